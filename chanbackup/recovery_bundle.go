@@ -0,0 +1,221 @@
+package chanbackup
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/lightningnetwork/lnd/keychain"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// RecoveryBundleVersion denotes the version of a recovery bundle. Based on
+// this version, we know how to pack/unpack serialized versions of the bundle.
+type RecoveryBundleVersion byte
+
+const (
+	// DefaultRecoveryBundleVersion is the default version of the recovery
+	// bundle. The serialized format of this version is: version ||
+	// multiLen || packedMulti || historyLen || packedHistory. Both the
+	// multi-chan backup and the address history are encrypted.
+	DefaultRecoveryBundleVersion = 0
+)
+
+// AddressHistorySource is an interface that allows us to query for all the
+// addresses a peer was ever known by.
+type AddressHistorySource interface {
+	// PeerAddressHistory returns all addresses the peer with the target
+	// public key was known by, from the most to the least recently seen.
+	PeerAddressHistory(nodePub *btcec.PublicKey) ([]net.Addr, error)
+}
+
+// RecoveryBundle is everything a fresh node needs to recover the channels of
+// a node that lost its data: the multi-chan backup of all its channels, and
+// the address history of their peers. The addresses stored within each
+// backup are only those known when it was created, which may be stale by the
+// time the backup is used, so the history raises the odds the peers can be
+// reached to let them force close the channels.
+type RecoveryBundle struct {
+	// Version is the version that should be observed when attempting to
+	// pack the recovery bundle.
+	Version RecoveryBundleVersion
+
+	// Multi is the multi-chan backup of all channels of the node.
+	Multi Multi
+
+	// AddrHistory maps the compressed public key of each peer with a
+	// channel within Multi to all addresses it was known by.
+	AddrHistory map[[33]byte][]net.Addr
+}
+
+// ExportRecoveryBundle assembles a recovery bundle from the backups of all
+// channels within the passed channel source, and the address history of their
+// peers, and packs it into the passed io.Writer.
+func ExportRecoveryBundle(w io.Writer, chanSource LiveChannelSource,
+	addrSource AddressHistorySource, keyRing keychain.KeyRing) error {
+
+	backups, err := FetchStaticChanBackups(chanSource)
+	if err != nil {
+		return err
+	}
+
+	bundle := RecoveryBundle{
+		Version: DefaultRecoveryBundleVersion,
+		Multi: Multi{
+			Version:       DefaultMultiVersion,
+			StaticBackups: backups,
+		},
+		AddrHistory: make(map[[33]byte][]net.Addr),
+	}
+	for _, backup := range backups {
+		var nodeKey [33]byte
+		copy(nodeKey[:], backup.RemoteNodePub.SerializeCompressed())
+		if _, ok := bundle.AddrHistory[nodeKey]; ok {
+			continue
+		}
+
+		addrs, err := addrSource.PeerAddressHistory(
+			backup.RemoteNodePub,
+		)
+		if err != nil {
+			return err
+		}
+		bundle.AddrHistory[nodeKey] = addrs
+	}
+
+	return bundle.PackToWriter(w, keyRing)
+}
+
+// PackToWriter packs (encrypts+serializes) the recovery bundle into the passed
+// io.Writer. This is the opposite of UnpackFromReader.
+func (b *RecoveryBundle) PackToWriter(w io.Writer,
+	keyRing keychain.KeyRing) error {
+
+	switch b.Version {
+	case DefaultRecoveryBundleVersion:
+	default:
+		return fmt.Errorf("unable to pack unknown recovery bundle "+
+			"version of %v", b.Version)
+	}
+
+	var packedMulti bytes.Buffer
+	if err := b.Multi.PackToWriter(&packedMulti, keyRing); err != nil {
+		return err
+	}
+
+	// The peers are written in the order of their public keys, such that
+	// the same history is always packed the same way.
+	nodeKeys := make([][33]byte, 0, len(b.AddrHistory))
+	for nodeKey := range b.AddrHistory {
+		nodeKeys = append(nodeKeys, nodeKey)
+	}
+	sort.Slice(nodeKeys, func(i, j int) bool {
+		return bytes.Compare(nodeKeys[i][:], nodeKeys[j][:]) < 0
+	})
+
+	var history bytes.Buffer
+	err := lnwire.WriteElements(&history, uint32(len(nodeKeys)))
+	if err != nil {
+		return err
+	}
+	for _, nodeKey := range nodeKeys {
+		err := lnwire.WriteElements(
+			&history, nodeKey[:], b.AddrHistory[nodeKey],
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	var packedHistory bytes.Buffer
+	err = encryptPayloadToWriter(history, &packedHistory, keyRing)
+	if err != nil {
+		return err
+	}
+
+	return lnwire.WriteElements(w,
+		byte(b.Version),
+		uint32(packedMulti.Len()), packedMulti.Bytes(),
+		uint32(packedHistory.Len()), packedHistory.Bytes(),
+	)
+}
+
+// UnpackFromReader attempts to unpack (decrypt+deserialize) a packed recovery
+// bundle from the passed io.Reader.
+func (b *RecoveryBundle) UnpackFromReader(r io.Reader,
+	keyRing keychain.KeyRing) error {
+
+	var version byte
+	if err := lnwire.ReadElements(r, &version); err != nil {
+		return err
+	}
+
+	b.Version = RecoveryBundleVersion(version)
+	switch b.Version {
+	case DefaultRecoveryBundleVersion:
+	default:
+		return fmt.Errorf("unable to unpack unknown recovery bundle "+
+			"version of %v", version)
+	}
+
+	packedMulti, err := readLengthPrefixed(r)
+	if err != nil {
+		return err
+	}
+	err = b.Multi.UnpackFromReader(bytes.NewReader(packedMulti), keyRing)
+	if err != nil {
+		return err
+	}
+
+	packedHistory, err := readLengthPrefixed(r)
+	if err != nil {
+		return err
+	}
+	history, err := decryptPayloadFromReader(
+		bytes.NewReader(packedHistory), keyRing,
+	)
+	if err != nil {
+		return err
+	}
+	historyReader := bytes.NewReader(history)
+
+	var numPeers uint32
+	if err := lnwire.ReadElements(historyReader, &numPeers); err != nil {
+		return err
+	}
+
+	b.AddrHistory = make(map[[33]byte][]net.Addr, numPeers)
+	for ; numPeers != 0; numPeers-- {
+		var (
+			nodeKey [33]byte
+			addrs   []net.Addr
+		)
+		err := lnwire.ReadElements(historyReader, nodeKey[:], &addrs)
+		if err != nil {
+			return err
+		}
+
+		b.AddrHistory[nodeKey] = addrs
+	}
+
+	return nil
+}
+
+// readLengthPrefixed reads a byte slice prefixed by its 4 byte length from the
+// passed io.Reader.
+func readLengthPrefixed(r io.Reader) ([]byte, error) {
+	var length uint32
+	if err := lnwire.ReadElements(r, &length); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, length)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
@@ -0,0 +1,124 @@
+package chanbackup
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+type mockAddrHistory map[[33]byte][]net.Addr
+
+func (m mockAddrHistory) PeerAddressHistory(
+	nodePub *btcec.PublicKey) ([]net.Addr, error) {
+
+	var nodeKey [33]byte
+	copy(nodeKey[:], nodePub.SerializeCompressed())
+
+	return m[nodeKey], nil
+}
+
+// TestRecoveryBundle tests that a recovery bundle exported from a channel
+// source can be unpacked into the backups of its channels, along with the
+// address history of their peers.
+func TestRecoveryBundle(t *testing.T) {
+	t.Parallel()
+
+	randomChan1, err := genRandomOpenChannelShell()
+	if err != nil {
+		t.Fatalf("unable to generate chan: %v", err)
+	}
+	randomChan2, err := genRandomOpenChannelShell()
+	if err != nil {
+		t.Fatalf("unable to generate chan: %v", err)
+	}
+
+	chanSource := newMockChannelSource()
+	chanSource.chans[randomChan1.FundingOutpoint] = randomChan1
+	chanSource.chans[randomChan2.FundingOutpoint] = randomChan2
+	chanSource.addAddrsForNode(randomChan1.IdentityPub, []net.Addr{addr1})
+	chanSource.addAddrsForNode(randomChan2.IdentityPub, []net.Addr{addr2})
+
+	// The first peer was known by another address before, while the
+	// second one hasn't changed its address.
+	var nodeKey1, nodeKey2 [33]byte
+	copy(nodeKey1[:], randomChan1.IdentityPub.SerializeCompressed())
+	copy(nodeKey2[:], randomChan2.IdentityPub.SerializeCompressed())
+	addrHistory := map[[33]byte][]net.Addr{
+		nodeKey1: {addr1, addr2},
+		nodeKey2: {addr2},
+	}
+
+	keyRing := &mockKeyRing{}
+
+	var b bytes.Buffer
+	err = ExportRecoveryBundle(
+		&b, chanSource, mockAddrHistory(addrHistory), keyRing,
+	)
+	if err != nil {
+		t.Fatalf("unable to export recovery bundle: %v", err)
+	}
+
+	var bundle RecoveryBundle
+	err = bundle.UnpackFromReader(bytes.NewReader(b.Bytes()), keyRing)
+	if err != nil {
+		t.Fatalf("unable to unpack recovery bundle: %v", err)
+	}
+
+	if bundle.Version != DefaultRecoveryBundleVersion {
+		t.Fatalf("expected version %v, got %v",
+			DefaultRecoveryBundleVersion, bundle.Version)
+	}
+	if len(bundle.AddrHistory) != len(addrHistory) {
+		t.Fatalf("expected history of %v peers, got %v",
+			len(addrHistory), len(bundle.AddrHistory))
+	}
+	for nodeKey, addrs := range addrHistory {
+		var expected, unpacked []string
+		for _, addr := range addrs {
+			expected = append(expected, addr.String())
+		}
+		for _, addr := range bundle.AddrHistory[nodeKey] {
+			unpacked = append(unpacked, addr.String())
+		}
+		if !reflect.DeepEqual(expected, unpacked) {
+			t.Fatalf("address history mismatch for %x: expected "+
+				"%v, got %v", nodeKey, expected, unpacked)
+		}
+	}
+
+	backups := bundle.Multi.StaticBackups
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups, got %v", len(backups))
+	}
+	for _, backup := range backups {
+		channel, ok := chanSource.chans[backup.FundingOutpoint]
+		if !ok {
+			t.Fatalf("unknown backup for %v",
+				backup.FundingOutpoint)
+		}
+
+		expected, err := FetchBackupForChan(
+			channel.FundingOutpoint, chanSource,
+		)
+		if err != nil {
+			t.Fatalf("unable to fetch backup: %v", err)
+		}
+		assertSingleEqual(t, *expected, backup)
+	}
+
+	// A bundle of an unknown version should be rejected.
+	bundle.Version = DefaultRecoveryBundleVersion + 1
+	if err := bundle.PackToWriter(&b, keyRing); err == nil {
+		t.Fatalf("expected packing unknown version to fail")
+	}
+
+	packed := append([]byte(nil), b.Bytes()...)
+	packed[0] = DefaultRecoveryBundleVersion + 1
+	err = bundle.UnpackFromReader(bytes.NewReader(packed), keyRing)
+	if err == nil {
+		t.Fatalf("expected unpacking unknown version to fail")
+	}
+}
@@ -0,0 +1,318 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/btcsuite/btcutil"
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// acceptorLogBucket is the top-level bucket that stores the decisions
+	// of the channel acceptor on inbound channel open requests.
+	acceptorLogBucket = []byte("acceptor-log")
+
+	// acceptorLogTimeKey is the sub-bucket of the acceptor log holding
+	// each decision keyed by the time it was made, followed by a sequence
+	// number to keep decisions made at the same time apart.
+	//
+	// maps: decisionTime || seqNo => decision
+	acceptorLogTimeKey = []byte("by-time")
+
+	// acceptorLogPeerKey is the sub-bucket of the acceptor log that
+	// indexes decisions by the peer that requested the channel.
+	//
+	// maps: peerPub => decisionTime || seqNo => nil
+	acceptorLogPeerKey = []byte("by-peer")
+
+	// ErrAcceptorRuleTooLong is returned when recording a decision of the
+	// channel acceptor whose rule exceeds MaxAcceptorRuleLen.
+	ErrAcceptorRuleTooLong = fmt.Errorf("acceptor rule exceeds max "+
+		"length of %v", MaxAcceptorRuleLen)
+)
+
+const (
+	// MaxAcceptorLogAge is the time for which a decision of the channel
+	// acceptor is retained. Decisions made before this are trimmed as new
+	// ones are recorded.
+	MaxAcceptorLogAge = 30 * 24 * time.Hour
+
+	// MaxAcceptorRuleLen is the max length in bytes of the rule that a
+	// decision of the channel acceptor is attributed to.
+	MaxAcceptorRuleLen = 256
+
+	// acceptorLogKeyLen is the length of the key of a decision within the
+	// acceptor log.
+	acceptorLogKeyLen = 16
+)
+
+// AcceptorDecision is the decision of the channel acceptor on an inbound
+// channel open request.
+type AcceptorDecision struct {
+	// Time is the time the decision was made at.
+	Time time.Time
+
+	// Peer is the public key of the peer that requested the channel.
+	Peer [33]byte
+
+	// Capacity is the capacity of the requested channel.
+	Capacity btcutil.Amount
+
+	// Accepted is true if the request was accepted, and false if it was
+	// rejected.
+	Accepted bool
+
+	// Rule identifies the rule of the channel acceptor that the decision
+	// was made by, such as a min channel size or a list of allowed peers.
+	// It's empty if the request wasn't matched by any rule.
+	Rule string
+}
+
+// RecordAcceptorDecision adds the decision of the channel acceptor to the
+// acceptor log. Any decisions within the log that are older than
+// MaxAcceptorLogAge relative to the new one are trimmed along the way.
+func (d *DB) RecordAcceptorDecision(decision *AcceptorDecision) error {
+	if len(decision.Rule) > MaxAcceptorRuleLen {
+		return ErrAcceptorRuleTooLong
+	}
+
+	var b bytes.Buffer
+	if err := serializeAcceptorDecision(&b, decision); err != nil {
+		return err
+	}
+
+	return d.Batch(func(tx *bbolt.Tx) error {
+		acceptorLog, err := tx.CreateBucketIfNotExists(
+			acceptorLogBucket,
+		)
+		if err != nil {
+			return err
+		}
+		byTime, err := acceptorLog.CreateBucketIfNotExists(
+			acceptorLogTimeKey,
+		)
+		if err != nil {
+			return err
+		}
+		byPeer, err := acceptorLog.CreateBucketIfNotExists(
+			acceptorLogPeerKey,
+		)
+		if err != nil {
+			return err
+		}
+		peerIndex, err := byPeer.CreateBucketIfNotExists(
+			decision.Peer[:],
+		)
+		if err != nil {
+			return err
+		}
+
+		seqNo, err := byTime.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		var key [acceptorLogKeyLen]byte
+		byteOrder.PutUint64(key[:8], uint64(decision.Time.UnixNano()))
+		byteOrder.PutUint64(key[8:], seqNo)
+		if err := byTime.Put(key[:], b.Bytes()); err != nil {
+			return err
+		}
+		if err := peerIndex.Put(key[:], nil); err != nil {
+			return err
+		}
+
+		return trimAcceptorLog(
+			byTime, byPeer, decision.Time.Add(-MaxAcceptorLogAge),
+		)
+	})
+}
+
+// AcceptorDecisions returns the decisions of the channel acceptor made within
+// the inclusive time range, in the order they were made.
+func (d *DB) AcceptorDecisions(start, end time.Time) ([]AcceptorDecision,
+	error) {
+
+	var decisions []AcceptorDecision
+	err := d.View(func(tx *bbolt.Tx) error {
+		decisions = nil
+
+		acceptorLog := tx.Bucket(acceptorLogBucket)
+		if acceptorLog == nil {
+			return nil
+		}
+		byTime := acceptorLog.Bucket(acceptorLogTimeKey)
+		if byTime == nil {
+			return nil
+		}
+
+		startKey, endKey := acceptorLogRange(start, end)
+
+		c := byTime.Cursor()
+		for k, v := c.Seek(startKey[:]); k != nil &&
+			bytes.Compare(k[:8], endKey[:]) <= 0; k, v = c.Next() {
+
+			decision, err := fetchAcceptorDecision(k, v)
+			if err != nil {
+				return err
+			}
+			decisions = append(decisions, *decision)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return decisions, nil
+}
+
+// PeerAcceptorDecisions returns the decisions of the channel acceptor on the
+// open requests of the peer made within the inclusive time range, in the
+// order they were made.
+func (d *DB) PeerAcceptorDecisions(pub [33]byte, start,
+	end time.Time) ([]AcceptorDecision, error) {
+
+	var decisions []AcceptorDecision
+	err := d.View(func(tx *bbolt.Tx) error {
+		decisions = nil
+
+		acceptorLog := tx.Bucket(acceptorLogBucket)
+		if acceptorLog == nil {
+			return nil
+		}
+		byTime := acceptorLog.Bucket(acceptorLogTimeKey)
+		byPeer := acceptorLog.Bucket(acceptorLogPeerKey)
+		if byTime == nil || byPeer == nil {
+			return nil
+		}
+		peerIndex := byPeer.Bucket(pub[:])
+		if peerIndex == nil {
+			return nil
+		}
+
+		startKey, endKey := acceptorLogRange(start, end)
+
+		c := peerIndex.Cursor()
+		for k, _ := c.Seek(startKey[:]); k != nil &&
+			bytes.Compare(k[:8], endKey[:]) <= 0; k, _ = c.Next() {
+
+			v := byTime.Get(k)
+			if v == nil {
+				return fmt.Errorf("acceptor decision %x not "+
+					"found", k)
+			}
+
+			decision, err := fetchAcceptorDecision(k, v)
+			if err != nil {
+				return err
+			}
+			decisions = append(decisions, *decision)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return decisions, nil
+}
+
+// acceptorLogRange returns the keys to bound the inclusive time range of an
+// acceptor log query by. Only the first 8 bytes of a key should be compared
+// against the end.
+func acceptorLogRange(start, end time.Time) ([8]byte, [8]byte) {
+	var startKey, endKey [8]byte
+	byteOrder.PutUint64(startKey[:], uint64(start.UnixNano()))
+	byteOrder.PutUint64(endKey[:], uint64(end.UnixNano()))
+
+	return startKey, endKey
+}
+
+// trimAcceptorLog removes all decisions made before the cutoff from the
+// acceptor log, along with their entries in the peer index.
+func trimAcceptorLog(byTime, byPeer *bbolt.Bucket, cutoff time.Time) error {
+	var cutoffKey [8]byte
+	byteOrder.PutUint64(cutoffKey[:], uint64(cutoff.UnixNano()))
+
+	c := byTime.Cursor()
+	for k, v := c.First(); k != nil &&
+		bytes.Compare(k[:8], cutoffKey[:]) < 0; k, v = c.First() {
+
+		decision, err := fetchAcceptorDecision(k, v)
+		if err != nil {
+			return err
+		}
+
+		peerIndex := byPeer.Bucket(decision.Peer[:])
+		if peerIndex != nil {
+			if err := peerIndex.Delete(k); err != nil {
+				return err
+			}
+
+			// Drop the index of a peer once none of its decisions
+			// are left.
+			first, _ := peerIndex.Cursor().First()
+			if first == nil {
+				err := byPeer.DeleteBucket(decision.Peer[:])
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetchAcceptorDecision deserializes the decision stored under the key within
+// the acceptor log.
+func fetchAcceptorDecision(k, v []byte) (*AcceptorDecision, error) {
+	if len(k) != acceptorLogKeyLen {
+		return nil, fmt.Errorf("invalid acceptor log key %x", k)
+	}
+
+	decision, err := deserializeAcceptorDecision(bytes.NewReader(v))
+	if err != nil {
+		return nil, err
+	}
+	decision.Time = time.Unix(0, int64(byteOrder.Uint64(k[:8])))
+
+	return decision, nil
+}
+
+// serializeAcceptorDecision writes the decision to w. The time of the
+// decision isn't serialized, as it's part of its key within the acceptor log.
+func serializeAcceptorDecision(w io.Writer, d *AcceptorDecision) error {
+	if _, err := w.Write(d.Peer[:]); err != nil {
+		return err
+	}
+
+	return WriteElements(w, d.Capacity, d.Accepted, []byte(d.Rule))
+}
+
+// deserializeAcceptorDecision reads a decision serialized by
+// serializeAcceptorDecision from r.
+func deserializeAcceptorDecision(r io.Reader) (*AcceptorDecision, error) {
+	d := &AcceptorDecision{}
+	if _, err := io.ReadFull(r, d.Peer[:]); err != nil {
+		return nil, err
+	}
+
+	var rule []byte
+	if err := ReadElements(r, &d.Capacity, &d.Accepted, &rule); err != nil {
+		return nil, err
+	}
+	d.Rule = string(rule)
+
+	return d, nil
+}
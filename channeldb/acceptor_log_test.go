@@ -0,0 +1,114 @@
+package channeldb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAcceptorLog asserts that decisions of the channel acceptor can be
+// queried by time and by peer, and that they're trimmed once they're too old.
+func TestAcceptorLog(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+
+	var peerA, peerB [33]byte
+	peerA[0], peerB[0] = 2, 3
+	now := time.Unix(1500000000, 0)
+
+	decisions := []AcceptorDecision{
+		{
+			Time:     now,
+			Peer:     peerA,
+			Capacity: 10000,
+			Rule:     "min-chan-size",
+		},
+		{
+			Time:     now,
+			Peer:     peerB,
+			Capacity: 500000,
+			Accepted: true,
+			Rule:     "allowed-peers",
+		},
+		{
+			Time:     now.Add(time.Minute),
+			Peer:     peerA,
+			Capacity: 500000,
+			Accepted: true,
+		},
+	}
+	for i := range decisions {
+		if err := db.RecordAcceptorDecision(&decisions[i]); err != nil {
+			t.Fatalf("unable to record decision: %v", err)
+		}
+	}
+
+	assertDecisions := func(result []AcceptorDecision, err error,
+		expected []AcceptorDecision) {
+
+		t.Helper()
+
+		if err != nil {
+			t.Fatalf("unable to fetch decisions: %v", err)
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("expected decisions %v, got %v", expected,
+				result)
+		}
+	}
+
+	result, err := db.AcceptorDecisions(now, now.Add(time.Minute))
+	assertDecisions(result, err, decisions)
+	result, err = db.AcceptorDecisions(now, now)
+	assertDecisions(result, err, decisions[:2])
+	result, err = db.AcceptorDecisions(
+		now.Add(time.Hour), now.Add(2*time.Hour),
+	)
+	assertDecisions(result, err, nil)
+
+	result, err = db.PeerAcceptorDecisions(peerA, now, now.Add(time.Hour))
+	assertDecisions(result, err, []AcceptorDecision{
+		decisions[0], decisions[2],
+	})
+	result, err = db.PeerAcceptorDecisions(
+		peerA, now.Add(time.Minute), now.Add(time.Hour),
+	)
+	assertDecisions(result, err, decisions[2:])
+	result, err = db.PeerAcceptorDecisions(peerB, now, now.Add(time.Hour))
+	assertDecisions(result, err, decisions[1:2])
+
+	// Recording a decision past the retention period trims all decisions
+	// made before it, along with the index of peers without any decisions
+	// left.
+	later := AcceptorDecision{
+		Time:     now.Add(MaxAcceptorLogAge + time.Second),
+		Peer:     peerA,
+		Capacity: 20000,
+		Rule:     "min-chan-size",
+	}
+	if err := db.RecordAcceptorDecision(&later); err != nil {
+		t.Fatalf("unable to record decision: %v", err)
+	}
+	result, err = db.AcceptorDecisions(now, later.Time)
+	assertDecisions(result, err, []AcceptorDecision{later})
+	result, err = db.PeerAcceptorDecisions(peerA, now, later.Time)
+	assertDecisions(result, err, []AcceptorDecision{later})
+	result, err = db.PeerAcceptorDecisions(peerB, now, later.Time)
+	assertDecisions(result, err, nil)
+
+	tooLong := AcceptorDecision{
+		Time: now,
+		Peer: peerA,
+		Rule: strings.Repeat("a", MaxAcceptorRuleLen+1),
+	}
+	err = db.RecordAcceptorDecision(&tooLong)
+	if err != ErrAcceptorRuleTooLong {
+		t.Fatalf("expected ErrAcceptorRuleTooLong, got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package channeldb
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+var (
+	// ErrAmountOverflow is returned when an aggregated amount exceeds the
+	// range of a uint64, rather than silently wrapping around.
+	ErrAmountOverflow = fmt.Errorf("aggregated amount overflows uint64")
+
+	// ErrAmountUnderflow is returned when an amount is subtracted from a
+	// smaller one, rather than silently wrapping around.
+	ErrAmountUnderflow = fmt.Errorf("subtracted amount exceeds total")
+)
+
+// addAmount returns the sum of the passed amounts, or ErrAmountOverflow if
+// the sum doesn't fit within a uint64.
+func addAmount(total, amt lnwire.MilliSatoshi) (lnwire.MilliSatoshi, error) {
+	if amt > math.MaxUint64-total {
+		return 0, ErrAmountOverflow
+	}
+
+	return total + amt, nil
+}
+
+// subAmount returns the difference of the passed amounts, or
+// ErrAmountUnderflow if amt exceeds total.
+func subAmount(total, amt lnwire.MilliSatoshi) (lnwire.MilliSatoshi, error) {
+	if amt > total {
+		return 0, ErrAmountUnderflow
+	}
+
+	return total - amt, nil
+}
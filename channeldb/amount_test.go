@@ -0,0 +1,70 @@
+package channeldb
+
+import (
+	"math"
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestAddAmount asserts that sums of amounts are only returned if they fit
+// within a uint64.
+func TestAddAmount(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		total, amt lnwire.MilliSatoshi
+		sum        lnwire.MilliSatoshi
+		err        error
+	}{
+		{total: 0, amt: 0, sum: 0},
+		{total: 1000, amt: 10, sum: 1010},
+		{total: math.MaxUint64 - 1, amt: 1, sum: math.MaxUint64},
+		{total: math.MaxUint64, amt: 1, err: ErrAmountOverflow},
+		{
+			total: math.MaxUint64/2 + 1,
+			amt:   math.MaxUint64/2 + 1,
+			err:   ErrAmountOverflow,
+		},
+	}
+	for _, test := range tests {
+		sum, err := addAmount(test.total, test.amt)
+		if err != test.err {
+			t.Fatalf("adding %v to %v: expected error %v, got %v",
+				test.amt, test.total, test.err, err)
+		}
+		if sum != test.sum {
+			t.Fatalf("adding %v to %v: expected %v, got %v",
+				test.amt, test.total, test.sum, sum)
+		}
+	}
+}
+
+// TestSubAmount asserts that differences of amounts are only returned if the
+// subtracted amount doesn't exceed the total.
+func TestSubAmount(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		total, amt lnwire.MilliSatoshi
+		diff       lnwire.MilliSatoshi
+		err        error
+	}{
+		{total: 0, amt: 0, diff: 0},
+		{total: 1010, amt: 10, diff: 1000},
+		{total: math.MaxUint64, amt: math.MaxUint64, diff: 0},
+		{total: 0, amt: 1, err: ErrAmountUnderflow},
+		{total: 1000, amt: 1010, err: ErrAmountUnderflow},
+	}
+	for _, test := range tests {
+		diff, err := subAmount(test.total, test.amt)
+		if err != test.err {
+			t.Fatalf("subtracting %v from %v: expected error %v, "+
+				"got %v", test.amt, test.total, test.err, err)
+		}
+		if diff != test.diff {
+			t.Fatalf("subtracting %v from %v: expected %v, got %v",
+				test.amt, test.total, test.diff, diff)
+		}
+	}
+}
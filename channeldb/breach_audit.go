@@ -0,0 +1,89 @@
+package channeldb
+
+import (
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// BreachInfo describes an open channel whose stored remote commitment has
+// already been revoked, in which case the peer could broadcast a revoked
+// state we may not hold the justice data for.
+type BreachInfo struct {
+	// ChanPoint is the funding outpoint of the channel.
+	ChanPoint wire.OutPoint
+
+	// ShortChannelID is the short channel ID of the channel.
+	ShortChannelID lnwire.ShortChannelID
+
+	// RemotePub is the identity public key of the channel's peer.
+	RemotePub *btcec.PublicKey
+
+	// RemoteCommitHeight is the height of the remote commitment stored as
+	// the peer's current one.
+	RemoteCommitHeight uint64
+
+	// RevokedHeight is the height of the latest remote commitment found
+	// within the revocation log of the channel.
+	RevokedHeight uint64
+}
+
+// BreachableChannels returns all open channels whose stored remote commitment
+// height isn't past the head of their revocation log. As the revocation log
+// only holds remote commitments that were revoked, the current remote
+// commitment of a consistent channel is always ahead of it. Otherwise, the
+// channel state was likely restored from a stale copy of the database.
+func (d *DB) BreachableChannels() ([]BreachInfo, error) {
+	var breachable []BreachInfo
+	err := d.View(func(tx *bbolt.Tx) error {
+		openChanBucket := tx.Bucket(openChannelBucket)
+		if openChanBucket == nil {
+			return nil
+		}
+
+		return forEachChanBucket(openChanBucket, func(op wire.OutPoint,
+			chanBucket *bbolt.Bucket) error {
+
+			logBucket := chanBucket.Bucket(revocationLogBucket)
+			if logBucket == nil {
+				return nil
+			}
+			logKey, _ := logBucket.Cursor().Last()
+			if logKey == nil {
+				return nil
+			}
+			revokedHeight := readLogKey(logKey)
+
+			remoteCommit, err := fetchChanCommitment(
+				chanBucket, false,
+			)
+			if err != nil {
+				return err
+			}
+			if remoteCommit.CommitHeight > revokedHeight {
+				return nil
+			}
+
+			channel, err := fetchChanLite(chanBucket)
+			if err != nil {
+				return err
+			}
+
+			breachable = append(breachable, BreachInfo{
+				ChanPoint:          op,
+				ShortChannelID:     channel.ShortChannelID,
+				RemotePub:          channel.IdentityPub,
+				RemoteCommitHeight: remoteCommit.CommitHeight,
+				RevokedHeight:      revokedHeight,
+			})
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return breachable, nil
+}
@@ -0,0 +1,107 @@
+package channeldb
+
+import (
+	"net"
+	"testing"
+
+	"github.com/coreos/bbolt"
+)
+
+// TestBreachableChannels asserts that only channels whose stored remote
+// commitment isn't ahead of their revocation log are reported.
+func TestBreachableChannels(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	addr := &net.TCPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 18555,
+	}
+
+	// We'll create three channels: one without any revoked states, one
+	// whose remote commitment follows its revocation log, and one whose
+	// remote commitment lags behind it.
+	var channels []*OpenChannel
+	for i := 0; i < 3; i++ {
+		channel, err := createTestChannelState(cdb)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		if err := channel.SyncPending(addr, 101); err != nil {
+			t.Fatalf("unable to sync channel: %v", err)
+		}
+		channels = append(channels, channel)
+	}
+
+	writeLog := func(channel *OpenChannel, remoteHeight uint64,
+		revokedHeights ...uint64) {
+
+		t.Helper()
+
+		err := cdb.Update(func(tx *bbolt.Tx) error {
+			chanBucket, err := fetchChanBucket(
+				tx, channel.IdentityPub,
+				&channel.FundingOutpoint, channel.ChainHash,
+			)
+			if err != nil {
+				return err
+			}
+			logBucket, err := chanBucket.CreateBucketIfNotExists(
+				revocationLogBucket,
+			)
+			if err != nil {
+				return err
+			}
+
+			commit := channel.RemoteCommitment
+			for _, height := range revokedHeights {
+				commit.CommitHeight = height
+				err := appendChannelLogEntry(logBucket, &commit)
+				if err != nil {
+					return err
+				}
+			}
+
+			commit.CommitHeight = remoteHeight
+			return putChanCommitment(chanBucket, &commit, false)
+		})
+		if err != nil {
+			t.Fatalf("unable to write revocation log: %v", err)
+		}
+	}
+	writeLog(channels[1], 3, 0, 1, 2)
+	writeLog(channels[2], 1, 0, 1, 2)
+
+	breachable, err := cdb.BreachableChannels()
+	if err != nil {
+		t.Fatalf("unable to fetch breachable channels: %v", err)
+	}
+	if len(breachable) != 1 {
+		t.Fatalf("expected 1 breachable channel, got %v",
+			len(breachable))
+	}
+
+	info := breachable[0]
+	if info.ChanPoint != channels[2].FundingOutpoint {
+		t.Fatalf("expected channel %v, got %v",
+			channels[2].FundingOutpoint, info.ChanPoint)
+	}
+	if info.ShortChannelID != channels[2].ShortChannelID {
+		t.Fatalf("expected short channel id %v, got %v",
+			channels[2].ShortChannelID, info.ShortChannelID)
+	}
+	if !info.RemotePub.IsEqual(channels[2].IdentityPub) {
+		t.Fatalf("unexpected remote pub %x",
+			info.RemotePub.SerializeCompressed())
+	}
+	if info.RemoteCommitHeight != 1 || info.RevokedHeight != 2 {
+		t.Fatalf("expected remote height 1 and revoked height 2, "+
+			"got %v and %v", info.RemoteCommitHeight,
+			info.RevokedHeight)
+	}
+}
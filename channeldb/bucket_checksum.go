@@ -0,0 +1,224 @@
+package channeldb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// checksumBucket is the top-level bucket that stores the checksums of
+	// the buckets for which checksums were enabled. The checksum of a
+	// bucket is the XOR of the SHA-256 hashes of all of its key/value
+	// pairs, such that it can be updated incrementally as pairs are
+	// written, regardless of the order they were written in. Nested
+	// buckets aren't covered.
+	//
+	// maps: bucketName => checksum
+	checksumBucket = []byte("bucket-checksums")
+
+	// checksummableBuckets are the top-level buckets for which checksums
+	// can be enabled. Each of their write paths must go through
+	// checksumPut, such that the checksum never lags behind the contents
+	// of the bucket.
+	checksummableBuckets = [][]byte{
+		paymentBucket,
+		forwardingLogBucket,
+	}
+
+	// ErrChecksumUnsupported is returned when attempting to enable the
+	// checksum of a bucket whose writes don't maintain a checksum.
+	ErrChecksumUnsupported = fmt.Errorf("bucket doesn't support checksums")
+
+	// ErrChecksumNotEnabled is returned when attempting to verify the
+	// checksum of a bucket for which checksums aren't enabled.
+	ErrChecksumNotEnabled = fmt.Errorf("bucket checksum not enabled")
+
+	// ErrChecksumMismatch is returned when the checksum recomputed from the
+	// contents of a bucket doesn't match the checksum stored for it,
+	// indicating that the bucket was corrupted.
+	ErrChecksumMismatch = fmt.Errorf("bucket checksum mismatch")
+)
+
+// EnableBucketChecksum starts maintaining a checksum of the top-level bucket
+// with the passed name, which from then on is updated along with every write
+// to the bucket. Maintaining the checksum requires hashing each written pair,
+// which is why checksums are opt-in. Only the buckets in checksummableBuckets
+// are supported, others are rejected with ErrChecksumUnsupported. Enabling
+// the checksum of a bucket that already has one recomputes it.
+func (d *DB) EnableBucketChecksum(name string) error {
+	if !isChecksummable([]byte(name)) {
+		return ErrChecksumUnsupported
+	}
+
+	return d.Update(func(tx *bbolt.Tx) error {
+		checksums, err := tx.CreateBucketIfNotExists(checksumBucket)
+		if err != nil {
+			return err
+		}
+
+		checksum, err := computeBucketChecksum(tx.Bucket([]byte(name)))
+		if err != nil {
+			return err
+		}
+
+		return checksums.Put([]byte(name), checksum[:])
+	})
+}
+
+// DisableBucketChecksum stops maintaining the checksum of the top-level bucket
+// with the passed name. It's a noop if the checksum isn't enabled.
+func (d *DB) DisableBucketChecksum(name string) error {
+	return d.Update(func(tx *bbolt.Tx) error {
+		checksums := tx.Bucket(checksumBucket)
+		if checksums == nil {
+			return nil
+		}
+
+		return checksums.Delete([]byte(name))
+	})
+}
+
+// VerifyBucketChecksum recomputes the checksum of the top-level bucket with
+// the passed name from its contents, and compares it to the one maintained
+// since the checksum was enabled. ErrChecksumMismatch is returned if the two
+// differ, meaning that the contents of the bucket changed outside of the
+// database's writes, for example due to silent disk corruption.
+func (d *DB) VerifyBucketChecksum(name string) error {
+	return d.View(func(tx *bbolt.Tx) error {
+		stored := fetchBucketChecksum(tx, []byte(name))
+		if stored == nil {
+			return ErrChecksumNotEnabled
+		}
+
+		checksum, err := computeBucketChecksum(tx.Bucket([]byte(name)))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(stored, checksum[:]) {
+			return ErrChecksumMismatch
+		}
+
+		return nil
+	})
+}
+
+// checksumPut writes the key/value pair to the passed bucket, which is the
+// top-level bucket with the given name. If the checksum of the bucket is
+// enabled, it's updated within the same transaction, replacing the hash of
+// any value previously stored under the key with that of the new one.
+func checksumPut(tx *bbolt.Tx, name []byte, b *bbolt.Bucket, k,
+	v []byte) error {
+
+	stored := fetchBucketChecksum(tx, name)
+	if stored == nil {
+		return b.Put(k, v)
+	}
+
+	var checksum [sha256.Size]byte
+	copy(checksum[:], stored)
+
+	if old := b.Get(k); old != nil {
+		xorChecksum(&checksum, k, old)
+	}
+	xorChecksum(&checksum, k, v)
+
+	if err := b.Put(k, v); err != nil {
+		return err
+	}
+
+	return tx.Bucket(checksumBucket).Put(name, checksum[:])
+}
+
+// refreshBucketChecksums recomputes the checksums of all buckets for which
+// checksums are enabled. It must be called by writes that rewrite a bucket
+// without going through checksumPut, such as migrations.
+func refreshBucketChecksums(tx *bbolt.Tx) error {
+	checksums := tx.Bucket(checksumBucket)
+	if checksums == nil {
+		return nil
+	}
+
+	var names [][]byte
+	err := checksums.ForEach(func(name, _ []byte) error {
+		names = append(names, append([]byte(nil), name...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		checksum, err := computeBucketChecksum(tx.Bucket(name))
+		if err != nil {
+			return err
+		}
+		if err := checksums.Put(name, checksum[:]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetchBucketChecksum returns the checksum stored for the top-level bucket
+// with the passed name, or nil if its checksum isn't enabled.
+func fetchBucketChecksum(tx *bbolt.Tx, name []byte) []byte {
+	checksums := tx.Bucket(checksumBucket)
+	if checksums == nil {
+		return nil
+	}
+
+	return checksums.Get(name)
+}
+
+// computeBucketChecksum computes the checksum of the passed bucket from all of
+// its key/value pairs. A missing bucket has the zero checksum, the same as an
+// empty one.
+func computeBucketChecksum(b *bbolt.Bucket) ([sha256.Size]byte, error) {
+	var checksum [sha256.Size]byte
+	if b == nil {
+		return checksum, nil
+	}
+
+	err := b.ForEach(func(k, v []byte) error {
+		if v != nil {
+			xorChecksum(&checksum, k, v)
+		}
+		return nil
+	})
+
+	return checksum, err
+}
+
+// xorChecksum folds the hash of the key/value pair into the checksum. As XOR
+// is its own inverse, folding the same pair in again removes it.
+func xorChecksum(checksum *[sha256.Size]byte, k, v []byte) {
+	var keyLen [4]byte
+	byteOrder.PutUint32(keyLen[:], uint32(len(k)))
+
+	h := sha256.New()
+	h.Write(keyLen[:])
+	h.Write(k)
+	h.Write(v)
+
+	var entryHash [sha256.Size]byte
+	copy(entryHash[:], h.Sum(nil))
+	for i := range checksum {
+		checksum[i] ^= entryHash[i]
+	}
+}
+
+// isChecksummable returns whether checksums can be enabled for the top-level
+// bucket with the passed name.
+func isChecksummable(name []byte) bool {
+	for _, b := range checksummableBuckets {
+		if bytes.Equal(b, name) {
+			return true
+		}
+	}
+
+	return false
+}
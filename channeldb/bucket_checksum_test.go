@@ -0,0 +1,119 @@
+package channeldb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestBucketChecksum asserts that the checksum of an enabled bucket keeps up
+// with the writes to the bucket, and detects changes made outside of them.
+func TestBucketChecksum(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	payments := string(paymentBucket)
+	if err := db.EnableBucketChecksum("invoices"); err !=
+		ErrChecksumUnsupported {
+
+		t.Fatalf("expected ErrChecksumUnsupported, got %v", err)
+	}
+	if err := db.VerifyBucketChecksum(payments); err !=
+		ErrChecksumNotEnabled {
+
+		t.Fatalf("expected ErrChecksumNotEnabled, got %v", err)
+	}
+
+	addPayment := func() {
+		t.Helper()
+
+		payment, err := makeRandomFakePayment()
+		if err != nil {
+			t.Fatalf("unable to create payment: %v", err)
+		}
+		if err := db.AddPayment(payment); err != nil {
+			t.Fatalf("unable to add payment: %v", err)
+		}
+	}
+
+	assertChecksum := func(name string, expected error) {
+		t.Helper()
+
+		if err := db.VerifyBucketChecksum(name); err != expected {
+			t.Fatalf("expected %v, got %v", expected, err)
+		}
+	}
+
+	// A payment added before the checksum is enabled must be covered by
+	// the initial checksum, and later ones by its updates.
+	addPayment()
+	if err := db.EnableBucketChecksum(payments); err != nil {
+		t.Fatalf("unable to enable checksum: %v", err)
+	}
+	assertChecksum(payments, nil)
+
+	addPayment()
+	addPayment()
+	assertChecksum(payments, nil)
+
+	// Flipping a bit of a stored payment behind the database's back must
+	// be detected.
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(paymentBucket)
+		k, v := bucket.Cursor().First()
+		corrupted := append([]byte(nil), v...)
+		corrupted[0] ^= 1
+		return bucket.Put(k, corrupted)
+	})
+	if err != nil {
+		t.Fatalf("unable to corrupt payment: %v", err)
+	}
+	assertChecksum(payments, ErrChecksumMismatch)
+
+	// Re-enabling the checksum accepts the current contents, and deleting
+	// all payments leaves it in sync.
+	if err := db.EnableBucketChecksum(payments); err != nil {
+		t.Fatalf("unable to enable checksum: %v", err)
+	}
+	assertChecksum(payments, nil)
+	if err := db.DeleteAllPayments(); err != nil {
+		t.Fatalf("unable to delete payments: %v", err)
+	}
+	assertChecksum(payments, nil)
+
+	if err := db.DisableBucketChecksum(payments); err != nil {
+		t.Fatalf("unable to disable checksum: %v", err)
+	}
+	assertChecksum(payments, ErrChecksumNotEnabled)
+
+	// Overwriting a forwarding event that shares its timestamp with an
+	// earlier one must replace the earlier event within the checksum.
+	fwdLog := string(forwardingLogBucket)
+	if err := db.EnableBucketChecksum(fwdLog); err != nil {
+		t.Fatalf("unable to enable checksum: %v", err)
+	}
+
+	log := ForwardingLog{
+		db: db,
+	}
+	for _, amt := range []lnwire.MilliSatoshi{1000, 2000} {
+		err := log.AddForwardingEvents([]ForwardingEvent{{
+			Timestamp:      time.Unix(1234, 0),
+			IncomingChanID: lnwire.NewShortChanIDFromInt(1),
+			OutgoingChanID: lnwire.NewShortChanIDFromInt(2),
+			AmtIn:          amt + 1,
+			AmtOut:         amt,
+		}})
+		if err != nil {
+			t.Fatalf("unable to add event: %v", err)
+		}
+	}
+	assertChecksum(fwdLog, nil)
+}
@@ -0,0 +1,34 @@
+package channeldb
+
+import (
+	"github.com/coreos/bbolt"
+)
+
+// BucketSizes returns the approximate number of bytes each top-level bucket
+// occupies on disk, keyed by the name of the bucket. The size of a bucket
+// includes all of its nested buckets, and is the size of the pages allocated
+// to it as reported by bolt's B+tree statistics. A bucket small enough to be
+// stored inline within the root page occupies no pages of its own, so it's
+// attributed the bytes used by its keys and values instead. Free pages aren't
+// attributed to any bucket, see Fragmentation for those.
+func (d *DB) BucketSizes() (map[string]uint64, error) {
+	sizes := make(map[string]uint64)
+	err := d.View(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			stats := b.Stats()
+
+			size := stats.BranchAlloc + stats.LeafAlloc
+			if size == 0 {
+				size = stats.InlineBucketInuse
+			}
+			sizes[string(name)] = uint64(size)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sizes, nil
+}
@@ -0,0 +1,71 @@
+package channeldb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/coreos/bbolt"
+)
+
+// TestBucketSizes asserts that the data stored within nested buckets is
+// attributed to their top-level bucket, and that small inline buckets are
+// reported by the size of their contents.
+func TestBucketSizes(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+
+	// The large bucket only holds data within a nested bucket, while the
+	// small bucket holds a single small value.
+	largeBucket := []byte("test-large-bucket")
+	smallBucket := []byte("test-small-bucket")
+	value := bytes.Repeat([]byte{1}, 1024)
+	err = db.Update(func(tx *bbolt.Tx) error {
+		parent, err := tx.CreateBucket(largeBucket)
+		if err != nil {
+			return err
+		}
+		nested, err := parent.CreateBucket([]byte("nested"))
+		if err != nil {
+			return err
+		}
+		for i := uint32(0); i < 1000; i++ {
+			var k [4]byte
+			byteOrder.PutUint32(k[:], i)
+			if err := nested.Put(k[:], value); err != nil {
+				return err
+			}
+		}
+
+		small, err := tx.CreateBucket(smallBucket)
+		if err != nil {
+			return err
+		}
+		return small.Put([]byte("k"), []byte("v"))
+	})
+	if err != nil {
+		t.Fatalf("unable to populate buckets: %v", err)
+	}
+
+	sizes, err := db.BucketSizes()
+	if err != nil {
+		t.Fatalf("unable to fetch bucket sizes: %v", err)
+	}
+
+	minSize := uint64(1000 * len(value))
+	if sizes[string(largeBucket)] < minSize {
+		t.Fatalf("expected large bucket to occupy at least %v bytes, "+
+			"got %v", minSize, sizes[string(largeBucket)])
+	}
+
+	smallSize := sizes[string(smallBucket)]
+	pageSize := uint64(db.bdb.Info().PageSize)
+	if smallSize == 0 || smallSize > pageSize {
+		t.Fatalf("expected small bucket to occupy up to %v bytes, "+
+			"got %v", pageSize, smallSize)
+	}
+}
@@ -0,0 +1,206 @@
+package channeldb
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// ErrCapacityMismatch is returned when the capacity stored for a
+	// channel doesn't match the value of its funding output.
+	ErrCapacityMismatch = fmt.Errorf("stored channel capacity doesn't " +
+		"match funding output value")
+)
+
+// CapacityMismatch describes an open channel whose stored capacity disagrees
+// with the value of its funding output.
+type CapacityMismatch struct {
+	// ChanPoint is the funding outpoint of the channel.
+	ChanPoint wire.OutPoint
+
+	// Stored is the capacity stored within the channel's info.
+	Stored btcutil.Amount
+
+	// Actual is the value of the channel's funding output.
+	Actual btcutil.Amount
+}
+
+// CapacityReport summarizes a cross-check of the stored capacity of all open
+// channels against the values of their funding outputs.
+type CapacityReport struct {
+	// Checked is the number of open channels whose capacity was checked.
+	Checked int
+
+	// Mismatches holds each channel whose stored capacity didn't match the
+	// value of its funding output.
+	Mismatches []CapacityMismatch
+}
+
+// VerifyChannelCapacity checks that the capacity stored for the open channel
+// with the passed funding outpoint matches actual, the value of its funding
+// output. ErrCapacityMismatch is returned if it doesn't.
+func (d *DB) VerifyChannelCapacity(op wire.OutPoint,
+	actual btcutil.Amount) error {
+
+	var stored btcutil.Amount
+	err := d.View(func(tx *bbolt.Tx) error {
+		_, _, chanBucket, err := findChanBucket(tx, &op)
+		if err != nil {
+			return err
+		}
+
+		var channel OpenChannel
+		if err := fetchChanInfo(chanBucket, &channel); err != nil {
+			return err
+		}
+		stored = channel.Capacity
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if stored != actual {
+		return ErrCapacityMismatch
+	}
+
+	return nil
+}
+
+// RepairChannelCapacity sets the stored capacity of the open channel with the
+// passed funding outpoint to actual, the value of its funding output. If the
+// channel is known to the graph, the capacity of its edge is corrected within
+// the same transaction, such that both records always agree.
+func (d *DB) RepairChannelCapacity(op wire.OutPoint,
+	actual btcutil.Amount) error {
+
+	return d.Update(func(tx *bbolt.Tx) error {
+		_, _, chanBucket, err := findChanBucket(tx, &op)
+		if err != nil {
+			return err
+		}
+
+		var channel OpenChannel
+		if err := fetchChanInfo(chanBucket, &channel); err != nil {
+			return err
+		}
+		if channel.Capacity != actual {
+			log.Infof("Repairing capacity of channel %v from %v "+
+				"to %v", op, channel.Capacity, actual)
+
+			channel.Capacity = actual
+			err := putChanInfo(chanBucket, &channel)
+			if err != nil {
+				return err
+			}
+		}
+
+		return repairEdgeCapacity(tx, op, actual)
+	})
+}
+
+// VerifyAllCapacities cross-checks the stored capacity of every open channel
+// against the value of its funding output, as returned by lookup. Channels are
+// only reported, not repaired. The lookup is performed outside of any database
+// transaction, such that it may e.g. query the chain backend.
+func (d *DB) VerifyAllCapacities(
+	lookup func(wire.OutPoint) (btcutil.Amount, error)) (*CapacityReport,
+	error) {
+
+	type storedCapacity struct {
+		op       wire.OutPoint
+		capacity btcutil.Amount
+	}
+	var channels []storedCapacity
+	err := d.View(func(tx *bbolt.Tx) error {
+		openChanBucket := tx.Bucket(openChannelBucket)
+		if openChanBucket == nil {
+			return nil
+		}
+
+		return forEachChanBucket(openChanBucket,
+			func(op wire.OutPoint, chanBucket *bbolt.Bucket) error {
+				var channel OpenChannel
+				err := fetchChanInfo(chanBucket, &channel)
+				if err != nil {
+					return err
+				}
+
+				channels = append(channels, storedCapacity{
+					op:       op,
+					capacity: channel.Capacity,
+				})
+
+				return nil
+			},
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CapacityReport{}
+	for _, channel := range channels {
+		actual, err := lookup(channel.op)
+		if err != nil {
+			return nil, fmt.Errorf("unable to look up funding "+
+				"output of channel %v: %v", channel.op, err)
+		}
+
+		report.Checked++
+		if actual == channel.capacity {
+			continue
+		}
+
+		report.Mismatches = append(report.Mismatches, CapacityMismatch{
+			ChanPoint: channel.op,
+			Stored:    channel.capacity,
+			Actual:    actual,
+		})
+	}
+
+	return report, nil
+}
+
+// repairEdgeCapacity sets the capacity of the graph edge of the channel with
+// the passed channel point to actual. Channels that aren't known to the graph
+// are skipped.
+func repairEdgeCapacity(tx *bbolt.Tx, op wire.OutPoint,
+	actual btcutil.Amount) error {
+
+	edges := tx.Bucket(edgeBucket)
+	if edges == nil {
+		return nil
+	}
+	edgeIndex := edges.Bucket(edgeIndexBucket)
+	chanIndex := edges.Bucket(channelPointBucket)
+	if edgeIndex == nil || chanIndex == nil {
+		return nil
+	}
+
+	chanID := chanIndex.Get(canonicalChannelKey(op))
+	if chanID == nil {
+		return nil
+	}
+
+	edgeInfo, err := fetchChanEdgeInfo(edgeIndex, chanID)
+	if err == ErrEdgeNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if edgeInfo.Capacity == actual {
+		return nil
+	}
+
+	var id [8]byte
+	copy(id[:], chanID)
+	edgeInfo.Capacity = actual
+
+	return putChanEdgeInfo(edgeIndex, &edgeInfo, id)
+}
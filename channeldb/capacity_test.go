@@ -0,0 +1,158 @@
+package channeldb
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestRepairChannelCapacity asserts that a channel whose stored capacity
+// disagrees with its funding output is detected, and that repairing it
+// corrects both the channel and its graph edge.
+func TestRepairChannelCapacity(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	channel, err := createTestChannelState(db)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	if err := channel.FullSync(); err != nil {
+		t.Fatalf("unable to save channel: %v", err)
+	}
+	op := channel.FundingOutpoint
+
+	graph := db.ChannelGraph()
+	node1, err := createTestVertex(db)
+	if err != nil {
+		t.Fatalf("unable to create test node: %v", err)
+	}
+	node2, err := createTestVertex(db)
+	if err != nil {
+		t.Fatalf("unable to create test node: %v", err)
+	}
+	for _, node := range []*LightningNode{node1, node2} {
+		if err := graph.AddLightningNode(node); err != nil {
+			t.Fatalf("unable to add node: %v", err)
+		}
+	}
+	edgeInfo, _, _ := createChannelEdge(db, node1, node2)
+	edgeInfo.ChannelPoint = op
+	edgeInfo.Capacity = channel.Capacity
+	if err := graph.AddChannelEdge(edgeInfo); err != nil {
+		t.Fatalf("unable to add edge: %v", err)
+	}
+
+	if err := db.VerifyChannelCapacity(op, channel.Capacity); err != nil {
+		t.Fatalf("expected capacity to match, got %v", err)
+	}
+
+	actual := channel.Capacity + 1000
+	err = db.VerifyChannelCapacity(op, actual)
+	if err != ErrCapacityMismatch {
+		t.Fatalf("expected ErrCapacityMismatch, got %v", err)
+	}
+
+	if err := db.RepairChannelCapacity(op, actual); err != nil {
+		t.Fatalf("unable to repair capacity: %v", err)
+	}
+	if err := db.VerifyChannelCapacity(op, actual); err != nil {
+		t.Fatalf("expected repaired capacity to match, got %v", err)
+	}
+
+	dbChannel, err := db.FetchChannel(op)
+	if err != nil {
+		t.Fatalf("unable to fetch channel: %v", err)
+	}
+	if dbChannel.Capacity != actual {
+		t.Fatalf("expected capacity %v, got %v", actual,
+			dbChannel.Capacity)
+	}
+	dbEdge, _, _, err := graph.FetchChannelEdgesByID(edgeInfo.ChannelID)
+	if err != nil {
+		t.Fatalf("unable to fetch edge: %v", err)
+	}
+	if dbEdge.Capacity != actual {
+		t.Fatalf("expected edge capacity %v, got %v", actual,
+			dbEdge.Capacity)
+	}
+
+	unknown := wire.OutPoint{Index: 99}
+	err = db.VerifyChannelCapacity(unknown, actual)
+	if err != ErrChannelNotFound {
+		t.Fatalf("expected ErrChannelNotFound, got %v", err)
+	}
+}
+
+// TestVerifyAllCapacities asserts that a bulk cross-check reports exactly the
+// channels whose stored capacity disagrees with the looked up funding output,
+// and that a failed lookup aborts the check.
+func TestVerifyAllCapacities(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	var channels []*OpenChannel
+	for i := 0; i < 3; i++ {
+		channel, err := createTestChannelState(db)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		channel.FundingOutpoint.Index = uint32(i)
+		if err := channel.FullSync(); err != nil {
+			t.Fatalf("unable to save channel: %v", err)
+		}
+		channels = append(channels, channel)
+	}
+
+	// The funding output of the second channel is worth less than its
+	// stored capacity.
+	bad := channels[1].FundingOutpoint
+	actual := channels[1].Capacity - 1
+	lookup := func(op wire.OutPoint) (btcutil.Amount, error) {
+		if op == bad {
+			return actual, nil
+		}
+		return channels[0].Capacity, nil
+	}
+
+	report, err := db.VerifyAllCapacities(lookup)
+	if err != nil {
+		t.Fatalf("unable to verify capacities: %v", err)
+	}
+	if report.Checked != len(channels) {
+		t.Fatalf("expected %v checked channels, got %v",
+			len(channels), report.Checked)
+	}
+	if len(report.Mismatches) != 1 {
+		t.Fatalf("expected 1 mismatch, got %v",
+			len(report.Mismatches))
+	}
+	mismatch := report.Mismatches[0]
+	if mismatch.ChanPoint != bad || mismatch.Actual != actual ||
+		mismatch.Stored != channels[1].Capacity {
+
+		t.Fatalf("unexpected mismatch: %v", spew.Sdump(mismatch))
+	}
+
+	_, err = db.VerifyAllCapacities(
+		func(wire.OutPoint) (btcutil.Amount, error) {
+			return 0, fmt.Errorf("chain backend unavailable")
+		},
+	)
+	if err == nil {
+		t.Fatalf("expected failed lookup to abort the check")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -26,6 +27,14 @@ var (
 	// previously open, but now closed channels.
 	closedChannelBucket = []byte("closed-chan-bucket")
 
+	// abandonedChannelBucket stores the details of channels that were
+	// abandoned, i.e. closed with the Abandoned close type. These are
+	// kept apart from the close summaries themselves, leaving the format
+	// of the records within the closedChannelBucket untouched.
+	//
+	// maps: chanPoint -> fundsLost || reason
+	abandonedChannelBucket = []byte("abandoned-chan-bucket")
+
 	// openChanBucket stores all the currently open channels. This bucket
 	// has a second, nested bucket which is keyed by a node's ID. Within
 	// that node ID bucket, all attributes required to track, update, and
@@ -111,6 +120,10 @@ var (
 	// ErrChanBorked is returned when a caller attempts to mutate a borked
 	// channel.
 	ErrChanBorked = fmt.Errorf("cannot mutate borked channel")
+
+	// ErrChannelNotPending is returned when attempting to mark a channel
+	// as open that's no longer pending.
+	ErrChannelNotPending = fmt.Errorf("channel isn't pending")
 )
 
 // ChannelType is an enum-like type that describes one of several possible
@@ -392,6 +405,10 @@ type OpenChannel struct {
 	// ChanType denotes which type of channel this is.
 	ChanType ChannelType
 
+	// CommitmentType is the format of the channel's commitment
+	// transactions, which selects how its commitments are serialized.
+	CommitmentType CommitmentType
+
 	// ChainHash is a hash which represents the blockchain that this
 	// channel will be opened within. This value is typically the genesis
 	// hash. In the case that the original chain went through a contentious
@@ -433,6 +450,11 @@ type OpenChannel struct {
 	// for normal transactional use.
 	NumConfsRequired uint16
 
+	// Confirmations is the number of confirmations the channel's funding
+	// transaction had received when last updated. Once the channel is
+	// marked as open, it's at least NumConfsRequired.
+	Confirmations uint32
+
 	// ChannelFlags holds the flags that were sent as part of the
 	// open_channel message.
 	ChannelFlags lnwire.FundingFlag
@@ -506,6 +528,12 @@ type OpenChannel struct {
 	// for which we are the initiator.
 	FundingTxn *wire.MsgTx
 
+	// UUID is a random identifier assigned to the channel once it's first
+	// written to disk. Unlike the channel point and short channel ID, it
+	// never changes for the life of the channel, making it suitable as a
+	// join key for external systems.
+	UUID [16]byte
+
 	// TODO(roasbeef): eww
 	Db *DB
 
@@ -636,11 +664,7 @@ func fetchChanBucket(tx *bbolt.Tx, nodeKey *btcec.PublicKey,
 
 	// With the bucket for the node and chain fetched, we can now go down
 	// another level, for this channel itself.
-	var chanPointBuf bytes.Buffer
-	if err := writeOutpoint(&chanPointBuf, outPoint); err != nil {
-		return nil, err
-	}
-	chanBucket := chainBucket.Bucket(chanPointBuf.Bytes())
+	chanBucket := chainBucket.Bucket(canonicalChannelKey(*outPoint))
 	if chanBucket == nil {
 		return nil, ErrChannelNotFound
 	}
@@ -676,12 +700,8 @@ func (c *OpenChannel) fullSync(tx *bbolt.Tx) error {
 
 	// With the bucket for the node fetched, we can now go down another
 	// level, creating the bucket for this channel itself.
-	var chanPointBuf bytes.Buffer
-	if err := writeOutpoint(&chanPointBuf, &c.FundingOutpoint); err != nil {
-		return err
-	}
 	chanBucket, err := chainBucket.CreateBucket(
-		chanPointBuf.Bytes(),
+		canonicalChannelKey(c.FundingOutpoint),
 	)
 	switch {
 	case err == bbolt.ErrBucketExists:
@@ -692,7 +712,13 @@ func (c *OpenChannel) fullSync(tx *bbolt.Tx) error {
 		return err
 	}
 
-	return putOpenChannel(chanBucket, c)
+	if err := putOpenChannel(chanBucket, c); err != nil {
+		return err
+	}
+
+	// With the channel itself written, we'll populate the indexes that
+	// reference it.
+	return onChannelOpen(tx, chanBucket, c)
 }
 
 // MarkAsOpen marks a channel as fully open given a locator that uniquely
@@ -714,21 +740,72 @@ func (c *OpenChannel) MarkAsOpen(openLoc lnwire.ShortChannelID) error {
 			return err
 		}
 
-		channel.IsPending = false
-		channel.ShortChannelID = openLoc
-
-		return putOpenChannel(chanBucket, channel)
+		return markChannelOpen(tx, chanBucket, channel, openLoc)
 	}); err != nil {
 		return err
 	}
 
 	c.IsPending = false
 	c.ShortChannelID = openLoc
+	c.Confirmations = openConfirmations(c)
 	c.Packager = NewChannelPackager(openLoc)
+	c.Db.notifyChannelStates()
 
 	return nil
 }
 
+// MarkChannelOpen marks the pending channel with the passed funding outpoint
+// as fully open, assigning it its final short channel ID. The channel is read,
+// checked and rewritten within a single transaction, so the channel is never
+// left partially updated. If the channel isn't pending, ErrChannelNotPending
+// is returned and nothing is written.
+func (d *DB) MarkChannelOpen(op wire.OutPoint,
+	scid lnwire.ShortChannelID) error {
+
+	err := d.Update(func(tx *bbolt.Tx) error {
+		_, _, chanBucket, err := findChanBucket(tx, &op)
+		if err != nil {
+			return err
+		}
+
+		channel, err := fetchOpenChannel(chanBucket, &op)
+		if err != nil {
+			return err
+		}
+		if !channel.IsPending {
+			return ErrChannelNotPending
+		}
+
+		return markChannelOpen(tx, chanBucket, channel, scid)
+	})
+	if err != nil {
+		return err
+	}
+
+	d.notifyChannelStates()
+
+	return nil
+}
+
+// markChannelOpen clears the pending flag of the channel read from the passed
+// bucket, and writes it back along with its final short channel ID. As the
+// channel's funding transaction has reached the required depth, so has its
+// number of confirmations. The channel moving out of its pending stage is
+// recorded within the channel state log.
+func markChannelOpen(tx *bbolt.Tx, chanBucket *bbolt.Bucket,
+	channel *OpenChannel, scid lnwire.ShortChannelID) error {
+
+	if err := logChannelLifecycle(tx, channel, ChannelOpen); err != nil {
+		return err
+	}
+
+	channel.IsPending = false
+	channel.ShortChannelID = scid
+	channel.Confirmations = openConfirmations(channel)
+
+	return putOpenChannel(chanBucket, channel)
+}
+
 // MarkDataLoss marks sets the channel status to LocalDataLoss and stores the
 // passed commitPoint for use to retrieve funds in case the remote force closes
 // the channel.
@@ -752,9 +829,15 @@ func (c *OpenChannel) MarkDataLoss(commitPoint *btcec.PublicKey) error {
 
 		// Add status LocalDataLoss to the existing bitvector found in
 		// the DB.
+		oldStatus := channel.chanStatus
 		status = channel.chanStatus | ChanStatusLocalDataLoss
 		channel.chanStatus = status
 
+		err = logChannelStatus(tx, channel, oldStatus, status)
+		if err != nil {
+			return err
+		}
+
 		var b bytes.Buffer
 		if err := WriteElement(&b, commitPoint); err != nil {
 			return err
@@ -770,8 +853,10 @@ func (c *OpenChannel) MarkDataLoss(commitPoint *btcec.PublicKey) error {
 		return err
 	}
 
-	// Update the in-memory representation to keep it in sync with the DB.
+	// Update the in-memory representation to keep it in sync with the DB,
+	// and let the subscribers of the channel state log know of the change.
 	c.chanStatus = status
+	c.Db.notifyChannelStates()
 
 	return nil
 }
@@ -860,16 +945,24 @@ func (c *OpenChannel) putChanStatus(status ChannelStatus) error {
 		}
 
 		// Add this status to the existing bitvector found in the DB.
+		oldStatus := channel.chanStatus
 		status = channel.chanStatus | status
 		channel.chanStatus = status
 
+		err = logChannelStatus(tx, channel, oldStatus, status)
+		if err != nil {
+			return err
+		}
+
 		return putOpenChannel(chanBucket, channel)
 	}); err != nil {
 		return err
 	}
 
-	// Update the in-memory representation to keep it in sync with the DB.
+	// Update the in-memory representation to keep it in sync with the DB,
+	// and let the subscribers of the channel state log know of the change.
 	c.chanStatus = status
+	c.Db.notifyChannelStates()
 
 	return nil
 }
@@ -889,16 +982,24 @@ func (c *OpenChannel) clearChanStatus(status ChannelStatus) error {
 		}
 
 		// Unset this bit in the bitvector on disk.
+		oldStatus := channel.chanStatus
 		status = channel.chanStatus & ^status
 		channel.chanStatus = status
 
+		err = logChannelStatus(tx, channel, oldStatus, status)
+		if err != nil {
+			return err
+		}
+
 		return putOpenChannel(chanBucket, channel)
 	}); err != nil {
 		return err
 	}
 
-	// Update the in-memory representation to keep it in sync with the DB.
+	// Update the in-memory representation to keep it in sync with the DB,
+	// and let the subscribers of the channel state log know of the change.
 	c.chanStatus = status
+	c.Db.notifyChannelStates()
 
 	return nil
 }
@@ -911,6 +1012,16 @@ func putOpenChannel(chanBucket *bbolt.Bucket, channel *OpenChannel) error {
 	if err := putChanInfo(chanBucket, channel); err != nil {
 		return fmt.Errorf("unable to store chan info: %v", err)
 	}
+	err := putChanCommitType(chanBucket, channel.CommitmentType)
+	if err != nil {
+		return fmt.Errorf("unable to store chan commitment type: %v",
+			err)
+	}
+	err = putChanConfirmations(chanBucket, channel.Confirmations)
+	if err != nil {
+		return fmt.Errorf("unable to store chan confirmations: %v",
+			err)
+	}
 
 	// With the static channel info written out, we'll now write out the
 	// current commitment state for both parties.
@@ -941,6 +1052,13 @@ func fetchOpenChannel(chanBucket *bbolt.Bucket,
 	if err := fetchChanInfo(chanBucket, channel); err != nil {
 		return nil, fmt.Errorf("unable to fetch chan info: %v", err)
 	}
+	commitType, err := fetchChanCommitType(chanBucket)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch chan commitment "+
+			"type: %v", err)
+	}
+	channel.CommitmentType = commitType
+	channel.Confirmations = fetchChanConfirmations(chanBucket)
 
 	// With the static information read, we'll now read the current
 	// commitment state for both sides of the channel.
@@ -956,6 +1074,9 @@ func fetchOpenChannel(chanBucket *bbolt.Bucket,
 
 	channel.Packager = NewChannelPackager(channel.ShortChannelID)
 
+	// Channels stored prior to the UUID migration don't carry a UUID.
+	copy(channel.UUID[:], chanBucket.Get(chanUUIDKey))
+
 	return channel, nil
 }
 
@@ -1674,6 +1795,15 @@ func (c *OpenChannel) AdvanceCommitChainTail(fwdPkg *FwdPkg) error {
 			return err
 		}
 
+		// If the number of retained revoked states is capped, the
+		// oldest ones are trimmed now that the log has grown.
+		if limit := c.Db.revocationLogLimit; limit > 0 {
+			_, err := trimRevocationLog(chanBucket, limit)
+			if err != nil {
+				return err
+			}
+		}
+
 		// Lastly, we write the forwarding package to disk so that we
 		// can properly recover from failures and reforward HTLCs that
 		// have not received a corresponding settle/fail.
@@ -1945,7 +2075,9 @@ const (
 
 	// Abandoned indicates that the channel state was removed without
 	// any further actions. This is intended to clean up unusable
-	// channels during development.
+	// channels during development. The reason for abandoning the channel,
+	// and whether its funds were considered lost, are recorded within the
+	// AbandonReason and FundsLost fields of the close summary.
 	Abandoned ClosureType = 5
 )
 
@@ -2010,6 +2142,11 @@ type ChannelCloseSummary struct {
 	// swept.
 	IsPending bool
 
+	// Swept indicates whether the output paying out our SettledBalance
+	// has been swept. This is only tracked for cooperative closes, as the
+	// outputs of force closes are resolved by the contract court instead.
+	Swept bool
+
 	// RemoteCurrentRevocation is the current revocation for their
 	// commitment transaction. However, since this the derived public key,
 	// we don't yet have the private key so we aren't yet able to verify
@@ -2028,6 +2165,16 @@ type ChannelCloseSummary struct {
 	// LastChanSyncMsg is the ChannelReestablish message for this channel
 	// for the state at the point where it was closed.
 	LastChanSyncMsg *lnwire.ChannelReestablish
+
+	// AbandonReason is a description of why the channel was abandoned.
+	// This is only set if the CloseType is Abandoned.
+	AbandonReason string
+
+	// FundsLost denotes whether our balance within the channel was
+	// considered lost at the time it was abandoned, rather than being
+	// recoverable by other means. This is only set if the CloseType is
+	// Abandoned.
+	FundsLost bool
 }
 
 // CloseChannel closes a previously active Lightning channel. Closing a channel
@@ -2039,7 +2186,7 @@ func (c *OpenChannel) CloseChannel(summary *ChannelCloseSummary) error {
 	c.Lock()
 	defer c.Unlock()
 
-	return c.Db.Update(func(tx *bbolt.Tx) error {
+	err := c.Db.Update(func(tx *bbolt.Tx) error {
 		openChanBucket := tx.Bucket(openChannelBucket)
 		if openChanBucket == nil {
 			return ErrNoChanDBExists
@@ -2056,12 +2203,8 @@ func (c *OpenChannel) CloseChannel(summary *ChannelCloseSummary) error {
 			return ErrNoActiveChannels
 		}
 
-		var chanPointBuf bytes.Buffer
-		err := writeOutpoint(&chanPointBuf, &c.FundingOutpoint)
-		if err != nil {
-			return err
-		}
-		chanBucket := chainBucket.Bucket(chanPointBuf.Bytes())
+		chanKey := canonicalChannelKey(c.FundingOutpoint)
+		chanBucket := chainBucket.Bucket(chanKey)
 		if chanBucket == nil {
 			return ErrNoActiveChannels
 		}
@@ -2076,9 +2219,20 @@ func (c *OpenChannel) CloseChannel(summary *ChannelCloseSummary) error {
 			return err
 		}
 
+		err = logChannelLifecycle(tx, chanState, ChannelClosed)
+		if err != nil {
+			return err
+		}
+
+		// Any state kept for the channel outside of its bucket is
+		// cleaned up while the channel's state is still available.
+		if err := onChannelClose(tx, c.FundingOutpoint); err != nil {
+			return err
+		}
+
 		// Now that the index to this channel has been deleted, purge
 		// the remaining channel metadata from the database.
-		err = deleteOpenChannel(chanBucket, chanPointBuf.Bytes())
+		err = deleteOpenChannel(chanBucket, chanKey)
 		if err != nil {
 			return err
 		}
@@ -2097,7 +2251,7 @@ func (c *OpenChannel) CloseChannel(summary *ChannelCloseSummary) error {
 			}
 		}
 
-		err = chainBucket.DeleteBucket(chanPointBuf.Bytes())
+		err = chainBucket.DeleteBucket(chanKey)
 		if err != nil {
 			return err
 		}
@@ -2105,9 +2259,16 @@ func (c *OpenChannel) CloseChannel(summary *ChannelCloseSummary) error {
 		// Finally, create a summary of this channel in the closed
 		// channel bucket for this node.
 		return putChannelCloseSummary(
-			tx, chanPointBuf.Bytes(), summary, chanState,
+			tx, chanKey, summary, chanState,
 		)
 	})
+	if err != nil {
+		return err
+	}
+
+	c.Db.notifyChannelStates()
+
+	return nil
 }
 
 // ChannelSnapshot is a frozen snapshot of the current channel state. A
@@ -2239,14 +2400,87 @@ func putChannelCloseSummary(tx *bbolt.Tx, chanID []byte,
 		return err
 	}
 
-	return closedChanBucket.Put(chanID, b.Bytes())
+	if err := closedChanBucket.Put(chanID, b.Bytes()); err != nil {
+		return err
+	}
+
+	if summary.CloseType != Abandoned {
+		return nil
+	}
+
+	return putAbandonmentInfo(tx, chanID, summary)
+}
+
+// putAbandonmentInfo stores the abandonment details of the passed close
+// summary within the abandoned channel bucket.
+func putAbandonmentInfo(tx *bbolt.Tx, chanID []byte,
+	summary *ChannelCloseSummary) error {
+
+	abandonedBucket, err := tx.CreateBucketIfNotExists(
+		abandonedChannelBucket,
+	)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	err = WriteElements(
+		&b, summary.FundsLost, []byte(summary.AbandonReason),
+	)
+	if err != nil {
+		return err
+	}
+
+	return abandonedBucket.Put(chanID, b.Bytes())
 }
 
+// fetchAbandonmentInfo populates the abandonment details of the passed close
+// summary, if it belongs to an abandoned channel. Summaries of channels that
+// were abandoned before these details were recorded are left untouched.
+func fetchAbandonmentInfo(tx *bbolt.Tx, chanID []byte,
+	summary *ChannelCloseSummary) error {
+
+	if summary.CloseType != Abandoned {
+		return nil
+	}
+
+	abandonedBucket := tx.Bucket(abandonedChannelBucket)
+	if abandonedBucket == nil {
+		return nil
+	}
+
+	infoBytes := abandonedBucket.Get(chanID)
+	if infoBytes == nil {
+		return nil
+	}
+
+	var reason []byte
+	err := ReadElements(
+		bytes.NewReader(infoBytes), &summary.FundsLost, &reason,
+	)
+	if err != nil {
+		return err
+	}
+	summary.AbandonReason = string(reason)
+
+	return nil
+}
+
+// serializeChannelCloseSummary writes the close summary to w, using the codec
+// registered for close summaries.
 func serializeChannelCloseSummary(w io.Writer, cs *ChannelCloseSummary) error {
+	return codecFor(CloseSummaryRecord).Encode(w, cs)
+}
+
+// serializeChannelCloseSummaryBinary writes the close summary to w in the
+// current binary format.
+func serializeChannelCloseSummaryBinary(w io.Writer,
+	cs *ChannelCloseSummary) error {
+
 	err := WriteElements(w,
 		cs.ChanPoint, cs.ShortChanID, cs.ChainHash, cs.ClosingTXID,
 		cs.CloseHeight, cs.RemotePub, cs.Capacity, cs.SettledBalance,
-		cs.TimeLockedBalance, cs.CloseType, cs.IsPending,
+		cs.TimeLockedBalance, cs.CloseType, cs.IsPending, cs.Swept,
 	)
 	if err != nil {
 		return err
@@ -2315,19 +2549,49 @@ func fetchChannelCloseSummary(tx *bbolt.Tx,
 	}
 
 	summaryReader := bytes.NewReader(summaryBytes)
-	return deserializeCloseChannelSummary(summaryReader)
+	summary, err := deserializeCloseChannelSummary(summaryReader)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fetchAbandonmentInfo(tx, chanID, summary); err != nil {
+		return nil, err
+	}
+
+	return summary, nil
 }
 
+// deserializeCloseChannelSummary reads a close summary from r, using the codec
+// registered for close summaries.
 func deserializeCloseChannelSummary(r io.Reader) (*ChannelCloseSummary, error) {
+	return decodeCloseChannelSummary(codecFor(CloseSummaryRecord), r)
+}
+
+// decodeCloseChannelSummary reads a close summary from r using the passed
+// codec.
+func decodeCloseChannelSummary(codec Codec,
+	r io.Reader) (*ChannelCloseSummary, error) {
+
 	c := &ChannelCloseSummary{}
+	if err := codec.Decode(r, c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// deserializeCloseChannelSummaryBinary reads a close summary in the current
+// binary format from r into c.
+func deserializeCloseChannelSummaryBinary(r io.Reader,
+	c *ChannelCloseSummary) error {
 
 	err := ReadElements(r,
 		&c.ChanPoint, &c.ShortChanID, &c.ChainHash, &c.ClosingTXID,
 		&c.CloseHeight, &c.RemotePub, &c.Capacity, &c.SettledBalance,
-		&c.TimeLockedBalance, &c.CloseType, &c.IsPending,
+		&c.TimeLockedBalance, &c.CloseType, &c.IsPending, &c.Swept,
 	)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// We'll now check to see if the channel close summary was encoded with
@@ -2335,21 +2599,21 @@ func deserializeCloseChannelSummary(r io.Reader) (*ChannelCloseSummary, error) {
 	var hasNewFields bool
 	err = ReadElements(r, &hasNewFields)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// If fields are not present, we can return.
 	if !hasNewFields {
-		return c, nil
+		return nil
 	}
 
 	// Otherwise read the new fields.
 	if err := ReadElements(r, &c.RemoteCurrentRevocation); err != nil {
-		return nil, err
+		return err
 	}
 
 	if err := readChanConfig(r, &c.LocalChanConfig); err != nil {
-		return nil, err
+		return err
 	}
 
 	// Finally, we'll attempt to read the next unrevoked commitment point
@@ -2359,14 +2623,14 @@ func deserializeCloseChannelSummary(r io.Reader) (*ChannelCloseSummary, error) {
 	var hasRemoteNextRevocation bool
 	err = ReadElements(r, &hasRemoteNextRevocation)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// If this field was written, read it.
 	if hasRemoteNextRevocation {
 		err = ReadElements(r, &c.RemoteNextRevocation)
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
@@ -2374,9 +2638,9 @@ func deserializeCloseChannelSummary(r io.Reader) (*ChannelCloseSummary, error) {
 	var hasChanSyncMsg bool
 	err = ReadElements(r, &hasChanSyncMsg)
 	if err == io.EOF {
-		return c, nil
+		return nil
 	} else if err != nil {
-		return nil, err
+		return err
 	}
 
 	// If a chan sync message is present, read it.
@@ -2385,18 +2649,18 @@ func deserializeCloseChannelSummary(r io.Reader) (*ChannelCloseSummary, error) {
 		// to support it.
 		var msg lnwire.Message
 		if err := ReadElements(r, &msg); err != nil {
-			return nil, err
+			return err
 		}
 
 		chanSync, ok := msg.(*lnwire.ChannelReestablish)
 		if !ok {
-			return nil, errors.New("unable cast db Message to " +
+			return errors.New("unable cast db Message to " +
 				"ChannelReestablish")
 		}
 		c.LastChanSyncMsg = chanSync
 	}
 
-	return c, nil
+	return nil
 }
 
 func writeChanConfig(b io.Writer, c *ChannelConfig) error {
@@ -2466,7 +2730,11 @@ func putChanCommitment(chanBucket *bbolt.Bucket, c *ChannelCommitment,
 		return err
 	}
 
-	return chanBucket.Put(commitKey, b.Bytes())
+	if err := chanBucket.Put(commitKey, b.Bytes()); err != nil {
+		return err
+	}
+
+	return putHtlcAddTimes(chanBucket, c, local, time.Now())
 }
 
 func putChanCommitments(chanBucket *bbolt.Bucket, channel *OpenChannel) error {
@@ -2476,6 +2744,13 @@ func putChanCommitments(chanBucket *bbolt.Bucket, channel *OpenChannel) error {
 		return nil
 	}
 
+	// All known commitment types currently share the same serialization.
+	switch channel.CommitmentType {
+	case CommitmentTypeLegacy:
+	default:
+		return ErrUnknownCommitmentType
+	}
+
 	err := putChanCommitment(
 		chanBucket, &channel.LocalCommitment, true,
 	)
@@ -2606,6 +2881,13 @@ func fetchChanCommitments(chanBucket *bbolt.Bucket, channel *OpenChannel) error
 		return nil
 	}
 
+	// All known commitment types currently share the same serialization.
+	switch channel.CommitmentType {
+	case CommitmentTypeLegacy:
+	default:
+		return ErrUnknownCommitmentType
+	}
+
 	channel.LocalCommitment, err = fetchChanCommitment(chanBucket, true)
 	if err != nil {
 		return err
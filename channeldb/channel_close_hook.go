@@ -0,0 +1,46 @@
+package channeldb
+
+import (
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+)
+
+// channelCloseCallback removes or moves the state kept for a channel outside
+// of its own bucket once the channel is closed. It's passed the channel as it
+// was stored right before being closed, and is executed within the
+// transaction that closes it.
+type channelCloseCallback func(tx *bbolt.Tx, channel *OpenChannel) error
+
+// channelCloseCallbacks are executed by onChannelClose in order. Any index
+// or other bucket that references open channels should register its cleanup
+// here, rather than within CloseChannel itself.
+var channelCloseCallbacks = []channelCloseCallback{
+	deleteChanUUIDOnClose,
+	deleteHTLCRatesOnClose,
+	deleteJammingStatsOnClose,
+	putChanLifetimeOnClose,
+	deleteChanActivityOnClose,
+}
+
+// onChannelClose executes all channel close callbacks for the open channel
+// with the passed channel point. It must be called before the channel's
+// bucket is deleted, such that the callbacks have access to its full state.
+func onChannelClose(tx *bbolt.Tx, op wire.OutPoint) error {
+	_, _, chanBucket, err := findChanBucket(tx, &op)
+	if err != nil {
+		return err
+	}
+
+	channel, err := fetchOpenChannel(chanBucket, &op)
+	if err != nil {
+		return err
+	}
+
+	for _, callback := range channelCloseCallbacks {
+		if err := callback(tx, channel); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
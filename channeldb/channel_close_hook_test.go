@@ -0,0 +1,76 @@
+package channeldb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcutil"
+	"github.com/coreos/bbolt"
+)
+
+// TestChannelCloseCascade asserts that closing a channel removes the entries
+// referencing it from the indexes that registered a close callback.
+func TestChannelCloseCascade(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	state, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	if err := state.FullSync(); err != nil {
+		t.Fatalf("unable to save channel state: %v", err)
+	}
+
+	chanID := state.ShortChannelID.ToUint64()
+	now := time.Now()
+	for dir := uint8(0); dir <= 1; dir++ {
+		if err := cdb.RecordHTLCAdd(chanID, dir, now); err != nil {
+			t.Fatalf("unable to record htlc add: %v", err)
+		}
+	}
+
+	closeSummary := &ChannelCloseSummary{
+		ChanPoint:      state.FundingOutpoint,
+		RemotePub:      state.IdentityPub,
+		SettledBalance: btcutil.Amount(500),
+		CloseType:      CooperativeClose,
+	}
+	if err := state.CloseChannel(closeSummary); err != nil {
+		t.Fatalf("unable to close channel: %v", err)
+	}
+
+	err = cdb.View(func(tx *bbolt.Tx) error {
+		uuidIndex := tx.Bucket(channelUUIDIndexBucket)
+		if uuidIndex.Get(state.UUID[:]) != nil {
+			t.Fatalf("uuid index entry not removed")
+		}
+
+		rates := tx.Bucket(htlcRateBucket)
+		for dir := uint8(0); dir <= 1; dir++ {
+			if rates.Bucket(channelScoreKey(chanID, dir)) != nil {
+				t.Fatalf("htlc additions of direction %v not "+
+					"removed", dir)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to read database: %v", err)
+	}
+
+	// Closing a channel that doesn't exist should fail, rather than
+	// run the callbacks.
+	err = cdb.Update(func(tx *bbolt.Tx) error {
+		return onChannelClose(tx, state.FundingOutpoint)
+	})
+	if err != ErrChannelNotFound {
+		t.Fatalf("expected ErrChannelNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package channeldb
+
+import (
+	"fmt"
+
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// chanCommitTypeKey can be accessed within the bucket for a channel,
+	// and stores the commitment type of the channel as a single byte.
+	chanCommitTypeKey = []byte("chan-commit-type-key")
+
+	// ErrUnknownCommitmentType is returned when a channel is of a
+	// commitment type this version of the database doesn't know how to
+	// serialize.
+	ErrUnknownCommitmentType = fmt.Errorf("unknown commitment type")
+
+	// ErrCommitmentTypeNotFound is returned when a channel carries no
+	// commitment type.
+	ErrCommitmentTypeNotFound = fmt.Errorf("channel commitment type " +
+		"not found")
+)
+
+// CommitmentType is the format of a channel's commitment transactions, which
+// determines how its commitments and the HTLCs on them are serialized. Unlike
+// the ChannelType, which describes how a channel was funded, the commitment
+// type may change over the lifetime of a channel as it's upgraded to a newer
+// format.
+type CommitmentType uint8
+
+const (
+	// NOTE: iota isn't used here for this enum needs to be stable
+	// long-term as it will be persisted to the database.
+
+	// CommitmentTypeLegacy is the original commitment format, where the
+	// output paying to the remote party is tweaked by the commitment
+	// point of each state.
+	CommitmentTypeLegacy CommitmentType = 0
+)
+
+// String returns a human readable identifier for the CommitmentType type.
+func (c CommitmentType) String() string {
+	switch c {
+	case CommitmentTypeLegacy:
+		return "Legacy"
+	}
+
+	return "Unknown"
+}
+
+// isKnown returns whether the commitment type is one the database knows how
+// to serialize.
+func (c CommitmentType) isKnown() bool {
+	switch c {
+	case CommitmentTypeLegacy:
+		return true
+	}
+
+	return false
+}
+
+// inferCommitmentType derives the commitment type of a channel stored before
+// the type was recorded explicitly. None of the existing channel types or
+// status flags select a commitment format other than the legacy one.
+func inferCommitmentType(channel *OpenChannel) CommitmentType {
+	return CommitmentTypeLegacy
+}
+
+// putChanCommitType stores the commitment type of the channel, which must be
+// one the database knows how to serialize.
+func putChanCommitType(chanBucket *bbolt.Bucket, t CommitmentType) error {
+	if !t.isKnown() {
+		return ErrUnknownCommitmentType
+	}
+
+	return chanBucket.Put(chanCommitTypeKey, []byte{byte(t)})
+}
+
+// fetchChanCommitType reads the commitment type of the channel, returning an
+// error if it's unknown.
+func fetchChanCommitType(chanBucket *bbolt.Bucket) (CommitmentType, error) {
+	typeBytes := chanBucket.Get(chanCommitTypeKey)
+	if len(typeBytes) != 1 {
+		return 0, ErrCommitmentTypeNotFound
+	}
+
+	t := CommitmentType(typeBytes[0])
+	if !t.isKnown() {
+		return 0, ErrUnknownCommitmentType
+	}
+
+	return t, nil
+}
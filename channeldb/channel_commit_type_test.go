@@ -0,0 +1,70 @@
+package channeldb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/coreos/bbolt"
+)
+
+// TestChannelCommitmentType asserts that the commitment type of a channel is
+// persisted, and that channels of an unknown commitment type are neither
+// stored nor read.
+func TestChannelCommitmentType(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	// A channel of an unknown commitment type shouldn't be stored.
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	channel.CommitmentType = CommitmentTypeLegacy + 1
+	if err := channel.FullSync(); err == nil {
+		t.Fatalf("expected channel of unknown commitment type to be " +
+			"rejected")
+	}
+
+	channel.CommitmentType = CommitmentTypeLegacy
+	if err := channel.FullSync(); err != nil {
+		t.Fatalf("unable to save channel state: %v", err)
+	}
+
+	dbChannel, err := cdb.FetchChannel(channel.FundingOutpoint)
+	if err != nil {
+		t.Fatalf("unable to fetch channel: %v", err)
+	}
+	if dbChannel.CommitmentType != CommitmentTypeLegacy {
+		t.Fatalf("expected commitment type %v, got %v",
+			CommitmentTypeLegacy, dbChannel.CommitmentType)
+	}
+
+	// If the stored commitment type is unknown, reading the channel should
+	// fail rather than interpret its commitments in the wrong format.
+	err = cdb.Update(func(tx *bbolt.Tx) error {
+		chanBucket, err := fetchChanBucket(
+			tx, channel.IdentityPub, &channel.FundingOutpoint,
+			channel.ChainHash,
+		)
+		if err != nil {
+			return err
+		}
+
+		unknownType := []byte{byte(CommitmentTypeLegacy + 1)}
+		return chanBucket.Put(chanCommitTypeKey, unknownType)
+	})
+	if err != nil {
+		t.Fatalf("unable to store commitment type: %v", err)
+	}
+
+	_, err = cdb.FetchChannel(channel.FundingOutpoint)
+	unknownErr := ErrUnknownCommitmentType.Error()
+	if err == nil || !strings.Contains(err.Error(), unknownErr) {
+		t.Fatalf("expected unknown commitment type error, got %v", err)
+	}
+}
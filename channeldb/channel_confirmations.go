@@ -0,0 +1,92 @@
+package channeldb
+
+import (
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// chanConfirmationsKey can be accessed within the bucket for a
+	// channel, and stores the number of confirmations its funding
+	// transaction had received when last updated.
+	chanConfirmationsKey = []byte("chan-confirmations-key")
+)
+
+// UpdateConfirmations records the number of confirmations the channel's
+// funding transaction has received, as reported by the chain as new blocks
+// arrive.
+func (c *OpenChannel) UpdateConfirmations(numConfs uint32) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if err := c.Db.Update(func(tx *bbolt.Tx) error {
+		chanBucket, err := fetchChanBucket(
+			tx, c.IdentityPub, &c.FundingOutpoint, c.ChainHash,
+		)
+		if err != nil {
+			return err
+		}
+
+		return putChanConfirmations(chanBucket, numConfs)
+	}); err != nil {
+		return err
+	}
+
+	c.Confirmations = numConfs
+
+	return nil
+}
+
+// UnconfirmedChannels returns all pending channels whose funding transaction
+// has yet to reach the number of confirmations the channel requires. The
+// number of confirmations each has received so far is found within its
+// Confirmations field.
+func (d *DB) UnconfirmedChannels() ([]*OpenChannel, error) {
+	pendingChannels, err := d.FetchPendingChannels()
+	if err != nil {
+		return nil, err
+	}
+
+	var channels []*OpenChannel
+	for _, channel := range pendingChannels {
+		if channel.Confirmations >= uint32(channel.NumConfsRequired) {
+			continue
+		}
+
+		channels = append(channels, channel)
+	}
+
+	return channels, nil
+}
+
+// openConfirmations returns the number of confirmations recorded for the
+// passed channel once it's marked as open, which is never below the number
+// it requires.
+func openConfirmations(channel *OpenChannel) uint32 {
+	numConfsRequired := uint32(channel.NumConfsRequired)
+	if channel.Confirmations < numConfsRequired {
+		return numConfsRequired
+	}
+
+	return channel.Confirmations
+}
+
+// putChanConfirmations stores the number of confirmations of the channel's
+// funding transaction within the passed channel bucket.
+func putChanConfirmations(chanBucket *bbolt.Bucket, numConfs uint32) error {
+	var b [4]byte
+	byteOrder.PutUint32(b[:], numConfs)
+
+	return chanBucket.Put(chanConfirmationsKey, b[:])
+}
+
+// fetchChanConfirmations returns the number of confirmations of the channel's
+// funding transaction stored within the passed channel bucket. Pending
+// channels stored before they were recorded have no confirmations.
+func fetchChanConfirmations(chanBucket *bbolt.Bucket) uint32 {
+	value := chanBucket.Get(chanConfirmationsKey)
+	if len(value) != 4 {
+		return 0
+	}
+
+	return byteOrder.Uint32(value)
+}
@@ -0,0 +1,90 @@
+package channeldb
+
+import (
+	"net"
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestUnconfirmedChannels asserts that pending channels are reported as
+// unconfirmed along with their confirmations, until their funding transaction
+// reaches the required depth.
+func TestUnconfirmedChannels(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	addr := &net.TCPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 18555,
+	}
+	if err := channel.SyncPending(addr, 101); err != nil {
+		t.Fatalf("unable to sync channel: %v", err)
+	}
+
+	assertUnconfirmed := func(numConfs uint32, unconfirmed bool) {
+		t.Helper()
+
+		channels, err := cdb.UnconfirmedChannels()
+		if err != nil {
+			t.Fatalf("unable to fetch unconfirmed channels: %v",
+				err)
+		}
+
+		switch {
+		case !unconfirmed && len(channels) != 0:
+			t.Fatalf("expected no unconfirmed channels, got %v",
+				len(channels))
+
+		case unconfirmed && len(channels) != 1:
+			t.Fatalf("expected 1 unconfirmed channel, got %v",
+				len(channels))
+
+		case unconfirmed && channels[0].Confirmations != numConfs:
+			t.Fatalf("expected %v confirmations, got %v", numConfs,
+				channels[0].Confirmations)
+		}
+
+		stored, err := cdb.FetchChannel(channel.FundingOutpoint)
+		if err != nil {
+			t.Fatalf("unable to fetch channel: %v", err)
+		}
+		if stored.Confirmations != numConfs {
+			t.Fatalf("expected %v stored confirmations, got %v",
+				numConfs, stored.Confirmations)
+		}
+	}
+
+	// The channel requires four confirmations, so it remains unconfirmed
+	// until the fourth arrives.
+	assertUnconfirmed(0, true)
+	if err := channel.UpdateConfirmations(3); err != nil {
+		t.Fatalf("unable to update confirmations: %v", err)
+	}
+	assertUnconfirmed(3, true)
+
+	if err := channel.UpdateConfirmations(4); err != nil {
+		t.Fatalf("unable to update confirmations: %v", err)
+	}
+	assertUnconfirmed(4, false)
+
+	// Marking a channel as open implies it reached the required depth,
+	// even if its last confirmations weren't recorded.
+	if err := channel.UpdateConfirmations(1); err != nil {
+		t.Fatalf("unable to update confirmations: %v", err)
+	}
+	openLoc := lnwire.NewShortChanIDFromInt(100)
+	if err := channel.MarkAsOpen(openLoc); err != nil {
+		t.Fatalf("unable to mark channel open: %v", err)
+	}
+	assertUnconfirmed(uint32(channel.NumConfsRequired), false)
+}
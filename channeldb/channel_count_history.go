@@ -0,0 +1,178 @@
+package channeldb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// closedChanLifetimeBucket is the top-level bucket that retains the
+	// open and close time of each closed channel, as both are lost along
+	// with the channel's bucket once it's closed, and the close summary
+	// carries neither.
+	//
+	// maps: chanPoint => openTime || closeTime
+	closedChanLifetimeBucket = []byte("closed-chan-lifetimes")
+
+	// ErrInvalidCountInterval is returned when querying the channel count
+	// history with a non-positive bucket size, or an end preceding the
+	// start.
+	ErrInvalidCountInterval = fmt.Errorf("invalid channel count interval")
+
+	// ErrTooManyCountSamples is returned when querying the channel count
+	// history over an interval that spans more than MaxCountSamples
+	// buckets.
+	ErrTooManyCountSamples = fmt.Errorf("channel count history exceeds "+
+		"max of %v samples", MaxCountSamples)
+)
+
+const (
+	// MaxCountSamples is the max number of samples returned by
+	// ChannelCountHistory.
+	MaxCountSamples = 10000
+)
+
+// CountSample is the number of channels that were open at a point in time.
+type CountSample struct {
+	// Time is the time of the sample.
+	Time time.Time
+
+	// Count is the number of channels open at the time.
+	Count uint64
+}
+
+// ChannelCountHistory returns the number of channels that were open at start,
+// and at every multiple of bucket following it up to and including end. A
+// channel counts as open from the time it was first written to the database
+// until the time it was closed. Channels that are still pending aren't
+// counted, nor are channels whose open time wasn't recorded, or that were
+// closed before their close time started to be recorded.
+func (d *DB) ChannelCountHistory(bucket time.Duration, start,
+	end time.Time) ([]CountSample, error) {
+
+	if bucket <= 0 || end.Before(start) {
+		return nil, ErrInvalidCountInterval
+	}
+	if end.Sub(start)/bucket >= MaxCountSamples {
+		return nil, ErrTooManyCountSamples
+	}
+
+	var samples []CountSample
+	for t := start; !t.After(end); t = t.Add(bucket) {
+		samples = append(samples, CountSample{Time: t})
+	}
+
+	// countLifetime adds the channel with the given lifetime to every
+	// sample it was open at. Channels that are still open have a zero
+	// close time.
+	countLifetime := func(openTime, closeTime time.Time) {
+		if openTime.IsZero() {
+			return
+		}
+		for i := range samples {
+			if samples[i].Time.Before(openTime) {
+				continue
+			}
+			closed := !closeTime.IsZero() &&
+				!samples[i].Time.Before(closeTime)
+			if closed {
+				break
+			}
+			samples[i].Count++
+		}
+	}
+
+	err := d.View(func(tx *bbolt.Tx) error {
+		for i := range samples {
+			samples[i].Count = 0
+		}
+
+		openChanBucket := tx.Bucket(openChannelBucket)
+		if openChanBucket != nil {
+			err := forEachChanBucket(openChanBucket, func(
+				op wire.OutPoint,
+				chanBucket *bbolt.Bucket) error {
+
+				channel := &OpenChannel{
+					FundingOutpoint: op,
+				}
+				err := fetchChanInfo(chanBucket, channel)
+				if err != nil {
+					return err
+				}
+				if channel.IsPending {
+					return nil
+				}
+
+				countLifetime(
+					fetchChanOpenTime(chanBucket),
+					time.Time{},
+				)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		lifetimes := tx.Bucket(closedChanLifetimeBucket)
+		if lifetimes == nil {
+			return nil
+		}
+
+		return lifetimes.ForEach(func(k, v []byte) error {
+			if len(v) != 16 {
+				return fmt.Errorf("invalid lifetime of closed "+
+					"channel %x", k)
+			}
+
+			countLifetime(
+				time.Unix(0, int64(byteOrder.Uint64(v[:8]))),
+				time.Unix(0, int64(byteOrder.Uint64(v[8:]))),
+			)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// putChanLifetimeOnClose records the open time of a channel that's being
+// closed, along with the current time as its close time.
+func putChanLifetimeOnClose(tx *bbolt.Tx, channel *OpenChannel) error {
+	_, _, chanBucket, err := findChanBucket(tx, &channel.FundingOutpoint)
+	if err != nil {
+		return err
+	}
+
+	openTime := fetchChanOpenTime(chanBucket)
+	if openTime.IsZero() {
+		return nil
+	}
+
+	return putClosedChanLifetime(
+		tx, channel.FundingOutpoint, openTime, time.Now(),
+	)
+}
+
+// putClosedChanLifetime stores the open and close time of a closed channel.
+func putClosedChanLifetime(tx *bbolt.Tx, op wire.OutPoint, openTime,
+	closeTime time.Time) error {
+
+	lifetimes, err := tx.CreateBucketIfNotExists(closedChanLifetimeBucket)
+	if err != nil {
+		return err
+	}
+
+	var v [16]byte
+	byteOrder.PutUint64(v[:8], uint64(openTime.UnixNano()))
+	byteOrder.PutUint64(v[8:], uint64(closeTime.UnixNano()))
+
+	return lifetimes.Put(canonicalChannelKey(op), v[:])
+}
@@ -0,0 +1,140 @@
+package channeldb
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+// TestChannelCountHistory asserts that channels are counted as open from their
+// open time until their close time, and that the lifetime of a channel is
+// retained once it's closed.
+func TestChannelCountHistory(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	start := time.Unix(1000000, 0)
+	_, err = db.ChannelCountHistory(0, start, start)
+	if err != ErrInvalidCountInterval {
+		t.Fatalf("expected ErrInvalidCountInterval, got %v", err)
+	}
+	_, err = db.ChannelCountHistory(time.Hour, start, start.Add(-1))
+	if err != ErrInvalidCountInterval {
+		t.Fatalf("expected ErrInvalidCountInterval, got %v", err)
+	}
+	_, err = db.ChannelCountHistory(
+		time.Second, start, start.Add(MaxCountSamples*time.Second),
+	)
+	if err != ErrTooManyCountSamples {
+		t.Fatalf("expected ErrTooManyCountSamples, got %v", err)
+	}
+
+	newChannel := func(openTime time.Time, pending bool) *OpenChannel {
+		t.Helper()
+
+		channel, err := createTestChannelState(db)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		if pending {
+			addr := &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 18555,
+			}
+			err = channel.SyncPending(addr, 101)
+		} else {
+			channel.IsPending = false
+			err = channel.FullSync()
+		}
+		if err != nil {
+			t.Fatalf("unable to save channel state: %v", err)
+		}
+
+		// We'll overwrite the open time recorded for the channel,
+		// such that it doesn't depend on the time the test runs.
+		err = db.Update(func(tx *bbolt.Tx) error {
+			chanBucket, err := fetchChanBucket(
+				tx, channel.IdentityPub,
+				&channel.FundingOutpoint, channel.ChainHash,
+			)
+			if err != nil {
+				return err
+			}
+
+			return putChanOpenTime(chanBucket, openTime)
+		})
+		if err != nil {
+			t.Fatalf("unable to set open time: %v", err)
+		}
+
+		return channel
+	}
+
+	// The first channel is open since an hour after the start, while the
+	// second one was open from the start until three hours after it. The
+	// third channel is still pending.
+	newChannel(start.Add(time.Hour), false)
+	closed := newChannel(start, false)
+	newChannel(start, true)
+
+	summary := &ChannelCloseSummary{
+		ChanPoint:       closed.FundingOutpoint,
+		ShortChanID:     closed.ShortChannelID,
+		ChainHash:       closed.ChainHash,
+		RemotePub:       closed.IdentityPub,
+		Capacity:        closed.Capacity,
+		CloseType:       CooperativeClose,
+		LocalChanConfig: closed.LocalChanCfg,
+	}
+	if err := closed.CloseChannel(summary); err != nil {
+		t.Fatalf("unable to close channel: %v", err)
+	}
+
+	// The close time is recorded as the time the channel is closed, so
+	// we'll overwrite it as well.
+	closeTime := start.Add(3 * time.Hour)
+	err = db.Update(func(tx *bbolt.Tx) error {
+		lifetimes := tx.Bucket(closedChanLifetimeBucket)
+		if lifetimes == nil || lifetimes.Stats().KeyN != 1 {
+			t.Fatalf("expected lifetime of closed channel")
+		}
+
+		return putClosedChanLifetime(
+			tx, closed.FundingOutpoint, start, closeTime,
+		)
+	})
+	if err != nil {
+		t.Fatalf("unable to set close time: %v", err)
+	}
+
+	samples, err := db.ChannelCountHistory(
+		time.Hour, start, start.Add(4*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("unable to fetch channel count history: %v", err)
+	}
+
+	expected := []uint64{1, 2, 2, 1, 1}
+	if len(samples) != len(expected) {
+		t.Fatalf("expected %v samples, got %v", len(expected),
+			len(samples))
+	}
+	for i, sample := range samples {
+		sampleTime := start.Add(time.Duration(i) * time.Hour)
+		if !sample.Time.Equal(sampleTime) {
+			t.Fatalf("expected sample at %v, got %v", sampleTime,
+				sample.Time)
+		}
+		if sample.Count != expected[i] {
+			t.Fatalf("expected %v channels at %v, got %v",
+				expected[i], sample.Time, sample.Count)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+)
+
+const (
+	// channelExportVersion is the version of the format written by
+	// ExportChannel. It must be bumped whenever the format changes, such
+	// that older exports are either converted or rejected by
+	// ImportChannel.
+	channelExportVersion uint16 = 1
+
+	// maxChannelExportElementSize is the maximum size of a single key or
+	// value within an exported channel. Commitments carrying a large
+	// number of HTLCs exceed the limit imposed by ReadElement.
+	maxChannelExportElementSize = 1 << 24
+)
+
+var (
+	// ErrUnknownChannelExportVersion is returned when attempting to import
+	// a channel that was exported using an unknown format.
+	ErrUnknownChannelExportVersion = fmt.Errorf("unknown channel export " +
+		"version")
+)
+
+// ExportChannel writes the complete state of the open channel identified by
+// the passed channel point to w. This includes the channel's static
+// parameters, its current commitments and HTLCs, the revocation state, the
+// revocation log, any pending commit diff and the channel's forwarding
+// packages. The export is versioned, and can be loaded into another database
+// using ImportChannel, allowing a single channel to be reproduced without
+// sharing the remainder of the database. Exporting the same channel state
+// always yields the same bytes, so exports can be compared or hashed
+// directly.
+func (d *DB) ExportChannel(op wire.OutPoint, w io.Writer) error {
+	var b bytes.Buffer
+	err := d.View(func(tx *bbolt.Tx) error {
+		nodePub, chainHash, chanBucket, err := findChanBucket(tx, &op)
+		if err != nil {
+			return err
+		}
+
+		// We'll decode the channel to ensure we're exporting a well
+		// formed record, and to learn the short channel ID its
+		// forwarding packages are stored under.
+		channel, err := fetchOpenChannel(chanBucket, &op)
+		if err != nil {
+			return err
+		}
+
+		err = WriteElements(
+			&b, channelExportVersion, nodePub, chainHash, op,
+		)
+		if err != nil {
+			return err
+		}
+		if err := exportBucket(&b, chanBucket); err != nil {
+			return err
+		}
+
+		var fwdPkgs *bbolt.Bucket
+		if fwdPkgBkt := tx.Bucket(fwdPackagesKey); fwdPkgBkt != nil {
+			source := makeLogKey(channel.ShortChannelID.ToUint64())
+			fwdPkgs = fwdPkgBkt.Bucket(source[:])
+		}
+		if err := WriteElement(&b, fwdPkgs != nil); err != nil {
+			return err
+		}
+		if fwdPkgs == nil {
+			return nil
+		}
+
+		return exportBucket(&b, fwdPkgs)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// ImportChannel loads a channel written by ExportChannel into the database.
+// The channel, along with its forwarding packages, is stored exactly as it
+// was found within the exporting database. If the database already contains
+// the channel, ErrChanAlreadyExists is returned.
+func (d *DB) ImportChannel(r io.Reader) error {
+	var version uint16
+	if err := ReadElement(r, &version); err != nil {
+		return err
+	}
+	if version != channelExportVersion {
+		return ErrUnknownChannelExportVersion
+	}
+
+	var (
+		nodePub   *btcec.PublicKey
+		chainHash chainhash.Hash
+		chanPoint wire.OutPoint
+	)
+	err := ReadElements(r, &nodePub, &chainHash, &chanPoint)
+	if err != nil {
+		return err
+	}
+
+	// As the import is applied within a single transaction, we'll read the
+	// entire export before touching the database.
+	chanEntries, err := importBucket(r)
+	if err != nil {
+		return err
+	}
+
+	var hasFwdPkgs bool
+	if err := ReadElement(r, &hasFwdPkgs); err != nil {
+		return err
+	}
+	var fwdPkgEntries []exportedEntry
+	if hasFwdPkgs {
+		fwdPkgEntries, err = importBucket(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return d.Update(func(tx *bbolt.Tx) error {
+		openChanBucket, err := tx.CreateBucketIfNotExists(
+			openChannelBucket,
+		)
+		if err != nil {
+			return err
+		}
+		nodeChanBucket, err := openChanBucket.CreateBucketIfNotExists(
+			nodePub.SerializeCompressed(),
+		)
+		if err != nil {
+			return err
+		}
+		chainBucket, err := nodeChanBucket.CreateBucketIfNotExists(
+			chainHash[:],
+		)
+		if err != nil {
+			return err
+		}
+
+		chanKey := canonicalChannelKey(chanPoint)
+		chanBucket, err := chainBucket.CreateBucket(chanKey)
+		switch {
+		case err == bbolt.ErrBucketExists:
+			return ErrChanAlreadyExists
+		case err != nil:
+			return err
+		}
+
+		err = putExportedEntries(chanBucket, chanEntries)
+		if err != nil {
+			return err
+		}
+
+		// Before going any further, we'll ensure that the imported
+		// channel can be decoded.
+		channel, err := fetchOpenChannel(chanBucket, &chanPoint)
+		if err != nil {
+			return fmt.Errorf("unable to decode imported channel: "+
+				"%v", err)
+		}
+
+		// The channel retains the UUID it was assigned by the exporting
+		// database, which we'll add to our own index.
+		if channel.UUID == ([16]byte{}) {
+			channel.UUID, err = newChannelUUID()
+			if err != nil {
+				return err
+			}
+		}
+		err = putChanUUID(
+			tx, chanBucket, channel.UUID,
+			nodePub.SerializeCompressed(), chainHash[:],
+			chanKey,
+		)
+		if err != nil {
+			return err
+		}
+
+		if hasFwdPkgs {
+			fwdPkgBkt, err := tx.CreateBucketIfNotExists(
+				fwdPackagesKey,
+			)
+			if err != nil {
+				return err
+			}
+
+			source := makeLogKey(channel.ShortChannelID.ToUint64())
+			sourceBkt, err := fwdPkgBkt.CreateBucket(source[:])
+			switch {
+			case err == bbolt.ErrBucketExists:
+				return ErrChanAlreadyExists
+			case err != nil:
+				return err
+			}
+
+			err = putExportedEntries(sourceBkt, fwdPkgEntries)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Finally, we'll create the link node for the channel's peer,
+		// unless one already exists.
+		linkNodes, err := tx.CreateBucketIfNotExists(nodeInfoBucket)
+		if err != nil {
+			return err
+		}
+		if linkNodes.Get(nodePub.SerializeCompressed()) != nil {
+			return nil
+		}
+
+		return putLinkNode(
+			linkNodes, d.NewLinkNode(wire.MainNet, nodePub),
+		)
+	})
+}
+
+// findChanBucket locates the bucket of the open channel identified by the
+// passed channel point, returning it along with the public key of the
+// channel's peer and the chain it was opened on.
+func findChanBucket(tx *bbolt.Tx, chanPoint *wire.OutPoint) (*btcec.PublicKey,
+	chainhash.Hash, *bbolt.Bucket, error) {
+
+	var chainHash chainhash.Hash
+
+	openChanBucket := tx.Bucket(openChannelBucket)
+	if openChanBucket == nil {
+		return nil, chainHash, nil, ErrNoActiveChannels
+	}
+
+	chanKey := canonicalChannelKey(*chanPoint)
+
+	var (
+		nodePub    []byte
+		chanBucket *bbolt.Bucket
+	)
+	err := openChanBucket.ForEach(func(k, v []byte) error {
+		if len(k) != 33 || v != nil || chanBucket != nil {
+			return nil
+		}
+
+		nodeChanBucket := openChanBucket.Bucket(k)
+		return nodeChanBucket.ForEach(func(chain, v []byte) error {
+			if v != nil || chanBucket != nil {
+				return nil
+			}
+
+			chainBucket := nodeChanBucket.Bucket(chain)
+			if chainBucket == nil {
+				return nil
+			}
+
+			chanBucket = chainBucket.Bucket(chanKey)
+			if chanBucket != nil {
+				nodePub = k
+				copy(chainHash[:], chain)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, chainHash, nil, err
+	}
+	if chanBucket == nil {
+		return nil, chainHash, nil, ErrChannelNotFound
+	}
+
+	pub, err := btcec.ParsePubKey(nodePub, btcec.S256())
+	if err != nil {
+		return nil, chainHash, nil, err
+	}
+
+	return pub, chainHash, chanBucket, nil
+}
+
+// exportedEntry is a single key within an exported bucket. An entry either
+// carries a value, or is a nested bucket holding entries of its own.
+type exportedEntry struct {
+	key      []byte
+	value    []byte
+	children []exportedEntry
+	isBucket bool
+}
+
+// exportBucket recursively writes all keys and nested buckets of the passed
+// bucket to w. Entries are written in the byte order of their keys, as
+// traversed by bbolt, so the output only depends on the bucket's contents.
+func exportBucket(w io.Writer, bucket *bbolt.Bucket) error {
+	var numEntries uint32
+	err := bucket.ForEach(func(_, _ []byte) error {
+		numEntries++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := WriteElement(w, numEntries); err != nil {
+		return err
+	}
+
+	return bucket.ForEach(func(k, v []byte) error {
+		isBucket := v == nil
+		if err := wire.WriteVarBytes(w, 0, k); err != nil {
+			return err
+		}
+		if err := WriteElement(w, isBucket); err != nil {
+			return err
+		}
+
+		if isBucket {
+			return exportBucket(w, bucket.Bucket(k))
+		}
+
+		return wire.WriteVarBytes(w, 0, v)
+	})
+}
+
+// importBucket reads the entries of a bucket written by exportBucket.
+func importBucket(r io.Reader) ([]exportedEntry, error) {
+	var numEntries uint32
+	if err := ReadElement(r, &numEntries); err != nil {
+		return nil, err
+	}
+
+	var entries []exportedEntry
+	for i := uint32(0); i < numEntries; i++ {
+		var (
+			entry exportedEntry
+			err   error
+		)
+		entry.key, err = wire.ReadVarBytes(
+			r, 0, maxChannelExportElementSize, "key",
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := ReadElement(r, &entry.isBucket); err != nil {
+			return nil, err
+		}
+
+		if entry.isBucket {
+			entry.children, err = importBucket(r)
+		} else {
+			entry.value, err = wire.ReadVarBytes(
+				r, 0, maxChannelExportElementSize, "value",
+			)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// putExportedEntries recursively stores the passed entries within bucket.
+func putExportedEntries(bucket *bbolt.Bucket, entries []exportedEntry) error {
+	for _, entry := range entries {
+		if !entry.isBucket {
+			err := bucket.Put(entry.key, entry.value)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		child, err := bucket.CreateBucketIfNotExists(entry.key)
+		if err != nil {
+			return err
+		}
+		err = putExportedEntries(child, entry.children)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package channeldb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/bbolt"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestExportImportChannel asserts that a channel exported from one database
+// can be imported into another, retaining its commitments, revocation log and
+// forwarding packages.
+func TestExportImportChannel(t *testing.T) {
+	t.Parallel()
+
+	srcDB, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+
+	channel, err := createTestChannelState(srcDB)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	channel.LocalCommitment.Htlcs = []HTLC{
+		{
+			Signature:     testSig.Serialize(),
+			Incoming:      true,
+			Amt:           10,
+			RHash:         key,
+			RefundTimeout: 1,
+			OnionBlob:     []byte("onionblob"),
+		},
+	}
+	if err := channel.FullSync(); err != nil {
+		t.Fatalf("unable to save channel state: %v", err)
+	}
+
+	// We'll advance the remote commitment once, such that the channel has
+	// an entry within its revocation log and a forwarding package.
+	remoteCommit := channel.RemoteCommitment
+	remoteCommit.CommitHeight = 1
+	commitDiff := &CommitDiff{
+		Commitment: remoteCommit,
+		CommitSig: &lnwire.CommitSig{
+			ChanID:    lnwire.ChannelID(key),
+			CommitSig: wireSig,
+		},
+		OpenedCircuitKeys: []CircuitKey{},
+		ClosedCircuitKeys: []CircuitKey{},
+	}
+	if err := channel.AppendRemoteCommitChain(commitDiff); err != nil {
+		t.Fatalf("unable to add to commit chain: %v", err)
+	}
+	fwdPkg := NewFwdPkg(channel.ShortChanID(), 0, nil, nil)
+	if err := channel.AdvanceCommitChainTail(fwdPkg); err != nil {
+		t.Fatalf("unable to advance commit chain: %v", err)
+	}
+
+	var b bytes.Buffer
+	if err := srcDB.ExportChannel(channel.FundingOutpoint, &b); err != nil {
+		t.Fatalf("unable to export channel: %v", err)
+	}
+	export := b.Bytes()
+
+	// Exporting the unchanged channel again should yield the exact same
+	// bytes.
+	var reExport bytes.Buffer
+	err = srcDB.ExportChannel(channel.FundingOutpoint, &reExport)
+	if err != nil {
+		t.Fatalf("unable to export channel: %v", err)
+	}
+	if !bytes.Equal(export, reExport.Bytes()) {
+		t.Fatalf("channel export isn't deterministic")
+	}
+
+	dstDB, cleanUp2, err := makeTestDB()
+	defer cleanUp2()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	if err := dstDB.ImportChannel(bytes.NewReader(export)); err != nil {
+		t.Fatalf("unable to import channel: %v", err)
+	}
+
+	// The imported channel should match the one found within the source
+	// database.
+	srcChannel, err := srcDB.FetchChannel(channel.FundingOutpoint)
+	if err != nil {
+		t.Fatalf("unable to fetch channel: %v", err)
+	}
+	dstChannel, err := dstDB.FetchChannel(channel.FundingOutpoint)
+	if err != nil {
+		t.Fatalf("unable to fetch imported channel: %v", err)
+	}
+	srcChannel.Db, dstChannel.Db = nil, nil
+	if !reflect.DeepEqual(srcChannel, dstChannel) {
+		t.Fatalf("imported channel doesn't match: %v vs %v",
+			spew.Sdump(srcChannel), spew.Sdump(dstChannel))
+	}
+	dstChannel.Db = dstDB
+
+	// As the imported channel is stored exactly as it was exported, its
+	// export should match the original one byte for byte.
+	var dstExport bytes.Buffer
+	err = dstDB.ExportChannel(channel.FundingOutpoint, &dstExport)
+	if err != nil {
+		t.Fatalf("unable to export imported channel: %v", err)
+	}
+	if !bytes.Equal(export, dstExport.Bytes()) {
+		t.Fatalf("export of imported channel doesn't match")
+	}
+
+	// Its revocation log and forwarding packages should have been carried
+	// over as well.
+	prevCommit, err := dstChannel.FindPreviousState(0)
+	if err != nil {
+		t.Fatalf("unable to fetch revoked state: %v", err)
+	}
+	assertCommitmentEqual(t, &channel.RemoteCommitment, prevCommit)
+
+	var fwdPkgs []*FwdPkg
+	err = dstDB.View(func(tx *bbolt.Tx) error {
+		var err error
+		fwdPkgs, err = dstChannel.Packager.LoadFwdPkgs(tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unable to load forwarding packages: %v", err)
+	}
+	if len(fwdPkgs) != 1 {
+		t.Fatalf("expected 1 forwarding package, got %v", len(fwdPkgs))
+	}
+
+	// The peer of the channel should now be known as a link node.
+	if _, err := dstDB.FetchLinkNode(channel.IdentityPub); err != nil {
+		t.Fatalf("unable to fetch link node: %v", err)
+	}
+
+	// Importing the channel a second time should fail.
+	err = dstDB.ImportChannel(bytes.NewReader(export))
+	if err != ErrChanAlreadyExists {
+		t.Fatalf("expected ErrChanAlreadyExists, got %v", err)
+	}
+
+	// Exports of an unknown version should be rejected.
+	unknownVersion := append([]byte(nil), export...)
+	unknownVersion[1]++
+	err = dstDB.ImportChannel(bytes.NewReader(unknownVersion))
+	if err != ErrUnknownChannelExportVersion {
+		t.Fatalf("expected ErrUnknownChannelExportVersion, got %v", err)
+	}
+}
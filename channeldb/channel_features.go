@@ -0,0 +1,75 @@
+package channeldb
+
+import (
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// ChannelsWithPeerFeature returns all open channels whose remote node
+// advertises support for the given feature bit, in either its required or
+// optional form. The features of each peer are taken from the node
+// announcement stored within the channel graph, so channels with peers that
+// haven't announced themselves are never returned. If no peer supports the
+// feature, an empty slice is returned.
+func (d *DB) ChannelsWithPeerFeature(
+	bit lnwire.FeatureBit) ([]*OpenChannel, error) {
+
+	channels, err := d.FetchAllOpenChannels()
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]*OpenChannel, 0)
+	err = d.View(func(tx *bbolt.Tx) error {
+		nodes := tx.Bucket(nodeBucket)
+		if nodes == nil {
+			return nil
+		}
+
+		// As a peer may have several channels with us, we'll only look
+		// up the features of each of them once.
+		supportsFeature := make(map[string]bool)
+		for _, channel := range channels {
+			nodePub := channel.IdentityPub.SerializeCompressed()
+
+			supported, ok := supportsFeature[string(nodePub)]
+			if !ok {
+				node, err := fetchLightningNode(nodes, nodePub)
+				switch {
+				case err == ErrGraphNodeNotFound:
+				case err != nil:
+					return err
+				default:
+					supported = hasFeaturePair(
+						node.Features, bit,
+					)
+				}
+				supportsFeature[string(nodePub)] = supported
+			}
+
+			if supported {
+				matches = append(matches, channel)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// hasFeaturePair returns whether the feature vector has either the given bit
+// or its even/odd counterpart set. As feature bits are always assigned in
+// pairs, this holds regardless of whether the feature is known to us.
+func hasFeaturePair(features *lnwire.FeatureVector,
+	bit lnwire.FeatureBit) bool {
+
+	if features == nil {
+		return false
+	}
+
+	return features.IsSet(bit) || features.IsSet(bit^1)
+}
@@ -0,0 +1,91 @@
+package channeldb
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestChannelsWithPeerFeature asserts that only channels whose peers announced
+// the queried feature are returned.
+func TestChannelsWithPeerFeature(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+	graph := cdb.ChannelGraph()
+
+	const optionalBit lnwire.FeatureBit = 9
+
+	// We'll create a channel with a peer that announced the optional form
+	// of the feature, one with a peer that didn't announce it, and one
+	// with a peer that isn't part of the graph.
+	createChannel := func(features *lnwire.FeatureVector) *OpenChannel {
+		t.Helper()
+
+		node, err := createTestVertex(cdb)
+		if err != nil {
+			t.Fatalf("unable to create test node: %v", err)
+		}
+		if features != nil {
+			node.Features = features
+			err := graph.AddLightningNode(node)
+			if err != nil {
+				t.Fatalf("unable to add node: %v", err)
+			}
+		}
+
+		channel, err := createTestChannelState(cdb)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		channel.IdentityPub, err = btcec.ParsePubKey(
+			node.PubKeyBytes[:], btcec.S256(),
+		)
+		if err != nil {
+			t.Fatalf("unable to parse node key: %v", err)
+		}
+		if err := channel.FullSync(); err != nil {
+			t.Fatalf("unable to save channel state: %v", err)
+		}
+
+		return channel
+	}
+
+	supporting := createChannel(lnwire.NewFeatureVector(
+		lnwire.NewRawFeatureVector(optionalBit), lnwire.GlobalFeatures,
+	))
+	createChannel(lnwire.NewFeatureVector(nil, lnwire.GlobalFeatures))
+	createChannel(nil)
+
+	// Querying either form of the feature should only yield the channel
+	// with the supporting peer.
+	for _, bit := range []lnwire.FeatureBit{optionalBit, optionalBit - 1} {
+		channels, err := cdb.ChannelsWithPeerFeature(bit)
+		if err != nil {
+			t.Fatalf("unable to fetch channels: %v", err)
+		}
+		if len(channels) != 1 {
+			t.Fatalf("expected 1 channel with feature %v, got %v",
+				bit, len(channels))
+		}
+		if channels[0].FundingOutpoint != supporting.FundingOutpoint {
+			t.Fatalf("expected channel %v, got %v",
+				supporting.FundingOutpoint,
+				channels[0].FundingOutpoint)
+		}
+	}
+
+	// A feature no peer supports should yield an empty slice.
+	channels, err := cdb.ChannelsWithPeerFeature(optionalBit + 2)
+	if err != nil {
+		t.Fatalf("unable to fetch channels: %v", err)
+	}
+	if channels == nil || len(channels) != 0 {
+		t.Fatalf("expected empty slice, got %v", channels)
+	}
+}
@@ -0,0 +1,231 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// channelActivityBucket is the top-level bucket that stores the
+	// transitions of open channels between being active and inactive.
+	// Each channel has its own sub-bucket, keyed by its funding outpoint,
+	// which holds the last known state of the channel along with a
+	// sub-bucket of its transitions.
+	channelActivityBucket = []byte("channel-activity")
+
+	// chanActiveStateKey is the key of the last known state of a channel
+	// within its activity bucket, which is 1 if the channel is active and
+	// 0 otherwise.
+	chanActiveStateKey = []byte("active")
+
+	// chanFlapsKey is the sub-bucket of the activity bucket of a channel
+	// holding an entry per transition, keyed by the time of the
+	// transition followed by a sequence number to keep transitions at the
+	// same time apart. The value is the state transitioned to.
+	//
+	// maps: transitionTime || seqNo => active
+	chanFlapsKey = []byte("flaps")
+
+	// ErrInvalidFlapWindow is returned when querying for flapping channels
+	// over a non-positive window, or one exceeding MaxFlapWindow.
+	ErrInvalidFlapWindow = fmt.Errorf("flap window must be positive and "+
+		"at most %v", MaxFlapWindow)
+
+	// ErrInvalidFlapCount is returned when querying for flapping channels
+	// with a non-positive min number of flaps.
+	ErrInvalidFlapCount = fmt.Errorf("min number of flaps must be " +
+		"positive")
+)
+
+const (
+	// MaxFlapWindow is the largest window over which channels can be
+	// queried for flaps. Transitions recorded before this are trimmed as
+	// new ones are recorded.
+	MaxFlapWindow = 7 * 24 * time.Hour
+)
+
+// ChannelFlap is the number of times a channel transitioned between being
+// active and inactive.
+type ChannelFlap struct {
+	// ChanPoint is the funding outpoint of the channel.
+	ChanPoint wire.OutPoint
+
+	// NumFlaps is the number of transitions of the channel, in either
+	// direction.
+	NumFlaps int
+}
+
+// RecordChannelActivity records that the open channel with the passed funding
+// outpoint is active or inactive as of the passed time. Only changes of the
+// state are recorded as flaps, so the first state recorded for a channel
+// isn't one. Any flaps recorded for the channel that have fallen out of
+// MaxFlapWindow are trimmed along the way.
+func (d *DB) RecordChannelActivity(chanPoint wire.OutPoint, active bool,
+	t time.Time) error {
+
+	state := []byte{0}
+	if active {
+		state[0] = 1
+	}
+
+	return d.Batch(func(tx *bbolt.Tx) error {
+		if _, _, _, err := findChanBucket(tx, &chanPoint); err != nil {
+			return err
+		}
+
+		activity, err := tx.CreateBucketIfNotExists(
+			channelActivityBucket,
+		)
+		if err != nil {
+			return err
+		}
+		chanActivity, err := activity.CreateBucketIfNotExists(
+			canonicalChannelKey(chanPoint),
+		)
+		if err != nil {
+			return err
+		}
+
+		lastState := chanActivity.Get(chanActiveStateKey)
+		if bytes.Equal(lastState, state) {
+			return nil
+		}
+		err = chanActivity.Put(chanActiveStateKey, state)
+		if err != nil {
+			return err
+		}
+		if lastState == nil {
+			return nil
+		}
+
+		flaps, err := chanActivity.CreateBucketIfNotExists(chanFlapsKey)
+		if err != nil {
+			return err
+		}
+		seqNo, err := flaps.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		var key [16]byte
+		byteOrder.PutUint64(key[:8], uint64(t.UnixNano()))
+		byteOrder.PutUint64(key[8:], seqNo)
+		if err := flaps.Put(key[:], state); err != nil {
+			return err
+		}
+
+		return trimTimeSeries(flaps, t.Add(-MaxFlapWindow))
+	})
+}
+
+// FlappingChannels returns the channels that transitioned between being active
+// and inactive at least minFlaps times within the window ending at now, both
+// bounds inclusive. Channels are sorted by their number of flaps in
+// descending order, with ties broken by their funding outpoint.
+func (d *DB) FlappingChannels(window time.Duration, now time.Time,
+	minFlaps int) ([]ChannelFlap, error) {
+
+	if window <= 0 || window > MaxFlapWindow {
+		return nil, ErrInvalidFlapWindow
+	}
+	if minFlaps <= 0 {
+		return nil, ErrInvalidFlapCount
+	}
+
+	var startKey, endKey [8]byte
+	byteOrder.PutUint64(startKey[:], uint64(now.Add(-window).UnixNano()))
+	byteOrder.PutUint64(endKey[:], uint64(now.UnixNano()))
+
+	var channelFlaps []ChannelFlap
+	err := d.View(func(tx *bbolt.Tx) error {
+		channelFlaps = nil
+
+		activity := tx.Bucket(channelActivityBucket)
+		if activity == nil {
+			return nil
+		}
+
+		return activity.ForEach(func(chanKey, _ []byte) error {
+			chanActivity := activity.Bucket(chanKey)
+			if chanActivity == nil {
+				return nil
+			}
+			flaps := chanActivity.Bucket(chanFlapsKey)
+			if flaps == nil {
+				return nil
+			}
+
+			numFlaps := countFlaps(flaps, startKey, endKey)
+			if numFlaps < minFlaps {
+				return nil
+			}
+
+			var chanPoint wire.OutPoint
+			r := bytes.NewReader(chanKey)
+			if err := readOutpoint(r, &chanPoint); err != nil {
+				return err
+			}
+			channelFlaps = append(channelFlaps, ChannelFlap{
+				ChanPoint: chanPoint,
+				NumFlaps:  numFlaps,
+			})
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(channelFlaps, func(i, j int) bool {
+		a, b := channelFlaps[i], channelFlaps[j]
+		if a.NumFlaps != b.NumFlaps {
+			return a.NumFlaps > b.NumFlaps
+		}
+
+		if a.ChanPoint.Hash != b.ChanPoint.Hash {
+			return bytes.Compare(
+				a.ChanPoint.Hash[:], b.ChanPoint.Hash[:],
+			) < 0
+		}
+		return a.ChanPoint.Index < b.ChanPoint.Index
+	})
+
+	return channelFlaps, nil
+}
+
+// countFlaps returns the number of flaps within the bucket of a channel's
+// flaps whose time is within the inclusive range of the keys.
+func countFlaps(flaps *bbolt.Bucket, startKey, endKey [8]byte) int {
+	var numFlaps int
+	c := flaps.Cursor()
+	for k, _ := c.Seek(startKey[:]); k != nil &&
+		bytes.Compare(k[:8], endKey[:]) <= 0; k, _ = c.Next() {
+
+		numFlaps++
+	}
+
+	return numFlaps
+}
+
+// deleteChanActivityOnClose removes the activity recorded for a closed
+// channel.
+func deleteChanActivityOnClose(tx *bbolt.Tx, channel *OpenChannel) error {
+	activity := tx.Bucket(channelActivityBucket)
+	if activity == nil {
+		return nil
+	}
+
+	chanKey := canonicalChannelKey(channel.FundingOutpoint)
+	err := activity.DeleteBucket(chanKey)
+	if err != nil && err != bbolt.ErrBucketNotFound {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package channeldb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestFlappingChannels asserts that only changes of the activity of a channel
+// count as flaps, that channels are reported once they flapped often enough
+// within the window, and that the activity of closed channels is removed.
+func TestFlappingChannels(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	var channels [2]*OpenChannel
+	for i := range channels {
+		channels[i], err = createTestChannelState(db)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		channels[i].IsPending = false
+		if err := channels[i].FullSync(); err != nil {
+			t.Fatalf("unable to save channel state: %v", err)
+		}
+	}
+	unstable := channels[0].FundingOutpoint
+	stable := channels[1].FundingOutpoint
+
+	now := time.Unix(1500000000, 0)
+	record := func(chanPoint wire.OutPoint, active bool,
+		at time.Time) error {
+
+		return db.RecordChannelActivity(chanPoint, active, at)
+	}
+
+	// The unstable channel flaps four times, one of which is outside of
+	// the window queried below. Repeated states aren't flaps.
+	activity := []struct {
+		chanPoint wire.OutPoint
+		active    bool
+		offset    time.Duration
+	}{
+		{unstable, true, -2 * time.Hour},
+		{unstable, false, -2 * time.Hour},
+		{unstable, true, -30 * time.Minute},
+		{unstable, true, -20 * time.Minute},
+		{unstable, false, -10 * time.Minute},
+		{unstable, true, 0},
+		{stable, true, -2 * time.Hour},
+		{stable, false, -time.Minute},
+	}
+	for _, a := range activity {
+		err := record(a.chanPoint, a.active, now.Add(a.offset))
+		if err != nil {
+			t.Fatalf("unable to record activity: %v", err)
+		}
+	}
+
+	assertFlaps := func(window time.Duration, minFlaps int,
+		expected []ChannelFlap) {
+
+		t.Helper()
+
+		flaps, err := db.FlappingChannels(window, now, minFlaps)
+		if err != nil {
+			t.Fatalf("unable to fetch flapping channels: %v", err)
+		}
+		if !reflect.DeepEqual(flaps, expected) {
+			t.Fatalf("expected flaps %v, got %v", expected, flaps)
+		}
+	}
+
+	assertFlaps(time.Hour, 1, []ChannelFlap{
+		{ChanPoint: unstable, NumFlaps: 3},
+		{ChanPoint: stable, NumFlaps: 1},
+	})
+	assertFlaps(time.Hour, 2, []ChannelFlap{
+		{ChanPoint: unstable, NumFlaps: 3},
+	})
+	assertFlaps(3*time.Hour, 4, []ChannelFlap{
+		{ChanPoint: unstable, NumFlaps: 4},
+	})
+	assertFlaps(time.Hour, 5, nil)
+
+	_, err = db.FlappingChannels(MaxFlapWindow+1, now, 1)
+	if err != ErrInvalidFlapWindow {
+		t.Fatalf("expected ErrInvalidFlapWindow, got %v", err)
+	}
+	_, err = db.FlappingChannels(time.Hour, now, 0)
+	if err != ErrInvalidFlapCount {
+		t.Fatalf("expected ErrInvalidFlapCount, got %v", err)
+	}
+
+	// Once closed, the activity of a channel is removed, and no longer
+	// recorded.
+	err = channels[0].CloseChannel(&ChannelCloseSummary{
+		ChanPoint:   unstable,
+		ShortChanID: channels[0].ShortChannelID,
+		RemotePub:   channels[0].IdentityPub,
+		CloseType:   CooperativeClose,
+	})
+	if err != nil {
+		t.Fatalf("unable to close channel: %v", err)
+	}
+	assertFlaps(time.Hour, 1, []ChannelFlap{
+		{ChanPoint: stable, NumFlaps: 1},
+	})
+	err = record(unstable, false, now)
+	if err != ErrChannelNotFound {
+		t.Fatalf("expected ErrChannelNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package channeldb
+
+import (
+	"sort"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+var (
+	// forwardingChanIndexBucket is the top-level bucket that indexes the
+	// forwarding log by channel. For each channel that ever forwarded an
+	// HTLC, it stores the time of the most recent forwarding event that
+	// went through the channel in either direction.
+	//
+	// maps: chanID => lastForwardTime
+	forwardingChanIndexBucket = []byte("fwd-chan-index")
+
+	// chanOpenTimeKey can be accessed within the bucket for a channel, and
+	// stores the time the channel was first written to the database.
+	chanOpenTimeKey = []byte("chan-open-time-key")
+)
+
+// ChannelIdle describes how long an open channel hasn't forwarded any HTLCs.
+type ChannelIdle struct {
+	// ChanPoint is the funding outpoint of the channel.
+	ChanPoint wire.OutPoint
+
+	// ShortChanID is the short channel ID of the channel.
+	ShortChanID lnwire.ShortChannelID
+
+	// LastForward is the time of the most recent forwarding event that
+	// went through the channel. It's zero if the channel never forwarded.
+	LastForward time.Time
+
+	// OpenTime is the time the channel was first written to the database.
+	OpenTime time.Time
+
+	// Idle is the time since the channel last forwarded, or since it was
+	// opened if it never forwarded.
+	Idle time.Duration
+}
+
+// ChannelIdleTimes returns, for each open channel that isn't pending, the time
+// that passed until now since it last forwarded an HTLC in either direction.
+// Channels that never forwarded are idle since they were opened. The result
+// is sorted by idle time, starting with the channel that's idle the longest.
+func (d *DB) ChannelIdleTimes(now time.Time) ([]ChannelIdle, error) {
+	var idleTimes []ChannelIdle
+	err := d.View(func(tx *bbolt.Tx) error {
+		idleTimes = nil
+
+		openChanBucket := tx.Bucket(openChannelBucket)
+		if openChanBucket == nil {
+			return nil
+		}
+		fwdIndex := tx.Bucket(forwardingChanIndexBucket)
+
+		return forEachChanBucket(openChanBucket, func(op wire.OutPoint,
+			chanBucket *bbolt.Bucket) error {
+
+			channel := &OpenChannel{
+				FundingOutpoint: op,
+			}
+			err := fetchChanInfo(chanBucket, channel)
+			if err != nil {
+				return err
+			}
+			if channel.IsPending {
+				return nil
+			}
+
+			idle := ChannelIdle{
+				ChanPoint:   op,
+				ShortChanID: channel.ShortChannelID,
+				OpenTime:    fetchChanOpenTime(chanBucket),
+			}
+			if fwdIndex != nil {
+				chanID := channel.ShortChannelID.ToUint64()
+				idle.LastForward = fetchLastForward(
+					fwdIndex, chanID,
+				)
+			}
+
+			since := idle.LastForward
+			if since.IsZero() {
+				since = idle.OpenTime
+			}
+			if !since.IsZero() && now.After(since) {
+				idle.Idle = now.Sub(since)
+			}
+
+			idleTimes = append(idleTimes, idle)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(idleTimes, func(i, j int) bool {
+		return idleTimes[i].Idle > idleTimes[j].Idle
+	})
+
+	return idleTimes, nil
+}
+
+// putForwardingChanIndex records the forwarding events as the most recent
+// forward of both their incoming and outgoing channel, unless a more recent
+// forward is already indexed for the channel.
+func putForwardingChanIndex(tx *bbolt.Tx, events []ForwardingEvent) error {
+	fwdIndex, err := tx.CreateBucketIfNotExists(forwardingChanIndexBucket)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		chanIDs := []lnwire.ShortChannelID{
+			event.IncomingChanID, event.OutgoingChanID,
+		}
+		for _, chanID := range chanIDs {
+			err := putLastForward(
+				fwdIndex, chanID.ToUint64(), event.Timestamp,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// putLastForward stores the passed time as the most recent forward of the
+// channel, if it's more recent than the one already stored.
+func putLastForward(fwdIndex *bbolt.Bucket, chanID uint64,
+	t time.Time) error {
+
+	if !t.After(fetchLastForward(fwdIndex, chanID)) {
+		return nil
+	}
+
+	var k, v [8]byte
+	byteOrder.PutUint64(k[:], chanID)
+	byteOrder.PutUint64(v[:], uint64(t.UnixNano()))
+
+	return fwdIndex.Put(k[:], v[:])
+}
+
+// fetchLastForward returns the time of the most recent forward of the
+// channel, or the zero time if it never forwarded.
+func fetchLastForward(fwdIndex *bbolt.Bucket, chanID uint64) time.Time {
+	var k [8]byte
+	byteOrder.PutUint64(k[:], chanID)
+
+	v := fwdIndex.Get(k[:])
+	if len(v) != 8 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, int64(byteOrder.Uint64(v)))
+}
+
+// putChanOpenTimeOnOpen records the current time as the open time of a new
+// channel, unless one is already recorded within its bucket.
+func putChanOpenTimeOnOpen(_ *bbolt.Tx, chanBucket *bbolt.Bucket,
+	_ *OpenChannel) error {
+
+	if chanBucket.Get(chanOpenTimeKey) != nil {
+		return nil
+	}
+
+	return putChanOpenTime(chanBucket, time.Now())
+}
+
+// putChanOpenTime stores the open time of a channel within its bucket.
+func putChanOpenTime(chanBucket *bbolt.Bucket, t time.Time) error {
+	var v [8]byte
+	byteOrder.PutUint64(v[:], uint64(t.UnixNano()))
+
+	return chanBucket.Put(chanOpenTimeKey, v[:])
+}
+
+// fetchChanOpenTime returns the open time stored within the bucket of a
+// channel, or the zero time if none is stored.
+func fetchChanOpenTime(chanBucket *bbolt.Bucket) time.Time {
+	v := chanBucket.Get(chanOpenTimeKey)
+	if len(v) != 8 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, int64(byteOrder.Uint64(v)))
+}
@@ -0,0 +1,119 @@
+package channeldb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestChannelIdleTimes asserts that channels are idle since their most recent
+// forward in either direction, or since they were opened if they never
+// forwarded, and that the most idle channel is returned first.
+func TestChannelIdleTimes(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	openTime := time.Unix(1000, 0)
+	var channels [3]*OpenChannel
+	for i := range channels {
+		channels[i], err = createTestChannelState(db)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		channels[i].IsPending = false
+		channels[i].ShortChannelID = lnwire.NewShortChanIDFromInt(
+			uint64(100 + i),
+		)
+		if err := channels[i].FullSync(); err != nil {
+			t.Fatalf("unable to save channel state: %v", err)
+		}
+
+		// We'll overwrite the open time recorded for the channel,
+		// such that it doesn't depend on the time the test runs.
+		err = db.Update(func(tx *bbolt.Tx) error {
+			chanBucket, err := fetchChanBucket(
+				tx, channels[i].IdentityPub,
+				&channels[i].FundingOutpoint,
+				channels[i].ChainHash,
+			)
+			if err != nil {
+				return err
+			}
+
+			return putChanOpenTime(chanBucket, openTime)
+		})
+		if err != nil {
+			t.Fatalf("unable to set open time: %v", err)
+		}
+	}
+
+	// The first channel forwarded in the incoming direction, and the
+	// second in the outgoing one more recently, while the third never
+	// forwarded at all.
+	events := []ForwardingEvent{
+		{
+			Timestamp:      openTime.Add(2 * time.Hour),
+			IncomingChanID: channels[0].ShortChannelID,
+			OutgoingChanID: channels[1].ShortChannelID,
+		},
+		{
+			Timestamp:      openTime.Add(3 * time.Hour),
+			IncomingChanID: lnwire.NewShortChanIDFromInt(1),
+			OutgoingChanID: channels[1].ShortChannelID,
+		},
+		{
+			Timestamp:      openTime.Add(time.Hour),
+			IncomingChanID: channels[0].ShortChannelID,
+			OutgoingChanID: lnwire.NewShortChanIDFromInt(1),
+		},
+	}
+	if err := db.ForwardingLog().AddForwardingEvents(events); err != nil {
+		t.Fatalf("unable to add events: %v", err)
+	}
+
+	now := openTime.Add(4 * time.Hour)
+	idleTimes, err := db.ChannelIdleTimes(now)
+	if err != nil {
+		t.Fatalf("unable to fetch idle times: %v", err)
+	}
+
+	expected := []struct {
+		channel     *OpenChannel
+		lastForward time.Time
+		idle        time.Duration
+	}{
+		{channels[2], time.Time{}, 4 * time.Hour},
+		{channels[0], openTime.Add(2 * time.Hour), 2 * time.Hour},
+		{channels[1], openTime.Add(3 * time.Hour), time.Hour},
+	}
+	if len(idleTimes) != len(expected) {
+		t.Fatalf("expected %v idle times, got %v", len(expected),
+			len(idleTimes))
+	}
+	for i, exp := range expected {
+		idle := idleTimes[i]
+		if idle.ChanPoint != exp.channel.FundingOutpoint {
+			t.Fatalf("idle time %v: expected channel %v, got %v",
+				i, exp.channel.FundingOutpoint, idle.ChanPoint)
+		}
+		if !idle.LastForward.Equal(exp.lastForward) {
+			t.Fatalf("idle time %v: expected last forward %v, "+
+				"got %v", i, exp.lastForward, idle.LastForward)
+		}
+		if !idle.OpenTime.Equal(openTime) {
+			t.Fatalf("idle time %v: expected open time %v, got %v",
+				i, openTime, idle.OpenTime)
+		}
+		if idle.Idle != exp.idle {
+			t.Fatalf("idle time %v: expected idle %v, got %v", i,
+				exp.idle, idle.Idle)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package channeldb
+
+import (
+	"bytes"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+)
+
+// canonicalChannelKey returns the key a channel point is stored under within
+// every bucket keyed by channel point: the txid in its internal byte order,
+// followed by the big endian output index. Note that the internal byte order
+// is the reverse of the order the txid is displayed in.
+func canonicalChannelKey(op wire.OutPoint) []byte {
+	key := make([]byte, outPointSize)
+	copy(key[:chainhash.HashSize], op.Hash[:])
+	byteOrder.PutUint32(key[chainhash.HashSize:], op.Index)
+
+	return key
+}
+
+// displayChannelKey returns the key a channel point would be stored under if
+// its txid was mistakenly written in display byte order. It's only used to
+// recognize such keys, such that they can be re-keyed canonically.
+func displayChannelKey(op wire.OutPoint) []byte {
+	key := canonicalChannelKey(op)
+	for i, j := 0, chainhash.HashSize-1; i < j; i, j = i+1, j-1 {
+		key[i], key[j] = key[j], key[i]
+	}
+
+	return key
+}
+
+// isDisplayChannelKey returns true if the key is the display ordered key of
+// the passed channel point, rather than its canonical key. A txid that reads
+// the same in both byte orders is always considered canonical.
+func isDisplayChannelKey(key []byte, op wire.OutPoint) bool {
+	return !bytes.Equal(key, canonicalChannelKey(op)) &&
+		bytes.Equal(key, displayChannelKey(op))
+}
+
+// copyBucket recursively copies all keys and nested buckets of src into dst.
+func copyBucket(dst, src *bbolt.Bucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+
+		child, err := dst.CreateBucketIfNotExists(k)
+		if err != nil {
+			return err
+		}
+
+		return copyBucket(child, src.Bucket(k))
+	})
+}
+
+// rekeyOpenChannels moves the bucket of each open channel that's keyed by the
+// display ordered key of its funding outpoint to its canonical key. The
+// funding outpoint stored within the channel's info is taken as the truth, and
+// the channel's entry within the UUID index is updated along with it. The
+// number of re-keyed channels is returned.
+func rekeyOpenChannels(tx *bbolt.Tx) (int, error) {
+	openChanBucket := tx.Bucket(openChannelBucket)
+	if openChanBucket == nil {
+		return 0, nil
+	}
+
+	type misKeyedChannel struct {
+		nodePub   []byte
+		chainHash []byte
+		key       []byte
+		op        wire.OutPoint
+	}
+	var misKeyed []misKeyedChannel
+	err := openChanBucket.ForEach(func(nodePub, v []byte) error {
+		if v != nil {
+			return nil
+		}
+
+		nodeChanBucket := openChanBucket.Bucket(nodePub)
+		return nodeChanBucket.ForEach(func(chainHash, v []byte) error {
+			if v != nil {
+				return nil
+			}
+
+			// The keys are copied, as they're only valid until the
+			// buckets are modified.
+			nodeKey := append([]byte(nil), nodePub...)
+			chainKey := append([]byte(nil), chainHash...)
+
+			chainBucket := nodeChanBucket.Bucket(chainHash)
+			return chainBucket.ForEach(func(k, v []byte) error {
+				if v != nil {
+					return nil
+				}
+
+				var channel OpenChannel
+				chanBucket := chainBucket.Bucket(k)
+				err := fetchChanInfo(chanBucket, &channel)
+				if err != nil {
+					return err
+				}
+
+				op := channel.FundingOutpoint
+				if !isDisplayChannelKey(k, op) {
+					return nil
+				}
+
+				misKeyed = append(misKeyed, misKeyedChannel{
+					nodePub:   nodeKey,
+					chainHash: chainKey,
+					key:       append([]byte(nil), k...),
+					op:        op,
+				})
+
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, channel := range misKeyed {
+		chainBucket := openChanBucket.Bucket(channel.nodePub).Bucket(
+			channel.chainHash,
+		)
+
+		newKey := canonicalChannelKey(channel.op)
+		chanBucket, err := chainBucket.CreateBucket(newKey)
+		if err != nil {
+			return 0, err
+		}
+		err = copyBucket(chanBucket, chainBucket.Bucket(channel.key))
+		if err != nil {
+			return 0, err
+		}
+		if err := chainBucket.DeleteBucket(channel.key); err != nil {
+			return 0, err
+		}
+
+		// The UUID index locates the channel by its key, so it must
+		// point to the new one.
+		if value := chanBucket.Get(chanUUIDKey); len(value) == 16 {
+			var id [16]byte
+			copy(id[:], value)
+
+			err := putChanUUID(
+				tx, chanBucket, id, channel.nodePub,
+				channel.chainHash, newKey,
+			)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return len(misKeyed), nil
+}
+
+// rekeyClosedChannels moves the summary of each closed channel that's keyed by
+// the display ordered key of its channel point to its canonical key, along
+// with the abandonment details of the channel if any exist. The number of
+// re-keyed summaries is returned.
+func rekeyClosedChannels(tx *bbolt.Tx) (int, error) {
+	closedChanBucket := tx.Bucket(closedChannelBucket)
+	if closedChanBucket == nil {
+		return 0, nil
+	}
+
+	type misKeyedSummary struct {
+		key     []byte
+		newKey  []byte
+		summary []byte
+	}
+	var misKeyed []misKeyedSummary
+	err := closedChanBucket.ForEach(func(k, v []byte) error {
+		summary, err := deserializeCloseChannelSummary(
+			bytes.NewReader(v),
+		)
+		if err != nil {
+			return err
+		}
+		if !isDisplayChannelKey(k, summary.ChanPoint) {
+			return nil
+		}
+
+		misKeyed = append(misKeyed, misKeyedSummary{
+			key:     append([]byte(nil), k...),
+			newKey:  canonicalChannelKey(summary.ChanPoint),
+			summary: append([]byte(nil), v...),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	abandonedBucket := tx.Bucket(abandonedChannelBucket)
+	for _, entry := range misKeyed {
+		err := closedChanBucket.Put(entry.newKey, entry.summary)
+		if err != nil {
+			return 0, err
+		}
+		if err := closedChanBucket.Delete(entry.key); err != nil {
+			return 0, err
+		}
+
+		if abandonedBucket == nil {
+			continue
+		}
+		info := abandonedBucket.Get(entry.key)
+		if info == nil {
+			continue
+		}
+		info = append([]byte(nil), info...)
+		if err := abandonedBucket.Put(entry.newKey, info); err != nil {
+			return 0, err
+		}
+		if err := abandonedBucket.Delete(entry.key); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(misKeyed), nil
+}
+
+// rekeyChannelPointIndex moves each entry of the graph's channel point index
+// that's keyed by the display ordered key of its edge's channel point to its
+// canonical key. The number of re-keyed entries is returned.
+func rekeyChannelPointIndex(tx *bbolt.Tx) (int, error) {
+	edges := tx.Bucket(edgeBucket)
+	if edges == nil {
+		return 0, nil
+	}
+	edgeIndex := edges.Bucket(edgeIndexBucket)
+	chanIndex := edges.Bucket(channelPointBucket)
+	if edgeIndex == nil || chanIndex == nil {
+		return 0, nil
+	}
+
+	type misKeyedEdge struct {
+		key    []byte
+		newKey []byte
+		chanID []byte
+	}
+	var misKeyed []misKeyedEdge
+	err := chanIndex.ForEach(func(k, chanID []byte) error {
+		edgeInfo, err := fetchChanEdgeInfo(edgeIndex, chanID)
+		if err == ErrEdgeNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !isDisplayChannelKey(k, edgeInfo.ChannelPoint) {
+			return nil
+		}
+
+		misKeyed = append(misKeyed, misKeyedEdge{
+			key:    append([]byte(nil), k...),
+			newKey: canonicalChannelKey(edgeInfo.ChannelPoint),
+			chanID: append([]byte(nil), chanID...),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range misKeyed {
+		err := chanIndex.Put(entry.newKey, entry.chanID)
+		if err != nil {
+			return 0, err
+		}
+		if err := chanIndex.Delete(entry.key); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(misKeyed), nil
+}
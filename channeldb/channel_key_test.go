@@ -0,0 +1,58 @@
+package channeldb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestCanonicalChannelKey asserts that the canonical key of a channel point
+// holds its txid in internal byte order, and that keys holding the txid in
+// display byte order are recognized as such.
+func TestCanonicalChannelKey(t *testing.T) {
+	t.Parallel()
+
+	op := wire.OutPoint{Hash: rev, Index: 7}
+
+	var b bytes.Buffer
+	if err := writeOutpoint(&b, &op); err != nil {
+		t.Fatalf("unable to write outpoint: %v", err)
+	}
+	canonical := canonicalChannelKey(op)
+	if !bytes.Equal(canonical, b.Bytes()) {
+		t.Fatalf("expected canonical key %x, got %x", b.Bytes(),
+			canonical)
+	}
+
+	// The display ordered key should hold the txid as it's displayed,
+	// followed by the same output index.
+	displayHash, err := hex.DecodeString(op.Hash.String())
+	if err != nil {
+		t.Fatalf("unable to decode txid: %v", err)
+	}
+	display := displayChannelKey(op)
+	hashLen := len(displayHash)
+	if !bytes.Equal(display[:hashLen], displayHash) {
+		t.Fatalf("expected display ordered txid %x, got %x",
+			displayHash, display[:hashLen])
+	}
+	if !bytes.Equal(display[hashLen:], canonical[hashLen:]) {
+		t.Fatalf("expected output index to be retained")
+	}
+
+	if isDisplayChannelKey(canonical, op) {
+		t.Fatalf("canonical key recognized as display ordered")
+	}
+	if !isDisplayChannelKey(display, op) {
+		t.Fatalf("display ordered key not recognized")
+	}
+
+	// A txid that reads the same in both byte orders can't be told apart,
+	// and is always considered canonical.
+	var zeroOp wire.OutPoint
+	if isDisplayChannelKey(canonicalChannelKey(zeroOp), zeroOp) {
+		t.Fatalf("symmetric txid recognized as display ordered")
+	}
+}
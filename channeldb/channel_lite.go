@@ -0,0 +1,101 @@
+package channeldb
+
+import (
+	"bytes"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// ChannelLite holds the identity fields of an open channel, which are fixed
+// once the channel has confirmed. It's decoded without the channel's configs,
+// commitments and HTLCs, for callers that only need to know which channels
+// exist.
+type ChannelLite struct {
+	// ChannelPoint is the funding outpoint of the channel.
+	ChannelPoint wire.OutPoint
+
+	// ChainHash is the genesis hash of the chain the channel was opened
+	// on.
+	ChainHash chainhash.Hash
+
+	// Capacity is the total capacity of the channel.
+	Capacity btcutil.Amount
+
+	// IdentityPub is the identity public key of the channel's peer.
+	IdentityPub *btcec.PublicKey
+
+	// ShortChannelID is the short channel ID of the channel. It's only
+	// final once the channel is no longer pending.
+	ShortChannelID lnwire.ShortChannelID
+
+	// CommitmentType is the type of the channel's commitments.
+	CommitmentType CommitmentType
+}
+
+// FetchChannelLite returns the identity fields of the open channel with the
+// given channel point. Only the prefix of the channel's static info preceding
+// its configs is decoded, along with its commitment type, which is stored
+// separately. If no such channel exists, ErrChannelNotFound is returned.
+func (d *DB) FetchChannelLite(op wire.OutPoint) (*ChannelLite, error) {
+	var channel *ChannelLite
+	err := d.View(func(tx *bbolt.Tx) error {
+		_, _, chanBucket, err := findChanBucket(tx, &op)
+		if err == ErrNoActiveChannels {
+			return ErrChannelNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		channel, err = fetchChanLite(chanBucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return channel, nil
+}
+
+// fetchChanLite decodes the identity fields of the channel stored within the
+// passed bucket. The fields are read from the prefix of the channel's static
+// info, as written by putChanInfo, and the fields in between are skipped
+// without being retained.
+func fetchChanLite(chanBucket *bbolt.Bucket) (*ChannelLite, error) {
+	infoBytes := chanBucket.Get(chanInfoKey)
+	if infoBytes == nil {
+		return nil, ErrNoChanInfoFound
+	}
+
+	var (
+		channel ChannelLite
+
+		chanType               ChannelType
+		isPending, isInitiator bool
+		chanStatus             ChannelStatus
+		broadcastHeight        uint32
+		numConfsRequired       uint16
+		chanFlags              lnwire.FundingFlag
+	)
+	err := ReadElements(bytes.NewReader(infoBytes),
+		&chanType, &channel.ChainHash, &channel.ChannelPoint,
+		&channel.ShortChannelID, &isPending, &isInitiator, &chanStatus,
+		&broadcastHeight, &numConfsRequired, &chanFlags,
+		&channel.IdentityPub, &channel.Capacity,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	channel.CommitmentType, err = fetchChanCommitType(chanBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return &channel, nil
+}
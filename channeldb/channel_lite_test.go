@@ -0,0 +1,70 @@
+package channeldb
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestFetchChannelLite asserts that the identity fields decoded from the
+// prefix of a channel's static info match those of the full channel.
+func TestFetchChannelLite(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	_, err = cdb.FetchChannelLite(wire.OutPoint{})
+	if err != ErrChannelNotFound {
+		t.Fatalf("expected ErrChannelNotFound, got %v", err)
+	}
+
+	state, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	if err := state.FullSync(); err != nil {
+		t.Fatalf("unable to save channel state: %v", err)
+	}
+
+	channel, err := cdb.FetchChannelLite(state.FundingOutpoint)
+	if err != nil {
+		t.Fatalf("unable to fetch channel: %v", err)
+	}
+
+	if channel.ChannelPoint != state.FundingOutpoint {
+		t.Fatalf("expected channel point %v, got %v",
+			state.FundingOutpoint, channel.ChannelPoint)
+	}
+	if channel.ChainHash != state.ChainHash {
+		t.Fatalf("expected chain hash %v, got %v", state.ChainHash,
+			channel.ChainHash)
+	}
+	if channel.Capacity != state.Capacity {
+		t.Fatalf("expected capacity %v, got %v", state.Capacity,
+			channel.Capacity)
+	}
+	if !channel.IdentityPub.IsEqual(state.IdentityPub) {
+		t.Fatalf("expected peer %x, got %x",
+			state.IdentityPub.SerializeCompressed(),
+			channel.IdentityPub.SerializeCompressed())
+	}
+	if channel.ShortChannelID != state.ShortChannelID {
+		t.Fatalf("expected short channel id %v, got %v",
+			state.ShortChannelID, channel.ShortChannelID)
+	}
+	if channel.CommitmentType != state.CommitmentType {
+		t.Fatalf("expected commitment type %v, got %v",
+			state.CommitmentType, channel.CommitmentType)
+	}
+
+	// A channel at another channel point should still not be found.
+	op := state.FundingOutpoint
+	op.Index++
+	if _, err := cdb.FetchChannelLite(op); err != ErrChannelNotFound {
+		t.Fatalf("expected ErrChannelNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package channeldb
+
+import (
+	"github.com/coreos/bbolt"
+)
+
+// channelOpenCallback adds a new channel to an index or other bucket kept
+// outside of the channel's own bucket. It's passed the channel along with its
+// bucket, which has already been populated, and is executed within the
+// transaction that writes the channel.
+type channelOpenCallback func(tx *bbolt.Tx, chanBucket *bbolt.Bucket,
+	channel *OpenChannel) error
+
+// channelOpenCallbacks are executed by onChannelOpen in order. Any index that
+// references open channels should be populated here, mirroring the cleanup
+// registered within channelCloseCallbacks.
+var channelOpenCallbacks = []channelOpenCallback{
+	putChanUUIDOnOpen,
+	putChanOpenTimeOnOpen,
+}
+
+// onChannelOpen executes all channel open callbacks for a channel that was
+// just written to the passed bucket.
+func onChannelOpen(tx *bbolt.Tx, chanBucket *bbolt.Bucket,
+	channel *OpenChannel) error {
+
+	for _, callback := range channelOpenCallbacks {
+		if err := callback(tx, chanBucket, channel); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddChannel writes a new channel to the database within a single
+// transaction, along with all indexes that reference it and a link node for
+// its peer if none exists yet. Before anything is written, the channel point
+// is checked against all open channels, across all peers and chains, and
+// ErrChanAlreadyExists is returned if it's already in use. If any write
+// fails, the database is left untouched.
+func (d *DB) AddChannel(channel *OpenChannel) error {
+	channel.Lock()
+	defer channel.Unlock()
+
+	channel.Db = d
+
+	return d.Update(func(tx *bbolt.Tx) error {
+		_, _, _, err := findChanBucket(tx, &channel.FundingOutpoint)
+		switch {
+		case err == nil:
+			return ErrChanAlreadyExists
+		case err != ErrChannelNotFound && err != ErrNoActiveChannels:
+			return err
+		}
+
+		return syncNewChannel(tx, channel, nil)
+	})
+}
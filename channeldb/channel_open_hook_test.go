@@ -0,0 +1,89 @@
+package channeldb
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/coreos/bbolt"
+)
+
+// TestAddChannel asserts that a channel added through AddChannel is written
+// along with the indexes referencing it, and that a channel reusing an
+// existing channel point is rejected without writing anything.
+func TestAddChannel(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	if err := cdb.AddChannel(channel); err != nil {
+		t.Fatalf("unable to add channel: %v", err)
+	}
+
+	if _, err := cdb.FetchChannel(channel.FundingOutpoint); err != nil {
+		t.Fatalf("unable to fetch channel: %v", err)
+	}
+	if channel.UUID == ([16]byte{}) {
+		t.Fatalf("channel wasn't assigned a uuid")
+	}
+	byUUID, err := cdb.ChannelByUUID(channel.UUID)
+	if err != nil {
+		t.Fatalf("unable to fetch channel by uuid: %v", err)
+	}
+	if byUUID.FundingOutpoint != channel.FundingOutpoint {
+		t.Fatalf("expected channel %v by uuid, got %v",
+			channel.FundingOutpoint, byUUID.FundingOutpoint)
+	}
+	if _, err := cdb.FetchLinkNode(channel.IdentityPub); err != nil {
+		t.Fatalf("unable to fetch link node: %v", err)
+	}
+
+	// A channel with another peer reusing the same channel point should be
+	// rejected.
+	priv, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	dupChannel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	dupChannel.FundingOutpoint = channel.FundingOutpoint
+	dupChannel.IdentityPub = priv.PubKey()
+
+	err = cdb.AddChannel(dupChannel)
+	if err != ErrChanAlreadyExists {
+		t.Fatalf("expected ErrChanAlreadyExists, got %v", err)
+	}
+
+	peerChannels, err := cdb.FetchOpenChannels(dupChannel.IdentityPub)
+	if err != nil {
+		t.Fatalf("unable to fetch open channels: %v", err)
+	}
+	if len(peerChannels) != 0 {
+		t.Fatalf("expected no channels with peer, got %v",
+			len(peerChannels))
+	}
+	_, err = cdb.FetchLinkNode(dupChannel.IdentityPub)
+	if err != ErrNodeNotFound {
+		t.Fatalf("expected ErrNodeNotFound, got %v", err)
+	}
+
+	err = cdb.View(func(tx *bbolt.Tx) error {
+		numIndexed := tx.Bucket(channelUUIDIndexBucket).Stats().KeyN
+		if numIndexed != 1 {
+			t.Fatalf("expected 1 indexed uuid, got %v", numIndexed)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to read database: %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// channelScoreBucket is the top-level bucket that stores the outcome
+	// of past payment attempts through each direction of a channel. The
+	// counters are decayed over time, such that the resulting success
+	// probability is dominated by recent attempts.
+	//
+	// maps: chanID || direction => channelScore
+	channelScoreBucket = []byte("channel-score")
+
+	// ErrInvalidChannelDirection is returned when a channel direction
+	// other than 0 or 1 is passed.
+	ErrInvalidChannelDirection = fmt.Errorf("channel direction must be " +
+		"either 0 or 1")
+)
+
+const (
+	// channelScoreHalfLife is the amount of time after which the weight
+	// of a recorded attempt has decayed to half of its initial weight.
+	channelScoreHalfLife = 24 * time.Hour
+
+	// channelScorePrior is the success probability assumed for a channel
+	// direction without any recorded attempts. As recorded attempts decay,
+	// the estimate returns to this value.
+	channelScorePrior = 0.6
+
+	// channelScorePriorWeight is the number of attempts the prior is worth
+	// when combined with the decayed counters. This prevents a single
+	// attempt from pushing the estimate to either extreme.
+	channelScorePriorWeight = 2.0
+)
+
+// channelScore holds the decayed attempt counters of a single channel
+// direction.
+type channelScore struct {
+	// attempts is the decayed number of attempts, as of lastUpdate.
+	attempts float64
+
+	// successes is the decayed number of successful attempts, as of
+	// lastUpdate.
+	successes float64
+
+	// numSamples is the total number of attempts ever recorded.
+	numSamples uint64
+
+	// lastUpdate is the time the counters were last decayed.
+	lastUpdate time.Time
+}
+
+// decay applies the decay of the counters between their last update and now.
+func (s *channelScore) decay(now time.Time) {
+	elapsed := now.Sub(s.lastUpdate)
+	if elapsed <= 0 {
+		return
+	}
+
+	factor := math.Exp2(-float64(elapsed) / float64(channelScoreHalfLife))
+	s.attempts *= factor
+	s.successes *= factor
+	s.lastUpdate = now
+}
+
+// probability returns the estimated success probability, combining the
+// counters with the prior.
+func (s *channelScore) probability() float64 {
+	return (s.successes + channelScorePrior*channelScorePriorWeight) /
+		(s.attempts + channelScorePriorWeight)
+}
+
+// RecordAttempt records the outcome of a payment attempt through the given
+// direction of a channel. The direction is 0 if the attempt was forwarded by
+// the node with the lexicographically smaller public key, and 1 otherwise,
+// matching the direction bit of a channel update. Attempts are deferred to the
+// dead letter queue when they can't be written and the queue is enabled.
+func (d *DB) RecordAttempt(chanID uint64, dir uint8, success bool) error {
+	return d.recordAttempt(chanID, dir, success, time.Now())
+}
+
+// recordAttempt records the outcome of an attempt made at the passed time.
+func (d *DB) recordAttempt(chanID uint64, dir uint8, success bool,
+	now time.Time) error {
+
+	if dir > 1 {
+		return ErrInvalidChannelDirection
+	}
+
+	err := d.Batch(func(tx *bbolt.Tx) error {
+		return putAttempt(tx, chanID, dir, success, now)
+	})
+
+	return d.deferWrite(err, &attemptLetter{
+		chanID:  chanID,
+		dir:     dir,
+		success: success,
+		t:       now,
+	})
+}
+
+// putAttempt records the outcome of an attempt within the passed transaction.
+func putAttempt(tx *bbolt.Tx, chanID uint64, dir uint8, success bool,
+	now time.Time) error {
+
+	scores, err := tx.CreateBucketIfNotExists(channelScoreBucket)
+	if err != nil {
+		return err
+	}
+
+	scoreKey := channelScoreKey(chanID, dir)
+	score, err := fetchChannelScore(scores, scoreKey)
+	if err != nil {
+		return err
+	}
+
+	score.decay(now)
+	score.attempts++
+	if success {
+		score.successes++
+	}
+	score.numSamples++
+
+	var b bytes.Buffer
+	if err := serializeChannelScore(&b, score); err != nil {
+		return err
+	}
+
+	return scores.Put(scoreKey, b.Bytes())
+}
+
+// ChannelSuccessProbability returns the estimated probability that a payment
+// attempt through the given direction of a channel succeeds, along with the
+// total number of attempts recorded for it. Attempts lose half of their
+// weight every channelScoreHalfLife, so the estimate gradually returns to the
+// prior for channel directions that aren't used any longer.
+func (d *DB) ChannelSuccessProbability(chanID uint64,
+	dir uint8) (float64, uint64, error) {
+
+	return d.channelSuccessProbability(chanID, dir, time.Now())
+}
+
+// channelSuccessProbability returns the success probability estimated at the
+// passed time.
+func (d *DB) channelSuccessProbability(chanID uint64, dir uint8,
+	now time.Time) (float64, uint64, error) {
+
+	if dir > 1 {
+		return 0, 0, ErrInvalidChannelDirection
+	}
+
+	var score *channelScore
+	err := d.View(func(tx *bbolt.Tx) error {
+		scores := tx.Bucket(channelScoreBucket)
+		if scores == nil {
+			score = &channelScore{lastUpdate: now}
+			return nil
+		}
+
+		var err error
+		score, err = fetchChannelScore(
+			scores, channelScoreKey(chanID, dir),
+		)
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	score.decay(now)
+
+	return score.probability(), score.numSamples, nil
+}
+
+// channelScoreKey returns the key under which the score of the given channel
+// direction is stored.
+func channelScoreKey(chanID uint64, dir uint8) []byte {
+	var k [9]byte
+	byteOrder.PutUint64(k[:8], chanID)
+	k[8] = dir
+	return k[:]
+}
+
+// fetchChannelScore retrieves the score stored under the passed key. If no
+// attempts have been recorded yet, an empty score is returned.
+func fetchChannelScore(scores *bbolt.Bucket,
+	scoreKey []byte) (*channelScore, error) {
+
+	scoreBytes := scores.Get(scoreKey)
+	if scoreBytes == nil {
+		return &channelScore{}, nil
+	}
+
+	return deserializeChannelScore(bytes.NewReader(scoreBytes))
+}
+
+func serializeChannelScore(w io.Writer, s *channelScore) error {
+	var lastUpdate uint64
+	if !s.lastUpdate.IsZero() {
+		lastUpdate = uint64(s.lastUpdate.UnixNano())
+	}
+
+	return WriteElements(w,
+		math.Float64bits(s.attempts), math.Float64bits(s.successes),
+		s.numSamples, lastUpdate,
+	)
+}
+
+func deserializeChannelScore(r io.Reader) (*channelScore, error) {
+	var attempts, successes, numSamples, lastUpdate uint64
+	err := ReadElements(r, &attempts, &successes, &numSamples, &lastUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &channelScore{
+		attempts:   math.Float64frombits(attempts),
+		successes:  math.Float64frombits(successes),
+		numSamples: numSamples,
+	}
+	if lastUpdate != 0 {
+		s.lastUpdate = time.Unix(0, int64(lastUpdate))
+	}
+
+	return s, nil
+}
@@ -0,0 +1,89 @@
+package channeldb
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestChannelSuccessProbability asserts that recorded attempts are reflected
+// by the success probability of a channel direction, and that their weight
+// decays over time.
+func TestChannelSuccessProbability(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+
+	const chanID = 1234
+	now := time.Unix(1500000000, 0)
+
+	assertProbability := func(dir uint8, at time.Time, expected float64,
+		expectedSamples uint64) {
+
+		t.Helper()
+
+		prob, numSamples, err := db.channelSuccessProbability(
+			chanID, dir, at,
+		)
+		if err != nil {
+			t.Fatalf("unable to fetch probability: %v", err)
+		}
+		if math.Abs(prob-expected) > 1e-9 {
+			t.Fatalf("expected probability %v, got %v", expected,
+				prob)
+		}
+		if numSamples != expectedSamples {
+			t.Fatalf("expected %v samples, got %v",
+				expectedSamples, numSamples)
+		}
+	}
+
+	// Without any attempts, the prior should be returned.
+	assertProbability(0, now, channelScorePrior, 0)
+
+	// We'll record three failures and a single success in the first
+	// direction.
+	for i := 0; i < 3; i++ {
+		if err := db.recordAttempt(chanID, 0, false, now); err != nil {
+			t.Fatalf("unable to record attempt: %v", err)
+		}
+	}
+	if err := db.recordAttempt(chanID, 0, true, now); err != nil {
+		t.Fatalf("unable to record attempt: %v", err)
+	}
+
+	expected := (1 + channelScorePrior*channelScorePriorWeight) /
+		(4 + channelScorePriorWeight)
+	assertProbability(0, now, expected, 4)
+
+	// The other direction should remain unaffected.
+	assertProbability(1, now, channelScorePrior, 0)
+
+	// After a single half life, the attempts should only count half.
+	later := now.Add(channelScoreHalfLife)
+	expected = (0.5 + channelScorePrior*channelScorePriorWeight) /
+		(2 + channelScorePriorWeight)
+	assertProbability(0, later, expected, 4)
+
+	// A new success recorded at that time should be combined with the
+	// decayed counters.
+	if err := db.recordAttempt(chanID, 0, true, later); err != nil {
+		t.Fatalf("unable to record attempt: %v", err)
+	}
+	expected = (1.5 + channelScorePrior*channelScorePriorWeight) /
+		(3 + channelScorePriorWeight)
+	assertProbability(0, later, expected, 5)
+
+	// Eventually, the estimate should return to the prior.
+	muchLater := later.Add(100 * channelScoreHalfLife)
+	assertProbability(0, muchLater, channelScorePrior, 5)
+
+	err = db.RecordAttempt(chanID, 2, true)
+	if err != ErrInvalidChannelDirection {
+		t.Fatalf("expected ErrInvalidChannelDirection, got %v", err)
+	}
+}
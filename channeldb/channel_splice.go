@@ -0,0 +1,188 @@
+package channeldb
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+const (
+	// MaxSplicePendingHTLCs is the max number of HTLCs that may be pending
+	// on a channel for it to be eligible for splicing. A splice can only
+	// be negotiated once the channel is quiescent, so channels with more
+	// HTLCs in flight would hold up the splice for too long.
+	MaxSplicePendingHTLCs = 5
+)
+
+var (
+	// ErrChannelNotSpliceable is returned when applying a splice to a
+	// channel that's pending, isn't of the default status, or whose
+	// commitment type doesn't support splicing.
+	ErrChannelNotSpliceable = fmt.Errorf("channel can't be spliced")
+
+	// ErrSpliceCommitmentMismatch is returned when applying a splice whose
+	// commitment doesn't spend exactly the new capacity of the channel.
+	ErrSpliceCommitmentMismatch = fmt.Errorf("splice commitment doesn't " +
+		"match new capacity")
+)
+
+// SupportsSplicing returns whether channels of the commitment type can be
+// spliced. The legacy format only references the funding output by its
+// outpoint, so its commitments can be re-signed against the output of a
+// splice transaction.
+func (c CommitmentType) SupportsSplicing() bool {
+	switch c {
+	case CommitmentTypeLegacy:
+		return true
+	}
+
+	return false
+}
+
+// SpliceableChannels returns the open channels that are eligible for
+// splicing, in no particular order. A channel is eligible if all of the
+// following hold:
+//   - Its funding transaction is confirmed, i.e. it isn't pending.
+//   - Its status is ChanStatusDefault. Channels that are borked, are being
+//     closed, lost local data or were restored from a backup aren't
+//     eligible.
+//   - Its commitment type supports splicing, see SupportsSplicing.
+//   - At most MaxSplicePendingHTLCs HTLCs are pending on it, counting each
+//     HTLC on its local and remote commitment, and on a pending remote
+//     commitment, once.
+func (d *DB) SpliceableChannels() ([]*OpenChannel, error) {
+	var channels []*OpenChannel
+	err := d.View(func(tx *bbolt.Tx) error {
+		channels = nil
+
+		openChanBucket := tx.Bucket(openChannelBucket)
+		if openChanBucket == nil {
+			return nil
+		}
+
+		return forEachChanBucket(openChanBucket, func(op wire.OutPoint,
+			chanBucket *bbolt.Bucket) error {
+
+			channel, err := fetchOpenChannel(chanBucket, &op)
+			if err != nil {
+				return err
+			}
+			if channel.IsPending ||
+				channel.ChanStatus() != ChanStatusDefault ||
+				!channel.CommitmentType.SupportsSplicing() {
+
+				return nil
+			}
+
+			htlcs, err := pendingHTLCRefs(chanBucket, op)
+			if err != nil {
+				return err
+			}
+			if len(htlcs) > MaxSplicePendingHTLCs {
+				return nil
+			}
+
+			channel.Db = d
+			channels = append(channels, channel)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return channels, nil
+}
+
+// ApplySplice records the completion of a splice of the open channel with the
+// passed funding outpoint, which changed its capacity to newCap. Within a
+// single transaction, the capacity of both the channel and its edge within
+// the channel graph is updated, and newCommit replaces the local commitment
+// of the channel. The new commitment must be consistent with the new
+// capacity: its balances, commitment fee and HTLCs must add up to exactly
+// newCap, otherwise ErrSpliceCommitmentMismatch is returned. A channel that
+// isn't announced within the graph yet has no edge to update. The remote
+// commitment is left to be advanced through AppendRemoteCommitChain.
+func (d *DB) ApplySplice(op wire.OutPoint, newCap btcutil.Amount,
+	newCommit *ChannelCommitment) error {
+
+	if err := validateSpliceCommitment(newCap, newCommit); err != nil {
+		return err
+	}
+
+	return d.Update(func(tx *bbolt.Tx) error {
+		_, _, chanBucket, err := findChanBucket(tx, &op)
+		if err != nil {
+			return err
+		}
+
+		channel := &OpenChannel{
+			FundingOutpoint: op,
+		}
+		if err := fetchChanInfo(chanBucket, channel); err != nil {
+			return err
+		}
+		commitType, err := fetchChanCommitType(chanBucket)
+		if err != nil {
+			return err
+		}
+		if channel.IsPending ||
+			channel.ChanStatus() != ChanStatusDefault ||
+			!commitType.SupportsSplicing() {
+
+			return ErrChannelNotSpliceable
+		}
+
+		channel.Capacity = newCap
+		if err := putChanInfo(chanBucket, channel); err != nil {
+			return err
+		}
+		err = putChanCommitment(chanBucket, newCommit, true)
+		if err != nil {
+			return err
+		}
+
+		chanID := channel.ShortChannelID.ToUint64()
+		err = putEdgeCapacity(tx, chanID, newCap)
+		if err == ErrEdgeNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// validateSpliceCommitment ensures that the balances, commitment fee and HTLCs
+// of the commitment add up to the capacity of the spliced channel.
+func validateSpliceCommitment(newCap btcutil.Amount,
+	commit *ChannelCommitment) error {
+
+	if commit == nil {
+		return ErrSpliceCommitmentMismatch
+	}
+
+	amts := []lnwire.MilliSatoshi{
+		commit.LocalBalance, commit.RemoteBalance,
+		lnwire.NewMSatFromSatoshis(commit.CommitFee),
+	}
+	for _, htlc := range commit.Htlcs {
+		amts = append(amts, htlc.Amt)
+	}
+
+	var total lnwire.MilliSatoshi
+	for _, amt := range amts {
+		var err error
+		total, err = addAmount(total, amt)
+		if err != nil {
+			return ErrSpliceCommitmentMismatch
+		}
+	}
+	if total != lnwire.NewMSatFromSatoshis(newCap) {
+		return ErrSpliceCommitmentMismatch
+	}
+
+	return nil
+}
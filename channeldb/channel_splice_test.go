@@ -0,0 +1,249 @@
+package channeldb
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestSpliceableChannels asserts that only confirmed channels of the default
+// status with few enough pending HTLCs are eligible for splicing.
+func TestSpliceableChannels(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	channels, err := db.SpliceableChannels()
+	if err != nil {
+		t.Fatalf("unable to fetch spliceable channels: %v", err)
+	}
+	if len(channels) != 0 {
+		t.Fatalf("expected no spliceable channels, got %v",
+			len(channels))
+	}
+
+	createChannel := func(pending bool, numHTLCs int) *OpenChannel {
+		t.Helper()
+
+		channel, err := createTestChannelState(db)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		for i := 0; i < numHTLCs; i++ {
+			channel.RemoteCommitment.Htlcs = append(
+				channel.RemoteCommitment.Htlcs, HTLC{
+					HtlcIndex: uint64(i),
+					Amt:       1000,
+				},
+			)
+		}
+
+		if pending {
+			addr := &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 18555,
+			}
+			err = channel.SyncPending(addr, 101)
+		} else {
+			channel.IsPending = false
+			err = channel.FullSync()
+		}
+		if err != nil {
+			t.Fatalf("unable to save channel state: %v", err)
+		}
+
+		return channel
+	}
+
+	eligible := createChannel(false, 0)
+	eligibleHTLCs := createChannel(false, MaxSplicePendingHTLCs)
+	createChannel(true, 0)
+	createChannel(false, MaxSplicePendingHTLCs+1)
+
+	borked := createChannel(false, 0)
+	if err := borked.MarkBorked(); err != nil {
+		t.Fatalf("unable to mark channel borked: %v", err)
+	}
+
+	// HTLCs of a pending remote commitment count towards the limit as
+	// well.
+	withDiff := createChannel(false, MaxSplicePendingHTLCs)
+	commitDiff := &CommitDiff{
+		Commitment: withDiff.RemoteCommitment,
+		CommitSig: &lnwire.CommitSig{
+			ChanID: lnwire.NewChanIDFromOutPoint(
+				&withDiff.FundingOutpoint,
+			),
+		},
+		OpenedCircuitKeys: []CircuitKey{},
+		ClosedCircuitKeys: []CircuitKey{},
+	}
+	commitDiff.Commitment.CommitHeight++
+	commitDiff.Commitment.Htlcs = append(
+		commitDiff.Commitment.Htlcs, HTLC{
+			HtlcIndex: MaxSplicePendingHTLCs,
+			Amt:       1000,
+		},
+	)
+	if err := withDiff.AppendRemoteCommitChain(commitDiff); err != nil {
+		t.Fatalf("unable to add to commit chain: %v", err)
+	}
+
+	channels, err = db.SpliceableChannels()
+	if err != nil {
+		t.Fatalf("unable to fetch spliceable channels: %v", err)
+	}
+
+	expected := map[wire.OutPoint]struct{}{
+		eligible.FundingOutpoint:      {},
+		eligibleHTLCs.FundingOutpoint: {},
+	}
+	if len(channels) != len(expected) {
+		t.Fatalf("expected %v spliceable channels, got %v",
+			len(expected), len(channels))
+	}
+	for _, channel := range channels {
+		if _, ok := expected[channel.FundingOutpoint]; !ok {
+			t.Fatalf("unexpected spliceable channel %v",
+				channel.FundingOutpoint)
+		}
+	}
+}
+
+// TestApplySplice asserts that a splice updates the capacity of a channel and
+// its edge along with its local commitment, and that splices with a
+// commitment that's inconsistent with the new capacity are rejected.
+func TestApplySplice(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	graph := db.ChannelGraph()
+	node1, err := createTestVertex(db)
+	if err != nil {
+		t.Fatalf("unable to create test node: %v", err)
+	}
+	node2, err := createTestVertex(db)
+	if err != nil {
+		t.Fatalf("unable to create test node: %v", err)
+	}
+	channel, err := createTestChannelState(db)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	edgeInfo, shortChanID := createEdge(100, 0, 0, 0, node1, node2)
+	edgeInfo.Capacity = channel.Capacity
+	if err := graph.AddChannelEdge(&edgeInfo); err != nil {
+		t.Fatalf("unable to add channel edge: %v", err)
+	}
+
+	channel.IsPending = false
+	channel.ShortChannelID = shortChanID
+	if err := channel.FullSync(); err != nil {
+		t.Fatalf("unable to save channel state: %v", err)
+	}
+	op := channel.FundingOutpoint
+
+	newCap := btcutil.Amount(20000)
+	newCommit := channel.LocalCommitment
+	newCommit.CommitHeight++
+	newCommit.CommitFee = 1000
+	newCommit.Htlcs = []HTLC{{
+		Amt:       4000000,
+		OnionBlob: []byte("onionblob"),
+	}}
+	newCommit.LocalBalance = 10000000
+	newCommit.RemoteBalance = 5000000
+
+	assertChannel := func(expectedCap btcutil.Amount,
+		expectedCommit *ChannelCommitment) {
+
+		t.Helper()
+
+		channels, err := db.FetchOpenChannels(channel.IdentityPub)
+		if err != nil {
+			t.Fatalf("unable to fetch open channels: %v", err)
+		}
+		if len(channels) != 1 {
+			t.Fatalf("expected 1 channel, got %v", len(channels))
+		}
+		if channels[0].Capacity != expectedCap {
+			t.Fatalf("expected capacity %v, got %v", expectedCap,
+				channels[0].Capacity)
+		}
+		if !reflect.DeepEqual(
+			channels[0].LocalCommitment, *expectedCommit,
+		) {
+			t.Fatalf("expected local commitment %v, got %v",
+				spew.Sdump(expectedCommit),
+				spew.Sdump(channels[0].LocalCommitment))
+		}
+
+		info, _, _, err := graph.FetchChannelEdgesByID(
+			shortChanID.ToUint64(),
+		)
+		if err != nil {
+			t.Fatalf("unable to fetch edge: %v", err)
+		}
+		if info.Capacity != expectedCap {
+			t.Fatalf("expected edge capacity %v, got %v",
+				expectedCap, info.Capacity)
+		}
+	}
+
+	// A commitment that doesn't spend the full new capacity is rejected,
+	// leaving the channel and its edge untouched.
+	oldCommit := channel.LocalCommitment
+	mismatched := newCommit
+	mismatched.CommitFee++
+	err = db.ApplySplice(op, newCap, &mismatched)
+	if err != ErrSpliceCommitmentMismatch {
+		t.Fatalf("expected ErrSpliceCommitmentMismatch, got %v", err)
+	}
+	err = db.ApplySplice(op, newCap, nil)
+	if err != ErrSpliceCommitmentMismatch {
+		t.Fatalf("expected ErrSpliceCommitmentMismatch, got %v", err)
+	}
+	assertChannel(channel.Capacity, &oldCommit)
+
+	if err := db.ApplySplice(op, newCap, &newCommit); err != nil {
+		t.Fatalf("unable to apply splice: %v", err)
+	}
+	assertChannel(newCap, &newCommit)
+
+	// Unknown and pending channels can't be spliced.
+	unknown := wire.OutPoint{Hash: op.Hash, Index: op.Index + 1}
+	err = db.ApplySplice(unknown, newCap, &newCommit)
+	if err != ErrChannelNotFound {
+		t.Fatalf("expected ErrChannelNotFound, got %v", err)
+	}
+
+	pending, err := createTestChannelState(db)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	addr := &net.TCPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 18555,
+	}
+	if err := pending.SyncPending(addr, 101); err != nil {
+		t.Fatalf("unable to save channel state: %v", err)
+	}
+	err = db.ApplySplice(pending.FundingOutpoint, newCap, &newCommit)
+	if err != ErrChannelNotSpliceable {
+		t.Fatalf("expected ErrChannelNotSpliceable, got %v", err)
+	}
+}
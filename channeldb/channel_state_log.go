@@ -0,0 +1,355 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// channelStateLogBucket is the top-level bucket that durably records
+	// every change of the status of an open channel, in the order the
+	// changes were committed.
+	//
+	// maps: seqNo => chanPoint || oldStatus || newStatus ||
+	//               oldLifecycle || newLifecycle
+	channelStateLogBucket = []byte("channel-state-log")
+
+	// ErrUnknownChannelStateSubscription is returned when canceling a
+	// subscription that isn't active.
+	ErrUnknownChannelStateSubscription = fmt.Errorf("unknown channel " +
+		"state subscription")
+)
+
+// ChannelLifecycle is the stage of its lifecycle a channel is in.
+type ChannelLifecycle uint8
+
+const (
+	// ChannelOpen denotes a channel whose funding transaction has
+	// confirmed. It's the zero value, such that events logged before
+	// lifecycle stages were recorded are read as status changes of an open
+	// channel.
+	ChannelOpen ChannelLifecycle = iota
+
+	// ChannelPending denotes a channel whose funding transaction hasn't
+	// confirmed yet.
+	ChannelPending
+
+	// ChannelClosed denotes a channel that has been closed.
+	ChannelClosed
+)
+
+// String returns a human readable description of the lifecycle stage.
+func (l ChannelLifecycle) String() string {
+	switch l {
+	case ChannelOpen:
+		return "Open"
+	case ChannelPending:
+		return "Pending"
+	case ChannelClosed:
+		return "Closed"
+	default:
+		return fmt.Sprintf("ChannelLifecycle(%d)", uint8(l))
+	}
+}
+
+// channelLifecycle returns the lifecycle stage of the passed channel, which
+// hasn't been closed yet.
+func channelLifecycle(channel *OpenChannel) ChannelLifecycle {
+	if channel.IsPending {
+		return ChannelPending
+	}
+
+	return ChannelOpen
+}
+
+// ChannelStateEvent records a change of the state of a channel, which is
+// either a change of its status, or it moving to the next stage of its
+// lifecycle. A channel that's marked as open moves from ChannelPending to
+// ChannelOpen, and a channel that's closed moves from either of them to
+// ChannelClosed. As those events leave the status as is, both OldState and
+// NewState hold the channel's status at the time, while events that change
+// the status leave the lifecycle stage as is.
+type ChannelStateEvent struct {
+	// Seq is the sequence number of the event within the channel state
+	// log. Sequence numbers start at 1 and increase monotonically.
+	Seq uint64
+
+	// ChanPoint is the funding outpoint of the channel.
+	ChanPoint wire.OutPoint
+
+	// OldState is the status of the channel before the change.
+	OldState ChannelStatus
+
+	// NewState is the status of the channel after the change.
+	NewState ChannelStatus
+
+	// OldLifecycle is the lifecycle stage of the channel before the
+	// change.
+	OldLifecycle ChannelLifecycle
+
+	// NewLifecycle is the lifecycle stage of the channel after the
+	// change.
+	NewLifecycle ChannelLifecycle
+}
+
+// channelStateSubscriber is a single subscription to the channel state log.
+type channelStateSubscriber struct {
+	// events is the channel events are delivered on.
+	events chan ChannelStateEvent
+
+	// wake is signaled whenever new events have been committed.
+	wake chan struct{}
+
+	// quit is closed once the subscription is canceled.
+	quit chan struct{}
+}
+
+// channelStateSubscribers is the set of active subscriptions to the channel
+// state log.
+type channelStateSubscribers struct {
+	sync.Mutex
+	subs map[<-chan ChannelStateEvent]*channelStateSubscriber
+}
+
+// SubscribeChannelStates returns a channel that delivers all channel state
+// events with a sequence number greater than sinceSeq. The events already
+// within the log are replayed first, after which events are delivered as
+// they're committed. As the log is durable, a consumer that persists the
+// sequence number of the last event it processed doesn't miss any events
+// across restarts, by subscribing from that sequence number.
+//
+// The returned channel must be passed to CancelChannelStateSubscription once
+// the consumer is no longer interested in events.
+func (d *DB) SubscribeChannelStates(
+	sinceSeq uint64) (<-chan ChannelStateEvent, error) {
+
+	sub := &channelStateSubscriber{
+		events: make(chan ChannelStateEvent),
+		wake:   make(chan struct{}, 1),
+		quit:   make(chan struct{}),
+	}
+
+	// The subscriber is registered before anything is read from the log,
+	// such that no event committed in the meantime goes unnoticed.
+	d.chanStateSubs.Lock()
+	if d.chanStateSubs.subs == nil {
+		d.chanStateSubs.subs = make(
+			map[<-chan ChannelStateEvent]*channelStateSubscriber,
+		)
+	}
+	d.chanStateSubs.subs[sub.events] = sub
+	d.chanStateSubs.Unlock()
+
+	go d.streamChannelStates(sub, sinceSeq)
+
+	return sub.events, nil
+}
+
+// CancelChannelStateSubscription cancels the subscription that delivers events
+// on the passed channel. The channel is closed once the subscription exits.
+func (d *DB) CancelChannelStateSubscription(
+	events <-chan ChannelStateEvent) error {
+
+	d.chanStateSubs.Lock()
+	defer d.chanStateSubs.Unlock()
+
+	sub, ok := d.chanStateSubs.subs[events]
+	if !ok {
+		return ErrUnknownChannelStateSubscription
+	}
+	delete(d.chanStateSubs.subs, events)
+	close(sub.quit)
+
+	return nil
+}
+
+// ChannelStateLog returns all events within the channel state log with a
+// sequence number greater than sinceSeq, in the order they were committed.
+func (d *DB) ChannelStateLog(sinceSeq uint64) ([]ChannelStateEvent, error) {
+	var events []ChannelStateEvent
+	err := d.View(func(tx *bbolt.Tx) error {
+		stateLog := tx.Bucket(channelStateLogBucket)
+		if stateLog == nil {
+			return nil
+		}
+
+		var start [8]byte
+		byteOrder.PutUint64(start[:], sinceSeq+1)
+
+		cursor := stateLog.Cursor()
+		k, v := cursor.Seek(start[:])
+		for ; k != nil; k, v = cursor.Next() {
+			event, err := deserializeChannelStateEvent(
+				bytes.NewReader(v),
+			)
+			if err != nil {
+				return err
+			}
+			event.Seq = byteOrder.Uint64(k)
+
+			events = append(events, event)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// streamChannelStates delivers the events of the channel state log to the
+// subscriber, until the subscription is canceled. Whenever the subscriber is
+// woken up, all events following the last delivered one are read from the log,
+// such that replayed and live events are delivered alike.
+func (d *DB) streamChannelStates(sub *channelStateSubscriber,
+	lastSeq uint64) {
+
+	defer close(sub.events)
+
+	for {
+		events, err := d.ChannelStateLog(lastSeq)
+		if err != nil {
+			log.Errorf("Unable to read channel state log: %v", err)
+			return
+		}
+
+		for _, event := range events {
+			select {
+			case sub.events <- event:
+				lastSeq = event.Seq
+			case <-sub.quit:
+				return
+			}
+		}
+
+		select {
+		case <-sub.wake:
+		case <-sub.quit:
+			return
+		}
+	}
+}
+
+// notifyChannelStates wakes up all subscribers of the channel state log. It
+// must be called after a transaction that logged channel state events has
+// been committed.
+func (d *DB) notifyChannelStates() {
+	d.chanStateSubs.Lock()
+	defer d.chanStateSubs.Unlock()
+
+	for _, sub := range d.chanStateSubs.subs {
+		select {
+		case sub.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// logChannelStatus appends a change of the status of the passed channel to
+// the channel state log. Changes that leave the status as is aren't logged.
+func logChannelStatus(tx *bbolt.Tx, channel *OpenChannel, oldStatus,
+	newStatus ChannelStatus) error {
+
+	lifecycle := channelLifecycle(channel)
+	return logChannelState(tx, &ChannelStateEvent{
+		ChanPoint:    channel.FundingOutpoint,
+		OldState:     oldStatus,
+		NewState:     newStatus,
+		OldLifecycle: lifecycle,
+		NewLifecycle: lifecycle,
+	})
+}
+
+// logChannelLifecycle appends the passed channel moving from its current
+// lifecycle stage to the new one to the channel state log. Moves that leave
+// the lifecycle stage as is aren't logged.
+func logChannelLifecycle(tx *bbolt.Tx, channel *OpenChannel,
+	newLifecycle ChannelLifecycle) error {
+
+	return logChannelState(tx, &ChannelStateEvent{
+		ChanPoint:    channel.FundingOutpoint,
+		OldState:     channel.chanStatus,
+		NewState:     channel.chanStatus,
+		OldLifecycle: channelLifecycle(channel),
+		NewLifecycle: newLifecycle,
+	})
+}
+
+// logChannelState appends the passed event to the channel state log, unless
+// it leaves the state of the channel as is.
+func logChannelState(tx *bbolt.Tx, event *ChannelStateEvent) error {
+	if event.OldState == event.NewState &&
+		event.OldLifecycle == event.NewLifecycle {
+
+		return nil
+	}
+
+	stateLog, err := tx.CreateBucketIfNotExists(channelStateLogBucket)
+	if err != nil {
+		return err
+	}
+
+	seq, err := stateLog.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	if err := serializeChannelStateEvent(&b, event); err != nil {
+		return err
+	}
+
+	var k [8]byte
+	byteOrder.PutUint64(k[:], seq)
+
+	return stateLog.Put(k[:], b.Bytes())
+}
+
+func serializeChannelStateEvent(w io.Writer, event *ChannelStateEvent) error {
+	if err := writeOutpoint(w, &event.ChanPoint); err != nil {
+		return err
+	}
+
+	err := WriteElements(w, event.OldState, event.NewState)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write([]byte{
+		byte(event.OldLifecycle), byte(event.NewLifecycle),
+	})
+	return err
+}
+
+func deserializeChannelStateEvent(r io.Reader) (ChannelStateEvent, error) {
+	var event ChannelStateEvent
+	if err := readOutpoint(r, &event.ChanPoint); err != nil {
+		return event, err
+	}
+
+	err := ReadElements(r, &event.OldState, &event.NewState)
+	if err != nil {
+		return event, err
+	}
+
+	// Events logged before lifecycle stages were recorded end here, and
+	// are status changes of an open channel.
+	var lifecycles [2]byte
+	switch _, err := io.ReadFull(r, lifecycles[:]); {
+	case err == io.EOF:
+		return event, nil
+	case err != nil:
+		return event, err
+	}
+	event.OldLifecycle = ChannelLifecycle(lifecycles[0])
+	event.NewLifecycle = ChannelLifecycle(lifecycles[1])
+
+	return event, nil
+}
@@ -0,0 +1,177 @@
+package channeldb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcutil"
+)
+
+// receiveChannelState returns the next event delivered on events, failing the
+// test if none arrives in time.
+func receiveChannelState(t *testing.T,
+	events <-chan ChannelStateEvent) ChannelStateEvent {
+
+	t.Helper()
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatalf("subscription closed unexpectedly")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no channel state event received")
+	}
+
+	return ChannelStateEvent{}
+}
+
+// TestSubscribeChannelStates asserts that subscribers to the channel state
+// log receive all status changes and lifecycle stages of a channel, both
+// replayed from the log and live, and that canceling a subscription closes its
+// channel.
+func TestSubscribeChannelStates(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	channel, err := createTestChannelState(db)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	if err := channel.FullSync(); err != nil {
+		t.Fatalf("unable to save channel: %v", err)
+	}
+	op := channel.FundingOutpoint
+
+	// The first changes are committed before anyone subscribes, so they
+	// must be replayed from the log.
+	if err := channel.MarkAsOpen(channel.ShortChannelID); err != nil {
+		t.Fatalf("unable to mark channel open: %v", err)
+	}
+	if err := channel.MarkBorked(); err != nil {
+		t.Fatalf("unable to mark channel borked: %v", err)
+	}
+
+	events, err := db.SubscribeChannelStates(0)
+	if err != nil {
+		t.Fatalf("unable to subscribe: %v", err)
+	}
+
+	broadcast := ChanStatusBorked | ChanStatusCommitBroadcasted
+	expected := []ChannelStateEvent{
+		{
+			Seq:          1,
+			ChanPoint:    op,
+			OldState:     ChanStatusDefault,
+			NewState:     ChanStatusDefault,
+			OldLifecycle: ChannelPending,
+			NewLifecycle: ChannelOpen,
+		},
+		{
+			Seq:          2,
+			ChanPoint:    op,
+			OldState:     ChanStatusDefault,
+			NewState:     ChanStatusBorked,
+			OldLifecycle: ChannelOpen,
+			NewLifecycle: ChannelOpen,
+		},
+		{
+			Seq:          3,
+			ChanPoint:    op,
+			OldState:     ChanStatusBorked,
+			NewState:     broadcast,
+			OldLifecycle: ChannelOpen,
+			NewLifecycle: ChannelOpen,
+		},
+		{
+			Seq:          4,
+			ChanPoint:    op,
+			OldState:     broadcast,
+			NewState:     ChanStatusCommitBroadcasted,
+			OldLifecycle: ChannelOpen,
+			NewLifecycle: ChannelOpen,
+		},
+		{
+			Seq:          5,
+			ChanPoint:    op,
+			OldState:     ChanStatusCommitBroadcasted,
+			NewState:     ChanStatusCommitBroadcasted,
+			OldLifecycle: ChannelOpen,
+			NewLifecycle: ChannelClosed,
+		},
+	}
+
+	for _, exp := range expected[:2] {
+		event := receiveChannelState(t, events)
+		if !reflect.DeepEqual(event, exp) {
+			t.Fatalf("expected event %v, got %v", exp, event)
+		}
+	}
+
+	// The remaining changes are delivered live. Applying a status that's
+	// already set doesn't change the state, and must not be logged.
+	if err := channel.MarkCommitmentBroadcasted(); err != nil {
+		t.Fatalf("unable to mark commitment broadcast: %v", err)
+	}
+	if err := channel.MarkBorked(); err != nil {
+		t.Fatalf("unable to mark channel borked: %v", err)
+	}
+	if err := channel.ClearChanStatus(ChanStatusBorked); err != nil {
+		t.Fatalf("unable to clear status: %v", err)
+	}
+	closeSummary := &ChannelCloseSummary{
+		ChanPoint:      op,
+		RemotePub:      channel.IdentityPub,
+		SettledBalance: btcutil.Amount(500),
+		CloseType:      RemoteForceClose,
+	}
+	if err := channel.CloseChannel(closeSummary); err != nil {
+		t.Fatalf("unable to close channel: %v", err)
+	}
+	for _, exp := range expected[2:] {
+		event := receiveChannelState(t, events)
+		if !reflect.DeepEqual(event, exp) {
+			t.Fatalf("expected event %v, got %v", exp, event)
+		}
+	}
+
+	// A consumer resuming from the first event only receives the ones
+	// that followed it.
+	resumed, err := db.SubscribeChannelStates(1)
+	if err != nil {
+		t.Fatalf("unable to subscribe: %v", err)
+	}
+	for _, exp := range expected[1:] {
+		event := receiveChannelState(t, resumed)
+		if !reflect.DeepEqual(event, exp) {
+			t.Fatalf("expected event %v, got %v", exp, event)
+		}
+	}
+
+	for _, sub := range []<-chan ChannelStateEvent{events, resumed} {
+		if err := db.CancelChannelStateSubscription(sub); err != nil {
+			t.Fatalf("unable to cancel subscription: %v", err)
+		}
+		select {
+		case _, ok := <-sub:
+			if ok {
+				t.Fatalf("unexpected event after cancel")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("subscription not closed")
+		}
+	}
+
+	err = db.CancelChannelStateSubscription(events)
+	if err != ErrUnknownChannelStateSubscription {
+		t.Fatalf("expected ErrUnknownChannelStateSubscription, got %v",
+			err)
+	}
+}
@@ -97,8 +97,10 @@ func makeTestDB() (*DB, func(), error) {
 		return nil, nil, err
 	}
 
-	// Next, create channeldb for the first time.
-	cdb, err := Open(tempDirName)
+	// Next, create channeldb for the first time. As the database is
+	// discarded once the test completes, we don't need commits to be
+	// synced to disk.
+	cdb, err := Open(tempDirName, OptionSetSyncMode(NoSync))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -742,6 +744,74 @@ func TestFetchPendingChannels(t *testing.T) {
 	}
 }
 
+// TestMarkChannelOpen asserts that a pending channel is marked as open along
+// with its final short channel ID, and that channels which aren't pending are
+// rejected.
+func TestMarkChannelOpen(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	state, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	addr := &net.TCPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 18555,
+	}
+	if err := state.SyncPending(addr, 99); err != nil {
+		t.Fatalf("unable to save and serialize channel state: %v", err)
+	}
+
+	// A channel that doesn't exist can't be marked as open.
+	var unknownOp wire.OutPoint
+	scid := lnwire.NewShortChanIDFromInt(1000)
+	if err := cdb.MarkChannelOpen(unknownOp, scid); err == nil {
+		t.Fatalf("expected unknown channel to be rejected")
+	}
+
+	if err := cdb.MarkChannelOpen(state.FundingOutpoint, scid); err != nil {
+		t.Fatalf("unable to mark channel as open: %v", err)
+	}
+
+	pendingChannels, err := cdb.FetchPendingChannels()
+	if err != nil {
+		t.Fatalf("unable to list pending channels: %v", err)
+	}
+	if len(pendingChannels) != 0 {
+		t.Fatalf("expected no pending channels, got %v",
+			len(pendingChannels))
+	}
+
+	channel, err := cdb.FetchChannel(state.FundingOutpoint)
+	if err != nil {
+		t.Fatalf("unable to fetch channel: %v", err)
+	}
+	if channel.IsPending {
+		t.Fatalf("channel marked open should no longer be pending")
+	}
+	if channel.ShortChanID() != scid {
+		t.Fatalf("expected short channel ID %v, got %v", scid,
+			channel.ShortChanID())
+	}
+	if channel.Confirmations != uint32(channel.NumConfsRequired) {
+		t.Fatalf("expected %v confirmations, got %v",
+			channel.NumConfsRequired, channel.Confirmations)
+	}
+
+	// Once open, the channel can't be marked as open again.
+	otherScid := lnwire.NewShortChanIDFromInt(2000)
+	err = cdb.MarkChannelOpen(state.FundingOutpoint, otherScid)
+	if err != ErrChannelNotPending {
+		t.Fatalf("expected ErrChannelNotPending, got %v", err)
+	}
+}
+
 func TestFetchClosedChannels(t *testing.T) {
 	t.Parallel()
 
@@ -852,6 +922,93 @@ func TestFetchClosedChannels(t *testing.T) {
 	}
 }
 
+// TestFetchAbandonedChannels asserts that the details of abandoned channels are
+// persisted, and that abandoned channels can be filtered by their close type.
+func TestFetchAbandonedChannels(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	// We'll create two channels, one of which will be closed
+	// cooperatively, while the other is abandoned.
+	addr := &net.TCPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 18555,
+	}
+	closeTypes := []ClosureType{CooperativeClose, Abandoned}
+	summaries := make([]*ChannelCloseSummary, 0, len(closeTypes))
+	for _, closeType := range closeTypes {
+		state, err := createTestChannelState(cdb)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		if err := state.SyncPending(addr, 99); err != nil {
+			t.Fatalf("unable to save channel state: %v", err)
+		}
+
+		summary := &ChannelCloseSummary{
+			ChanPoint:       state.FundingOutpoint,
+			ClosingTXID:     rev,
+			RemotePub:       state.IdentityPub,
+			Capacity:        state.Capacity,
+			SettledBalance:  state.LocalCommitment.LocalBalance.ToSatoshis(),
+			CloseType:       closeType,
+			LocalChanConfig: state.LocalChanCfg,
+		}
+		if closeType == Abandoned {
+			summary.AbandonReason = "stuck commitment"
+			summary.FundsLost = true
+		}
+		if err := state.CloseChannel(summary); err != nil {
+			t.Fatalf("unable to close channel: %v", err)
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	abandoned, err := cdb.FetchClosedChannelsByType(Abandoned)
+	if err != nil {
+		t.Fatalf("unable to fetch abandoned channels: %v", err)
+	}
+	if len(abandoned) != 1 {
+		t.Fatalf("expected 1 abandoned channel, got %v", len(abandoned))
+	}
+	if !reflect.DeepEqual(summaries[1], abandoned[0]) {
+		t.Fatalf("database summaries don't match: expected %v got %v",
+			spew.Sdump(summaries[1]), spew.Sdump(abandoned[0]))
+	}
+
+	coopClosed, err := cdb.FetchClosedChannelsByType(CooperativeClose)
+	if err != nil {
+		t.Fatalf("unable to fetch closed channels: %v", err)
+	}
+	if len(coopClosed) != 1 {
+		t.Fatalf("expected 1 cooperatively closed channel, got %v",
+			len(coopClosed))
+	}
+	if !reflect.DeepEqual(summaries[0], coopClosed[0]) {
+		t.Fatalf("database summaries don't match: expected %v got %v",
+			spew.Sdump(summaries[0]), spew.Sdump(coopClosed[0]))
+	}
+
+	// The abandonment details should also be returned when looking up
+	// the channel by its channel point.
+	summary, err := cdb.FetchClosedChannel(&summaries[1].ChanPoint)
+	if err != nil {
+		t.Fatalf("unable to fetch closed channel: %v", err)
+	}
+	if summary.AbandonReason != summaries[1].AbandonReason ||
+		!summary.FundsLost {
+
+		t.Fatalf("abandonment details not retrieved: %v",
+			spew.Sdump(summary))
+	}
+}
+
 // TestFetchWaitingCloseChannels ensures that the correct channels that are
 // waiting to be closed are returned.
 func TestFetchWaitingCloseChannels(t *testing.T) {
@@ -0,0 +1,146 @@
+package channeldb
+
+import (
+	"bytes"
+	"crypto/rand"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// chanUUIDKey can be accessed within the bucket for a channel, and
+	// stores the channel's UUID.
+	chanUUIDKey = []byte("chan-uuid-key")
+
+	// channelUUIDIndexBucket is the top-level bucket that indexes all open
+	// channels by their UUID. Each entry holds the keys leading to the
+	// channel's bucket within the open channel bucket.
+	//
+	// maps: uuid -> nodePub || chainHash || chanPoint
+	channelUUIDIndexBucket = []byte("channel-uuid-index")
+)
+
+// ChannelByUUID returns the open channel that was assigned the passed UUID.
+// If no such channel exists, ErrChannelNotFound is returned.
+func (d *DB) ChannelByUUID(id [16]byte) (*OpenChannel, error) {
+	var channel *OpenChannel
+	err := d.View(func(tx *bbolt.Tx) error {
+		uuidIndex := tx.Bucket(channelUUIDIndexBucket)
+		if uuidIndex == nil {
+			return ErrChannelNotFound
+		}
+		location := uuidIndex.Get(id[:])
+		if len(location) < 33+32 {
+			return ErrChannelNotFound
+		}
+		nodePub, chainHash, chanPoint := location[:33],
+			location[33:65], location[65:]
+
+		openChanBucket := tx.Bucket(openChannelBucket)
+		if openChanBucket == nil {
+			return ErrChannelNotFound
+		}
+		nodeChanBucket := openChanBucket.Bucket(nodePub)
+		if nodeChanBucket == nil {
+			return ErrChannelNotFound
+		}
+		chainBucket := nodeChanBucket.Bucket(chainHash)
+		if chainBucket == nil {
+			return ErrChannelNotFound
+		}
+		chanBucket := chainBucket.Bucket(chanPoint)
+		if chanBucket == nil {
+			return ErrChannelNotFound
+		}
+
+		var op wire.OutPoint
+		err := readOutpoint(bytes.NewReader(chanPoint), &op)
+		if err != nil {
+			return err
+		}
+
+		channel, err = fetchOpenChannel(chanBucket, &op)
+		if err != nil {
+			return err
+		}
+		channel.Db = d
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return channel, nil
+}
+
+// newChannelUUID generates a random version 4 UUID.
+func newChannelUUID() ([16]byte, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return id, err
+	}
+
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+
+	return id, nil
+}
+
+// putChanUUID stores the UUID within the passed channel bucket, and adds it
+// to the UUID index along with the keys leading to the channel bucket.
+func putChanUUID(tx *bbolt.Tx, chanBucket *bbolt.Bucket, id [16]byte,
+	nodePub, chainHash, chanPoint []byte) error {
+
+	uuidIndex, err := tx.CreateBucketIfNotExists(channelUUIDIndexBucket)
+	if err != nil {
+		return err
+	}
+
+	location := make([]byte, 0, len(nodePub)+len(chainHash)+len(chanPoint))
+	location = append(location, nodePub...)
+	location = append(location, chainHash...)
+	location = append(location, chanPoint...)
+	if err := uuidIndex.Put(id[:], location); err != nil {
+		return err
+	}
+
+	return chanBucket.Put(chanUUIDKey, id[:])
+}
+
+// deleteChanUUIDOnClose removes the UUID of a closed channel from the UUID
+// index. Channels that weren't assigned a UUID are ignored.
+func deleteChanUUIDOnClose(tx *bbolt.Tx, channel *OpenChannel) error {
+	if channel.UUID == ([16]byte{}) {
+		return nil
+	}
+
+	uuidIndex := tx.Bucket(channelUUIDIndexBucket)
+	if uuidIndex == nil {
+		return nil
+	}
+
+	return uuidIndex.Delete(channel.UUID[:])
+}
+
+// putChanUUIDOnOpen assigns a UUID to a new channel, unless it already
+// carries one, and indexes the channel by it.
+func putChanUUIDOnOpen(tx *bbolt.Tx, chanBucket *bbolt.Bucket,
+	channel *OpenChannel) error {
+
+	if channel.UUID == ([16]byte{}) {
+		id, err := newChannelUUID()
+		if err != nil {
+			return err
+		}
+		channel.UUID = id
+	}
+
+	return putChanUUID(
+		tx, chanBucket, channel.UUID,
+		channel.IdentityPub.SerializeCompressed(),
+		channel.ChainHash[:],
+		canonicalChannelKey(channel.FundingOutpoint),
+	)
+}
@@ -0,0 +1,67 @@
+package channeldb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcutil"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestChannelByUUID asserts that each new channel is assigned a UUID under
+// which it can be looked up until it's closed.
+func TestChannelByUUID(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	state, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	if err := state.FullSync(); err != nil {
+		t.Fatalf("unable to save channel state: %v", err)
+	}
+	if state.UUID == ([16]byte{}) {
+		t.Fatalf("expected channel to be assigned a UUID")
+	}
+
+	channel, err := cdb.ChannelByUUID(state.UUID)
+	if err != nil {
+		t.Fatalf("unable to fetch channel by UUID: %v", err)
+	}
+	if !reflect.DeepEqual(state, channel) {
+		t.Fatalf("channel state doesn't match: %v vs %v",
+			spew.Sdump(state), spew.Sdump(channel))
+	}
+
+	// The UUID should be retained as the channel is modified.
+	if err := channel.MarkBorked(); err != nil {
+		t.Fatalf("unable to mark channel borked: %v", err)
+	}
+	channel, err = cdb.ChannelByUUID(state.UUID)
+	if err != nil {
+		t.Fatalf("unable to fetch channel by UUID: %v", err)
+	}
+	if channel.UUID != state.UUID {
+		t.Fatalf("expected UUID %x, got %x", state.UUID, channel.UUID)
+	}
+
+	// Once the channel is closed, it should no longer be found.
+	closeSummary := &ChannelCloseSummary{
+		ChanPoint:      state.FundingOutpoint,
+		RemotePub:      state.IdentityPub,
+		SettledBalance: btcutil.Amount(500),
+		CloseType:      CooperativeClose,
+	}
+	if err := state.CloseChannel(closeSummary); err != nil {
+		t.Fatalf("unable to close channel: %v", err)
+	}
+	if _, err := cdb.ChannelByUUID(state.UUID); err != ErrChannelNotFound {
+		t.Fatalf("expected ErrChannelNotFound, got %v", err)
+	}
+}
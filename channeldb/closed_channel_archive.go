@@ -0,0 +1,268 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+const (
+	// closedChanArchiveVersion is the version of the format closed
+	// channels are archived in, written at the start of each archive.
+	closedChanArchiveVersion = 1
+)
+
+var (
+	// ErrInvalidArchiveAge is returned when archiving closed channels with
+	// a negative retention period.
+	ErrInvalidArchiveAge = fmt.Errorf("archive retention period must not " +
+		"be negative")
+
+	// ErrUnknownArchiveVersion is returned when reading an archive of
+	// closed channels of an unknown version.
+	ErrUnknownArchiveVersion = fmt.Errorf("unknown closed channel " +
+		"archive version")
+)
+
+// ArchivedChannel is a closed channel read back from an archive written by
+// ArchiveOldClosedChannels.
+type ArchivedChannel struct {
+	// Summary is the close summary of the channel, including its
+	// abandonment details if it was abandoned.
+	Summary *ChannelCloseSummary
+
+	// OpenTime is the time the channel was opened at.
+	OpenTime time.Time
+
+	// CloseTime is the time the channel was closed at.
+	CloseTime time.Time
+}
+
+// ArchiveOldClosedChannels writes every fully resolved channel that was closed
+// at least olderThan before now to w, and then removes it from the database
+// along with its abandonment details, lifetime and sweep worklist. The number
+// of archived channels is returned. The revocation log of a channel is already
+// removed as it's closed, so it isn't part of the archive.
+//
+// A closed channel is only archived once nothing is left to resolve for it: it
+// must be fully closed, have no outstanding sweep steps, and the settled
+// balance of a cooperative close must have been swept. Channels whose close
+// time wasn't recorded, because they were closed before close times were,
+// are never archived, as their age can't be told.
+//
+// The archive is written within the transaction that removes the channels,
+// which is only committed once the archive was written in full, such that no
+// channel is removed without having been archived. The archive can be read
+// back through ReadClosedChannelArchive.
+func (d *DB) ArchiveOldClosedChannels(olderThan time.Duration, now time.Time,
+	w io.Writer) (uint64, error) {
+
+	if olderThan < 0 {
+		return 0, ErrInvalidArchiveAge
+	}
+	cutoff := now.Add(-olderThan)
+
+	var numArchived uint64
+	err := d.Update(func(tx *bbolt.Tx) error {
+		numArchived = 0
+
+		_, err := w.Write([]byte{closedChanArchiveVersion})
+		if err != nil {
+			return err
+		}
+
+		closedChanBucket := tx.Bucket(closedChannelBucket)
+		lifetimes := tx.Bucket(closedChanLifetimeBucket)
+		if closedChanBucket == nil || lifetimes == nil {
+			return nil
+		}
+
+		var archived [][]byte
+		err = closedChanBucket.ForEach(func(chanKey, v []byte) error {
+			lifetime := lifetimes.Get(chanKey)
+			if lifetime == nil {
+				return nil
+			}
+			if len(lifetime) != 16 {
+				return fmt.Errorf("invalid lifetime of closed "+
+					"channel %x", chanKey)
+			}
+			openTime := time.Unix(
+				0, int64(byteOrder.Uint64(lifetime[:8])),
+			)
+			closeTime := time.Unix(
+				0, int64(byteOrder.Uint64(lifetime[8:])),
+			)
+			if closeTime.After(cutoff) {
+				return nil
+			}
+
+			summary, err := deserializeCloseChannelSummary(
+				bytes.NewReader(v),
+			)
+			if err != nil {
+				return err
+			}
+			resolved, err := closedChanResolved(
+				tx, chanKey, summary,
+			)
+			if err != nil || !resolved {
+				return err
+			}
+
+			err = fetchAbandonmentInfo(tx, chanKey, summary)
+			if err != nil {
+				return err
+			}
+			err = writeArchivedChannel(w, &ArchivedChannel{
+				Summary:   summary,
+				OpenTime:  openTime,
+				CloseTime: closeTime,
+			})
+			if err != nil {
+				return err
+			}
+
+			archived = append(
+				archived, append([]byte(nil), chanKey...),
+			)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, chanKey := range archived {
+			if err := deleteClosedChannel(tx, chanKey); err != nil {
+				return err
+			}
+		}
+		numArchived = uint64(len(archived))
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return numArchived, nil
+}
+
+// ReadClosedChannelArchive reads back all channels within an archive written by
+// ArchiveOldClosedChannels, in the order they were archived.
+func ReadClosedChannelArchive(r io.Reader) ([]ArchivedChannel, error) {
+	var version [1]byte
+	if _, err := io.ReadFull(r, version[:]); err != nil {
+		return nil, err
+	}
+	if version[0] != closedChanArchiveVersion {
+		return nil, ErrUnknownArchiveVersion
+	}
+
+	var channels []ArchivedChannel
+	for {
+		var summaryBytes []byte
+		err := ReadElements(r, &summaryBytes)
+		if err == io.EOF {
+			return channels, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		summary, err := decodeCloseChannelSummary(
+			BinaryCodec(CloseSummaryRecord),
+			bytes.NewReader(summaryBytes),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		var (
+			openTime, closeTime uint64
+			reason              []byte
+		)
+		err = ReadElements(
+			r, &openTime, &closeTime, &summary.FundsLost, &reason,
+		)
+		if err != nil {
+			return nil, err
+		}
+		summary.AbandonReason = string(reason)
+
+		channels = append(channels, ArchivedChannel{
+			Summary:   summary,
+			OpenTime:  time.Unix(0, int64(openTime)),
+			CloseTime: time.Unix(0, int64(closeTime)),
+		})
+	}
+}
+
+// closedChanResolved returns whether nothing is left to resolve for the closed
+// channel with the passed key.
+func closedChanResolved(tx *bbolt.Tx, chanKey []byte,
+	summary *ChannelCloseSummary) (bool, error) {
+
+	if summary.IsPending {
+		return false, nil
+	}
+	if summary.CloseType == CooperativeClose && !summary.Swept &&
+		summary.SettledBalance != 0 {
+
+		return false, nil
+	}
+
+	worklists := tx.Bucket(sweepWorklistBucket)
+	if worklists == nil {
+		return true, nil
+	}
+	worklist := worklists.Bucket(chanKey)
+	if worklist == nil {
+		return true, nil
+	}
+	step, _ := worklist.Cursor().First()
+
+	return step == nil, nil
+}
+
+// deleteClosedChannel removes the closed channel with the passed key from the
+// database, along with all state kept for it.
+func deleteClosedChannel(tx *bbolt.Tx, chanKey []byte) error {
+	buckets := [][]byte{
+		closedChannelBucket, abandonedChannelBucket,
+		closedChanLifetimeBucket,
+	}
+	for _, bucketName := range buckets {
+		bucket := tx.Bucket(bucketName)
+		if bucket == nil {
+			continue
+		}
+		if err := bucket.Delete(chanKey); err != nil {
+			return err
+		}
+	}
+
+	return deleteSweepWorklist(tx, chanKey)
+}
+
+// writeArchivedChannel writes the archived channel to w. The abandonment
+// details of its close summary are written after its lifetime, as they're not
+// part of the serialized summary.
+func writeArchivedChannel(w io.Writer, channel *ArchivedChannel) error {
+	var summaryBytes bytes.Buffer
+	err := BinaryCodec(CloseSummaryRecord).Encode(
+		&summaryBytes, channel.Summary,
+	)
+	if err != nil {
+		return err
+	}
+
+	return WriteElements(w,
+		summaryBytes.Bytes(), uint64(channel.OpenTime.UnixNano()),
+		uint64(channel.CloseTime.UnixNano()), channel.Summary.FundsLost,
+		[]byte(channel.Summary.AbandonReason),
+	)
+}
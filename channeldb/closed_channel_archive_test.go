@@ -0,0 +1,217 @@
+package channeldb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestArchiveOldClosedChannels asserts that only closed channels that are
+// fully resolved and old enough are archived and removed, and that they can
+// be read back from the archive.
+func TestArchiveOldClosedChannels(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	now := time.Unix(1500000000, 0)
+	openTime := now.Add(-1000 * time.Hour)
+	oldClose := now.Add(-100 * time.Hour)
+	retention := 50 * time.Hour
+
+	// closeChannel closes a new channel with the passed close summary
+	// template at the given close time. A zero close time leaves the
+	// channel without a recorded lifetime.
+	closeChannel := func(tmpl ChannelCloseSummary,
+		closeTime time.Time) wire.OutPoint {
+
+		t.Helper()
+
+		channel, err := createTestChannelState(db)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		channel.IsPending = false
+		if err := channel.FullSync(); err != nil {
+			t.Fatalf("unable to save channel state: %v", err)
+		}
+
+		summary := tmpl
+		summary.ChanPoint = channel.FundingOutpoint
+		summary.ShortChanID = channel.ShortChannelID
+		summary.ChainHash = channel.ChainHash
+		summary.RemotePub = channel.IdentityPub
+		summary.Capacity = channel.Capacity
+		summary.LocalChanConfig = channel.LocalChanCfg
+		if err := channel.CloseChannel(&summary); err != nil {
+			t.Fatalf("unable to close channel: %v", err)
+		}
+
+		err = db.Update(func(tx *bbolt.Tx) error {
+			op := channel.FundingOutpoint
+			if closeTime.IsZero() {
+				lifetimes := tx.Bucket(closedChanLifetimeBucket)
+				return lifetimes.Delete(canonicalChannelKey(op))
+			}
+
+			return putClosedChanLifetime(
+				tx, op, openTime, closeTime,
+			)
+		})
+		if err != nil {
+			t.Fatalf("unable to set lifetime: %v", err)
+		}
+
+		return channel.FundingOutpoint
+	}
+
+	// Only the fully resolved cooperative close and the abandoned channel
+	// qualify for the archive.
+	resolved := closeChannel(ChannelCloseSummary{
+		CloseType: CooperativeClose,
+	}, oldClose)
+	abandoned := closeChannel(ChannelCloseSummary{
+		CloseType:     Abandoned,
+		AbandonReason: "lost state",
+		FundsLost:     true,
+	}, oldClose)
+	pending := closeChannel(ChannelCloseSummary{
+		CloseType: RemoteForceClose,
+		IsPending: true,
+	}, oldClose)
+	unswept := closeChannel(ChannelCloseSummary{
+		CloseType:      CooperativeClose,
+		SettledBalance: 1000,
+	}, oldClose)
+	sweeping := closeChannel(ChannelCloseSummary{
+		CloseType: RemoteForceClose,
+	}, oldClose)
+	err = db.AddSweepSteps(sweeping, []SweepStep{{
+		Kind:           SweepCommitOutput,
+		Output:         wire.OutPoint{Index: 1},
+		MaturityHeight: 100,
+	}})
+	if err != nil {
+		t.Fatalf("unable to add sweep steps: %v", err)
+	}
+	recent := closeChannel(ChannelCloseSummary{
+		CloseType: CooperativeClose,
+	}, now.Add(-retention+time.Hour))
+	unknownAge := closeChannel(ChannelCloseSummary{
+		CloseType: CooperativeClose,
+	}, time.Time{})
+
+	var expected []ArchivedChannel
+	for _, op := range []wire.OutPoint{resolved, abandoned} {
+		summary, err := db.FetchClosedChannel(&op)
+		if err != nil {
+			t.Fatalf("unable to fetch closed channel: %v", err)
+		}
+		expected = append(expected, ArchivedChannel{
+			Summary:   summary,
+			OpenTime:  openTime,
+			CloseTime: oldClose,
+		})
+	}
+
+	_, err = db.ArchiveOldClosedChannels(-1, now, &bytes.Buffer{})
+	if err != ErrInvalidArchiveAge {
+		t.Fatalf("expected ErrInvalidArchiveAge, got %v", err)
+	}
+
+	var archive bytes.Buffer
+	numArchived, err := db.ArchiveOldClosedChannels(
+		retention, now, &archive,
+	)
+	if err != nil {
+		t.Fatalf("unable to archive closed channels: %v", err)
+	}
+	if numArchived != uint64(len(expected)) {
+		t.Fatalf("expected %v archived channels, got %v",
+			len(expected), numArchived)
+	}
+
+	channels, err := ReadClosedChannelArchive(&archive)
+	if err != nil {
+		t.Fatalf("unable to read archive: %v", err)
+	}
+	if len(channels) != len(expected) {
+		t.Fatalf("expected %v channels within archive, got %v",
+			len(expected), len(channels))
+	}
+	for _, channel := range channels {
+		var match *ArchivedChannel
+		for i := range expected {
+			chanPoint := expected[i].Summary.ChanPoint
+			if channel.Summary.ChanPoint == chanPoint {
+				match = &expected[i]
+			}
+		}
+		if match == nil || !reflect.DeepEqual(channel, *match) {
+			t.Fatalf("unexpected archived channel %v",
+				spew.Sdump(channel))
+		}
+	}
+
+	// The archived channels are removed, while the others remain.
+	for _, op := range []wire.OutPoint{resolved, abandoned} {
+		_, err := db.FetchClosedChannel(&op)
+		if err != ErrClosedChannelNotFound {
+			t.Fatalf("expected ErrClosedChannelNotFound, got %v",
+				err)
+		}
+	}
+	remaining := []wire.OutPoint{
+		pending, unswept, sweeping, recent, unknownAge,
+	}
+	for _, op := range remaining {
+		if _, err := db.FetchClosedChannel(&op); err != nil {
+			t.Fatalf("unable to fetch closed channel: %v", err)
+		}
+	}
+	err = db.View(func(tx *bbolt.Tx) error {
+		for _, op := range []wire.OutPoint{resolved, abandoned} {
+			key := canonicalChannelKey(op)
+			if tx.Bucket(closedChanLifetimeBucket).Get(key) != nil {
+				t.Fatalf("expected lifetime to be removed")
+			}
+		}
+		if tx.Bucket(abandonedChannelBucket).Get(
+			canonicalChannelKey(abandoned),
+		) != nil {
+			t.Fatalf("expected abandonment info to be removed")
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to check removed state: %v", err)
+	}
+
+	// Archiving again leaves an empty archive.
+	archive.Reset()
+	numArchived, err = db.ArchiveOldClosedChannels(retention, now, &archive)
+	if err != nil {
+		t.Fatalf("unable to archive closed channels: %v", err)
+	}
+	if numArchived != 0 {
+		t.Fatalf("expected no archived channels, got %v", numArchived)
+	}
+	channels, err = ReadClosedChannelArchive(&archive)
+	if err != nil {
+		t.Fatalf("unable to read archive: %v", err)
+	}
+	if len(channels) != 0 {
+		t.Fatalf("expected empty archive, got %v channels",
+			len(channels))
+	}
+}
@@ -0,0 +1,532 @@
+package channeldb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+const (
+	// compactTxMaxSize is the max number of key and value bytes copied
+	// within a single transaction while compacting, which bounds the
+	// memory used to compact large databases.
+	compactTxMaxSize = 64 * 1024 * 1024
+
+	// compactFileSuffix is appended to the name of the database file to
+	// obtain the name of the file the database is compacted into before
+	// it replaces the database.
+	compactFileSuffix = ".compact"
+
+	// compactBackupSuffix is appended to the name of the database file to
+	// obtain the name of the link to the original database that's kept
+	// while it's replaced, such that it can be restored should the
+	// compacted copy fail to open.
+	compactBackupSuffix = ".backup"
+
+	// defaultCompactionCheckInterval is the interval at which the
+	// compaction scheduler evaluates its policy, unless the policy
+	// specifies one.
+	defaultCompactionCheckInterval = 10 * time.Minute
+)
+
+var (
+	// compactionBucket is the top-level bucket that stores the state of
+	// the compaction scheduler.
+	compactionBucket = []byte("compaction")
+
+	// lastCompactionKey is the key within the compactionBucket that holds
+	// the time the database was last compacted by the scheduler.
+	lastCompactionKey = []byte("last-compaction")
+
+	// ErrInvalidCompactionPolicy is returned when enabling the compaction
+	// scheduler with a policy that can never trigger a compaction, or
+	// whose window doesn't lie within a day.
+	ErrInvalidCompactionPolicy = fmt.Errorf("invalid compaction policy")
+
+	// ErrCompactionReadOnly is returned when enabling the compaction
+	// scheduler for a database that was opened read-only.
+	ErrCompactionReadOnly = fmt.Errorf("cannot compact read-only database")
+
+	// ErrCompactionSchedulerActive is returned when enabling the
+	// compaction scheduler while it's already running.
+	ErrCompactionSchedulerActive = fmt.Errorf("compaction scheduler " +
+		"already active")
+)
+
+// CompactionPolicy determines when the compaction scheduler compacts the
+// database.
+type CompactionPolicy struct {
+	// FragmentationThreshold is the ratio of free to used pages, as
+	// reported by Fragmentation, above which the database is compacted.
+	FragmentationThreshold float64
+
+	// MinInterval is the min time between two compactions. It's enforced
+	// across restarts.
+	MinInterval time.Duration
+
+	// WindowStart and WindowEnd are the offsets from local midnight that
+	// delimit the time of day during which compactions may run, such as
+	// the hours during which the node sees the least activity. A window
+	// that ends before it starts wraps past midnight. If both are equal,
+	// compactions may run at any time of day.
+	WindowStart time.Duration
+	WindowEnd   time.Duration
+
+	// CheckInterval is the interval at which the scheduler evaluates the
+	// policy. It defaults to ten minutes if unset.
+	CheckInterval time.Duration
+}
+
+// validate ensures that the policy can trigger a compaction.
+func (p *CompactionPolicy) validate() error {
+	const day = 24 * time.Hour
+
+	switch {
+	case p.FragmentationThreshold <= 0:
+		return ErrInvalidCompactionPolicy
+	case p.MinInterval < 0 || p.CheckInterval < 0:
+		return ErrInvalidCompactionPolicy
+	case p.WindowStart < 0 || p.WindowStart >= day:
+		return ErrInvalidCompactionPolicy
+	case p.WindowEnd < 0 || p.WindowEnd >= day:
+		return ErrInvalidCompactionPolicy
+	}
+
+	return nil
+}
+
+// inWindow returns whether the passed time lies within the time of day during
+// which compactions may run.
+func (p *CompactionPolicy) inWindow(t time.Time) bool {
+	if p.WindowStart == p.WindowEnd {
+		return true
+	}
+
+	year, month, day := t.Date()
+	offset := t.Sub(time.Date(year, month, day, 0, 0, 0, 0, t.Location()))
+
+	if p.WindowStart < p.WindowEnd {
+		return offset >= p.WindowStart && offset < p.WindowEnd
+	}
+	return offset >= p.WindowStart || offset < p.WindowEnd
+}
+
+// compactionScheduler is the state of the compaction scheduler.
+type compactionScheduler struct {
+	policy CompactionPolicy
+	quit   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// EnableCompactionScheduler starts compacting the database automatically,
+// whenever its fragmentation exceeds the threshold of the passed policy
+// during the policy's window, and the min interval since the last compaction
+// has passed. A compaction waits for all transactions in flight to complete,
+// and blocks new ones until the compacted database has replaced the original
+// one. The scheduler is stopped when the database is closed.
+//
+// NOTE: This method should be called at startup, before the database is used
+// concurrently. While the scheduler is active, the underlying bolt database
+// must only be accessed through View, Update and Batch, as it may be replaced
+// at any other time.
+func (d *DB) EnableCompactionScheduler(policy CompactionPolicy) error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+	if d.boltOptions.ReadOnly {
+		return ErrCompactionReadOnly
+	}
+	if d.compaction != nil {
+		return ErrCompactionSchedulerActive
+	}
+	if policy.CheckInterval == 0 {
+		policy.CheckInterval = defaultCompactionCheckInterval
+	}
+
+	d.compaction = &compactionScheduler{
+		policy: policy,
+		quit:   make(chan struct{}),
+	}
+
+	d.compaction.wg.Add(1)
+	go d.scheduleCompactions(d.compaction)
+
+	return nil
+}
+
+// Close stops the compaction scheduler if it's active, and closes the
+// database.
+func (d *DB) Close() error {
+	if d.compaction != nil {
+		close(d.compaction.quit)
+		d.compaction.wg.Wait()
+		d.compaction = nil
+	}
+
+	return d.bdb.Close()
+}
+
+// View executes fn within a read-only transaction. It's blocked while the
+// database is being replaced by its compacted copy.
+func (d *DB) View(fn func(tx *bbolt.Tx) error) error {
+	d.compactMtx.RLock()
+	defer d.compactMtx.RUnlock()
+
+	if d.reopenErr != nil {
+		return d.reopenErr
+	}
+
+	return d.bdb.View(fn)
+}
+
+// CompactTo writes a compacted copy of the database to a new file at dstPath,
+// which must not exist yet. The copy holds the same buckets, keys and
+// sequences as the database, but packs them into as few pages as possible,
+// leaving out the free pages the database accumulated over time.
+func (d *DB) CompactTo(dstPath string) error {
+	d.compactMtx.RLock()
+	defer d.compactMtx.RUnlock()
+
+	if d.reopenErr != nil {
+		return d.reopenErr
+	}
+
+	return d.compactTo(dstPath)
+}
+
+// scheduleCompactions evaluates the policy of the scheduler at each check
+// interval, until the scheduler is stopped.
+func (d *DB) scheduleCompactions(s *compactionScheduler) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.policy.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.quit:
+			return
+		}
+
+		_, err := d.maybeCompact(&s.policy, time.Now())
+		if err != nil {
+			log.Errorf("Unable to compact database: %v", err)
+		}
+	}
+}
+
+// maybeCompact compacts the database if the passed policy allows it at the
+// given time, returning whether it did.
+func (d *DB) maybeCompact(policy *CompactionPolicy, now time.Time) (bool,
+	error) {
+
+	if !policy.inWindow(now) {
+		return false, nil
+	}
+
+	lastCompaction, err := d.lastCompaction()
+	if err != nil {
+		return false, err
+	}
+	if !lastCompaction.IsZero() &&
+		now.Sub(lastCompaction) < policy.MinInterval {
+
+		return false, nil
+	}
+
+	report, err := d.Fragmentation()
+	if err != nil {
+		return false, err
+	}
+	if report.Fragmentation < policy.FragmentationThreshold {
+		return false, nil
+	}
+
+	log.Infof("Compacting database with fragmentation of %.2f",
+		report.Fragmentation)
+
+	if err := d.compact(now); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// compact replaces the database file with a compacted copy of it, and records
+// the passed time as the time of the last compaction. All transactions are
+// blocked until the compacted database is opened in place of the original.
+// Should the compacted copy fail to open, the original is restored and opened
+// instead. Only if that fails as well is the database left closed, failing
+// all subsequent transactions.
+func (d *DB) compact(now time.Time) error {
+	d.compactMtx.Lock()
+	defer d.compactMtx.Unlock()
+
+	if d.reopenErr != nil {
+		return d.reopenErr
+	}
+
+	path := d.bdb.Path()
+	compactPath := path + compactFileSuffix
+	backupPath := path + compactBackupSuffix
+
+	// A copy or backup left behind by an interrupted compaction is stale,
+	// as the database file is only ever replaced atomically.
+	for _, stalePath := range []string{compactPath, backupPath} {
+		err := os.Remove(stalePath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	start := time.Now()
+	sizeBefore, err := fileSize(path)
+	if err != nil {
+		return err
+	}
+	if err := d.compactTo(compactPath); err != nil {
+		os.Remove(compactPath)
+		return err
+	}
+
+	// Before the copy replaces the database, we'll link the original, such
+	// that it can be restored should the copy fail to open.
+	if err := os.Link(path, backupPath); err != nil {
+		os.Remove(compactPath)
+		return err
+	}
+	defer os.Remove(backupPath)
+
+	// With the copy complete, we'll swap it in place of the database. If
+	// that fails, we'll reopen the original database instead.
+	if err := d.bdb.Close(); err != nil {
+		os.Remove(compactPath)
+		return err
+	}
+	swapErr := os.Rename(compactPath, path)
+	if swapErr != nil {
+		os.Remove(compactPath)
+	}
+
+	err = d.reopen(path)
+	if err != nil && swapErr == nil {
+		swapErr = fmt.Errorf("unable to open compacted database: %v",
+			err)
+		log.Errorf("Restoring original database: %v", swapErr)
+
+		err = os.Rename(backupPath, path)
+		if err == nil {
+			err = d.reopen(path)
+		}
+	}
+	if err != nil {
+		d.reopenErr = fmt.Errorf("unable to reopen database after "+
+			"compaction: %v", err)
+		return d.reopenErr
+	}
+
+	if swapErr != nil {
+		return swapErr
+	}
+
+	sizeAfter, err := fileSize(path)
+	if err != nil {
+		return err
+	}
+	var reclaimed int64
+	if sizeAfter < sizeBefore {
+		reclaimed = sizeBefore - sizeAfter
+	}
+	log.Infof("Compacted database from %v to %v bytes in %v, "+
+		"reclaiming %v bytes", sizeBefore, sizeAfter,
+		time.Since(start), reclaimed)
+
+	return d.bdb.Update(func(tx *bbolt.Tx) error {
+		if err := bumpDBSequence(tx); err != nil {
+			return err
+		}
+
+		compaction, err := tx.CreateBucketIfNotExists(compactionBucket)
+		if err != nil {
+			return err
+		}
+
+		var v [8]byte
+		byteOrder.PutUint64(v[:], uint64(now.UnixNano()))
+		return compaction.Put(lastCompactionKey, v[:])
+	})
+}
+
+// reopen opens the bolt database at path with the options the database was
+// originally opened with, in place of the closed one. The caller must hold the
+// compactMtx exclusively.
+func (d *DB) reopen(path string) error {
+	bdb, err := bbolt.Open(path, dbFilePermission, d.boltOptions)
+	if err != nil {
+		return err
+	}
+	bdb.NoSync = d.noSync
+	d.bdb = bdb
+
+	return nil
+}
+
+// lastCompaction returns the time the database was last compacted by the
+// scheduler, or the zero time if it never was.
+func (d *DB) lastCompaction() (time.Time, error) {
+	var lastCompaction time.Time
+	err := d.View(func(tx *bbolt.Tx) error {
+		compaction := tx.Bucket(compactionBucket)
+		if compaction == nil {
+			return nil
+		}
+
+		v := compaction.Get(lastCompactionKey)
+		if len(v) != 8 {
+			return nil
+		}
+		lastCompaction = time.Unix(0, int64(byteOrder.Uint64(v)))
+
+		return nil
+	})
+
+	return lastCompaction, err
+}
+
+// compactTo copies the database into a new file at dstPath. The caller must
+// ensure the database isn't replaced while it's being copied.
+func (d *DB) compactTo(dstPath string) error {
+	if fileExists(dstPath) {
+		return fmt.Errorf("compaction destination %v already exists",
+			dstPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0700); err != nil {
+		return err
+	}
+
+	dst, err := bbolt.Open(dstPath, dbFilePermission, nil)
+	if err != nil {
+		return err
+	}
+
+	err = d.bdb.View(func(src *bbolt.Tx) error {
+		return copyBuckets(dst, src)
+	})
+	if err != nil {
+		dst.Close()
+		return err
+	}
+
+	return dst.Close()
+}
+
+// copyBuckets copies all buckets of the source transaction into the
+// destination database. The copy is committed in chunks of at most
+// compactTxMaxSize bytes.
+func copyBuckets(dst *bbolt.DB, src *bbolt.Tx) error {
+	tx, err := dst.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	var size int
+	err = walkBuckets(src, func(path [][]byte, k, v []byte,
+		seq uint64) error {
+
+		if size+len(k)+len(v) > compactTxMaxSize {
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+			tx, err = dst.Begin(true)
+			if err != nil {
+				return err
+			}
+			size = 0
+		}
+		size += len(k) + len(v)
+
+		if len(path) == 0 {
+			b, err := tx.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+			return b.SetSequence(seq)
+		}
+
+		parent := tx.Bucket(path[0])
+		for _, name := range path[1:] {
+			parent = parent.Bucket(name)
+		}
+
+		// Keys are copied in order, such that pages can be filled
+		// completely.
+		parent.FillPercent = 1.0
+
+		if v == nil {
+			b, err := parent.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+			return b.SetSequence(seq)
+		}
+
+		return parent.Put(k, v)
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// walkBuckets calls cb for each bucket and key within the transaction, in
+// depth-first order. The path passed to cb holds the names of the buckets
+// enclosing the key. For buckets, the value is nil, and seq is the sequence of
+// the bucket.
+func walkBuckets(tx *bbolt.Tx, cb func(path [][]byte, k, v []byte,
+	seq uint64) error) error {
+
+	return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+		return walkBucket(b, nil, name, cb)
+	})
+}
+
+// walkBucket calls cb for the bucket with the passed name and path, followed
+// by all of its keys and nested buckets.
+func walkBucket(b *bbolt.Bucket, path [][]byte, name []byte,
+	cb func(path [][]byte, k, v []byte, seq uint64) error) error {
+
+	if err := cb(path, name, nil, b.Sequence()); err != nil {
+		return err
+	}
+
+	bucketPath := make([][]byte, len(path), len(path)+1)
+	copy(bucketPath, path)
+	bucketPath = append(bucketPath, name)
+
+	return b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return walkBucket(b.Bucket(k), bucketPath, k, cb)
+		}
+
+		return cb(bucketPath, k, v, 0)
+	})
+}
+
+// fileSize returns the size of the file at the passed path.
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
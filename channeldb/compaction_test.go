@@ -0,0 +1,253 @@
+package channeldb
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+// TestCompactionPolicyWindow asserts that the window of a compaction policy
+// is evaluated relative to local midnight, including windows that wrap past
+// midnight.
+func TestCompactionPolicyWindow(t *testing.T) {
+	t.Parallel()
+
+	at := func(hour int) time.Time {
+		return time.Date(2020, 1, 1, hour, 30, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name     string
+		start    time.Duration
+		end      time.Duration
+		expected map[int]bool
+	}{
+		{
+			name: "any time",
+			expected: map[int]bool{
+				0: true, 12: true, 23: true,
+			},
+		},
+		{
+			name:  "within day",
+			start: 2 * time.Hour,
+			end:   4 * time.Hour,
+			expected: map[int]bool{
+				1: false, 2: true, 3: true, 4: false,
+			},
+		},
+		{
+			name:  "past midnight",
+			start: 22 * time.Hour,
+			end:   2 * time.Hour,
+			expected: map[int]bool{
+				21: false, 22: true, 0: true, 1: true, 2: false,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		policy := CompactionPolicy{
+			FragmentationThreshold: 1,
+			WindowStart:            test.start,
+			WindowEnd:              test.end,
+		}
+		if err := policy.validate(); err != nil {
+			t.Fatalf("%v: invalid policy: %v", test.name, err)
+		}
+
+		for hour, expected := range test.expected {
+			if policy.inWindow(at(hour)) != expected {
+				t.Fatalf("%v: expected window at hour %v to "+
+					"be %v", test.name, hour, expected)
+			}
+		}
+	}
+
+	invalid := []CompactionPolicy{
+		{},
+		{FragmentationThreshold: 1, MinInterval: -1},
+		{FragmentationThreshold: 1, WindowEnd: 24 * time.Hour},
+	}
+	for _, policy := range invalid {
+		if err := policy.validate(); err != ErrInvalidCompactionPolicy {
+			t.Fatalf("expected ErrInvalidCompactionPolicy for %v, "+
+				"got %v", policy, err)
+		}
+	}
+}
+
+// TestMaybeCompact asserts that a fragmented database is compacted in place
+// once the policy allows it, without losing any of its contents.
+func TestMaybeCompact(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	var (
+		keptBucket  = []byte("kept")
+		dropBucket  = []byte("dropped")
+		keptKey     = []byte("key")
+		keptValue   = []byte("value")
+		keptSeq     = uint64(42)
+		largeValue  = bytes.Repeat([]byte{1}, 1024)
+		numDropKeys = 2000
+	)
+
+	// We'll fragment the database by filling a bucket with values, and
+	// deleting it again.
+	err = db.Update(func(tx *bbolt.Tx) error {
+		kept, err := tx.CreateBucket(keptBucket)
+		if err != nil {
+			return err
+		}
+		if err := kept.SetSequence(keptSeq); err != nil {
+			return err
+		}
+		nested, err := kept.CreateBucket(keptKey)
+		if err != nil {
+			return err
+		}
+		if err := nested.Put(keptKey, keptValue); err != nil {
+			return err
+		}
+
+		dropped, err := tx.CreateBucket(dropBucket)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < numDropKeys; i++ {
+			var k [8]byte
+			byteOrder.PutUint64(k[:], uint64(i))
+			if err := dropped.Put(k[:], largeValue); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to fill database: %v", err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return tx.DeleteBucket(dropBucket)
+	})
+	if err != nil {
+		t.Fatalf("unable to delete bucket: %v", err)
+	}
+
+	sizeBefore, err := fileSize(db.bdb.Path())
+	if err != nil {
+		t.Fatalf("unable to fetch file size: %v", err)
+	}
+
+	policy := &CompactionPolicy{
+		FragmentationThreshold: 1,
+		MinInterval:            time.Hour,
+		WindowStart:            2 * time.Hour,
+		WindowEnd:              4 * time.Hour,
+	}
+	outsideWindow := time.Date(2020, 1, 1, 12, 0, 0, 0, time.Local)
+	withinWindow := time.Date(2020, 1, 1, 3, 0, 0, 0, time.Local)
+
+	assertCompacted := func(now time.Time, expected bool) {
+		t.Helper()
+
+		compacted, err := db.maybeCompact(policy, now)
+		if err != nil {
+			t.Fatalf("unable to compact: %v", err)
+		}
+		if compacted != expected {
+			t.Fatalf("expected compacted to be %v", expected)
+		}
+	}
+
+	assertCompacted(outsideWindow, false)
+	assertCompacted(withinWindow, true)
+
+	sizeAfter, err := fileSize(db.bdb.Path())
+	if err != nil {
+		t.Fatalf("unable to fetch file size: %v", err)
+	}
+	if sizeAfter >= sizeBefore {
+		t.Fatalf("expected compaction to shrink database of %v "+
+			"bytes, got %v bytes", sizeBefore, sizeAfter)
+	}
+	if _, err := os.Stat(db.bdb.Path() + compactFileSuffix); err == nil {
+		t.Fatalf("expected compacted copy to be swapped in")
+	}
+
+	// The compacted database must hold the same contents, and accept
+	// writes.
+	err = db.Update(func(tx *bbolt.Tx) error {
+		kept := tx.Bucket(keptBucket)
+		if kept == nil {
+			t.Fatalf("kept bucket not found")
+		}
+		if kept.Sequence() != keptSeq {
+			t.Fatalf("expected sequence %v, got %v", keptSeq,
+				kept.Sequence())
+		}
+		value := kept.Bucket(keptKey).Get(keptKey)
+		if !bytes.Equal(value, keptValue) {
+			t.Fatalf("expected value %x, got %x", keptValue, value)
+		}
+
+		return kept.Put(keptKey[1:], keptValue)
+	})
+	if err != nil {
+		t.Fatalf("unable to update compacted database: %v", err)
+	}
+	if _, err := db.FetchMeta(nil); err != nil {
+		t.Fatalf("unable to fetch meta: %v", err)
+	}
+
+	// Before the min interval passed, the database isn't compacted again,
+	// even if it's still fragmented enough.
+	policy.FragmentationThreshold = 1e-9
+	assertCompacted(withinWindow.Add(time.Minute), false)
+	assertCompacted(withinWindow.Add(time.Hour), true)
+}
+
+// TestCompactionScheduler asserts that the scheduler can't be enabled with an
+// invalid policy or twice, and that it's stopped when the database is closed.
+func TestCompactionScheduler(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	err = db.EnableCompactionScheduler(CompactionPolicy{})
+	if err != ErrInvalidCompactionPolicy {
+		t.Fatalf("expected ErrInvalidCompactionPolicy, got %v", err)
+	}
+
+	policy := CompactionPolicy{
+		FragmentationThreshold: 1,
+		CheckInterval:          time.Millisecond,
+	}
+	if err := db.EnableCompactionScheduler(policy); err != nil {
+		t.Fatalf("unable to enable scheduler: %v", err)
+	}
+	err = db.EnableCompactionScheduler(policy)
+	if err != ErrCompactionSchedulerActive {
+		t.Fatalf("expected ErrCompactionSchedulerActive, got %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("unable to close database: %v", err)
+	}
+	if db.compaction != nil {
+		t.Fatalf("expected scheduler to be stopped")
+	}
+}
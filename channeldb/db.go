@@ -11,7 +11,10 @@ import (
 	"time"
 
 	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+	"github.com/btcsuite/btcutil"
 	"github.com/coreos/bbolt"
 	"github.com/go-errors/errors"
 	"github.com/lightningnetwork/lnd/lnwire"
@@ -24,12 +27,26 @@ const (
 
 // migration is a function which takes a prior outdated version of the database
 // instances and mutates the key/bucket structure to arrive at a more
-// up-to-date version of the database.
-type migration func(tx *bbolt.Tx) error
+// up-to-date version of the database. All messages should be logged through
+// the passed logger, which annotates them with the migration being applied.
+type migration func(tx *bbolt.Tx, log btclog.Logger) error
+
+// batchMigration is a migration that rewrites a potentially large number of
+// records, and is therefore applied in batches, each committed within its own
+// transaction. A single invocation migrates at most batchSize records,
+// recording its progress within the passed checkpoint bucket, such that an
+// interrupted migration resumes where it left off rather than starting over.
+// It returns true once all records have been migrated.
+type batchMigration func(tx *bbolt.Tx, checkpoint *bbolt.Bucket,
+	batchSize int, log btclog.Logger) (bool, error)
 
 type version struct {
 	number    uint32
 	migration migration
+
+	// batchMigration is set instead of migration for migrations that are
+	// applied in batches.
+	batchMigration batchMigration
 }
 
 var (
@@ -53,14 +70,14 @@ var (
 		{
 			// The DB version that added the invoice event time
 			// series.
-			number:    2,
-			migration: migrateInvoiceTimeSeries,
+			number:         2,
+			batchMigration: migrateInvoiceTimeSeries,
 		},
 		{
 			// The DB version that updated the embedded invoice in
 			// outgoing payments to match the new format.
-			number:    3,
-			migration: migrateInvoiceTimeSeriesOutgoingPayments,
+			number:         3,
+			batchMigration: migrateInvoiceTimeSeriesOutgoingPayments,
 		},
 		{
 			// The version of the database where every channel
@@ -97,6 +114,170 @@ var (
 			number:    8,
 			migration: migrateGossipMessageStoreKeys,
 		},
+		{
+			// The DB version where invoices, including the ones
+			// embedded within outgoing payments, are followed by
+			// a TLV stream of optional records.
+			number:         9,
+			batchMigration: migrateInvoiceTLVStream,
+		},
+		{
+			// The DB version where outgoing payments are followed
+			// by their own TLV stream, used to store the custom
+			// records sent along with the payment.
+			number:         10,
+			batchMigration: migrateOutgoingPaymentTLVStream,
+		},
+		{
+			// The DB version that reports graph records whose
+			// update time appears to have been stored in local
+			// time rather than UTC. No records are modified.
+			number:    11,
+			migration: migrateReportSkewedTimestamps,
+		},
+		{
+			// The DB version where channel close summaries carry
+			// a flag indicating whether our settled balance has
+			// been swept.
+			number:    12,
+			migration: migrateCloseSummarySweptFlag,
+		},
+		{
+			// The DB version where each open channel is assigned
+			// a UUID, and channels are indexed by their UUID.
+			number:    13,
+			migration: migrateChannelUUIDs,
+		},
+		{
+			// The DB version where invoices may carry the fiat
+			// amount and exchange rate they were priced at.
+			number:    14,
+			migration: migrateInvoiceFiatRecords,
+		},
+		{
+			// The DB version where the add time of each HTLC
+			// pending on a channel's commitments is recorded.
+			number:    15,
+			migration: migrateHtlcAddTimes,
+		},
+		{
+			// The DB version where each channel records the type
+			// of its commitments explicitly.
+			number:    16,
+			migration: migrateCommitmentTypes,
+		},
+		{
+			// The DB version where duplicate forwarding events
+			// written by an older build are removed.
+			number:    17,
+			migration: migrateDedupeForwardingEvents,
+		},
+		{
+			// The DB version where the preimages of settled
+			// invoices are moved out of their records into a
+			// bucket of their own.
+			number:         18,
+			batchMigration: migrateInvoicePreimages,
+		},
+		{
+			// The DB version where outgoing payments are indexed
+			// by the group they were sent as part of.
+			number:    19,
+			migration: migratePaymentGroupIndex,
+		},
+		{
+			// The DB version where every channel point is keyed
+			// with its txid in internal byte order.
+			number:    20,
+			migration: migrateCanonicalChannelKeys,
+		},
+		{
+			// The DB version where invoices record whether an
+			// HTLC paying to them has ever been seen.
+			number:         21,
+			batchMigration: migrateInvoiceHtlcAttempts,
+		},
+		{
+			// The DB version where nodes are indexed by the types
+			// of the addresses they advertise.
+			number:    22,
+			migration: migrateNodeAddrTypeIndex,
+		},
+		{
+			// The DB version where the direction flag of every
+			// edge policy agrees with the node it leads to.
+			number:    23,
+			migration: migrateEdgePolicyDirections,
+		},
+		{
+			// The DB version where the node identifier within each
+			// key of the node update index is length-prefixed.
+			number:    24,
+			migration: migrateNodeUpdateIndexKeys,
+		},
+		{
+			// The DB version where invoices may carry the routing
+			// hints of their payment request. Existing invoices
+			// carry none, so no migration is required.
+			number:    25,
+			migration: nil,
+		},
+		{
+			// The DB version where channels record the number of
+			// confirmations of their funding transaction.
+			number:    26,
+			migration: migrateChannelConfirmations,
+		},
+		{
+			// The DB version where outgoing payments may be
+			// marked as rebalances. None of the existing payments
+			// is known to be one, so no migration is required.
+			number:    27,
+			migration: nil,
+		},
+		{
+			// The DB version where rebalances may record the
+			// channels they were sent out and came back in
+			// through. Those of existing rebalances aren't known,
+			// so no migration is required.
+			number:    28,
+			migration: nil,
+		},
+		{
+			// The DB version where the forwarding log is indexed
+			// by channel, and channels record their open time.
+			number:    29,
+			migration: migrateChannelIdleIndex,
+		},
+		{
+			// The DB version where outgoing payments may record
+			// the channels their route traversed, and are indexed
+			// by them. Only the nodes of the path of existing
+			// payments were stored, so no migration is required.
+			number:    30,
+			migration: nil,
+		},
+		{
+			// The DB version where invoices may reference the
+			// offer they were issued for. Existing invoices
+			// weren't issued for any, so no migration is required.
+			number:    31,
+			migration: nil,
+		},
+		{
+			// The DB version where invoices may carry a payment
+			// address, and are indexed by it. The address of an
+			// existing invoice is only held by its payment
+			// request, so no migration is required.
+			number:    32,
+			migration: nil,
+		},
+		{
+			// The DB version where invoices may carry the fields
+			// of their payment request they don't otherwise hold.
+			number:         33,
+			batchMigration: migrateInvoicePaymentRequestFields,
+		},
 	}
 
 	// Big endian is the preferred byte order, due to cursor scans over
@@ -112,29 +293,113 @@ var bufPool = &sync.Pool{
 // information related to nodes, routing data, open/closed channels, fee
 // schedules, and reputation data.
 type DB struct {
-	*bbolt.DB
+	// bdb is the bolt database. It isn't embedded, as it's replaced by its
+	// compacted copy, so it must only be accessed while holding
+	// compactMtx.
+	bdb    *bbolt.DB
 	dbPath string
+
+	// updateIndexCache is an optional in-memory mirror of the graph's
+	// update indexes. It is nil unless enabled by EnableUpdateIndexCache.
+	updateIndexCache *updateIndexCache
+
+	// deadLetters queues failed non-critical writes for a later retry. It
+	// is nil unless enabled by EnableDeadLetterQueue.
+	deadLetters *deadLetterQueue
+
+	// replicationSink is an optional sink that receives the mutations
+	// committed to the database, such that they can be streamed to a
+	// standby. It is nil unless set by OptionSetReplicationSink.
+	replicationSink ReplicationSink
+
+	// replicationMtx serializes replicated updates, such that events are
+	// handed to the sink in the order of their sequence numbers. It's
+	// acquired before compactMtx.
+	replicationMtx sync.Mutex
+
+	// replicationBatch collects the calls to Batch that are yet to be
+	// executed while a replication sink is set, guarded by
+	// replicationBatchMtx.
+	replicationBatch    *replicationBatch
+	replicationBatchMtx sync.Mutex
+
+	// chanStateSubs holds the active subscriptions to the channel state
+	// log.
+	chanStateSubs channelStateSubscribers
+
+	// revocationLogLimit is the max number of revoked states retained per
+	// channel, or zero if all are retained.
+	revocationLogLimit int
+
+	// boltOptions and noSync are the options the bolt database was opened
+	// with, such that it can be reopened with the same options once it's
+	// been compacted.
+	boltOptions *bbolt.Options
+	noSync      bool
+
+	// compactMtx is held shared by every transaction, and exclusively
+	// while the database is replaced by its compacted copy.
+	compactMtx sync.RWMutex
+
+	// reopenErr is set if the database couldn't be reopened after it was
+	// closed to be replaced by its compacted copy. It's returned by every
+	// subsequent transaction in place of using the closed database.
+	reopenErr error
+
+	// compaction is the state of the compaction scheduler. It is nil
+	// unless enabled by EnableCompactionScheduler.
+	compaction *compactionScheduler
 }
 
 // Open opens an existing channeldb. Any necessary schemas migrations due to
-// updates will take place as necessary.
-func Open(dbPath string) (*DB, error) {
+// updates will take place as necessary. The passed modifiers are applied to
+// the default options of the database.
+func Open(dbPath string, modifiers ...OptionModifier) (*DB, error) {
+	opts := DefaultOptions()
+	for _, modifier := range modifiers {
+		modifier(&opts)
+	}
+
+	switch opts.SyncMode {
+	case FullSync, NoSync, NoFreelistSync:
+	default:
+		return nil, fmt.Errorf("unknown sync mode: %v", opts.SyncMode)
+	}
+
 	path := filepath.Join(dbPath, dbName)
 
-	if !fileExists(path) {
+	// A database that's opened read-only must already exist, as we won't
+	// create it.
+	if !opts.ReadOnly && !fileExists(path) {
 		if err := createChannelDB(dbPath); err != nil {
 			return nil, err
 		}
 	}
 
-	bdb, err := bbolt.Open(path, dbFilePermission, nil)
+	boltOptions := &bbolt.Options{
+		NoFreelistSync: opts.SyncMode == NoFreelistSync,
+		ReadOnly:       opts.ReadOnly,
+	}
+
+	bdb, err := bbolt.Open(path, dbFilePermission, boltOptions)
 	if err != nil {
 		return nil, err
 	}
+	bdb.NoSync = opts.SyncMode == NoSync
 
 	chanDB := &DB{
-		DB:     bdb,
-		dbPath: dbPath,
+		bdb:                bdb,
+		dbPath:             dbPath,
+		replicationSink:    opts.ReplicationSink,
+		revocationLogLimit: opts.RevocationLogLimit,
+		boltOptions:        boltOptions,
+		noSync:             bdb.NoSync,
+	}
+
+	// A read-only database is left exactly as we found it, with any
+	// pending migrations and journals left for the next regular open.
+	if opts.ReadOnly {
+		return chanDB, nil
 	}
 
 	// Synchronize the version of database and apply migrations if needed.
@@ -143,6 +408,21 @@ func Open(dbPath string) (*DB, error) {
 		return nil, err
 	}
 
+	// Now that the database is at our version, we'll prevent binaries that
+	// don't support it from opening the database going forward.
+	err = chanDB.raiseMinCompatibleVersion(minCompatibleVersion)
+	if err != nil {
+		bdb.Close()
+		return nil, err
+	}
+
+	// Complete any journaled operations that were interrupted before
+	// their steps were committed.
+	if err := chanDB.RecoverJournal(); err != nil {
+		bdb.Close()
+		return nil, err
+	}
+
 	return chanDB, nil
 }
 
@@ -155,7 +435,9 @@ func (d *DB) Path() string {
 // database. The deletion is done in a single transaction, therefore this
 // operation is fully atomic.
 func (d *DB) Wipe() error {
-	return d.Update(func(tx *bbolt.Tx) error {
+	return d.updateGraph(func(tx *bbolt.Tx) error {
+		d.updateIndexCache.stageReset()
+
 		err := tx.DeleteBucket(openChannelBucket)
 		if err != nil && err != bbolt.ErrBucketNotFound {
 			return err
@@ -166,11 +448,36 @@ func (d *DB) Wipe() error {
 			return err
 		}
 
+		err = tx.DeleteBucket(closedChanLifetimeBucket)
+		if err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+
+		err = tx.DeleteBucket(abandonedChannelBucket)
+		if err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+
 		err = tx.DeleteBucket(invoiceBucket)
 		if err != nil && err != bbolt.ErrBucketNotFound {
 			return err
 		}
 
+		err = tx.DeleteBucket(preimageBucket)
+		if err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+
+		err = tx.DeleteBucket(offerInvoiceIndexBucket)
+		if err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+
+		err = tx.DeleteBucket(paymentAddrIndexBucket)
+		if err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+
 		err = tx.DeleteBucket(nodeInfoBucket)
 		if err != nil && err != bbolt.ErrBucketNotFound {
 			return err
@@ -283,7 +590,8 @@ func createChannelDB(dbPath string) error {
 		}
 
 		meta := &Meta{
-			DbVersionNumber: getLatestDBVersion(dbVersions),
+			DbVersionNumber:      getLatestDBVersion(dbVersions),
+			MinCompatibleVersion: minCompatibleVersion,
 		}
 		return putMeta(meta, tx)
 	})
@@ -421,13 +729,9 @@ func (d *DB) fetchNodeChannels(chainBucket *bbolt.Bucket) ([]*OpenChannel, error
 func (d *DB) FetchChannel(chanPoint wire.OutPoint) (*OpenChannel, error) {
 	var (
 		targetChan      *OpenChannel
-		targetChanPoint bytes.Buffer
+		targetChanPoint = canonicalChannelKey(chanPoint)
 	)
 
-	if err := writeOutpoint(&targetChanPoint, &chanPoint); err != nil {
-		return nil, err
-	}
-
 	// chanScan will traverse the following bucket structure:
 	//  * nodePub => chainHash => chanPoint
 	//
@@ -477,7 +781,7 @@ func (d *DB) FetchChannel(chanPoint wire.OutPoint) (*OpenChannel, error) {
 				// Finally we reach the leaf bucket that stores
 				// all the chanPoints for this node.
 				chanBucket := chainBucket.Bucket(
-					targetChanPoint.Bytes(),
+					targetChanPoint,
 				)
 				if chanBucket == nil {
 					return nil
@@ -554,6 +858,117 @@ func (d *DB) FetchPendingChannels() ([]*OpenChannel, error) {
 	return fetchChannels(d, true, false)
 }
 
+// PendingChannelCount returns the number of channels that would be returned by
+// FetchPendingChannels. Only the channel's status flags are decoded, making
+// this considerably cheaper than fetching the channels themselves.
+func (d *DB) PendingChannelCount() (int, error) {
+	var numPending int
+	err := d.View(func(tx *bbolt.Tx) error {
+		numPending = 0
+		countChannel := func(wire.OutPoint) error {
+			numPending++
+			return nil
+		}
+
+		return forEachPendingChannelPoint(tx, countChannel)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return numPending, nil
+}
+
+// PendingChannelPoints returns the funding outpoints of all channels that
+// would be returned by FetchPendingChannels. Only the channel's status flags
+// and channel point are decoded.
+func (d *DB) PendingChannelPoints() ([]wire.OutPoint, error) {
+	var chanPoints []wire.OutPoint
+	err := d.View(func(tx *bbolt.Tx) error {
+		chanPoints = nil
+		addChanPoint := func(op wire.OutPoint) error {
+			chanPoints = append(chanPoints, op)
+			return nil
+		}
+
+		return forEachPendingChannelPoint(tx, addChanPoint)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return chanPoints, nil
+}
+
+// forEachPendingChannelPoint invokes cb with the funding outpoint of each
+// channel whose funding transaction hasn't yet confirmed, and which isn't
+// waiting to be closed. To determine this, only the fixed-size fields at the
+// start of the channel's info are read.
+func forEachPendingChannelPoint(tx *bbolt.Tx,
+	cb func(wire.OutPoint) error) error {
+
+	openChanBucket := tx.Bucket(openChannelBucket)
+	if openChanBucket == nil {
+		return nil
+	}
+
+	return openChanBucket.ForEach(func(nodePub, v []byte) error {
+		if v != nil {
+			return nil
+		}
+		nodeChanBucket := openChanBucket.Bucket(nodePub)
+
+		return nodeChanBucket.ForEach(func(chainHash, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			chainBucket := nodeChanBucket.Bucket(chainHash)
+
+			return chainBucket.ForEach(func(chanPoint, v []byte) error {
+				if v != nil {
+					return nil
+				}
+				chanBucket := chainBucket.Bucket(chanPoint)
+
+				infoBytes := chanBucket.Get(chanInfoKey)
+				if infoBytes == nil {
+					return ErrNoChanInfoFound
+				}
+
+				var (
+					chanType    ChannelType
+					chanHash    chainhash.Hash
+					outPoint    wire.OutPoint
+					shortChanID lnwire.ShortChannelID
+					isPending   bool
+					isInitiator bool
+					chanStatus  ChannelStatus
+				)
+				err := ReadElements(bytes.NewReader(infoBytes),
+					&chanType, &chanHash, &outPoint,
+					&shortChanID, &isPending, &isInitiator,
+					&chanStatus,
+				)
+				if err != nil {
+					return fmt.Errorf("unable to read "+
+						"channel info for "+
+						"node_key=%x: %v", nodePub, err)
+				}
+
+				// Channels that are waiting to be closed have
+				// a non-default status.
+				if !isPending ||
+					chanStatus != ChanStatusDefault {
+
+					return nil
+				}
+
+				return cb(outPoint)
+			})
+		})
+	})
+}
+
 // FetchWaitingCloseChannels will return all channels that have been opened,
 // but are now waiting for a closing transaction to be confirmed.
 //
@@ -658,6 +1073,112 @@ func fetchChannels(d *DB, pending, waitingClose bool) ([]*OpenChannel, error) {
 	return channels, nil
 }
 
+// PeerChannelStats is an aggregate view of all the channels we currently have
+// with a single peer. It's meant to allow callers to quickly spot peers that
+// have opened an unusual number of very small channels with us.
+type PeerChannelStats struct {
+	// NumChannels is the total number of channels with the peer. This
+	// includes channels that are still pending confirmation.
+	NumChannels uint32
+
+	// NumPending is the number of channels with the peer whose funding
+	// transaction hasn't yet been confirmed.
+	NumPending uint32
+
+	// TotalCapacity is the sum of the capacity of all channels with the
+	// peer.
+	TotalCapacity btcutil.Amount
+
+	// AvgCapacity is the average capacity of the channels with the peer.
+	AvgCapacity btcutil.Amount
+}
+
+// PeerChannelSummary returns, for each peer we have at least one channel with,
+// the number of channels, their total capacity, as well as the average channel
+// size. Both open and pending channels are included. The summary is computed
+// within a single scan of the open channel bucket, and only the static channel
+// information is decoded for each channel.
+func (d *DB) PeerChannelSummary() (map[[33]byte]PeerChannelStats, error) {
+	summary := make(map[[33]byte]PeerChannelStats)
+
+	err := d.View(func(tx *bbolt.Tx) error {
+		openChanBucket := tx.Bucket(openChannelBucket)
+		if openChanBucket == nil {
+			return nil
+		}
+
+		return openChanBucket.ForEach(func(nodePub, v []byte) error {
+			// Only the sub-buckets keyed by a node's public key
+			// are of interest to us.
+			if v != nil || len(nodePub) != 33 {
+				return nil
+			}
+			nodeChanBucket := openChanBucket.Bucket(nodePub)
+			if nodeChanBucket == nil {
+				return nil
+			}
+
+			var peer [33]byte
+			copy(peer[:], nodePub)
+			stats := summary[peer]
+
+			err := nodeChanBucket.ForEach(func(chainHash, v []byte) error {
+				if v != nil {
+					return nil
+				}
+				chainBucket := nodeChanBucket.Bucket(chainHash)
+				if chainBucket == nil {
+					return fmt.Errorf("unable to read "+
+						"bucket for chain=%x", chainHash[:])
+				}
+
+				return chainBucket.ForEach(func(chanPoint, v []byte) error {
+					if v != nil {
+						return nil
+					}
+					chanBucket := chainBucket.Bucket(chanPoint)
+
+					var channel OpenChannel
+					err := fetchChanInfo(chanBucket, &channel)
+					if err != nil {
+						return fmt.Errorf("unable to read "+
+							"channel info for "+
+							"node_key=%x: %v", nodePub, err)
+					}
+
+					stats.NumChannels++
+					if channel.IsPending {
+						stats.NumPending++
+					}
+					stats.TotalCapacity += channel.Capacity
+
+					return nil
+				})
+			})
+			if err != nil {
+				return err
+			}
+
+			// Peers that only had an empty bucket lingering around
+			// aren't included within the summary.
+			if stats.NumChannels == 0 {
+				return nil
+			}
+
+			stats.AvgCapacity = stats.TotalCapacity /
+				btcutil.Amount(stats.NumChannels)
+			summary[peer] = stats
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
 // FetchClosedChannels attempts to fetch all closed channels from the database.
 // The pendingOnly bool toggles if channels that aren't yet fully closed should
 // be returned in the response or not. When a channel was cooperatively closed,
@@ -680,6 +1201,11 @@ func (d *DB) FetchClosedChannels(pendingOnly bool) ([]*ChannelCloseSummary, erro
 				return err
 			}
 
+			err = fetchAbandonmentInfo(tx, chanID, chanSummary)
+			if err != nil {
+				return err
+			}
+
 			// If the query specified to only include pending
 			// channels, then we'll skip any channels which aren't
 			// currently pending.
@@ -697,6 +1223,29 @@ func (d *DB) FetchClosedChannels(pendingOnly bool) ([]*ChannelCloseSummary, erro
 	return chanSummaries, nil
 }
 
+// FetchClosedChannelsByType returns the close summaries of all channels that
+// were closed with the given close type. This can be used to, for instance,
+// retrieve all abandoned channels along with their abandonment details.
+func (d *DB) FetchClosedChannelsByType(
+	closeType ClosureType) ([]*ChannelCloseSummary, error) {
+
+	chanSummaries, err := d.FetchClosedChannels(false)
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []*ChannelCloseSummary
+	for _, chanSummary := range chanSummaries {
+		if chanSummary.CloseType != closeType {
+			continue
+		}
+
+		filtered = append(filtered, chanSummary)
+	}
+
+	return filtered, nil
+}
+
 // ErrClosedChannelNotFound signals that a closed channel could not be found in
 // the channeldb.
 var ErrClosedChannelNotFound = errors.New("unable to find closed channel summary")
@@ -711,21 +1260,20 @@ func (d *DB) FetchClosedChannel(chanID *wire.OutPoint) (*ChannelCloseSummary, er
 			return ErrClosedChannelNotFound
 		}
 
-		var b bytes.Buffer
-		var err error
-		if err = writeOutpoint(&b, chanID); err != nil {
-			return err
-		}
-
-		summaryBytes := closeBucket.Get(b.Bytes())
+		chanKey := canonicalChannelKey(*chanID)
+		summaryBytes := closeBucket.Get(chanKey)
 		if summaryBytes == nil {
 			return ErrClosedChannelNotFound
 		}
 
+		var err error
 		summaryReader := bytes.NewReader(summaryBytes)
 		chanSummary, err = deserializeCloseChannelSummary(summaryReader)
+		if err != nil {
+			return err
+		}
 
-		return err
+		return fetchAbandonmentInfo(tx, chanKey, chanSummary)
 	}); err != nil {
 		return nil, err
 	}
@@ -771,7 +1319,7 @@ func (d *DB) FetchClosedChannelForID(cid lnwire.ChannelID) (
 				return err
 			}
 
-			return nil
+			return fetchAbandonmentInfo(tx, op, chanSummary)
 		}
 		return ErrClosedChannelNotFound
 	}); err != nil {
@@ -788,12 +1336,7 @@ func (d *DB) FetchClosedChannelForID(cid lnwire.ChannelID) (
 // swept.
 func (d *DB) MarkChanFullyClosed(chanPoint *wire.OutPoint) error {
 	return d.Update(func(tx *bbolt.Tx) error {
-		var b bytes.Buffer
-		if err := writeOutpoint(&b, chanPoint); err != nil {
-			return err
-		}
-
-		chanID := b.Bytes()
+		chanID := canonicalChannelKey(*chanPoint)
 
 		closedChanBucket, err := tx.CreateBucketIfNotExists(
 			closedChannelBucket,
@@ -829,6 +1372,11 @@ func (d *DB) MarkChanFullyClosed(chanPoint *wire.OutPoint) error {
 			return err
 		}
 
+		// A fully closed channel has nothing left to sweep.
+		if err := deleteSweepWorklist(tx, chanID); err != nil {
+			return err
+		}
+
 		// Now that the channel is closed, we'll check if we have any
 		// other open channels with this peer. If we don't we'll
 		// garbage collect it to ensure we don't establish persistent
@@ -837,6 +1385,62 @@ func (d *DB) MarkChanFullyClosed(chanPoint *wire.OutPoint) error {
 	})
 }
 
+// MarkSwept marks the output paying out our settled balance of the closed
+// channel with the given channel point as swept.
+func (d *DB) MarkSwept(op wire.OutPoint) error {
+	return d.Update(func(tx *bbolt.Tx) error {
+		chanID := canonicalChannelKey(op)
+
+		closedChanBucket := tx.Bucket(closedChannelBucket)
+		if closedChanBucket == nil {
+			return ErrClosedChannelNotFound
+		}
+
+		chanSummaryBytes := closedChanBucket.Get(chanID)
+		if chanSummaryBytes == nil {
+			return ErrClosedChannelNotFound
+		}
+
+		chanSummary, err := deserializeCloseChannelSummary(
+			bytes.NewReader(chanSummaryBytes),
+		)
+		if err != nil {
+			return err
+		}
+
+		chanSummary.Swept = true
+
+		var newSummary bytes.Buffer
+		err = serializeChannelCloseSummary(&newSummary, chanSummary)
+		if err != nil {
+			return err
+		}
+
+		return closedChanBucket.Put(chanID, newSummary.Bytes())
+	})
+}
+
+// UnsweptCoopCloses returns the close summaries of all cooperatively closed
+// channels that paid out a settled balance to us, which hasn't yet been marked
+// as swept using MarkSwept.
+func (d *DB) UnsweptCoopCloses() ([]*ChannelCloseSummary, error) {
+	coopCloses, err := d.FetchClosedChannelsByType(CooperativeClose)
+	if err != nil {
+		return nil, err
+	}
+
+	var unswept []*ChannelCloseSummary
+	for _, chanSummary := range coopCloses {
+		if chanSummary.Swept || chanSummary.SettledBalance == 0 {
+			continue
+		}
+
+		unswept = append(unswept, chanSummary)
+	}
+
+	return unswept, nil
+}
+
 // pruneLinkNode determines whether we should garbage collect a link node from
 // the database due to no longer having any open channels with it. If there are
 // any left, then this acts as a no-op.
@@ -899,7 +1503,7 @@ type ChannelShell struct {
 func (d *DB) RestoreChannelShells(channelShells ...*ChannelShell) error {
 	chanGraph := ChannelGraph{d}
 
-	return d.Update(func(tx *bbolt.Tx) error {
+	return d.updateGraph(func(tx *bbolt.Tx) error {
 		for _, channelShell := range channelShells {
 			channel := channelShell.Chan
 
@@ -973,7 +1577,9 @@ func (d *DB) RestoreChannelShells(channelShells ...*ChannelShell) error {
 				chanEdge.ChannelFlags |= lnwire.ChanUpdateDirection
 			}
 
-			err = updateEdgePolicy(tx, &chanEdge)
+			err = updateEdgePolicy(
+				tx, &chanEdge, d.updateIndexCache,
+			)
 			if err != nil {
 				return err
 			}
@@ -1039,7 +1645,15 @@ func (d *DB) AddrsForNode(nodePub *btcec.PublicKey) ([]net.Addr, error) {
 // syncVersions function is used for safe db version synchronization. It
 // applies migration functions to the current database and recovers the
 // previous state of db if at least one error/panic appeared during migration.
+// Batch migrations retain the batches committed before the failure, and are
+// resumed from their checkpoint instead.
 func (d *DB) syncVersions(versions []version) error {
+	return d.syncVersionsInBatches(versions, migrationBatchSize)
+}
+
+// syncVersionsInBatches is syncVersions with a custom number of records that
+// are migrated within each batch of a batch migration.
+func (d *DB) syncVersionsInBatches(versions []version, batchSize int) error {
 	meta, err := d.FetchMeta(nil)
 	if err != nil {
 		if err == ErrMetaNotFound {
@@ -1053,6 +1667,16 @@ func (d *DB) syncVersions(versions []version) error {
 	log.Infof("Checking for schema update: latest_version=%v, "+
 		"db_version=%v", latestVersion, meta.DbVersionNumber)
 
+	// Before touching the database, we'll make sure we're able to decode
+	// its records at all. If it was written by a binary requiring a newer
+	// version than we support, doing so could corrupt it.
+	if meta.MinCompatibleVersion > latestVersion {
+		log.Errorf("Refusing to open db requiring min_version=%d "+
+			"with latest supported version=%d, upgrade lnd to "+
+			"open it", meta.MinCompatibleVersion, latestVersion)
+		return ErrDBIncompatibleVersion
+	}
+
 	switch {
 
 	// If the database reports a higher version that we are aware of, the
@@ -1072,30 +1696,154 @@ func (d *DB) syncVersions(versions []version) error {
 
 	log.Infof("Performing database schema migration")
 
-	// Otherwise, we fetch the migrations which need to applied, and
-	// execute them serially within a single database transaction to ensure
-	// the migration is atomic.
-	migrations, migrationVersions := getMigrationsToApply(
-		versions, meta.DbVersionNumber,
+	// Otherwise, we fetch the migrations which need to be applied, and
+	// execute them serially. Regular migrations that directly follow each
+	// other are executed within a single database transaction to ensure
+	// they're applied atomically, while batch migrations commit each of
+	// their batches separately. In either case, the database version is
+	// bumped by the transaction that completes a migration, such that an
+	// interrupted migration is resumed on the next startup.
+	fromVersion := meta.DbVersionNumber
+	var pending []version
+	applyPending := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+
+		err := d.Update(func(tx *bbolt.Tx) error {
+			from := fromVersion
+			for _, v := range pending {
+				if v.migration == nil {
+					from = v.number
+					continue
+				}
+
+				migrationLog := newMigrationLogger(
+					log, v.migration, from, v.number,
+					d.dbPath,
+				)
+
+				migrationLog.Infof("Applying migration #%v",
+					v.number)
+
+				err := v.migration(tx, migrationLog)
+				if err != nil {
+					migrationLog.Errorf("Unable to apply "+
+						"migration #%v: %v", v.number,
+						err)
+					return err
+				}
+
+				from = v.number
+			}
+
+			// Migrations rewrite buckets directly, so the checksums
+			// of those buckets must be brought up to date.
+			if err := refreshBucketChecksums(tx); err != nil {
+				return err
+			}
+
+			newMeta := *meta
+			newMeta.DbVersionNumber = pending[len(pending)-1].number
+			return putMeta(&newMeta, tx)
+		})
+		if err != nil {
+			return err
+		}
+
+		fromVersion = pending[len(pending)-1].number
+		pending = nil
+
+		return nil
+	}
+
+	for _, v := range getMigrationsToApply(versions, fromVersion) {
+		if v.batchMigration == nil {
+			pending = append(pending, v)
+			continue
+		}
+
+		if err := applyPending(); err != nil {
+			return err
+		}
+
+		err := d.applyBatchMigration(v, fromVersion, meta, batchSize)
+		if err != nil {
+			return err
+		}
+		fromVersion = v.number
+	}
+
+	return applyPending()
+}
+
+// applyBatchMigration applies the passed batch migration, which moves the
+// database from fromVersion to the migration's version. Each batch is
+// committed separately, with the final one also removing the migration's
+// checkpoint and bumping the database version.
+func (d *DB) applyBatchMigration(v version, fromVersion uint32, meta *Meta,
+	batchSize int) error {
+
+	migrationLog := newMigrationLogger(
+		log, v.batchMigration, fromVersion, v.number, d.dbPath,
 	)
-	return d.Update(func(tx *bbolt.Tx) error {
-		for i, migration := range migrations {
-			if migration == nil {
-				continue
+
+	migrationLog.Infof("Applying migration #%v in batches of %v records",
+		v.number, batchSize)
+
+	var versionKey [4]byte
+	byteOrder.PutUint32(versionKey[:], v.number)
+
+	for batch := 1; ; batch++ {
+		var done bool
+		err := d.Update(func(tx *bbolt.Tx) error {
+			checkpoints, err := tx.CreateBucketIfNotExists(
+				migrationCheckpointBucket,
+			)
+			if err != nil {
+				return err
+			}
+			checkpoint, err := checkpoints.CreateBucketIfNotExists(
+				versionKey[:],
+			)
+			if err != nil {
+				return err
 			}
 
-			log.Infof("Applying migration #%v", migrationVersions[i])
+			done, err = v.batchMigration(
+				tx, checkpoint, batchSize, migrationLog,
+			)
+			if err != nil || !done {
+				return err
+			}
 
-			if err := migration(tx); err != nil {
-				log.Infof("Unable to apply migration #%v",
-					migrationVersions[i])
+			// With the final batch applied, the checkpoint is no
+			// longer needed.
+			err = tx.DeleteBucket(migrationCheckpointBucket)
+			if err != nil {
 				return err
 			}
+			if err := refreshBucketChecksums(tx); err != nil {
+				return err
+			}
+
+			newMeta := *meta
+			newMeta.DbVersionNumber = v.number
+			return putMeta(&newMeta, tx)
+		})
+		if err != nil {
+			migrationLog.Errorf("Unable to apply batch #%v of "+
+				"migration #%v: %v", batch, v.number, err)
+			return err
 		}
 
-		meta.DbVersionNumber = latestVersion
-		return putMeta(meta, tx)
-	})
+		if done {
+			return nil
+		}
+
+		migrationLog.Debugf("Committed batch #%v of migration #%v",
+			batch, v.number)
+	}
 }
 
 // ChannelGraph returns a new instance of the directed channel graph.
@@ -1103,22 +1851,38 @@ func (d *DB) ChannelGraph() *ChannelGraph {
 	return &ChannelGraph{d}
 }
 
+// raiseMinCompatibleVersion raises the minimum version a binary must support to
+// open the database to the passed version. A higher recorded minimum is left
+// in place.
+func (d *DB) raiseMinCompatibleVersion(minVersion uint32) error {
+	return d.Update(func(tx *bbolt.Tx) error {
+		meta := &Meta{}
+		if err := fetchMeta(meta, tx); err != nil {
+			return err
+		}
+		if meta.MinCompatibleVersion >= minVersion {
+			return nil
+		}
+
+		meta.MinCompatibleVersion = minVersion
+		return putMeta(meta, tx)
+	})
+}
+
 func getLatestDBVersion(versions []version) uint32 {
 	return versions[len(versions)-1].number
 }
 
-// getMigrationsToApply retrieves the migration function that should be
-// applied to the database.
-func getMigrationsToApply(versions []version, version uint32) ([]migration, []uint32) {
-	migrations := make([]migration, 0, len(versions))
-	migrationVersions := make([]uint32, 0, len(versions))
+// getMigrationsToApply retrieves the versions whose migrations should be
+// applied to a database at the passed version.
+func getMigrationsToApply(versions []version, dbVersion uint32) []version {
+	migrations := make([]version, 0, len(versions))
 
 	for _, v := range versions {
-		if v.number > version {
-			migrations = append(migrations, v.migration)
-			migrationVersions = append(migrationVersions, v.number)
+		if v.number > dbVersion {
+			migrations = append(migrations, v)
 		}
 	}
 
-	return migrations, migrationVersions
+	return migrations
 }
@@ -0,0 +1,125 @@
+package channeldb
+
+import (
+	"bytes"
+
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// dbSequenceBucket is the top-level bucket whose sequence counts the
+	// write transactions committed to the database.
+	dbSequenceBucket = []byte("db-sequence")
+
+	// dbSequenceTxIDKey is the key within the dbSequenceBucket that holds
+	// the ID of the bbolt transaction that last bumped the sequence. It
+	// ensures a transaction bumps the sequence only once, even if it's
+	// shared by several batched updates.
+	dbSequenceTxIDKey = []byte("tx-id")
+)
+
+// Update executes fn within a read-write transaction, bumping the DB sequence
+// within the same transaction. All write transactions of channeldb are
+// executed through this method or Batch, such that every committed write
+// increments the sequence exactly once. Like all transactions, it's blocked
+// while the database is being replaced by its compacted copy. If a replication
+// sink is set, the mutations of the transaction are handed to it once
+// committed.
+func (d *DB) Update(fn func(tx *bbolt.Tx) error) error {
+	if d.replicationSink != nil {
+		return d.updateReplicated(fn)
+	}
+
+	d.compactMtx.RLock()
+	defer d.compactMtx.RUnlock()
+
+	if d.reopenErr != nil {
+		return d.reopenErr
+	}
+
+	return d.bdb.Update(func(tx *bbolt.Tx) error {
+		if err := bumpDBSequence(tx); err != nil {
+			return err
+		}
+
+		return fn(tx)
+	})
+}
+
+// Batch executes fn as part of a batched read-write transaction, bumping the
+// DB sequence within the same transaction. A transaction that's shared by
+// several calls to Batch bumps the sequence only once. If a replication sink
+// is set, the mutations of the transaction are handed to it once committed.
+func (d *DB) Batch(fn func(tx *bbolt.Tx) error) error {
+	if d.replicationSink != nil {
+		return d.batchReplicated(fn)
+	}
+
+	d.compactMtx.RLock()
+	defer d.compactMtx.RUnlock()
+
+	if d.reopenErr != nil {
+		return d.reopenErr
+	}
+
+	return d.bdb.Batch(func(tx *bbolt.Tx) error {
+		if err := bumpDBSequence(tx); err != nil {
+			return err
+		}
+
+		return fn(tx)
+	})
+}
+
+// DBSequence returns the number of write transactions that have been committed
+// to the database. The sequence is bumped within the same transaction as the
+// write itself, so it never skips or repeats a value, and a backup or standby
+// tagged with it reflects exactly the writes up to that point.
+func (d *DB) DBSequence() (uint64, error) {
+	var seq uint64
+	err := d.View(func(tx *bbolt.Tx) error {
+		seq = dbSequenceTx(tx)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return seq, nil
+}
+
+// dbSequenceTx returns the DB sequence as seen by the passed transaction. For
+// a read-write transaction, this is the sequence assigned to the transaction
+// itself.
+func dbSequenceTx(tx *bbolt.Tx) uint64 {
+	bucket := tx.Bucket(dbSequenceBucket)
+	if bucket == nil {
+		return 0
+	}
+
+	return bucket.Sequence()
+}
+
+// bumpDBSequence increments the DB sequence, unless it was already bumped by
+// the passed transaction.
+func bumpDBSequence(tx *bbolt.Tx) error {
+	bucket, err := tx.CreateBucketIfNotExists(dbSequenceBucket)
+	if err != nil {
+		return err
+	}
+
+	// The ID of a write transaction is unique among committed
+	// transactions. Should a transaction that bumped the sequence be
+	// rolled back, the stored ID is rolled back along with it.
+	var txID [8]byte
+	byteOrder.PutUint64(txID[:], uint64(tx.ID()))
+	if bytes.Equal(bucket.Get(dbSequenceTxIDKey), txID[:]) {
+		return nil
+	}
+
+	if _, err := bucket.NextSequence(); err != nil {
+		return err
+	}
+
+	return bucket.Put(dbSequenceTxIDKey, txID[:])
+}
@@ -0,0 +1,98 @@
+package channeldb
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/coreos/bbolt"
+)
+
+// TestDBSequence asserts that the DB sequence is bumped exactly once by every
+// committed write transaction, and left untouched by failed ones.
+func TestDBSequence(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	start, err := db.DBSequence()
+	if err != nil {
+		t.Fatalf("unable to fetch db sequence: %v", err)
+	}
+
+	// A committed update is assigned the next sequence, which it can
+	// observe from within its own transaction.
+	var txSeq uint64
+	err = db.Update(func(tx *bbolt.Tx) error {
+		txSeq = dbSequenceTx(tx)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to update db: %v", err)
+	}
+	if txSeq != start+1 {
+		t.Fatalf("expected tx sequence %v, got %v", start+1, txSeq)
+	}
+
+	// A failed update must leave the sequence untouched.
+	errFail := fmt.Errorf("fail")
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return errFail
+	})
+	if err != errFail {
+		t.Fatalf("expected update to fail, got %v", err)
+	}
+
+	seq, err := db.DBSequence()
+	if err != nil {
+		t.Fatalf("unable to fetch db sequence: %v", err)
+	}
+	if seq != start+1 {
+		t.Fatalf("expected db sequence %v, got %v", start+1, seq)
+	}
+
+	// Concurrent batched updates may share transactions, each of which
+	// must bump the sequence once, such that the sequences observed by
+	// the updates are contiguous.
+	const numUpdates = 20
+	var (
+		mu   sync.Mutex
+		seen = make(map[uint64]struct{})
+		wg   sync.WaitGroup
+	)
+	for i := 0; i < numUpdates; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := db.Batch(func(tx *bbolt.Tx) error {
+				mu.Lock()
+				seen[dbSequenceTx(tx)] = struct{}{}
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Errorf("unable to batch update: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	end, err := db.DBSequence()
+	if err != nil {
+		t.Fatalf("unable to fetch db sequence: %v", err)
+	}
+	if end-seq != uint64(len(seen)) {
+		t.Fatalf("expected %v transactions, sequence advanced by %v",
+			len(seen), end-seq)
+	}
+	for s := seq + 1; s <= end; s++ {
+		if _, ok := seen[s]; !ok {
+			t.Fatalf("sequence %v not observed by any update", s)
+		}
+	}
+}
@@ -464,3 +464,267 @@ func TestRestoreChannelShells(t *testing.T) {
 		t.Fatalf("only a single edge should be inserted: %v", err)
 	}
 }
+
+// TestPeerChannelSummary tests that the per-peer channel summary properly
+// aggregates both open and pending channels for each of our peers.
+func TestPeerChannelSummary(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	// With no channels in the database, the summary should be empty.
+	summary, err := cdb.PeerChannelSummary()
+	if err != nil {
+		t.Fatalf("unable to fetch summary: %v", err)
+	}
+	if len(summary) != 0 {
+		t.Fatalf("expected empty summary, got %v", spew.Sdump(summary))
+	}
+
+	_, otherPub := btcec.PrivKeyFromBytes(btcec.S256(), rev[:])
+
+	addr := &net.TCPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 18555,
+	}
+
+	// We'll create three channels with the first peer, one of which will
+	// remain pending, and a single pending channel with the second peer.
+	capacities := []btcutil.Amount{1000, 2000, 6000}
+	for i, capacity := range capacities {
+		channel, err := createTestChannelState(cdb)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		channel.Capacity = capacity
+		if err := channel.SyncPending(addr, 101); err != nil {
+			t.Fatalf("unable to sync channel: %v", err)
+		}
+
+		if i == 0 {
+			continue
+		}
+		err = channel.MarkAsOpen(
+			lnwire.NewShortChanIDFromInt(uint64(i)),
+		)
+		if err != nil {
+			t.Fatalf("unable to mark channel open: %v", err)
+		}
+	}
+
+	otherChannel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	otherChannel.IdentityPub = otherPub
+	otherChannel.Capacity = 5000
+	if err := otherChannel.SyncPending(addr, 101); err != nil {
+		t.Fatalf("unable to sync channel: %v", err)
+	}
+
+	summary, err = cdb.PeerChannelSummary()
+	if err != nil {
+		t.Fatalf("unable to fetch summary: %v", err)
+	}
+
+	var peer, otherPeer [33]byte
+	copy(peer[:], pubKey.SerializeCompressed())
+	copy(otherPeer[:], otherPub.SerializeCompressed())
+
+	expectedSummary := map[[33]byte]PeerChannelStats{
+		peer: {
+			NumChannels:   3,
+			NumPending:    1,
+			TotalCapacity: 9000,
+			AvgCapacity:   3000,
+		},
+		otherPeer: {
+			NumChannels:   1,
+			NumPending:    1,
+			TotalCapacity: 5000,
+			AvgCapacity:   5000,
+		},
+	}
+	if !reflect.DeepEqual(summary, expectedSummary) {
+		t.Fatalf("summary mismatch: expected %v, got %v",
+			spew.Sdump(expectedSummary), spew.Sdump(summary))
+	}
+}
+
+// TestPendingChannelCount asserts that PendingChannelCount and
+// PendingChannelPoints agree with the channels returned by
+// FetchPendingChannels.
+func TestPendingChannelCount(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	numPending, err := cdb.PendingChannelCount()
+	if err != nil {
+		t.Fatalf("unable to count pending channels: %v", err)
+	}
+	if numPending != 0 {
+		t.Fatalf("expected no pending channels, got %v", numPending)
+	}
+
+	addr := &net.TCPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 18555,
+	}
+
+	// We'll create four pending channels. One of them will then be marked
+	// as open, and another as waiting to be closed, leaving two channels
+	// that are still pending.
+	channels := make([]*OpenChannel, 4)
+	for i := range channels {
+		channel, err := createTestChannelState(cdb)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		if err := channel.SyncPending(addr, 101); err != nil {
+			t.Fatalf("unable to sync channel: %v", err)
+		}
+		channels[i] = channel
+	}
+
+	err = channels[0].MarkAsOpen(lnwire.NewShortChanIDFromInt(1))
+	if err != nil {
+		t.Fatalf("unable to mark channel open: %v", err)
+	}
+	if err := channels[1].MarkCommitmentBroadcasted(); err != nil {
+		t.Fatalf("unable to mark commitment broadcast: %v", err)
+	}
+
+	pendingChannels, err := cdb.FetchPendingChannels()
+	if err != nil {
+		t.Fatalf("unable to fetch pending channels: %v", err)
+	}
+	if len(pendingChannels) != 2 {
+		t.Fatalf("expected 2 pending channels, got %v",
+			len(pendingChannels))
+	}
+
+	numPending, err = cdb.PendingChannelCount()
+	if err != nil {
+		t.Fatalf("unable to count pending channels: %v", err)
+	}
+	if numPending != len(pendingChannels) {
+		t.Fatalf("expected %v pending channels, got %v",
+			len(pendingChannels), numPending)
+	}
+
+	chanPoints, err := cdb.PendingChannelPoints()
+	if err != nil {
+		t.Fatalf("unable to fetch pending channel points: %v", err)
+	}
+	expectedPoints := make(map[wire.OutPoint]struct{})
+	for _, channel := range pendingChannels {
+		expectedPoints[channel.FundingOutpoint] = struct{}{}
+	}
+	if len(chanPoints) != len(expectedPoints) {
+		t.Fatalf("expected %v channel points, got %v",
+			len(expectedPoints), len(chanPoints))
+	}
+	for _, chanPoint := range chanPoints {
+		if _, ok := expectedPoints[chanPoint]; !ok {
+			t.Fatalf("unexpected pending channel point %v",
+				chanPoint)
+		}
+	}
+}
+
+// TestUnsweptCoopCloses asserts that cooperative closes paying out a settled
+// balance are reported until they're marked as swept.
+func TestUnsweptCoopCloses(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	addr := &net.TCPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 18555,
+	}
+
+	// We'll close three channels: a cooperative close paying out a
+	// balance to us, a cooperative close without any balance, and a
+	// force close. Only the first should need to be swept.
+	closes := []struct {
+		closeType      ClosureType
+		settledBalance btcutil.Amount
+	}{
+		{CooperativeClose, 5000},
+		{CooperativeClose, 0},
+		{LocalForceClose, 5000},
+	}
+	var chanPoints []wire.OutPoint
+	for _, c := range closes {
+		channel, err := createTestChannelState(cdb)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		if err := channel.SyncPending(addr, 101); err != nil {
+			t.Fatalf("unable to sync channel: %v", err)
+		}
+
+		summary := &ChannelCloseSummary{
+			ChanPoint:      channel.FundingOutpoint,
+			RemotePub:      channel.IdentityPub,
+			Capacity:       channel.Capacity,
+			SettledBalance: c.settledBalance,
+			CloseType:      c.closeType,
+		}
+		if err := channel.CloseChannel(summary); err != nil {
+			t.Fatalf("unable to close channel: %v", err)
+		}
+
+		chanPoints = append(chanPoints, channel.FundingOutpoint)
+	}
+
+	unswept, err := cdb.UnsweptCoopCloses()
+	if err != nil {
+		t.Fatalf("unable to fetch unswept closes: %v", err)
+	}
+	if len(unswept) != 1 || unswept[0].ChanPoint != chanPoints[0] {
+		t.Fatalf("expected only %v to be unswept, got %v",
+			chanPoints[0], spew.Sdump(unswept))
+	}
+
+	if err := cdb.MarkSwept(chanPoints[0]); err != nil {
+		t.Fatalf("unable to mark close as swept: %v", err)
+	}
+
+	unswept, err = cdb.UnsweptCoopCloses()
+	if err != nil {
+		t.Fatalf("unable to fetch unswept closes: %v", err)
+	}
+	if len(unswept) != 0 {
+		t.Fatalf("expected no unswept closes, got %v",
+			spew.Sdump(unswept))
+	}
+
+	summary, err := cdb.FetchClosedChannel(&chanPoints[0])
+	if err != nil {
+		t.Fatalf("unable to fetch closed channel: %v", err)
+	}
+	if !summary.Swept {
+		t.Fatalf("expected close to be marked as swept")
+	}
+
+	// Marking an unknown channel as swept should fail.
+	unknown := wire.OutPoint{Index: 99}
+	if err := cdb.MarkSwept(unknown); err != ErrClosedChannelNotFound {
+		t.Fatalf("expected ErrClosedChannelNotFound, got %v", err)
+	}
+}
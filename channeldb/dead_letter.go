@@ -0,0 +1,439 @@
+package channeldb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// deadLetterBucket is the top-level bucket that stores writes which
+	// failed and were deferred for a later retry. Each entry is keyed by
+	// a sequence number, such that writes are retried in the order they
+	// were deferred.
+	//
+	// maps: seqNo -> letterKind || letter
+	deadLetterBucket = []byte("dead-letters")
+
+	// ErrUnknownDeadLetter is returned when a deferred write of an
+	// unknown kind is retried.
+	ErrUnknownDeadLetter = fmt.Errorf("unknown dead letter kind")
+)
+
+// deadLetterKind denotes the operation a deferred write belongs to.
+type deadLetterKind uint8
+
+const (
+	// htlcAddLetterKind denotes a write of RecordHTLCAdd.
+	htlcAddLetterKind deadLetterKind = iota
+
+	// gossipLetterKind denotes a write of RecordGossip.
+	gossipLetterKind
+
+	// attemptLetterKind denotes a write of RecordAttempt.
+	attemptLetterKind
+
+	// forwardingEventsLetterKind denotes a write of AddForwardingEvents.
+	forwardingEventsLetterKind
+)
+
+// deadLetter is a write that can be deferred, serialized, and applied once
+// the database accepts writes again.
+type deadLetter interface {
+	// kind returns the kind of the write.
+	kind() deadLetterKind
+
+	// encode serializes the write to w.
+	encode(w io.Writer) error
+
+	// decode deserializes the write from r.
+	decode(r io.Reader) error
+
+	// apply performs the write within the passed transaction.
+	apply(tx *bbolt.Tx) error
+}
+
+// newDeadLetter returns an empty dead letter of the given kind to decode into.
+func newDeadLetter(kind deadLetterKind) (deadLetter, error) {
+	switch kind {
+	case htlcAddLetterKind:
+		return &htlcAddLetter{}, nil
+	case gossipLetterKind:
+		return &gossipLetter{}, nil
+	case attemptLetterKind:
+		return &attemptLetter{}, nil
+	case forwardingEventsLetterKind:
+		return &forwardingEventsLetter{}, nil
+	default:
+		return nil, ErrUnknownDeadLetter
+	}
+}
+
+// deadLetterQueue holds deferred writes in memory until they've been persisted
+// to the dead letter bucket.
+type deadLetterQueue struct {
+	// maxPending is the max number of letters held in memory. Once
+	// exceeded, the oldest letters are dropped.
+	maxPending int
+
+	// pending are the serialized letters that couldn't be persisted yet,
+	// in the order they were deferred.
+	pending [][]byte
+
+	sync.Mutex
+}
+
+// EnableDeadLetterQueue enables the deferral of failed non-critical writes.
+// Rather than returning the error, such a write is queued in memory, and
+// persisted to disk as soon as the database accepts writes again, from where
+// it's applied by RetryDeadLetters. At most maxPending writes are held in
+// memory, beyond which the oldest ones are dropped.
+//
+// The following operations opt in, as the data they record is only used for
+// reporting and heuristics:
+//   - RecordHTLCAdd
+//   - RecordGossip
+//   - RecordAttempt
+//   - ForwardingLog.AddForwardingEvents
+//
+// All other writes, including those of channel state, invoices and payments,
+// keep failing hard.
+//
+// NOTE: This method should be called at startup, before the database is used
+// concurrently.
+func (d *DB) EnableDeadLetterQueue(maxPending int) {
+	d.deadLetters = &deadLetterQueue{
+		maxPending: maxPending,
+	}
+}
+
+// deferWrite queues the letter if the write it describes failed with err and
+// the dead letter queue is enabled, in which case nil is returned. Otherwise,
+// err is returned as is.
+func (d *DB) deferWrite(err error, letter deadLetter) error {
+	q := d.deadLetters
+	if err == nil || q == nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	b.WriteByte(byte(letter.kind()))
+	if encodeErr := letter.encode(&b); encodeErr != nil {
+		return err
+	}
+
+	log.Warnf("Deferring write of dead letter kind=%v: %v",
+		letter.kind(), err)
+
+	q.Lock()
+	defer q.Unlock()
+
+	q.pending = append(q.pending, b.Bytes())
+	if dropped := len(q.pending) - q.maxPending; dropped > 0 {
+		log.Errorf("Dropping %v dead letters exceeding the max of %v",
+			dropped, q.maxPending)
+		q.pending = q.pending[dropped:]
+	}
+
+	// We'll attempt to persist the letters right away. If the database
+	// still refuses writes, they'll remain in memory until the next
+	// attempt.
+	if err := d.flushDeadLetters(); err != nil {
+		log.Warnf("Unable to persist %v dead letters: %v",
+			len(q.pending), err)
+	}
+
+	return nil
+}
+
+// flushDeadLetters persists the letters held in memory to the dead letter
+// bucket.
+//
+// NOTE: The caller must hold the lock of the dead letter queue.
+func (d *DB) flushDeadLetters() error {
+	q := d.deadLetters
+	if len(q.pending) == 0 {
+		return nil
+	}
+
+	err := d.Update(func(tx *bbolt.Tx) error {
+		letters, err := tx.CreateBucketIfNotExists(deadLetterBucket)
+		if err != nil {
+			return err
+		}
+
+		for _, letter := range q.pending {
+			seqNo, err := letters.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			var seqNoBytes [8]byte
+			byteOrder.PutUint64(seqNoBytes[:], seqNo)
+			err = letters.Put(seqNoBytes[:], letter)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	q.pending = nil
+
+	return nil
+}
+
+// RetryDeadLetters applies all deferred writes in the order they were
+// deferred, each within its own transaction, and returns the number of writes
+// applied. Retrying stops at the first write that fails again, which remains
+// queued along with all writes following it.
+func (d *DB) RetryDeadLetters() (int, error) {
+	if q := d.deadLetters; q != nil {
+		q.Lock()
+		err := d.flushDeadLetters()
+		q.Unlock()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var seqNos [][]byte
+	err := d.View(func(tx *bbolt.Tx) error {
+		letters := tx.Bucket(deadLetterBucket)
+		if letters == nil {
+			return nil
+		}
+
+		return letters.ForEach(func(seqNo, _ []byte) error {
+			seqNos = append(seqNos, append([]byte(nil), seqNo...))
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var numApplied int
+	for _, seqNo := range seqNos {
+		err := d.Update(func(tx *bbolt.Tx) error {
+			letters := tx.Bucket(deadLetterBucket)
+			letterBytes := letters.Get(seqNo)
+			if len(letterBytes) == 0 {
+				return ErrUnknownDeadLetter
+			}
+
+			kind := deadLetterKind(letterBytes[0])
+			letter, err := newDeadLetter(kind)
+			if err != nil {
+				return err
+			}
+			err = letter.decode(bytes.NewReader(letterBytes[1:]))
+			if err != nil {
+				return err
+			}
+			if err := letter.apply(tx); err != nil {
+				return err
+			}
+
+			return letters.Delete(seqNo)
+		})
+		if err != nil {
+			return numApplied, err
+		}
+
+		numApplied++
+	}
+
+	return numApplied, nil
+}
+
+// htlcAddLetter is a deferred write of RecordHTLCAdd.
+type htlcAddLetter struct {
+	chanID uint64
+	dir    uint8
+	t      time.Time
+}
+
+// kind returns the kind of the write.
+func (l *htlcAddLetter) kind() deadLetterKind {
+	return htlcAddLetterKind
+}
+
+// encode serializes the write to w.
+func (l *htlcAddLetter) encode(w io.Writer) error {
+	return writeBinary(w, l.chanID, l.dir, l.t.UnixNano())
+}
+
+// decode deserializes the write from r.
+func (l *htlcAddLetter) decode(r io.Reader) error {
+	var unixNano int64
+	err := readBinary(r, &l.chanID, &l.dir, &unixNano)
+	l.t = time.Unix(0, unixNano)
+
+	return err
+}
+
+// apply performs the write within the passed transaction.
+func (l *htlcAddLetter) apply(tx *bbolt.Tx) error {
+	return putHTLCAdd(tx, l.chanID, l.dir, l.t)
+}
+
+// gossipLetter is a deferred write of RecordGossip.
+type gossipLetter struct {
+	pub     [33]byte
+	msgKind GossipKind
+	t       time.Time
+}
+
+// kind returns the kind of the write.
+func (l *gossipLetter) kind() deadLetterKind {
+	return gossipLetterKind
+}
+
+// encode serializes the write to w.
+func (l *gossipLetter) encode(w io.Writer) error {
+	return writeBinary(w, l.pub, l.msgKind, l.t.UnixNano())
+}
+
+// decode deserializes the write from r.
+func (l *gossipLetter) decode(r io.Reader) error {
+	var unixNano int64
+	err := readBinary(r, &l.pub, &l.msgKind, &unixNano)
+	l.t = time.Unix(0, unixNano)
+
+	return err
+}
+
+// apply performs the write within the passed transaction.
+func (l *gossipLetter) apply(tx *bbolt.Tx) error {
+	return putGossipMsg(tx, l.pub, l.msgKind, l.t)
+}
+
+// attemptLetter is a deferred write of RecordAttempt.
+type attemptLetter struct {
+	chanID  uint64
+	dir     uint8
+	success bool
+	t       time.Time
+}
+
+// kind returns the kind of the write.
+func (l *attemptLetter) kind() deadLetterKind {
+	return attemptLetterKind
+}
+
+// encode serializes the write to w.
+func (l *attemptLetter) encode(w io.Writer) error {
+	return writeBinary(w, l.chanID, l.dir, l.success, l.t.UnixNano())
+}
+
+// decode deserializes the write from r.
+func (l *attemptLetter) decode(r io.Reader) error {
+	var unixNano int64
+	err := readBinary(r, &l.chanID, &l.dir, &l.success, &unixNano)
+	l.t = time.Unix(0, unixNano)
+
+	return err
+}
+
+// apply performs the write within the passed transaction.
+func (l *attemptLetter) apply(tx *bbolt.Tx) error {
+	return putAttempt(tx, l.chanID, l.dir, l.success, l.t)
+}
+
+// forwardingEventsLetter is a deferred write of AddForwardingEvents.
+type forwardingEventsLetter struct {
+	events []ForwardingEvent
+}
+
+// kind returns the kind of the write.
+func (l *forwardingEventsLetter) kind() deadLetterKind {
+	return forwardingEventsLetterKind
+}
+
+// encode serializes the write to w. The events are always written in the
+// binary format rather than by the registered codec, as they're replayed
+// through the binary format of the dead letter.
+func (l *forwardingEventsLetter) encode(w io.Writer) error {
+	err := writeBinary(w, uint32(len(l.events)))
+	if err != nil {
+		return err
+	}
+
+	for i := range l.events {
+		event := &l.events[i]
+		err := writeBinary(w, event.Timestamp.UnixNano())
+		if err != nil {
+			return err
+		}
+		if err := encodeForwardingEventBinary(w, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decode deserializes the write from r.
+func (l *forwardingEventsLetter) decode(r io.Reader) error {
+	var numEvents uint32
+	if err := readBinary(r, &numEvents); err != nil {
+		return err
+	}
+
+	l.events = nil
+	for i := uint32(0); i < numEvents; i++ {
+		var (
+			event    ForwardingEvent
+			unixNano int64
+		)
+		if err := readBinary(r, &unixNano); err != nil {
+			return err
+		}
+		err := decodeForwardingEventBinary(r, &event)
+		if err != nil {
+			return err
+		}
+		event.Timestamp = time.Unix(0, unixNano)
+
+		l.events = append(l.events, event)
+	}
+
+	return nil
+}
+
+// apply performs the write within the passed transaction.
+func (l *forwardingEventsLetter) apply(tx *bbolt.Tx) error {
+	return putForwardingEvents(tx, l.events)
+}
+
+// writeBinary writes the fixed size values to w in order.
+func writeBinary(w io.Writer, values ...interface{}) error {
+	for _, v := range values {
+		if err := binary.Write(w, byteOrder, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readBinary reads the fixed size values from r in order.
+func readBinary(r io.Reader, values ...interface{}) error {
+	for _, v := range values {
+		if err := binary.Read(r, byteOrder, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
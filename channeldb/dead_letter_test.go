@@ -0,0 +1,135 @@
+package channeldb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestDeadLetterQueue asserts that failed writes are only deferred once the
+// dead letter queue is enabled, and that retrying applies each deferred write
+// exactly once.
+func TestDeadLetterQueue(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	const chanID = 1234
+	now := time.Unix(0, time.Now().UnixNano())
+	var pub [33]byte
+	pub[0] = 2
+
+	letters := []deadLetter{
+		&htlcAddLetter{chanID: chanID, dir: 1, t: now},
+		&gossipLetter{pub: pub, msgKind: GossipChannelUpdate, t: now},
+		&attemptLetter{chanID: chanID, dir: 0, success: true, t: now},
+		&forwardingEventsLetter{
+			events: []ForwardingEvent{{
+				Timestamp:      now,
+				IncomingChanID: lnwire.NewShortChanIDFromInt(1),
+				OutgoingChanID: lnwire.NewShortChanIDFromInt(2),
+				AmtIn:          1000,
+				AmtOut:         990,
+			}},
+		},
+	}
+
+	// Without the queue enabled, the error of a failed write should be
+	// returned as is.
+	writeErr := errors.New("disk full")
+	if err := db.deferWrite(writeErr, letters[0]); err != writeErr {
+		t.Fatalf("expected write error, got %v", err)
+	}
+
+	db.EnableDeadLetterQueue(len(letters))
+	for _, letter := range letters {
+		if err := db.deferWrite(writeErr, letter); err != nil {
+			t.Fatalf("unable to defer write: %v", err)
+		}
+	}
+
+	// None of the writes should've been applied before retrying.
+	numAdds, err := db.HTLCRate(chanID, 1, time.Minute, now)
+	if err != nil {
+		t.Fatalf("unable to fetch htlc rate: %v", err)
+	}
+	if numAdds != 0 {
+		t.Fatalf("expected no htlc adds, got %v", numAdds)
+	}
+
+	numApplied, err := db.RetryDeadLetters()
+	if err != nil {
+		t.Fatalf("unable to retry dead letters: %v", err)
+	}
+	if numApplied != len(letters) {
+		t.Fatalf("expected %v applied writes, got %v", len(letters),
+			numApplied)
+	}
+
+	numAdds, err = db.HTLCRate(chanID, 1, time.Minute, now)
+	if err != nil {
+		t.Fatalf("unable to fetch htlc rate: %v", err)
+	}
+	if numAdds != 1 {
+		t.Fatalf("expected 1 htlc add, got %v", numAdds)
+	}
+
+	counts, err := db.GossipRate(pub, time.Minute, now)
+	if err != nil {
+		t.Fatalf("unable to fetch gossip rate: %v", err)
+	}
+	if counts[GossipChannelUpdate] != 1 {
+		t.Fatalf("expected 1 channel update, got %v",
+			counts[GossipChannelUpdate])
+	}
+
+	_, numSamples, err := db.channelSuccessProbability(chanID, 0, now)
+	if err != nil {
+		t.Fatalf("unable to fetch success probability: %v", err)
+	}
+	if numSamples != 1 {
+		t.Fatalf("expected 1 attempt, got %v", numSamples)
+	}
+
+	timeSlice, err := db.ForwardingLog().Query(ForwardingEventQuery{
+		StartTime:    now,
+		EndTime:      now,
+		NumMaxEvents: 10,
+	})
+	if err != nil {
+		t.Fatalf("unable to query forwarding log: %v", err)
+	}
+	if len(timeSlice.ForwardingEvents) != 1 {
+		t.Fatalf("expected 1 forwarding event, got %v",
+			len(timeSlice.ForwardingEvents))
+	}
+
+	// A second retry shouldn't apply any of the writes again.
+	numApplied, err = db.RetryDeadLetters()
+	if err != nil {
+		t.Fatalf("unable to retry dead letters: %v", err)
+	}
+	if numApplied != 0 {
+		t.Fatalf("expected no applied writes, got %v", numApplied)
+	}
+
+	// A letter of an unknown kind should stop the retry, and remain
+	// queued along with the letters following it.
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(deadLetterBucket)
+		return bucket.Put([]byte{0xff}, []byte{0xff})
+	})
+	if err != nil {
+		t.Fatalf("unable to store letter: %v", err)
+	}
+	if _, err := db.RetryDeadLetters(); err != ErrUnknownDeadLetter {
+		t.Fatalf("expected ErrUnknownDeadLetter, got %v", err)
+	}
+}
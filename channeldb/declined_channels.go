@@ -0,0 +1,127 @@
+package channeldb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// declinedChannelsBucket is the top-level bucket that stores the
+	// inbound channel open requests we've declined. Each peer has its own
+	// sub-bucket, which holds an entry per declined request keyed by the
+	// time it was declined, followed by a sequence number to keep requests
+	// declined at the same time apart. The value is the reason the
+	// request was declined for.
+	//
+	// maps: peerPub => declineTime || seqNo => reason
+	declinedChannelsBucket = []byte("declined-channels")
+
+	// ErrDeclineReasonTooLong is returned when recording a declined
+	// channel open request with a reason exceeding MaxDeclineReasonLen.
+	ErrDeclineReasonTooLong = fmt.Errorf("decline reason exceeds max "+
+		"length of %v", MaxDeclineReasonLen)
+)
+
+const (
+	// MaxDeclinedOpenAge is the time for which a declined channel open
+	// request is retained. Requests declined before this are trimmed as
+	// new declines of the same peer are recorded.
+	MaxDeclinedOpenAge = 30 * 24 * time.Hour
+
+	// MaxDeclineReasonLen is the max length in bytes of the reason a
+	// channel open request was declined for.
+	MaxDeclineReasonLen = 256
+)
+
+// DeclinedOpen is an inbound channel open request that we declined.
+type DeclinedOpen struct {
+	// Time is the time the request was declined at.
+	Time time.Time
+
+	// Reason is the reason the request was declined for.
+	Reason string
+}
+
+// RecordDeclinedOpen records that we declined a channel open request of the
+// peer at the passed time, for the given reason. Any declines recorded for
+// the peer that are older than MaxDeclinedOpenAge are trimmed along the way.
+func (d *DB) RecordDeclinedOpen(pub [33]byte, reason string,
+	t time.Time) error {
+
+	if len(reason) > MaxDeclineReasonLen {
+		return ErrDeclineReasonTooLong
+	}
+
+	return d.Batch(func(tx *bbolt.Tx) error {
+		declined, err := tx.CreateBucketIfNotExists(
+			declinedChannelsBucket,
+		)
+		if err != nil {
+			return err
+		}
+		peerDeclines, err := declined.CreateBucketIfNotExists(pub[:])
+		if err != nil {
+			return err
+		}
+
+		seqNo, err := peerDeclines.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		var key [16]byte
+		byteOrder.PutUint64(key[:8], uint64(t.UnixNano()))
+		byteOrder.PutUint64(key[8:], seqNo)
+		if err := peerDeclines.Put(key[:], []byte(reason)); err != nil {
+			return err
+		}
+
+		return trimTimeSeries(peerDeclines, t.Add(-MaxDeclinedOpenAge))
+	})
+}
+
+// DeclinedOpens returns the channel open requests of the peer that we declined
+// at or after the passed time, in the order they were declined.
+func (d *DB) DeclinedOpens(pub [33]byte,
+	since time.Time) ([]DeclinedOpen, error) {
+
+	var declines []DeclinedOpen
+	err := d.View(func(tx *bbolt.Tx) error {
+		declines = nil
+
+		declined := tx.Bucket(declinedChannelsBucket)
+		if declined == nil {
+			return nil
+		}
+		peerDeclines := declined.Bucket(pub[:])
+		if peerDeclines == nil {
+			return nil
+		}
+
+		var start [8]byte
+		byteOrder.PutUint64(start[:], uint64(since.UnixNano()))
+
+		c := peerDeclines.Cursor()
+		for k, v := c.Seek(start[:]); k != nil; k, v = c.Next() {
+			if len(k) != 16 {
+				return fmt.Errorf("invalid declined open key "+
+					"%x", k)
+			}
+
+			unixNano := int64(byteOrder.Uint64(k[:8]))
+			declines = append(declines, DeclinedOpen{
+				Time:   time.Unix(0, unixNano),
+				Reason: string(v),
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return declines, nil
+}
@@ -0,0 +1,86 @@
+package channeldb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDeclinedOpens asserts that declined channel open requests are returned
+// per peer since the queried time, and trimmed once they're too old.
+func TestDeclinedOpens(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+
+	var spammyPeer, otherPeer [33]byte
+	spammyPeer[0], otherPeer[0] = 2, 3
+	now := time.Unix(1500000000, 0)
+
+	declines := []struct {
+		pub    [33]byte
+		reason string
+		t      time.Time
+	}{
+		{spammyPeer, "too small", now},
+		{spammyPeer, "too small", now},
+		{spammyPeer, "unknown peer", now.Add(time.Minute)},
+		{otherPeer, "too small", now},
+	}
+	for _, decline := range declines {
+		err := db.RecordDeclinedOpen(
+			decline.pub, decline.reason, decline.t,
+		)
+		if err != nil {
+			t.Fatalf("unable to record declined open: %v", err)
+		}
+	}
+
+	assertDeclines := func(pub [33]byte, since time.Time,
+		expected []DeclinedOpen) {
+
+		t.Helper()
+
+		result, err := db.DeclinedOpens(pub, since)
+		if err != nil {
+			t.Fatalf("unable to fetch declined opens: %v", err)
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("expected declines %v, got %v", expected,
+				result)
+		}
+	}
+
+	assertDeclines(spammyPeer, now, []DeclinedOpen{
+		{Time: now, Reason: "too small"},
+		{Time: now, Reason: "too small"},
+		{Time: now.Add(time.Minute), Reason: "unknown peer"},
+	})
+	assertDeclines(spammyPeer, now.Add(time.Second), []DeclinedOpen{
+		{Time: now.Add(time.Minute), Reason: "unknown peer"},
+	})
+	assertDeclines(otherPeer, now, []DeclinedOpen{
+		{Time: now, Reason: "too small"},
+	})
+
+	// Recording a decline beyond the retention period trims all earlier
+	// declines of the peer.
+	later := now.Add(MaxDeclinedOpenAge + time.Hour)
+	if err := db.RecordDeclinedOpen(spammyPeer, "", later); err != nil {
+		t.Fatalf("unable to record declined open: %v", err)
+	}
+	assertDeclines(spammyPeer, time.Unix(0, 0), []DeclinedOpen{
+		{Time: later, Reason: ""},
+	})
+
+	reason := strings.Repeat("a", MaxDeclineReasonLen+1)
+	err = db.RecordDeclinedOpen(otherPeer, reason, now)
+	if err != ErrDeclineReasonTooLong {
+		t.Fatalf("expected ErrDeclineReasonTooLong, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/coreos/bbolt"
+)
+
+// ErrInvalidDuplicateCount is returned when querying duplicate channels with a
+// minimum count below two, as a single channel isn't a duplicate.
+var ErrInvalidDuplicateCount = fmt.Errorf("min count of duplicate " +
+	"channels must be at least two")
+
+// DuplicatePeerChannels returns the open channels of each peer that we have
+// at least minCount open channels with, keyed by the public key of the peer.
+// Channels whose funding transaction is yet to confirm, and those that are
+// being closed, aren't counted. The channels of a peer are sorted by capacity
+// in ascending order, so the ones worth consolidating come first, with ties
+// broken by their funding outpoint.
+func (d *DB) DuplicatePeerChannels(minCount int) (map[[33]byte][]*OpenChannel,
+	error) {
+
+	if minCount < 2 {
+		return nil, ErrInvalidDuplicateCount
+	}
+
+	duplicates := make(map[[33]byte][]*OpenChannel)
+	err := d.View(func(tx *bbolt.Tx) error {
+		for peer := range duplicates {
+			delete(duplicates, peer)
+		}
+
+		openChanBucket := tx.Bucket(openChannelBucket)
+		if openChanBucket == nil {
+			return nil
+		}
+
+		return openChanBucket.ForEach(func(nodePub, v []byte) error {
+			// Only the sub-buckets keyed by a node's public key
+			// are of interest to us.
+			if v != nil || len(nodePub) != 33 {
+				return nil
+			}
+			nodeChanBucket := openChanBucket.Bucket(nodePub)
+
+			var channels []*OpenChannel
+			err := nodeChanBucket.ForEach(func(chainHash,
+				v []byte) error {
+
+				if v != nil {
+					return nil
+				}
+				chainBucket := nodeChanBucket.Bucket(chainHash)
+
+				nodeChans, err := d.fetchNodeChannels(
+					chainBucket,
+				)
+				if err != nil {
+					return fmt.Errorf("unable to read "+
+						"channel for chain_hash=%x, "+
+						"node_key=%x: %v", chainHash,
+						nodePub, err)
+				}
+				for _, channel := range nodeChans {
+					status := channel.ChanStatus()
+					if channel.IsPending ||
+						status != ChanStatusDefault {
+
+						continue
+					}
+					channels = append(channels, channel)
+				}
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if len(channels) < minCount {
+				return nil
+			}
+
+			sort.Slice(channels, func(i, j int) bool {
+				return lessByCapacity(channels[i], channels[j])
+			})
+
+			var peer [33]byte
+			copy(peer[:], nodePub)
+			duplicates[peer] = channels
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return duplicates, nil
+}
+
+// lessByCapacity returns whether channel a has a smaller capacity than
+// channel b, comparing their funding outpoints if both are of the same size.
+func lessByCapacity(a, b *OpenChannel) bool {
+	if a.Capacity != b.Capacity {
+		return a.Capacity < b.Capacity
+	}
+
+	opA, opB := a.FundingOutpoint, b.FundingOutpoint
+	if cmp := bytes.Compare(opA.Hash[:], opB.Hash[:]); cmp != 0 {
+		return cmp < 0
+	}
+
+	return opA.Index < opB.Index
+}
@@ -0,0 +1,122 @@
+package channeldb
+
+import (
+	"net"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestDuplicatePeerChannels asserts that only peers with enough open channels
+// are returned, with their channels sorted by capacity.
+func TestDuplicatePeerChannels(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	_, err = cdb.DuplicatePeerChannels(1)
+	if err != ErrInvalidDuplicateCount {
+		t.Fatalf("expected ErrInvalidDuplicateCount, got %v", err)
+	}
+
+	priv, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+
+	newChannel := func(capacity btcutil.Amount, otherPeer,
+		pending bool) *OpenChannel {
+
+		t.Helper()
+
+		channel, err := createTestChannelState(cdb)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		channel.Capacity = capacity
+		if otherPeer {
+			channel.IdentityPub = priv.PubKey()
+		}
+
+		if pending {
+			addr := &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 18555,
+			}
+			err = channel.SyncPending(addr, 101)
+		} else {
+			channel.IsPending = false
+			err = channel.FullSync()
+		}
+		if err != nil {
+			t.Fatalf("unable to save channel state: %v", err)
+		}
+
+		return channel
+	}
+
+	// The first peer has three open channels, one of which is borked,
+	// along with a pending one. The second peer has two open channels.
+	large := newChannel(30000, false, false)
+	small := newChannel(10000, false, false)
+	newChannel(20000, false, true)
+	borked := newChannel(5000, false, false)
+	if err := borked.MarkBorked(); err != nil {
+		t.Fatalf("unable to mark channel borked: %v", err)
+	}
+	otherLarge := newChannel(20000, true, false)
+	otherSmall := newChannel(10000, true, false)
+
+	var firstPeer, secondPeer [33]byte
+	copy(firstPeer[:], large.IdentityPub.SerializeCompressed())
+	copy(secondPeer[:], priv.PubKey().SerializeCompressed())
+
+	assertDuplicates := func(minCount int,
+		expected map[[33]byte][]*OpenChannel) {
+
+		t.Helper()
+
+		duplicates, err := cdb.DuplicatePeerChannels(minCount)
+		if err != nil {
+			t.Fatalf("unable to fetch duplicate channels: %v", err)
+		}
+		if len(duplicates) != len(expected) {
+			t.Fatalf("expected %v peers, got %v", len(expected),
+				len(duplicates))
+		}
+		for peer, expectedChans := range expected {
+			channels := duplicates[peer]
+			if len(channels) != len(expectedChans) {
+				t.Fatalf("expected %v channels of peer %x, "+
+					"got %v", len(expectedChans), peer,
+					len(channels))
+			}
+
+			for i, channel := range channels {
+				op := expectedChans[i].FundingOutpoint
+				if channel.FundingOutpoint != op {
+					t.Fatalf("expected channel %v at "+
+						"index %v, got %v", op, i,
+						channel.FundingOutpoint)
+				}
+				capacity := expectedChans[i].Capacity
+				if channel.Capacity != capacity {
+					t.Fatalf("expected capacity %v, "+
+						"got %v", capacity,
+						channel.Capacity)
+				}
+			}
+		}
+	}
+
+	assertDuplicates(2, map[[33]byte][]*OpenChannel{
+		firstPeer:  {small, large},
+		secondPeer: {otherSmall, otherLarge},
+	})
+	assertDuplicates(3, map[[33]byte][]*OpenChannel{})
+}
@@ -11,6 +11,11 @@ var (
 	// prior database version.
 	ErrDBReversion = fmt.Errorf("channel db cannot revert to prior version")
 
+	// ErrDBIncompatibleVersion is returned when the database requires a
+	// newer schema version than is supported by the running binary.
+	ErrDBIncompatibleVersion = fmt.Errorf("channel db was written by a " +
+		"newer version and can't be opened by this one")
+
 	// ErrLinkNodesNotFound is returned when node info bucket hasn't been
 	// created.
 	ErrLinkNodesNotFound = fmt.Errorf("no link nodes exist")
@@ -108,6 +113,14 @@ var (
 	// channel with a channel point that is already present in the
 	// database.
 	ErrChanAlreadyExists = fmt.Errorf("channel already exists")
+
+	// ErrTLVOutOfOrder is returned when a serialized TLV stream contains
+	// records that aren't sorted by their type.
+	ErrTLVOutOfOrder = fmt.Errorf("tlv records not in canonical order")
+
+	// ErrTLVDuplicateType is returned when a serialized TLV stream
+	// contains more than one record of the same type.
+	ErrTLVDuplicateType = fmt.Errorf("duplicate tlv record type")
 )
 
 // ErrTooManyExtraOpaqueBytes creates an error which should be returned if the
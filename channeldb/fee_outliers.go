@@ -0,0 +1,123 @@
+package channeldb
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// ErrInvalidStdDevs is returned when querying fee rate outliers with a
+// threshold that isn't a positive number of standard deviations.
+var ErrInvalidStdDevs = fmt.Errorf("number of standard deviations must " +
+	"be positive")
+
+// ChannelFee is the fee rate that the source node charges for forwarding
+// over one of its channels, along with how far it deviates from the fee rates
+// of its other channels.
+type ChannelFee struct {
+	// ChannelID is the short channel ID of the channel.
+	ChannelID uint64
+
+	// ChannelPoint is the funding outpoint of the channel.
+	ChannelPoint wire.OutPoint
+
+	// FeeRate is the proportional fee rate of the outgoing policy of the
+	// channel, in millionths.
+	FeeRate lnwire.MilliSatoshi
+
+	// Deviation is the number of standard deviations the fee rate lies
+	// from the mean. It's positive for fee rates above the mean, and
+	// negative for those below it.
+	Deviation float64
+}
+
+// FeeRateOutliers returns the channels of the source node whose outgoing fee
+// rate deviates from the mean fee rate across all of its channels by more than
+// stdDevs standard deviations, ordered by decreasing magnitude of deviation.
+// Both channels with an unusually high fee rate and those with an unusually
+// low one are returned. Channels for which the source node hasn't set a
+// policy yet aren't taken into account.
+func (c *ChannelGraph) FeeRateOutliers(stdDevs float64) ([]ChannelFee, error) {
+	if !(stdDevs > 0) {
+		return nil, ErrInvalidStdDevs
+	}
+
+	var fees []ChannelFee
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		fees = nil
+
+		nodes := tx.Bucket(nodeBucket)
+		if nodes == nil {
+			return ErrGraphNotFound
+		}
+		source, err := c.sourceNode(nodes)
+		if err != nil {
+			return err
+		}
+
+		return source.ForEachChannel(tx, func(_ *bbolt.Tx,
+			info *ChannelEdgeInfo, policy,
+			_ *ChannelEdgePolicy) error {
+
+			if policy == nil {
+				return nil
+			}
+
+			fees = append(fees, ChannelFee{
+				ChannelID:    info.ChannelID,
+				ChannelPoint: info.ChannelPoint,
+				FeeRate:      policy.FeeProportionalMillionths,
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return feeRateOutliers(fees, stdDevs), nil
+}
+
+// feeRateOutliers sets the deviation of each of the passed fees, and returns
+// those deviating by more than stdDevs standard deviations.
+func feeRateOutliers(fees []ChannelFee, stdDevs float64) []ChannelFee {
+	if len(fees) == 0 {
+		return nil
+	}
+
+	var sum float64
+	for _, fee := range fees {
+		sum += float64(fee.FeeRate)
+	}
+	mean := sum / float64(len(fees))
+
+	var sumSquares float64
+	for _, fee := range fees {
+		diff := float64(fee.FeeRate) - mean
+		sumSquares += diff * diff
+	}
+	stdDev := math.Sqrt(sumSquares / float64(len(fees)))
+
+	// If all fee rates are the same, none of them is an outlier.
+	if stdDev == 0 {
+		return nil
+	}
+
+	var outliers []ChannelFee
+	for _, fee := range fees {
+		fee.Deviation = (float64(fee.FeeRate) - mean) / stdDev
+		if math.Abs(fee.Deviation) > stdDevs {
+			outliers = append(outliers, fee)
+		}
+	}
+	sort.Slice(outliers, func(i, j int) bool {
+		return math.Abs(outliers[i].Deviation) >
+			math.Abs(outliers[j].Deviation)
+	})
+
+	return outliers
+}
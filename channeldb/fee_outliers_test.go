@@ -0,0 +1,120 @@
+package channeldb
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestFeeRateOutliers asserts that channels of the source node whose outgoing
+// fee rate lies too far from the mean are reported, while the fee rates of
+// incoming policies and other nodes' channels are ignored.
+func TestFeeRateOutliers(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	graph := db.ChannelGraph()
+
+	if _, err := graph.FeeRateOutliers(0); err != ErrInvalidStdDevs {
+		t.Fatalf("expected ErrInvalidStdDevs, got %v", err)
+	}
+
+	source, err := createTestVertex(db)
+	if err != nil {
+		t.Fatalf("unable to create test node: %v", err)
+	}
+	if err := graph.SetSourceNode(source); err != nil {
+		t.Fatalf("unable to set source node: %v", err)
+	}
+
+	// addChannel adds a channel between the source node and a new peer,
+	// with the passed outgoing fee rate. The peer sets a much higher fee
+	// rate, which must not be taken into account.
+	addChannel := func(feeRate lnwire.MilliSatoshi,
+		withPolicy bool) uint64 {
+
+		t.Helper()
+
+		peer, err := createTestVertex(db)
+		if err != nil {
+			t.Fatalf("unable to create test node: %v", err)
+		}
+		if err := graph.AddLightningNode(peer); err != nil {
+			t.Fatalf("unable to add node: %v", err)
+		}
+
+		edgeInfo, edge1, edge2 := createChannelEdge(db, source, peer)
+		if err := graph.AddChannelEdge(edgeInfo); err != nil {
+			t.Fatalf("unable to add channel edge: %v", err)
+		}
+
+		// The first policy is the one of the first node, which is
+		// the node with the smaller public key.
+		outgoing, incoming := edge1, edge2
+		if bytes.Compare(source.PubKeyBytes[:],
+			peer.PubKeyBytes[:]) > 0 {
+
+			outgoing, incoming = edge2, edge1
+		}
+		outgoing.FeeProportionalMillionths = feeRate
+		incoming.FeeProportionalMillionths = feeRate * 100
+
+		if withPolicy {
+			err := graph.UpdateEdgePolicy(outgoing)
+			if err != nil {
+				t.Fatalf("unable to update policy: %v", err)
+			}
+		}
+		if err := graph.UpdateEdgePolicy(incoming); err != nil {
+			t.Fatalf("unable to update policy: %v", err)
+		}
+
+		return edgeInfo.ChannelID
+	}
+
+	for i := 0; i < 6; i++ {
+		addChannel(1000, true)
+	}
+	low := addChannel(0, true)
+	high := addChannel(2000, true)
+	addChannel(1000000, false)
+
+	// The mean fee rate is 1000 with a standard deviation of 500, so both
+	// the low and the high fee rate deviate by two standard deviations.
+	outliers, err := graph.FeeRateOutliers(2)
+	if err != nil {
+		t.Fatalf("unable to fetch outliers: %v", err)
+	}
+	if len(outliers) != 0 {
+		t.Fatalf("expected no outliers, got %v", len(outliers))
+	}
+
+	outliers, err = graph.FeeRateOutliers(1.5)
+	if err != nil {
+		t.Fatalf("unable to fetch outliers: %v", err)
+	}
+	if len(outliers) != 2 {
+		t.Fatalf("expected 2 outliers, got %v", len(outliers))
+	}
+
+	expected := map[uint64]float64{
+		low:  -2,
+		high: 2,
+	}
+	for _, outlier := range outliers {
+		deviation, ok := expected[outlier.ChannelID]
+		if !ok {
+			t.Fatalf("unexpected outlier %v", outlier.ChannelID)
+		}
+		if math.Abs(outlier.Deviation-deviation) > 1e-9 {
+			t.Fatalf("expected deviation %v, got %v", deviation,
+				outlier.Deviation)
+		}
+	}
+}
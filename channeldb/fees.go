@@ -1 +1,112 @@
 package channeldb
+
+import (
+	"math"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// FeeComparison compares the fee policy the source node advertises for one of
+// its channels with the policy advertised by the peer on the other end.
+type FeeComparison struct {
+	// ChannelID is the short channel ID of the channel.
+	ChannelID uint64
+
+	// ChannelPoint is the funding outpoint of the channel.
+	ChannelPoint wire.OutPoint
+
+	// Peer is the public key of the node on the other end of the channel.
+	Peer [33]byte
+
+	// LocalBaseFee is the base fee the source node charges for forwarding
+	// HTLCs out through the channel.
+	LocalBaseFee lnwire.MilliSatoshi
+
+	// LocalFeeRate is the proportional fee, in millionths, the source
+	// node charges for forwarding HTLCs out through the channel.
+	LocalFeeRate lnwire.MilliSatoshi
+
+	// RemoteBaseFee is the base fee the peer charges for forwarding HTLCs
+	// through the channel towards the source node.
+	RemoteBaseFee lnwire.MilliSatoshi
+
+	// RemoteFeeRate is the proportional fee, in millionths, the peer
+	// charges for forwarding HTLCs through the channel towards the source
+	// node.
+	RemoteFeeRate lnwire.MilliSatoshi
+
+	// Ratio is the local fee rate divided by the remote fee rate. If the
+	// peer charges no proportional fee, it's positive infinity when the
+	// source node does, and 1 when neither does.
+	Ratio float64
+}
+
+// ChannelFeeAsymmetry compares, for each channel of the source node, its own
+// fee policy with that of the peer on the other end of the channel. Channels
+// for which either policy is still unknown are skipped.
+func (c *ChannelGraph) ChannelFeeAsymmetry() ([]FeeComparison, error) {
+	comparisons := make([]FeeComparison, 0)
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		nodes := tx.Bucket(nodeBucket)
+		if nodes == nil {
+			return ErrGraphNotFound
+		}
+		sourceNode, err := c.sourceNode(nodes)
+		if err != nil {
+			return err
+		}
+
+		return sourceNode.ForEachChannel(tx, func(_ *bbolt.Tx,
+			edge *ChannelEdgeInfo, local,
+			remote *ChannelEdgePolicy) error {
+
+			if local == nil || remote == nil {
+				return nil
+			}
+
+			peerBytes, err := edge.OtherNodeKeyBytes(
+				sourceNode.PubKeyBytes[:],
+			)
+			if err != nil {
+				return err
+			}
+			var peer [33]byte
+			copy(peer[:], peerBytes)
+
+			comparisons = append(comparisons, FeeComparison{
+				ChannelID:     edge.ChannelID,
+				ChannelPoint:  edge.ChannelPoint,
+				Peer:          peer,
+				LocalBaseFee:  local.FeeBaseMSat,
+				LocalFeeRate:  local.FeeProportionalMillionths,
+				RemoteBaseFee: remote.FeeBaseMSat,
+				RemoteFeeRate: remote.FeeProportionalMillionths,
+				Ratio: feeRateRatio(
+					local.FeeProportionalMillionths,
+					remote.FeeProportionalMillionths,
+				),
+			})
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return comparisons, nil
+}
+
+// feeRateRatio divides the local fee rate by the remote one.
+func feeRateRatio(local, remote lnwire.MilliSatoshi) float64 {
+	switch {
+	case remote != 0:
+		return float64(local) / float64(remote)
+	case local != 0:
+		return math.Inf(1)
+	default:
+		return 1
+	}
+}
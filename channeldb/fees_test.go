@@ -0,0 +1,123 @@
+package channeldb
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestChannelFeeAsymmetry asserts that the policy of the source node is
+// compared with its peer's for every channel whose policies are both known.
+func TestChannelFeeAsymmetry(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	graph := db.ChannelGraph()
+
+	sourceNode, err := createTestVertex(db)
+	if err != nil {
+		t.Fatalf("unable to create test node: %v", err)
+	}
+	if err := graph.SetSourceNode(sourceNode); err != nil {
+		t.Fatalf("unable to set source node: %v", err)
+	}
+
+	// We'll open a channel with each of two peers, but only learn the
+	// policy of the first peer.
+	var edgeInfos [2]*ChannelEdgeInfo
+	for i := range edgeInfos {
+		peer, err := createTestVertex(db)
+		if err != nil {
+			t.Fatalf("unable to create test node: %v", err)
+		}
+		if err := graph.AddLightningNode(peer); err != nil {
+			t.Fatalf("unable to add node: %v", err)
+		}
+
+		edgeInfo, edge1, edge2 := createChannelEdge(
+			db, sourceNode, peer,
+		)
+		edgeInfo.ChannelPoint.Index = uint32(i)
+		if err := graph.AddChannelEdge(edgeInfo); err != nil {
+			t.Fatalf("unable to add edge: %v", err)
+		}
+		edgeInfos[i] = edgeInfo
+
+		localPolicy, remotePolicy := edge1, edge2
+		if bytes.Compare(sourceNode.PubKeyBytes[:],
+			peer.PubKeyBytes[:]) > 0 {
+
+			localPolicy, remotePolicy = edge2, edge1
+		}
+
+		localPolicy.FeeBaseMSat = 1000
+		localPolicy.FeeProportionalMillionths = 100
+		if err := graph.UpdateEdgePolicy(localPolicy); err != nil {
+			t.Fatalf("unable to update edge: %v", err)
+		}
+		if i > 0 {
+			continue
+		}
+
+		remotePolicy.FeeBaseMSat = 2000
+		remotePolicy.FeeProportionalMillionths = 400
+		if err := graph.UpdateEdgePolicy(remotePolicy); err != nil {
+			t.Fatalf("unable to update edge: %v", err)
+		}
+	}
+
+	comparisons, err := graph.ChannelFeeAsymmetry()
+	if err != nil {
+		t.Fatalf("unable to compare fees: %v", err)
+	}
+	if len(comparisons) != 1 {
+		t.Fatalf("expected 1 fee comparison, got %v", len(comparisons))
+	}
+
+	expected := FeeComparison{
+		ChannelID:     edgeInfos[0].ChannelID,
+		ChannelPoint:  edgeInfos[0].ChannelPoint,
+		LocalBaseFee:  1000,
+		LocalFeeRate:  100,
+		RemoteBaseFee: 2000,
+		RemoteFeeRate: 400,
+		Ratio:         0.25,
+	}
+	expected.Peer = edgeInfos[0].NodeKey1Bytes
+	if expected.Peer == sourceNode.PubKeyBytes {
+		expected.Peer = edgeInfos[0].NodeKey2Bytes
+	}
+	if comparisons[0] != expected {
+		t.Fatalf("expected comparison %v, got %v", expected,
+			comparisons[0])
+	}
+}
+
+// TestFeeRateRatio asserts that fee rates are compared sensibly when the peer
+// charges no proportional fee.
+func TestFeeRateRatio(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		local, remote lnwire.MilliSatoshi
+		ratio         float64
+	}{
+		{local: 300, remote: 100, ratio: 3},
+		{local: 0, remote: 100, ratio: 0},
+		{local: 100, remote: 0, ratio: math.Inf(1)},
+		{local: 0, remote: 0, ratio: 1},
+	}
+	for _, test := range tests {
+		ratio := feeRateRatio(test.local, test.remote)
+		if ratio != test.ratio {
+			t.Fatalf("expected ratio %v of %v and %v, got %v",
+				test.ratio, test.local, test.remote, ratio)
+		}
+	}
+}
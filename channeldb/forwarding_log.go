@@ -80,19 +80,32 @@ type ForwardingEvent struct {
 }
 
 // encodeForwardingEvent writes out the target forwarding event to the passed
-// io.Writer, using the expected DB format. Note that the timestamp isn't
-// serialized as this will be the key value within the bucket.
+// io.Writer, using the codec registered for forwarding events.
 func encodeForwardingEvent(w io.Writer, f *ForwardingEvent) error {
+	return codecFor(ForwardingEventRecord).Encode(w, f)
+}
+
+// decodeForwardingEvent attempts to decode the raw bytes of a serialized
+// forwarding event into the target ForwardingEvent, using the codec
+// registered for forwarding events.
+func decodeForwardingEvent(r io.Reader, f *ForwardingEvent) error {
+	return codecFor(ForwardingEventRecord).Decode(r, f)
+}
+
+// encodeForwardingEventBinary writes out the target forwarding event to the
+// passed io.Writer, using the expected DB format. Note that the timestamp
+// isn't serialized as this will be the key value within the bucket.
+func encodeForwardingEventBinary(w io.Writer, f *ForwardingEvent) error {
 	return WriteElements(
 		w, f.IncomingChanID, f.OutgoingChanID, f.AmtIn, f.AmtOut,
 	)
 }
 
-// decodeForwardingEvent attempts to decode the raw bytes of a serialized
-// forwarding event into the target ForwardingEvent. Note that the timestamp
-// won't be decoded, as the caller is expected to set this due to the bucket
-// structure of the forwarding log.
-func decodeForwardingEvent(r io.Reader, f *ForwardingEvent) error {
+// decodeForwardingEventBinary attempts to decode the raw bytes of a
+// serialized forwarding event into the target ForwardingEvent. Note that the
+// timestamp won't be decoded, as the caller is expected to set this due to the
+// bucket structure of the forwarding log.
+func decodeForwardingEventBinary(r io.Reader, f *ForwardingEvent) error {
 	return ReadElements(
 		r, &f.IncomingChanID, &f.OutgoingChanID, &f.AmtIn, &f.AmtOut,
 	)
@@ -100,7 +113,9 @@ func decodeForwardingEvent(r io.Reader, f *ForwardingEvent) error {
 
 // AddForwardingEvents adds a series of forwarding events to the database.
 // Before inserting, the set of events will be sorted according to their
-// timestamp. This ensures that all writes to disk are sequential.
+// timestamp. This ensures that all writes to disk are sequential. Should the
+// events fail to be written while the dead letter queue is enabled, they're
+// queued to be added by a later retry.
 func (f *ForwardingLog) AddForwardingEvents(events []ForwardingEvent) error {
 	// Before we create the database transaction, we'll ensure that the set
 	// of forwarding events are properly sorted according to their
@@ -109,44 +124,53 @@ func (f *ForwardingLog) AddForwardingEvents(events []ForwardingEvent) error {
 		return events[i].Timestamp.Before(events[j].Timestamp)
 	})
 
-	var timestamp [8]byte
+	err := f.db.Batch(func(tx *bbolt.Tx) error {
+		return putForwardingEvents(tx, events)
+	})
+
+	return f.db.deferWrite(err, &forwardingEventsLetter{
+		events: events,
+	})
+}
+
+// putForwardingEvents writes the series of forwarding events to the
+// forwarding log within the passed transaction.
+func putForwardingEvents(tx *bbolt.Tx, events []ForwardingEvent) error {
+	// First, we'll fetch the bucket that stores our time series log.
+	logBucket, err := tx.CreateBucketIfNotExists(forwardingLogBucket)
+	if err != nil {
+		return err
+	}
 
-	return f.db.Batch(func(tx *bbolt.Tx) error {
-		// First, we'll fetch the bucket that stores our time series
-		// log.
-		logBucket, err := tx.CreateBucketIfNotExists(
-			forwardingLogBucket,
+	// With the bucket obtained, we can now begin to write out the series
+	// of events.
+	var timestamp [8]byte
+	for _, event := range events {
+		var eventBytes [forwardingEventSize]byte
+		eventBuf := bytes.NewBuffer(eventBytes[0:0:forwardingEventSize])
+
+		// First, we'll serialize this timestamp into our timestamp
+		// buffer.
+		byteOrder.PutUint64(
+			timestamp[:], uint64(event.Timestamp.UnixNano()),
 		)
+
+		// With the key encoded, we'll then encode the event into our
+		// buffer, then write it out to disk.
+		err := encodeForwardingEvent(eventBuf, &event)
 		if err != nil {
 			return err
 		}
-
-		// With the bucket obtained, we can now begin to write out the
-		// series of events.
-		for _, event := range events {
-			var eventBytes [forwardingEventSize]byte
-			eventBuf := bytes.NewBuffer(eventBytes[0:0:forwardingEventSize])
-
-			// First, we'll serialize this timestamp into our
-			// timestamp buffer.
-			byteOrder.PutUint64(
-				timestamp[:], uint64(event.Timestamp.UnixNano()),
-			)
-
-			// With the key encoded, we'll then encode the event
-			// into our buffer, then write it out to disk.
-			err := encodeForwardingEvent(eventBuf, &event)
-			if err != nil {
-				return err
-			}
-			err = logBucket.Put(timestamp[:], eventBuf.Bytes())
-			if err != nil {
-				return err
-			}
+		err = checksumPut(
+			tx, forwardingLogBucket, logBucket, timestamp[:],
+			eventBuf.Bytes(),
+		)
+		if err != nil {
+			return err
 		}
+	}
 
-		return nil
-	})
+	return putForwardingChanIndex(tx, events)
 }
 
 // ForwardingEventQuery represents a query to the forwarding log payment
@@ -0,0 +1,110 @@
+package channeldb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestExportForwardingLogJSON asserts that the forwarding events within the
+// queried range are exported as one JSON object per line, in timestamp order.
+func TestExportForwardingLogJSON(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	// Nothing should be exported before any event has been logged.
+	var b bytes.Buffer
+	err = db.ExportForwardingLogJSON(&b, time.Unix(0, 0), time.Now())
+	if err != nil {
+		t.Fatalf("unable to export forwarding log: %v", err)
+	}
+	if b.Len() != 0 {
+		t.Fatalf("expected empty export, got %q", b.String())
+	}
+
+	// We'll log ten events, spaced a minute apart, and added in reverse
+	// order.
+	const numEvents = 10
+	initialTime := time.Unix(1234, 0)
+	events := make([]ForwardingEvent, numEvents)
+	for i := 0; i < numEvents; i++ {
+		events[numEvents-1-i] = ForwardingEvent{
+			Timestamp: initialTime.Add(
+				time.Duration(i) * time.Minute,
+			),
+			IncomingChanID: lnwire.NewShortChanIDFromInt(uint64(i)),
+			OutgoingChanID: lnwire.NewShortChanIDFromInt(
+				uint64(i + 100),
+			),
+			AmtIn:  lnwire.MilliSatoshi(1000 + i),
+			AmtOut: 1000,
+		}
+	}
+	if err := db.ForwardingLog().AddForwardingEvents(events); err != nil {
+		t.Fatalf("unable to add events: %v", err)
+	}
+
+	// Exporting all but the first and last events should yield the
+	// remaining events in order.
+	start := initialTime.Add(time.Minute)
+	end := initialTime.Add((numEvents - 2) * time.Minute)
+	if err := db.ExportForwardingLogJSON(&b, start, end); err != nil {
+		t.Fatalf("unable to export forwarding log: %v", err)
+	}
+
+	// Exporting the same range again should yield identical output.
+	var reExport bytes.Buffer
+	err = db.ExportForwardingLogJSON(&reExport, start, end)
+	if err != nil {
+		t.Fatalf("unable to export forwarding log: %v", err)
+	}
+	if !bytes.Equal(b.Bytes(), reExport.Bytes()) {
+		t.Fatalf("forwarding log export isn't deterministic")
+	}
+
+	var numExported int
+	scanner := bufio.NewScanner(&b)
+	for scanner.Scan() {
+		var event jsonForwardingEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("unable to decode line %q: %v",
+				scanner.Text(), err)
+		}
+
+		i := numExported + 1
+		expected := jsonForwardingEvent{
+			Timestamp: initialTime.Add(
+				time.Duration(i) * time.Minute,
+			),
+			IncomingChanID: uint64(i),
+			OutgoingChanID: uint64(i + 100),
+			AmtIn:          lnwire.MilliSatoshi(1000 + i),
+			AmtOut:         1000,
+			Fee:            lnwire.MilliSatoshi(i),
+			Type:           forwardingEventTypeSettle,
+		}
+		if !event.Timestamp.Equal(expected.Timestamp) {
+			t.Fatalf("expected timestamp %v, got %v",
+				expected.Timestamp, event.Timestamp)
+		}
+		event.Timestamp = expected.Timestamp
+		if event != expected {
+			t.Fatalf("expected event %v, got %v", expected, event)
+		}
+
+		numExported++
+	}
+	if numExported != numEvents-2 {
+		t.Fatalf("expected %v events, got %v", numEvents-2,
+			numExported)
+	}
+}
@@ -0,0 +1,314 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+var (
+	// ErrConflictingForwardingQuery is returned when running a forwarding
+	// query whose constraints can't all be satisfied, or that constrains
+	// the same dimension twice with different values.
+	ErrConflictingForwardingQuery = fmt.Errorf("conflicting forwarding " +
+		"query constraints")
+
+	// ErrInvalidForwardingQueryLimit is returned when limiting a
+	// forwarding query to either no events or more than
+	// MaxResponseEvents events.
+	ErrInvalidForwardingQueryLimit = fmt.Errorf("forwarding query limit "+
+		"must be between 1 and %v", MaxResponseEvents)
+)
+
+// ForwardingQuery is a query to the forwarding log that's built by chaining
+// filters, each of which narrows down the events that are returned. A query
+// is created by NewQuery and executed by Run.
+//
+// The forwarding log is only indexed by time, so the time range set by Since
+// and Until is the only index-accelerated filter: only the events within the
+// range are read from disk. All other filters are applied to each event read,
+// and a query lacking a time range scans the entire log.
+type ForwardingQuery struct {
+	log *ForwardingLog
+
+	// start and end are the inclusive bounds of the time range, if set.
+	start, end *time.Time
+
+	// incoming and outgoing are the channels the incoming and outgoing leg
+	// of the circuit must go through, if set.
+	incoming, outgoing *lnwire.ShortChannelID
+
+	// channel is a channel either leg of the circuit must go through, if
+	// set.
+	channel *lnwire.ShortChannelID
+
+	// peer is the peer of the channel of either leg of the circuit, if
+	// set.
+	peer *[33]byte
+
+	// minAmt and maxAmt are the inclusive bounds of the amount forwarded.
+	minAmt, maxAmt lnwire.MilliSatoshi
+
+	// limit is the max number of events returned.
+	limit uint32
+
+	// err is the first error encountered while building the query. It's
+	// returned by Run.
+	err error
+}
+
+// NewQuery returns a query that matches all events within the forwarding log,
+// up to MaxResponseEvents of them.
+func (f *ForwardingLog) NewQuery() *ForwardingQuery {
+	return &ForwardingQuery{
+		log:    f,
+		maxAmt: math.MaxUint64,
+		limit:  MaxResponseEvents,
+	}
+}
+
+// Since restricts the query to events at or after the passed time.
+func (q *ForwardingQuery) Since(start time.Time) *ForwardingQuery {
+	if q.start != nil && !q.start.Equal(start) {
+		q.fail(ErrConflictingForwardingQuery)
+	}
+	q.start = &start
+
+	return q
+}
+
+// Until restricts the query to events at or before the passed time.
+func (q *ForwardingQuery) Until(end time.Time) *ForwardingQuery {
+	if q.end != nil && !q.end.Equal(end) {
+		q.fail(ErrConflictingForwardingQuery)
+	}
+	q.end = &end
+
+	return q
+}
+
+// IncomingChannel restricts the query to circuits that came in through the
+// passed channel.
+func (q *ForwardingQuery) IncomingChannel(
+	chanID lnwire.ShortChannelID) *ForwardingQuery {
+
+	q.setChannel(&q.incoming, chanID)
+	return q
+}
+
+// OutgoingChannel restricts the query to circuits that went out through the
+// passed channel.
+func (q *ForwardingQuery) OutgoingChannel(
+	chanID lnwire.ShortChannelID) *ForwardingQuery {
+
+	q.setChannel(&q.outgoing, chanID)
+	return q
+}
+
+// Channel restricts the query to circuits that either came in or went out
+// through the passed channel.
+func (q *ForwardingQuery) Channel(
+	chanID lnwire.ShortChannelID) *ForwardingQuery {
+
+	q.setChannel(&q.channel, chanID)
+	return q
+}
+
+// Peer restricts the query to circuits that either came in or went out
+// through a channel with the passed peer. Channels are mapped to peers
+// through both open and closed channels.
+func (q *ForwardingQuery) Peer(peer [33]byte) *ForwardingQuery {
+	if q.peer != nil && *q.peer != peer {
+		q.fail(ErrConflictingForwardingQuery)
+	}
+	q.peer = &peer
+
+	return q
+}
+
+// MinAmount restricts the query to circuits that forwarded at least the
+// passed amount, the amount of their outgoing HTLC.
+func (q *ForwardingQuery) MinAmount(amt lnwire.MilliSatoshi) *ForwardingQuery {
+	if amt > q.minAmt {
+		q.minAmt = amt
+	}
+
+	return q
+}
+
+// MaxAmount restricts the query to circuits that forwarded at most the passed
+// amount, the amount of their outgoing HTLC.
+func (q *ForwardingQuery) MaxAmount(amt lnwire.MilliSatoshi) *ForwardingQuery {
+	if amt < q.maxAmt {
+		q.maxAmt = amt
+	}
+
+	return q
+}
+
+// Limit restricts the query to return at most the passed number of events,
+// which must lie between 1 and MaxResponseEvents.
+func (q *ForwardingQuery) Limit(limit uint32) *ForwardingQuery {
+	if limit == 0 || limit > MaxResponseEvents {
+		q.fail(ErrInvalidForwardingQueryLimit)
+	}
+	q.limit = limit
+
+	return q
+}
+
+// Run executes the query, returning the matching events in the order of their
+// timestamps.
+func (q *ForwardingQuery) Run() ([]ForwardingEvent, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+
+	var events []ForwardingEvent
+	err := q.log.db.View(func(tx *bbolt.Tx) error {
+		logBucket := tx.Bucket(forwardingLogBucket)
+		if logBucket == nil {
+			return nil
+		}
+
+		var chanPeers map[uint64][33]byte
+		if q.peer != nil {
+			var err error
+			chanPeers, err = fetchChanPeers(tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		startKey, endKey := q.timeRange()
+		c := logBucket.Cursor()
+		for k, v := c.Seek(startKey[:]); k != nil &&
+			bytes.Compare(k, endKey[:]) <= 0; k, v = c.Next() {
+
+			timestamp := time.Unix(0, int64(byteOrder.Uint64(k)))
+
+			readBuf := bytes.NewReader(v)
+			for readBuf.Len() != 0 {
+				var event ForwardingEvent
+				err := decodeForwardingEvent(readBuf, &event)
+				if err != nil {
+					return err
+				}
+				event.Timestamp = timestamp
+
+				if !q.matches(&event, chanPeers) {
+					continue
+				}
+
+				events = append(events, event)
+				if uint32(len(events)) >= q.limit {
+					return nil
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// setChannel sets the channel filter pointed to by filter, failing the query
+// if it's already set to a different channel.
+func (q *ForwardingQuery) setChannel(filter **lnwire.ShortChannelID,
+	chanID lnwire.ShortChannelID) {
+
+	if *filter != nil && **filter != chanID {
+		q.fail(ErrConflictingForwardingQuery)
+	}
+	*filter = &chanID
+}
+
+// fail records the first error encountered while building the query.
+func (q *ForwardingQuery) fail(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
+
+// validate returns an error if the query was built with conflicting
+// constraints.
+func (q *ForwardingQuery) validate() error {
+	if q.err != nil {
+		return q.err
+	}
+
+	if q.start != nil && q.end != nil && q.start.After(*q.end) {
+		return ErrConflictingForwardingQuery
+	}
+	if q.minAmt > q.maxAmt {
+		return ErrConflictingForwardingQuery
+	}
+
+	// If both legs are fixed, a channel required on either leg must be
+	// one of them.
+	if q.channel != nil && q.incoming != nil && q.outgoing != nil &&
+		*q.channel != *q.incoming && *q.channel != *q.outgoing {
+
+		return ErrConflictingForwardingQuery
+	}
+
+	return nil
+}
+
+// timeRange returns the inclusive range of keys within the forwarding log
+// that's scanned by the query.
+func (q *ForwardingQuery) timeRange() ([8]byte, [8]byte) {
+	var startKey, endKey [8]byte
+	if q.start != nil {
+		byteOrder.PutUint64(startKey[:], uint64(q.start.UnixNano()))
+	}
+
+	byteOrder.PutUint64(endKey[:], math.MaxUint64)
+	if q.end != nil {
+		byteOrder.PutUint64(endKey[:], uint64(q.end.UnixNano()))
+	}
+
+	return startKey, endKey
+}
+
+// matches returns true if the event satisfies all filters of the query that
+// aren't accelerated by the time index.
+func (q *ForwardingQuery) matches(event *ForwardingEvent,
+	chanPeers map[uint64][33]byte) bool {
+
+	if q.incoming != nil && event.IncomingChanID != *q.incoming {
+		return false
+	}
+	if q.outgoing != nil && event.OutgoingChanID != *q.outgoing {
+		return false
+	}
+	if q.channel != nil && event.IncomingChanID != *q.channel &&
+		event.OutgoingChanID != *q.channel {
+
+		return false
+	}
+
+	if event.AmtOut < q.minAmt || event.AmtOut > q.maxAmt {
+		return false
+	}
+
+	if q.peer != nil {
+		inPeer, inOk := chanPeers[event.IncomingChanID.ToUint64()]
+		outPeer, outOk := chanPeers[event.OutgoingChanID.ToUint64()]
+		if !(inOk && inPeer == *q.peer) &&
+			!(outOk && outPeer == *q.peer) {
+
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,240 @@
+package channeldb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestForwardingQuery asserts that each filter of a forwarding query narrows
+// down the returned events, and that filters combine.
+func TestForwardingQuery(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	// We'll create a channel with each of two peers, through which all
+	// events are forwarded, with the exception of a channel unknown to
+	// the database.
+	priv, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	var channels [2]*OpenChannel
+	for i := range channels {
+		channels[i], err = createTestChannelState(db)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		channels[i].ShortChannelID = lnwire.NewShortChanIDFromInt(
+			uint64(100 + i),
+		)
+		if i == 1 {
+			channels[i].IdentityPub = priv.PubKey()
+		}
+		if err := channels[i].FullSync(); err != nil {
+			t.Fatalf("unable to save channel state: %v", err)
+		}
+	}
+	chanA := channels[0].ShortChannelID
+	chanB := channels[1].ShortChannelID
+	unknownChan := lnwire.NewShortChanIDFromInt(1)
+
+	var peerB [33]byte
+	copy(peerB[:], priv.PubKey().SerializeCompressed())
+
+	start := time.Unix(1000, 0)
+	events := []ForwardingEvent{
+		{
+			Timestamp:      start,
+			IncomingChanID: chanA,
+			OutgoingChanID: chanB,
+			AmtIn:          1000,
+			AmtOut:         990,
+		},
+		{
+			Timestamp:      start.Add(time.Minute),
+			IncomingChanID: chanB,
+			OutgoingChanID: chanA,
+			AmtIn:          2000,
+			AmtOut:         1980,
+		},
+		{
+			Timestamp:      start.Add(2 * time.Minute),
+			IncomingChanID: unknownChan,
+			OutgoingChanID: chanA,
+			AmtIn:          500,
+			AmtOut:         495,
+		},
+		{
+			Timestamp:      start.Add(time.Hour),
+			IncomingChanID: chanA,
+			OutgoingChanID: unknownChan,
+			AmtIn:          100000,
+			AmtOut:         99000,
+		},
+	}
+	fwdLog := db.ForwardingLog()
+	if err := fwdLog.AddForwardingEvents(events); err != nil {
+		t.Fatalf("unable to add events: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    *ForwardingQuery
+		expected []int
+	}{
+		{
+			name:     "all",
+			query:    fwdLog.NewQuery(),
+			expected: []int{0, 1, 2, 3},
+		},
+		{
+			name: "time range",
+			query: fwdLog.NewQuery().
+				Since(start.Add(time.Minute)).
+				Until(start.Add(2 * time.Minute)),
+			expected: []int{1, 2},
+		},
+		{
+			name:     "incoming channel",
+			query:    fwdLog.NewQuery().IncomingChannel(chanA),
+			expected: []int{0, 3},
+		},
+		{
+			name:     "outgoing channel",
+			query:    fwdLog.NewQuery().OutgoingChannel(chanA),
+			expected: []int{1, 2},
+		},
+		{
+			name:     "either channel",
+			query:    fwdLog.NewQuery().Channel(unknownChan),
+			expected: []int{2, 3},
+		},
+		{
+			name:     "peer",
+			query:    fwdLog.NewQuery().Peer(peerB),
+			expected: []int{0, 1},
+		},
+		{
+			name: "amount range",
+			query: fwdLog.NewQuery().
+				MinAmount(495).
+				MaxAmount(1980),
+			expected: []int{0, 1, 2},
+		},
+		{
+			name: "combined",
+			query: fwdLog.NewQuery().
+				Until(start.Add(2 * time.Minute)).
+				OutgoingChannel(chanA).
+				MinAmount(1000),
+			expected: []int{1},
+		},
+		{
+			name:     "limit",
+			query:    fwdLog.NewQuery().Channel(chanA).Limit(2),
+			expected: []int{0, 1},
+		},
+	}
+
+	for _, test := range tests {
+		result, err := test.query.Run()
+		if err != nil {
+			t.Fatalf("%v: unable to run query: %v", test.name, err)
+		}
+
+		var expected []ForwardingEvent
+		for _, i := range test.expected {
+			expected = append(expected, events[i])
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("%v: expected %v, got %v", test.name,
+				spew.Sdump(expected), spew.Sdump(result))
+		}
+	}
+}
+
+// TestForwardingQueryConflicts asserts that queries with conflicting or
+// invalid constraints are rejected when run.
+func TestForwardingQueryConflicts(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	fwdLog := db.ForwardingLog()
+	start := time.Unix(1000, 0)
+	chanA := lnwire.NewShortChanIDFromInt(1)
+	chanB := lnwire.NewShortChanIDFromInt(2)
+	chanC := lnwire.NewShortChanIDFromInt(3)
+
+	tests := []struct {
+		name  string
+		query *ForwardingQuery
+		err   error
+	}{
+		{
+			name: "inverted time range",
+			query: fwdLog.NewQuery().
+				Since(start.Add(time.Minute)).
+				Until(start),
+			err: ErrConflictingForwardingQuery,
+		},
+		{
+			name: "start set twice",
+			query: fwdLog.NewQuery().
+				Since(start).
+				Since(start.Add(time.Second)),
+			err: ErrConflictingForwardingQuery,
+		},
+		{
+			name: "incoming channel set twice",
+			query: fwdLog.NewQuery().
+				IncomingChannel(chanA).
+				IncomingChannel(chanB),
+			err: ErrConflictingForwardingQuery,
+		},
+		{
+			name: "channel outside of both legs",
+			query: fwdLog.NewQuery().
+				IncomingChannel(chanA).
+				OutgoingChannel(chanB).
+				Channel(chanC),
+			err: ErrConflictingForwardingQuery,
+		},
+		{
+			name:  "inverted amount range",
+			query: fwdLog.NewQuery().MinAmount(2).MaxAmount(1),
+			err:   ErrConflictingForwardingQuery,
+		},
+		{
+			name:  "zero limit",
+			query: fwdLog.NewQuery().Limit(0),
+			err:   ErrInvalidForwardingQueryLimit,
+		},
+		{
+			name:  "limit too large",
+			query: fwdLog.NewQuery().Limit(MaxResponseEvents + 1),
+			err:   ErrInvalidForwardingQueryLimit,
+		},
+	}
+
+	for _, test := range tests {
+		if _, err := test.query.Run(); err != test.err {
+			t.Fatalf("%v: expected %v, got %v", test.name, test.err,
+				err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// ErrInvalidRouteCount is returned when querying for a non-positive number of
+// top fee routes.
+var ErrInvalidRouteCount = fmt.Errorf("number of routes must be positive")
+
+// RouteFee aggregates the forwarding events of a single route through our
+// node, identified by the channels circuits came in and went out through.
+type RouteFee struct {
+	// IncomingChanID is the channel circuits came in through.
+	IncomingChanID lnwire.ShortChannelID
+
+	// OutgoingChanID is the channel circuits went out through.
+	OutgoingChanID lnwire.ShortChannelID
+
+	// TotalFees is the total fees earned on the route.
+	TotalFees lnwire.MilliSatoshi
+
+	// NumForwards is the number of circuits forwarded along the route.
+	NumForwards uint64
+}
+
+// TopFeeRoutes returns the n routes through our node that earned the most
+// fees within the inclusive time range, where a route is the pair of channels
+// a circuit came in and went out through. Routes are sorted by their total
+// fees in descending order, with ties broken by the number of forwards, and
+// then by the channel IDs of the route. Fewer than n routes are returned if
+// fewer were taken. If the fees of a route exceed the range of a uint64,
+// ErrAmountOverflow is returned.
+func (d *DB) TopFeeRoutes(n int, start, end time.Time) ([]RouteFee, error) {
+	if n <= 0 {
+		return nil, ErrInvalidRouteCount
+	}
+
+	type routeKey struct {
+		incoming uint64
+		outgoing uint64
+	}
+
+	var routes map[routeKey]*RouteFee
+	addRoute := func(event *ForwardingEvent) error {
+		key := routeKey{
+			incoming: event.IncomingChanID.ToUint64(),
+			outgoing: event.OutgoingChanID.ToUint64(),
+		}
+		route, ok := routes[key]
+		if !ok {
+			route = &RouteFee{
+				IncomingChanID: event.IncomingChanID,
+				OutgoingChanID: event.OutgoingChanID,
+			}
+			routes[key] = route
+		}
+
+		fee, err := subAmount(event.AmtIn, event.AmtOut)
+		if err != nil {
+			return err
+		}
+
+		route.NumForwards++
+		route.TotalFees, err = addAmount(route.TotalFees, fee)
+		return err
+	}
+
+	err := d.View(func(tx *bbolt.Tx) error {
+		routes = make(map[routeKey]*RouteFee)
+
+		logBucket := tx.Bucket(forwardingLogBucket)
+		if logBucket == nil {
+			return nil
+		}
+
+		var startTime, endTime [8]byte
+		byteOrder.PutUint64(startTime[:], uint64(start.UnixNano()))
+		byteOrder.PutUint64(endTime[:], uint64(end.UnixNano()))
+
+		c := logBucket.Cursor()
+		for k, v := c.Seek(startTime[:]); k != nil &&
+			bytes.Compare(k, endTime[:]) <= 0; k, v = c.Next() {
+
+			readBuf := bytes.NewReader(v)
+			for readBuf.Len() != 0 {
+				var event ForwardingEvent
+				err := decodeForwardingEvent(readBuf, &event)
+				if err != nil {
+					return err
+				}
+
+				if err := addRoute(&event); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	topRoutes := make([]RouteFee, 0, len(routes))
+	for _, route := range routes {
+		topRoutes = append(topRoutes, *route)
+	}
+	sort.Slice(topRoutes, func(i, j int) bool {
+		a, b := topRoutes[i], topRoutes[j]
+		switch {
+		case a.TotalFees != b.TotalFees:
+			return a.TotalFees > b.TotalFees
+		case a.NumForwards != b.NumForwards:
+			return a.NumForwards > b.NumForwards
+		}
+
+		aIn := a.IncomingChanID.ToUint64()
+		bIn := b.IncomingChanID.ToUint64()
+		if aIn != bIn {
+			return aIn < bIn
+		}
+		return a.OutgoingChanID.ToUint64() < b.OutgoingChanID.ToUint64()
+	})
+	if len(topRoutes) > n {
+		topRoutes = topRoutes[:n]
+	}
+
+	return topRoutes, nil
+}
@@ -0,0 +1,112 @@
+package channeldb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestTopFeeRoutes asserts that forwarding events within the queried range are
+// grouped by their pair of channels, and that the routes that earned the most
+// fees are returned first.
+func TestTopFeeRoutes(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	start := time.Unix(1000, 0)
+	end := start.Add(time.Hour)
+
+	routes, err := db.TopFeeRoutes(10, start, end)
+	if err != nil {
+		t.Fatalf("unable to fetch top fee routes: %v", err)
+	}
+	if len(routes) != 0 {
+		t.Fatalf("expected no routes, got %v", len(routes))
+	}
+
+	chanA := lnwire.NewShortChanIDFromInt(1)
+	chanB := lnwire.NewShortChanIDFromInt(2)
+	chanC := lnwire.NewShortChanIDFromInt(3)
+	event := func(offset time.Duration, in, out lnwire.ShortChannelID,
+		fee lnwire.MilliSatoshi) ForwardingEvent {
+
+		return ForwardingEvent{
+			Timestamp:      start.Add(offset),
+			IncomingChanID: in,
+			OutgoingChanID: out,
+			AmtIn:          10000 + fee,
+			AmtOut:         10000,
+		}
+	}
+	events := []ForwardingEvent{
+		event(0, chanA, chanB, 10),
+		event(time.Minute, chanA, chanB, 15),
+		event(2*time.Minute, chanB, chanA, 20),
+		event(3*time.Minute, chanA, chanC, 5),
+		event(4*time.Minute, chanC, chanA, 5),
+
+		// Events outside of the range aren't aggregated.
+		event(-time.Minute, chanA, chanC, 100),
+		event(2*time.Hour, chanA, chanC, 100),
+	}
+	if err := db.ForwardingLog().AddForwardingEvents(events); err != nil {
+		t.Fatalf("unable to add events: %v", err)
+	}
+
+	routes, err = db.TopFeeRoutes(10, start, end)
+	if err != nil {
+		t.Fatalf("unable to fetch top fee routes: %v", err)
+	}
+	expected := []RouteFee{
+		{
+			IncomingChanID: chanA,
+			OutgoingChanID: chanB,
+			TotalFees:      25,
+			NumForwards:    2,
+		},
+		{
+			IncomingChanID: chanB,
+			OutgoingChanID: chanA,
+			TotalFees:      20,
+			NumForwards:    1,
+		},
+		{
+			IncomingChanID: chanA,
+			OutgoingChanID: chanC,
+			TotalFees:      5,
+			NumForwards:    1,
+		},
+		{
+			IncomingChanID: chanC,
+			OutgoingChanID: chanA,
+			TotalFees:      5,
+			NumForwards:    1,
+		},
+	}
+	if !reflect.DeepEqual(routes, expected) {
+		t.Fatalf("expected routes %v, got %v", spew.Sdump(expected),
+			spew.Sdump(routes))
+	}
+
+	routes, err = db.TopFeeRoutes(2, start, end)
+	if err != nil {
+		t.Fatalf("unable to fetch top fee routes: %v", err)
+	}
+	if !reflect.DeepEqual(routes, expected[:2]) {
+		t.Fatalf("expected routes %v, got %v", spew.Sdump(expected[:2]),
+			spew.Sdump(routes))
+	}
+
+	_, err = db.TopFeeRoutes(0, start, end)
+	if err != ErrInvalidRouteCount {
+		t.Fatalf("expected ErrInvalidRouteCount, got %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package channeldb
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// VolumeStats aggregates the forwarding events a peer took part in, split by
+// whether the peer's channel was the incoming or outgoing leg of the circuit.
+type VolumeStats struct {
+	// NumInbound is the number of circuits that came in through a channel
+	// with the peer.
+	NumInbound uint64
+
+	// InboundAmt is the total amount the peer sent us for circuits that
+	// came in through its channels.
+	InboundAmt lnwire.MilliSatoshi
+
+	// InboundFees is the total fees earned on circuits that came in
+	// through a channel with the peer.
+	InboundFees lnwire.MilliSatoshi
+
+	// NumOutbound is the number of circuits that went out through a
+	// channel with the peer.
+	NumOutbound uint64
+
+	// OutboundAmt is the total amount we sent to the peer for circuits
+	// that went out through its channels.
+	OutboundAmt lnwire.MilliSatoshi
+
+	// OutboundFees is the total fees earned on circuits that went out
+	// through a channel with the peer.
+	OutboundFees lnwire.MilliSatoshi
+}
+
+// ForwardingVolumeByPeer aggregates all forwarding events within the inclusive
+// time range by the peers of the channels they went through. The fee of a
+// circuit is attributed to both its incoming and outgoing peer. Channels are
+// mapped to peers through both open and closed channels, and events through
+// channels that are unknown to the database are skipped. If any of the
+// aggregated amounts exceeds the range of a uint64, ErrAmountOverflow is
+// returned.
+func (d *DB) ForwardingVolumeByPeer(start, end time.Time) (
+	map[[33]byte]VolumeStats, error) {
+
+	volumes := make(map[[33]byte]VolumeStats)
+	err := d.View(func(tx *bbolt.Tx) error {
+		logBucket := tx.Bucket(forwardingLogBucket)
+		if logBucket == nil {
+			return nil
+		}
+
+		chanPeers, err := fetchChanPeers(tx)
+		if err != nil {
+			return err
+		}
+
+		var startTime, endTime [8]byte
+		byteOrder.PutUint64(startTime[:], uint64(start.UnixNano()))
+		byteOrder.PutUint64(endTime[:], uint64(end.UnixNano()))
+
+		c := logBucket.Cursor()
+		for k, v := c.Seek(startTime[:]); k != nil &&
+			bytes.Compare(k, endTime[:]) <= 0; k, v = c.Next() {
+
+			readBuf := bytes.NewReader(v)
+			for readBuf.Len() != 0 {
+				var event ForwardingEvent
+				err := decodeForwardingEvent(readBuf, &event)
+				if err != nil {
+					return err
+				}
+				fee, err := subAmount(event.AmtIn, event.AmtOut)
+				if err != nil {
+					return err
+				}
+
+				incomingID := event.IncomingChanID.ToUint64()
+				if peer, ok := chanPeers[incomingID]; ok {
+					stats := volumes[peer]
+					stats.NumInbound++
+					stats.InboundAmt, err = addAmount(
+						stats.InboundAmt, event.AmtIn,
+					)
+					if err != nil {
+						return err
+					}
+					stats.InboundFees, err = addAmount(
+						stats.InboundFees, fee,
+					)
+					if err != nil {
+						return err
+					}
+					volumes[peer] = stats
+				}
+
+				outgoingID := event.OutgoingChanID.ToUint64()
+				if peer, ok := chanPeers[outgoingID]; ok {
+					stats := volumes[peer]
+					stats.NumOutbound++
+					stats.OutboundAmt, err = addAmount(
+						stats.OutboundAmt, event.AmtOut,
+					)
+					if err != nil {
+						return err
+					}
+					stats.OutboundFees, err = addAmount(
+						stats.OutboundFees, fee,
+					)
+					if err != nil {
+						return err
+					}
+					volumes[peer] = stats
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return volumes, nil
+}
+
+// fetchChanPeers maps the short channel IDs of all open and closed channels to
+// the public keys of their peers.
+func fetchChanPeers(tx *bbolt.Tx) (map[uint64][33]byte, error) {
+	chanPeers := make(map[uint64][33]byte)
+
+	addOpenChannel := func(_ wire.OutPoint,
+		chanBucket *bbolt.Bucket) error {
+
+		var channel OpenChannel
+		if err := fetchChanInfo(chanBucket, &channel); err != nil {
+			return err
+		}
+
+		var peer [33]byte
+		copy(peer[:], channel.IdentityPub.SerializeCompressed())
+		chanPeers[channel.ShortChannelID.ToUint64()] = peer
+
+		return nil
+	}
+	openChanBucket := tx.Bucket(openChannelBucket)
+	if openChanBucket != nil {
+		err := forEachChanBucket(openChanBucket, addOpenChannel)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	closeBucket := tx.Bucket(closedChannelBucket)
+	if closeBucket == nil {
+		return chanPeers, nil
+	}
+	err := closeBucket.ForEach(func(_, summaryBytes []byte) error {
+		summary, err := deserializeCloseChannelSummary(
+			bytes.NewReader(summaryBytes),
+		)
+		if err != nil {
+			return err
+		}
+
+		var peer [33]byte
+		copy(peer[:], summary.RemotePub.SerializeCompressed())
+		chanPeers[summary.ShortChanID.ToUint64()] = peer
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return chanPeers, nil
+}
@@ -0,0 +1,189 @@
+package channeldb
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestForwardingVolumeByPeer asserts that forwarding events are attributed to
+// the peers of both their open and closed channels, and that only events
+// within the queried range are aggregated.
+func TestForwardingVolumeByPeer(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	// We'll create an open channel with each of two peers, and a closed
+	// channel with the first peer.
+	priv, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	var channels [3]*OpenChannel
+	for i := range channels {
+		channels[i], err = createTestChannelState(db)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		if i == 1 {
+			channels[i].IdentityPub = priv.PubKey()
+		}
+		if err := channels[i].FullSync(); err != nil {
+			t.Fatalf("unable to save channel state: %v", err)
+		}
+	}
+	closed := channels[2]
+	err = closed.CloseChannel(&ChannelCloseSummary{
+		ChanPoint:      closed.FundingOutpoint,
+		ShortChanID:    closed.ShortChannelID,
+		RemotePub:      closed.IdentityPub,
+		SettledBalance: btcutil.Amount(500),
+		CloseType:      CooperativeClose,
+	})
+	if err != nil {
+		t.Fatalf("unable to close channel: %v", err)
+	}
+
+	var peerA, peerB [33]byte
+	copy(peerA[:], channels[0].IdentityPub.SerializeCompressed())
+	copy(peerB[:], channels[1].IdentityPub.SerializeCompressed())
+
+	start := time.Unix(1000, 0)
+	unknownChan := lnwire.NewShortChanIDFromInt(1)
+	events := []ForwardingEvent{
+		{
+			Timestamp:      start,
+			IncomingChanID: channels[0].ShortChannelID,
+			OutgoingChanID: channels[1].ShortChannelID,
+			AmtIn:          1000,
+			AmtOut:         990,
+		},
+		{
+			Timestamp:      start.Add(time.Minute),
+			IncomingChanID: channels[1].ShortChannelID,
+			OutgoingChanID: closed.ShortChannelID,
+			AmtIn:          2000,
+			AmtOut:         1980,
+		},
+		{
+			Timestamp:      start.Add(2 * time.Minute),
+			IncomingChanID: unknownChan,
+			OutgoingChanID: channels[0].ShortChannelID,
+			AmtIn:          500,
+			AmtOut:         495,
+		},
+		{
+			Timestamp:      start.Add(time.Hour),
+			IncomingChanID: channels[0].ShortChannelID,
+			OutgoingChanID: channels[1].ShortChannelID,
+			AmtIn:          100000,
+			AmtOut:         99000,
+		},
+	}
+	if err := db.ForwardingLog().AddForwardingEvents(events); err != nil {
+		t.Fatalf("unable to add events: %v", err)
+	}
+
+	volumes, err := db.ForwardingVolumeByPeer(
+		start, start.Add(2*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("unable to query forwarding volume: %v", err)
+	}
+
+	expected := map[[33]byte]VolumeStats{
+		peerA: {
+			NumInbound:   1,
+			InboundAmt:   1000,
+			InboundFees:  10,
+			NumOutbound:  2,
+			OutboundAmt:  2475,
+			OutboundFees: 25,
+		},
+		peerB: {
+			NumInbound:   1,
+			InboundAmt:   2000,
+			InboundFees:  20,
+			NumOutbound:  1,
+			OutboundAmt:  990,
+			OutboundFees: 10,
+		},
+	}
+	if !reflect.DeepEqual(volumes, expected) {
+		t.Fatalf("unexpected volumes: expected %v, got %v",
+			spew.Sdump(expected), spew.Sdump(volumes))
+	}
+}
+
+// TestForwardingVolumeOverflow asserts that aggregating forwarding events
+// whose total amount exceeds the range of a uint64 fails with
+// ErrAmountOverflow, rather than returning a wrapped total.
+func TestForwardingVolumeOverflow(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	channel, err := createTestChannelState(db)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	if err := channel.FullSync(); err != nil {
+		t.Fatalf("unable to save channel state: %v", err)
+	}
+
+	// Each of the two events comes in through the channel with more than
+	// half the range of a uint64, so a naive sum would wrap around.
+	start := time.Unix(1000, 0)
+	amt := lnwire.MilliSatoshi(math.MaxUint64/2 + 1)
+	events := []ForwardingEvent{
+		{
+			Timestamp:      start,
+			IncomingChanID: channel.ShortChannelID,
+			OutgoingChanID: lnwire.NewShortChanIDFromInt(1),
+			AmtIn:          amt,
+			AmtOut:         amt - 10,
+		},
+		{
+			Timestamp:      start.Add(time.Minute),
+			IncomingChanID: channel.ShortChannelID,
+			OutgoingChanID: lnwire.NewShortChanIDFromInt(1),
+			AmtIn:          amt,
+			AmtOut:         amt - 10,
+		},
+	}
+	if err := db.ForwardingLog().AddForwardingEvents(events); err != nil {
+		t.Fatalf("unable to add events: %v", err)
+	}
+
+	// A single event still fits, and should be aggregated as usual.
+	volumes, err := db.ForwardingVolumeByPeer(start, start)
+	if err != nil {
+		t.Fatalf("unable to query forwarding volume: %v", err)
+	}
+	var peer [33]byte
+	copy(peer[:], channel.IdentityPub.SerializeCompressed())
+	if volumes[peer].InboundAmt != amt {
+		t.Fatalf("expected inbound amount %v, got %v", amt,
+			volumes[peer].InboundAmt)
+	}
+
+	_, err = db.ForwardingVolumeByPeer(start, start.Add(time.Minute))
+	if err != ErrAmountOverflow {
+		t.Fatalf("expected ErrAmountOverflow, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package channeldb
+
+import (
+	"github.com/coreos/bbolt"
+)
+
+// FragReport describes the page usage of the database file, which indicates
+// whether compacting the database would reclaim a significant amount of
+// space.
+type FragReport struct {
+	// PageSize is the size of a single page in bytes.
+	PageSize int
+
+	// TotalPages is the number of pages the database file consists of.
+	TotalPages uint64
+
+	// FreePages is the number of pages that are no longer in use, either
+	// free or pending to be freed once all readers referencing them have
+	// finished.
+	FreePages uint64
+
+	// BucketPages maps the name of each top-level bucket to the number of
+	// pages it occupies, including overflow pages. Buckets small enough
+	// to be stored inline within their parent occupy no pages.
+	BucketPages map[string]uint64
+
+	// Fragmentation is the ratio of free to used pages. The larger the
+	// ratio, the more space would be reclaimed by compacting the database.
+	Fragmentation float64
+}
+
+// Fragmentation reports the page usage of the database file, as obtained by
+// the statistics of bolt's freelist and B+trees. It's read-only, though the
+// page counts of each top-level bucket require a walk over its pages.
+func (d *DB) Fragmentation() (*FragReport, error) {
+	report := &FragReport{
+		BucketPages: make(map[string]uint64),
+	}
+
+	err := d.View(func(tx *bbolt.Tx) error {
+		report.PageSize = tx.DB().Info().PageSize
+		report.TotalPages = uint64(tx.Size()) / uint64(report.PageSize)
+
+		stats := tx.DB().Stats()
+		report.FreePages = uint64(stats.FreePageN + stats.PendingPageN)
+
+		return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			stats := b.Stats()
+			numPages := stats.BranchPageN + stats.BranchOverflowN +
+				stats.LeafPageN + stats.LeafOverflowN
+			report.BucketPages[string(name)] = uint64(numPages)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if report.FreePages < report.TotalPages {
+		usedPages := report.TotalPages - report.FreePages
+		report.Fragmentation = float64(report.FreePages) /
+			float64(usedPages)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,85 @@
+package channeldb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/coreos/bbolt"
+)
+
+// TestFragmentation asserts that the pages occupied by a bucket are reported,
+// and that they're reported as free once the bucket is deleted.
+func TestFragmentation(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+
+	// We'll fill a bucket with enough data to span many pages.
+	testBucket := []byte("test-frag-bucket")
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucket(testBucket)
+		if err != nil {
+			return err
+		}
+
+		value := bytes.Repeat([]byte{1}, 1024)
+		for i := uint32(0); i < 1000; i++ {
+			var k [4]byte
+			byteOrder.PutUint32(k[:], i)
+			if err := bucket.Put(k[:], value); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to populate bucket: %v", err)
+	}
+
+	report, err := db.Fragmentation()
+	if err != nil {
+		t.Fatalf("unable to fetch fragmentation report: %v", err)
+	}
+	numPages := report.BucketPages[string(testBucket)]
+	minPages := uint64(1000 * 1024 / report.PageSize)
+	if numPages < minPages {
+		t.Fatalf("expected bucket to span at least %v pages, got %v",
+			minPages, numPages)
+	}
+	if report.TotalPages < numPages {
+		t.Fatalf("expected at least %v total pages, got %v", numPages,
+			report.TotalPages)
+	}
+
+	// Once the bucket is deleted, its pages should be reported as free.
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return tx.DeleteBucket(testBucket)
+	})
+	if err != nil {
+		t.Fatalf("unable to delete bucket: %v", err)
+	}
+
+	report, err = db.Fragmentation()
+	if err != nil {
+		t.Fatalf("unable to fetch fragmentation report: %v", err)
+	}
+	if _, ok := report.BucketPages[string(testBucket)]; ok {
+		t.Fatalf("expected deleted bucket to be omitted")
+	}
+	if report.FreePages < numPages {
+		t.Fatalf("expected at least %v free pages, got %v", numPages,
+			report.FreePages)
+	}
+
+	usedPages := report.TotalPages - report.FreePages
+	expected := float64(report.FreePages) / float64(usedPages)
+	if report.Fragmentation != expected {
+		t.Fatalf("expected fragmentation %v, got %v", expected,
+			report.Fragmentation)
+	}
+}
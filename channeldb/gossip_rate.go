@@ -0,0 +1,222 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// gossipRateBucket is the top-level bucket that stores the times at
+	// which gossip messages were received from each peer. Each peer has
+	// its own sub-bucket, which holds an entry per message keyed by the
+	// time it was received, followed by a sequence number to keep
+	// messages received at the same time apart. The value is the kind of
+	// the message.
+	//
+	// maps: peerPub => recvTime || seqNo => gossipKind
+	gossipRateBucket = []byte("gossip-rate")
+
+	// ErrUnknownGossipKind is returned when recording a gossip message of
+	// an unknown kind.
+	ErrUnknownGossipKind = fmt.Errorf("unknown gossip kind")
+
+	// ErrGossipRateWindowTooLarge is returned when the rate of gossip
+	// messages is queried over a window exceeding MaxGossipRateWindow.
+	ErrGossipRateWindowTooLarge = fmt.Errorf("gossip rate window exceeds "+
+		"max of %v", MaxGossipRateWindow)
+)
+
+const (
+	// MaxGossipRateWindow is the largest window over which the rate of
+	// gossip messages can be queried. Messages received before this are
+	// trimmed as new ones are recorded.
+	MaxGossipRateWindow = 24 * time.Hour
+)
+
+// GossipKind is the kind of a gossip message received from a peer.
+type GossipKind uint8
+
+const (
+	// GossipNodeAnnouncement is a node announcement.
+	GossipNodeAnnouncement GossipKind = 0
+
+	// GossipChannelAnnouncement is a channel announcement.
+	GossipChannelAnnouncement GossipKind = 1
+
+	// GossipChannelUpdate is a channel update.
+	GossipChannelUpdate GossipKind = 2
+)
+
+// String returns a human readable identifier for the GossipKind type.
+func (g GossipKind) String() string {
+	switch g {
+	case GossipNodeAnnouncement:
+		return "NodeAnnouncement"
+	case GossipChannelAnnouncement:
+		return "ChannelAnnouncement"
+	case GossipChannelUpdate:
+		return "ChannelUpdate"
+	}
+
+	return "Unknown"
+}
+
+// RecordGossip records the receipt of a gossip message of the given kind from
+// the peer at the passed time. Any messages recorded for the peer that have
+// fallen out of MaxGossipRateWindow are trimmed along the way. If the write
+// fails while the dead letter queue is enabled, the message is queued for a
+// later retry instead.
+func (d *DB) RecordGossip(pub [33]byte, kind GossipKind, t time.Time) error {
+	if kind > GossipChannelUpdate {
+		return ErrUnknownGossipKind
+	}
+
+	err := d.Batch(func(tx *bbolt.Tx) error {
+		return putGossipMsg(tx, pub, kind, t)
+	})
+
+	return d.deferWrite(err, &gossipLetter{
+		pub:     pub,
+		msgKind: kind,
+		t:       t,
+	})
+}
+
+// putGossipMsg records the receipt of a gossip message within the passed
+// transaction.
+func putGossipMsg(tx *bbolt.Tx, pub [33]byte, kind GossipKind,
+	t time.Time) error {
+
+	rates, err := tx.CreateBucketIfNotExists(gossipRateBucket)
+	if err != nil {
+		return err
+	}
+	msgs, err := rates.CreateBucketIfNotExists(pub[:])
+	if err != nil {
+		return err
+	}
+
+	seqNo, err := msgs.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	var msgKey [16]byte
+	byteOrder.PutUint64(msgKey[:8], uint64(t.UnixNano()))
+	byteOrder.PutUint64(msgKey[8:], seqNo)
+	if err := msgs.Put(msgKey[:], []byte{byte(kind)}); err != nil {
+		return err
+	}
+
+	return trimTimeSeries(msgs, t.Add(-MaxGossipRateWindow))
+}
+
+// GossipRate returns the number of gossip messages of each kind received from
+// the peer within the window preceding now, including those received at now.
+// The window may not exceed MaxGossipRateWindow.
+func (d *DB) GossipRate(pub [33]byte, window time.Duration,
+	now time.Time) (map[GossipKind]uint64, error) {
+
+	if window > MaxGossipRateWindow {
+		return nil, ErrGossipRateWindowTooLarge
+	}
+
+	counts := make(map[GossipKind]uint64)
+	err := d.View(func(tx *bbolt.Tx) error {
+		rates := tx.Bucket(gossipRateBucket)
+		if rates == nil {
+			return nil
+		}
+		msgs := rates.Bucket(pub[:])
+		if msgs == nil {
+			return nil
+		}
+
+		countKind := func(kind GossipKind) {
+			counts[kind]++
+		}
+
+		return forEachGossipMsg(msgs, window, now, countKind)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// PeersExceedingGossipRate returns the peers that sent more than threshold
+// gossip messages of any kind within the window preceding now, along with the
+// number of messages each of them sent. The window may not exceed
+// MaxGossipRateWindow.
+func (d *DB) PeersExceedingGossipRate(threshold uint64, window time.Duration,
+	now time.Time) (map[[33]byte]uint64, error) {
+
+	if window > MaxGossipRateWindow {
+		return nil, ErrGossipRateWindowTooLarge
+	}
+
+	peers := make(map[[33]byte]uint64)
+	err := d.View(func(tx *bbolt.Tx) error {
+		rates := tx.Bucket(gossipRateBucket)
+		if rates == nil {
+			return nil
+		}
+
+		return rates.ForEach(func(pub, v []byte) error {
+			if v != nil || len(pub) != 33 {
+				return nil
+			}
+
+			var numMsgs uint64
+			err := forEachGossipMsg(
+				rates.Bucket(pub), window, now,
+				func(GossipKind) {
+					numMsgs++
+				},
+			)
+			if err != nil {
+				return err
+			}
+
+			if numMsgs > threshold {
+				var peer [33]byte
+				copy(peer[:], pub)
+				peers[peer] = numMsgs
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return peers, nil
+}
+
+// forEachGossipMsg calls cb with the kind of each gossip message of a peer
+// that was received within the window preceding now.
+func forEachGossipMsg(msgs *bbolt.Bucket, window time.Duration,
+	now time.Time, cb func(GossipKind)) error {
+
+	var start, end [8]byte
+	startTime := now.Add(-window)
+	byteOrder.PutUint64(start[:], uint64(startTime.UnixNano()))
+	byteOrder.PutUint64(end[:], uint64(now.UnixNano()))
+
+	c := msgs.Cursor()
+	for k, v := c.Seek(start[:]); k != nil &&
+		bytes.Compare(k[:8], end[:]) <= 0; k, v = c.Next() {
+
+		if len(v) != 1 {
+			return fmt.Errorf("invalid gossip message entry %x", k)
+		}
+		cb(GossipKind(v[0]))
+	}
+
+	return nil
+}
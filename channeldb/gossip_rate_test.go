@@ -0,0 +1,119 @@
+package channeldb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestGossipRate asserts that gossip messages are counted per kind within the
+// queried window, and that peers exceeding a threshold are reported.
+func TestGossipRate(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+
+	var spammyPeer, quietPeer [33]byte
+	spammyPeer[0], quietPeer[0] = 2, 3
+	now := time.Unix(1500000000, 0)
+
+	// The spammy peer sends two channel updates at the same time, along
+	// with a node announcement a minute later, while the quiet peer only
+	// sends a channel announcement.
+	msgs := []struct {
+		pub  [33]byte
+		kind GossipKind
+		t    time.Time
+	}{
+		{spammyPeer, GossipChannelUpdate, now},
+		{spammyPeer, GossipChannelUpdate, now},
+		{spammyPeer, GossipNodeAnnouncement, now.Add(time.Minute)},
+		{quietPeer, GossipChannelAnnouncement, now},
+	}
+	for _, msg := range msgs {
+		err := db.RecordGossip(msg.pub, msg.kind, msg.t)
+		if err != nil {
+			t.Fatalf("unable to record gossip: %v", err)
+		}
+	}
+
+	assertRate := func(pub [33]byte, window time.Duration, at time.Time,
+		expected map[GossipKind]uint64) {
+
+		t.Helper()
+
+		counts, err := db.GossipRate(pub, window, at)
+		if err != nil {
+			t.Fatalf("unable to fetch gossip rate: %v", err)
+		}
+		if !reflect.DeepEqual(counts, expected) {
+			t.Fatalf("expected counts %v, got %v", expected, counts)
+		}
+	}
+	assertRate(spammyPeer, time.Minute, now.Add(time.Minute),
+		map[GossipKind]uint64{
+			GossipChannelUpdate:    2,
+			GossipNodeAnnouncement: 1,
+		},
+	)
+	assertRate(spammyPeer, time.Second, now.Add(time.Minute),
+		map[GossipKind]uint64{GossipNodeAnnouncement: 1},
+	)
+	assertRate(quietPeer, time.Minute, now,
+		map[GossipKind]uint64{GossipChannelAnnouncement: 1},
+	)
+
+	assertExceeding := func(threshold uint64, window time.Duration,
+		at time.Time, expected map[[33]byte]uint64) {
+
+		t.Helper()
+
+		peers, err := db.PeersExceedingGossipRate(threshold, window, at)
+		if err != nil {
+			t.Fatalf("unable to fetch peers exceeding rate: %v",
+				err)
+		}
+		if !reflect.DeepEqual(peers, expected) {
+			t.Fatalf("expected peers %v, got %v", expected, peers)
+		}
+	}
+	assertExceeding(1, time.Minute, now.Add(time.Minute),
+		map[[33]byte]uint64{spammyPeer: 3},
+	)
+	assertExceeding(0, time.Minute, now, map[[33]byte]uint64{
+		spammyPeer: 2,
+		quietPeer:  1,
+	})
+	assertExceeding(3, time.Minute, now.Add(time.Minute),
+		map[[33]byte]uint64{},
+	)
+
+	// Once the max window has passed, a new message should cause the old
+	// ones of the peer to be trimmed.
+	later := now.Add(MaxGossipRateWindow + time.Hour)
+	err = db.RecordGossip(spammyPeer, GossipChannelUpdate, later)
+	if err != nil {
+		t.Fatalf("unable to record gossip: %v", err)
+	}
+	assertRate(spammyPeer, MaxGossipRateWindow, later.Add(-2*time.Hour),
+		map[GossipKind]uint64{},
+	)
+
+	// Unknown kinds and windows exceeding the max should be rejected.
+	err = db.RecordGossip(spammyPeer, GossipChannelUpdate+1, now)
+	if err != ErrUnknownGossipKind {
+		t.Fatalf("expected ErrUnknownGossipKind, got %v", err)
+	}
+	_, err = db.GossipRate(spammyPeer, MaxGossipRateWindow+1, now)
+	if err != ErrGossipRateWindowTooLarge {
+		t.Fatalf("expected ErrGossipRateWindowTooLarge, got %v", err)
+	}
+	_, err = db.PeersExceedingGossipRate(0, MaxGossipRateWindow+1, now)
+	if err != ErrGossipRateWindowTooLarge {
+		t.Fatalf("expected ErrGossipRateWindowTooLarge, got %v", err)
+	}
+}
@@ -41,7 +41,7 @@ var (
 	// update to the network. The bucket only contains keys, and no values,
 	// it's mapping:
 	//
-	// maps: updateTime || nodeID -> nil
+	// maps: updateTime || len(nodeID) || nodeID -> nil
 	nodeUpdateIndexBucket = []byte("graph-node-update-index")
 
 	// sourceKey is a special key that resides within the nodeBucket. The
@@ -326,7 +326,7 @@ func (c *ChannelGraph) sourceNode(nodes *bbolt.Bucket) (*LightningNode, error) {
 func (c *ChannelGraph) SetSourceNode(node *LightningNode) error {
 	nodePubBytes := node.PubKeyBytes[:]
 
-	return c.db.Update(func(tx *bbolt.Tx) error {
+	return c.db.updateGraph(func(tx *bbolt.Tx) error {
 		// First grab the nodes bucket which stores the mapping from
 		// pubKey to node information.
 		nodes, err := tx.CreateBucketIfNotExists(nodeBucket)
@@ -342,7 +342,7 @@ func (c *ChannelGraph) SetSourceNode(node *LightningNode) error {
 
 		// Finally, we commit the information of the lightning node
 		// itself.
-		return addLightningNode(tx, node)
+		return addLightningNode(tx, node, c.db.updateIndexCache)
 	})
 }
 
@@ -355,12 +355,14 @@ func (c *ChannelGraph) SetSourceNode(node *LightningNode) error {
 //
 // TODO(roasbeef): also need sig of announcement
 func (c *ChannelGraph) AddLightningNode(node *LightningNode) error {
-	return c.db.Update(func(tx *bbolt.Tx) error {
-		return addLightningNode(tx, node)
+	return c.db.updateGraph(func(tx *bbolt.Tx) error {
+		return addLightningNode(tx, node, c.db.updateIndexCache)
 	})
 }
 
-func addLightningNode(tx *bbolt.Tx, node *LightningNode) error {
+func addLightningNode(tx *bbolt.Tx, node *LightningNode,
+	cache *updateIndexCache) error {
+
 	nodes, err := tx.CreateBucketIfNotExists(nodeBucket)
 	if err != nil {
 		return err
@@ -378,7 +380,7 @@ func addLightningNode(tx *bbolt.Tx, node *LightningNode) error {
 		return err
 	}
 
-	return putLightningNode(nodes, aliases, updateIndex, node)
+	return putLightningNode(nodes, aliases, updateIndex, node, cache)
 }
 
 // LookupAlias attempts to return the alias as advertised by the target node.
@@ -419,7 +421,7 @@ func (c *ChannelGraph) LookupAlias(pub *btcec.PublicKey) (string, error) {
 // from the database according to the node's public key.
 func (c *ChannelGraph) DeleteLightningNode(nodePub *btcec.PublicKey) error {
 	// TODO(roasbeef): ensure dangling edges are removed...
-	return c.db.Update(func(tx *bbolt.Tx) error {
+	return c.db.updateGraph(func(tx *bbolt.Tx) error {
 		nodes := tx.Bucket(nodeBucket)
 		if nodes == nil {
 			return ErrGraphNodeNotFound
@@ -453,6 +455,13 @@ func (c *ChannelGraph) deleteLightningNode(nodes *bbolt.Bucket,
 		return err
 	}
 
+	err = updateNodeAddrTypeIndex(
+		nodes, compressedPubKey, node.Addresses, nil,
+	)
+	if err != nil {
+		return err
+	}
+
 	if err := nodes.Delete(compressedPubKey); err != nil {
 
 		return err
@@ -469,11 +478,11 @@ func (c *ChannelGraph) deleteLightningNode(nodes *bbolt.Bucket,
 	// In order to delete the entry, we'll need to reconstruct the key for
 	// its last update.
 	updateUnix := uint64(node.LastUpdate.Unix())
-	var indexKey [8 + 33]byte
-	byteOrder.PutUint64(indexKey[:8], updateUnix)
-	copy(indexKey[8:], compressedPubKey)
 
-	return nodeUpdateIndex.Delete(indexKey[:])
+	return deleteNodeUpdateIndexKey(
+		nodeUpdateIndex, c.db.updateIndexCache, updateUnix,
+		compressedPubKey,
+	)
 }
 
 // AddChannelEdge adds a new (undirected, blank) edge to the graph database. An
@@ -483,7 +492,7 @@ func (c *ChannelGraph) deleteLightningNode(nodes *bbolt.Bucket,
 // the channel supports. The chanPoint and chanID are used to uniquely identify
 // the edge globally within the database.
 func (c *ChannelGraph) AddChannelEdge(edge *ChannelEdgeInfo) error {
-	return c.db.Update(func(tx *bbolt.Tx) error {
+	return c.db.updateGraph(func(tx *bbolt.Tx) error {
 		return c.addChannelEdge(tx, edge)
 	})
 }
@@ -529,7 +538,9 @@ func (c *ChannelGraph) addChannelEdge(tx *bbolt.Tx, edge *ChannelEdgeInfo) error
 			PubKeyBytes:          edge.NodeKey1Bytes,
 			HaveNodeAnnouncement: false,
 		}
-		err := addLightningNode(tx, &node1Shell)
+		err := addLightningNode(
+			tx, &node1Shell, c.db.updateIndexCache,
+		)
 		if err != nil {
 			return fmt.Errorf("unable to create shell node "+
 				"for: %x", edge.NodeKey1Bytes)
@@ -546,7 +557,9 @@ func (c *ChannelGraph) addChannelEdge(tx *bbolt.Tx, edge *ChannelEdgeInfo) error
 			PubKeyBytes:          edge.NodeKey2Bytes,
 			HaveNodeAnnouncement: false,
 		}
-		err := addLightningNode(tx, &node2Shell)
+		err := addLightningNode(
+			tx, &node2Shell, c.db.updateIndexCache,
+		)
 		if err != nil {
 			return fmt.Errorf("unable to create shell node "+
 				"for: %x", edge.NodeKey2Bytes)
@@ -577,11 +590,9 @@ func (c *ChannelGraph) addChannelEdge(tx *bbolt.Tx, edge *ChannelEdgeInfo) error
 
 	// Finally we add it to the channel index which maps channel points
 	// (outpoints) to the shorter channel ID's.
-	var b bytes.Buffer
-	if err := writeOutpoint(&b, &edge.ChannelPoint); err != nil {
-		return err
-	}
-	return chanIndex.Put(b.Bytes(), chanKey[:])
+	return chanIndex.Put(
+		canonicalChannelKey(edge.ChannelPoint), chanKey[:],
+	)
 }
 
 // HasChannelEdge returns true if the database knows of a channel edge with the
@@ -676,6 +687,93 @@ func (c *ChannelGraph) UpdateChannelEdge(edge *ChannelEdgeInfo) error {
 	})
 }
 
+// UpdateEdgeCapacity sets the capacity of the channel edge identified by
+// chanID to newCap, e.g. after the channel has been spliced. Only the capacity
+// field of the serialized edge info is overwritten, all other fields of the
+// edge as well as its policies are left untouched. If the edge doesn't exist,
+// ErrEdgeNotFound is returned.
+func (c *ChannelGraph) UpdateEdgeCapacity(chanID uint64,
+	newCap btcutil.Amount) error {
+
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		return putEdgeCapacity(tx, chanID, newCap)
+	})
+}
+
+// putEdgeCapacity overwrites the capacity field of the serialized info of the
+// channel edge identified by chanID within the passed transaction.
+func putEdgeCapacity(tx *bbolt.Tx, chanID uint64, newCap btcutil.Amount) error {
+	var chanKey [8]byte
+	byteOrder.PutUint64(chanKey[:], chanID)
+
+	edges := tx.Bucket(edgeBucket)
+	if edges == nil {
+		return ErrEdgeNotFound
+	}
+
+	edgeIndex := edges.Bucket(edgeIndexBucket)
+	if edgeIndex == nil {
+		return ErrEdgeNotFound
+	}
+
+	edgeInfoBytes := edgeIndex.Get(chanKey[:])
+	if edgeInfoBytes == nil {
+		return ErrEdgeNotFound
+	}
+
+	offset, err := edgeInfoCapacityOffset(edgeInfoBytes)
+	if err != nil {
+		return err
+	}
+
+	// The slice returned by bolt is only valid for the lifetime of the
+	// transaction and must not be modified, so we'll patch a copy of it
+	// instead.
+	updated := make([]byte, len(edgeInfoBytes))
+	copy(updated, edgeInfoBytes)
+	byteOrder.PutUint64(updated[offset:offset+8], uint64(newCap))
+
+	return edgeIndex.Put(chanKey[:], updated)
+}
+
+// edgeInfoCapacityOffset returns the offset of the capacity field within the
+// passed serialized edge info. As the fields preceding it are partially of
+// variable length, we'll skip over them one by one.
+func edgeInfoCapacityOffset(edgeInfoBytes []byte) (int, error) {
+	r := bytes.NewReader(edgeInfoBytes)
+
+	// First, skip the two node keys and the two bitcoin keys.
+	if _, err := r.Seek(33*4, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	// Next come the feature vector and the four signatures of the auth
+	// proof, all of which are prefixed by their length.
+	for i := 0; i < 5; i++ {
+		length, err := wire.ReadVarInt(r, 0)
+		if err != nil {
+			return 0, err
+		}
+		if length > uint64(r.Len()) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if _, err := r.Seek(int64(length), io.SeekCurrent); err != nil {
+			return 0, err
+		}
+	}
+
+	// Finally, the channel point directly precedes the capacity.
+	var chanPoint wire.OutPoint
+	if err := readOutpoint(r, &chanPoint); err != nil {
+		return 0, err
+	}
+	if r.Len() < 8 {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	return len(edgeInfoBytes) - r.Len(), nil
+}
+
 const (
 	// pruneTipBytes is the total size of the value which stores a prune
 	// entry of the graph in the prune log. The "prune tip" is the last
@@ -697,7 +795,7 @@ func (c *ChannelGraph) PruneGraph(spentOutputs []*wire.OutPoint,
 
 	var chansClosed []*ChannelEdgeInfo
 
-	err := c.db.Update(func(tx *bbolt.Tx) error {
+	err := c.db.updateGraph(func(tx *bbolt.Tx) error {
 		// First grab the edges bucket which houses the information
 		// we'd like to delete
 		edges, err := tx.CreateBucketIfNotExists(edgeBucket)
@@ -726,14 +824,9 @@ func (c *ChannelGraph) PruneGraph(spentOutputs []*wire.OutPoint,
 			// TODO(roasbeef): load channel bloom filter, continue
 			// if NOT if filter
 
-			var opBytes bytes.Buffer
-			if err := writeOutpoint(&opBytes, chanPoint); err != nil {
-				return nil
-			}
-
 			// First attempt to see if the channel exists within
 			// the database, if not, then we can exit early.
-			chanID := chanIndex.Get(opBytes.Bytes())
+			chanID := chanIndex.Get(canonicalChannelKey(*chanPoint))
 			if chanID == nil {
 				continue
 			}
@@ -752,6 +845,7 @@ func (c *ChannelGraph) PruneGraph(spentOutputs []*wire.OutPoint,
 			// was successfully pruned.
 			err = delChannelByEdge(
 				edges, edgeIndex, chanIndex, nodes, chanPoint,
+				c.db.updateIndexCache,
 			)
 			if err != nil && err != ErrEdgeNotFound {
 				return err
@@ -801,7 +895,7 @@ func (c *ChannelGraph) PruneGraph(spentOutputs []*wire.OutPoint,
 // that we only maintain a graph of reachable nodes. In the event that a pruned
 // node gains more channels, it will be re-added back to the graph.
 func (c *ChannelGraph) PruneGraphNodes() error {
-	return c.db.Update(func(tx *bbolt.Tx) error {
+	return c.db.updateGraph(func(tx *bbolt.Tx) error {
 		nodes := tx.Bucket(nodeBucket)
 		if nodes == nil {
 			return ErrGraphNodesNotFound
@@ -946,7 +1040,7 @@ func (c *ChannelGraph) DisconnectBlockAtHeight(height uint32) ([]*ChannelEdgeInf
 	// Keep track of the channels that are removed from the graph.
 	var removedChans []*ChannelEdgeInfo
 
-	if err := c.db.Update(func(tx *bbolt.Tx) error {
+	if err := c.db.updateGraph(func(tx *bbolt.Tx) error {
 		edges, err := tx.CreateBucketIfNotExists(edgeBucket)
 		if err != nil {
 			return err
@@ -976,7 +1070,8 @@ func (c *ChannelGraph) DisconnectBlockAtHeight(height uint32) ([]*ChannelEdgeInf
 				return err
 			}
 			err = delChannelByEdge(
-				edges, edgeIndex, chanIndex, nodes, &edgeInfo.ChannelPoint,
+				edges, edgeIndex, chanIndex, nodes,
+				&edgeInfo.ChannelPoint, c.db.updateIndexCache,
 			)
 			if err != nil && err != ErrEdgeNotFound {
 				return err
@@ -1070,7 +1165,7 @@ func (c *ChannelGraph) DeleteChannelEdge(chanPoint *wire.OutPoint) error {
 	// channels
 	// TODO(roasbeef): don't delete both edges?
 
-	return c.db.Update(func(tx *bbolt.Tx) error {
+	return c.db.updateGraph(func(tx *bbolt.Tx) error {
 		// First grab the edges bucket which houses the information
 		// we'd like to delete
 		edges := tx.Bucket(edgeBucket)
@@ -1097,6 +1192,7 @@ func (c *ChannelGraph) DeleteChannelEdge(chanPoint *wire.OutPoint) error {
 
 		return delChannelByEdge(
 			edges, edgeIndex, chanIndex, nodes, chanPoint,
+			c.db.updateIndexCache,
 		)
 	})
 }
@@ -1106,12 +1202,6 @@ func (c *ChannelGraph) DeleteChannelEdge(chanPoint *wire.OutPoint) error {
 // the database, then ErrEdgeNotFound is returned.
 func (c *ChannelGraph) ChannelID(chanPoint *wire.OutPoint) (uint64, error) {
 	var chanID uint64
-
-	var b bytes.Buffer
-	if err := writeOutpoint(&b, chanPoint); err != nil {
-		return 0, nil
-	}
-
 	if err := c.db.View(func(tx *bbolt.Tx) error {
 		edges := tx.Bucket(edgeBucket)
 		if edges == nil {
@@ -1122,7 +1212,7 @@ func (c *ChannelGraph) ChannelID(chanPoint *wire.OutPoint) (uint64, error) {
 			return ErrGraphNoEdgesFound
 		}
 
-		chanIDBytes := chanIndex.Get(b.Bytes())
+		chanIDBytes := chanIndex.Get(canonicalChannelKey(*chanPoint))
 		if chanIDBytes == nil {
 			return ErrEdgeNotFound
 		}
@@ -1204,7 +1294,7 @@ func (c *ChannelGraph) ChanUpdatesInHorizon(startTime, endTime time.Time) ([]Cha
 	edgesSeen := make(map[uint64]struct{})
 	var edgesInHorizon []ChannelEdge
 
-	err := c.db.View(func(tx *bbolt.Tx) error {
+	err := c.db.viewUpdateIndex(func(tx *bbolt.Tx) error {
 		edges := tx.Bucket(edgeBucket)
 		if edges == nil {
 			return ErrGraphNoEdgesFound
@@ -1223,10 +1313,6 @@ func (c *ChannelGraph) ChanUpdatesInHorizon(startTime, endTime time.Time) ([]Cha
 			return ErrGraphNodesNotFound
 		}
 
-		// We'll now obtain a cursor to perform a range query within
-		// the index to find all channels within the horizon.
-		updateCursor := edgeUpdateIndex.Cursor()
-
 		var startTimeBytes, endTimeBytes [8 + 8]byte
 		byteOrder.PutUint64(
 			startTimeBytes[:8], uint64(startTime.Unix()),
@@ -1235,12 +1321,9 @@ func (c *ChannelGraph) ChanUpdatesInHorizon(startTime, endTime time.Time) ([]Cha
 			endTimeBytes[:8], uint64(endTime.Unix()),
 		)
 
-		// With our start and end times constructed, we'll step through
-		// the index collecting the info and policy of each update of
-		// each channel that has a last update within the time range.
-		for indexKey, _ := updateCursor.Seek(startTimeBytes[:]); indexKey != nil &&
-			bytes.Compare(indexKey, endTimeBytes[:]) <= 0; indexKey, _ = updateCursor.Next() {
-
+		// collectEdge gathers the info and policies of the channel
+		// referenced by an entry within the update index.
+		collectEdge := func(indexKey []byte) error {
 			// We have a new eligible entry, so we'll slice of the
 			// chan ID so we can query it in the DB.
 			chanID := indexKey[8:]
@@ -1250,7 +1333,7 @@ func (c *ChannelGraph) ChanUpdatesInHorizon(startTime, endTime time.Time) ([]Cha
 			// so again.
 			chanIDInt := byteOrder.Uint64(chanID)
 			if _, ok := edgesSeen[chanIDInt]; ok {
-				continue
+				return nil
 			}
 
 			// First, we'll fetch the static edge information.
@@ -1282,9 +1365,17 @@ func (c *ChannelGraph) ChanUpdatesInHorizon(startTime, endTime time.Time) ([]Cha
 				Policy1: edge1,
 				Policy2: edge2,
 			})
+
+			return nil
 		}
 
-		return nil
+		// With our start and end times constructed, we'll step through
+		// the index collecting the info and policy of each update of
+		// each channel that has a last update within the time range.
+		return c.db.forEachUpdateIndexKey(
+			edgeUpdateIndex, edgeUpdateIndexKind,
+			startTimeBytes[:], endTimeBytes[:], collectEdge,
+		)
 	})
 	switch {
 	case err == ErrGraphNoEdgesFound:
@@ -1306,7 +1397,7 @@ func (c *ChannelGraph) ChanUpdatesInHorizon(startTime, endTime time.Time) ([]Cha
 func (c *ChannelGraph) NodeUpdatesInHorizon(startTime, endTime time.Time) ([]LightningNode, error) {
 	var nodesInHorizon []LightningNode
 
-	err := c.db.View(func(tx *bbolt.Tx) error {
+	err := c.db.viewUpdateIndex(func(tx *bbolt.Tx) error {
 		nodes := tx.Bucket(nodeBucket)
 		if nodes == nil {
 			return ErrGraphNodesNotFound
@@ -1317,10 +1408,6 @@ func (c *ChannelGraph) NodeUpdatesInHorizon(startTime, endTime time.Time) ([]Lig
 			return ErrGraphNodesNotFound
 		}
 
-		// We'll now obtain a cursor to perform a range query within
-		// the index to find all node announcements within the horizon.
-		updateCursor := nodeUpdateIndex.Cursor()
-
 		var startTimeBytes, endTimeBytes [8 + 33]byte
 		byteOrder.PutUint64(
 			startTimeBytes[:8], uint64(startTime.Unix()),
@@ -1332,20 +1419,27 @@ func (c *ChannelGraph) NodeUpdatesInHorizon(startTime, endTime time.Time) ([]Lig
 		// With our start and end times constructed, we'll step through
 		// the index collecting info for each node within the time
 		// range.
-		for indexKey, _ := updateCursor.Seek(startTimeBytes[:]); indexKey != nil &&
-			bytes.Compare(indexKey, endTimeBytes[:]) <= 0; indexKey, _ = updateCursor.Next() {
+		return c.db.forEachUpdateIndexKey(
+			nodeUpdateIndex, nodeUpdateIndexKind,
+			startTimeBytes[:], endTimeBytes[:],
+			func(indexKey []byte) error {
+				_, nodePub, err := parseNodeUpdateIndexKey(
+					indexKey,
+				)
+				if err != nil {
+					return err
+				}
+				node, err := fetchLightningNode(nodes, nodePub)
+				if err != nil {
+					return err
+				}
+				node.db = c.db
+
+				nodesInHorizon = append(nodesInHorizon, node)
 
-			nodePub := indexKey[8:]
-			node, err := fetchLightningNode(nodes, nodePub)
-			if err != nil {
-				return err
-			}
-			node.db = c.db
-
-			nodesInHorizon = append(nodesInHorizon, node)
-		}
-
-		return nil
+				return nil
+			},
+		)
 	})
 	switch {
 	case err == ErrGraphNoEdgesFound:
@@ -1530,7 +1624,7 @@ func (c *ChannelGraph) FetchChanInfos(chanIDs []uint64) ([]ChannelEdge, error) {
 }
 
 func delEdgeUpdateIndexEntry(edgesBucket *bbolt.Bucket, chanID uint64,
-	edge1, edge2 *ChannelEdgePolicy) error {
+	edge1, edge2 *ChannelEdgePolicy, cache *updateIndexCache) error {
 
 	// First, we'll fetch the edge update index bucket which currently
 	// stores an entry for the channel we're about to delete.
@@ -1553,6 +1647,7 @@ func delEdgeUpdateIndexEntry(edgesBucket *bbolt.Bucket, chanID uint64,
 		if err := updateIndex.Delete(indexKey[:]); err != nil {
 			return err
 		}
+		cache.stageDelete(edgeUpdateIndexKind, indexKey[:])
 	}
 
 	// We'll also attempt to delete the entry that may have been created by
@@ -1562,21 +1657,21 @@ func delEdgeUpdateIndexEntry(edgesBucket *bbolt.Bucket, chanID uint64,
 		if err := updateIndex.Delete(indexKey[:]); err != nil {
 			return err
 		}
+		cache.stageDelete(edgeUpdateIndexKind, indexKey[:])
 	}
 
 	return nil
 }
 
 func delChannelByEdge(edges *bbolt.Bucket, edgeIndex *bbolt.Bucket,
-	chanIndex *bbolt.Bucket, nodes *bbolt.Bucket, chanPoint *wire.OutPoint) error {
-	var b bytes.Buffer
-	if err := writeOutpoint(&b, chanPoint); err != nil {
-		return err
-	}
+	chanIndex *bbolt.Bucket, nodes *bbolt.Bucket, chanPoint *wire.OutPoint,
+	cache *updateIndexCache) error {
+
+	chanPointKey := canonicalChannelKey(*chanPoint)
 
 	// If the channel's outpoint doesn't exist within the outpoint index,
 	// then the edge does not exist.
-	chanID := chanIndex.Get(b.Bytes())
+	chanID := chanIndex.Get(chanPointKey)
 	if chanID == nil {
 		return ErrEdgeNotFound
 	}
@@ -1600,7 +1695,7 @@ func delChannelByEdge(edges *bbolt.Bucket, edgeIndex *bbolt.Bucket,
 	if err != nil {
 		return err
 	}
-	err = delEdgeUpdateIndexEntry(edges, cid, edge1, edge2)
+	err = delEdgeUpdateIndexEntry(edges, cid, edge1, edge2, cache)
 	if err != nil {
 		return err
 	}
@@ -1626,12 +1721,18 @@ func delChannelByEdge(edges *bbolt.Bucket, edgeIndex *bbolt.Bucket,
 		}
 	}
 
+	// The signatures validated for the channel's updates are of no use
+	// once the channel is gone.
+	if err := delValidatedSigs(edges, chanID); err != nil {
+		return err
+	}
+
 	// Finally, with the edge data deleted, we can purge the information
 	// from the two edge indexes.
 	if err := edgeIndex.Delete(chanID); err != nil {
 		return err
 	}
-	return chanIndex.Delete(b.Bytes())
+	return chanIndex.Delete(chanPointKey)
 }
 
 // UpdateEdgePolicy updates the edge routing policy for a single directed edge
@@ -1640,16 +1741,24 @@ func delChannelByEdge(edges *bbolt.Bucket, edgeIndex *bbolt.Bucket,
 // updated. If the flag is 1, then the first node's information is being
 // updated, otherwise it's the second node's information. The node ordering is
 // determined by the lexicographical ordering of the identity public keys of
-// the nodes on either side of the channel.
+// the nodes on either side of the channel. Updates published by the source
+// node are also added to its local policy history.
 func (c *ChannelGraph) UpdateEdgePolicy(edge *ChannelEdgePolicy) error {
-	return c.db.Update(func(tx *bbolt.Tx) error {
-		return updateEdgePolicy(tx, edge)
+	return c.db.updateGraph(func(tx *bbolt.Tx) error {
+		err := updateEdgePolicy(tx, edge, c.db.updateIndexCache)
+		if err != nil {
+			return err
+		}
+
+		return recordLocalPolicy(tx, edge)
 	})
 }
 
 // updateEdgePolicy attempts to update an edge's policy within the relevant
 // buckets using an existing database transaction.
-func updateEdgePolicy(tx *bbolt.Tx, edge *ChannelEdgePolicy) error {
+func updateEdgePolicy(tx *bbolt.Tx, edge *ChannelEdgePolicy,
+	cache *updateIndexCache) error {
+
 	edges := tx.Bucket(edgeBucket)
 	if edges == nil {
 		return ErrEdgeNotFound
@@ -1689,7 +1798,7 @@ func updateEdgePolicy(tx *bbolt.Tx, edge *ChannelEdgePolicy) error {
 
 	// Finally, with the direction of the edge being updated
 	// identified, we update the on-disk edge representation.
-	return putChanEdgePolicy(edges, nodes, edge, fromNode, toNode)
+	return putChanEdgePolicy(edges, nodes, edge, fromNode, toNode, cache)
 }
 
 // LightningNode represents an individual vertex/node within the channel graph.
@@ -2527,11 +2636,7 @@ func (c *ChannelGraph) FetchChannelEdgesByOutpoint(op *wire.OutPoint) (*ChannelE
 		if chanIndex == nil {
 			return ErrGraphNoEdgesFound
 		}
-		var b bytes.Buffer
-		if err := writeOutpoint(&b, op); err != nil {
-			return err
-		}
-		chanID := chanIndex.Get(b.Bytes())
+		chanID := chanIndex.Get(canonicalChannelKey(*op))
 		if chanID == nil {
 			return ErrEdgeNotFound
 		}
@@ -2782,7 +2887,8 @@ func (c *ChannelGraph) NewChannelEdgePolicy() *ChannelEdgePolicy {
 }
 
 func putLightningNode(nodeBucket *bbolt.Bucket, aliasBucket *bbolt.Bucket,
-	updateIndex *bbolt.Bucket, node *LightningNode) error {
+	updateIndex *bbolt.Bucket, node *LightningNode,
+	cache *updateIndexCache) error {
 
 	var (
 		scratch [16]byte
@@ -2795,6 +2901,25 @@ func putLightningNode(nodeBucket *bbolt.Bucket, aliasBucket *bbolt.Bucket,
 	}
 	nodePub := pub.SerializeCompressed()
 
+	// Before the node is overwritten, we'll replace the address type index
+	// entries of its prior addresses with those of its current ones. A
+	// node without an announcement has no known addresses.
+	var oldAddrs, newAddrs []net.Addr
+	oldNode, err := fetchLightningNode(nodeBucket, nodePub)
+	switch {
+	case err == nil:
+		oldAddrs = oldNode.Addresses
+	case err != ErrGraphNodeNotFound:
+		return err
+	}
+	if node.HaveNodeAnnouncement {
+		newAddrs = node.Addresses
+	}
+	err = updateNodeAddrTypeIndex(nodeBucket, nodePub, oldAddrs, newAddrs)
+	if err != nil {
+		return err
+	}
+
 	// If the node has the update time set, write it, else write 0.
 	updateUnix := uint64(0)
 	if node.LastUpdate.Unix() > 0 {
@@ -2883,29 +3008,27 @@ func putLightningNode(nodeBucket *bbolt.Bucket, aliasBucket *bbolt.Bucket,
 
 	// With the alias bucket updated, we'll now update the index that
 	// tracks the time series of node updates.
-	var indexKey [8 + 33]byte
-	byteOrder.PutUint64(indexKey[:8], updateUnix)
-	copy(indexKey[8:], nodePub)
+	indexKey := nodeUpdateIndexKey(updateUnix, nodePub)
 
 	// If there was already an old index entry for this node, then we'll
 	// delete the old one before we write the new entry.
 	if nodeBytes := nodeBucket.Get(nodePub); nodeBytes != nil {
 		// Extract out the old update time to we can reconstruct the
 		// prior index key to delete it from the index.
-		oldUpdateTime := nodeBytes[:8]
+		oldUpdateUnix := byteOrder.Uint64(nodeBytes[:8])
 
-		var oldIndexKey [8 + 33]byte
-		copy(oldIndexKey[:8], oldUpdateTime)
-		copy(oldIndexKey[8:], nodePub)
-
-		if err := updateIndex.Delete(oldIndexKey[:]); err != nil {
+		err := deleteNodeUpdateIndexKey(
+			updateIndex, cache, oldUpdateUnix, nodePub,
+		)
+		if err != nil {
 			return err
 		}
 	}
 
-	if err := updateIndex.Put(indexKey[:], nil); err != nil {
+	if err := updateIndex.Put(indexKey, nil); err != nil {
 		return err
 	}
+	cache.stagePut(nodeUpdateIndexKind, indexKey)
 
 	return nodeBucket.Put(nodePub, b.Bytes())
 }
@@ -3172,7 +3295,7 @@ func deserializeChanEdgeInfo(r io.Reader) (ChannelEdgeInfo, error) {
 }
 
 func putChanEdgePolicy(edges, nodes *bbolt.Bucket, edge *ChannelEdgePolicy,
-	from, to []byte) error {
+	from, to []byte, cache *updateIndexCache) error {
 
 	var edgeKey [33 + 8]byte
 	copy(edgeKey[:], from)
@@ -3227,11 +3350,13 @@ func putChanEdgePolicy(edges, nodes *bbolt.Bucket, edge *ChannelEdgePolicy,
 		if err := updateIndex.Delete(oldIndexKey[:]); err != nil {
 			return err
 		}
+		cache.stageDelete(edgeUpdateIndexKind, oldIndexKey[:])
 	}
 
 	if err := updateIndex.Put(indexKey[:], nil); err != nil {
 		return err
 	}
+	cache.stagePut(edgeUpdateIndexKind, indexKey[:])
 
 	return edges.Put(edgeKey[:], b.Bytes()[:])
 }
@@ -0,0 +1,197 @@
+package channeldb
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/coreos/bbolt"
+)
+
+// ArticulationNodes returns the public keys of the nodes within the graph
+// whose removal would disconnect parts of it that are connected through them,
+// sorted in ascending order. The edge index is streamed into an adjacency
+// structure within a single read transaction, after which the articulation
+// points are found by a depth-first search in memory. Channel policies aren't
+// taken into account, so disabled channels still connect their nodes.
+func (c *ChannelGraph) ArticulationNodes() ([][33]byte, error) {
+	var adj *graphAdjacency
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		adj, err = fetchGraphAdjacency(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return adj.articulationPoints(), nil
+}
+
+// graphAdjacency is an undirected view of the channel graph, with each node
+// referred to by its index within pubs.
+type graphAdjacency struct {
+	pubs      [][33]byte
+	neighbors [][]int
+}
+
+// fetchGraphAdjacency builds the adjacency structure of the graph from the
+// edge index. Parallel channels between the same pair of nodes result in a
+// single link, while channels from a node to itself are skipped.
+func fetchGraphAdjacency(tx *bbolt.Tx) (*graphAdjacency, error) {
+	adj := &graphAdjacency{}
+
+	edges := tx.Bucket(edgeBucket)
+	if edges == nil {
+		return adj, nil
+	}
+	edgeIndex := edges.Bucket(edgeIndexBucket)
+	if edgeIndex == nil {
+		return adj, nil
+	}
+
+	nodeIndexes := make(map[[33]byte]int)
+	nodeIndex := func(pub []byte) int {
+		var key [33]byte
+		copy(key[:], pub)
+
+		i, ok := nodeIndexes[key]
+		if !ok {
+			i = len(adj.pubs)
+			nodeIndexes[key] = i
+			adj.pubs = append(adj.pubs, key)
+			adj.neighbors = append(adj.neighbors, nil)
+		}
+		return i
+	}
+
+	links := make(map[[2]int]struct{})
+	err := edgeIndex.ForEach(func(_, edgeInfo []byte) error {
+		// The edge info starts with the public keys of both nodes.
+		if len(edgeInfo) < 66 {
+			return ErrEdgeNotFound
+		}
+
+		node1 := nodeIndex(edgeInfo[:33])
+		node2 := nodeIndex(edgeInfo[33:66])
+		if node1 == node2 {
+			return nil
+		}
+
+		link := [2]int{node1, node2}
+		if node2 < node1 {
+			link = [2]int{node2, node1}
+		}
+		if _, ok := links[link]; ok {
+			return nil
+		}
+		links[link] = struct{}{}
+
+		adj.neighbors[node1] = append(adj.neighbors[node1], node2)
+		adj.neighbors[node2] = append(adj.neighbors[node2], node1)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return adj, nil
+}
+
+// articulationPoints returns the public keys of the nodes whose removal
+// increases the number of connected components of the graph, sorted in
+// ascending order. The search is iterative rather than recursive, as paths
+// within the graph can be far longer than what's sensible to recurse on.
+func (g *graphAdjacency) articulationPoints() [][33]byte {
+	var (
+		numNodes = len(g.pubs)
+
+		// disc is the time each node is discovered at, starting at
+		// one such that undiscovered nodes have a zero time. low is
+		// the earliest discovery time reachable from the subtree of
+		// each node through at most a single back link.
+		disc   = make([]int, numNodes)
+		low    = make([]int, numNodes)
+		parent = make([]int, numNodes)
+		isCut  = make([]bool, numNodes)
+		timer  int
+	)
+
+	// frame is a node on the search stack, along with the index of the
+	// next neighbor to visit from it.
+	type frame struct {
+		node int
+		next int
+	}
+
+	for root := 0; root < numNodes; root++ {
+		if disc[root] != 0 {
+			continue
+		}
+
+		timer++
+		disc[root], low[root], parent[root] = timer, timer, -1
+		stack := []frame{{node: root}}
+		rootChildren := 0
+
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			v := top.node
+
+			if top.next < len(g.neighbors[v]) {
+				w := g.neighbors[v][top.next]
+				top.next++
+
+				switch {
+				case disc[w] == 0:
+					timer++
+					disc[w], low[w] = timer, timer
+					parent[w] = v
+					stack = append(stack, frame{node: w})
+					if v == root {
+						rootChildren++
+					}
+
+				case w != parent[v] && disc[w] < low[v]:
+					low[v] = disc[w]
+				}
+
+				continue
+			}
+
+			// All neighbors of v have been visited, so we can
+			// propagate its low time to its parent. The parent
+			// separates v's subtree from the rest of the graph if
+			// there's no link from the subtree to above it.
+			stack = stack[:len(stack)-1]
+			p := parent[v]
+			if p == -1 {
+				continue
+			}
+			if low[v] < low[p] {
+				low[p] = low[v]
+			}
+			if p != root && low[v] >= disc[p] {
+				isCut[p] = true
+			}
+		}
+
+		// The root is only an articulation point if the search
+		// started more than one subtree from it.
+		if rootChildren > 1 {
+			isCut[root] = true
+		}
+	}
+
+	var cuts [][33]byte
+	for i, cut := range isCut {
+		if cut {
+			cuts = append(cuts, g.pubs[i])
+		}
+	}
+	sort.Slice(cuts, func(i, j int) bool {
+		return bytes.Compare(cuts[i][:], cuts[j][:]) < 0
+	})
+
+	return cuts
+}
@@ -0,0 +1,83 @@
+package channeldb
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+)
+
+// TestArticulationNodes asserts that exactly the nodes that connect parts of
+// the graph that aren't otherwise connected are returned.
+func TestArticulationNodes(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	graph := db.ChannelGraph()
+
+	cuts, err := graph.ArticulationNodes()
+	if err != nil {
+		t.Fatalf("unable to fetch articulation nodes: %v", err)
+	}
+	if len(cuts) != 0 {
+		t.Fatalf("expected no articulation nodes, got %v", len(cuts))
+	}
+
+	var nodes []*LightningNode
+	for i := 0; i < 7; i++ {
+		node, err := createTestVertex(db)
+		if err != nil {
+			t.Fatalf("unable to create test node: %v", err)
+		}
+		nodes = append(nodes, node)
+	}
+
+	// We'll create the following graph, where node 1 and 3 are
+	// articulation points. The cycle between 1, 2 and 3 means none of its
+	// links disconnect it, while the parallel channels between 0 and 1
+	// don't keep node 1 from separating node 0. Nodes 5 and 6 are a
+	// separate component, and neither is an articulation point.
+	//
+	//     0 == 1 -- 2
+	//           \  |
+	//            \ |
+	//              3 -- 4     5 -- 6
+	links := [][2]int{
+		{0, 1}, {1, 0}, {1, 2}, {2, 3}, {3, 1}, {3, 4}, {5, 6},
+	}
+	for i, link := range links {
+		edgeInfo, _ := createEdge(
+			uint32(100+i), 0, 0, uint32(i), nodes[link[0]],
+			nodes[link[1]],
+		)
+		if err := graph.AddChannelEdge(&edgeInfo); err != nil {
+			t.Fatalf("unable to add channel edge: %v", err)
+		}
+	}
+
+	var expected [][33]byte
+	for _, i := range []int{1, 3} {
+		expected = append(expected, nodes[i].PubKeyBytes)
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		return bytes.Compare(expected[i][:], expected[j][:]) < 0
+	})
+
+	cuts, err = graph.ArticulationNodes()
+	if err != nil {
+		t.Fatalf("unable to fetch articulation nodes: %v", err)
+	}
+	if len(cuts) != len(expected) {
+		t.Fatalf("expected %v articulation nodes, got %v",
+			len(expected), len(cuts))
+	}
+	for i := range expected {
+		if cuts[i] != expected[i] {
+			t.Fatalf("expected articulation node %x, got %x",
+				expected[i], cuts[i])
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package channeldb
+
+import (
+	"crypto/sha256"
+
+	"github.com/coreos/bbolt"
+)
+
+// GraphRootHash computes the root of a Merkle tree over all node
+// announcements and channels within the graph. Two nodes that have the same
+// view of the graph compute the same root, allowing them to cheaply determine
+// whether a full graph sync is needed by exchanging it.
+//
+// The leaves of the tree are ordered canonically by walking the node update
+// index, followed by the edge update index. As both indexes are keyed by
+// signed update times rather than local state, this order is the same across
+// nodes. Each node leaf commits to the index key and the node's record, while
+// each edge leaf commits to the index key, the channel's edge info and both of
+// its policies. Interior nodes are the SHA-256 of the concatenation of their
+// children, with an odd node at the end of a level being carried up as is. An
+// empty graph has an all-zero root.
+//
+// NOTE: The root is recomputed from scratch on every call, as an update to a
+// single record moves its leaf within the canonical order.
+func (c *ChannelGraph) GraphRootHash() ([32]byte, error) {
+	var leaves [][32]byte
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		leaves, err = graphHashLeaves(tx)
+		return err
+	})
+	if err != nil {
+		return [32]byte{}, err
+	}
+
+	return merkleRoot(leaves), nil
+}
+
+// graphHashLeaves returns the leaves of the graph's Merkle tree in canonical
+// order.
+func graphHashLeaves(tx *bbolt.Tx) ([][32]byte, error) {
+	var leaves [][32]byte
+
+	nodes := tx.Bucket(nodeBucket)
+	if nodes == nil {
+		return nil, nil
+	}
+
+	// Each key of the node update index is the update time followed by the
+	// node's identifier. Leaves commit to the key in its length-prefixed
+	// format, such that the root doesn't depend on whether the index has
+	// been transitioned to it yet.
+	nodeUpdateIndex := nodes.Bucket(nodeUpdateIndexBucket)
+	if nodeUpdateIndex != nil {
+		err := nodeUpdateIndex.ForEach(func(k, _ []byte) error {
+			updateUnix, nodePub, err := parseNodeUpdateIndexKey(k)
+			if err != nil {
+				return err
+			}
+
+			h := sha256.New()
+			h.Write(nodeUpdateIndexKey(updateUnix, nodePub))
+			h.Write(nodes.Get(nodePub))
+
+			var leaf [32]byte
+			copy(leaf[:], h.Sum(nil))
+			leaves = append(leaves, leaf)
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	edges := tx.Bucket(edgeBucket)
+	if edges == nil {
+		return leaves, nil
+	}
+	edgeIndex := edges.Bucket(edgeIndexBucket)
+	edgeUpdateIndex := edges.Bucket(edgeUpdateIndexBucket)
+	if edgeIndex == nil || edgeUpdateIndex == nil {
+		return leaves, nil
+	}
+
+	// Each key of the edge update index is the update time followed by
+	// the channel ID.
+	err := edgeUpdateIndex.ForEach(func(k, _ []byte) error {
+		chanID := k[8:]
+		edgeInfo := edgeIndex.Get(chanID)
+		if len(edgeInfo) < 66 {
+			return ErrEdgeNotFound
+		}
+
+		h := sha256.New()
+		h.Write(k)
+		h.Write(edgeInfo)
+
+		// The edge info starts with the public keys of both nodes,
+		// which are used to locate the policy of each direction.
+		var policyKey [33 + 8]byte
+		copy(policyKey[33:], chanID)
+		for _, nodePub := range [][]byte{
+			edgeInfo[:33], edgeInfo[33:66],
+		} {
+			copy(policyKey[:33], nodePub)
+			h.Write(edges.Get(policyKey[:]))
+		}
+
+		var leaf [32]byte
+		copy(leaf[:], h.Sum(nil))
+		leaves = append(leaves, leaf)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return leaves, nil
+}
+
+// merkleRoot computes the root of the Merkle tree with the given leaves.
+func merkleRoot(leaves [][32]byte) [32]byte {
+	if len(leaves) == 0 {
+		return [32]byte{}
+	}
+
+	level := leaves
+	for len(level) > 1 {
+		next := make([][32]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+
+			var pair [64]byte
+			copy(pair[:32], level[i][:])
+			copy(pair[32:], level[i+1][:])
+			next = append(next, sha256.Sum256(pair[:]))
+		}
+		level = next
+	}
+
+	return level[0]
+}
@@ -0,0 +1,162 @@
+package channeldb
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+// TestGraphRootHash asserts that two graphs holding the same records have
+// the same root hash, regardless of the order the records were added in, and
+// that modifying a record changes the root hash.
+func TestGraphRootHash(t *testing.T) {
+	t.Parallel()
+
+	db1, cleanUp1, err := makeTestDB()
+	defer cleanUp1()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	db2, cleanUp2, err := makeTestDB()
+	defer cleanUp2()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	graph1, graph2 := db1.ChannelGraph(), db2.ChannelGraph()
+
+	rootHash := func(graph *ChannelGraph) [32]byte {
+		t.Helper()
+
+		root, err := graph.GraphRootHash()
+		if err != nil {
+			t.Fatalf("unable to compute root hash: %v", err)
+		}
+		return root
+	}
+
+	if rootHash(graph1) != ([32]byte{}) {
+		t.Fatalf("expected empty graph to have an all-zero root")
+	}
+
+	// We'll create three nodes, connected by two channels.
+	var nodes []*LightningNode
+	for i := 0; i < 3; i++ {
+		node, err := createTestVertex(db1)
+		if err != nil {
+			t.Fatalf("unable to create test node: %v", err)
+		}
+		node.LastUpdate = time.Unix(int64(1000+i), 0)
+		nodes = append(nodes, node)
+	}
+
+	var (
+		edgeInfos []*ChannelEdgeInfo
+		policies  []*ChannelEdgePolicy
+	)
+	for i := 0; i < 2; i++ {
+		edgeInfo, edge1, edge2 := createChannelEdge(
+			db1, nodes[i], nodes[i+1],
+		)
+		edge1.LastUpdate = time.Unix(int64(2000+2*i), 0)
+		edge2.LastUpdate = time.Unix(int64(2001+2*i), 0)
+
+		edgeInfos = append(edgeInfos, edgeInfo)
+		policies = append(policies, edge1, edge2)
+	}
+
+	// The first graph receives the records in order, the second in
+	// reverse order.
+	for i := range nodes {
+		if err := graph1.AddLightningNode(nodes[i]); err != nil {
+			t.Fatalf("unable to add node: %v", err)
+		}
+		err := graph2.AddLightningNode(nodes[len(nodes)-1-i])
+		if err != nil {
+			t.Fatalf("unable to add node: %v", err)
+		}
+	}
+	for i := range edgeInfos {
+		if err := graph1.AddChannelEdge(edgeInfos[i]); err != nil {
+			t.Fatalf("unable to add edge: %v", err)
+		}
+		err := graph2.AddChannelEdge(edgeInfos[len(edgeInfos)-1-i])
+		if err != nil {
+			t.Fatalf("unable to add edge: %v", err)
+		}
+	}
+	for i := range policies {
+		if err := graph1.UpdateEdgePolicy(policies[i]); err != nil {
+			t.Fatalf("unable to update edge: %v", err)
+		}
+		err := graph2.UpdateEdgePolicy(policies[len(policies)-1-i])
+		if err != nil {
+			t.Fatalf("unable to update edge: %v", err)
+		}
+	}
+
+	// The root should commit to all three nodes and four channel updates.
+	err = db1.View(func(tx *bbolt.Tx) error {
+		leaves, err := graphHashLeaves(tx)
+		if err != nil {
+			return err
+		}
+		if len(leaves) != len(nodes)+len(policies) {
+			t.Fatalf("expected %v leaves, got %v",
+				len(nodes)+len(policies), len(leaves))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to compute leaves: %v", err)
+	}
+
+	root := rootHash(graph1)
+	if root != rootHash(graph2) {
+		t.Fatalf("expected identical graphs to have the same root")
+	}
+
+	// Once a channel update is only applied to the first graph, the roots
+	// should diverge, until it's applied to the second as well.
+	policies[1].FeeBaseMSat++
+	policies[1].LastUpdate = policies[1].LastUpdate.Add(time.Hour)
+	if err := graph1.UpdateEdgePolicy(policies[1]); err != nil {
+		t.Fatalf("unable to update edge: %v", err)
+	}
+	if rootHash(graph1) == root {
+		t.Fatalf("expected root to change after channel update")
+	}
+	if rootHash(graph1) == rootHash(graph2) {
+		t.Fatalf("expected roots of diverging graphs to differ")
+	}
+
+	if err := graph2.UpdateEdgePolicy(policies[1]); err != nil {
+		t.Fatalf("unable to update edge: %v", err)
+	}
+	if rootHash(graph1) != rootHash(graph2) {
+		t.Fatalf("expected roots to match after syncing update")
+	}
+}
+
+// TestMerkleRoot asserts that the Merkle root of a set of leaves is computed
+// by pairwise hashing, carrying an odd leaf up as is.
+func TestMerkleRoot(t *testing.T) {
+	t.Parallel()
+
+	var a, b, c [32]byte
+	a[0], b[0], c[0] = 1, 2, 3
+
+	hashPair := func(l, r [32]byte) [32]byte {
+		return sha256.Sum256(append(l[:], r[:]...))
+	}
+
+	if merkleRoot([][32]byte{a}) != a {
+		t.Fatalf("expected single leaf to be the root")
+	}
+
+	expected := hashPair(hashPair(a, b), c)
+	if root := merkleRoot([][32]byte{a, b, c}); root != expected {
+		t.Fatalf("expected root %x, got %x", expected, root)
+	}
+}
@@ -0,0 +1,88 @@
+package channeldb
+
+import (
+	"github.com/coreos/bbolt"
+)
+
+// graphPinBucket is the top-level bucket that stores the channels an operator
+// pinned within the graph. The edges of a pinned channel are never pruned as
+// zombies, regardless of how long ago they were last updated. Channels can be
+// pinned before their edges are known.
+//
+// maps: chanID -> nil
+var graphPinBucket = []byte("graph-pin")
+
+// PinEdge pins the channel with the given ID, such that its edges are exempt
+// from zombie pruning. Pinning a channel that's already pinned is a no-op.
+func (c *ChannelGraph) PinEdge(chanID uint64) error {
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		pins, err := tx.CreateBucketIfNotExists(graphPinBucket)
+		if err != nil {
+			return err
+		}
+
+		var chanIDBytes [8]byte
+		byteOrder.PutUint64(chanIDBytes[:], chanID)
+
+		return pins.Put(chanIDBytes[:], nil)
+	})
+}
+
+// UnpinEdge reverts PinEdge, once again subjecting the edges of the channel to
+// zombie pruning. Unpinning a channel that isn't pinned is a no-op.
+func (c *ChannelGraph) UnpinEdge(chanID uint64) error {
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		pins := tx.Bucket(graphPinBucket)
+		if pins == nil {
+			return nil
+		}
+
+		var chanIDBytes [8]byte
+		byteOrder.PutUint64(chanIDBytes[:], chanID)
+
+		return pins.Delete(chanIDBytes[:])
+	})
+}
+
+// PinnedEdges returns the IDs of all pinned channels in ascending order.
+func (c *ChannelGraph) PinnedEdges() ([]uint64, error) {
+	var chanIDs []uint64
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		pins := tx.Bucket(graphPinBucket)
+		if pins == nil {
+			return nil
+		}
+
+		return pins.ForEach(func(k, _ []byte) error {
+			chanIDs = append(chanIDs, byteOrder.Uint64(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return chanIDs, nil
+}
+
+// IsEdgePinned returns whether the channel with the given ID is pinned.
+func (c *ChannelGraph) IsEdgePinned(chanID uint64) (bool, error) {
+	var pinned bool
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		pins := tx.Bucket(graphPinBucket)
+		if pins == nil {
+			return nil
+		}
+
+		var chanIDBytes [8]byte
+		byteOrder.PutUint64(chanIDBytes[:], chanID)
+		pinned = pins.Get(chanIDBytes[:]) != nil
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return pinned, nil
+}
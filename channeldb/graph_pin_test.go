@@ -0,0 +1,60 @@
+package channeldb
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestGraphPins asserts that pinned channels are persisted and listed in
+// order, and that unpinning a channel removes it.
+func TestGraphPins(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	graph := db.ChannelGraph()
+
+	pinned, err := graph.PinnedEdges()
+	if err != nil {
+		t.Fatalf("unable to fetch pinned edges: %v", err)
+	}
+	if len(pinned) != 0 {
+		t.Fatalf("expected no pinned edges, got %v", pinned)
+	}
+
+	// Unpinning a channel before any was pinned should be a no-op.
+	if err := graph.UnpinEdge(1); err != nil {
+		t.Fatalf("unable to unpin edge: %v", err)
+	}
+
+	for _, chanID := range []uint64{300, 100, 200, 100} {
+		if err := graph.PinEdge(chanID); err != nil {
+			t.Fatalf("unable to pin edge: %v", err)
+		}
+	}
+	if err := graph.UnpinEdge(200); err != nil {
+		t.Fatalf("unable to unpin edge: %v", err)
+	}
+
+	pinned, err = graph.PinnedEdges()
+	if err != nil {
+		t.Fatalf("unable to fetch pinned edges: %v", err)
+	}
+	if !reflect.DeepEqual(pinned, []uint64{100, 300}) {
+		t.Fatalf("unexpected pinned edges: %v", pinned)
+	}
+
+	for chanID, expected := range map[uint64]bool{100: true, 200: false} {
+		isPinned, err := graph.IsEdgePinned(chanID)
+		if err != nil {
+			t.Fatalf("unable to check pin: %v", err)
+		}
+		if isPinned != expected {
+			t.Fatalf("expected pinned=%v for %v, got %v",
+				expected, chanID, isPinned)
+		}
+	}
+}
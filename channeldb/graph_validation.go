@@ -0,0 +1,230 @@
+package channeldb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+const (
+	// graphValidationBatchSize is the max number of channel updates read
+	// within a single transaction by ValidateGraphSignatures. The
+	// transaction is closed while the batch is verified, so the sweep
+	// never holds one open for long.
+	graphValidationBatchSize = 100
+)
+
+// ErrInvalidValidationRate is returned when sweeping the graph with a rate
+// that isn't a positive number of updates per second.
+var ErrInvalidValidationRate = fmt.Errorf("validation rate must be positive")
+
+// ValidationReport is the outcome of a sweep over the signatures of the
+// channel updates within the graph.
+type ValidationReport struct {
+	// Valid is the number of channel updates whose signature was verified
+	// during the sweep.
+	Valid uint64
+
+	// Invalid is the number of channel updates whose signature was
+	// rejected by the verifier.
+	Invalid uint64
+
+	// Skipped is the number of channel updates whose signature was already
+	// validated before, either by an earlier sweep or as the update was
+	// received.
+	Skipped uint64
+}
+
+// ValidateGraphSignatures walks all channel updates within the graph, and
+// passes each whose signature hasn't been validated yet to verify, at a rate
+// of at most ratePerSec updates per second. Updates that pass are marked as
+// validated, so a sweep that's interrupted skips them once resumed, while
+// those that don't are only counted, leaving it to the caller to prune them.
+// The sweep stops once the context is cancelled, in which case the report of
+// the updates processed so far is returned along with the context's error.
+func (c *ChannelGraph) ValidateGraphSignatures(ctx context.Context,
+	ratePerSec int,
+	verify func(ChannelEdgePolicy) error) (*ValidationReport, error) {
+
+	if ratePerSec <= 0 {
+		return nil, ErrInvalidValidationRate
+	}
+
+	ticker := time.NewTicker(time.Second / time.Duration(ratePerSec))
+	defer ticker.Stop()
+
+	report := &ValidationReport{}
+	var lastKey []byte
+	for {
+		policies, nextKey, err := c.fetchUnvalidatedPolicies(
+			lastKey, report,
+		)
+		if err != nil {
+			return report, err
+		}
+		lastKey = nextKey
+
+		var valid []*ChannelEdgePolicy
+		for _, policy := range policies {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+			}
+
+			// We'll check for cancellation even if the ticker
+			// fired, as both may be ready at once.
+			if ctx.Err() != nil {
+				err := c.markPoliciesValidated(valid)
+				if err != nil {
+					return report, err
+				}
+				return report, ctx.Err()
+			}
+
+			if err := verify(*policy); err != nil {
+				log.Debugf("Invalid signature of channel "+
+					"update for %v: %v", policy.ChannelID,
+					err)
+				report.Invalid++
+				continue
+			}
+
+			report.Valid++
+			valid = append(valid, policy)
+		}
+
+		if err := c.markPoliciesValidated(valid); err != nil {
+			return report, err
+		}
+		if nextKey == nil {
+			return report, nil
+		}
+	}
+}
+
+// fetchUnvalidatedPolicies reads the next batch of channel updates following
+// the policy key afterKey whose signature hasn't been validated yet, counting
+// those that were as skipped. The key of the last update read is returned to
+// continue from, which is nil once all updates have been read.
+func (c *ChannelGraph) fetchUnvalidatedPolicies(afterKey []byte,
+	report *ValidationReport) ([]*ChannelEdgePolicy, []byte, error) {
+
+	var (
+		policies []*ChannelEdgePolicy
+		lastKey  []byte
+		skipped  uint64
+	)
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		policies, lastKey, skipped = nil, nil, 0
+
+		edges := tx.Bucket(edgeBucket)
+		if edges == nil {
+			return nil
+		}
+		nodes := tx.Bucket(nodeBucket)
+		if nodes == nil {
+			return ErrGraphNotFound
+		}
+		validated := edges.Bucket(validatedSigBucket)
+
+		cursor := edges.Cursor()
+		k, v := cursor.First()
+		if afterKey != nil {
+			k, v = cursor.Seek(afterKey)
+			if bytes.Equal(k, afterKey) {
+				k, v = cursor.Next()
+			}
+		}
+
+		numRead := 0
+		for ; k != nil; k, v = cursor.Next() {
+			if numRead == graphValidationBatchSize {
+				return nil
+			}
+			lastKey = append([]byte(nil), k...)
+
+			// Only the entries keyed by a node's public key and
+			// channel ID hold channel updates, while the unknown
+			// policies of channels don't carry a signature.
+			if v == nil || len(k) != 33+8 ||
+				bytes.Equal(v, unknownPolicy) {
+
+				continue
+			}
+			numRead++
+
+			policy, err := deserializeChanEdgePolicy(
+				bytes.NewReader(v), nodes,
+			)
+			switch {
+			case err == ErrEdgePolicyOptionalFieldNotFound:
+				continue
+			case err != nil:
+				return err
+			}
+
+			// The values of the validated signature records are
+			// empty, so we seek to them rather than getting them.
+			key := validatedSigKey(
+				policy.ChannelID, policy.LastUpdate,
+			)
+			if validated != nil {
+				seen, _ := validated.Cursor().Seek(key[:])
+				if bytes.Equal(seen, key[:]) {
+					skipped++
+					continue
+				}
+			}
+
+			policy.db = c.db
+			policies = append(policies, policy)
+		}
+
+		// All updates have been read.
+		lastKey = nil
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	report.Skipped += skipped
+
+	return policies, lastKey, nil
+}
+
+// markPoliciesValidated records that the signatures of the passed channel
+// updates have been validated within a single transaction.
+func (c *ChannelGraph) markPoliciesValidated(
+	policies []*ChannelEdgePolicy) error {
+
+	if len(policies) == 0 {
+		return nil
+	}
+
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		edges, err := tx.CreateBucketIfNotExists(edgeBucket)
+		if err != nil {
+			return err
+		}
+		validated, err := edges.CreateBucketIfNotExists(
+			validatedSigBucket,
+		)
+		if err != nil {
+			return err
+		}
+
+		for _, policy := range policies {
+			key := validatedSigKey(
+				policy.ChannelID, policy.LastUpdate,
+			)
+			if err := validated.Put(key[:], nil); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
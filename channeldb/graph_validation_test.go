@@ -0,0 +1,131 @@
+package channeldb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestValidateGraphSignatures asserts that a sweep over the graph verifies
+// each channel update that wasn't validated before, and that an interrupted
+// sweep resumes where it left off.
+func TestValidateGraphSignatures(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+	graph := db.ChannelGraph()
+
+	verifyAll := func(ChannelEdgePolicy) error {
+		return nil
+	}
+	_, err = graph.ValidateGraphSignatures(
+		context.Background(), 0, verifyAll,
+	)
+	if err != ErrInvalidValidationRate {
+		t.Fatalf("expected ErrInvalidValidationRate, got %v", err)
+	}
+
+	// We'll add three channels with both of their policies.
+	var edges []*ChannelEdgeInfo
+	for i := 0; i < 3; i++ {
+		node1, err := createTestVertex(db)
+		if err != nil {
+			t.Fatalf("unable to create test node: %v", err)
+		}
+		node2, err := createTestVertex(db)
+		if err != nil {
+			t.Fatalf("unable to create test node: %v", err)
+		}
+		for _, node := range []*LightningNode{node1, node2} {
+			if err := graph.AddLightningNode(node); err != nil {
+				t.Fatalf("unable to add node: %v", err)
+			}
+		}
+
+		edgeInfo, edge1, edge2 := createChannelEdge(db, node1, node2)
+		if err := graph.AddChannelEdge(edgeInfo); err != nil {
+			t.Fatalf("unable to add edge: %v", err)
+		}
+		for _, edge := range []*ChannelEdgePolicy{edge1, edge2} {
+			if err := graph.UpdateEdgePolicy(edge); err != nil {
+				t.Fatalf("unable to update policy: %v", err)
+			}
+		}
+		edges = append(edges, edgeInfo)
+	}
+
+	// The first policy of the first channel was already validated, while
+	// the signature of the second policy of the last channel is invalid.
+	_, policy1, _, err := graph.FetchChannelEdgesByID(edges[0].ChannelID)
+	if err != nil {
+		t.Fatalf("unable to fetch edge: %v", err)
+	}
+	err = graph.MarkPolicyValidated(policy1.ChannelID, policy1.LastUpdate)
+	if err != nil {
+		t.Fatalf("unable to mark policy validated: %v", err)
+	}
+
+	invalidID := edges[2].ChannelID
+	verify := func(policy ChannelEdgePolicy) error {
+		direction := policy.ChannelFlags & lnwire.ChanUpdateDirection
+		if policy.ChannelID == invalidID && direction == 1 {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	}
+
+	assertReport := func(report *ValidationReport, expected uint64,
+		name string, actual uint64) {
+
+		t.Helper()
+
+		if actual != expected {
+			t.Fatalf("expected %v %v updates, got %v: %+v",
+				expected, name, actual, report)
+		}
+	}
+
+	// The first sweep is cancelled once the first update was verified.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	report, err := graph.ValidateGraphSignatures(ctx, 1000,
+		func(policy ChannelEdgePolicy) error {
+			cancel()
+			return verify(policy)
+		},
+	)
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	assertReport(report, 1, "verified", report.Valid+report.Invalid)
+	assertReport(report, 1, "skipped", report.Skipped)
+	firstValid := report.Valid
+
+	// Once resumed, the update verified by the first sweep is skipped.
+	report, err = graph.ValidateGraphSignatures(
+		context.Background(), 1000, verify,
+	)
+	if err != nil {
+		t.Fatalf("unable to validate graph: %v", err)
+	}
+	assertReport(report, 1+firstValid, "skipped", report.Skipped)
+	assertReport(report, 4-firstValid, "valid", report.Valid)
+	assertReport(report, 1, "invalid", report.Invalid)
+
+	// Only the invalid update is verified again by a later sweep.
+	report, err = graph.ValidateGraphSignatures(
+		context.Background(), 1000, verify,
+	)
+	if err != nil {
+		t.Fatalf("unable to validate graph: %v", err)
+	}
+	assertReport(report, 5, "skipped", report.Skipped)
+	assertReport(report, 0, "valid", report.Valid)
+	assertReport(report, 1, "invalid", report.Invalid)
+}
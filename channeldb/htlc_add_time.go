@@ -0,0 +1,212 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// htlcAddTimesKey can be accessed within the sub-bucket for a
+	// particular channel. It stores the times at which the HTLCs of a
+	// channel party's commitment were added. As with chanCommitmentKey,
+	// a 0 is appended for the local party, and a 1 for the remote party.
+	//
+	// The value is a series of entries, each consisting of:
+	//
+	//   incoming (1 byte) || htlcIndex (8 bytes) || addTime (8 bytes)
+	htlcAddTimesKey = []byte("htlc-add-times-key")
+
+	// ErrNoPendingHTLCs is returned when none of the channels have an HTLC
+	// pending on their commitments.
+	ErrNoPendingHTLCs = fmt.Errorf("no pending htlcs found")
+)
+
+// htlcAddTimeEntrySize is the size of a single entry stored under
+// htlcAddTimesKey.
+const htlcAddTimeEntrySize = 1 + 8 + 8
+
+// htlcKey uniquely identifies an HTLC within a single commitment.
+type htlcKey struct {
+	incoming  bool
+	htlcIndex uint64
+}
+
+// htlcAddTimesKeyFor returns the key under which the HTLC add times of the
+// local or remote commitment are stored.
+func htlcAddTimesKeyFor(local bool) []byte {
+	key := make([]byte, len(htlcAddTimesKey)+1)
+	copy(key, htlcAddTimesKey)
+	if !local {
+		key[len(htlcAddTimesKey)] = 0x01
+	}
+
+	return key
+}
+
+// fetchHtlcAddTimes reads the stored add times of the HTLCs of the local or
+// remote commitment.
+func fetchHtlcAddTimes(chanBucket *bbolt.Bucket,
+	local bool) (map[htlcKey]time.Time, error) {
+
+	addTimes := make(map[htlcKey]time.Time)
+
+	r := bytes.NewReader(chanBucket.Get(htlcAddTimesKeyFor(local)))
+	for r.Len() > 0 {
+		var entry [htlcAddTimeEntrySize]byte
+		if _, err := io.ReadFull(r, entry[:]); err != nil {
+			return nil, err
+		}
+
+		key := htlcKey{
+			incoming:  entry[0] == 1,
+			htlcIndex: byteOrder.Uint64(entry[1:9]),
+		}
+		addTimes[key] = time.Unix(0, int64(byteOrder.Uint64(entry[9:])))
+	}
+
+	return addTimes, nil
+}
+
+// putHtlcAddTimes stores the add times of the HTLCs of the passed commitment.
+// HTLCs keep the add time previously stored for them, while those new to the
+// commitment are assigned now. Entries of HTLCs that are no longer part of the
+// commitment are removed.
+func putHtlcAddTimes(chanBucket *bbolt.Bucket, c *ChannelCommitment,
+	local bool, now time.Time) error {
+
+	prevAddTimes, err := fetchHtlcAddTimes(chanBucket, local)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	for _, htlc := range c.Htlcs {
+		key := htlcKey{
+			incoming:  htlc.Incoming,
+			htlcIndex: htlc.HtlcIndex,
+		}
+		addTime, ok := prevAddTimes[key]
+		if !ok {
+			addTime = now
+		}
+
+		var entry [htlcAddTimeEntrySize]byte
+		if htlc.Incoming {
+			entry[0] = 1
+		}
+		byteOrder.PutUint64(entry[1:9], htlc.HtlcIndex)
+		byteOrder.PutUint64(entry[9:], uint64(addTime.UnixNano()))
+		b.Write(entry[:])
+	}
+
+	return chanBucket.Put(htlcAddTimesKeyFor(local), b.Bytes())
+}
+
+// OldestPendingHTLC returns the HTLC that has been pending on the commitments
+// of any channel for the longest time. The short channel ID of its channel and
+// its payment hash are returned, along with how long ago it was added. If no
+// HTLC is pending, ErrNoPendingHTLCs is returned.
+func (d *DB) OldestPendingHTLC() (uint64, [32]byte, time.Duration, error) {
+	var (
+		found      bool
+		oldestChan uint64
+		oldestHash [32]byte
+		oldestTime time.Time
+	)
+	err := d.View(func(tx *bbolt.Tx) error {
+		openChanBucket := tx.Bucket(openChannelBucket)
+		if openChanBucket == nil {
+			return nil
+		}
+
+		return forEachChanBucket(openChanBucket, func(op wire.OutPoint,
+			chanBucket *bbolt.Bucket) error {
+
+			channel, err := fetchOpenChannel(chanBucket, &op)
+			if err != nil {
+				return err
+			}
+
+			chanID := channel.ShortChannelID.ToUint64()
+			for _, local := range []bool{true, false} {
+				commitment := &channel.LocalCommitment
+				if !local {
+					commitment = &channel.RemoteCommitment
+				}
+
+				addTimes, err := fetchHtlcAddTimes(
+					chanBucket, local,
+				)
+				if err != nil {
+					return err
+				}
+
+				for _, htlc := range commitment.Htlcs {
+					addTime, ok := addTimes[htlcKey{
+						incoming:  htlc.Incoming,
+						htlcIndex: htlc.HtlcIndex,
+					}]
+					if !ok || (found &&
+						!addTime.Before(oldestTime)) {
+
+						continue
+					}
+
+					found = true
+					oldestChan = chanID
+					oldestHash = htlc.RHash
+					oldestTime = addTime
+				}
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, [32]byte{}, 0, err
+	}
+	if !found {
+		return 0, [32]byte{}, 0, ErrNoPendingHTLCs
+	}
+
+	return oldestChan, oldestHash, time.Since(oldestTime), nil
+}
+
+// forEachChanBucket calls cb with the funding outpoint and bucket of each
+// channel within the open channel bucket.
+func forEachChanBucket(openChanBucket *bbolt.Bucket,
+	cb func(wire.OutPoint, *bbolt.Bucket) error) error {
+
+	return openChanBucket.ForEach(func(nodePub, v []byte) error {
+		if v != nil {
+			return nil
+		}
+
+		nodeChanBucket := openChanBucket.Bucket(nodePub)
+		return nodeChanBucket.ForEach(func(chainHash, v []byte) error {
+			if v != nil {
+				return nil
+			}
+
+			chainBucket := nodeChanBucket.Bucket(chainHash)
+			return chainBucket.ForEach(func(k, v []byte) error {
+				if v != nil {
+					return nil
+				}
+
+				var op wire.OutPoint
+				err := readOutpoint(bytes.NewReader(k), &op)
+				if err != nil {
+					return err
+				}
+
+				return cb(op, chainBucket.Bucket(k))
+			})
+		})
+	})
+}
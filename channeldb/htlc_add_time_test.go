@@ -0,0 +1,127 @@
+package channeldb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+// testHTLC returns an HTLC with the given index and payment hash, suitable
+// for adding to a test commitment.
+func testHTLC(htlcIndex uint64, rHash [32]byte) HTLC {
+	return HTLC{
+		Signature:     testSig.Serialize(),
+		RHash:         rHash,
+		Amt:           10,
+		RefundTimeout: 144,
+		HtlcIndex:     htlcIndex,
+		LogIndex:      htlcIndex,
+		OnionBlob:     []byte("onionblob"),
+	}
+}
+
+// TestOldestPendingHTLC asserts that the oldest HTLC pending on any
+// commitment is returned, and that HTLCs retain their add time as the
+// commitment advances.
+func TestOldestPendingHTLC(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	if _, _, _, err := cdb.OldestPendingHTLC(); err != ErrNoPendingHTLCs {
+		t.Fatalf("expected ErrNoPendingHTLCs, got %v", err)
+	}
+
+	// We'll create a channel with a single HTLC on our commitment.
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	oldHash, newHash := [32]byte{1}, [32]byte{2}
+	channel.LocalCommitment.Htlcs = []HTLC{testHTLC(0, oldHash)}
+	if err := channel.FullSync(); err != nil {
+		t.Fatalf("unable to save channel state: %v", err)
+	}
+
+	assertOldest := func(expectedHash [32]byte, minAge,
+		maxAge time.Duration) {
+
+		t.Helper()
+
+		chanID, rHash, age, err := cdb.OldestPendingHTLC()
+		if err != nil {
+			t.Fatalf("unable to fetch oldest htlc: %v", err)
+		}
+		if chanID != channel.ShortChannelID.ToUint64() {
+			t.Fatalf("expected channel %v, got %v",
+				channel.ShortChannelID, chanID)
+		}
+		if rHash != expectedHash {
+			t.Fatalf("expected htlc %x, got %x", expectedHash,
+				rHash)
+		}
+		if age < minAge || age > maxAge {
+			t.Fatalf("expected age between %v and %v, got %v",
+				minAge, maxAge, age)
+		}
+	}
+	assertOldest(oldHash, 0, time.Minute)
+
+	// Backdate the HTLC by an hour, so we can tell it apart from HTLCs
+	// added from here on.
+	err = cdb.Update(func(tx *bbolt.Tx) error {
+		chanBucket, err := fetchChanBucket(
+			tx, channel.IdentityPub, &channel.FundingOutpoint,
+			channel.ChainHash,
+		)
+		if err != nil {
+			return err
+		}
+		err = chanBucket.Delete(htlcAddTimesKeyFor(true))
+		if err != nil {
+			return err
+		}
+
+		return putHtlcAddTimes(
+			chanBucket, &channel.LocalCommitment, true,
+			time.Now().Add(-time.Hour),
+		)
+	})
+	if err != nil {
+		t.Fatalf("unable to backdate htlc: %v", err)
+	}
+
+	// Adding a second HTLC should leave the add time of the first one
+	// untouched.
+	commitment := channel.LocalCommitment
+	commitment.CommitHeight++
+	commitment.Htlcs = []HTLC{testHTLC(0, oldHash), testHTLC(1, newHash)}
+	if err := channel.UpdateCommitment(&commitment); err != nil {
+		t.Fatalf("unable to update commitment: %v", err)
+	}
+	assertOldest(oldHash, time.Hour, time.Hour+time.Minute)
+
+	// Once the first HTLC is resolved, the second one should be the
+	// oldest.
+	commitment.CommitHeight++
+	commitment.Htlcs = []HTLC{testHTLC(1, newHash)}
+	if err := channel.UpdateCommitment(&commitment); err != nil {
+		t.Fatalf("unable to update commitment: %v", err)
+	}
+	assertOldest(newHash, 0, time.Minute)
+
+	// Finally, with no HTLCs left, none should be found.
+	commitment.CommitHeight++
+	commitment.Htlcs = nil
+	if err := channel.UpdateCommitment(&commitment); err != nil {
+		t.Fatalf("unable to update commitment: %v", err)
+	}
+	if _, _, _, err := cdb.OldestPendingHTLC(); err != ErrNoPendingHTLCs {
+		t.Fatalf("expected ErrNoPendingHTLCs, got %v", err)
+	}
+}
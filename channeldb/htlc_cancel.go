@@ -0,0 +1,193 @@
+package channeldb
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+var (
+	// htlcCancelBucket is a sub-bucket of a channel's bucket that records
+	// the HTLCs of the channel marked for cancellation ahead of a force
+	// close.
+	//
+	// maps: htlcIndex || incoming -> nil
+	htlcCancelBucket = []byte("htlc-cancel-intents")
+)
+
+// HTLCRef identifies an HTLC pending on a channel, along with the terms the
+// resolver needs to handle it.
+type HTLCRef struct {
+	// ChanPoint is the funding outpoint of the channel the HTLC is pending
+	// on.
+	ChanPoint wire.OutPoint
+
+	// HtlcIndex is the index of the HTLC within the update log of the
+	// party that offered it.
+	HtlcIndex uint64
+
+	// Incoming is true if the HTLC was offered by the remote party.
+	Incoming bool
+
+	// RHash is the payment hash of the HTLC.
+	RHash [32]byte
+
+	// Amt is the amount of the HTLC.
+	Amt lnwire.MilliSatoshi
+
+	// RefundTimeout is the absolute timeout of the HTLC.
+	RefundTimeout uint32
+}
+
+// MarkChannelHTLCsForCancel marks all HTLCs pending on the open channel with
+// the passed funding outpoint for cancellation, and returns them. The HTLCs
+// pending on a channel are those of its current local and remote commitment,
+// and of the pending remote commitment if there is one. HTLCs that were
+// already resolved aren't marked. The marks persist across restarts, such
+// that a force close can be resumed by fetching them through
+// HTLCsMarkedForCancel.
+func (d *DB) MarkChannelHTLCsForCancel(op wire.OutPoint) ([]HTLCRef, error) {
+	var refs []HTLCRef
+	err := d.Update(func(tx *bbolt.Tx) error {
+		_, _, chanBucket, err := findChanBucket(tx, &op)
+		if err != nil {
+			return err
+		}
+
+		refs, err = pendingHTLCRefs(chanBucket, op)
+		if err != nil {
+			return err
+		}
+
+		cancels, err := chanBucket.CreateBucketIfNotExists(
+			htlcCancelBucket,
+		)
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			key := htlcCancelKey(ref.HtlcIndex, ref.Incoming)
+			if err := cancels.Put(key[:], nil); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// HTLCsMarkedForCancel returns the HTLCs of the open channel with the passed
+// funding outpoint that were marked for cancellation, and are still pending.
+func (d *DB) HTLCsMarkedForCancel(op wire.OutPoint) ([]HTLCRef, error) {
+	var refs []HTLCRef
+	err := d.View(func(tx *bbolt.Tx) error {
+		refs = nil
+
+		_, _, chanBucket, err := findChanBucket(tx, &op)
+		if err != nil {
+			return err
+		}
+		cancels := chanBucket.Bucket(htlcCancelBucket)
+		if cancels == nil {
+			return nil
+		}
+
+		pending, err := pendingHTLCRefs(chanBucket, op)
+		if err != nil {
+			return err
+		}
+		for _, ref := range pending {
+			key := htlcCancelKey(ref.HtlcIndex, ref.Incoming)
+			if cancels.Get(key[:]) != nil {
+				refs = append(refs, ref)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// pendingHTLCRefs returns the HTLCs pending on the channel stored within the
+// passed bucket, ordered by direction and index. Restored channels have no
+// commitments, and therefore no pending HTLCs.
+func pendingHTLCRefs(chanBucket *bbolt.Bucket,
+	op wire.OutPoint) ([]HTLCRef, error) {
+
+	var commits []*ChannelCommitment
+	for _, local := range []bool{true, false} {
+		commit, err := fetchChanCommitment(chanBucket, local)
+		if err == ErrNoCommitmentsFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, &commit)
+	}
+
+	if tipBytes := chanBucket.Get(commitDiffKey); tipBytes != nil {
+		diff, err := deserializeCommitDiff(bytes.NewReader(tipBytes))
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, &diff.Commitment)
+	}
+
+	var refs []HTLCRef
+	seen := make(map[htlcID]struct{})
+	for _, commit := range commits {
+		for _, htlc := range commit.Htlcs {
+			id := htlcID{
+				htlcIndex: htlc.HtlcIndex,
+				incoming:  htlc.Incoming,
+			}
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+
+			refs = append(refs, HTLCRef{
+				ChanPoint:     op,
+				HtlcIndex:     htlc.HtlcIndex,
+				Incoming:      htlc.Incoming,
+				RHash:         htlc.RHash,
+				Amt:           htlc.Amt,
+				RefundTimeout: htlc.RefundTimeout,
+			})
+		}
+	}
+
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Incoming != refs[j].Incoming {
+			return !refs[i].Incoming
+		}
+		return refs[i].HtlcIndex < refs[j].HtlcIndex
+	})
+
+	return refs, nil
+}
+
+// htlcCancelKey returns the key of an HTLC within the cancel bucket of its
+// channel.
+func htlcCancelKey(htlcIndex uint64, incoming bool) [9]byte {
+	var key [9]byte
+	byteOrder.PutUint64(key[:8], htlcIndex)
+	if incoming {
+		key[8] = 1
+	}
+
+	return key
+}
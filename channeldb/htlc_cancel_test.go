@@ -0,0 +1,171 @@
+package channeldb
+
+import (
+	"net"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+)
+
+// TestMarkChannelHTLCsForCancel asserts that all HTLCs pending on a channel
+// are marked for cancellation exactly once, and that the marks of HTLCs that
+// are resolved afterwards are no longer reported.
+func TestMarkChannelHTLCsForCancel(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	addr := &net.TCPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 18555,
+	}
+	if err := channel.SyncPending(addr, 101); err != nil {
+		t.Fatalf("unable to sync channel: %v", err)
+	}
+
+	op := channel.FundingOutpoint
+	if _, err := cdb.MarkChannelHTLCsForCancel(wire.OutPoint{}); err !=
+		ErrChannelNotFound {
+
+		t.Fatalf("expected ErrChannelNotFound, got %v", err)
+	}
+
+	// Without any HTLCs on the channel, none are marked.
+	refs, err := cdb.MarkChannelHTLCsForCancel(op)
+	if err != nil {
+		t.Fatalf("unable to mark htlcs: %v", err)
+	}
+	if len(refs) != 0 {
+		t.Fatalf("expected no htlcs, got %v", refs)
+	}
+
+	outgoing := HTLC{
+		RHash:         [32]byte{1},
+		Amt:           1000,
+		RefundTimeout: 500,
+		HtlcIndex:     1,
+	}
+	incoming := HTLC{
+		RHash:         [32]byte{2},
+		Amt:           2000,
+		RefundTimeout: 600,
+		HtlcIndex:     1,
+		Incoming:      true,
+	}
+	added := HTLC{
+		RHash:         [32]byte{3},
+		Amt:           3000,
+		RefundTimeout: 700,
+		HtlcIndex:     2,
+		Incoming:      true,
+	}
+
+	putCommitments := func(local, remote []HTLC) {
+		t.Helper()
+
+		err := cdb.Update(func(tx *bbolt.Tx) error {
+			chanBucket, err := fetchChanBucket(
+				tx, channel.IdentityPub,
+				&channel.FundingOutpoint, channel.ChainHash,
+			)
+			if err != nil {
+				return err
+			}
+
+			localCommit := channel.LocalCommitment
+			localCommit.Htlcs = local
+			err = putChanCommitment(chanBucket, &localCommit, true)
+			if err != nil {
+				return err
+			}
+
+			remoteCommit := channel.RemoteCommitment
+			remoteCommit.Htlcs = remote
+			return putChanCommitment(
+				chanBucket, &remoteCommit, false,
+			)
+		})
+		if err != nil {
+			t.Fatalf("unable to put commitments: %v", err)
+		}
+	}
+
+	assertRefs := func(refs []HTLCRef, htlcs ...HTLC) {
+		t.Helper()
+
+		if len(refs) != len(htlcs) {
+			t.Fatalf("expected %v htlcs, got %v", len(htlcs), refs)
+		}
+		for i, htlc := range htlcs {
+			expected := HTLCRef{
+				ChanPoint:     op,
+				HtlcIndex:     htlc.HtlcIndex,
+				Incoming:      htlc.Incoming,
+				RHash:         htlc.RHash,
+				Amt:           htlc.Amt,
+				RefundTimeout: htlc.RefundTimeout,
+			}
+			if refs[i] != expected {
+				t.Fatalf("expected htlc %v to be %v, got %v", i,
+					expected, refs[i])
+			}
+		}
+	}
+
+	// The outgoing and incoming HTLC share an index, but are on both
+	// commitments, such that each must be reported once. The HTLC that was
+	// just added is only on the remote commitment.
+	putCommitments(
+		[]HTLC{incoming, outgoing},
+		[]HTLC{outgoing, incoming, added},
+	)
+	refs, err = cdb.MarkChannelHTLCsForCancel(op)
+	if err != nil {
+		t.Fatalf("unable to mark htlcs: %v", err)
+	}
+	assertRefs(refs, outgoing, incoming, added)
+
+	marked, err := cdb.HTLCsMarkedForCancel(op)
+	if err != nil {
+		t.Fatalf("unable to fetch marked htlcs: %v", err)
+	}
+	assertRefs(marked, outgoing, incoming, added)
+
+	// Once the outgoing HTLC is resolved, it's no longer reported as
+	// marked, while the others still are.
+	putCommitments(
+		[]HTLC{incoming, added},
+		[]HTLC{incoming, added},
+	)
+	marked, err = cdb.HTLCsMarkedForCancel(op)
+	if err != nil {
+		t.Fatalf("unable to fetch marked htlcs: %v", err)
+	}
+	assertRefs(marked, incoming, added)
+
+	// The marks of the remaining HTLCs must survive a restart of the
+	// database.
+	if err := cdb.Close(); err != nil {
+		t.Fatalf("unable to close database: %v", err)
+	}
+	reopened, err := Open(cdb.dbPath, OptionSetSyncMode(NoSync))
+	if err != nil {
+		t.Fatalf("unable to reopen database: %v", err)
+	}
+	defer reopened.Close()
+
+	marked, err = reopened.HTLCsMarkedForCancel(op)
+	if err != nil {
+		t.Fatalf("unable to fetch marked htlcs: %v", err)
+	}
+	assertRefs(marked, incoming, added)
+}
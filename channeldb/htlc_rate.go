@@ -0,0 +1,162 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// htlcRateBucket is the top-level bucket that stores the times at which
+	// HTLCs were added to each direction of a channel. Each channel
+	// direction has its own sub-bucket, which holds an entry per HTLC
+	// keyed by the time it was added, followed by a sequence number to
+	// keep entries added at the same time apart.
+	//
+	// maps: chanID || direction => addTime || seqNo => nil
+	htlcRateBucket = []byte("htlc-rate")
+
+	// ErrHTLCRateWindowTooLarge is returned when the rate of HTLC additions
+	// is queried over a window exceeding MaxHTLCRateWindow.
+	ErrHTLCRateWindowTooLarge = fmt.Errorf("htlc rate window exceeds "+
+		"max of %v", MaxHTLCRateWindow)
+)
+
+const (
+	// MaxHTLCRateWindow is the largest window over which the rate of HTLC
+	// additions can be queried. HTLC additions older than this are
+	// trimmed as new ones are recorded.
+	MaxHTLCRateWindow = 24 * time.Hour
+)
+
+// RecordHTLCAdd records the addition of an HTLC to the given direction of a
+// channel at the passed time. The direction is 0 if the HTLC was offered by
+// the node with the lexicographically smaller public key, and 1 otherwise.
+// Any additions recorded for the channel direction that have fallen out of
+// MaxHTLCRateWindow are trimmed along the way. A failed write is deferred to
+// the dead letter queue, if it's enabled.
+func (d *DB) RecordHTLCAdd(chanID uint64, dir uint8, t time.Time) error {
+	if dir > 1 {
+		return ErrInvalidChannelDirection
+	}
+
+	err := d.Batch(func(tx *bbolt.Tx) error {
+		return putHTLCAdd(tx, chanID, dir, t)
+	})
+
+	return d.deferWrite(err, &htlcAddLetter{
+		chanID: chanID,
+		dir:    dir,
+		t:      t,
+	})
+}
+
+// putHTLCAdd records the addition of an HTLC within the passed transaction.
+func putHTLCAdd(tx *bbolt.Tx, chanID uint64, dir uint8, t time.Time) error {
+	rates, err := tx.CreateBucketIfNotExists(htlcRateBucket)
+	if err != nil {
+		return err
+	}
+	adds, err := rates.CreateBucketIfNotExists(channelScoreKey(chanID, dir))
+	if err != nil {
+		return err
+	}
+
+	seqNo, err := adds.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	var addKey [16]byte
+	byteOrder.PutUint64(addKey[:8], uint64(t.UnixNano()))
+	byteOrder.PutUint64(addKey[8:], seqNo)
+	if err := adds.Put(addKey[:], nil); err != nil {
+		return err
+	}
+
+	return trimTimeSeries(adds, t.Add(-MaxHTLCRateWindow))
+}
+
+// HTLCRate returns the number of HTLCs added to the given direction of a
+// channel within the window preceding now, including those added at now.
+// The window may not exceed MaxHTLCRateWindow.
+func (d *DB) HTLCRate(chanID uint64, dir uint8, window time.Duration,
+	now time.Time) (uint64, error) {
+
+	if dir > 1 {
+		return 0, ErrInvalidChannelDirection
+	}
+	if window > MaxHTLCRateWindow {
+		return 0, ErrHTLCRateWindowTooLarge
+	}
+
+	var numAdds uint64
+	err := d.View(func(tx *bbolt.Tx) error {
+		rates := tx.Bucket(htlcRateBucket)
+		if rates == nil {
+			return nil
+		}
+		adds := rates.Bucket(channelScoreKey(chanID, dir))
+		if adds == nil {
+			return nil
+		}
+
+		var start, end [8]byte
+		startTime := now.Add(-window)
+		byteOrder.PutUint64(start[:], uint64(startTime.UnixNano()))
+		byteOrder.PutUint64(end[:], uint64(now.UnixNano()))
+
+		c := adds.Cursor()
+		for k, _ := c.Seek(start[:]); k != nil &&
+			bytes.Compare(k[:8], end[:]) <= 0; k, _ = c.Next() {
+
+			numAdds++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return numAdds, nil
+}
+
+// trimTimeSeries removes all entries recorded before the cutoff from a bucket
+// whose keys are prefixed by the time of their entry.
+func trimTimeSeries(series *bbolt.Bucket, cutoff time.Time) error {
+	var cutoffKey [8]byte
+	byteOrder.PutUint64(cutoffKey[:], uint64(cutoff.UnixNano()))
+
+	c := series.Cursor()
+	for k, _ := c.First(); k != nil &&
+		bytes.Compare(k[:8], cutoffKey[:]) < 0; k, _ = c.First() {
+
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteHTLCRatesOnClose removes the HTLC additions recorded for both
+// directions of a closed channel.
+func deleteHTLCRatesOnClose(tx *bbolt.Tx, channel *OpenChannel) error {
+	rates := tx.Bucket(htlcRateBucket)
+	if rates == nil {
+		return nil
+	}
+
+	chanID := channel.ShortChannelID.ToUint64()
+	for dir := uint8(0); dir <= 1; dir++ {
+		err := rates.DeleteBucket(channelScoreKey(chanID, dir))
+		if err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package channeldb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+// TestHTLCRate asserts that HTLC additions are counted within the queried
+// window of their channel direction, and that additions falling out of the
+// max window are trimmed.
+func TestHTLCRate(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+
+	const chanID = 1234
+	now := time.Unix(1500000000, 0)
+
+	assertRate := func(dir uint8, window time.Duration, at time.Time,
+		expected uint64) {
+
+		t.Helper()
+
+		rate, err := db.HTLCRate(chanID, dir, window, at)
+		if err != nil {
+			t.Fatalf("unable to fetch htlc rate: %v", err)
+		}
+		if rate != expected {
+			t.Fatalf("expected rate %v, got %v", expected, rate)
+		}
+	}
+
+	assertRate(0, time.Minute, now, 0)
+
+	// We'll record two additions at the same time, and another one a
+	// minute later, all in the first direction.
+	for _, addTime := range []time.Time{
+		now, now, now.Add(time.Minute),
+	} {
+		if err := db.RecordHTLCAdd(chanID, 0, addTime); err != nil {
+			t.Fatalf("unable to record htlc add: %v", err)
+		}
+	}
+
+	assertRate(0, time.Minute, now.Add(time.Minute), 3)
+	assertRate(0, time.Minute-time.Second, now.Add(time.Minute), 1)
+	assertRate(0, time.Minute, now, 2)
+	assertRate(1, time.Minute, now.Add(time.Minute), 0)
+
+	// Recording an addition after the max window has passed should trim
+	// the additions that were made before it.
+	later := now.Add(MaxHTLCRateWindow + 30*time.Second)
+	if err := db.RecordHTLCAdd(chanID, 0, later); err != nil {
+		t.Fatalf("unable to record htlc add: %v", err)
+	}
+	assertRate(0, MaxHTLCRateWindow, later, 2)
+
+	err = db.View(func(tx *bbolt.Tx) error {
+		adds := tx.Bucket(htlcRateBucket).Bucket(
+			channelScoreKey(chanID, 0),
+		)
+		numAdds := adds.Stats().KeyN
+		if numAdds != 2 {
+			t.Fatalf("expected 2 stored additions, got %v", numAdds)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to read htlc additions: %v", err)
+	}
+
+	// Invalid directions and windows should be rejected.
+	err = db.RecordHTLCAdd(chanID, 2, now)
+	if err != ErrInvalidChannelDirection {
+		t.Fatalf("expected ErrInvalidChannelDirection, got %v", err)
+	}
+	_, err = db.HTLCRate(chanID, 0, MaxHTLCRateWindow+1, now)
+	if err != ErrHTLCRateWindowTooLarge {
+		t.Fatalf("expected ErrHTLCRateWindowTooLarge, got %v", err)
+	}
+}
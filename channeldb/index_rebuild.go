@@ -0,0 +1,899 @@
+package channeldb
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// RebuildReport describes the contents of each secondary index after it has
+// been rebuilt by RebuildAllIndexes.
+type RebuildReport struct {
+	// NodeUpdateIndex is the number of entries within the node update
+	// index.
+	NodeUpdateIndex uint64
+
+	// EdgeUpdateIndex is the number of entries within the edge update
+	// index.
+	EdgeUpdateIndex uint64
+
+	// ChannelPointIndex is the number of entries within the index mapping
+	// channel points to channel IDs.
+	ChannelPointIndex uint64
+
+	// InvoiceAddIndex is the number of entries within the invoice add
+	// index.
+	InvoiceAddIndex uint64
+
+	// InvoiceSettleIndex is the number of entries within the invoice
+	// settle index.
+	InvoiceSettleIndex uint64
+
+	// PaymentHashIndex is the number of entries within the invoice payment
+	// hash index.
+	PaymentHashIndex uint64
+
+	// NodeAddrTypeIndex is the number of entries within the index of
+	// nodes by the types of their addresses.
+	NodeAddrTypeIndex uint64
+
+	// ChannelUUIDIndex is the number of entries within the index of open
+	// channels by their UUID.
+	ChannelUUIDIndex uint64
+
+	// ForwardingChanIndex is the number of channels within the index of
+	// the most recent forward through each channel.
+	ForwardingChanIndex uint64
+
+	// PaymentGroupIndex is the number of payments indexed within the
+	// payment group index.
+	PaymentGroupIndex uint64
+
+	// PaymentChanIndex is the number of entries within the index of
+	// payments by their route channels, counting a payment once for each
+	// channel it's indexed under.
+	PaymentChanIndex uint64
+
+	// OfferInvoiceIndex is the number of invoices indexed within the index
+	// of invoices by the offer they were issued for.
+	OfferInvoiceIndex uint64
+
+	// PaymentAddrIndex is the number of entries within the index of
+	// invoices by their payment address.
+	PaymentAddrIndex uint64
+}
+
+// RebuildAllIndexes drops every secondary index of the graph and the invoices,
+// and rebuilds it from the records it indexes. It's meant as a recovery tool
+// after a corruption of the database, and is safe to run on a healthy
+// database, in which case the indexes are rebuilt as they were. Each family of
+// indexes is rebuilt within its own transaction, such that a failure leaves
+// any index either untouched or fully rebuilt.
+//
+// The payment hash index is the exception to the above, as an invoice doesn't
+// store its own payment hash, which therefore can't be derived for invoices
+// whose preimage is unknown. Instead, entries pointing to invoices that no
+// longer exist are removed, and invoices with a known preimage that aren't
+// referenced by the index are indexed under the hash of their preimage.
+//
+// Invoices whose offer no longer exists, and invoices whose payment address
+// is taken by an invoice preceding them, can't be indexed without breaking
+// the invariants of the offer and payment address indexes. They're logged and
+// left unindexed instead.
+func (d *DB) RebuildAllIndexes() (*RebuildReport, error) {
+	report := &RebuildReport{}
+
+	err := d.updateGraph(func(tx *bbolt.Tx) error {
+		var err error
+		report.NodeUpdateIndex, report.EdgeUpdateIndex, err =
+			rebuildUpdateIndexes(tx, d.updateIndexCache)
+		if err != nil {
+			return err
+		}
+
+		report.NodeAddrTypeIndex, err = rebuildNodeAddrTypeIndex(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.Update(func(tx *bbolt.Tx) error {
+		var err error
+		report.ChannelPointIndex, err = rebuildChannelPointIndex(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.Update(func(tx *bbolt.Tx) error {
+		var err error
+		report.ChannelUUIDIndex, err = rebuildChannelUUIDIndex(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.Update(func(tx *bbolt.Tx) error {
+		var err error
+		report.ForwardingChanIndex, err = rebuildForwardingChanIndex(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.Update(func(tx *bbolt.Tx) error {
+		var err error
+		report.PaymentGroupIndex, report.PaymentChanIndex, err =
+			rebuildPaymentIndexes(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.Update(func(tx *bbolt.Tx) error {
+		var err error
+		report.InvoiceAddIndex, report.InvoiceSettleIndex, err =
+			rebuildInvoiceSeqIndexes(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Settled invoices that were never assigned a settle index are picked
+	// up by the regular repair of the settle index.
+	numRepairs, err := d.RepairSettleIndex()
+	if err != nil {
+		return nil, err
+	}
+	if numRepairs > 0 {
+		log.Infof("Repaired %v entries of the settle index", numRepairs)
+
+		err := d.View(func(tx *bbolt.Tx) error {
+			settleIndex := tx.Bucket(invoiceBucket).Bucket(
+				settleIndexBucket,
+			)
+
+			numSettled, err := countEntries(settleIndex)
+			report.InvoiceSettleIndex = numSettled
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = d.Update(func(tx *bbolt.Tx) error {
+		var err error
+		report.PaymentHashIndex, err = rebuildPaymentHashIndex(tx)
+		if err != nil {
+			return err
+		}
+
+		report.OfferInvoiceIndex, report.PaymentAddrIndex, err =
+			rebuildInvoiceRecordIndexes(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// bucketParent is either a transaction holding top-level buckets, or a bucket
+// holding nested ones.
+type bucketParent interface {
+	Bucket(name []byte) *bbolt.Bucket
+	CreateBucket(name []byte) (*bbolt.Bucket, error)
+	DeleteBucket(name []byte) error
+}
+
+// recreateBucket deletes the named sub-bucket of parent if it exists, and
+// creates it anew, retaining its sequence number.
+func recreateBucket(parent bucketParent, name []byte) (*bbolt.Bucket,
+	error) {
+
+	var sequence uint64
+	if bucket := parent.Bucket(name); bucket != nil {
+		sequence = bucket.Sequence()
+		if err := parent.DeleteBucket(name); err != nil {
+			return nil, err
+		}
+	}
+
+	bucket, err := parent.CreateBucket(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := bucket.SetSequence(sequence); err != nil {
+		return nil, err
+	}
+
+	return bucket, nil
+}
+
+// countEntries returns the number of keys within the given bucket.
+func countEntries(bucket *bbolt.Bucket) (uint64, error) {
+	var numEntries uint64
+	err := bucket.ForEach(func(_, _ []byte) error {
+		numEntries++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return numEntries, nil
+}
+
+// countNestedEntries returns the number of keys within all sub-buckets of the
+// given bucket.
+func countNestedEntries(bucket *bbolt.Bucket) (uint64, error) {
+	var numEntries uint64
+	err := bucket.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nil
+		}
+
+		n, err := countEntries(bucket.Bucket(k))
+		numEntries += n
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return numEntries, nil
+}
+
+// rebuildUpdateIndexes rebuilds the node and edge update indexes from the
+// node announcements and channel updates they index. As both are mirrored by
+// the update index cache, they're rebuilt within the same transaction, which
+// is staged as a reset of the mirror followed by the addition of each key.
+func rebuildUpdateIndexes(tx *bbolt.Tx, cache *updateIndexCache) (uint64,
+	uint64, error) {
+
+	cache.stageReset()
+
+	var numNodes, numEdges uint64
+	if nodes := tx.Bucket(nodeBucket); nodes != nil {
+		updateIndex, err := recreateBucket(nodes, nodeUpdateIndexBucket)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		// Each node announcement starts with its update time, which
+		// precedes the node's length-prefixed public key within the
+		// index key.
+		var indexKeys [][]byte
+		err = nodes.ForEach(func(nodePub, nodeBytes []byte) error {
+			if nodeBytes == nil || len(nodePub) != 33 {
+				return nil
+			}
+			if len(nodeBytes) < 8 {
+				return io.ErrUnexpectedEOF
+			}
+
+			indexKey := nodeUpdateIndexKey(
+				byteOrder.Uint64(nodeBytes[:8]), nodePub,
+			)
+			indexKeys = append(indexKeys, indexKey)
+
+			return nil
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+
+		for _, indexKey := range indexKeys {
+			if err := updateIndex.Put(indexKey, nil); err != nil {
+				return 0, 0, err
+			}
+			cache.stagePut(nodeUpdateIndexKind, indexKey)
+		}
+		numNodes = uint64(len(indexKeys))
+	}
+
+	edges := tx.Bucket(edgeBucket)
+	if edges == nil {
+		return numNodes, 0, nil
+	}
+	updateIndex, err := recreateBucket(edges, edgeUpdateIndexBucket)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Each channel update is keyed by the public key of the node that
+	// issued it, followed by the channel ID. As the direction isn't part
+	// of the index key, both updates of a channel may map onto the same
+	// key, which is only counted once.
+	indexKeys := make(map[[8 + 8]byte]struct{})
+	err = edges.ForEach(func(edgeKey, edgeBytes []byte) error {
+		if edgeBytes == nil || len(edgeKey) != 33+8 ||
+			bytes.Equal(edgeBytes, unknownPolicy) {
+
+			return nil
+		}
+
+		updateUnix, err := edgePolicyUpdateTime(edgeBytes)
+		if err != nil {
+			return err
+		}
+
+		var indexKey [8 + 8]byte
+		byteOrder.PutUint64(indexKey[:8], updateUnix)
+		copy(indexKey[8:], edgeKey[33:])
+		indexKeys[indexKey] = struct{}{}
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for indexKey := range indexKeys {
+		if err := updateIndex.Put(indexKey[:], nil); err != nil {
+			return 0, 0, err
+		}
+		cache.stagePut(edgeUpdateIndexKind, indexKey[:])
+	}
+	numEdges = uint64(len(indexKeys))
+
+	return numNodes, numEdges, nil
+}
+
+// edgePolicyUpdateTime extracts the update time of a serialized channel
+// update, which follows its signature and channel ID.
+func edgePolicyUpdateTime(edgeBytes []byte) (uint64, error) {
+	r := bytes.NewReader(edgeBytes)
+
+	sigLen, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return 0, err
+	}
+	if sigLen+8 > uint64(r.Len()) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if _, err := r.Seek(int64(sigLen+8), io.SeekCurrent); err != nil {
+		return 0, err
+	}
+
+	var scratch [8]byte
+	if _, err := io.ReadFull(r, scratch[:]); err != nil {
+		return 0, err
+	}
+
+	return byteOrder.Uint64(scratch[:]), nil
+}
+
+// rebuildChannelPointIndex rebuilds the index mapping the channel point of
+// each channel to its channel ID from the channel edges.
+func rebuildChannelPointIndex(tx *bbolt.Tx) (uint64, error) {
+	edges := tx.Bucket(edgeBucket)
+	if edges == nil {
+		return 0, nil
+	}
+	edgeIndex := edges.Bucket(edgeIndexBucket)
+	if edgeIndex == nil {
+		return 0, nil
+	}
+	chanIndex, err := recreateBucket(edges, channelPointBucket)
+	if err != nil {
+		return 0, err
+	}
+
+	type channelPoint struct {
+		outpoint []byte
+		chanID   []byte
+	}
+	var chanPoints []channelPoint
+	err = edgeIndex.ForEach(func(chanID, edgeInfoBytes []byte) error {
+		edgeInfo, err := deserializeChanEdgeInfo(
+			bytes.NewReader(edgeInfoBytes),
+		)
+		if err != nil {
+			return err
+		}
+
+		chanPoints = append(chanPoints, channelPoint{
+			outpoint: canonicalChannelKey(edgeInfo.ChannelPoint),
+			chanID:   append([]byte(nil), chanID...),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, c := range chanPoints {
+		if err := chanIndex.Put(c.outpoint, c.chanID); err != nil {
+			return 0, err
+		}
+	}
+
+	return uint64(len(chanPoints)), nil
+}
+
+// rebuildInvoiceSeqIndexes rebuilds the add and settle indexes of the
+// invoices from the sequence numbers stored within each invoice. The sequence
+// of each index is advanced past the largest sequence number found if needed,
+// such that new entries never collide with existing ones.
+func rebuildInvoiceSeqIndexes(tx *bbolt.Tx) (uint64, uint64, error) {
+	invoices := tx.Bucket(invoiceBucket)
+	if invoices == nil {
+		return 0, 0, nil
+	}
+
+	type seqEntry struct {
+		seqNo      uint64
+		invoiceNum []byte
+	}
+	var addEntries, settleEntries []seqEntry
+	err := invoices.ForEach(func(invoiceNum, invoiceBytes []byte) error {
+		if invoiceBytes == nil {
+			return nil
+		}
+
+		invoice, err := deserializeInvoice(
+			bytes.NewReader(invoiceBytes),
+		)
+		if err != nil {
+			return err
+		}
+
+		invoiceNum = append([]byte(nil), invoiceNum...)
+		if invoice.AddIndex != 0 {
+			addEntries = append(addEntries, seqEntry{
+				seqNo:      invoice.AddIndex,
+				invoiceNum: invoiceNum,
+			})
+		}
+		if invoice.Terms.State == ContractSettled &&
+			invoice.SettleIndex != 0 {
+
+			settleEntries = append(settleEntries, seqEntry{
+				seqNo:      invoice.SettleIndex,
+				invoiceNum: invoiceNum,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	rebuild := func(name []byte, entries []seqEntry) (uint64, error) {
+		index, err := recreateBucket(invoices, name)
+		if err != nil {
+			return 0, err
+		}
+
+		sequence := index.Sequence()
+		for _, e := range entries {
+			var seqNoBytes [8]byte
+			byteOrder.PutUint64(seqNoBytes[:], e.seqNo)
+			err := index.Put(seqNoBytes[:], e.invoiceNum)
+			if err != nil {
+				return 0, err
+			}
+
+			if e.seqNo > sequence {
+				sequence = e.seqNo
+			}
+		}
+		if err := index.SetSequence(sequence); err != nil {
+			return 0, err
+		}
+
+		return countEntries(index)
+	}
+
+	numAdded, err := rebuild(addIndexBucket, addEntries)
+	if err != nil {
+		return 0, 0, err
+	}
+	numSettled, err := rebuild(settleIndexBucket, settleEntries)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return numAdded, numSettled, nil
+}
+
+// rebuildPaymentHashIndex removes all entries of the payment hash index that
+// point to an invoice which doesn't exist, and indexes each unreferenced
+// invoice with a known preimage under the hash of its preimage.
+func rebuildPaymentHashIndex(tx *bbolt.Tx) (uint64, error) {
+	invoices := tx.Bucket(invoiceBucket)
+	if invoices == nil {
+		return 0, nil
+	}
+	invoiceIndex, err := invoices.CreateBucketIfNotExists(
+		invoiceIndexBucket,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		danglingHashes [][]byte
+		indexed        = make(map[string]struct{})
+	)
+	err = invoiceIndex.ForEach(func(payHash, invoiceNum []byte) error {
+		if bytes.Equal(payHash, numInvoicesKey) {
+			return nil
+		}
+
+		if invoices.Get(invoiceNum) == nil {
+			danglingHashes = append(danglingHashes, payHash)
+			return nil
+		}
+		indexed[string(invoiceNum)] = struct{}{}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, payHash := range danglingHashes {
+		if err := invoiceIndex.Delete(payHash); err != nil {
+			return 0, err
+		}
+	}
+
+	type hashEntry struct {
+		payHash    [32]byte
+		invoiceNum []byte
+	}
+	var (
+		unindexed     []hashEntry
+		numInvoices   int
+		maxInvoiceNum uint32
+	)
+	err = invoices.ForEach(func(invoiceNum, invoiceBytes []byte) error {
+		if invoiceBytes == nil || len(invoiceNum) != 4 {
+			return nil
+		}
+
+		numInvoices++
+		if num := byteOrder.Uint32(invoiceNum); num > maxInvoiceNum {
+			maxInvoiceNum = num
+		}
+
+		if _, ok := indexed[string(invoiceNum)]; ok {
+			return nil
+		}
+
+		payHash, ok, err := invoicePaymentHash(invoiceBytes)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			log.Warnf("Unable to index invoice %x with unknown "+
+				"preimage", invoiceNum)
+			return nil
+		}
+
+		unindexed = append(unindexed, hashEntry{
+			payHash:    payHash,
+			invoiceNum: append([]byte(nil), invoiceNum...),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	numEntries := uint64(len(indexed))
+	for _, u := range unindexed {
+		if invoiceIndex.Get(u.payHash[:]) != nil {
+			log.Warnf("Unable to index invoice %x under taken "+
+				"payment hash %x", u.invoiceNum, u.payHash)
+			continue
+		}
+
+		err := invoiceIndex.Put(u.payHash[:], u.invoiceNum)
+		if err != nil {
+			return 0, err
+		}
+		numEntries++
+	}
+
+	// Finally, we'll ensure the invoice counter lies past all existing
+	// invoices, such that a new invoice doesn't overwrite an existing one.
+	invoiceCounter := invoiceIndex.Get(numInvoicesKey)
+	if numInvoices > 0 && (len(invoiceCounter) != 4 ||
+		byteOrder.Uint32(invoiceCounter) <= maxInvoiceNum) {
+
+		var scratch [4]byte
+		byteOrder.PutUint32(scratch[:], maxInvoiceNum+1)
+		err := invoiceIndex.Put(numInvoicesKey, scratch[:])
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return numEntries, nil
+}
+
+// rebuildNodeAddrTypeIndex rebuilds the index of nodes by the types of the
+// addresses they advertise from the announcements of the nodes.
+func rebuildNodeAddrTypeIndex(tx *bbolt.Tx) (uint64, error) {
+	nodes := tx.Bucket(nodeBucket)
+	if nodes == nil {
+		return 0, nil
+	}
+
+	// We'll gather all nodes first, as the index is nested within the
+	// node bucket, which can't be modified while iterating over it.
+	var announced []LightningNode
+	err := nodes.ForEach(func(nodePub, nodeBytes []byte) error {
+		if nodeBytes == nil || len(nodePub) != 33 {
+			return nil
+		}
+
+		node, err := deserializeLightningNode(
+			bytes.NewReader(nodeBytes),
+		)
+		if err != nil {
+			return err
+		}
+		if node.HaveNodeAnnouncement {
+			announced = append(announced, node)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	index, err := recreateBucket(nodes, nodeAddrTypeIndexBucket)
+	if err != nil {
+		return 0, err
+	}
+	for _, node := range announced {
+		err := updateNodeAddrTypeIndex(
+			nodes, node.PubKeyBytes[:], nil, node.Addresses,
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return countEntries(index)
+}
+
+// rebuildChannelUUIDIndex rebuilds the index of open channels by their UUID
+// from the UUID stored within the bucket of each open channel.
+func rebuildChannelUUIDIndex(tx *bbolt.Tx) (uint64, error) {
+	uuidIndex, err := recreateBucket(tx, channelUUIDIndexBucket)
+	if err != nil {
+		return 0, err
+	}
+
+	openChanBucket := tx.Bucket(openChannelBucket)
+	if openChanBucket == nil {
+		return 0, nil
+	}
+
+	// Each channel bucket is nested within the buckets of its node and
+	// chain, whose keys make up the location stored within the index.
+	err = openChanBucket.ForEach(func(nodePub, v []byte) error {
+		if v != nil {
+			return nil
+		}
+
+		nodeChanBucket := openChanBucket.Bucket(nodePub)
+		return nodeChanBucket.ForEach(func(chainHash, v []byte) error {
+			if v != nil {
+				return nil
+			}
+
+			chainBucket := nodeChanBucket.Bucket(chainHash)
+			return chainBucket.ForEach(func(k, _ []byte) error {
+				chanBucket := chainBucket.Bucket(k)
+				if chanBucket == nil {
+					return nil
+				}
+				id := chanBucket.Get(chanUUIDKey)
+				if len(id) != 16 {
+					return nil
+				}
+
+				var location []byte
+				location = append(location, nodePub...)
+				location = append(location, chainHash...)
+				location = append(location, k...)
+
+				return uuidIndex.Put(id, location)
+			})
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return countEntries(uuidIndex)
+}
+
+// rebuildForwardingChanIndex rebuilds the index of the most recent forward
+// through each channel from the forwarding log.
+func rebuildForwardingChanIndex(tx *bbolt.Tx) (uint64, error) {
+	fwdIndex, err := recreateBucket(tx, forwardingChanIndexBucket)
+	if err != nil {
+		return 0, err
+	}
+
+	logBucket := tx.Bucket(forwardingLogBucket)
+	if logBucket == nil {
+		return 0, nil
+	}
+
+	err = logBucket.ForEach(func(k, v []byte) error {
+		timestamp := time.Unix(0, int64(byteOrder.Uint64(k)))
+
+		readBuf := bytes.NewReader(v)
+		for readBuf.Len() != 0 {
+			var event ForwardingEvent
+			err := decodeForwardingEvent(readBuf, &event)
+			if err != nil {
+				return err
+			}
+
+			chanIDs := []lnwire.ShortChannelID{
+				event.IncomingChanID, event.OutgoingChanID,
+			}
+			for _, chanID := range chanIDs {
+				err := putLastForward(
+					fwdIndex, chanID.ToUint64(), timestamp,
+				)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return countEntries(fwdIndex)
+}
+
+// rebuildPaymentIndexes rebuilds the payment group index and the index of
+// payments by their route channels from the outgoing payments.
+func rebuildPaymentIndexes(tx *bbolt.Tx) (uint64, uint64, error) {
+	groupIndex, err := recreateBucket(tx, paymentGroupIndexBucket)
+	if err != nil {
+		return 0, 0, err
+	}
+	chanIndex, err := recreateBucket(tx, paymentChanIndexBucket)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	payments := tx.Bucket(paymentBucket)
+	if payments == nil {
+		return 0, 0, nil
+	}
+
+	err = payments.ForEach(func(paymentID, paymentBytes []byte) error {
+		if paymentBytes == nil {
+			return nil
+		}
+
+		payment, err := deserializeOutgoingPayment(
+			bytes.NewReader(paymentBytes),
+		)
+		if err != nil {
+			return err
+		}
+
+		err = putPaymentGroupIndex(tx, payment.GroupID, paymentID)
+		if err != nil {
+			return err
+		}
+
+		return putPaymentChanIndex(tx, payment.RouteChanIDs, paymentID)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	numGrouped, err := countNestedEntries(groupIndex)
+	if err != nil {
+		return 0, 0, err
+	}
+	numRouted, err := countNestedEntries(chanIndex)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return numGrouped, numRouted, nil
+}
+
+// rebuildInvoiceRecordIndexes rebuilds the index of invoices by the offer they
+// were issued for and the index of invoices by their payment address from the
+// invoices.
+func rebuildInvoiceRecordIndexes(tx *bbolt.Tx) (uint64, uint64, error) {
+	offerIndex, err := recreateBucket(tx, offerInvoiceIndexBucket)
+	if err != nil {
+		return 0, 0, err
+	}
+	addrIndex, err := recreateBucket(tx, paymentAddrIndexBucket)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	invoices := tx.Bucket(invoiceBucket)
+	if invoices == nil {
+		return 0, 0, nil
+	}
+
+	err = invoices.ForEach(func(invoiceNum, invoiceBytes []byte) error {
+		if invoiceBytes == nil || len(invoiceNum) != 4 {
+			return nil
+		}
+
+		invoice, err := deserializeInvoice(
+			bytes.NewReader(invoiceBytes),
+		)
+		if err != nil {
+			return err
+		}
+
+		err = putOfferInvoiceIndex(tx, &invoice, invoiceNum)
+		switch {
+		case err == ErrOfferNotFound:
+			log.Warnf("Unable to index invoice %x under unknown "+
+				"offer %x", invoiceNum, invoice.OfferID)
+
+		case err != nil:
+			return err
+		}
+
+		err = putPaymentAddrIndex(tx, &invoice, invoiceNum)
+		switch {
+		case err == ErrDuplicatePaymentAddr:
+			log.Warnf("Unable to index invoice %x under taken "+
+				"payment address %x", invoiceNum,
+				invoice.PaymentAddr)
+
+		case err != nil:
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	numOffered, err := countNestedEntries(offerIndex)
+	if err != nil {
+		return 0, 0, err
+	}
+	numAddrs, err := countEntries(addrIndex)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return numOffered, numAddrs, nil
+}
@@ -0,0 +1,324 @@
+package channeldb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lntypes"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// secondaryIndexes are the bucket path of each index that's rebuilt by
+// RebuildAllIndexes, starting with its top-level bucket.
+var secondaryIndexes = [][][]byte{
+	{nodeBucket, nodeUpdateIndexBucket},
+	{nodeBucket, nodeAddrTypeIndexBucket},
+	{edgeBucket, edgeUpdateIndexBucket},
+	{edgeBucket, channelPointBucket},
+	{invoiceBucket, addIndexBucket},
+	{invoiceBucket, settleIndexBucket},
+	{invoiceBucket, invoiceIndexBucket},
+	{channelUUIDIndexBucket},
+	{forwardingChanIndexBucket},
+	{paymentGroupIndexBucket},
+	{paymentChanIndexBucket},
+	{offerInvoiceIndexBucket},
+	{paymentAddrIndexBucket},
+}
+
+// indexBucket returns the bucket of the index with the passed path.
+func indexBucket(tx *bbolt.Tx, path [][]byte) *bbolt.Bucket {
+	bucket := tx.Bucket(path[0])
+	for _, name := range path[1:] {
+		bucket = bucket.Bucket(name)
+	}
+
+	return bucket
+}
+
+// snapshotIndexes returns the contents and sequence numbers of all secondary
+// indexes. The entries of nested buckets are prefixed by the bucket's key.
+func snapshotIndexes(t *testing.T, db *DB) map[string]map[string]string {
+	t.Helper()
+
+	var snapshotBucket func(map[string]string, string, *bbolt.Bucket) error
+	snapshotBucket = func(entries map[string]string, prefix string,
+		bucket *bbolt.Bucket) error {
+
+		return bucket.ForEach(func(k, v []byte) error {
+			if v == nil {
+				return snapshotBucket(
+					entries, prefix+string(k)+"/",
+					bucket.Bucket(k),
+				)
+			}
+
+			entries[prefix+string(k)] = string(v)
+			return nil
+		})
+	}
+
+	snapshot := make(map[string]map[string]string)
+	err := db.View(func(tx *bbolt.Tx) error {
+		for _, index := range secondaryIndexes {
+			bucket := indexBucket(tx, index)
+
+			entries := make(map[string]string)
+			err := snapshotBucket(entries, "", bucket)
+			if err != nil {
+				return err
+			}
+			entries["sequence"] = fmt.Sprint(bucket.Sequence())
+
+			snapshot[string(index[len(index)-1])] = entries
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to snapshot indexes: %v", err)
+	}
+
+	return snapshot
+}
+
+// TestRebuildAllIndexes asserts that rebuilding the secondary indexes of a
+// healthy database leaves them untouched, and that they're restored after
+// being corrupted.
+func TestRebuildAllIndexes(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	if err := db.EnableUpdateIndexCache(100); err != nil {
+		t.Fatalf("unable to enable update index cache: %v", err)
+	}
+	graph := db.ChannelGraph()
+
+	// We'll populate the graph with three nodes, connected by two
+	// channels.
+	var nodes []*LightningNode
+	for i := 0; i < 3; i++ {
+		node, err := createTestVertex(db)
+		if err != nil {
+			t.Fatalf("unable to create test node: %v", err)
+		}
+		node.LastUpdate = time.Unix(int64(1000+i), 0)
+		if err := graph.AddLightningNode(node); err != nil {
+			t.Fatalf("unable to add node: %v", err)
+		}
+		nodes = append(nodes, node)
+	}
+	for i := 0; i < 2; i++ {
+		edgeInfo, edge1, edge2 := createChannelEdge(
+			db, nodes[i], nodes[i+1],
+		)
+		edgeInfo.ChannelPoint.Index = uint32(i)
+		edge1.LastUpdate = time.Unix(int64(2000+2*i), 0)
+		edge2.LastUpdate = time.Unix(int64(2001+2*i), 0)
+
+		if err := graph.AddChannelEdge(edgeInfo); err != nil {
+			t.Fatalf("unable to add edge: %v", err)
+		}
+		if err := graph.UpdateEdgePolicy(edge1); err != nil {
+			t.Fatalf("unable to update edge: %v", err)
+		}
+		if err := graph.UpdateEdgePolicy(edge2); err != nil {
+			t.Fatalf("unable to update edge: %v", err)
+		}
+	}
+
+	// We'll also add an open channel, and forward through three
+	// channels.
+	channel, err := createTestChannelState(db)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 18555}
+	if err := channel.SyncPending(addr, 99); err != nil {
+		t.Fatalf("unable to sync channel: %v", err)
+	}
+
+	events := make([]ForwardingEvent, 2)
+	for i := range events {
+		events[i] = ForwardingEvent{
+			Timestamp:      time.Unix(int64(3000+i), 0),
+			IncomingChanID: lnwire.NewShortChanIDFromInt(uint64(i)),
+			OutgoingChanID: lnwire.NewShortChanIDFromInt(
+				uint64(i + 1),
+			),
+			AmtIn:  2000,
+			AmtOut: 1000,
+		}
+	}
+	err = db.ForwardingLog().AddForwardingEvents(events)
+	if err != nil {
+		t.Fatalf("unable to add forwarding events: %v", err)
+	}
+
+	// Next, we'll add a payment sent as part of a group through two
+	// channels, along with one that wasn't.
+	for i := 0; i < 2; i++ {
+		payment, err := makeRandomFakePayment()
+		if err != nil {
+			t.Fatalf("unable to create payment: %v", err)
+		}
+		if i == 0 {
+			payment.GroupID = [16]byte{1}
+			payment.Path = make([][33]byte, 2)
+			payment.RouteChanIDs = []uint64{1, 2}
+		}
+		if err := db.AddPayment(payment); err != nil {
+			t.Fatalf("unable to add payment: %v", err)
+		}
+	}
+
+	// Finally, we'll add a settled invoice issued for an offer, along
+	// with a hold invoice whose preimage is unknown.
+	offerID := [32]byte{2}
+	if err := db.AddOffer(offerID, []byte("offer")); err != nil {
+		t.Fatalf("unable to add offer: %v", err)
+	}
+
+	amt := lnwire.NewMSatFromSatoshis(1000)
+	settledInvoice, err := randInvoice(amt)
+	if err != nil {
+		t.Fatalf("unable to create invoice: %v", err)
+	}
+	settledInvoice.OfferID = offerID
+	settledInvoice.PaymentAddr = [32]byte{3}
+	settledHash := settledInvoice.Terms.PaymentPreimage.Hash()
+	if _, err := db.AddInvoice(settledInvoice, settledHash); err != nil {
+		t.Fatalf("unable to add invoice: %v", err)
+	}
+	if _, err := db.AcceptOrSettleInvoice(settledHash, amt); err != nil {
+		t.Fatalf("unable to settle invoice: %v", err)
+	}
+
+	holdInvoice, err := randInvoice(amt)
+	if err != nil {
+		t.Fatalf("unable to create invoice: %v", err)
+	}
+	holdInvoice.Terms.PaymentPreimage = UnknownPreimage
+
+	var holdHash lntypes.Hash
+	if _, err := rand.Read(holdHash[:]); err != nil {
+		t.Fatalf("unable to generate hash: %v", err)
+	}
+	if _, err := db.AddInvoice(holdInvoice, holdHash); err != nil {
+		t.Fatalf("unable to add invoice: %v", err)
+	}
+
+	expectedReport := &RebuildReport{
+		NodeUpdateIndex:     3,
+		EdgeUpdateIndex:     4,
+		ChannelPointIndex:   2,
+		InvoiceAddIndex:     2,
+		InvoiceSettleIndex:  1,
+		PaymentHashIndex:    2,
+		NodeAddrTypeIndex:   6,
+		ChannelUUIDIndex:    1,
+		ForwardingChanIndex: 3,
+		PaymentGroupIndex:   2,
+		PaymentChanIndex:    2,
+		OfferInvoiceIndex:   1,
+		PaymentAddrIndex:    1,
+	}
+	rebuild := func() {
+		t.Helper()
+
+		report, err := db.RebuildAllIndexes()
+		if err != nil {
+			t.Fatalf("unable to rebuild indexes: %v", err)
+		}
+		if !reflect.DeepEqual(report, expectedReport) {
+			t.Fatalf("expected report %v, got %v", expectedReport,
+				report)
+		}
+	}
+
+	// Rebuilding the indexes of the healthy database shouldn't modify
+	// them.
+	snapshot := snapshotIndexes(t, db)
+	rebuild()
+	if !reflect.DeepEqual(snapshotIndexes(t, db), snapshot) {
+		t.Fatalf("indexes modified by rebuild of healthy database")
+	}
+	assertUpdateIndexMirror(t, db)
+
+	// We'll now corrupt each index by removing some entries and adding
+	// some bogus ones. This is done directly on disk, leaving the update
+	// index cache stale.
+	bogusKey := []byte("bogus")
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, index := range secondaryIndexes {
+			bucket := indexBucket(tx, index)
+
+			var keys [][]byte
+			err := bucket.ForEach(func(k, _ []byte) error {
+				keys = append(keys, k)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			// As the payment hash of an invoice can only be
+			// restored if its preimage is known, we'll remove
+			// that of the settled invoice.
+			toDelete := keys[len(keys)-1]
+			name := index[len(index)-1]
+			if bytes.Equal(name, invoiceIndexBucket) {
+				toDelete = settledHash[:]
+			}
+
+			// Entries of nested indexes are removed along with
+			// their bucket.
+			err = bucket.Delete(toDelete)
+			if err == bbolt.ErrIncompatibleValue {
+				err = bucket.DeleteBucket(toDelete)
+			}
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(bogusKey, bogusKey); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to corrupt indexes: %v", err)
+	}
+
+	rebuild()
+	if !reflect.DeepEqual(snapshotIndexes(t, db), snapshot) {
+		t.Fatalf("indexes not restored by rebuild")
+	}
+	assertUpdateIndexMirror(t, db)
+
+	// Finally, a new invoice should be assigned the next add index.
+	invoice, err := randInvoice(amt)
+	if err != nil {
+		t.Fatalf("unable to create invoice: %v", err)
+	}
+	addIndex, err := db.AddInvoice(
+		invoice, invoice.Terms.PaymentPreimage.Hash(),
+	)
+	if err != nil {
+		t.Fatalf("unable to add invoice: %v", err)
+	}
+	if addIndex != 3 {
+		t.Fatalf("expected add index 3, got %v", addIndex)
+	}
+}
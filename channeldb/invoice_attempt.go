@@ -0,0 +1,114 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lntypes"
+)
+
+const (
+	// htlcAttemptedType is the TLV record type marking an invoice that an
+	// HTLC paying to it has been seen for. Invoices that were never
+	// attempted don't carry the record.
+	htlcAttemptedType uint64 = 3
+)
+
+// MarkInvoiceAttempted records that an HTLC paying to the invoice with the
+// given payment hash has been seen, whether it was accepted or not. The state
+// of the invoice is left unchanged, and marking an invoice that was attempted
+// already is a noop.
+func (d *DB) MarkInvoiceAttempted(paymentHash lntypes.Hash) error {
+	return d.Update(func(tx *bbolt.Tx) error {
+		invoices := tx.Bucket(invoiceBucket)
+		if invoices == nil {
+			return ErrNoInvoicesCreated
+		}
+		invoiceIndex := invoices.Bucket(invoiceIndexBucket)
+		if invoiceIndex == nil {
+			return ErrNoInvoicesCreated
+		}
+
+		invoiceNum := invoiceIndex.Get(paymentHash[:])
+		if invoiceNum == nil {
+			return ErrInvoiceNotFound
+		}
+
+		invoiceBytes := invoices.Get(invoiceNum)
+		if invoiceBytes == nil {
+			return ErrInvoiceNotFound
+		}
+		invoice, err := deserializeInvoice(
+			bytes.NewReader(invoiceBytes),
+		)
+		if err != nil {
+			return err
+		}
+		if invoice.HtlcAttempted {
+			return nil
+		}
+
+		invoice.HtlcAttempted = true
+
+		return putInvoiceRecord(invoices, invoiceNum, &invoice)
+	})
+}
+
+// UnattemptedInvoices returns all open invoices that were created more than
+// olderThan before now, and that no HTLC paying to them has ever been seen
+// for. These are invoices that were abandoned before the payer attempted to
+// pay them, and may be canceled. Invoices that are settled, accepted or
+// canceled, or that an HTLC was seen for, are never returned.
+func (d *DB) UnattemptedInvoices(olderThan time.Duration,
+	now time.Time) ([]Invoice, error) {
+
+	cutoff := now.Add(-olderThan)
+
+	var invoices []Invoice
+	err := d.View(func(tx *bbolt.Tx) error {
+		invoiceB := tx.Bucket(invoiceBucket)
+		if invoiceB == nil {
+			return nil
+		}
+
+		return invoiceB.ForEach(func(k, v []byte) error {
+			if v == nil {
+				return nil
+			}
+
+			invoice, err := deserializeInvoice(bytes.NewReader(v))
+			if err != nil {
+				return err
+			}
+
+			if invoice.Terms.State != ContractOpen ||
+				invoice.HtlcAttempted ||
+				!invoice.CreationDate.Before(cutoff) {
+
+				return nil
+			}
+
+			invoices = append(invoices, invoice)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return invoices, nil
+}
+
+// decodeHtlcAttempted deserializes the value of an invoice's HTLC attempted
+// record.
+func decodeHtlcAttempted(value []byte) (bool, error) {
+	if len(value) != 1 || value[0] != 1 {
+		return false, fmt.Errorf("invalid htlc attempted record %x",
+			value)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,92 @@
+package channeldb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lntypes"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestUnattemptedInvoices asserts that only open invoices older than the
+// threshold that no HTLC was ever seen for are returned as unattempted.
+func TestUnattemptedInvoices(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	now := time.Unix(time.Now().Unix(), 0)
+	amt := lnwire.NewMSatFromSatoshis(1000)
+
+	addInvoice := func(age time.Duration) lntypes.Hash {
+		t.Helper()
+
+		invoice, err := randInvoice(amt)
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+		invoice.CreationDate = now.Add(-age)
+
+		payHash := invoice.Terms.PaymentPreimage.Hash()
+		if _, err := db.AddInvoice(invoice, payHash); err != nil {
+			t.Fatalf("unable to add invoice: %v", err)
+		}
+
+		return payHash
+	}
+
+	// We'll add an old invoice that was never attempted, a recent one, an
+	// old one that had a rejected HTLC, and old ones that were settled and
+	// canceled.
+	abandoned := addInvoice(2 * time.Hour)
+	addInvoice(time.Minute)
+
+	rejected := addInvoice(2 * time.Hour)
+	if err := db.MarkInvoiceAttempted(rejected); err != nil {
+		t.Fatalf("unable to mark invoice attempted: %v", err)
+	}
+
+	settled := addInvoice(2 * time.Hour)
+	if _, err := db.AcceptOrSettleInvoice(settled, amt); err != nil {
+		t.Fatalf("unable to settle invoice: %v", err)
+	}
+
+	canceled := addInvoice(2 * time.Hour)
+	if _, err := db.CancelInvoice(canceled); err != nil {
+		t.Fatalf("unable to cancel invoice: %v", err)
+	}
+
+	invoices, err := db.UnattemptedInvoices(time.Hour, now)
+	if err != nil {
+		t.Fatalf("unable to fetch unattempted invoices: %v", err)
+	}
+	if len(invoices) != 1 {
+		t.Fatalf("expected 1 unattempted invoice, got %v",
+			len(invoices))
+	}
+	if invoices[0].Terms.PaymentPreimage.Hash() != abandoned {
+		t.Fatalf("expected invoice %v, got %v", abandoned,
+			invoices[0].Terms.PaymentPreimage.Hash())
+	}
+
+	// The attempt should be recorded on the invoice itself, without
+	// changing its state.
+	invoice, err := db.LookupInvoice(rejected)
+	if err != nil {
+		t.Fatalf("unable to lookup invoice: %v", err)
+	}
+	if !invoice.HtlcAttempted || invoice.Terms.State != ContractOpen {
+		t.Fatalf("expected open attempted invoice, got attempted=%v "+
+			"state=%v", invoice.HtlcAttempted, invoice.Terms.State)
+	}
+
+	var unknownHash lntypes.Hash
+	err = db.MarkInvoiceAttempted(unknownHash)
+	if err != ErrInvoiceNotFound {
+		t.Fatalf("expected ErrInvoiceNotFound, got %v", err)
+	}
+}
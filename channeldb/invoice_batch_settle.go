@@ -0,0 +1,104 @@
+package channeldb
+
+import (
+	"fmt"
+
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lntypes"
+)
+
+// ErrDuplicateSettlement is returned when a batch of settlements contains the
+// same payment hash more than once.
+var ErrDuplicateSettlement = fmt.Errorf("payment hash settled more than " +
+	"once within batch")
+
+// InvoiceSettlement reveals the preimage of an accepted hold invoice, settling
+// it.
+type InvoiceSettlement struct {
+	// Hash is the payment hash of the invoice to settle.
+	Hash lntypes.Hash
+
+	// Preimage is the preimage of the payment hash.
+	Preimage lntypes.Preimage
+}
+
+// SettleInvoices settles a batch of accepted hold invoices within a single
+// transaction, assigning each a settle index in the order of the batch. All
+// settlements are validated before any invoice is written: if a preimage
+// doesn't match its hash, an invoice can't be found, or an invoice isn't in
+// the accepted state, the batch fails as a whole and no invoice is settled.
+func (d *DB) SettleInvoices(settlements []InvoiceSettlement) error {
+	seen := make(map[lntypes.Hash]struct{}, len(settlements))
+	for _, settlement := range settlements {
+		if !settlement.Preimage.Matches(settlement.Hash) {
+			return ErrInvoicePreimageMismatch
+		}
+		if _, ok := seen[settlement.Hash]; ok {
+			return ErrDuplicateSettlement
+		}
+		seen[settlement.Hash] = struct{}{}
+	}
+
+	if len(settlements) == 0 {
+		return nil
+	}
+
+	return d.Update(func(tx *bbolt.Tx) error {
+		invoices, err := tx.CreateBucketIfNotExists(invoiceBucket)
+		if err != nil {
+			return err
+		}
+		invoiceIndex, err := invoices.CreateBucketIfNotExists(
+			invoiceIndexBucket,
+		)
+		if err != nil {
+			return err
+		}
+		settleIndex, err := invoices.CreateBucketIfNotExists(
+			settleIndexBucket,
+		)
+		if err != nil {
+			return err
+		}
+
+		// We'll first ensure every invoice can be settled, such that
+		// we don't write a partial batch.
+		invoiceNums := make([][]byte, 0, len(settlements))
+		for _, settlement := range settlements {
+			invoiceNum := invoiceIndex.Get(settlement.Hash[:])
+			if invoiceNum == nil {
+				return ErrInvoiceNotFound
+			}
+
+			_, state, _, err := deserializeInvoiceState(
+				invoices.Get(invoiceNum),
+			)
+			if err != nil {
+				return err
+			}
+
+			switch state {
+			case ContractOpen:
+				return ErrInvoiceStillOpen
+			case ContractCanceled:
+				return ErrInvoiceAlreadyCanceled
+			case ContractSettled:
+				return ErrInvoiceAlreadySettled
+			}
+
+			invoiceNums = append(invoiceNums, invoiceNum)
+		}
+
+		for i, invoiceNum := range invoiceNums {
+			_, err := settleHoldInvoice(
+				invoices, settleIndex, invoiceNum,
+				settlements[i].Preimage,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
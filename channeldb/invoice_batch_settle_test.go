@@ -0,0 +1,123 @@
+package channeldb
+
+import (
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lntypes"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestSettleInvoices asserts that a batch of hold invoices is settled as a
+// whole, and that a batch containing an invalid settlement settles none of
+// its invoices.
+func TestSettleInvoices(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	// We'll add a few accepted hold invoices, retaining their preimages
+	// as settlements.
+	const numInvoices = 3
+	amt := lnwire.NewMSatFromSatoshis(1000)
+	settlements := make([]InvoiceSettlement, 0, numInvoices)
+	for i := 0; i < numInvoices; i++ {
+		invoice, err := randInvoice(amt)
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+		preimage := invoice.Terms.PaymentPreimage
+		invoice.Terms.PaymentPreimage = UnknownPreimage
+
+		hash := preimage.Hash()
+		if _, err := db.AddInvoice(invoice, hash); err != nil {
+			t.Fatalf("unable to add invoice: %v", err)
+		}
+		if _, err := db.AcceptOrSettleInvoice(hash, amt); err != nil {
+			t.Fatalf("unable to accept invoice: %v", err)
+		}
+
+		settlements = append(settlements, InvoiceSettlement{
+			Hash:     hash,
+			Preimage: preimage,
+		})
+	}
+
+	assertNumSettled := func(expected int) {
+		t.Helper()
+
+		settled, err := db.InvoicesSettledSince(0)
+		if err != nil {
+			t.Fatalf("unable to query settled invoices: %v", err)
+		}
+		if len(settled) != expected {
+			t.Fatalf("expected %v settled invoices, got %v",
+				expected, len(settled))
+		}
+	}
+
+	// A batch with a preimage not matching its hash should be rejected.
+	mismatched := append([]InvoiceSettlement(nil), settlements...)
+	mismatched[1].Preimage = settlements[0].Preimage
+	err = db.SettleInvoices(mismatched)
+	if err != ErrInvoicePreimageMismatch {
+		t.Fatalf("expected ErrInvoicePreimageMismatch, got %v", err)
+	}
+
+	// A batch with an unknown invoice should be rejected, without settling
+	// the invoices preceding it.
+	var unknownPreimage lntypes.Preimage
+	unknownPreimage[0] = 1
+	unknown := append([]InvoiceSettlement(nil), settlements...)
+	unknown = append(unknown, InvoiceSettlement{
+		Hash:     unknownPreimage.Hash(),
+		Preimage: unknownPreimage,
+	})
+	if err := db.SettleInvoices(unknown); err != ErrInvoiceNotFound {
+		t.Fatalf("expected ErrInvoiceNotFound, got %v", err)
+	}
+	assertNumSettled(0)
+
+	duplicate := append([]InvoiceSettlement(nil), settlements...)
+	duplicate = append(duplicate, settlements[0])
+	if err := db.SettleInvoices(duplicate); err != ErrDuplicateSettlement {
+		t.Fatalf("expected ErrDuplicateSettlement, got %v", err)
+	}
+
+	// The valid batch should settle all invoices, in the order of the
+	// batch.
+	if err := db.SettleInvoices(settlements); err != nil {
+		t.Fatalf("unable to settle invoices: %v", err)
+	}
+	assertNumSettled(numInvoices)
+
+	for i, settlement := range settlements {
+		invoice, err := db.LookupInvoice(settlement.Hash)
+		if err != nil {
+			t.Fatalf("unable to lookup invoice: %v", err)
+		}
+		if invoice.Terms.State != ContractSettled {
+			t.Fatalf("expected invoice to be settled, got %v",
+				invoice.Terms.State)
+		}
+		if invoice.Terms.PaymentPreimage != settlement.Preimage {
+			t.Fatalf("expected preimage %v, got %v",
+				settlement.Preimage,
+				invoice.Terms.PaymentPreimage)
+		}
+		if invoice.SettleIndex != uint64(i+1) {
+			t.Fatalf("expected settle index %v, got %v", i+1,
+				invoice.SettleIndex)
+		}
+	}
+
+	// Settling an already settled invoice again should fail.
+	err = db.SettleInvoices(settlements[:1])
+	if err != ErrInvoiceAlreadySettled {
+		t.Fatalf("expected ErrInvoiceAlreadySettled, got %v", err)
+	}
+	assertNumSettled(numInvoices)
+}
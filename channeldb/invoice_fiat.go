@@ -0,0 +1,107 @@
+package channeldb
+
+import (
+	"fmt"
+)
+
+const (
+	// fiatAmountType is the TLV record type of an invoice's fiat amount.
+	// The record holds the 8 byte amount followed by the currency code.
+	fiatAmountType uint64 = 0
+
+	// exchangeRateType is the TLV record type of an invoice's exchange
+	// rate, which holds the rate as 8 bytes.
+	exchangeRateType uint64 = 1
+
+	// fiatCurrencyCodeLen is the length of an ISO 4217 currency code.
+	fiatCurrencyCodeLen = 3
+)
+
+var (
+	// ErrInvalidFiatCurrency is returned when the currency of a fiat
+	// amount isn't an ISO 4217 code consisting of three upper case
+	// letters.
+	ErrInvalidFiatCurrency = fmt.Errorf("fiat currency must be an ISO " +
+		"4217 currency code")
+
+	// ErrExchangeRateWithoutFiatAmount is returned when an invoice carries
+	// an exchange rate, but no fiat amount that denominates it.
+	ErrExchangeRateWithoutFiatAmount = fmt.Errorf("exchange rate " +
+		"requires a fiat amount")
+)
+
+// FiatAmount is an amount denominated in a fiat currency. It's stored along
+// with an invoice for informational purposes only, and has no bearing on the
+// amount that's required to settle it.
+type FiatAmount struct {
+	// Currency is the ISO 4217 code of the currency, for example "USD".
+	Currency string
+
+	// Amount is the amount in the minor unit of the currency, for example
+	// cents for USD.
+	Amount uint64
+}
+
+// validateFiatAmount ensures that the currency of the passed fiat amount is a
+// well formed currency code.
+func validateFiatAmount(f *FiatAmount) error {
+	if len(f.Currency) != fiatCurrencyCodeLen {
+		return ErrInvalidFiatCurrency
+	}
+	for _, c := range f.Currency {
+		if c < 'A' || c > 'Z' {
+			return ErrInvalidFiatCurrency
+		}
+	}
+
+	return nil
+}
+
+// encodeFiatAmount serializes the passed fiat amount into the value of its
+// TLV record.
+func encodeFiatAmount(f *FiatAmount) []byte {
+	value := make([]byte, 8+len(f.Currency))
+	byteOrder.PutUint64(value[:8], f.Amount)
+	copy(value[8:], f.Currency)
+
+	return value
+}
+
+// decodeFiatAmount deserializes a fiat amount from the value of its TLV
+// record.
+func decodeFiatAmount(value []byte) (*FiatAmount, error) {
+	if len(value) != 8+fiatCurrencyCodeLen {
+		return nil, fmt.Errorf("invalid fiat amount record of %v "+
+			"bytes", len(value))
+	}
+
+	f := &FiatAmount{
+		Amount:   byteOrder.Uint64(value[:8]),
+		Currency: string(value[8:]),
+	}
+	if err := validateFiatAmount(f); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// encodeExchangeRate serializes the passed exchange rate into the value of
+// its TLV record.
+func encodeExchangeRate(rate uint64) []byte {
+	var value [8]byte
+	byteOrder.PutUint64(value[:], rate)
+
+	return value[:]
+}
+
+// decodeExchangeRate deserializes an exchange rate from the value of its TLV
+// record.
+func decodeExchangeRate(value []byte) (uint64, error) {
+	if len(value) != 8 {
+		return 0, fmt.Errorf("invalid exchange rate record of %v "+
+			"bytes", len(value))
+	}
+
+	return byteOrder.Uint64(value), nil
+}
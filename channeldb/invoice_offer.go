@@ -0,0 +1,166 @@
+package channeldb
+
+import (
+	"fmt"
+
+	"github.com/coreos/bbolt"
+)
+
+const (
+	// offerIDType is the TLV record type of the ID of the offer an invoice
+	// was issued for. Invoices that weren't issued for an offer don't
+	// carry the record.
+	offerIDType uint64 = 5
+
+	// offerIDLen is the length of an offer ID.
+	offerIDLen = 32
+)
+
+var (
+	// offerBucket is the top-level bucket that stores the offers we've
+	// created, keyed by their ID.
+	//
+	// maps: offerID => offer
+	offerBucket = []byte("offers")
+
+	// offerInvoiceIndexBucket is the top-level bucket that indexes
+	// invoices by the offer they were issued for.
+	//
+	// maps: offerID => invoiceNum => nil
+	offerInvoiceIndexBucket = []byte("offer-invoice-index")
+
+	// ErrOfferNotFound is returned when an offer isn't found within the
+	// offer bucket.
+	ErrOfferNotFound = fmt.Errorf("offer not found")
+
+	// ErrDuplicateOffer is returned when adding an offer whose ID is
+	// already taken.
+	ErrDuplicateOffer = fmt.Errorf("offer with id already exists")
+
+	// ErrEmptyOffer is returned when adding an offer without any content.
+	ErrEmptyOffer = fmt.Errorf("offer is empty")
+)
+
+// AddOffer stores the serialized offer under the passed ID. Invoices issued
+// for the offer reference it by that ID.
+func (d *DB) AddOffer(id [32]byte, offer []byte) error {
+	if len(offer) == 0 {
+		return ErrEmptyOffer
+	}
+
+	return d.Update(func(tx *bbolt.Tx) error {
+		offers, err := tx.CreateBucketIfNotExists(offerBucket)
+		if err != nil {
+			return err
+		}
+		if offers.Get(id[:]) != nil {
+			return ErrDuplicateOffer
+		}
+
+		return offers.Put(id[:], offer)
+	})
+}
+
+// FetchOffer returns the serialized offer stored under the passed ID.
+func (d *DB) FetchOffer(id [32]byte) ([]byte, error) {
+	var offer []byte
+	err := d.View(func(tx *bbolt.Tx) error {
+		offers := tx.Bucket(offerBucket)
+		if offers == nil {
+			return ErrOfferNotFound
+		}
+
+		v := offers.Get(id[:])
+		if v == nil {
+			return ErrOfferNotFound
+		}
+		offer = append([]byte(nil), v...)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return offer, nil
+}
+
+// InvoicesForOffer returns all invoices issued for the offer with the passed
+// ID, in the order they were added.
+func (d *DB) InvoicesForOffer(id [32]byte) ([]Invoice, error) {
+	var invoices []Invoice
+	err := d.View(func(tx *bbolt.Tx) error {
+		invoices = nil
+
+		offers := tx.Bucket(offerBucket)
+		if offers == nil || offers.Get(id[:]) == nil {
+			return ErrOfferNotFound
+		}
+
+		index := tx.Bucket(offerInvoiceIndexBucket)
+		if index == nil {
+			return nil
+		}
+		offerInvoices := index.Bucket(id[:])
+		if offerInvoices == nil {
+			return nil
+		}
+		invoiceB := tx.Bucket(invoiceBucket)
+		if invoiceB == nil {
+			return ErrNoInvoicesCreated
+		}
+
+		return offerInvoices.ForEach(func(invoiceNum, _ []byte) error {
+			invoice, err := fetchInvoice(invoiceNum, invoiceB)
+			if err != nil {
+				return err
+			}
+
+			invoices = append(invoices, invoice)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return invoices, nil
+}
+
+// putOfferInvoiceIndex indexes the invoice with the passed number under the
+// offer it was issued for. It's a noop for invoices that weren't issued for
+// an offer, while the offer of those that were must exist.
+func putOfferInvoiceIndex(tx *bbolt.Tx, i *Invoice, invoiceNum []byte) error {
+	if i.OfferID == ([32]byte{}) {
+		return nil
+	}
+
+	offers := tx.Bucket(offerBucket)
+	if offers == nil || offers.Get(i.OfferID[:]) == nil {
+		return ErrOfferNotFound
+	}
+
+	index, err := tx.CreateBucketIfNotExists(offerInvoiceIndexBucket)
+	if err != nil {
+		return err
+	}
+	offerInvoices, err := index.CreateBucketIfNotExists(i.OfferID[:])
+	if err != nil {
+		return err
+	}
+
+	return offerInvoices.Put(invoiceNum, nil)
+}
+
+// decodeOfferID deserializes the ID of the offer an invoice was issued for
+// from the value of its TLV record.
+func decodeOfferID(value []byte) ([32]byte, error) {
+	var id [32]byte
+	if len(value) != offerIDLen {
+		return id, fmt.Errorf("invalid offer id record of %v bytes",
+			len(value))
+	}
+	copy(id[:], value)
+
+	return id, nil
+}
@@ -0,0 +1,110 @@
+package channeldb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestInvoicesForOffer asserts that offers are stored by their ID, and that
+// the invoices issued for an offer are linked back to it.
+func TestInvoicesForOffer(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	offerID := [32]byte{1}
+	otherID := [32]byte{2}
+	offer := []byte("offer")
+
+	if _, err := db.FetchOffer(offerID); err != ErrOfferNotFound {
+		t.Fatalf("expected ErrOfferNotFound, got %v", err)
+	}
+	if err := db.AddOffer(offerID, nil); err != ErrEmptyOffer {
+		t.Fatalf("expected ErrEmptyOffer, got %v", err)
+	}
+	if err := db.AddOffer(offerID, offer); err != nil {
+		t.Fatalf("unable to add offer: %v", err)
+	}
+	if err := db.AddOffer(offerID, offer); err != ErrDuplicateOffer {
+		t.Fatalf("expected ErrDuplicateOffer, got %v", err)
+	}
+	if err := db.AddOffer(otherID, []byte("other")); err != nil {
+		t.Fatalf("unable to add offer: %v", err)
+	}
+
+	stored, err := db.FetchOffer(offerID)
+	if err != nil {
+		t.Fatalf("unable to fetch offer: %v", err)
+	}
+	if !bytes.Equal(stored, offer) {
+		t.Fatalf("expected offer %x, got %x", offer, stored)
+	}
+
+	addInvoice := func(id [32]byte) (*Invoice, error) {
+		t.Helper()
+
+		invoice, err := randInvoice(lnwire.NewMSatFromSatoshis(1000))
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+		invoice.OfferID = id
+
+		_, err = db.AddInvoice(
+			invoice, invoice.Terms.PaymentPreimage.Hash(),
+		)
+		return invoice, err
+	}
+
+	// An invoice can't be issued for an unknown offer.
+	if _, err := addInvoice([32]byte{3}); err != ErrOfferNotFound {
+		t.Fatalf("expected ErrOfferNotFound, got %v", err)
+	}
+
+	var expected []*Invoice
+	for i := 0; i < 3; i++ {
+		invoice, err := addInvoice(offerID)
+		if err != nil {
+			t.Fatalf("unable to add invoice: %v", err)
+		}
+		expected = append(expected, invoice)
+
+		if _, err := addInvoice([32]byte{}); err != nil {
+			t.Fatalf("unable to add invoice: %v", err)
+		}
+	}
+
+	invoices, err := db.InvoicesForOffer(offerID)
+	if err != nil {
+		t.Fatalf("unable to fetch invoices: %v", err)
+	}
+	if len(invoices) != len(expected) {
+		t.Fatalf("expected %v invoices, got %v", len(expected),
+			len(invoices))
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(*expected[i], invoices[i]) {
+			t.Fatalf("invoice mismatch: expected %v, got %v",
+				spew.Sdump(expected[i]),
+				spew.Sdump(invoices[i]))
+		}
+	}
+
+	invoices, err = db.InvoicesForOffer(otherID)
+	if err != nil {
+		t.Fatalf("unable to fetch invoices: %v", err)
+	}
+	if len(invoices) != 0 {
+		t.Fatalf("expected no invoices, got %v", len(invoices))
+	}
+	if _, err := db.InvoicesForOffer([32]byte{3}); err != ErrOfferNotFound {
+		t.Fatalf("expected ErrOfferNotFound, got %v", err)
+	}
+}
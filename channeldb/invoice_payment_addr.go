@@ -0,0 +1,197 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/coreos/bbolt"
+)
+
+const (
+	// paymentAddrType is the TLV record type of the payment address of an
+	// invoice. Invoices without a payment address don't carry the record.
+	paymentAddrType uint64 = 6
+
+	// paymentAddrLen is the length of a payment address.
+	paymentAddrLen = 32
+)
+
+var (
+	// paymentAddrIndexBucket is the top-level bucket that indexes invoices
+	// by their payment address. Invoices without a payment address aren't
+	// indexed.
+	//
+	// maps: paymentAddr => invoiceNum
+	paymentAddrIndexBucket = []byte("invoice-payment-addr-index")
+
+	// ErrDuplicatePaymentAddr is returned when adding an invoice whose
+	// payment address is already taken by another invoice.
+	ErrDuplicatePaymentAddr = fmt.Errorf("invoice with payment address " +
+		"already exists")
+)
+
+// InvoiceByPaymentAddr returns the invoice with the passed payment address. If
+// no such invoice exists, ErrInvoiceNotFound is returned.
+func (d *DB) InvoiceByPaymentAddr(addr [32]byte) (*Invoice, error) {
+	if addr == ([32]byte{}) {
+		return nil, ErrInvoiceNotFound
+	}
+
+	var invoice *Invoice
+	err := d.View(func(tx *bbolt.Tx) error {
+		invoices := tx.Bucket(invoiceBucket)
+		if invoices == nil {
+			return ErrNoInvoicesCreated
+		}
+
+		index := tx.Bucket(paymentAddrIndexBucket)
+		if index == nil {
+			return ErrInvoiceNotFound
+		}
+		invoiceNum := index.Get(addr[:])
+		if invoiceNum == nil {
+			return ErrInvoiceNotFound
+		}
+
+		i, err := fetchInvoice(invoiceNum, invoices)
+		if err != nil {
+			return err
+		}
+		invoice = &i
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return invoice, nil
+}
+
+// CheckPaymentAddrCollisions audits the payment addresses of all invoices, and
+// returns the addresses that are involved with more than one invoice, sorted
+// in ascending order. An address is involved with each invoice that carries
+// it, along with the invoice the payment address index maps it to, such that
+// an index entry pointing to an invoice other than the one carrying its
+// address is reported as well. The keys of the invoices involved with each
+// collision are logged.
+func (d *DB) CheckPaymentAddrCollisions() ([][32]byte, error) {
+	var collisions [][32]byte
+	err := d.View(func(tx *bbolt.Tx) error {
+		collisions = nil
+
+		invoices := tx.Bucket(invoiceBucket)
+		if invoices == nil {
+			return nil
+		}
+
+		// involved maps each payment address to the set of invoice
+		// keys it's involved with.
+		involved := make(map[[32]byte]map[string]struct{})
+		addInvolved := func(addr [32]byte, invoiceNum []byte) {
+			if involved[addr] == nil {
+				involved[addr] = make(map[string]struct{})
+			}
+			involved[addr][string(invoiceNum)] = struct{}{}
+		}
+
+		err := invoices.ForEach(func(k, v []byte) error {
+			if v == nil {
+				return nil
+			}
+
+			invoice, err := deserializeInvoice(bytes.NewReader(v))
+			if err != nil {
+				return fmt.Errorf("unable to decode invoice "+
+					"%x: %v", k, err)
+			}
+			if invoice.PaymentAddr != ([32]byte{}) {
+				addInvolved(invoice.PaymentAddr, k)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		index := tx.Bucket(paymentAddrIndexBucket)
+		if index != nil {
+			err := index.ForEach(func(k, v []byte) error {
+				if len(k) != paymentAddrLen {
+					return fmt.Errorf("invalid payment "+
+						"address index key %x", k)
+				}
+
+				var addr [32]byte
+				copy(addr[:], k)
+				addInvolved(addr, v)
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		for addr, invoiceNums := range involved {
+			if len(invoiceNums) < 2 {
+				continue
+			}
+			collisions = append(collisions, addr)
+
+			keys := make([]string, 0, len(invoiceNums))
+			for invoiceNum := range invoiceNums {
+				keys = append(keys, fmt.Sprintf("%x",
+					invoiceNum))
+			}
+			sort.Strings(keys)
+			log.Warnf("Payment address %x is involved with "+
+				"invoices %v", addr, keys)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(collisions, func(i, j int) bool {
+		return bytes.Compare(collisions[i][:], collisions[j][:]) < 0
+	})
+
+	return collisions, nil
+}
+
+// putPaymentAddrIndex indexes the invoice with the passed number under its
+// payment address. It's a noop for invoices without a payment address, while
+// the address of those with one must not be taken yet.
+func putPaymentAddrIndex(tx *bbolt.Tx, i *Invoice, invoiceNum []byte) error {
+	if i.PaymentAddr == ([32]byte{}) {
+		return nil
+	}
+
+	index, err := tx.CreateBucketIfNotExists(paymentAddrIndexBucket)
+	if err != nil {
+		return err
+	}
+	if index.Get(i.PaymentAddr[:]) != nil {
+		return ErrDuplicatePaymentAddr
+	}
+
+	return index.Put(i.PaymentAddr[:], invoiceNum)
+}
+
+// decodePaymentAddr deserializes the payment address of an invoice from the
+// value of its TLV record.
+func decodePaymentAddr(value []byte) ([32]byte, error) {
+	var addr [32]byte
+	if len(value) != paymentAddrLen {
+		return addr, fmt.Errorf("invalid payment address record of %v "+
+			"bytes", len(value))
+	}
+	copy(addr[:], value)
+
+	return addr, nil
+}
@@ -0,0 +1,159 @@
+package channeldb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/bbolt"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestInvoiceByPaymentAddr asserts that invoices can be looked up by their
+// payment address, and that no two invoices may share one.
+func TestInvoiceByPaymentAddr(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	addr := [32]byte{1}
+	_, err = db.InvoiceByPaymentAddr(addr)
+	if err != ErrNoInvoicesCreated {
+		t.Fatalf("expected ErrNoInvoicesCreated, got %v", err)
+	}
+
+	addInvoice := func(addr [32]byte) (*Invoice, error) {
+		t.Helper()
+
+		invoice, err := randInvoice(lnwire.NewMSatFromSatoshis(1000))
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+		invoice.PaymentAddr = addr
+
+		_, err = db.AddInvoice(
+			invoice, invoice.Terms.PaymentPreimage.Hash(),
+		)
+		return invoice, err
+	}
+
+	invoice, err := addInvoice(addr)
+	if err != nil {
+		t.Fatalf("unable to add invoice: %v", err)
+	}
+
+	// Invoices without a payment address aren't indexed, so any number of
+	// them can be added.
+	for i := 0; i < 2; i++ {
+		if _, err := addInvoice([32]byte{}); err != nil {
+			t.Fatalf("unable to add invoice: %v", err)
+		}
+	}
+	if _, err := addInvoice(addr); err != ErrDuplicatePaymentAddr {
+		t.Fatalf("expected ErrDuplicatePaymentAddr, got %v", err)
+	}
+
+	dbInvoice, err := db.InvoiceByPaymentAddr(addr)
+	if err != nil {
+		t.Fatalf("unable to fetch invoice: %v", err)
+	}
+	if !reflect.DeepEqual(invoice, dbInvoice) {
+		t.Fatalf("invoice mismatch: expected %v, got %v",
+			spew.Sdump(invoice), spew.Sdump(dbInvoice))
+	}
+
+	// The payment address is retained along with the rest of the invoice.
+	byHash, err := db.LookupInvoice(invoice.Terms.PaymentPreimage.Hash())
+	if err != nil {
+		t.Fatalf("unable to lookup invoice: %v", err)
+	}
+	if byHash.PaymentAddr != addr {
+		t.Fatalf("expected payment address %x, got %x", addr,
+			byHash.PaymentAddr)
+	}
+
+	_, err = db.InvoiceByPaymentAddr([32]byte{2})
+	if err != ErrInvoiceNotFound {
+		t.Fatalf("expected ErrInvoiceNotFound, got %v", err)
+	}
+	_, err = db.InvoiceByPaymentAddr([32]byte{})
+	if err != ErrInvoiceNotFound {
+		t.Fatalf("expected ErrInvoiceNotFound, got %v", err)
+	}
+}
+
+// TestCheckPaymentAddrCollisions asserts that payment addresses carried by
+// multiple invoices, or indexed under an invoice that doesn't carry them, are
+// reported as collisions.
+func TestCheckPaymentAddrCollisions(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	assertCollisions := func(expected [][32]byte) {
+		t.Helper()
+
+		collisions, err := db.CheckPaymentAddrCollisions()
+		if err != nil {
+			t.Fatalf("unable to check collisions: %v", err)
+		}
+		if !reflect.DeepEqual(collisions, expected) {
+			t.Fatalf("expected collisions %x, got %x", expected,
+				collisions)
+		}
+	}
+
+	assertCollisions(nil)
+
+	addrA, addrB := [32]byte{1}, [32]byte{2}
+	var invoices []*Invoice
+	for _, addr := range [][32]byte{addrA, addrB, {}} {
+		invoice, err := randInvoice(lnwire.NewMSatFromSatoshis(1000))
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+		invoice.PaymentAddr = addr
+
+		_, err = db.AddInvoice(
+			invoice, invoice.Terms.PaymentPreimage.Hash(),
+		)
+		if err != nil {
+			t.Fatalf("unable to add invoice: %v", err)
+		}
+		invoices = append(invoices, invoice)
+	}
+
+	assertCollisions(nil)
+
+	// We'll simulate a bug by having the last invoice carry the address of
+	// the first one without indexing it, and by pointing the index entry
+	// of the second one at the last invoice.
+	var lastKey [4]byte
+	byteOrder.PutUint32(lastKey[:], uint32(len(invoices)-1))
+	err = db.Update(func(tx *bbolt.Tx) error {
+		last := invoices[len(invoices)-1]
+		last.PaymentAddr = addrA
+		err := putInvoiceRecord(
+			tx.Bucket(invoiceBucket), lastKey[:], last,
+		)
+		if err != nil {
+			return err
+		}
+
+		index := tx.Bucket(paymentAddrIndexBucket)
+		return index.Put(addrB[:], lastKey[:])
+	})
+	if err != nil {
+		t.Fatalf("unable to corrupt invoices: %v", err)
+	}
+
+	assertCollisions([][32]byte{addrA, addrB})
+}
@@ -0,0 +1,419 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/lightningnetwork/lnd/zpay32"
+)
+
+const (
+	// paymentRequestFieldsType is the TLV record type of the payment
+	// request fields of an invoice. The record holds the name of the
+	// network, the expiry in seconds, the min final CLTV delta, a byte of
+	// flags marking which of the two were omitted from the request and the
+	// compressed public key of the payee, followed by the fallback address
+	// and the description hash, each prefixed by its length.
+	paymentRequestFieldsType uint64 = 7
+
+	// expiryOmittedFlag and minFinalCLTVExpiryOmittedFlag are the flags of
+	// the payment request fields record marking that the expiry and the
+	// min final CLTV delta were omitted from the request.
+	expiryOmittedFlag             = 0x01
+	minFinalCLTVExpiryOmittedFlag = 0x02
+
+	// maxNetNameLen is the max length of the network name held by the
+	// payment request fields of an invoice.
+	maxNetNameLen = 32
+
+	// maxFallbackAddrLen is the max length of the encoded fallback address
+	// held by the payment request fields of an invoice.
+	maxFallbackAddrLen = 128
+)
+
+var (
+	// paymentRequestNets are the networks the payment request of an
+	// invoice may have been issued for.
+	paymentRequestNets = []*chaincfg.Params{
+		&chaincfg.MainNetParams,
+		&chaincfg.TestNet3Params,
+		&chaincfg.RegressionNetParams,
+		&chaincfg.SimNetParams,
+	}
+
+	// ErrPaymentRequestFieldsNotStored is returned when reconstructing the
+	// payment request of an invoice that wasn't stored along with the
+	// network, expiry, min final CLTV delta and payee of its request.
+	ErrPaymentRequestFieldsNotStored = fmt.Errorf("invoice has no " +
+		"stored network, expiry, final cltv delta and payee of its " +
+		"payment request")
+
+	// ErrUnknownPaymentRequestNet is returned when the payment request
+	// fields of an invoice lack a network, or name one that payment
+	// requests can't be issued for.
+	ErrUnknownPaymentRequestNet = fmt.Errorf("unknown payment request " +
+		"network")
+
+	// ErrInvalidPaymentRequestExpiry is returned when the payment request
+	// fields of an invoice hold an expiry that isn't a positive number of
+	// seconds.
+	ErrInvalidPaymentRequestExpiry = fmt.Errorf("payment request expiry " +
+		"must be a positive number of seconds")
+
+	// ErrMissingFinalCLTVDelta is returned when the payment request fields
+	// of an invoice lack the min final CLTV delta.
+	ErrMissingFinalCLTVDelta = fmt.Errorf("payment request must have a " +
+		"final cltv delta")
+
+	// ErrMissingPaymentRequestPayee is returned when the payment request
+	// fields of an invoice lack the public key of the payee.
+	ErrMissingPaymentRequestPayee = fmt.Errorf("payment request must " +
+		"have a payee")
+
+	// ErrInvalidFallbackAddr is returned when the fallback address of the
+	// payment request fields of an invoice isn't for their network, or
+	// exceeds maxFallbackAddrLen once encoded.
+	ErrInvalidFallbackAddr = fmt.Errorf("fallback address isn't for " +
+		"the payment request network")
+
+	// ErrPaymentAddrNotEncodable is returned when reconstructing the
+	// payment request of an invoice with a payment address, which the
+	// payment request encoding doesn't support.
+	ErrPaymentAddrNotEncodable = fmt.Errorf("payment address can't be " +
+		"encoded within a payment request")
+
+	// ErrPaymentRequestMismatch is returned when the reconstructed payment
+	// request of an invoice isn't signed by the payee of the original one.
+	ErrPaymentRequestMismatch = fmt.Errorf("payment request doesn't " +
+		"match invoice")
+)
+
+// PaymentRequestFields are the fields of the payment request of an invoice
+// that the invoice itself doesn't hold. They're retained such that the
+// payment request can be reconstructed.
+type PaymentRequestFields struct {
+	// Net is the network the payment request was issued for.
+	Net *chaincfg.Params
+
+	// Expiry is the time after the creation date of the invoice that its
+	// payment request expires. It must be a whole number of seconds, as
+	// that's the precision of the encoding.
+	Expiry time.Duration
+
+	// MinFinalCLTVExpiry is the min CLTV delta of the final hop of a
+	// route paying the request.
+	MinFinalCLTVExpiry uint64
+
+	// ExpiryOmitted and MinFinalCLTVExpiryOmitted are true if the expiry
+	// or the min final CLTV delta were omitted from the request, in which
+	// case Expiry and MinFinalCLTVExpiry hold the defaults implied by
+	// their absence. Omitted fields are also omitted from a reconstructed
+	// request, such that it encodes the same fields as the original one.
+	ExpiryOmitted             bool
+	MinFinalCLTVExpiryOmitted bool
+
+	// Destination is the public key of the node that issued the request.
+	Destination *btcec.PublicKey
+
+	// FallbackAddr is the optional on-chain address the request may be
+	// paid to instead.
+	FallbackAddr btcutil.Address
+
+	// DescriptionHash is the optional hash of the description of the
+	// request, which is then included in place of the memo of the
+	// invoice.
+	DescriptionHash *[32]byte
+}
+
+// NewPaymentRequestFields returns the fields the passed payment request holds
+// beyond those of its invoice. The request must have been decoded, such that
+// its destination is known.
+func NewPaymentRequestFields(request *zpay32.Invoice) *PaymentRequestFields {
+	return &PaymentRequestFields{
+		Net:                request.Net,
+		Expiry:             request.Expiry(),
+		MinFinalCLTVExpiry: request.MinFinalCLTVExpiry(),
+
+		ExpiryOmitted:             !request.HasExpiry(),
+		MinFinalCLTVExpiryOmitted: !request.HasMinFinalCLTVExpiry(),
+
+		Destination:     request.Destination,
+		FallbackAddr:    request.FallbackAddr,
+		DescriptionHash: request.DescriptionHash,
+	}
+}
+
+// validatePaymentRequestFields ensures that the passed payment request fields
+// hold all required fields, for a network payment requests can be issued
+// for.
+func validatePaymentRequestFields(f *PaymentRequestFields) error {
+	if f.Net == nil || paymentRequestNet(f.Net.Name) != f.Net {
+		return ErrUnknownPaymentRequestNet
+	}
+	if f.Expiry < time.Second || f.Expiry%time.Second != 0 {
+		return ErrInvalidPaymentRequestExpiry
+	}
+	if f.MinFinalCLTVExpiry == 0 {
+		return ErrMissingFinalCLTVDelta
+	}
+	if f.Destination == nil {
+		return ErrMissingPaymentRequestPayee
+	}
+	if f.FallbackAddr != nil {
+		addrLen := len(f.FallbackAddr.EncodeAddress())
+		if !f.FallbackAddr.IsForNet(f.Net) ||
+			addrLen > maxFallbackAddrLen {
+
+			return ErrInvalidFallbackAddr
+		}
+	}
+
+	return nil
+}
+
+// paymentRequestNet returns the network payment requests can be issued for
+// with the passed name, or nil if there's none.
+func paymentRequestNet(name string) *chaincfg.Params {
+	for _, net := range paymentRequestNets {
+		if net.Name == name {
+			return net
+		}
+	}
+
+	return nil
+}
+
+// encodePaymentRequestFields serializes the passed payment request fields
+// into the value of their TLV record.
+func encodePaymentRequestFields(f *PaymentRequestFields) ([]byte, error) {
+	var b bytes.Buffer
+	if err := wire.WriteVarString(&b, 0, f.Net.Name); err != nil {
+		return nil, err
+	}
+
+	var scratch [17]byte
+	byteOrder.PutUint64(scratch[:8], uint64(f.Expiry/time.Second))
+	byteOrder.PutUint64(scratch[8:16], f.MinFinalCLTVExpiry)
+	if f.ExpiryOmitted {
+		scratch[16] |= expiryOmittedFlag
+	}
+	if f.MinFinalCLTVExpiryOmitted {
+		scratch[16] |= minFinalCLTVExpiryOmittedFlag
+	}
+	if _, err := b.Write(scratch[:]); err != nil {
+		return nil, err
+	}
+	if _, err := b.Write(f.Destination.SerializeCompressed()); err != nil {
+		return nil, err
+	}
+
+	var fallbackAddr string
+	if f.FallbackAddr != nil {
+		fallbackAddr = f.FallbackAddr.EncodeAddress()
+	}
+	if err := wire.WriteVarString(&b, 0, fallbackAddr); err != nil {
+		return nil, err
+	}
+
+	var descHash []byte
+	if f.DescriptionHash != nil {
+		descHash = f.DescriptionHash[:]
+	}
+	if err := wire.WriteVarBytes(&b, 0, descHash); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// decodePaymentRequestFields deserializes the payment request fields of an
+// invoice from the value of their TLV record.
+func decodePaymentRequestFields(value []byte) (*PaymentRequestFields,
+	error) {
+
+	r := bytes.NewReader(value)
+	netName, err := wire.ReadVarBytes(r, 0, maxNetNameLen, "net")
+	if err != nil {
+		return nil, err
+	}
+
+	f := &PaymentRequestFields{
+		Net: paymentRequestNet(string(netName)),
+	}
+	if f.Net == nil {
+		return nil, ErrUnknownPaymentRequestNet
+	}
+
+	var scratch [17]byte
+	if _, err := io.ReadFull(r, scratch[:]); err != nil {
+		return nil, err
+	}
+	expiry := byteOrder.Uint64(scratch[:8])
+	if expiry > math.MaxInt64/uint64(time.Second) {
+		return nil, ErrInvalidPaymentRequestExpiry
+	}
+	f.Expiry = time.Duration(expiry) * time.Second
+	f.MinFinalCLTVExpiry = byteOrder.Uint64(scratch[8:16])
+
+	flags := scratch[16]
+	if flags&^(expiryOmittedFlag|minFinalCLTVExpiryOmittedFlag) != 0 {
+		return nil, fmt.Errorf("unknown payment request fields "+
+			"flags %x", flags)
+	}
+	f.ExpiryOmitted = flags&expiryOmittedFlag != 0
+	f.MinFinalCLTVExpiryOmitted = flags&minFinalCLTVExpiryOmittedFlag != 0
+
+	var destination [33]byte
+	if _, err := io.ReadFull(r, destination[:]); err != nil {
+		return nil, err
+	}
+	f.Destination, err = btcec.ParsePubKey(destination[:], btcec.S256())
+	if err != nil {
+		return nil, err
+	}
+
+	fallbackAddr, err := wire.ReadVarBytes(
+		r, 0, maxFallbackAddrLen, "fallback",
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(fallbackAddr) != 0 {
+		f.FallbackAddr, err = btcutil.DecodeAddress(
+			string(fallbackAddr), f.Net,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	descHash, err := wire.ReadVarBytes(r, 0, 32, "description hash")
+	if err != nil {
+		return nil, err
+	}
+	switch len(descHash) {
+	case 0:
+	case 32:
+		f.DescriptionHash = &[32]byte{}
+		copy(f.DescriptionHash[:], descHash)
+	default:
+		return nil, fmt.Errorf("invalid description hash of %v bytes",
+			len(descHash))
+	}
+
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%v trailing bytes within payment "+
+			"request fields record", r.Len())
+	}
+	if err := validatePaymentRequestFields(f); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// ReconstructPaymentRequest rebuilds the BOLT-0011 payment request of the
+// invoice with the passed payment hash from its stored fields, and signs it
+// with the signer, which must sign with the key of the node that issued the
+// invoice. The signer is passed the hash to sign, and must return a compact
+// signature as returned by btcec.SignCompact.
+//
+// The amount, memo, creation date and routing hints of the request are taken
+// from the invoice, and the rest from its PaymentRequestFields. The expiry and
+// min final CLTV delta are only encoded if the original request held them. If
+// the invoice was stored without those fields,
+// ErrPaymentRequestFieldsNotStored is returned. The payment request stored
+// along with the invoice isn't consulted. Invoices with a payment address
+// can't be reconstructed, as the encoding lacks a field to carry it. The
+// reconstructed request is decoded before it's returned, to ensure it's valid
+// and signed by the payee of the original one.
+func (d *DB) ReconstructPaymentRequest(hash [32]byte,
+	signer func([]byte) ([]byte, error)) (string, error) {
+
+	invoice, err := d.LookupInvoice(hash)
+	if err != nil {
+		return "", err
+	}
+	if invoice.PaymentAddr != ([32]byte{}) {
+		return "", ErrPaymentAddrNotEncodable
+	}
+	fields := invoice.PaymentRequestFields
+	if fields == nil {
+		return "", ErrPaymentRequestFieldsNotStored
+	}
+
+	var options []func(*zpay32.Invoice)
+	if !fields.ExpiryOmitted {
+		options = append(options, zpay32.Expiry(fields.Expiry))
+	}
+	if !fields.MinFinalCLTVExpiryOmitted {
+		options = append(
+			options, zpay32.CLTVExpiry(fields.MinFinalCLTVExpiry),
+		)
+	}
+	if invoice.Terms.Value != 0 {
+		options = append(options, zpay32.Amount(invoice.Terms.Value))
+	}
+	if fields.DescriptionHash != nil {
+		descHash := *fields.DescriptionHash
+		options = append(options, zpay32.DescriptionHash(descHash))
+	} else {
+		options = append(
+			options, zpay32.Description(string(invoice.Memo)),
+		)
+	}
+	if fields.FallbackAddr != nil {
+		options = append(
+			options, zpay32.FallbackAddr(fields.FallbackAddr),
+		)
+	}
+	for _, routeHint := range invoice.RouteHints {
+		options = append(options, zpay32.RouteHint(routeHint))
+	}
+
+	request, err := zpay32.NewInvoice(
+		fields.Net, hash, invoice.CreationDate, options...,
+	)
+	if err != nil {
+		return "", err
+	}
+	encoded, err := request.Encode(zpay32.MessageSigner{
+		SignCompact: signer,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	decoded, err := zpay32.Decode(encoded, fields.Net)
+	if err != nil {
+		return "", err
+	}
+	if !decoded.Destination.IsEqual(fields.Destination) {
+		return "", ErrPaymentRequestMismatch
+	}
+
+	return encoded, nil
+}
+
+// decodeStoredPaymentRequest decodes the payment request stored along with an
+// invoice, for whichever network it was issued for.
+func decodeStoredPaymentRequest(request string) (*zpay32.Invoice, error) {
+	var err error
+	for _, net := range paymentRequestNets {
+		var decoded *zpay32.Invoice
+		decoded, err = zpay32.Decode(request, net)
+		if err == nil {
+			return decoded, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unable to decode stored payment request: %v",
+		err)
+}
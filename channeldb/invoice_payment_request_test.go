@@ -0,0 +1,341 @@
+package channeldb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/lightningnetwork/lnd/zpay32"
+)
+
+// TestReconstructPaymentRequest asserts that the payment request of a stored
+// invoice is rebuilt from its stored fields into a valid request, and that
+// invoices whose request can't be reconstructed are rejected.
+func TestReconstructPaymentRequest(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	newSigner := func() (*btcec.PrivateKey,
+		func([]byte) ([]byte, error)) {
+
+		t.Helper()
+
+		privKey, err := btcec.NewPrivateKey(btcec.S256())
+		if err != nil {
+			t.Fatalf("unable to create private key: %v", err)
+		}
+		signer := func(hash []byte) ([]byte, error) {
+			return btcec.SignCompact(
+				btcec.S256(), privKey, hash, true,
+			)
+		}
+
+		return privKey, signer
+	}
+	privKey, signer := newSigner()
+
+	routeHint := []zpay32.HopHint{{
+		NodeID:                    privKey.PubKey(),
+		ChannelID:                 12345,
+		FeeBaseMSat:               1000,
+		FeeProportionalMillionths: 10,
+		CLTVExpiryDelta:           40,
+	}}
+
+	fallbackAddr, err := btcutil.NewAddressPubKeyHash(
+		make([]byte, 20), &chaincfg.SimNetParams,
+	)
+	if err != nil {
+		t.Fatalf("unable to create fallback address: %v", err)
+	}
+
+	// Unless stated otherwise, the requests of the invoices are issued
+	// with an explicit expiry and final cltv delta.
+	tagged := []func(*zpay32.Invoice){
+		zpay32.Expiry(time.Hour * 2),
+		zpay32.CLTVExpiry(80),
+	}
+	addInvoice := func(withFields bool, addr [32]byte,
+		options ...func(*zpay32.Invoice)) (*Invoice, [32]byte) {
+
+		t.Helper()
+
+		invoice, err := randInvoice(lnwire.NewMSatFromSatoshis(1000))
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+		invoice.PaymentAddr = addr
+		invoice.RouteHints = [][]zpay32.HopHint{routeHint}
+		hash := invoice.Terms.PaymentPreimage.Hash()
+
+		// The original request is stored either way, as it must not
+		// be consulted when reconstructing the request. It's issued
+		// with the passed options, along with the invoice's fields.
+		options = append(
+			options, zpay32.Amount(invoice.Terms.Value),
+			zpay32.Description(string(invoice.Memo)),
+			zpay32.FallbackAddr(fallbackAddr),
+			zpay32.RouteHint(routeHint),
+		)
+		request, err := zpay32.NewInvoice(
+			&chaincfg.SimNetParams, hash, invoice.CreationDate,
+			options...,
+		)
+		if err != nil {
+			t.Fatalf("unable to create request: %v", err)
+		}
+		encoded, err := request.Encode(zpay32.MessageSigner{
+			SignCompact: signer,
+		})
+		if err != nil {
+			t.Fatalf("unable to encode request: %v", err)
+		}
+		invoice.PaymentRequest = []byte(encoded)
+		if withFields {
+			decoded, err := zpay32.Decode(
+				encoded, &chaincfg.SimNetParams,
+			)
+			if err != nil {
+				t.Fatalf("unable to decode request: %v", err)
+			}
+			invoice.PaymentRequestFields = NewPaymentRequestFields(
+				decoded,
+			)
+		}
+
+		if _, err := db.AddInvoice(invoice, hash); err != nil {
+			t.Fatalf("unable to add invoice: %v", err)
+		}
+
+		return invoice, hash
+	}
+
+	invoice, hash := addInvoice(true, [32]byte{}, tagged...)
+	reconstructed, err := db.ReconstructPaymentRequest(hash, signer)
+	if err != nil {
+		t.Fatalf("unable to reconstruct payment request: %v", err)
+	}
+
+	decoded, err := zpay32.Decode(reconstructed, &chaincfg.SimNetParams)
+	if err != nil {
+		t.Fatalf("unable to decode reconstructed request: %v", err)
+	}
+	switch {
+	case *decoded.PaymentHash != hash:
+		t.Fatalf("expected payment hash %x, got %x", hash,
+			*decoded.PaymentHash)
+	case *decoded.MilliSat != invoice.Terms.Value:
+		t.Fatalf("expected amount %v, got %v", invoice.Terms.Value,
+			*decoded.MilliSat)
+	case *decoded.Description != string(invoice.Memo):
+		t.Fatalf("expected description %v, got %v",
+			string(invoice.Memo), *decoded.Description)
+	case !decoded.Timestamp.Equal(invoice.CreationDate):
+		t.Fatalf("expected timestamp %v, got %v",
+			invoice.CreationDate, decoded.Timestamp)
+	case decoded.Expiry() != time.Hour*2:
+		t.Fatalf("expected expiry %v, got %v", time.Hour*2,
+			decoded.Expiry())
+	case decoded.MinFinalCLTVExpiry() != 80:
+		t.Fatalf("expected final cltv delta 80, got %v",
+			decoded.MinFinalCLTVExpiry())
+	case len(decoded.RouteHints) != 1 ||
+		len(decoded.RouteHints[0]) != 1 ||
+		decoded.RouteHints[0][0].ChannelID != routeHint[0].ChannelID:
+
+		t.Fatalf("expected route hints %v, got %v", routeHint,
+			decoded.RouteHints)
+	case decoded.FallbackAddr == nil ||
+		decoded.FallbackAddr.String() != fallbackAddr.String():
+
+		t.Fatalf("expected fallback address %v, got %v",
+			fallbackAddr, decoded.FallbackAddr)
+	case !decoded.Destination.IsEqual(privKey.PubKey()):
+		t.Fatalf("expected destination %x, got %x",
+			privKey.PubKey().SerializeCompressed(),
+			decoded.Destination.SerializeCompressed())
+	}
+
+	// The stored fields must survive a round trip through the database.
+	dbInvoice, err := db.LookupInvoice(hash)
+	if err != nil {
+		t.Fatalf("unable to lookup invoice: %v", err)
+	}
+	if !reflect.DeepEqual(invoice.PaymentRequestFields,
+		dbInvoice.PaymentRequestFields) {
+
+		t.Fatalf("expected payment request fields %v, got %v",
+			spew.Sdump(invoice.PaymentRequestFields),
+			spew.Sdump(dbInvoice.PaymentRequestFields))
+	}
+
+	// A request that omits its expiry and final cltv delta, relying on
+	// their defaults, should be reconstructed without them as well. As
+	// the signature is deterministic, the reconstructed request is then
+	// identical to the original one.
+	invoice, hash = addInvoice(true, [32]byte{})
+	fields := invoice.PaymentRequestFields
+	if !fields.ExpiryOmitted || !fields.MinFinalCLTVExpiryOmitted {
+		t.Fatalf("expected omitted expiry and final cltv delta, got "+
+			"%v", spew.Sdump(fields))
+	}
+	dbInvoice, err = db.LookupInvoice(hash)
+	if err != nil {
+		t.Fatalf("unable to lookup invoice: %v", err)
+	}
+	if !reflect.DeepEqual(fields, dbInvoice.PaymentRequestFields) {
+		t.Fatalf("expected payment request fields %v, got %v",
+			spew.Sdump(fields),
+			spew.Sdump(dbInvoice.PaymentRequestFields))
+	}
+
+	reconstructed, err = db.ReconstructPaymentRequest(hash, signer)
+	if err != nil {
+		t.Fatalf("unable to reconstruct payment request: %v", err)
+	}
+	if reconstructed != string(invoice.PaymentRequest) {
+		t.Fatalf("expected payment request %v, got %v",
+			string(invoice.PaymentRequest), reconstructed)
+	}
+	decoded, err = zpay32.Decode(reconstructed, &chaincfg.SimNetParams)
+	if err != nil {
+		t.Fatalf("unable to decode reconstructed request: %v", err)
+	}
+	if decoded.HasExpiry() || decoded.HasMinFinalCLTVExpiry() {
+		t.Fatalf("expected request without expiry and final cltv " +
+			"delta")
+	}
+
+	// The request must be signed by the node that issued the original
+	// one.
+	_, otherSigner := newSigner()
+	_, err = db.ReconstructPaymentRequest(hash, otherSigner)
+	if err != ErrPaymentRequestMismatch {
+		t.Fatalf("expected ErrPaymentRequestMismatch, got %v", err)
+	}
+
+	// Invoices without stored payment request fields, or with a payment
+	// address, can't be reconstructed.
+	_, hash = addInvoice(false, [32]byte{}, tagged...)
+	_, err = db.ReconstructPaymentRequest(hash, signer)
+	if err != ErrPaymentRequestFieldsNotStored {
+		t.Fatalf("expected ErrPaymentRequestFieldsNotStored, got %v",
+			err)
+	}
+
+	_, hash = addInvoice(true, [32]byte{1}, tagged...)
+	_, err = db.ReconstructPaymentRequest(hash, signer)
+	if err != ErrPaymentAddrNotEncodable {
+		t.Fatalf("expected ErrPaymentAddrNotEncodable, got %v", err)
+	}
+
+	_, err = db.ReconstructPaymentRequest([32]byte{1}, signer)
+	if err != ErrInvoiceNotFound {
+		t.Fatalf("expected ErrInvoiceNotFound, got %v", err)
+	}
+}
+
+// TestPaymentRequestFieldsValidation asserts that invoices whose payment
+// request fields lack a required field, or hold an invalid one, are rejected.
+func TestPaymentRequestFieldsValidation(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	privKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to create private key: %v", err)
+	}
+	fallbackAddr, err := btcutil.NewAddressPubKeyHash(
+		make([]byte, 20), &chaincfg.MainNetParams,
+	)
+	if err != nil {
+		t.Fatalf("unable to create fallback address: %v", err)
+	}
+	otherNet := chaincfg.SimNetParams
+
+	tests := []struct {
+		name   string
+		modify func(*PaymentRequestFields)
+		err    error
+	}{
+		{
+			name:   "no network",
+			modify: func(f *PaymentRequestFields) { f.Net = nil },
+			err:    ErrUnknownPaymentRequestNet,
+		},
+		{
+			name: "unknown network",
+			modify: func(f *PaymentRequestFields) {
+				f.Net = &otherNet
+			},
+			err: ErrUnknownPaymentRequestNet,
+		},
+		{
+			name:   "no expiry",
+			modify: func(f *PaymentRequestFields) { f.Expiry = 0 },
+			err:    ErrInvalidPaymentRequestExpiry,
+		},
+		{
+			name: "fractional expiry",
+			modify: func(f *PaymentRequestFields) {
+				f.Expiry = time.Second + time.Millisecond
+			},
+			err: ErrInvalidPaymentRequestExpiry,
+		},
+		{
+			name: "no final cltv delta",
+			modify: func(f *PaymentRequestFields) {
+				f.MinFinalCLTVExpiry = 0
+			},
+			err: ErrMissingFinalCLTVDelta,
+		},
+		{
+			name: "no payee",
+			modify: func(f *PaymentRequestFields) {
+				f.Destination = nil
+			},
+			err: ErrMissingPaymentRequestPayee,
+		},
+		{
+			name: "fallback address for another network",
+			modify: func(f *PaymentRequestFields) {
+				f.FallbackAddr = fallbackAddr
+			},
+			err: ErrInvalidFallbackAddr,
+		},
+	}
+	for _, test := range tests {
+		invoice, err := randInvoice(lnwire.NewMSatFromSatoshis(1000))
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+		invoice.PaymentRequestFields = &PaymentRequestFields{
+			Net:                &chaincfg.SimNetParams,
+			Expiry:             time.Hour,
+			MinFinalCLTVExpiry: 40,
+			Destination:        privKey.PubKey(),
+		}
+		test.modify(invoice.PaymentRequestFields)
+
+		hash := invoice.Terms.PaymentPreimage.Hash()
+		if _, err := db.AddInvoice(invoice, hash); err != test.err {
+			t.Fatalf("%v: expected %v, got %v", test.name,
+				test.err, err)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lntypes"
+)
+
+const (
+	// preimageRefType is the TLV record type of the payment hash an
+	// invoice references its preimage by, once the preimage has been
+	// moved to the preimage bucket.
+	preimageRefType uint64 = 2
+)
+
+var (
+	// preimageBucket is the top-level bucket that stores the preimages of
+	// settled invoices. Their records no longer carry the preimage inline,
+	// but reference it by their payment hash instead.
+	//
+	// maps: payHash => preimage
+	preimageBucket = []byte("invoice-preimages")
+
+	// ErrInvoicePreimageNotFound is returned when the preimage referenced
+	// by an invoice isn't found within the preimage bucket.
+	ErrInvoicePreimageNotFound = fmt.Errorf("invoice preimage not found")
+)
+
+// PreimageReport summarizes an audit of the preimages of all settled
+// invoices.
+type PreimageReport struct {
+	// Checked is the number of settled invoices that were checked.
+	Checked int
+
+	// Mismatched holds each settled invoice whose preimage doesn't hash to
+	// the payment hash the invoice is indexed by.
+	Mismatched []PreimageMismatch
+
+	// Missing holds the payment hash of each settled invoice whose
+	// preimage isn't found.
+	Missing [][32]byte
+}
+
+// PreimageMismatch is a settled invoice whose preimage doesn't hash to its
+// payment hash.
+type PreimageMismatch struct {
+	// InvoiceKey is the key of the invoice within the invoice bucket.
+	InvoiceKey []byte
+
+	// PayHash is the payment hash the invoice is indexed by.
+	PayHash [32]byte
+
+	// Preimage is the preimage stored for the invoice.
+	Preimage lntypes.Preimage
+}
+
+// VerifyPreimages checks that the preimage of every settled invoice, whether
+// stored inline or within the preimage bucket, hashes to the payment hash the
+// invoice is indexed by. A mismatch means that HTLCs paying to the invoice
+// were settled with a preimage that doesn't unlock them. The audit is
+// read-only, and performed within a single transaction.
+func (d *DB) VerifyPreimages() (*PreimageReport, error) {
+	var report *PreimageReport
+	err := d.View(func(tx *bbolt.Tx) error {
+		report = &PreimageReport{}
+
+		invoices := tx.Bucket(invoiceBucket)
+		if invoices == nil {
+			return nil
+		}
+		invoiceIndex := invoices.Bucket(invoiceIndexBucket)
+		if invoiceIndex == nil {
+			return nil
+		}
+
+		return invoiceIndex.ForEach(func(payHash, num []byte) error {
+			if bytes.Equal(payHash, numInvoicesKey) {
+				return nil
+			}
+
+			v := invoices.Get(num)
+			if v == nil {
+				return ErrInvoiceNotFound
+			}
+			invoice, err := deserializeInvoice(bytes.NewReader(v))
+			if err != nil {
+				return err
+			}
+			if invoice.Terms.State != ContractSettled {
+				return nil
+			}
+			report.Checked++
+
+			var hash [32]byte
+			copy(hash[:], payHash)
+
+			preimage := invoice.Terms.PaymentPreimage
+			if invoice.preimageRef != nil {
+				preimage, err = fetchPreimage(
+					tx, *invoice.preimageRef,
+				)
+				switch {
+				case err == ErrInvoicePreimageNotFound:
+					preimage = UnknownPreimage
+				case err != nil:
+					return err
+				}
+			}
+
+			switch {
+			case preimage == UnknownPreimage:
+				report.Missing = append(report.Missing, hash)
+
+			case preimage.Hash() != hash:
+				mismatch := PreimageMismatch{
+					InvoiceKey: append([]byte(nil), num...),
+					PayHash:    hash,
+					Preimage:   preimage,
+				}
+				report.Mismatched = append(
+					report.Mismatched, mismatch,
+				)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// movePreimage moves the preimage of a settled invoice to the preimage
+// bucket, leaving a reference to it within the invoice. It's a noop for
+// invoices that aren't settled, or whose preimage has been moved already.
+func movePreimage(tx *bbolt.Tx, i *Invoice) error {
+	if i.Terms.State != ContractSettled ||
+		i.Terms.PaymentPreimage == UnknownPreimage {
+
+		return nil
+	}
+
+	preimages, err := tx.CreateBucketIfNotExists(preimageBucket)
+	if err != nil {
+		return err
+	}
+
+	payHash := i.Terms.PaymentPreimage.Hash()
+	err = preimages.Put(payHash[:], i.Terms.PaymentPreimage[:])
+	if err != nil {
+		return err
+	}
+
+	i.Terms.PaymentPreimage = UnknownPreimage
+	i.preimageRef = &payHash
+
+	return nil
+}
+
+// putInvoiceRecord writes the invoice to the invoice bucket under invoiceNum.
+// The preimage of a settled invoice is stored within the preimage bucket
+// rather than the record itself, while the passed invoice is left untouched.
+func putInvoiceRecord(invoices *bbolt.Bucket, invoiceNum []byte,
+	i *Invoice) error {
+
+	stored := *i
+	if err := movePreimage(invoices.Tx(), &stored); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := serializeInvoice(&buf, &stored); err != nil {
+		return err
+	}
+
+	return invoices.Put(invoiceNum, buf.Bytes())
+}
+
+// resolvePreimage fetches the preimage referenced by the invoice from the
+// preimage bucket and populates the invoice's terms with it.
+func resolvePreimage(tx *bbolt.Tx, i *Invoice) error {
+	if i.preimageRef == nil {
+		return nil
+	}
+
+	preimage, err := fetchPreimage(tx, *i.preimageRef)
+	if err != nil {
+		return err
+	}
+
+	i.Terms.PaymentPreimage = preimage
+	i.preimageRef = nil
+
+	return nil
+}
+
+// fetchPreimage returns the preimage stored under the payment hash within the
+// preimage bucket.
+func fetchPreimage(tx *bbolt.Tx, payHash lntypes.Hash) (lntypes.Preimage,
+	error) {
+
+	var preimage lntypes.Preimage
+
+	preimages := tx.Bucket(preimageBucket)
+	if preimages == nil {
+		return preimage, ErrInvoicePreimageNotFound
+	}
+
+	preimageBytes := preimages.Get(payHash[:])
+	if len(preimageBytes) != lntypes.PreimageSize {
+		return preimage, ErrInvoicePreimageNotFound
+	}
+	copy(preimage[:], preimageBytes)
+
+	return preimage, nil
+}
+
+// encodePreimageRef encodes the payment hash an invoice references its
+// preimage by.
+func encodePreimageRef(payHash *lntypes.Hash) []byte {
+	return append([]byte(nil), payHash[:]...)
+}
+
+// decodePreimageRef decodes the payment hash an invoice references its
+// preimage by.
+func decodePreimageRef(value []byte) (*lntypes.Hash, error) {
+	payHash, err := lntypes.MakeHash(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid preimage reference: %v", err)
+	}
+
+	return &payHash, nil
+}
+
+// invoicePaymentHash derives the payment hash of a serialized invoice, either
+// from its preimage, or from the reference to it if the preimage was moved.
+// It returns false if the preimage of the invoice isn't known.
+func invoicePaymentHash(invoiceBytes []byte) (lntypes.Hash, bool, error) {
+	_, state, preimage, err := deserializeInvoiceState(invoiceBytes)
+	if err != nil {
+		return lntypes.Hash{}, false, err
+	}
+	if preimage != UnknownPreimage {
+		return preimage.Hash(), true, nil
+	}
+	if state != ContractSettled {
+		return lntypes.Hash{}, false, nil
+	}
+
+	invoice, err := deserializeInvoice(bytes.NewReader(invoiceBytes))
+	if err != nil {
+		return lntypes.Hash{}, false, err
+	}
+	if invoice.preimageRef == nil {
+		return lntypes.Hash{}, false, nil
+	}
+
+	return *invoice.preimageRef, true, nil
+}
@@ -0,0 +1,225 @@
+package channeldb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/bbolt"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/lightningnetwork/lnd/lntypes"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// fetchStoredPreimages returns the preimage found inline within the record of
+// the invoice paying to payHash, along with the one stored under payHash
+// within the preimage bucket, if any.
+func fetchStoredPreimages(t *testing.T, db *DB,
+	payHash lntypes.Hash) (lntypes.Preimage, []byte) {
+
+	var (
+		inline lntypes.Preimage
+		stored []byte
+	)
+	err := db.View(func(tx *bbolt.Tx) error {
+		invoices := tx.Bucket(invoiceBucket)
+		invoiceNum := invoices.Bucket(invoiceIndexBucket).Get(
+			payHash[:],
+		)
+
+		var err error
+		_, _, inline, err = deserializeInvoiceState(
+			invoices.Get(invoiceNum),
+		)
+		if err != nil {
+			return err
+		}
+
+		if preimages := tx.Bucket(preimageBucket); preimages != nil {
+			stored = preimages.Get(payHash[:])
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to fetch preimages: %v", err)
+	}
+
+	return inline, stored
+}
+
+// TestSettledInvoicePreimage asserts that the preimage of an invoice is moved
+// out of its record once it's settled, while it's still returned along with
+// the invoice.
+func TestSettledInvoicePreimage(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	amt := lnwire.NewMSatFromSatoshis(1000)
+	invoice, err := randInvoice(amt)
+	if err != nil {
+		t.Fatalf("unable to create invoice: %v", err)
+	}
+	preimage := invoice.Terms.PaymentPreimage
+	payHash := preimage.Hash()
+	if _, err := db.AddInvoice(invoice, payHash); err != nil {
+		t.Fatalf("unable to add invoice: %v", err)
+	}
+
+	// As long as the invoice is open, its preimage is kept inline.
+	inline, stored := fetchStoredPreimages(t, db, payHash)
+	if inline != preimage || stored != nil {
+		t.Fatalf("expected preimage inline, got inline=%v stored=%x",
+			inline, stored)
+	}
+
+	settled, err := db.AcceptOrSettleInvoice(payHash, amt)
+	if err != nil {
+		t.Fatalf("unable to settle invoice: %v", err)
+	}
+	if settled.Terms.PaymentPreimage != preimage {
+		t.Fatalf("expected preimage %v, got %v", preimage,
+			settled.Terms.PaymentPreimage)
+	}
+
+	// Once settled, the preimage should only be found within the
+	// preimage bucket.
+	inline, stored = fetchStoredPreimages(t, db, payHash)
+	if inline != UnknownPreimage {
+		t.Fatalf("expected no inline preimage, got %v", inline)
+	}
+	if !bytes.Equal(stored, preimage[:]) {
+		t.Fatalf("expected stored preimage %v, got %x", preimage,
+			stored)
+	}
+
+	// The preimage should still be returned by all lookups.
+	dbInvoice, err := db.LookupInvoice(payHash)
+	if err != nil {
+		t.Fatalf("unable to lookup invoice: %v", err)
+	}
+	if !reflect.DeepEqual(*settled, dbInvoice) {
+		t.Fatalf("invoice mismatch: expected %v, got %v",
+			spew.Sdump(settled), spew.Sdump(dbInvoice))
+	}
+
+	_, state, statePreimage, err := db.LookupInvoiceState(payHash)
+	if err != nil {
+		t.Fatalf("unable to lookup invoice state: %v", err)
+	}
+	if state != ContractSettled || statePreimage != preimage {
+		t.Fatalf("expected settled invoice with preimage %v, got "+
+			"state=%v preimage=%v", preimage, state, statePreimage)
+	}
+
+	invoices, err := db.FetchAllInvoices(false)
+	if err != nil {
+		t.Fatalf("unable to fetch invoices: %v", err)
+	}
+	if len(invoices) != 1 ||
+		invoices[0].Terms.PaymentPreimage != preimage {
+
+		t.Fatalf("expected invoice with preimage %v, got %v",
+			preimage, spew.Sdump(invoices))
+	}
+
+	// A lost preimage should be reported rather than returned as unknown.
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(preimageBucket).Delete(payHash[:])
+	})
+	if err != nil {
+		t.Fatalf("unable to delete preimage: %v", err)
+	}
+	_, err = db.LookupInvoice(payHash)
+	if err != ErrInvoicePreimageNotFound {
+		t.Fatalf("expected ErrInvoicePreimageNotFound, got %v", err)
+	}
+}
+
+// TestVerifyPreimages asserts that settled invoices whose preimage doesn't
+// hash to their payment hash, or was lost, are reported, while open invoices
+// aren't checked.
+func TestVerifyPreimages(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	amt := lnwire.NewMSatFromSatoshis(1000)
+	addInvoice := func(settle bool, payHash *lntypes.Hash) lntypes.Hash {
+		t.Helper()
+
+		invoice, err := randInvoice(amt)
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+		hash := invoice.Terms.PaymentPreimage.Hash()
+		if payHash != nil {
+			hash = *payHash
+		}
+		if _, err := db.AddInvoice(invoice, hash); err != nil {
+			t.Fatalf("unable to add invoice: %v", err)
+		}
+		if settle {
+			_, err := db.AcceptOrSettleInvoice(hash, amt)
+			if err != nil {
+				t.Fatalf("unable to settle invoice: %v", err)
+			}
+		}
+
+		return hash
+	}
+
+	report, err := db.VerifyPreimages()
+	if err != nil {
+		t.Fatalf("unable to verify preimages: %v", err)
+	}
+	if report.Checked != 0 {
+		t.Fatalf("expected no invoices to be checked, got %v",
+			report.Checked)
+	}
+
+	// An open invoice indexed by a wrong hash isn't checked, as it has no
+	// preimage to claim with yet.
+	wrongHash := lntypes.Hash{1}
+	otherHash := lntypes.Hash{2}
+	addInvoice(true, nil)
+	addInvoice(false, &otherHash)
+	mismatched := addInvoice(true, &wrongHash)
+	lost := addInvoice(true, nil)
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(preimageBucket).Delete(lost[:])
+	})
+	if err != nil {
+		t.Fatalf("unable to delete preimage: %v", err)
+	}
+
+	report, err = db.VerifyPreimages()
+	if err != nil {
+		t.Fatalf("unable to verify preimages: %v", err)
+	}
+	if report.Checked != 3 {
+		t.Fatalf("expected 3 invoices to be checked, got %v",
+			report.Checked)
+	}
+	if len(report.Mismatched) != 1 ||
+		report.Mismatched[0].PayHash != mismatched ||
+		report.Mismatched[0].Preimage.Hash() == mismatched {
+
+		t.Fatalf("expected mismatch of %v, got %v", mismatched,
+			spew.Sdump(report.Mismatched))
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != lost {
+		t.Fatalf("expected missing preimage of %v, got %x", lost,
+			report.Missing)
+	}
+}
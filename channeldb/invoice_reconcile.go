@@ -0,0 +1,102 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/coreos/bbolt"
+)
+
+// ReconcileReport summarizes a cross-check of the state of all invoices
+// against an external source of HTLC resolutions.
+type ReconcileReport struct {
+	// Checked is the number of invoices that were checked.
+	Checked int
+
+	// SettledWithoutHTLC holds the payment hash of each invoice that's
+	// marked settled, while no HTLC paying to it was resolved.
+	SettledWithoutHTLC [][32]byte
+
+	// HTLCWithoutSettlement holds the payment hash of each invoice that
+	// an HTLC paying to was resolved, while the invoice isn't marked
+	// settled.
+	HTLCWithoutSettlement [][32]byte
+}
+
+// ReconcileInvoiceSettlements cross-checks the state of every invoice against
+// htlcLookup, which reports whether an HTLC paying to the passed payment hash
+// was resolved. Such discrepancies arise when a crash occurs between the
+// resolution of an HTLC and the settlement of its invoice. Invoices are only
+// reported, never modified. The lookup is performed outside of any database
+// transaction, such that it may e.g. query the contract court.
+func (d *DB) ReconcileInvoiceSettlements(
+	htlcLookup func([32]byte) (bool, error)) (*ReconcileReport, error) {
+
+	type invoiceSettlement struct {
+		payHash [32]byte
+		settled bool
+	}
+	var invoices []invoiceSettlement
+	err := d.View(func(tx *bbolt.Tx) error {
+		invoiceB := tx.Bucket(invoiceBucket)
+		if invoiceB == nil {
+			return nil
+		}
+		invoiceIndex := invoiceB.Bucket(invoiceIndexBucket)
+		if invoiceIndex == nil {
+			return nil
+		}
+
+		return invoiceIndex.ForEach(func(payHash, num []byte) error {
+			if bytes.Equal(payHash, numInvoicesKey) {
+				return nil
+			}
+
+			v := invoiceB.Get(num)
+			if v == nil {
+				return ErrInvoiceNotFound
+			}
+
+			_, state, _, err := deserializeInvoiceState(v)
+			if err != nil {
+				return err
+			}
+
+			invoice := invoiceSettlement{
+				settled: state == ContractSettled,
+			}
+			copy(invoice.payHash[:], payHash)
+			invoices = append(invoices, invoice)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconcileReport{}
+	for _, invoice := range invoices {
+		resolved, err := htlcLookup(invoice.payHash)
+		if err != nil {
+			return nil, fmt.Errorf("unable to look up HTLC "+
+				"resolution of invoice %x: %v", invoice.payHash,
+				err)
+		}
+
+		report.Checked++
+		switch {
+		case invoice.settled && !resolved:
+			report.SettledWithoutHTLC = append(
+				report.SettledWithoutHTLC, invoice.payHash,
+			)
+
+		case !invoice.settled && resolved:
+			report.HTLCWithoutSettlement = append(
+				report.HTLCWithoutSettlement, invoice.payHash,
+			)
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,94 @@
+package channeldb
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lntypes"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestReconcileInvoiceSettlements asserts that settled invoices lacking a
+// resolved HTLC, and resolved HTLCs whose invoice isn't settled, are reported,
+// while consistent invoices aren't.
+func TestReconcileInvoiceSettlements(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	amt := lnwire.NewMSatFromSatoshis(1000)
+	addInvoice := func(settle bool) lntypes.Hash {
+		invoice, err := randInvoice(amt)
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+		hash := invoice.Terms.PaymentPreimage.Hash()
+		if _, err := db.AddInvoice(invoice, hash); err != nil {
+			t.Fatalf("unable to add invoice: %v", err)
+		}
+
+		if settle {
+			_, err := db.AcceptOrSettleInvoice(hash, amt)
+			if err != nil {
+				t.Fatalf("unable to settle invoice: %v", err)
+			}
+		}
+
+		return hash
+	}
+
+	var (
+		settledResolved   = addInvoice(true)
+		settledUnresolved = addInvoice(true)
+		openResolved      = addInvoice(false)
+	)
+
+	// An open invoice without a resolved HTLC is consistent, and shouldn't
+	// be reported.
+	addInvoice(false)
+
+	resolved := map[[32]byte]bool{
+		settledResolved: true,
+		openResolved:    true,
+	}
+	report, err := db.ReconcileInvoiceSettlements(
+		func(payHash [32]byte) (bool, error) {
+			return resolved[payHash], nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("unable to reconcile invoices: %v", err)
+	}
+
+	if report.Checked != 4 {
+		t.Fatalf("expected 4 checked invoices, got %v", report.Checked)
+	}
+	if len(report.SettledWithoutHTLC) != 1 ||
+		report.SettledWithoutHTLC[0] != settledUnresolved {
+
+		t.Fatalf("expected only %v to be settled without HTLC, got %x",
+			settledUnresolved, report.SettledWithoutHTLC)
+	}
+	if len(report.HTLCWithoutSettlement) != 1 ||
+		report.HTLCWithoutSettlement[0] != openResolved {
+
+		t.Fatalf("expected only %v to be resolved without "+
+			"settlement, got %x", openResolved,
+			report.HTLCWithoutSettlement)
+	}
+
+	// A failing lookup should abort the reconciliation.
+	lookupErr := fmt.Errorf("contract court unavailable")
+	_, err = db.ReconcileInvoiceSettlements(
+		func([32]byte) (bool, error) {
+			return false, lookupErr
+		},
+	)
+	if err == nil {
+		t.Fatalf("expected reconciliation to fail")
+	}
+}
@@ -0,0 +1,134 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightningnetwork/lnd/zpay32"
+)
+
+const (
+	// routeHintsType is the TLV record type of the routing hints of an
+	// invoice. The record holds the number of routes, each of which is
+	// its number of hops followed by the hops themselves.
+	routeHintsType uint64 = 4
+
+	// hopHintSize is the size of a serialized hop hint: the node's
+	// compressed public key, the channel ID, both fees and the time lock
+	// delta.
+	hopHintSize = 33 + 8 + 4 + 4 + 2
+
+	// MaxHopHintsPerRoute is the max number of hops a single routing hint
+	// of an invoice may consist of. This is the number of hops that fit
+	// within a single routing field of a BOLT 11 payment request.
+	MaxHopHintsPerRoute = 12
+)
+
+var (
+	// ErrInvalidRouteHint is returned when a routing hint of an invoice
+	// is empty, too long, or holds a hop lacking a node or channel.
+	ErrInvalidRouteHint = fmt.Errorf("invalid invoice route hint")
+)
+
+// validateRouteHints ensures that every routing hint of an invoice consists
+// of at least one and at most MaxHopHintsPerRoute hops, each of which
+// identifies both a node and a channel.
+func validateRouteHints(routeHints [][]zpay32.HopHint) error {
+	for _, route := range routeHints {
+		if len(route) == 0 || len(route) > MaxHopHintsPerRoute {
+			return ErrInvalidRouteHint
+		}
+
+		for _, hop := range route {
+			if hop.NodeID == nil || hop.ChannelID == 0 {
+				return ErrInvalidRouteHint
+			}
+		}
+	}
+
+	return nil
+}
+
+// encodeRouteHints serializes the passed routing hints into the value of
+// their TLV record.
+func encodeRouteHints(routeHints [][]zpay32.HopHint) ([]byte, error) {
+	var b bytes.Buffer
+	err := wire.WriteVarInt(&b, 0, uint64(len(routeHints)))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, route := range routeHints {
+		if _, err := b.Write([]byte{byte(len(route))}); err != nil {
+			return nil, err
+		}
+
+		for _, hop := range route {
+			err := serializeHopHint(&b, &hop)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return b.Bytes(), nil
+}
+
+// decodeRouteHints deserializes the routing hints of an invoice from the
+// value of their TLV record.
+func decodeRouteHints(value []byte) ([][]zpay32.HopHint, error) {
+	r := bytes.NewReader(value)
+	numRoutes, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each route takes up at least its length and a single hop, which
+	// bounds the number of routes we'll allocate for.
+	if numRoutes > uint64(r.Len())/(1+hopHintSize) {
+		return nil, ErrInvalidRouteHint
+	}
+
+	routeHints := make([][]zpay32.HopHint, 0, numRoutes)
+	for i := uint64(0); i < numRoutes; i++ {
+		var numHops [1]byte
+		if _, err := io.ReadFull(r, numHops[:]); err != nil {
+			return nil, err
+		}
+
+		route := make([]zpay32.HopHint, numHops[0])
+		for j := range route {
+			if err := deserializeHopHint(r, &route[j]); err != nil {
+				return nil, err
+			}
+		}
+
+		routeHints = append(routeHints, route)
+	}
+
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%v trailing bytes within route hints "+
+			"record", r.Len())
+	}
+	if err := validateRouteHints(routeHints); err != nil {
+		return nil, err
+	}
+
+	return routeHints, nil
+}
+
+func serializeHopHint(w io.Writer, hop *zpay32.HopHint) error {
+	return WriteElements(w,
+		hop.NodeID, hop.ChannelID, hop.FeeBaseMSat,
+		hop.FeeProportionalMillionths, hop.CLTVExpiryDelta,
+	)
+}
+
+func deserializeHopHint(r io.Reader, hop *zpay32.HopHint) error {
+	return ReadElements(r,
+		&hop.NodeID, &hop.ChannelID, &hop.FeeBaseMSat,
+		&hop.FeeProportionalMillionths, &hop.CLTVExpiryDelta,
+	)
+}
@@ -6,8 +6,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/coreos/bbolt"
 	"github.com/davecgh/go-spew/spew"
+	"github.com/lightningnetwork/lnd/lntypes"
 	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/lightningnetwork/lnd/zpay32"
 )
 
 func randInvoice(value lnwire.MilliSatoshi) (*Invoice, error) {
@@ -352,6 +356,7 @@ func TestDuplicateSettleInvoice(t *testing.T) {
 	invoice.SettleIndex = 1
 	invoice.Terms.State = ContractSettled
 	invoice.AmtPaid = amt
+	invoice.HtlcAttempted = true
 	invoice.SettleDate = dbInvoice.SettleDate
 
 	// We should get back the exact same invoice that we just inserted.
@@ -648,3 +653,575 @@ func TestQueryInvoices(t *testing.T) {
 		}
 	}
 }
+
+// TestInvoiceCustomRecords asserts that custom records attached to an invoice
+// survive a round trip through the database, and that records within the
+// reserved type range are rejected.
+func TestInvoiceCustomRecords(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	invoice, err := randInvoice(lnwire.NewMSatFromSatoshis(1000))
+	if err != nil {
+		t.Fatalf("unable to create invoice: %v", err)
+	}
+	invoice.CustomRecords = map[uint64][]byte{
+		CustomTypeStart:     []byte("pos-terminal-7"),
+		CustomTypeStart + 1: {},
+	}
+
+	paymentHash := invoice.Terms.PaymentPreimage.Hash()
+	if _, err := db.AddInvoice(invoice, paymentHash); err != nil {
+		t.Fatalf("unable to add invoice: %v", err)
+	}
+
+	dbInvoice, err := db.LookupInvoice(paymentHash)
+	if err != nil {
+		t.Fatalf("unable to lookup invoice: %v", err)
+	}
+	if !reflect.DeepEqual(*invoice, dbInvoice) {
+		t.Fatalf("invoice mismatch: expected %v, got %v",
+			spew.Sdump(invoice), spew.Sdump(dbInvoice))
+	}
+
+	// The records should also be preserved once the invoice is settled.
+	settled, err := db.AcceptOrSettleInvoice(paymentHash, 1000)
+	if err != nil {
+		t.Fatalf("unable to settle invoice: %v", err)
+	}
+	if !reflect.DeepEqual(invoice.CustomRecords, settled.CustomRecords) {
+		t.Fatalf("custom records mismatch: expected %v, got %v",
+			spew.Sdump(invoice.CustomRecords),
+			spew.Sdump(settled.CustomRecords))
+	}
+
+	// Finally, an invoice carrying a record below the custom type range
+	// should be rejected.
+	badInvoice, err := randInvoice(lnwire.NewMSatFromSatoshis(1000))
+	if err != nil {
+		t.Fatalf("unable to create invoice: %v", err)
+	}
+	badInvoice.CustomRecords = map[uint64][]byte{
+		CustomTypeStart - 1: []byte("reserved"),
+	}
+	_, err = db.AddInvoice(
+		badInvoice, badInvoice.Terms.PaymentPreimage.Hash(),
+	)
+	if err == nil {
+		t.Fatalf("expected invoice with reserved record type to be " +
+			"rejected")
+	}
+}
+
+// TestInvoiceFiatAmount asserts that the fiat amount and exchange rate of an
+// invoice survive a round trip through the database, and that malformed ones
+// are rejected.
+func TestInvoiceFiatAmount(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	invoice, err := randInvoice(lnwire.NewMSatFromSatoshis(1000))
+	if err != nil {
+		t.Fatalf("unable to create invoice: %v", err)
+	}
+	invoice.FiatAmount = &FiatAmount{
+		Currency: "USD",
+		Amount:   1250,
+	}
+	invoice.ExchangeRate = 800000000
+	invoice.CustomRecords = map[uint64][]byte{
+		CustomTypeStart: []byte("pos-terminal-7"),
+	}
+
+	paymentHash := invoice.Terms.PaymentPreimage.Hash()
+	if _, err := db.AddInvoice(invoice, paymentHash); err != nil {
+		t.Fatalf("unable to add invoice: %v", err)
+	}
+
+	dbInvoice, err := db.LookupInvoice(paymentHash)
+	if err != nil {
+		t.Fatalf("unable to lookup invoice: %v", err)
+	}
+	if !reflect.DeepEqual(*invoice, dbInvoice) {
+		t.Fatalf("invoice mismatch: expected %v, got %v",
+			spew.Sdump(invoice), spew.Sdump(dbInvoice))
+	}
+
+	// Invoices with a malformed currency, or an exchange rate lacking a
+	// fiat amount, should be rejected.
+	badInvoices := []func(*Invoice){
+		func(i *Invoice) {
+			i.FiatAmount = &FiatAmount{Currency: "usd", Amount: 1}
+		},
+		func(i *Invoice) {
+			i.FiatAmount = &FiatAmount{Currency: "USDT", Amount: 1}
+		},
+		func(i *Invoice) {
+			i.ExchangeRate = 1
+		},
+	}
+	for i, modify := range badInvoices {
+		badInvoice, err := randInvoice(lnwire.NewMSatFromSatoshis(1000))
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+		modify(badInvoice)
+
+		_, err = db.AddInvoice(
+			badInvoice, badInvoice.Terms.PaymentPreimage.Hash(),
+		)
+		if err == nil {
+			t.Fatalf("expected bad invoice #%v to be rejected", i)
+		}
+	}
+}
+
+// TestInvoiceRouteHints asserts that the routing hints of an invoice survive
+// a round trip through the database, and that malformed ones are rejected.
+func TestInvoiceRouteHints(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	priv1, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	priv2, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	hop1 := zpay32.HopHint{
+		NodeID:                    priv1.PubKey(),
+		ChannelID:                 12345,
+		FeeBaseMSat:               1000,
+		FeeProportionalMillionths: 10,
+		CLTVExpiryDelta:           144,
+	}
+	hop2 := zpay32.HopHint{
+		NodeID:                    priv2.PubKey(),
+		ChannelID:                 67890,
+		FeeBaseMSat:               0,
+		FeeProportionalMillionths: 1,
+		CLTVExpiryDelta:           40,
+	}
+
+	invoice, err := randInvoice(lnwire.NewMSatFromSatoshis(1000))
+	if err != nil {
+		t.Fatalf("unable to create invoice: %v", err)
+	}
+	invoice.RouteHints = [][]zpay32.HopHint{
+		{hop1},
+		{hop1, hop2},
+	}
+
+	paymentHash := invoice.Terms.PaymentPreimage.Hash()
+	if _, err := db.AddInvoice(invoice, paymentHash); err != nil {
+		t.Fatalf("unable to add invoice: %v", err)
+	}
+
+	dbInvoice, err := db.LookupInvoice(paymentHash)
+	if err != nil {
+		t.Fatalf("unable to lookup invoice: %v", err)
+	}
+	if !reflect.DeepEqual(*invoice, dbInvoice) {
+		t.Fatalf("invoice mismatch: expected %v, got %v",
+			spew.Sdump(invoice), spew.Sdump(dbInvoice))
+	}
+
+	// Empty or overly long routes, and hops lacking a node or channel,
+	// should be rejected.
+	tooLong := make([]zpay32.HopHint, MaxHopHintsPerRoute+1)
+	for i := range tooLong {
+		tooLong[i] = hop1
+	}
+	noNode := hop1
+	noNode.NodeID = nil
+	noChannel := hop1
+	noChannel.ChannelID = 0
+
+	badRouteHints := [][][]zpay32.HopHint{
+		{{}},
+		{tooLong},
+		{{hop1}, {noNode}},
+		{{noChannel, hop2}},
+	}
+	for i, routeHints := range badRouteHints {
+		badInvoice, err := randInvoice(lnwire.NewMSatFromSatoshis(1000))
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+		badInvoice.RouteHints = routeHints
+
+		_, err = db.AddInvoice(
+			badInvoice, badInvoice.Terms.PaymentPreimage.Hash(),
+		)
+		if err != ErrInvalidRouteHint {
+			t.Fatalf("expected bad invoice #%v to be rejected, "+
+				"got %v", i, err)
+		}
+	}
+}
+
+// TestRepairSettleIndex asserts that RepairSettleIndex removes settle index
+// entries which don't reference a matching settled invoice, and re-indexes
+// settled invoices which lack an entry.
+func TestRepairSettleIndex(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	// We'll add a few invoices, settling all but the last one.
+	const numInvoices = 4
+	amt := lnwire.NewMSatFromSatoshis(1000)
+	payHashes := make([]lntypes.Hash, 0, numInvoices)
+	for i := 0; i < numInvoices; i++ {
+		invoice, err := randInvoice(amt)
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+
+		payHash := invoice.Terms.PaymentPreimage.Hash()
+		if _, err := db.AddInvoice(invoice, payHash); err != nil {
+			t.Fatalf("unable to add invoice %v", err)
+		}
+		payHashes = append(payHashes, payHash)
+
+		if i == numInvoices-1 {
+			continue
+		}
+
+		if _, err := db.AcceptOrSettleInvoice(payHash, amt); err != nil {
+			t.Fatalf("unable to settle invoice: %v", err)
+		}
+	}
+
+	// A consistent index shouldn't require any repairs.
+	numRepairs, err := db.RepairSettleIndex()
+	if err != nil {
+		t.Fatalf("unable to repair settle index: %v", err)
+	}
+	if numRepairs != 0 {
+		t.Fatalf("expected no repairs, got %v", numRepairs)
+	}
+
+	// Now, we'll corrupt the index by removing the entry of the first
+	// invoice, and adding entries that point to the open invoice and to a
+	// non-existent invoice.
+	err = db.Update(func(tx *bbolt.Tx) error {
+		invoices := tx.Bucket(invoiceBucket)
+		invoiceIndex := invoices.Bucket(invoiceIndexBucket)
+		settleIndex := invoices.Bucket(settleIndexBucket)
+
+		var seqNo [8]byte
+		byteOrder.PutUint64(seqNo[:], 1)
+		if err := settleIndex.Delete(seqNo[:]); err != nil {
+			return err
+		}
+
+		openInvoiceNum := invoiceIndex.Get(payHashes[numInvoices-1][:])
+		byteOrder.PutUint64(seqNo[:], 100)
+		if err := settleIndex.Put(seqNo[:], openInvoiceNum); err != nil {
+			return err
+		}
+
+		byteOrder.PutUint64(seqNo[:], 101)
+		return settleIndex.Put(seqNo[:], []byte{0xff, 0xff, 0xff, 0xff})
+	})
+	if err != nil {
+		t.Fatalf("unable to corrupt settle index: %v", err)
+	}
+
+	numRepairs, err = db.RepairSettleIndex()
+	if err != nil {
+		t.Fatalf("unable to repair settle index: %v", err)
+	}
+	if numRepairs != 3 {
+		t.Fatalf("expected 3 repairs, got %v", numRepairs)
+	}
+
+	// The first invoice should have been assigned the next settle index,
+	// and be the only invoice reported as settled after the remaining
+	// original entries.
+	invoice, err := db.LookupInvoice(payHashes[0])
+	if err != nil {
+		t.Fatalf("unable to lookup invoice: %v", err)
+	}
+	if invoice.SettleIndex != numInvoices {
+		t.Fatalf("expected settle index %v, got %v", numInvoices,
+			invoice.SettleIndex)
+	}
+
+	settled, err := db.InvoicesSettledSince(numInvoices - 1)
+	if err != nil {
+		t.Fatalf("unable to fetch settled invoices: %v", err)
+	}
+	if len(settled) != 1 || settled[0].SettleIndex != numInvoices {
+		t.Fatalf("expected only repaired invoice, got %v",
+			spew.Sdump(settled))
+	}
+
+	// Running the repair again should be a noop.
+	numRepairs, err = db.RepairSettleIndex()
+	if err != nil {
+		t.Fatalf("unable to repair settle index: %v", err)
+	}
+	if numRepairs != 0 {
+		t.Fatalf("expected no repairs, got %v", numRepairs)
+	}
+}
+
+// TestReindexInvoice asserts that an invoice can be moved to a new payment
+// hash, retaining its add and settle index while dropping the payment request
+// of its old hash.
+func TestReindexInvoice(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	// We'll add a settled hold invoice, whose preimage isn't known by the
+	// invoice itself, and a regular invoice.
+	amt := lnwire.NewMSatFromSatoshis(1000)
+	holdInvoice, err := randInvoice(amt)
+	if err != nil {
+		t.Fatalf("unable to create invoice: %v", err)
+	}
+	preimage := holdInvoice.Terms.PaymentPreimage
+	holdInvoice.Terms.PaymentPreimage = UnknownPreimage
+	holdInvoice.PaymentRequest = []byte("payment request")
+
+	var oldHash lntypes.Hash
+	if _, err := rand.Read(oldHash[:]); err != nil {
+		t.Fatalf("unable to generate hash: %v", err)
+	}
+	if _, err := db.AddInvoice(holdInvoice, oldHash); err != nil {
+		t.Fatalf("unable to add invoice: %v", err)
+	}
+
+	otherInvoice, err := randInvoice(amt)
+	if err != nil {
+		t.Fatalf("unable to create invoice: %v", err)
+	}
+	otherHash := otherInvoice.Terms.PaymentPreimage.Hash()
+	if _, err := db.AddInvoice(otherInvoice, otherHash); err != nil {
+		t.Fatalf("unable to add invoice: %v", err)
+	}
+
+	// Moving the invoice onto the hash of an existing invoice should fail.
+	err = db.ReindexInvoice(oldHash, otherHash)
+	if err != ErrDuplicateInvoice {
+		t.Fatalf("expected ErrDuplicateInvoice, got %v", err)
+	}
+
+	// We'll now move the invoice to the hash of its actual preimage, after
+	// which it can be settled using the preimage.
+	newHash := preimage.Hash()
+	if err := db.ReindexInvoice(oldHash, newHash); err != nil {
+		t.Fatalf("unable to reindex invoice: %v", err)
+	}
+	if _, err := db.LookupInvoice(oldHash); err != ErrInvoiceNotFound {
+		t.Fatalf("expected ErrInvoiceNotFound, got %v", err)
+	}
+	invoice, err := db.LookupInvoice(newHash)
+	if err != nil {
+		t.Fatalf("unable to lookup invoice: %v", err)
+	}
+	if len(invoice.PaymentRequest) != 0 {
+		t.Fatalf("expected payment request of old hash to be "+
+			"cleared, got %v", string(invoice.PaymentRequest))
+	}
+
+	if _, err := db.AcceptOrSettleInvoice(newHash, amt); err != nil {
+		t.Fatalf("unable to accept invoice: %v", err)
+	}
+	if _, err := db.SettleHoldInvoice(preimage); err != nil {
+		t.Fatalf("unable to settle invoice: %v", err)
+	}
+
+	invoice, err = db.LookupInvoice(newHash)
+	if err != nil {
+		t.Fatalf("unable to lookup invoice: %v", err)
+	}
+	if invoice.AddIndex != 1 || invoice.SettleIndex != 1 {
+		t.Fatalf("unexpected add index %v and settle index %v",
+			invoice.AddIndex, invoice.SettleIndex)
+	}
+
+	settled, err := db.InvoicesSettledSince(0)
+	if err != nil {
+		t.Fatalf("unable to query settled invoices: %v", err)
+	}
+	if len(settled) != 1 || settled[0].AddIndex != invoice.AddIndex {
+		t.Fatalf("unexpected settled invoices: %v", spew.Sdump(settled))
+	}
+
+	// Now that the preimage is known, the invoice can't be moved to a hash
+	// that doesn't match it.
+	err = db.ReindexInvoice(newHash, oldHash)
+	if err != ErrInvoicePreimageMismatch {
+		t.Fatalf("expected ErrInvoicePreimageMismatch, got %v", err)
+	}
+
+	var unknownHash lntypes.Hash
+	err = db.ReindexInvoice(unknownHash, oldHash)
+	if err != ErrInvoiceNotFound {
+		t.Fatalf("expected ErrInvoiceNotFound, got %v", err)
+	}
+}
+
+// TestLookupInvoiceState asserts that the value, state and preimage returned
+// by LookupInvoiceState match those of the full invoice as it progresses.
+func TestLookupInvoiceState(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	amt := lnwire.NewMSatFromSatoshis(1000)
+	invoice, err := randInvoice(amt)
+	if err != nil {
+		t.Fatalf("unable to create invoice: %v", err)
+	}
+	invoice.CustomRecords = map[uint64][]byte{CustomTypeStart: {1, 2, 3}}
+
+	paymentHash := invoice.Terms.PaymentPreimage.Hash()
+	if _, err := db.AddInvoice(invoice, paymentHash); err != nil {
+		t.Fatalf("unable to add invoice: %v", err)
+	}
+
+	assertState := func(expectedState ContractState) {
+		t.Helper()
+
+		value, state, preimage, err := db.LookupInvoiceState(
+			paymentHash,
+		)
+		if err != nil {
+			t.Fatalf("unable to lookup invoice state: %v", err)
+		}
+		if value != amt {
+			t.Fatalf("expected value %v, got %v", amt, value)
+		}
+		if state != expectedState {
+			t.Fatalf("expected state %v, got %v", expectedState,
+				state)
+		}
+		if preimage != invoice.Terms.PaymentPreimage {
+			t.Fatalf("expected preimage %v, got %v",
+				invoice.Terms.PaymentPreimage, preimage)
+		}
+	}
+
+	assertState(ContractOpen)
+
+	if _, err := db.AcceptOrSettleInvoice(paymentHash, amt); err != nil {
+		t.Fatalf("unable to settle invoice: %v", err)
+	}
+	assertState(ContractSettled)
+
+	// Looking up an unknown payment hash should fail.
+	var unknownHash [32]byte
+	_, _, _, err = db.LookupInvoiceState(unknownHash)
+	if err != ErrInvoiceNotFound {
+		t.Fatalf("expected ErrInvoiceNotFound, got %v", err)
+	}
+}
+
+// TestReorderInvoiceAddIndex asserts that reordering the add index sorts
+// invoices by their creation date, and allocates add indexes that follow all
+// previously assigned ones.
+func TestReorderInvoiceAddIndex(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	// We'll import three invoices whose creation dates are out of order
+	// with respect to their insertion.
+	creationDates := []time.Time{
+		time.Unix(3000, 0), time.Unix(1000, 0), time.Unix(2000, 0),
+	}
+	for _, creationDate := range creationDates {
+		invoice, err := randInvoice(1000)
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+		invoice.CreationDate = creationDate
+
+		hash := invoice.Terms.PaymentPreimage.Hash()
+		if _, err := db.AddInvoice(invoice, hash); err != nil {
+			t.Fatalf("unable to add invoice: %v", err)
+		}
+	}
+
+	if err := db.ReorderInvoiceAddIndex(); err != nil {
+		t.Fatalf("unable to reorder add index: %v", err)
+	}
+
+	// Resuming from the latest add index handed out before reordering
+	// should return all invoices once more, now sorted by their creation
+	// date.
+	added, err := db.InvoicesAddedSince(uint64(len(creationDates)))
+	if err != nil {
+		t.Fatalf("unable to query added invoices: %v", err)
+	}
+	if len(added) != len(creationDates) {
+		t.Fatalf("expected %v invoices, got %v", len(creationDates),
+			len(added))
+	}
+	for i, invoice := range added {
+		expectedDate := time.Unix(int64(i+1)*1000, 0)
+		if !invoice.CreationDate.Equal(expectedDate) {
+			t.Fatalf("expected creation date %v, got %v",
+				expectedDate, invoice.CreationDate)
+		}
+
+		expectedIndex := uint64(len(creationDates) + i + 1)
+		if invoice.AddIndex != expectedIndex {
+			t.Fatalf("expected add index %v, got %v",
+				expectedIndex, invoice.AddIndex)
+		}
+	}
+
+	// New invoices should be added after the reordered ones.
+	invoice, err := randInvoice(1000)
+	if err != nil {
+		t.Fatalf("unable to create invoice: %v", err)
+	}
+	addIndex, err := db.AddInvoice(
+		invoice, invoice.Terms.PaymentPreimage.Hash(),
+	)
+	if err != nil {
+		t.Fatalf("unable to add invoice: %v", err)
+	}
+	if addIndex != uint64(2*len(creationDates)+1) {
+		t.Fatalf("unexpected add index %v", addIndex)
+	}
+}
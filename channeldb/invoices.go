@@ -6,12 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"time"
 
 	"github.com/btcsuite/btcd/wire"
 	"github.com/coreos/bbolt"
 	"github.com/lightningnetwork/lnd/lntypes"
 	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/lightningnetwork/lnd/zpay32"
 )
 
 var (
@@ -76,6 +78,12 @@ var (
 
 	// ErrInvoiceStillOpen is returned when the invoice is still open.
 	ErrInvoiceStillOpen = errors.New("invoice still open")
+
+	// ErrInvoicePreimageMismatch is returned when attempting to re-key or
+	// settle an invoice with a preimage that doesn't match its payment
+	// hash.
+	ErrInvoicePreimageMismatch = errors.New("invoice preimage doesn't " +
+		"match payment hash")
 )
 
 const (
@@ -209,6 +217,54 @@ type Invoice struct {
 	// that the invoice originally didn't specify an amount, or the sender
 	// overpaid.
 	AmtPaid lnwire.MilliSatoshi
+
+	// CustomRecords is an optional set of application specific TLV records
+	// attached to the invoice. All record types must be greater than or
+	// equal to CustomTypeStart.
+	CustomRecords map[uint64][]byte
+
+	// FiatAmount is the optional amount of the invoice in a fiat currency,
+	// as priced at the time the invoice was created.
+	FiatAmount *FiatAmount
+
+	// ExchangeRate is the optional exchange rate used to derive the value
+	// of the invoice from its fiat amount, expressed as the number of
+	// minor units of the fiat currency per bitcoin. A zero value means no
+	// exchange rate was recorded. It may only be set along with
+	// FiatAmount.
+	ExchangeRate uint64
+
+	// HtlcAttempted is true once an HTLC paying to the invoice has been
+	// seen, regardless of whether it was accepted.
+	HtlcAttempted bool
+
+	// RouteHints are the optional routing hints included within the
+	// payment request of the invoice, typically to reach us through
+	// private channels. They're retained such that the payment request
+	// can be reconstructed.
+	RouteHints [][]zpay32.HopHint
+
+	// OfferID is the ID of the offer the invoice was issued for, which
+	// must have been added through AddOffer. Invoices that weren't issued
+	// for an offer have the zero ID.
+	OfferID [32]byte
+
+	// PaymentAddr is the payment address of the invoice, also known as its
+	// payment secret. It's included within the payment request, such that
+	// only HTLCs of the payer carry it, and lets the HTLCs of a multi-path
+	// payment be matched to the invoice. No two invoices share a payment
+	// address, while invoices without one have the zero address.
+	PaymentAddr [32]byte
+
+	// PaymentRequestFields are the fields of the payment request of the
+	// invoice that the invoice doesn't otherwise hold, such as its network
+	// and expiry. It's nil for invoices stored without them.
+	PaymentRequestFields *PaymentRequestFields
+
+	// preimageRef is the payment hash of a settled invoice whose preimage
+	// was moved to the preimage bucket. It's only set on invoices decoded
+	// without resolving their preimage.
+	preimageRef *lntypes.Hash
 }
 
 func validateInvoice(i *Invoice) error {
@@ -226,6 +282,25 @@ func validateInvoice(i *Invoice) error {
 			"provided was %v", MaxPaymentRequestSize,
 			len(i.PaymentRequest))
 	}
+	if err := validateCustomRecords(i.CustomRecords); err != nil {
+		return err
+	}
+	if err := validateRouteHints(i.RouteHints); err != nil {
+		return err
+	}
+	if i.FiatAmount != nil {
+		if err := validateFiatAmount(i.FiatAmount); err != nil {
+			return err
+		}
+	} else if i.ExchangeRate != 0 {
+		return ErrExchangeRateWithoutFiatAmount
+	}
+	if i.PaymentRequestFields != nil {
+		err := validatePaymentRequestFields(i.PaymentRequestFields)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -320,7 +395,7 @@ func (d *DB) InvoicesAddedSince(sinceAddIndex uint64) ([]Invoice, error) {
 	var startIndex [8]byte
 	byteOrder.PutUint64(startIndex[:], sinceAddIndex)
 
-	err := d.DB.View(func(tx *bbolt.Tx) error {
+	err := d.View(func(tx *bbolt.Tx) error {
 		invoices := tx.Bucket(invoiceBucket)
 		if invoices == nil {
 			return ErrNoInvoicesCreated
@@ -409,6 +484,61 @@ func (d *DB) LookupInvoice(paymentHash [32]byte) (Invoice, error) {
 	return invoice, nil
 }
 
+// LookupInvoiceState attempts to look up the invoice paying to the passed
+// payment hash, returning only its value, state and preimage. It's a cheaper
+// alternative to LookupInvoice for the HTLC handling path, as the remaining
+// fields of the invoice are skipped rather than decoded. If no such invoice
+// exists, ErrInvoiceNotFound is returned.
+func (d *DB) LookupInvoiceState(paymentHash [32]byte) (lnwire.MilliSatoshi,
+	ContractState, lntypes.Preimage, error) {
+
+	var (
+		amt      lnwire.MilliSatoshi
+		state    ContractState
+		preimage lntypes.Preimage
+	)
+	err := d.View(func(tx *bbolt.Tx) error {
+		invoices := tx.Bucket(invoiceBucket)
+		if invoices == nil {
+			return ErrNoInvoicesCreated
+		}
+		invoiceIndex := invoices.Bucket(invoiceIndexBucket)
+		if invoiceIndex == nil {
+			return ErrNoInvoicesCreated
+		}
+
+		invoiceNum := invoiceIndex.Get(paymentHash[:])
+		if invoiceNum == nil {
+			return ErrInvoiceNotFound
+		}
+		invoiceBytes := invoices.Get(invoiceNum)
+		if invoiceBytes == nil {
+			return ErrInvoiceNotFound
+		}
+
+		var err error
+		amt, state, preimage, err = deserializeInvoiceState(
+			invoiceBytes,
+		)
+		if err != nil {
+			return err
+		}
+
+		// Settled invoices no longer carry their preimage, which is
+		// instead stored under their payment hash.
+		if state == ContractSettled && preimage == UnknownPreimage {
+			preimage, err = fetchPreimage(tx, paymentHash)
+		}
+
+		return err
+	})
+	if err != nil {
+		return 0, 0, preimage, err
+	}
+
+	return amt, state, preimage, nil
+}
+
 // FetchAllInvoices returns all invoices currently stored within the database.
 // If the pendingOnly param is true, then only unsettled invoices will be
 // returned, skipping all invoices that are fully settled.
@@ -434,6 +564,9 @@ func (d *DB) FetchAllInvoices(pendingOnly bool) ([]Invoice, error) {
 			if err != nil {
 				return err
 			}
+			if err := resolvePreimage(tx, &invoice); err != nil {
+				return err
+			}
 
 			if pendingOnly &&
 				invoice.Terms.State == ContractSettled {
@@ -760,7 +893,7 @@ func (d *DB) InvoicesSettledSince(sinceSettleIndex uint64) ([]Invoice, error) {
 	var startIndex [8]byte
 	byteOrder.PutUint64(startIndex[:], sinceSettleIndex)
 
-	err := d.DB.View(func(tx *bbolt.Tx) error {
+	err := d.View(func(tx *bbolt.Tx) error {
 		invoices := tx.Bucket(invoiceBucket)
 		if invoices == nil {
 			return ErrNoInvoicesCreated
@@ -802,6 +935,293 @@ func (d *DB) InvoicesSettledSince(sinceSettleIndex uint64) ([]Invoice, error) {
 	return settledInvoices, nil
 }
 
+// RepairSettleIndex restores the consistency between the settle index and
+// the invoices it references. Entries within the settle index that point to
+// an invoice which doesn't exist, isn't settled, or doesn't carry the entry's
+// sequence number are removed. Afterwards, each settled invoice lacking a
+// valid entry is assigned a new settle index. The total number of repairs
+// made is returned.
+func (d *DB) RepairSettleIndex() (uint64, error) {
+	var numRepairs uint64
+	err := d.Update(func(tx *bbolt.Tx) error {
+		numRepairs = 0
+
+		invoices := tx.Bucket(invoiceBucket)
+		if invoices == nil {
+			return nil
+		}
+		settleIndex, err := invoices.CreateBucketIfNotExists(
+			settleIndexBucket,
+		)
+		if err != nil {
+			return err
+		}
+
+		// First, we'll gather all entries of the settle index that
+		// don't match the invoice they point to. As the bucket can't
+		// be modified while iterating, they're deleted afterwards.
+		var danglingEntries [][]byte
+		err = settleIndex.ForEach(func(seqNo, invoiceNum []byte) error {
+			invoiceBytes := invoices.Get(invoiceNum)
+			if invoiceBytes == nil {
+				danglingEntries = append(danglingEntries, seqNo)
+				return nil
+			}
+
+			invoice, err := deserializeInvoice(
+				bytes.NewReader(invoiceBytes),
+			)
+			if err != nil {
+				return err
+			}
+
+			if invoice.Terms.State != ContractSettled ||
+				invoice.SettleIndex != byteOrder.Uint64(seqNo) {
+
+				danglingEntries = append(danglingEntries, seqNo)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, seqNo := range danglingEntries {
+			if err := settleIndex.Delete(seqNo); err != nil {
+				return err
+			}
+			numRepairs++
+		}
+
+		// Next, we'll find all settled invoices which aren't
+		// referenced by the settle index under their settle index.
+		type unindexedInvoice struct {
+			invoiceNum []byte
+			invoice    Invoice
+		}
+		var unindexed []unindexedInvoice
+		err = invoices.ForEach(func(invoiceNum, v []byte) error {
+			if v == nil {
+				return nil
+			}
+
+			invoice, err := deserializeInvoice(bytes.NewReader(v))
+			if err != nil {
+				return err
+			}
+
+			if invoice.Terms.State != ContractSettled {
+				return nil
+			}
+
+			var seqNoBytes [8]byte
+			byteOrder.PutUint64(seqNoBytes[:], invoice.SettleIndex)
+			indexedNum := settleIndex.Get(seqNoBytes[:])
+			if invoice.SettleIndex != 0 &&
+				bytes.Equal(indexedNum, invoiceNum) {
+
+				return nil
+			}
+
+			unindexed = append(unindexed, unindexedInvoice{
+				invoiceNum: append([]byte(nil), invoiceNum...),
+				invoice:    invoice,
+			})
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Each of these invoices is assigned a fresh sequence number
+		// from the settle index, which is then written back to the
+		// invoice itself.
+		for _, u := range unindexed {
+			nextSettleSeqNo, err := settleIndex.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			var seqNoBytes [8]byte
+			byteOrder.PutUint64(seqNoBytes[:], nextSettleSeqNo)
+			err = settleIndex.Put(seqNoBytes[:], u.invoiceNum)
+			if err != nil {
+				return err
+			}
+
+			u.invoice.SettleIndex = nextSettleSeqNo
+
+			err = putInvoiceRecord(
+				invoices, u.invoiceNum, &u.invoice,
+			)
+			if err != nil {
+				return err
+			}
+
+			numRepairs++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return numRepairs, nil
+}
+
+// ReorderInvoiceAddIndex rebuilds the add index such that the order of the
+// add indexes of invoices matches the order of their creation dates, which may
+// differ after invoices were imported out of order. Invoices created at the
+// same time retain their relative order.
+//
+// NOTE: This invalidates all add index offsets previously handed out to
+// callers of InvoicesAddedSince. To ensure such callers never miss an invoice,
+// the new add indexes are allocated past all previously assigned ones, such
+// that resuming from a stale offset returns every invoice once more.
+func (d *DB) ReorderInvoiceAddIndex() error {
+	return d.Update(func(tx *bbolt.Tx) error {
+		invoices := tx.Bucket(invoiceBucket)
+		if invoices == nil {
+			return nil
+		}
+
+		type addEntry struct {
+			invoiceNum []byte
+			invoice    Invoice
+		}
+		var entries []addEntry
+		err := invoices.ForEach(func(invoiceNum, v []byte) error {
+			if v == nil {
+				return nil
+			}
+
+			invoice, err := deserializeInvoice(bytes.NewReader(v))
+			if err != nil {
+				return err
+			}
+
+			entries = append(entries, addEntry{
+				invoiceNum: append([]byte(nil), invoiceNum...),
+				invoice:    invoice,
+			})
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		sort.SliceStable(entries, func(i, j int) bool {
+			a, b := &entries[i].invoice, &entries[j].invoice
+			if !a.CreationDate.Equal(b.CreationDate) {
+				return a.CreationDate.Before(b.CreationDate)
+			}
+			return a.AddIndex < b.AddIndex
+		})
+
+		// The recreated index retains its sequence, so the new add
+		// indexes follow all of those handed out before.
+		addIndex, err := recreateBucket(invoices, addIndexBucket)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			nextAddSeqNo, err := addIndex.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			var seqNoBytes [8]byte
+			byteOrder.PutUint64(seqNoBytes[:], nextAddSeqNo)
+			err = addIndex.Put(seqNoBytes[:], e.invoiceNum)
+			if err != nil {
+				return err
+			}
+
+			e.invoice.AddIndex = nextAddSeqNo
+
+			err = putInvoiceRecord(
+				invoices, e.invoiceNum, &e.invoice,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ReindexInvoice moves the invoice stored under oldHash to newHash. If an
+// invoice paying to newHash already exists, ErrDuplicateInvoice is returned.
+// If the preimage of the invoice is known, it must hash to newHash.
+//
+// Only the payment hash index refers to an invoice by its hash. The add and
+// settle indexes, the offer and payment address indexes, as well as the
+// invoice record itself, refer to the invoice by its invoice number instead,
+// which is retained. The channel point index only covers the edges of the
+// channel graph, so it never refers to an invoice. As a result, the invoice
+// keeps its add and settle index, and the move is carried out atomically by
+// updating the payment hash index within a single transaction.
+//
+// The payment request stored along with the invoice commits to oldHash, so
+// it's cleared. If the invoice was stored with its PaymentRequestFields, a
+// request paying to newHash can be rebuilt by ReconstructPaymentRequest.
+func (d *DB) ReindexInvoice(oldHash, newHash [32]byte) error {
+	if oldHash == newHash {
+		return nil
+	}
+
+	return d.Update(func(tx *bbolt.Tx) error {
+		invoices := tx.Bucket(invoiceBucket)
+		if invoices == nil {
+			return ErrNoInvoicesCreated
+		}
+		invoiceIndex := invoices.Bucket(invoiceIndexBucket)
+		if invoiceIndex == nil {
+			return ErrNoInvoicesCreated
+		}
+
+		invoiceNum := invoiceIndex.Get(oldHash[:])
+		if invoiceNum == nil {
+			return ErrInvoiceNotFound
+		}
+		invoiceNum = append([]byte(nil), invoiceNum...)
+
+		if invoiceIndex.Get(newHash[:]) != nil {
+			return ErrDuplicateInvoice
+		}
+
+		invoice, err := fetchInvoice(invoiceNum, invoices)
+		if err != nil {
+			return err
+		}
+
+		preimage := invoice.Terms.PaymentPreimage
+		if preimage != UnknownPreimage && preimage.Hash() != newHash {
+			return ErrInvoicePreimageMismatch
+		}
+
+		if len(invoice.PaymentRequest) != 0 {
+			invoice.PaymentRequest = nil
+			err := putInvoiceRecord(invoices, invoiceNum, &invoice)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := invoiceIndex.Put(newHash[:], invoiceNum); err != nil {
+			return err
+		}
+
+		return invoiceIndex.Delete(oldHash[:])
+	})
+}
+
 func putInvoice(invoices, invoiceIndex, addIndex *bbolt.Bucket,
 	i *Invoice, invoiceNum uint32, paymentHash lntypes.Hash) (
 	uint64, error) {
@@ -847,13 +1267,17 @@ func putInvoice(invoices, invoiceIndex, addIndex *bbolt.Bucket,
 
 	i.AddIndex = nextAddSeqNo
 
-	// Finally, serialize the invoice itself to be written to the disk.
-	var buf bytes.Buffer
-	if err := serializeInvoice(&buf, i); err != nil {
-		return 0, nil
+	err = putOfferInvoiceIndex(invoices.Tx(), i, invoiceKey[:])
+	if err != nil {
+		return 0, err
+	}
+	err = putPaymentAddrIndex(invoices.Tx(), i, invoiceKey[:])
+	if err != nil {
+		return 0, err
 	}
 
-	if err := invoices.Put(invoiceKey[:], buf.Bytes()); err != nil {
+	// Finally, serialize the invoice itself to be written to the disk.
+	if err := putInvoiceRecord(invoices, invoiceKey[:], i); err != nil {
 		return 0, err
 	}
 
@@ -913,7 +1337,60 @@ func serializeInvoice(w io.Writer, i *Invoice) error {
 		return err
 	}
 
-	return nil
+	// Finally, we'll write out the TLV stream which houses all the
+	// optional records of the invoice.
+	records, err := invoiceRecords(i)
+	if err != nil {
+		return err
+	}
+
+	return writeTLVStream(w, records)
+}
+
+// invoiceRecords returns the full set of TLV records that should be written
+// for the passed invoice.
+func invoiceRecords(i *Invoice) (map[uint64][]byte, error) {
+	records := make(map[uint64][]byte, len(i.CustomRecords)+8)
+	for typ, value := range i.CustomRecords {
+		records[typ] = value
+	}
+
+	if i.FiatAmount != nil {
+		records[fiatAmountType] = encodeFiatAmount(i.FiatAmount)
+	}
+	if i.ExchangeRate != 0 {
+		records[exchangeRateType] = encodeExchangeRate(i.ExchangeRate)
+	}
+	if i.preimageRef != nil {
+		records[preimageRefType] = encodePreimageRef(i.preimageRef)
+	}
+	if i.HtlcAttempted {
+		records[htlcAttemptedType] = []byte{1}
+	}
+	if len(i.RouteHints) != 0 {
+		value, err := encodeRouteHints(i.RouteHints)
+		if err != nil {
+			return nil, err
+		}
+		records[routeHintsType] = value
+	}
+	if i.OfferID != ([32]byte{}) {
+		offerID := i.OfferID
+		records[offerIDType] = offerID[:]
+	}
+	if i.PaymentAddr != ([32]byte{}) {
+		paymentAddr := i.PaymentAddr
+		records[paymentAddrType] = paymentAddr[:]
+	}
+	if i.PaymentRequestFields != nil {
+		value, err := encodePaymentRequestFields(i.PaymentRequestFields)
+		if err != nil {
+			return nil, err
+		}
+		records[paymentRequestFieldsType] = value
+	}
+
+	return records, nil
 }
 
 func fetchInvoice(invoiceNum []byte, invoices *bbolt.Bucket) (Invoice, error) {
@@ -923,8 +1400,16 @@ func fetchInvoice(invoiceNum []byte, invoices *bbolt.Bucket) (Invoice, error) {
 	}
 
 	invoiceReader := bytes.NewReader(invoiceBytes)
+	invoice, err := deserializeInvoice(invoiceReader)
+	if err != nil {
+		return invoice, err
+	}
+
+	// The preimage of a settled invoice is stored separately, so we'll
+	// fetch it to return the invoice in full.
+	err = resolvePreimage(invoices.Tx(), &invoice)
 
-	return deserializeInvoice(invoiceReader)
+	return invoice, err
 }
 
 func deserializeInvoice(r io.Reader) (Invoice, error) {
@@ -985,9 +1470,125 @@ func deserializeInvoice(r io.Reader) (Invoice, error) {
 		return invoice, err
 	}
 
+	records, err := readTLVStream(r)
+	if err != nil {
+		return invoice, err
+	}
+	for typ, value := range records {
+		switch {
+		case typ == fiatAmountType:
+			invoice.FiatAmount, err = decodeFiatAmount(value)
+			if err != nil {
+				return invoice, err
+			}
+			continue
+
+		case typ == exchangeRateType:
+			invoice.ExchangeRate, err = decodeExchangeRate(value)
+			if err != nil {
+				return invoice, err
+			}
+			continue
+
+		case typ == preimageRefType:
+			invoice.preimageRef, err = decodePreimageRef(value)
+			if err != nil {
+				return invoice, err
+			}
+			continue
+
+		case typ == htlcAttemptedType:
+			invoice.HtlcAttempted, err = decodeHtlcAttempted(value)
+			if err != nil {
+				return invoice, err
+			}
+			continue
+
+		case typ == routeHintsType:
+			invoice.RouteHints, err = decodeRouteHints(value)
+			if err != nil {
+				return invoice, err
+			}
+			continue
+
+		case typ == offerIDType:
+			invoice.OfferID, err = decodeOfferID(value)
+			if err != nil {
+				return invoice, err
+			}
+			continue
+
+		case typ == paymentAddrType:
+			invoice.PaymentAddr, err = decodePaymentAddr(value)
+			if err != nil {
+				return invoice, err
+			}
+			continue
+
+		case typ == paymentRequestFieldsType:
+			fields, err := decodePaymentRequestFields(value)
+			if err != nil {
+				return invoice, err
+			}
+			invoice.PaymentRequestFields = fields
+			continue
+
+		case typ < CustomTypeStart:
+			return invoice, fmt.Errorf("unknown invoice record "+
+				"type %v", typ)
+		}
+
+		if invoice.CustomRecords == nil {
+			invoice.CustomRecords = make(map[uint64][]byte)
+		}
+		invoice.CustomRecords[typ] = value
+	}
+
 	return invoice, nil
 }
 
+// deserializeInvoiceState decodes the value, state and preimage of a
+// serialized invoice. As the fields preceding them are all of variable
+// length, we'll skip over them one by one.
+func deserializeInvoiceState(invoiceBytes []byte) (lnwire.MilliSatoshi,
+	ContractState, lntypes.Preimage, error) {
+
+	var preimage lntypes.Preimage
+	r := bytes.NewReader(invoiceBytes)
+
+	// The memo, receipt, payment request, creation date and settle date
+	// are all prefixed by their length.
+	for i := 0; i < 5; i++ {
+		length, err := wire.ReadVarInt(r, 0)
+		if err != nil {
+			return 0, 0, preimage, err
+		}
+		if length > uint64(r.Len()) {
+			return 0, 0, preimage, io.ErrUnexpectedEOF
+		}
+		if _, err := r.Seek(int64(length), io.SeekCurrent); err != nil {
+			return 0, 0, preimage, err
+		}
+	}
+
+	if _, err := io.ReadFull(r, preimage[:]); err != nil {
+		return 0, 0, preimage, err
+	}
+
+	var scratch [8]byte
+	if _, err := io.ReadFull(r, scratch[:]); err != nil {
+		return 0, 0, preimage, err
+	}
+	amt := lnwire.MilliSatoshi(byteOrder.Uint64(scratch[:]))
+
+	var state ContractState
+	if err := binary.Read(r, byteOrder, &state); err != nil {
+		return 0, 0, preimage, err
+	}
+
+	return amt, state, preimage, nil
+}
+
 func acceptOrSettleInvoice(invoices, settleIndex *bbolt.Bucket, invoiceNum []byte,
 	amtPaid lnwire.MilliSatoshi) (*Invoice, error) {
 
@@ -1018,13 +1619,9 @@ func acceptOrSettleInvoice(invoices, settleIndex *bbolt.Bucket, invoiceNum []byt
 	}
 
 	invoice.AmtPaid = amtPaid
+	invoice.HtlcAttempted = true
 
-	var buf bytes.Buffer
-	if err := serializeInvoice(&buf, &invoice); err != nil {
-		return nil, err
-	}
-
-	if err := invoices.Put(invoiceNum[:], buf.Bytes()); err != nil {
+	if err := putInvoiceRecord(invoices, invoiceNum, &invoice); err != nil {
 		return nil, err
 	}
 
@@ -1080,12 +1677,7 @@ func settleHoldInvoice(invoices, settleIndex *bbolt.Bucket,
 		return nil, err
 	}
 
-	var buf bytes.Buffer
-	if err := serializeInvoice(&buf, &invoice); err != nil {
-		return nil, err
-	}
-
-	if err := invoices.Put(invoiceNum[:], buf.Bytes()); err != nil {
+	if err := putInvoiceRecord(invoices, invoiceNum, &invoice); err != nil {
 		return nil, err
 	}
 
@@ -1112,12 +1704,7 @@ func cancelInvoice(invoices *bbolt.Bucket, invoiceNum []byte) (
 	// Set AmtPaid back to 0, in case the invoice was already accepted.
 	invoice.AmtPaid = 0
 
-	var buf bytes.Buffer
-	if err := serializeInvoice(&buf, &invoice); err != nil {
-		return nil, err
-	}
-
-	if err := invoices.Put(invoiceNum[:], buf.Bytes()); err != nil {
+	if err := putInvoiceRecord(invoices, invoiceNum, &invoice); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,187 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// jammingStatsBucket is the top-level bucket that stores the outcomes
+	// of the HTLCs forwarded over each channel. Each channel has its own
+	// sub-bucket, which holds an entry per HTLC keyed by the time it was
+	// resolved, followed by a sequence number to keep HTLCs resolved at
+	// the same time apart. The value is the outcome of the HTLC.
+	//
+	// maps: chanID => resolveTime || seqNo => htlcOutcome
+	jammingStatsBucket = []byte("jamming-stats")
+
+	// ErrUnknownHTLCOutcome is returned when recording an HTLC outcome of
+	// an unknown kind.
+	ErrUnknownHTLCOutcome = fmt.Errorf("unknown htlc outcome")
+
+	// ErrJammingWindowTooLarge is returned when the jamming score of a
+	// channel is queried over a window exceeding MaxJammingWindow.
+	ErrJammingWindowTooLarge = fmt.Errorf("jamming window exceeds max "+
+		"of %v", MaxJammingWindow)
+)
+
+const (
+	// MaxJammingWindow is the largest window over which the jamming score
+	// of a channel can be queried. Outcomes recorded before this are
+	// trimmed as new ones are recorded.
+	MaxJammingWindow = 7 * 24 * time.Hour
+)
+
+// HTLCOutcome is the way an HTLC added to a channel was resolved.
+type HTLCOutcome uint8
+
+const (
+	// HTLCSettled denotes an HTLC that was settled.
+	HTLCSettled HTLCOutcome = 0
+
+	// HTLCFailed denotes an HTLC that was failed back.
+	HTLCFailed HTLCOutcome = 1
+
+	// HTLCExpired denotes an HTLC that was held until it expired.
+	HTLCExpired HTLCOutcome = 2
+)
+
+// String returns a human readable identifier for the HTLCOutcome type.
+func (o HTLCOutcome) String() string {
+	switch o {
+	case HTLCSettled:
+		return "Settled"
+	case HTLCFailed:
+		return "Failed"
+	case HTLCExpired:
+		return "Expired"
+	}
+
+	return "Unknown"
+}
+
+// RecordHTLCOutcome records the outcome of an HTLC added to the channel, as
+// resolved at the passed time. Any outcomes recorded for the channel that
+// have fallen out of MaxJammingWindow are trimmed along the way.
+func (d *DB) RecordHTLCOutcome(chanID uint64, outcome HTLCOutcome,
+	t time.Time) error {
+
+	if outcome > HTLCExpired {
+		return ErrUnknownHTLCOutcome
+	}
+
+	return d.Batch(func(tx *bbolt.Tx) error {
+		stats, err := tx.CreateBucketIfNotExists(jammingStatsBucket)
+		if err != nil {
+			return err
+		}
+
+		var chanKey [8]byte
+		byteOrder.PutUint64(chanKey[:], chanID)
+		outcomes, err := stats.CreateBucketIfNotExists(chanKey[:])
+		if err != nil {
+			return err
+		}
+
+		seqNo, err := outcomes.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		var outcomeKey [16]byte
+		byteOrder.PutUint64(outcomeKey[:8], uint64(t.UnixNano()))
+		byteOrder.PutUint64(outcomeKey[8:], seqNo)
+		err = outcomes.Put(outcomeKey[:], []byte{byte(outcome)})
+		if err != nil {
+			return err
+		}
+
+		return trimTimeSeries(outcomes, t.Add(-MaxJammingWindow))
+	})
+}
+
+// JammingScore returns the ratio of HTLCs that were failed or expired to
+// those that were settled over the channel within the window preceding now.
+// A high score hints at a peer jamming the channel with HTLCs it never
+// intends to settle. The score is zero if no HTLC failed or expired, and
+// infinite if some did while none were settled. The window may not exceed
+// MaxJammingWindow.
+func (d *DB) JammingScore(chanID uint64, window time.Duration,
+	now time.Time) (float64, error) {
+
+	if window > MaxJammingWindow {
+		return 0, ErrJammingWindowTooLarge
+	}
+
+	var numSettled, numFailed uint64
+	err := d.View(func(tx *bbolt.Tx) error {
+		stats := tx.Bucket(jammingStatsBucket)
+		if stats == nil {
+			return nil
+		}
+
+		var chanKey [8]byte
+		byteOrder.PutUint64(chanKey[:], chanID)
+		outcomes := stats.Bucket(chanKey[:])
+		if outcomes == nil {
+			return nil
+		}
+
+		var start, end [8]byte
+		startTime := now.Add(-window)
+		byteOrder.PutUint64(start[:], uint64(startTime.UnixNano()))
+		byteOrder.PutUint64(end[:], uint64(now.UnixNano()))
+
+		c := outcomes.Cursor()
+		for k, v := c.Seek(start[:]); k != nil &&
+			bytes.Compare(k[:8], end[:]) <= 0; k, v = c.Next() {
+
+			if len(v) != 1 {
+				return fmt.Errorf("invalid htlc outcome entry "+
+					"%x", k)
+			}
+
+			if HTLCOutcome(v[0]) == HTLCSettled {
+				numSettled++
+			} else {
+				numFailed++
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case numSettled != 0:
+		return float64(numFailed) / float64(numSettled), nil
+	case numFailed != 0:
+		return math.Inf(1), nil
+	default:
+		return 0, nil
+	}
+}
+
+// deleteJammingStatsOnClose removes the HTLC outcomes recorded for a closed
+// channel.
+func deleteJammingStatsOnClose(tx *bbolt.Tx, channel *OpenChannel) error {
+	stats := tx.Bucket(jammingStatsBucket)
+	if stats == nil {
+		return nil
+	}
+
+	var chanKey [8]byte
+	byteOrder.PutUint64(chanKey[:], channel.ShortChannelID.ToUint64())
+	err := stats.DeleteBucket(chanKey[:])
+	if err != nil && err != bbolt.ErrBucketNotFound {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package channeldb
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestJammingScore asserts that the jamming score of a channel reflects the
+// ratio of failed and expired HTLCs to settled ones within the queried
+// window, and that outcomes falling out of the max window are trimmed.
+func TestJammingScore(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+
+	const chanID = 1234
+	now := time.Unix(1500000000, 0)
+
+	assertScore := func(window time.Duration, at time.Time,
+		expected float64) {
+
+		t.Helper()
+
+		score, err := db.JammingScore(chanID, window, at)
+		if err != nil {
+			t.Fatalf("unable to fetch jamming score: %v", err)
+		}
+		if score != expected {
+			t.Fatalf("expected score %v, got %v", expected, score)
+		}
+	}
+
+	record := func(outcome HTLCOutcome, at time.Time) {
+		t.Helper()
+
+		err := db.RecordHTLCOutcome(chanID, outcome, at)
+		if err != nil {
+			t.Fatalf("unable to record htlc outcome: %v", err)
+		}
+	}
+
+	assertScore(time.Hour, now, 0)
+
+	// A failed HTLC without any settled ones yields an infinite score.
+	record(HTLCFailed, now)
+	assertScore(time.Hour, now, math.Inf(1))
+
+	// With an expired HTLC and two settled ones a minute later, two out
+	// of the three HTLCs within the window were not settled.
+	later := now.Add(time.Minute)
+	record(HTLCExpired, later)
+	record(HTLCSettled, later)
+	record(HTLCSettled, later)
+	assertScore(time.Hour, later, 1)
+	assertScore(time.Second, later, 0.5)
+
+	// Another channel shouldn't be affected by these outcomes.
+	score, err := db.JammingScore(chanID+1, time.Hour, later)
+	if err != nil {
+		t.Fatalf("unable to fetch jamming score: %v", err)
+	}
+	if score != 0 {
+		t.Fatalf("expected score 0 for other channel, got %v", score)
+	}
+
+	// Recording an outcome once the max window has passed should trim
+	// the outcomes recorded before it.
+	last := now.Add(MaxJammingWindow + 30*time.Second)
+	record(HTLCSettled, last)
+	assertScore(MaxJammingWindow, last, 1.0/3)
+
+	// Unknown outcomes and windows exceeding the max should be rejected.
+	err = db.RecordHTLCOutcome(chanID, HTLCExpired+1, now)
+	if err != ErrUnknownHTLCOutcome {
+		t.Fatalf("expected ErrUnknownHTLCOutcome, got %v", err)
+	}
+	_, err = db.JammingScore(chanID, MaxJammingWindow+1, now)
+	if err != ErrJammingWindowTooLarge {
+		t.Fatalf("expected ErrJammingWindowTooLarge, got %v", err)
+	}
+}
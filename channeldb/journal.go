@@ -0,0 +1,448 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// journalBucket is the top-level bucket that houses the intent of all
+	// journaled operations that haven't yet been applied. Once the steps
+	// of a journal have been committed, its entry is removed.
+	//
+	// maps: journalID => serialized journal
+	journalBucket = []byte("journal")
+
+	// ErrEmptyJournal is returned when attempting to journal an operation
+	// without any steps.
+	ErrEmptyJournal = fmt.Errorf("journal has no steps")
+
+	// ErrJournalTooLarge is returned when attempting to journal an
+	// operation with more than maxJournalSteps steps, or with a step whose
+	// bucket path, key, value or prior value exceeds the limits a journal
+	// is read back with.
+	ErrJournalTooLarge = fmt.Errorf("journal exceeds max size")
+
+	// ErrJournalConflict is returned when the keys targeted by a journal
+	// were modified by another writer after the journal was recorded, in
+	// which case it's discarded without applying any of its steps.
+	ErrJournalConflict = fmt.Errorf("keys targeted by journal were " +
+		"modified since it was recorded")
+)
+
+const (
+	// maxJournalElementSize is the maximum size of a single bucket name,
+	// key or value within a serialized journal step.
+	maxJournalElementSize = 1 << 20
+
+	// maxJournalSteps is the maximum number of steps of a single journal.
+	maxJournalSteps = 1 << 16
+
+	// maxJournalBuckets is the maximum number of buckets along the path of
+	// a single journal step.
+	maxJournalBuckets = math.MaxUint16
+)
+
+// JournalStep is a single mutation of a key within the database, which is
+// applied as part of a journaled operation.
+type JournalStep struct {
+	// Buckets is the path of nested buckets, starting at the root of the
+	// database, that houses Key. Any buckets along the path that don't yet
+	// exist are created when the step is applied.
+	Buckets [][]byte
+
+	// Key is the key targeted by this step.
+	Key []byte
+
+	// Value is the new value of Key. If nil, the key is deleted instead.
+	Value []byte
+
+	// prior is the value of Key at the time the journal was recorded, or
+	// nil if the key didn't exist.
+	prior []byte
+}
+
+// Journal applies the given steps as a single crash-consistent operation. The
+// intent to apply the steps is first durably recorded within the journal,
+// along with the prior value of every key they modify. Afterwards, all steps
+// are applied within a single transaction which also clears the journal
+// entry. Should we crash before the steps are committed, the operation is
+// completed on the next startup by RecoverJournal.
+//
+// Another writer may modify the targeted keys between the two transactions.
+// Just like on recovery, the steps are then discarded rather than overwriting
+// the newer state, and ErrJournalConflict is returned.
+//
+// A journal may have at most maxJournalSteps steps, and each bucket name, key
+// and value may be at most maxJournalElementSize bytes, as do the values the
+// steps replace. Larger journals are rejected with ErrJournalTooLarge before
+// anything is recorded, as they couldn't be read back on recovery.
+func (d *DB) Journal(steps []JournalStep) error {
+	if len(steps) == 0 {
+		return ErrEmptyJournal
+	}
+	if len(steps) > maxJournalSteps {
+		return ErrJournalTooLarge
+	}
+	for _, step := range steps {
+		if len(step.Buckets) == 0 || len(step.Key) == 0 {
+			return fmt.Errorf("journal step must specify a bucket " +
+				"path and key")
+		}
+		if err := validateJournalStep(&step); err != nil {
+			return err
+		}
+	}
+
+	// First, we'll record our intent, along with the current value of
+	// each of the keys we're about to modify. We copy the steps to avoid
+	// mutating the caller's slice.
+	steps = append([]JournalStep(nil), steps...)
+
+	var journalID []byte
+	err := d.Update(func(tx *bbolt.Tx) error {
+		var err error
+		journalID, err = recordJournal(tx, steps)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// With the intent recorded, we can now apply all steps and clear the
+	// journal entry atomically.
+	return d.applyRecordedJournal(journalID, steps)
+}
+
+// applyRecordedJournal applies the steps of the recorded journal identified by
+// journalID and clears its entry, unless the keys they target have been
+// modified since the journal was recorded, in which case the entry is
+// discarded and ErrJournalConflict is returned.
+func (d *DB) applyRecordedJournal(journalID []byte, steps []JournalStep) error {
+	var conflict bool
+	err := d.Update(func(tx *bbolt.Tx) error {
+		conflict = !journalPriorsHeld(tx, steps)
+		if conflict {
+			return discardJournal(tx, journalID)
+		}
+
+		return applyJournal(tx, journalID, steps)
+	})
+	if err != nil {
+		return err
+	}
+	if conflict {
+		return ErrJournalConflict
+	}
+
+	return nil
+}
+
+// RecoverJournal completes any journaled operations whose steps weren't
+// committed, e.g. due to a crash. As the steps of a journal are always
+// committed atomically, an incomplete journal never has any of its steps
+// applied. If all keys it targets still hold the values recorded along with
+// the journal, the journal is replayed. Otherwise, the keys have since been
+// modified by another writer, in which case the journal is rolled back by
+// discarding it, as replaying it would overwrite the newer state.
+//
+// NOTE: This is called when opening the database, and should only be called
+// before the database is used concurrently.
+func (d *DB) RecoverJournal() error {
+	return d.Update(func(tx *bbolt.Tx) error {
+		journal := tx.Bucket(journalBucket)
+		if journal == nil {
+			return nil
+		}
+
+		// We'll gather all journal entries first, as they're removed
+		// while being recovered.
+		type pendingJournal struct {
+			id    []byte
+			steps []JournalStep
+		}
+		var pending []pendingJournal
+		err := journal.ForEach(func(k, v []byte) error {
+			steps, err := deserializeJournal(bytes.NewReader(v))
+			if err != nil {
+				return err
+			}
+
+			pending = append(pending, pendingJournal{
+				id:    append([]byte(nil), k...),
+				steps: steps,
+			})
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, p := range pending {
+			if !journalPriorsHeld(tx, p.steps) {
+				log.Warnf("Rolling back journal %x, targeted keys "+
+					"were modified since it was recorded", p.id)
+
+				if err := discardJournal(tx, p.id); err != nil {
+					return err
+				}
+				continue
+			}
+
+			log.Infof("Replaying journal %x with %v steps", p.id,
+				len(p.steps))
+
+			if err := applyJournal(tx, p.id, p.steps); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// recordJournal stores the given steps within the journal bucket, along with
+// the current value of each key they target. The ID of the new journal entry
+// is returned.
+func recordJournal(tx *bbolt.Tx, steps []JournalStep) ([]byte, error) {
+	for i := range steps {
+		steps[i].prior = fetchJournalKey(tx, &steps[i])
+		if len(steps[i].prior) > maxJournalElementSize {
+			return nil, ErrJournalTooLarge
+		}
+	}
+
+	journal, err := tx.CreateBucketIfNotExists(journalBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	seqNo, err := journal.NextSequence()
+	if err != nil {
+		return nil, err
+	}
+
+	var journalID [8]byte
+	byteOrder.PutUint64(journalID[:], seqNo)
+
+	var b bytes.Buffer
+	if err := serializeJournal(&b, steps); err != nil {
+		return nil, err
+	}
+
+	if err := journal.Put(journalID[:], b.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return journalID[:], nil
+}
+
+// validateJournalStep ensures the bucket path, key and value of the step stay
+// within the limits a journal is read back with.
+func validateJournalStep(step *JournalStep) error {
+	if len(step.Buckets) > maxJournalBuckets ||
+		len(step.Key) > maxJournalElementSize ||
+		len(step.Value) > maxJournalElementSize {
+
+		return ErrJournalTooLarge
+	}
+	for _, name := range step.Buckets {
+		if len(name) > maxJournalElementSize {
+			return ErrJournalTooLarge
+		}
+	}
+
+	return nil
+}
+
+// fetchJournalKey returns the current value of the key targeted by the step,
+// or nil if either the key or any of its parent buckets don't exist.
+func fetchJournalKey(tx *bbolt.Tx, step *JournalStep) []byte {
+	bucket := tx.Bucket(step.Buckets[0])
+	for _, name := range step.Buckets[1:] {
+		if bucket == nil {
+			return nil
+		}
+		bucket = bucket.Bucket(name)
+	}
+	if bucket == nil {
+		return nil
+	}
+
+	value := bucket.Get(step.Key)
+	if value == nil {
+		return nil
+	}
+
+	return append([]byte(nil), value...)
+}
+
+// journalPriorsHeld returns whether all keys targeted by the steps still hold
+// the values recorded along with their journal.
+func journalPriorsHeld(tx *bbolt.Tx, steps []JournalStep) bool {
+	for i := range steps {
+		current := fetchJournalKey(tx, &steps[i])
+		if !bytes.Equal(current, steps[i].prior) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// discardJournal removes the entry of the journal identified by journalID
+// without applying any of its steps.
+func discardJournal(tx *bbolt.Tx, journalID []byte) error {
+	journal := tx.Bucket(journalBucket)
+	if journal == nil {
+		return nil
+	}
+
+	return journal.Delete(journalID)
+}
+
+// applyJournal applies all steps of the journal identified by journalID, and
+// removes its entry from the journal bucket.
+func applyJournal(tx *bbolt.Tx, journalID []byte, steps []JournalStep) error {
+	for i := range steps {
+		if err := applyJournalStep(tx, &steps[i]); err != nil {
+			return err
+		}
+	}
+
+	return discardJournal(tx, journalID)
+}
+
+// applyJournalStep applies a single step, creating any buckets along its path
+// that don't yet exist.
+func applyJournalStep(tx *bbolt.Tx, step *JournalStep) error {
+	bucket, err := tx.CreateBucketIfNotExists(step.Buckets[0])
+	if err != nil {
+		return err
+	}
+	for _, name := range step.Buckets[1:] {
+		bucket, err = bucket.CreateBucketIfNotExists(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	if step.Value == nil {
+		return bucket.Delete(step.Key)
+	}
+
+	return bucket.Put(step.Key, step.Value)
+}
+
+// writeOptionalBytes writes a flag indicating whether b is non-nil, followed
+// by b itself if so. This allows nil values to be distinguished from empty
+// ones.
+func writeOptionalBytes(w io.Writer, b []byte) error {
+	if err := WriteElement(w, b != nil); err != nil {
+		return err
+	}
+	if b == nil {
+		return nil
+	}
+
+	return wire.WriteVarBytes(w, 0, b)
+}
+
+// readOptionalBytes reads a byte slice written by writeOptionalBytes.
+func readOptionalBytes(r io.Reader) ([]byte, error) {
+	var present bool
+	if err := ReadElement(r, &present); err != nil {
+		return nil, err
+	}
+	if !present {
+		return nil, nil
+	}
+
+	return wire.ReadVarBytes(r, 0, maxJournalElementSize, "journal")
+}
+
+func serializeJournal(w io.Writer, steps []JournalStep) error {
+	if err := WriteElement(w, uint32(len(steps))); err != nil {
+		return err
+	}
+
+	for _, step := range steps {
+		numBuckets := uint16(len(step.Buckets))
+		if err := WriteElement(w, numBuckets); err != nil {
+			return err
+		}
+		for _, name := range step.Buckets {
+			if err := wire.WriteVarBytes(w, 0, name); err != nil {
+				return err
+			}
+		}
+
+		if err := wire.WriteVarBytes(w, 0, step.Key); err != nil {
+			return err
+		}
+		if err := writeOptionalBytes(w, step.Value); err != nil {
+			return err
+		}
+		if err := writeOptionalBytes(w, step.prior); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func deserializeJournal(r io.Reader) ([]JournalStep, error) {
+	var numSteps uint32
+	if err := ReadElement(r, &numSteps); err != nil {
+		return nil, err
+	}
+	if numSteps > maxJournalSteps {
+		return nil, fmt.Errorf("journal of %v steps exceeds max of %v",
+			numSteps, maxJournalSteps)
+	}
+
+	steps := make([]JournalStep, numSteps)
+	for i := range steps {
+		var numBuckets uint16
+		if err := ReadElement(r, &numBuckets); err != nil {
+			return nil, err
+		}
+		if numBuckets == 0 {
+			return nil, fmt.Errorf("journal step has no buckets")
+		}
+
+		steps[i].Buckets = make([][]byte, numBuckets)
+		for j := range steps[i].Buckets {
+			name, err := wire.ReadVarBytes(
+				r, 0, maxJournalElementSize, "bucket",
+			)
+			if err != nil {
+				return nil, err
+			}
+			steps[i].Buckets[j] = name
+		}
+
+		key, err := wire.ReadVarBytes(r, 0, maxJournalElementSize, "key")
+		if err != nil {
+			return nil, err
+		}
+		steps[i].Key = key
+
+		steps[i].Value, err = readOptionalBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		steps[i].prior, err = readOptionalBytes(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return steps, nil
+}
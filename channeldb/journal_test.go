@@ -0,0 +1,302 @@
+package channeldb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/coreos/bbolt"
+)
+
+var (
+	testJournalBucket = []byte("test-journal-bucket")
+	testJournalNested = []byte("test-journal-nested")
+)
+
+// fetchTestJournalKey returns the current value of key within the nested test
+// bucket.
+func fetchTestJournalKey(t *testing.T, db *DB, key []byte) []byte {
+	t.Helper()
+
+	var value []byte
+	err := db.View(func(tx *bbolt.Tx) error {
+		value = fetchJournalKey(tx, &JournalStep{
+			Buckets: [][]byte{testJournalBucket, testJournalNested},
+			Key:     key,
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to fetch key: %v", err)
+	}
+
+	return value
+}
+
+// assertJournalEmpty asserts that no journal entries remain.
+func assertJournalEmpty(t *testing.T, db *DB) {
+	t.Helper()
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		journal := tx.Bucket(journalBucket)
+		if journal == nil {
+			return nil
+		}
+
+		k, _ := journal.Cursor().First()
+		if k != nil {
+			t.Fatalf("expected empty journal, found entry %x", k)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to read journal: %v", err)
+	}
+}
+
+// TestJournal asserts that all steps of a journal are applied, and that the
+// journal is cleared afterwards.
+func TestJournal(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	path := [][]byte{testJournalBucket, testJournalNested}
+	steps := []JournalStep{
+		{Buckets: path, Key: []byte("a"), Value: []byte("1")},
+		{Buckets: path, Key: []byte("b"), Value: []byte("2")},
+	}
+	if err := db.Journal(steps); err != nil {
+		t.Fatalf("unable to apply journal: %v", err)
+	}
+
+	// A second journal deletes one key and overwrites the other.
+	steps = []JournalStep{
+		{Buckets: path, Key: []byte("a")},
+		{Buckets: path, Key: []byte("b"), Value: []byte("3")},
+	}
+	if err := db.Journal(steps); err != nil {
+		t.Fatalf("unable to apply journal: %v", err)
+	}
+
+	if value := fetchTestJournalKey(t, db, []byte("a")); value != nil {
+		t.Fatalf("expected key to be deleted, found %x", value)
+	}
+	value := fetchTestJournalKey(t, db, []byte("b"))
+	if !bytes.Equal(value, []byte("3")) {
+		t.Fatalf("expected value %x, got %x", []byte("3"), value)
+	}
+	assertJournalEmpty(t, db)
+
+	if err := db.Journal(nil); err != ErrEmptyJournal {
+		t.Fatalf("expected ErrEmptyJournal, got %v", err)
+	}
+}
+
+// TestRecoverJournal asserts that journals whose steps weren't committed are
+// replayed on startup, unless the keys they target were modified in the
+// meantime, in which case they're rolled back.
+func TestRecoverJournal(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	path := [][]byte{testJournalBucket, testJournalNested}
+	err = db.Journal([]JournalStep{
+		{Buckets: path, Key: []byte("b"), Value: []byte("1")},
+	})
+	if err != nil {
+		t.Fatalf("unable to apply journal: %v", err)
+	}
+
+	// We'll simulate a crash by only recording the intent of two
+	// journals, without applying their steps.
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := recordJournal(tx, []JournalStep{
+			{Buckets: path, Key: []byte("a"), Value: []byte("2")},
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = recordJournal(tx, []JournalStep{
+			{Buckets: path, Key: []byte("b"), Value: []byte("3")},
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unable to record journals: %v", err)
+	}
+
+	// Before recovering, we'll modify the key targeted by the second
+	// journal, which should cause it to be rolled back.
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(testJournalBucket).Bucket(testJournalNested)
+		return bucket.Put([]byte("b"), []byte("4"))
+	})
+	if err != nil {
+		t.Fatalf("unable to modify key: %v", err)
+	}
+
+	// Reopening the database should recover both journals.
+	dbPath := db.Path()
+	db.Close()
+	db, err = Open(dbPath)
+	if err != nil {
+		t.Fatalf("unable to reopen db: %v", err)
+	}
+	defer db.Close()
+
+	value := fetchTestJournalKey(t, db, []byte("a"))
+	if !bytes.Equal(value, []byte("2")) {
+		t.Fatalf("expected replayed value %x, got %x", []byte("2"),
+			value)
+	}
+	value = fetchTestJournalKey(t, db, []byte("b"))
+	if !bytes.Equal(value, []byte("4")) {
+		t.Fatalf("expected value %x to be retained, got %x",
+			[]byte("4"), value)
+	}
+	assertJournalEmpty(t, db)
+}
+
+// TestJournalConflict asserts that a journal whose targeted keys are modified
+// by another writer after its intent is recorded is discarded rather than
+// overwriting the newer state.
+func TestJournalConflict(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	path := [][]byte{testJournalBucket, testJournalNested}
+	steps := []JournalStep{
+		{Buckets: path, Key: []byte("a"), Value: []byte("1")},
+		{Buckets: path, Key: []byte("b"), Value: []byte("2")},
+	}
+
+	// We'll record the intent of the journal, and modify one of its keys
+	// before its steps are applied.
+	var journalID []byte
+	err = db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		journalID, err = recordJournal(tx, steps)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unable to record journal: %v", err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(testJournalBucket)
+		if err != nil {
+			return err
+		}
+		bucket, err = bucket.CreateBucketIfNotExists(testJournalNested)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte("b"), []byte("3"))
+	})
+	if err != nil {
+		t.Fatalf("unable to modify key: %v", err)
+	}
+
+	err = db.applyRecordedJournal(journalID, steps)
+	if err != ErrJournalConflict {
+		t.Fatalf("expected ErrJournalConflict, got %v", err)
+	}
+
+	// None of the steps should have been applied, and the journal should
+	// have been discarded.
+	if value := fetchTestJournalKey(t, db, []byte("a")); value != nil {
+		t.Fatalf("expected key to be absent, found %x", value)
+	}
+	value := fetchTestJournalKey(t, db, []byte("b"))
+	if !bytes.Equal(value, []byte("3")) {
+		t.Fatalf("expected value %x to be retained, got %x",
+			[]byte("3"), value)
+	}
+	assertJournalEmpty(t, db)
+}
+
+// TestJournalLimits asserts that journals that couldn't be read back on
+// recovery are rejected before anything is recorded, and that a corrupted
+// journal entry doesn't cause its steps to be allocated.
+func TestJournalLimits(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	path := [][]byte{testJournalBucket, testJournalNested}
+	oversized := make([]byte, maxJournalElementSize+1)
+
+	invalid := [][]JournalStep{
+		{{Buckets: path, Key: []byte("a"), Value: oversized}},
+		{{Buckets: path, Key: oversized, Value: []byte("1")}},
+		{{
+			Buckets: [][]byte{testJournalBucket, oversized},
+			Key:     []byte("a"),
+			Value:   []byte("1"),
+		}},
+		make([]JournalStep, maxJournalSteps+1),
+	}
+	for _, steps := range invalid {
+		if err := db.Journal(steps); err != ErrJournalTooLarge {
+			t.Fatalf("expected ErrJournalTooLarge, got %v", err)
+		}
+	}
+
+	// A step replacing a value that exceeds the limit is rejected as well,
+	// as its prior value is recorded along with the journal.
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(testJournalBucket)
+		if err != nil {
+			return err
+		}
+		nested, err := bucket.CreateBucketIfNotExists(testJournalNested)
+		if err != nil {
+			return err
+		}
+
+		return nested.Put([]byte("a"), oversized)
+	})
+	if err != nil {
+		t.Fatalf("unable to store oversized value: %v", err)
+	}
+	err = db.Journal([]JournalStep{
+		{Buckets: path, Key: []byte("a"), Value: []byte("1")},
+	})
+	if err != ErrJournalTooLarge {
+		t.Fatalf("expected ErrJournalTooLarge, got %v", err)
+	}
+	value := fetchTestJournalKey(t, db, []byte("a"))
+	if !bytes.Equal(value, oversized) {
+		t.Fatalf("expected oversized value to be retained")
+	}
+	assertJournalEmpty(t, db)
+
+	var b bytes.Buffer
+	if err := WriteElement(&b, uint32(maxJournalSteps+1)); err != nil {
+		t.Fatalf("unable to write step count: %v", err)
+	}
+	if _, err := deserializeJournal(&b); err == nil {
+		t.Fatalf("expected journal with too many steps to be " +
+			"rejected")
+	}
+}
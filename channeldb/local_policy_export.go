@@ -0,0 +1,312 @@
+package channeldb
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+const (
+	// localPolicyExportMagic is the first field of the first row written
+	// by ExportLocalPolicies, identifying the content of the export.
+	localPolicyExportMagic = "lnd-local-policies"
+
+	// localPolicyExportVersion is the version of the format written by
+	// ExportLocalPolicies. It must be bumped whenever the columns change,
+	// such that older exports are either converted or rejected by
+	// ImportLocalPolicies.
+	localPolicyExportVersion = 1
+)
+
+var (
+	// localPolicyExportColumns are the names of the columns of the export,
+	// as written to the row following the version row.
+	localPolicyExportColumns = []string{
+		"scid", "base_fee_msat", "fee_rate_ppm", "time_lock_delta",
+		"min_htlc_msat", "max_htlc_msat", "disabled",
+	}
+
+	// ErrUnknownPolicyExportVersion is returned when attempting to import
+	// local policies that were exported using an unknown format.
+	ErrUnknownPolicyExportVersion = fmt.Errorf("unknown local policy " +
+		"export version")
+)
+
+// ImportReport is the outcome of importing local policies.
+type ImportReport struct {
+	// Updated holds the current policy of the source node for each
+	// imported channel that it has, with the imported values applied,
+	// ordered by channel ID.
+	Updated []*ChannelEdgePolicy
+
+	// Unknown holds the channel IDs of the imported policies that were
+	// skipped, as the source node has no policy for them.
+	Unknown []uint64
+}
+
+// ExportLocalPolicies writes the policy the source node set for each of its
+// channels to w in CSV format, ordered by channel ID. The first row holds the
+// format version, followed by a row naming the columns, and a row per channel
+// holding its short channel ID, base fee, fee rate, time lock delta, min and
+// max HTLC, and whether it's disabled. The max HTLC is left empty for
+// policies that don't set one. Channels for which the source node hasn't set
+// a policy yet are omitted.
+func (c *ChannelGraph) ExportLocalPolicies(w io.Writer) error {
+	csvWriter := csv.NewWriter(w)
+	err := csvWriter.Write([]string{
+		localPolicyExportMagic, strconv.Itoa(localPolicyExportVersion),
+	})
+	if err != nil {
+		return err
+	}
+	if err := csvWriter.Write(localPolicyExportColumns); err != nil {
+		return err
+	}
+
+	err = c.db.View(func(tx *bbolt.Tx) error {
+		nodes := tx.Bucket(nodeBucket)
+		if nodes == nil {
+			return ErrGraphNotFound
+		}
+		source, err := c.sourceNode(nodes)
+		if err != nil {
+			return err
+		}
+
+		// The edges of the source node are iterated in the order of
+		// their channel ID, so the rows can be written as we go.
+		return source.ForEachChannel(tx, func(_ *bbolt.Tx,
+			_ *ChannelEdgeInfo, policy,
+			_ *ChannelEdgePolicy) error {
+
+			if policy == nil {
+				return nil
+			}
+
+			return csvWriter.Write(encodeLocalPolicyRow(policy))
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// ImportLocalPolicies reads local policies written by ExportLocalPolicies,
+// and applies the imported values of each channel to the current policy the
+// source node set for it. As channel updates must be signed before they're
+// stored within the graph, the updated policies are returned within the
+// report rather than written, so the caller can sign and publish them through
+// UpdateEdgePolicy. The entire export is validated before any policy is
+// updated.
+func (c *ChannelGraph) ImportLocalPolicies(r io.Reader) (*ImportReport,
+	error) {
+
+	imported, err := decodeLocalPolicies(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var report *ImportReport
+	err = c.db.View(func(tx *bbolt.Tx) error {
+		report = &ImportReport{}
+
+		nodes := tx.Bucket(nodeBucket)
+		if nodes == nil {
+			return ErrGraphNotFound
+		}
+		sourcePub := nodes.Get(sourceKey)
+		if sourcePub == nil {
+			return ErrSourceNodeNotSet
+		}
+		edges := tx.Bucket(edgeBucket)
+		if edges == nil {
+			return ErrGraphNoEdgesFound
+		}
+
+		for _, importedPolicy := range imported {
+			var chanID [8]byte
+			byteOrder.PutUint64(chanID[:], importedPolicy.ChannelID)
+
+			policy, err := fetchChanEdgePolicy(
+				edges, chanID[:], sourcePub, nodes,
+			)
+			switch {
+			case err == ErrEdgeNotFound || policy == nil:
+				report.Unknown = append(
+					report.Unknown,
+					importedPolicy.ChannelID,
+				)
+				continue
+
+			case err != nil:
+				return err
+			}
+
+			applyLocalPolicy(policy, importedPolicy)
+			policy.db = c.db
+			report.Updated = append(report.Updated, policy)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// encodeLocalPolicyRow returns the row of the export for the given policy.
+func encodeLocalPolicyRow(policy *ChannelEdgePolicy) []string {
+	maxHTLC := ""
+	if policy.MessageFlags.HasMaxHtlc() {
+		maxHTLC = strconv.FormatUint(uint64(policy.MaxHTLC), 10)
+	}
+	disabled := policy.ChannelFlags&lnwire.ChanUpdateDisabled != 0
+
+	feeRate := policy.FeeProportionalMillionths
+
+	return []string{
+		strconv.FormatUint(policy.ChannelID, 10),
+		strconv.FormatUint(uint64(policy.FeeBaseMSat), 10),
+		strconv.FormatUint(uint64(feeRate), 10),
+		strconv.FormatUint(uint64(policy.TimeLockDelta), 10),
+		strconv.FormatUint(uint64(policy.MinHTLC), 10),
+		maxHTLC,
+		strconv.FormatBool(disabled),
+	}
+}
+
+// decodeLocalPolicies reads and validates all policies of an export. Only the
+// fields that are part of the export are set on the returned policies.
+func decodeLocalPolicies(r io.Reader) ([]*ChannelEdgePolicy, error) {
+	csvReader := csv.NewReader(r)
+	csvReader.FieldsPerRecord = -1
+
+	versionRow, err := csvReader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if len(versionRow) != 2 || versionRow[0] != localPolicyExportMagic {
+		return nil, fmt.Errorf("invalid local policy export header")
+	}
+	if versionRow[1] != strconv.Itoa(localPolicyExportVersion) {
+		return nil, ErrUnknownPolicyExportVersion
+	}
+
+	columns, err := csvReader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) != len(localPolicyExportColumns) {
+		return nil, fmt.Errorf("expected %v columns, got %v",
+			len(localPolicyExportColumns), len(columns))
+	}
+	for i, column := range columns {
+		if column != localPolicyExportColumns[i] {
+			return nil, fmt.Errorf("expected column %v, got %v",
+				localPolicyExportColumns[i], column)
+		}
+	}
+	csvReader.FieldsPerRecord = len(columns)
+
+	var (
+		policies []*ChannelEdgePolicy
+		seen     = make(map[uint64]struct{})
+	)
+	for {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		policy, err := decodeLocalPolicyRow(row)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[policy.ChannelID]; ok {
+			return nil, fmt.Errorf("duplicate policy for channel "+
+				"%v", policy.ChannelID)
+		}
+		seen[policy.ChannelID] = struct{}{}
+
+		policies = append(policies, policy)
+	}
+
+	return policies, nil
+}
+
+// decodeLocalPolicyRow parses a row written by encodeLocalPolicyRow.
+func decodeLocalPolicyRow(row []string) (*ChannelEdgePolicy, error) {
+	var fields [5]uint64
+	for i := range fields {
+		bitSize := 64
+		if i == 3 {
+			bitSize = 16
+		}
+
+		var err error
+		fields[i], err = strconv.ParseUint(row[i], 10, bitSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v of policy %v: %v",
+				localPolicyExportColumns[i], row[0], err)
+		}
+	}
+
+	policy := &ChannelEdgePolicy{
+		ChannelID:                 fields[0],
+		FeeBaseMSat:               lnwire.MilliSatoshi(fields[1]),
+		FeeProportionalMillionths: lnwire.MilliSatoshi(fields[2]),
+		TimeLockDelta:             uint16(fields[3]),
+		MinHTLC:                   lnwire.MilliSatoshi(fields[4]),
+	}
+
+	if row[5] != "" {
+		maxHTLC, err := strconv.ParseUint(row[5], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max_htlc_msat of "+
+				"policy %v: %v", row[0], err)
+		}
+		policy.MaxHTLC = lnwire.MilliSatoshi(maxHTLC)
+		policy.MessageFlags |= lnwire.ChanUpdateOptionMaxHtlc
+	}
+
+	disabled, err := strconv.ParseBool(row[6])
+	if err != nil {
+		return nil, fmt.Errorf("invalid disabled of policy %v: %v",
+			row[0], err)
+	}
+	if disabled {
+		policy.ChannelFlags |= lnwire.ChanUpdateDisabled
+	}
+
+	return policy, nil
+}
+
+// applyLocalPolicy sets the fields of policy that are part of the export to
+// those of the imported one.
+func applyLocalPolicy(policy, imported *ChannelEdgePolicy) {
+	policy.FeeBaseMSat = imported.FeeBaseMSat
+	policy.FeeProportionalMillionths = imported.FeeProportionalMillionths
+	policy.TimeLockDelta = imported.TimeLockDelta
+	policy.MinHTLC = imported.MinHTLC
+	policy.MaxHTLC = imported.MaxHTLC
+
+	maxHTLCFlag := lnwire.ChanUpdateOptionMaxHtlc
+	policy.MessageFlags = policy.MessageFlags&^maxHTLCFlag |
+		imported.MessageFlags&maxHTLCFlag
+
+	disabledFlag := lnwire.ChanUpdateDisabled
+	policy.ChannelFlags = policy.ChannelFlags&^disabledFlag |
+		imported.ChannelFlags&disabledFlag
+}
@@ -0,0 +1,171 @@
+package channeldb
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestLocalPolicyExport asserts that the local policies exported by one node
+// can be imported, with unknown channels reported, and that exports of an
+// unknown version are rejected.
+func TestLocalPolicyExport(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	graph := db.ChannelGraph()
+
+	source, err := createTestVertex(db)
+	if err != nil {
+		t.Fatalf("unable to create test node: %v", err)
+	}
+	if err := graph.SetSourceNode(source); err != nil {
+		t.Fatalf("unable to set source node: %v", err)
+	}
+
+	// addChannel adds a channel between the source node and a new peer,
+	// and returns the policy of the source node.
+	addChannel := func() *ChannelEdgePolicy {
+		t.Helper()
+
+		peer, err := createTestVertex(db)
+		if err != nil {
+			t.Fatalf("unable to create test node: %v", err)
+		}
+		if err := graph.AddLightningNode(peer); err != nil {
+			t.Fatalf("unable to add node: %v", err)
+		}
+
+		edgeInfo, edge1, edge2 := createChannelEdge(db, source, peer)
+		if err := graph.AddChannelEdge(edgeInfo); err != nil {
+			t.Fatalf("unable to add channel edge: %v", err)
+		}
+
+		policy := edge1
+		if bytes.Compare(source.PubKeyBytes[:],
+			peer.PubKeyBytes[:]) > 0 {
+
+			policy = edge2
+		}
+		return policy
+	}
+
+	withMaxHTLC := addChannel()
+	withoutMaxHTLC := addChannel()
+	withoutMaxHTLC.MessageFlags = 0
+	withoutMaxHTLC.MaxHTLC = 0
+	withoutMaxHTLC.ChannelFlags |= lnwire.ChanUpdateDisabled
+	for _, policy := range []*ChannelEdgePolicy{
+		withMaxHTLC, withoutMaxHTLC,
+	} {
+		if err := graph.UpdateEdgePolicy(policy); err != nil {
+			t.Fatalf("unable to update policy: %v", err)
+		}
+	}
+
+	// A channel without a policy of the source node isn't exported.
+	addChannel()
+
+	var export bytes.Buffer
+	if err := graph.ExportLocalPolicies(&export); err != nil {
+		t.Fatalf("unable to export policies: %v", err)
+	}
+	rows := strings.Split(strings.TrimSpace(export.String()), "\n")
+	if len(rows) != 4 {
+		t.Fatalf("expected 4 rows, got %v", len(rows))
+	}
+	if rows[0] != "lnd-local-policies,1" {
+		t.Fatalf("unexpected version row %v", rows[0])
+	}
+
+	// Importing the export as is should leave the policies unchanged.
+	report, err := graph.ImportLocalPolicies(
+		bytes.NewReader(export.Bytes()),
+	)
+	if err != nil {
+		t.Fatalf("unable to import policies: %v", err)
+	}
+	if len(report.Updated) != 2 || len(report.Unknown) != 0 {
+		t.Fatalf("expected 2 updated and no unknown policies, got "+
+			"%v and %v", len(report.Updated), len(report.Unknown))
+	}
+	for _, updated := range report.Updated {
+		expected := withMaxHTLC
+		if updated.ChannelID == withoutMaxHTLC.ChannelID {
+			expected = withoutMaxHTLC
+		}
+		assertLocalPolicy(t, updated, expected)
+	}
+
+	// We'll now import a modified policy for the first channel, along
+	// with one for a channel the source node doesn't have.
+	withMaxHTLC.FeeBaseMSat = 1
+	withMaxHTLC.FeeProportionalMillionths = 2
+	withMaxHTLC.TimeLockDelta = 3
+	withMaxHTLC.MinHTLC = 4
+	withMaxHTLC.MaxHTLC = 5
+	withMaxHTLC.ChannelFlags |= lnwire.ChanUpdateDisabled
+
+	var modified bytes.Buffer
+	modified.WriteString(rows[0] + "\n" + rows[1] + "\n")
+	modified.WriteString(
+		strings.Join(encodeLocalPolicyRow(withMaxHTLC), ",") + "\n",
+	)
+	modified.WriteString("999,0,0,0,0,,false\n")
+
+	report, err = graph.ImportLocalPolicies(&modified)
+	if err != nil {
+		t.Fatalf("unable to import policies: %v", err)
+	}
+	if !reflect.DeepEqual(report.Unknown, []uint64{999}) {
+		t.Fatalf("expected unknown channel 999, got %v",
+			report.Unknown)
+	}
+	if len(report.Updated) != 1 {
+		t.Fatalf("expected 1 updated policy, got %v",
+			len(report.Updated))
+	}
+	assertLocalPolicy(t, report.Updated[0], withMaxHTLC)
+
+	invalid := []string{
+		"lnd-local-policies,2\n" + rows[1] + "\n",
+		"other,1\n" + rows[1] + "\n",
+		rows[0] + "\nscid\n",
+		rows[0] + "\n" + rows[1] + "\n1,0,0,70000,0,,false\n",
+		rows[0] + "\n" + rows[1] + "\n1,0,0,0,0,,false\n" +
+			"1,0,0,0,0,,false\n",
+	}
+	for i, export := range invalid {
+		_, err := graph.ImportLocalPolicies(strings.NewReader(export))
+		if err == nil {
+			t.Fatalf("expected invalid export %v to be rejected", i)
+		}
+		if i == 0 && err != ErrUnknownPolicyExportVersion {
+			t.Fatalf("expected ErrUnknownPolicyExportVersion, "+
+				"got %v", err)
+		}
+	}
+}
+
+// assertLocalPolicy asserts that the exported fields of the policies match.
+func assertLocalPolicy(t *testing.T, policy, expected *ChannelEdgePolicy) {
+	t.Helper()
+
+	if !reflect.DeepEqual(
+		encodeLocalPolicyRow(policy), encodeLocalPolicyRow(expected),
+	) {
+		t.Fatalf("expected policy %v, got %v",
+			encodeLocalPolicyRow(expected),
+			encodeLocalPolicyRow(policy))
+	}
+	if policy.SigBytes == nil || policy.Node == nil {
+		t.Fatalf("expected current policy to be updated")
+	}
+}
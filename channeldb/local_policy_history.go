@@ -0,0 +1,197 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+var (
+	// localPolicyHistoryBucket is the top-level bucket that retains every
+	// channel update published by the source node, allowing an operator
+	// to audit past fee policies and revert to one of them. Each channel
+	// has its own sub-bucket, holding its updates keyed by their update
+	// time.
+	//
+	// maps: chanID -> updateTime -> channelEdgePolicy
+	localPolicyHistoryBucket = []byte("local-policy-history")
+
+	// ErrLocalPolicyNotFound is returned when no channel update of the
+	// source node that satisfies the query has been recorded.
+	ErrLocalPolicyNotFound = fmt.Errorf("no matching local policy found")
+)
+
+// MyPolicyHistory returns all channel updates the source node published for
+// the given channel, ordered by their update time. Updates are recorded as
+// they're applied through UpdateEdgePolicy, and are retained after the
+// channel is closed.
+func (c *ChannelGraph) MyPolicyHistory(chanID uint64) ([]ChannelEdgePolicy,
+	error) {
+
+	var policies []ChannelEdgePolicy
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		history := localPolicyHistory(tx, chanID)
+		if history == nil {
+			return nil
+		}
+		nodes := tx.Bucket(nodeBucket)
+
+		return history.ForEach(func(_, policyBytes []byte) error {
+			policy, err := deserializeLocalPolicy(
+				policyBytes, nodes,
+			)
+			if err != nil {
+				return err
+			}
+			policy.db = c.db
+
+			policies = append(policies, *policy)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+// RevertMyPolicy returns the latest channel update the source node published
+// for the given channel at or before toTimestamp. The policy is returned as it
+// was published, so the caller must refresh its update time and signature
+// before re-applying it. If no such update was recorded,
+// ErrLocalPolicyNotFound is returned.
+func (c *ChannelGraph) RevertMyPolicy(chanID uint64,
+	toTimestamp time.Time) (*ChannelEdgePolicy, error) {
+
+	var policy *ChannelEdgePolicy
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		history := localPolicyHistory(tx, chanID)
+		if history == nil {
+			return ErrLocalPolicyNotFound
+		}
+
+		// We'll seek to the first update published after the target
+		// time, and step back to the one preceding it.
+		var seekKey [8]byte
+		byteOrder.PutUint64(seekKey[:], uint64(toTimestamp.Unix())+1)
+
+		cursor := history.Cursor()
+		k, policyBytes := cursor.Seek(seekKey[:])
+		if k == nil {
+			_, policyBytes = cursor.Last()
+		} else {
+			_, policyBytes = cursor.Prev()
+		}
+		if policyBytes == nil {
+			return ErrLocalPolicyNotFound
+		}
+
+		var err error
+		policy, err = deserializeLocalPolicy(
+			policyBytes, tx.Bucket(nodeBucket),
+		)
+		if err != nil {
+			return err
+		}
+		policy.db = c.db
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// localPolicyHistory returns the bucket holding the local policy history of
+// the given channel, or nil if none has been recorded.
+func localPolicyHistory(tx *bbolt.Tx, chanID uint64) *bbolt.Bucket {
+	historyBucket := tx.Bucket(localPolicyHistoryBucket)
+	if historyBucket == nil {
+		return nil
+	}
+
+	var chanIDBytes [8]byte
+	byteOrder.PutUint64(chanIDBytes[:], chanID)
+
+	return historyBucket.Bucket(chanIDBytes[:])
+}
+
+// recordLocalPolicy adds the passed channel update to the local policy
+// history if it was published by the source node. Updates of other nodes are
+// ignored.
+func recordLocalPolicy(tx *bbolt.Tx, edge *ChannelEdgePolicy) error {
+	nodes := tx.Bucket(nodeBucket)
+	if nodes == nil {
+		return nil
+	}
+	sourcePub := nodes.Get(sourceKey)
+	if sourcePub == nil {
+		return nil
+	}
+
+	edges := tx.Bucket(edgeBucket)
+	if edges == nil {
+		return ErrEdgeNotFound
+	}
+	edgeIndex := edges.Bucket(edgeIndexBucket)
+	if edgeIndex == nil {
+		return ErrEdgeNotFound
+	}
+
+	var chanID [8]byte
+	byteOrder.PutUint64(chanID[:], edge.ChannelID)
+	nodeInfo := edgeIndex.Get(chanID[:])
+	if len(nodeInfo) < 66 {
+		return ErrEdgeNotFound
+	}
+
+	fromNode, toNode := nodeInfo[:33], nodeInfo[33:66]
+	if edge.ChannelFlags&lnwire.ChanUpdateDirection != 0 {
+		fromNode, toNode = toNode, fromNode
+	}
+	if !bytes.Equal(fromNode, sourcePub) {
+		return nil
+	}
+
+	historyBucket, err := tx.CreateBucketIfNotExists(
+		localPolicyHistoryBucket,
+	)
+	if err != nil {
+		return err
+	}
+	history, err := historyBucket.CreateBucketIfNotExists(chanID[:])
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	if err := serializeChanEdgePolicy(&b, edge, toNode); err != nil {
+		return err
+	}
+
+	var updateTime [8]byte
+	byteOrder.PutUint64(updateTime[:], uint64(edge.LastUpdate.Unix()))
+
+	return history.Put(updateTime[:], b.Bytes())
+}
+
+// deserializeLocalPolicy decodes a channel update of the local policy
+// history.
+func deserializeLocalPolicy(policyBytes []byte,
+	nodes *bbolt.Bucket) (*ChannelEdgePolicy, error) {
+
+	policy, err := deserializeChanEdgePolicy(
+		bytes.NewReader(policyBytes), nodes,
+	)
+	if err != nil && err != ErrEdgePolicyOptionalFieldNotFound {
+		return nil, err
+	}
+
+	return policy, nil
+}
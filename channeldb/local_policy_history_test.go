@@ -0,0 +1,117 @@
+package channeldb
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestLocalPolicyHistory asserts that only the channel updates published by
+// the source node are recorded, and that a past update can be retrieved to
+// revert to.
+func TestLocalPolicyHistory(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	graph := db.ChannelGraph()
+
+	sourceNode, err := createTestVertex(db)
+	if err != nil {
+		t.Fatalf("unable to create test node: %v", err)
+	}
+	if err := graph.SetSourceNode(sourceNode); err != nil {
+		t.Fatalf("unable to set source node: %v", err)
+	}
+	peer, err := createTestVertex(db)
+	if err != nil {
+		t.Fatalf("unable to create test node: %v", err)
+	}
+	if err := graph.AddLightningNode(peer); err != nil {
+		t.Fatalf("unable to add node: %v", err)
+	}
+
+	edgeInfo, edge1, edge2 := createChannelEdge(db, sourceNode, peer)
+	if err := graph.AddChannelEdge(edgeInfo); err != nil {
+		t.Fatalf("unable to add edge: %v", err)
+	}
+
+	// The first policy is published by the node with the smaller public
+	// key.
+	localPolicy, remotePolicy := edge1, edge2
+	if bytes.Compare(sourceNode.PubKeyBytes[:], peer.PubKeyBytes[:]) > 0 {
+		localPolicy, remotePolicy = edge2, edge1
+	}
+
+	_, err = graph.RevertMyPolicy(edgeInfo.ChannelID, time.Unix(5000, 0))
+	if err != ErrLocalPolicyNotFound {
+		t.Fatalf("expected ErrLocalPolicyNotFound, got %v", err)
+	}
+
+	// We'll publish three fee updates of our own, along with an update
+	// of our peer.
+	baseTime := time.Unix(1000, 0)
+	for i := 0; i < 3; i++ {
+		localPolicy.LastUpdate = baseTime.Add(
+			time.Duration(i) * time.Hour,
+		)
+		localPolicy.FeeBaseMSat = 1000 * lnwire.MilliSatoshi(i+1)
+		if err := graph.UpdateEdgePolicy(localPolicy); err != nil {
+			t.Fatalf("unable to update edge: %v", err)
+		}
+	}
+	if err := graph.UpdateEdgePolicy(remotePolicy); err != nil {
+		t.Fatalf("unable to update edge: %v", err)
+	}
+
+	history, err := graph.MyPolicyHistory(edgeInfo.ChannelID)
+	if err != nil {
+		t.Fatalf("unable to fetch policy history: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("expected 3 recorded policies, got %v", len(history))
+	}
+	for i, policy := range history {
+		expectedFee := 1000 * lnwire.MilliSatoshi(i+1)
+		if policy.FeeBaseMSat != expectedFee {
+			t.Fatalf("expected policy %v to have base fee %v, "+
+				"got %v", i, expectedFee, policy.FeeBaseMSat)
+		}
+	}
+
+	// Reverting to a time between the second and third update should
+	// return the second update.
+	policy, err := graph.RevertMyPolicy(
+		edgeInfo.ChannelID, baseTime.Add(90*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("unable to revert policy: %v", err)
+	}
+	if policy.FeeBaseMSat != 2000 {
+		t.Fatalf("expected base fee 2000, got %v", policy.FeeBaseMSat)
+	}
+
+	// Reverting to a time after all updates should return the latest
+	// one, while a time preceding them should fail.
+	policy, err = graph.RevertMyPolicy(
+		edgeInfo.ChannelID, baseTime.Add(time.Hour*24),
+	)
+	if err != nil {
+		t.Fatalf("unable to revert policy: %v", err)
+	}
+	if policy.FeeBaseMSat != 3000 {
+		t.Fatalf("expected base fee 3000, got %v", policy.FeeBaseMSat)
+	}
+
+	_, err = graph.RevertMyPolicy(
+		edgeInfo.ChannelID, baseTime.Add(-time.Second),
+	)
+	if err != ErrLocalPolicyNotFound {
+		t.Fatalf("expected ErrLocalPolicyNotFound, got %v", err)
+	}
+}
@@ -10,12 +10,28 @@ var (
 	// dbVersionKey is a boltdb key and it's used for storing/retrieving
 	// current database version.
 	dbVersionKey = []byte("dbp")
+
+	// minCompatibleVersionKey is a boltdb key and it's used for
+	// storing/retrieving the lowest database version a binary must
+	// support in order to safely open the database.
+	minCompatibleVersionKey = []byte("mcv")
 )
 
+// minCompatibleVersion is the lowest database version a binary must support to
+// open a database written by this one. It must be raised whenever records are
+// written in a way binaries supporting a lower version would mis-decode,
+// rather than merely ignore.
+const minCompatibleVersion = 33
+
 // Meta structure holds the database meta information.
 type Meta struct {
 	// DbVersionNumber is the current schema version of the database.
 	DbVersionNumber uint32
+
+	// MinCompatibleVersion is the lowest schema version a binary must
+	// support in order to open the database. It's zero for databases that
+	// were written before the minimum was recorded.
+	MinCompatibleVersion uint32
 }
 
 // FetchMeta fetches the meta data from boltdb and returns filled meta
@@ -49,6 +65,10 @@ func fetchMeta(meta *Meta, tx *bbolt.Tx) error {
 		meta.DbVersionNumber = byteOrder.Uint32(data)
 	}
 
+	if data := metaBucket.Get(minCompatibleVersionKey); data != nil {
+		meta.MinCompatibleVersion = byteOrder.Uint32(data)
+	}
+
 	return nil
 }
 
@@ -68,7 +88,13 @@ func putMeta(meta *Meta, tx *bbolt.Tx) error {
 		return err
 	}
 
-	return putDbVersion(metaBucket, meta)
+	if err := putDbVersion(metaBucket, meta); err != nil {
+		return err
+	}
+
+	var scratch [4]byte
+	byteOrder.PutUint32(scratch[:], meta.MinCompatibleVersion)
+	return metaBucket.Put(minCompatibleVersionKey, scratch[:])
 }
 
 func putDbVersion(metaBucket *bbolt.Bucket, meta *Meta) error {
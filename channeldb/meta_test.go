@@ -3,8 +3,11 @@ package channeldb
 import (
 	"bytes"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/btcsuite/btclog"
 	"github.com/coreos/bbolt"
 	"github.com/go-errors/errors"
 )
@@ -14,6 +17,30 @@ import (
 func applyMigration(t *testing.T, beforeMigration, afterMigration func(d *DB),
 	migrationFunc migration, shouldFail bool) {
 
+	applyVersion(
+		t, beforeMigration, afterMigration,
+		version{number: 1, migration: migrationFunc}, shouldFail,
+	)
+}
+
+// applyBatchMigration is the equivalent of applyMigration for migrations that
+// are applied in batches. The migration is applied in batches of a single
+// record, so that it's resumed from its checkpoint for every record.
+func applyBatchMigration(t *testing.T, beforeMigration,
+	afterMigration func(d *DB), migrationFunc batchMigration,
+	shouldFail bool) {
+
+	applyVersion(
+		t, beforeMigration, afterMigration,
+		version{number: 1, batchMigration: migrationFunc}, shouldFail,
+	)
+}
+
+// applyVersion applies the migration of the passed version to a database at
+// version zero. The version's number must be 1.
+func applyVersion(t *testing.T, beforeMigration, afterMigration func(d *DB),
+	newVersion version, shouldFail bool) {
+
 	cdb, cleanUp, err := makeTestDB()
 	defer cleanUp()
 	if err != nil {
@@ -36,10 +63,7 @@ func applyMigration(t *testing.T, beforeMigration, afterMigration func(d *DB),
 			number:    0,
 			migration: nil,
 		},
-		{
-			number:    1,
-			migration: migrationFunc,
-		},
+		newVersion,
 	}
 
 	defer func() {
@@ -59,7 +83,7 @@ func applyMigration(t *testing.T, beforeMigration, afterMigration func(d *DB),
 	}()
 
 	// Sync with the latest version - applying migration function.
-	err = cdb.syncVersions(versions)
+	err = cdb.syncVersionsInBatches(versions, 1)
 }
 
 // TestVersionFetchPut checks the propernces of fetch/put methods
@@ -106,28 +130,34 @@ func TestOrderOfMigrations(t *testing.T) {
 
 	appliedMigration := -1
 	versions := []version{
-		{0, nil},
-		{1, nil},
-		{2, func(tx *bbolt.Tx) error {
-			appliedMigration = 2
-			return nil
-		}},
-		{3, func(tx *bbolt.Tx) error {
-			appliedMigration = 3
-			return nil
-		}},
+		{number: 0},
+		{number: 1},
+		{
+			number: 2,
+			migration: func(tx *bbolt.Tx, _ btclog.Logger) error {
+				appliedMigration = 2
+				return nil
+			},
+		},
+		{
+			number: 3,
+			migration: func(tx *bbolt.Tx, _ btclog.Logger) error {
+				appliedMigration = 3
+				return nil
+			},
+		},
 	}
 
 	// Retrieve the migration that should be applied to db, as far as
 	// current version is 1, we skip zero and first versions.
-	migrations, _ := getMigrationsToApply(versions, 1)
+	migrations := getMigrationsToApply(versions, 1)
 
 	if len(migrations) != 2 {
 		t.Fatal("incorrect number of migrations to apply")
 	}
 
 	// Apply first migration.
-	migrations[0](nil)
+	migrations[0].migration(nil, nil)
 
 	// Check that first migration corresponds to the second version.
 	if appliedMigration != 2 {
@@ -135,7 +165,7 @@ func TestOrderOfMigrations(t *testing.T) {
 	}
 
 	// Apply second migration.
-	migrations[1](nil)
+	migrations[1].migration(nil, nil)
 
 	// Check that second migration corresponds to the third version.
 	if appliedMigration != 3 {
@@ -197,7 +227,7 @@ func TestMigrationWithPanic(t *testing.T) {
 
 	// Create migration function which changes the initially created data and
 	// throw the panic, in this case we pretending that something goes.
-	migrationWithPanic := func(tx *bbolt.Tx) error {
+	migrationWithPanic := func(tx *bbolt.Tx, _ btclog.Logger) error {
 		bucket, err := tx.CreateBucketIfNotExists(bucketPrefix)
 		if err != nil {
 			return err
@@ -269,7 +299,7 @@ func TestMigrationWithFatal(t *testing.T) {
 	// Create migration function which changes the initially created data and
 	// return the error, in this case we pretending that something goes
 	// wrong.
-	migrationWithFatal := func(tx *bbolt.Tx) error {
+	migrationWithFatal := func(tx *bbolt.Tx, _ btclog.Logger) error {
 		bucket, err := tx.CreateBucketIfNotExists(bucketPrefix)
 		if err != nil {
 			return err
@@ -340,7 +370,7 @@ func TestMigrationWithoutErrors(t *testing.T) {
 	}
 
 	// Create migration function which changes the initially created data.
-	migrationWithoutErrors := func(tx *bbolt.Tx) error {
+	migrationWithoutErrors := func(tx *bbolt.Tx, _ btclog.Logger) error {
 		bucket, err := tx.CreateBucketIfNotExists(bucketPrefix)
 		if err != nil {
 			return err
@@ -427,3 +457,79 @@ func TestMigrationReversion(t *testing.T) {
 			"want: %v, got: %v", ErrDBReversion, err)
 	}
 }
+
+// TestMinCompatibleVersion asserts that opening a database records the minimum
+// version required to open it, and that a database requiring a newer version
+// than supported is refused before any migration is applied.
+func TestMinCompatibleVersion(t *testing.T) {
+	t.Parallel()
+
+	latestVersion := getLatestDBVersion(dbVersions)
+	if minCompatibleVersion > latestVersion {
+		t.Fatalf("min compatible version %v exceeds latest version %v",
+			minCompatibleVersion, latestVersion)
+	}
+
+	tempDirName, err := ioutil.TempDir("", "channeldb")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDirName)
+
+	cdb, err := Open(tempDirName)
+	if err != nil {
+		t.Fatalf("unable to open channeldb: %v", err)
+	}
+
+	meta, err := cdb.FetchMeta(nil)
+	if err != nil {
+		cdb.Close()
+		t.Fatalf("unable to fetch meta: %v", err)
+	}
+	if meta.MinCompatibleVersion != minCompatibleVersion {
+		cdb.Close()
+		t.Fatalf("expected min compatible version %v, got %v",
+			minCompatibleVersion, meta.MinCompatibleVersion)
+	}
+
+	// We'll now pretend the database was written by a newer binary, which
+	// requires a version beyond our latest one. Its version is left below
+	// our latest, such that we'd otherwise attempt to migrate it.
+	newMeta := &Meta{
+		DbVersionNumber:      0,
+		MinCompatibleVersion: latestVersion + 1,
+	}
+	err = cdb.PutMeta(newMeta)
+	cdb.Close()
+	if err != nil {
+		t.Fatalf("unable to store meta: %v", err)
+	}
+
+	_, err = Open(tempDirName)
+	if err != ErrDBIncompatibleVersion {
+		t.Fatalf("expected ErrDBIncompatibleVersion, got %v", err)
+	}
+
+	// The database should've been left untouched.
+	bdb, err := bbolt.Open(
+		filepath.Join(tempDirName, dbName), dbFilePermission, nil,
+	)
+	if err != nil {
+		t.Fatalf("unable to open bolt db: %v", err)
+	}
+	defer bdb.Close()
+
+	err = bdb.View(func(tx *bbolt.Tx) error {
+		meta := &Meta{}
+		if err := fetchMeta(meta, tx); err != nil {
+			return err
+		}
+		if *meta != *newMeta {
+			t.Fatalf("expected meta %v, got %v", newMeta, meta)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to read meta: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package channeldb
+
+import (
+	"bytes"
+
+	"github.com/coreos/bbolt"
+)
+
+const (
+	// migrationBatchSize is the number of records a batch migration
+	// rewrites within a single transaction.
+	migrationBatchSize = 10000
+)
+
+var (
+	// migrationCheckpointBucket is a temporary top-level bucket that
+	// tracks the progress of the batch migration currently being applied.
+	// It's removed along with the final batch of the migration.
+	//
+	// maps: version => stage => checkpoint
+	migrationCheckpointBucket = []byte("migration-checkpoint")
+)
+
+const (
+	// checkpointInProgress marks a checkpoint of a stage that has records
+	// left to migrate. It's followed by the key of the last record that
+	// was migrated.
+	checkpointInProgress byte = 0
+
+	// checkpointDone marks a checkpoint of a stage whose records have all
+	// been migrated.
+	checkpointDone byte = 1
+)
+
+// reserializeBatch rewrites the next batch of at most batchSize records within
+// bucket using convert, which returns the new value of the record. Nested
+// buckets are skipped. The progress of the rewrite is tracked by the passed
+// checkpoint under stage, allowing a single batch migration to rewrite
+// several buckets in sequence. It returns true once all records of the bucket
+// have been rewritten.
+func reserializeBatch(checkpoint *bbolt.Bucket, stage []byte,
+	bucket *bbolt.Bucket, batchSize int,
+	convert func(k, v []byte) ([]byte, error)) (bool, error) {
+
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	// If we've migrated a prior batch of this stage, we'll resume right
+	// after the last record it migrated.
+	var lastKey []byte
+	if state := checkpoint.Get(stage); len(state) > 0 {
+		if state[0] == checkpointDone {
+			return true, nil
+		}
+		lastKey = state[1:]
+	}
+
+	type record struct {
+		key   []byte
+		value []byte
+	}
+
+	var (
+		records []record
+		c       = bucket.Cursor()
+		k, v    []byte
+	)
+	if lastKey == nil {
+		k, v = c.First()
+	} else {
+		k, v = c.Seek(lastKey)
+		if bytes.Equal(k, lastKey) {
+			k, v = c.Next()
+		}
+	}
+
+	// As a bucket must not be modified while a cursor iterates it, we'll
+	// gather all records of the batch before writing them back.
+	for ; k != nil && len(records) < batchSize; k, v = c.Next() {
+		if v == nil {
+			continue
+		}
+
+		newValue, err := convert(k, v)
+		if err != nil {
+			return false, err
+		}
+
+		records = append(records, record{
+			key:   append([]byte(nil), k...),
+			value: newValue,
+		})
+	}
+	done := k == nil
+
+	for _, r := range records {
+		if err := bucket.Put(r.key, r.value); err != nil {
+			return false, err
+		}
+	}
+
+	state := []byte{checkpointDone}
+	if !done {
+		state = []byte{checkpointInProgress}
+		state = append(state, records[len(records)-1].key...)
+	}
+	if err := checkpoint.Put(stage, state); err != nil {
+		return false, err
+	}
+
+	return done, nil
+}
@@ -0,0 +1,132 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+	"github.com/coreos/bbolt"
+)
+
+// TestBatchMigrationResume asserts that a batch migration which fails midway
+// retains the batches it committed, and is resumed from its checkpoint once
+// it's applied again.
+func TestBatchMigrationResume(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+
+	// We'll populate a bucket with a few records, along with a nested
+	// bucket that should be skipped.
+	testBucket := []byte("test-batch-bucket")
+	const numRecords = 5
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucket(testBucket)
+		if err != nil {
+			return err
+		}
+		if _, err := bucket.CreateBucket([]byte("nested")); err != nil {
+			return err
+		}
+
+		for i := byte(0); i < numRecords; i++ {
+			err := bucket.Put([]byte{i}, []byte{i})
+			if err != nil {
+				return err
+			}
+		}
+
+		return putMeta(&Meta{DbVersionNumber: 0}, tx)
+	})
+	if err != nil {
+		t.Fatalf("unable to populate database: %v", err)
+	}
+
+	// The migration appends a marker to each record, and fails during its
+	// third batch if requested.
+	var (
+		numBatches int
+		failBatch  = 3
+	)
+	appendMarker := func(tx *bbolt.Tx, checkpoint *bbolt.Bucket,
+		batchSize int, _ btclog.Logger) (bool, error) {
+
+		numBatches++
+		if numBatches == failBatch {
+			return false, fmt.Errorf("migration interrupted")
+		}
+
+		return reserializeBatch(
+			checkpoint, testBucket, tx.Bucket(testBucket),
+			batchSize, func(k, v []byte) ([]byte, error) {
+				newValue := append([]byte(nil), v...)
+				return append(newValue, 'x'), nil
+			},
+		)
+	}
+
+	versions := []version{
+		{number: 0},
+		{number: 1, batchMigration: appendMarker},
+	}
+
+	assertState := func(expectedVersion uint32, numMigrated int) {
+		t.Helper()
+
+		meta, err := db.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch meta: %v", err)
+		}
+		if meta.DbVersionNumber != expectedVersion {
+			t.Fatalf("expected db version %v, got %v",
+				expectedVersion, meta.DbVersionNumber)
+		}
+
+		err = db.View(func(tx *bbolt.Tx) error {
+			bucket := tx.Bucket(testBucket)
+			for i := byte(0); i < numRecords; i++ {
+				expected := []byte{i}
+				if int(i) < numMigrated {
+					expected = append(expected, 'x')
+				}
+
+				v := bucket.Get([]byte{i})
+				if !bytes.Equal(v, expected) {
+					t.Fatalf("expected record %v to be "+
+						"%x, got %x", i, expected, v)
+				}
+			}
+
+			checkpoint := tx.Bucket(migrationCheckpointBucket)
+			hasCheckpoint := checkpoint != nil
+			if hasCheckpoint != (expectedVersion == 0) {
+				t.Fatalf("unexpected checkpoint presence: %v",
+					hasCheckpoint)
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to read database: %v", err)
+		}
+	}
+
+	// With two records per batch, the first two batches should be
+	// committed before the migration fails.
+	if err := db.syncVersionsInBatches(versions, 2); err == nil {
+		t.Fatalf("expected migration to fail")
+	}
+	assertState(0, 4)
+
+	// Applying the migration again should only migrate the remaining
+	// record, and bump the version of the database.
+	if err := db.syncVersionsInBatches(versions, 2); err != nil {
+		t.Fatalf("unable to apply migration: %v", err)
+	}
+	assertState(1, numRecords)
+}
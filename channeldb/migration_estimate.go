@@ -0,0 +1,318 @@
+package channeldb
+
+import (
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+)
+
+// recordClass is a class of records whose number determines how long a
+// migration takes.
+type recordClass uint8
+
+const (
+	// recordClassNodes are the nodes of the channel graph.
+	recordClassNodes recordClass = iota
+
+	// recordClassEdges are the edges of the channel graph.
+	recordClassEdges
+
+	// recordClassInvoices are the invoices we've created.
+	recordClassInvoices
+
+	// recordClassPayments are the outgoing payments we've sent.
+	recordClassPayments
+
+	// recordClassOpenChannels are the channels that are still open.
+	recordClassOpenChannels
+
+	// recordClassClosedChannels are the summaries of closed channels.
+	recordClassClosedChannels
+
+	// recordClassForwards are the events of the forwarding log.
+	recordClassForwards
+
+	// recordClassGossip are the messages of the gossiper's message store.
+	recordClassGossip
+)
+
+// migrationCost models the time a migration takes as a fixed cost for each
+// record of the classes it processes.
+type migrationCost struct {
+	// records are the classes of records the migration processes.
+	records []recordClass
+
+	// perRecord is the time the migration spends on a single record.
+	perRecord time.Duration
+}
+
+// migrationCosts models the cost of each migration, keyed by the version it
+// migrates the database to. Re-serializing a record costs roughly an order of
+// magnitude more than adding an index entry for it, while the migrations that
+// decode full channel state are the most expensive per record. The costs are
+// rough, conservative figures for databases stored on SSDs.
+var migrationCosts = map[uint32]migrationCost{
+	1: {
+		records:   []recordClass{recordClassNodes, recordClassEdges},
+		perRecord: 3 * time.Microsecond,
+	},
+	2: {
+		records:   []recordClass{recordClassInvoices},
+		perRecord: 20 * time.Microsecond,
+	},
+	3: {
+		records:   []recordClass{recordClassPayments},
+		perRecord: 25 * time.Microsecond,
+	},
+	4: {
+		records:   []recordClass{recordClassEdges},
+		perRecord: 5 * time.Microsecond,
+	},
+	5: {
+		records:   []recordClass{recordClassPayments},
+		perRecord: 5 * time.Microsecond,
+	},
+	6: {
+		records:   []recordClass{recordClassEdges},
+		perRecord: 3 * time.Microsecond,
+	},
+	7: {
+		records:   []recordClass{recordClassClosedChannels},
+		perRecord: 20 * time.Microsecond,
+	},
+	8: {
+		records:   []recordClass{recordClassGossip},
+		perRecord: 10 * time.Microsecond,
+	},
+	9: {
+		records: []recordClass{
+			recordClassInvoices, recordClassPayments,
+		},
+		perRecord: 25 * time.Microsecond,
+	},
+	10: {
+		records:   []recordClass{recordClassPayments},
+		perRecord: 25 * time.Microsecond,
+	},
+	11: {
+		records:   []recordClass{recordClassNodes, recordClassEdges},
+		perRecord: 2 * time.Microsecond,
+	},
+	12: {
+		records:   []recordClass{recordClassClosedChannels},
+		perRecord: 20 * time.Microsecond,
+	},
+	13: {
+		records:   []recordClass{recordClassOpenChannels},
+		perRecord: 30 * time.Microsecond,
+	},
+	14: {
+		records:   []recordClass{recordClassInvoices},
+		perRecord: 20 * time.Microsecond,
+	},
+	15: {
+		records:   []recordClass{recordClassOpenChannels},
+		perRecord: 100 * time.Microsecond,
+	},
+	16: {
+		records:   []recordClass{recordClassOpenChannels},
+		perRecord: 50 * time.Microsecond,
+	},
+	17: {
+		records:   []recordClass{recordClassForwards},
+		perRecord: 5 * time.Microsecond,
+	},
+	18: {
+		records:   []recordClass{recordClassInvoices},
+		perRecord: 25 * time.Microsecond,
+	},
+	19: {
+		records:   []recordClass{recordClassPayments},
+		perRecord: 5 * time.Microsecond,
+	},
+	20: {
+		records: []recordClass{
+			recordClassOpenChannels, recordClassClosedChannels,
+			recordClassEdges,
+		},
+		perRecord: 10 * time.Microsecond,
+	},
+	21: {
+		records:   []recordClass{recordClassInvoices},
+		perRecord: 25 * time.Microsecond,
+	},
+	22: {
+		records:   []recordClass{recordClassNodes},
+		perRecord: 10 * time.Microsecond,
+	},
+	23: {
+		records:   []recordClass{recordClassEdges},
+		perRecord: 6 * time.Microsecond,
+	},
+	24: {
+		records:   []recordClass{recordClassNodes},
+		perRecord: 4 * time.Microsecond,
+	},
+	26: {
+		records:   []recordClass{recordClassOpenChannels},
+		perRecord: 20 * time.Microsecond,
+	},
+	29: {
+		records: []recordClass{
+			recordClassForwards, recordClassOpenChannels,
+		},
+		perRecord: 8 * time.Microsecond,
+	},
+	33: {
+		records:   []recordClass{recordClassInvoices},
+		perRecord: 100 * time.Microsecond,
+	},
+}
+
+// EstimateMigrationTime predicts how long each migration that's yet to be
+// applied to the database will take, keyed by the name of the function
+// implementing the migration. The estimate scales the modeled cost of each
+// migration with the number of records it processes, and is only accurate up
+// to a small factor, depending on the hardware the database is stored on.
+//
+// As migrations are applied when the database is opened, pending migrations
+// can only be estimated for a database opened with OptionSetReadOnly.
+func (d *DB) EstimateMigrationTime() (map[string]time.Duration, error) {
+	return d.estimateMigrationTime(dbVersions)
+}
+
+// estimateMigrationTime is EstimateMigrationTime with a custom set of versions
+// to estimate.
+func (d *DB) estimateMigrationTime(
+	versions []version) (map[string]time.Duration, error) {
+
+	estimates := make(map[string]time.Duration)
+	err := d.View(func(tx *bbolt.Tx) error {
+		meta := &Meta{}
+		err := fetchMeta(meta, tx)
+		if err != nil && err != ErrMetaNotFound {
+			return err
+		}
+		if meta.DbVersionNumber > getLatestDBVersion(versions) {
+			return ErrDBReversion
+		}
+
+		counts := make(map[recordClass]uint64)
+		for _, v := range versions {
+			if v.number <= meta.DbVersionNumber {
+				continue
+			}
+			name := versionMigrationName(v)
+			if name == "" {
+				continue
+			}
+
+			// A migration without a cost model is assumed to be
+			// negligible.
+			cost := migrationCosts[v.number]
+
+			var numRecords uint64
+			for _, class := range cost.records {
+				count, ok := counts[class]
+				if !ok {
+					count, err = countRecords(tx, class)
+					if err != nil {
+						return err
+					}
+					counts[class] = count
+				}
+				numRecords += count
+			}
+
+			estimates[name] = time.Duration(numRecords) *
+				cost.perRecord
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return estimates, nil
+}
+
+// countRecords returns the number of records of the given class within the
+// database.
+func countRecords(tx *bbolt.Tx, class recordClass) (uint64, error) {
+	switch class {
+	case recordClassNodes:
+		nodes := tx.Bucket(nodeBucket)
+		if nodes == nil {
+			return 0, nil
+		}
+
+		var count uint64
+		err := nodes.ForEach(func(k, v []byte) error {
+			if v != nil && len(k) == 33 {
+				count++
+			}
+			return nil
+		})
+		return count, err
+
+	case recordClassEdges:
+		edges := tx.Bucket(edgeBucket)
+		if edges == nil {
+			return 0, nil
+		}
+		return countValues(edges.Bucket(edgeIndexBucket)), nil
+
+	case recordClassInvoices:
+		return countValues(tx.Bucket(invoiceBucket)), nil
+
+	case recordClassPayments:
+		return countValues(tx.Bucket(paymentBucket)), nil
+
+	case recordClassOpenChannels:
+		openChanBucket := tx.Bucket(openChannelBucket)
+		if openChanBucket == nil {
+			return 0, nil
+		}
+
+		var count uint64
+		err := forEachChanBucket(openChanBucket,
+			func(wire.OutPoint, *bbolt.Bucket) error {
+				count++
+				return nil
+			},
+		)
+		return count, err
+
+	case recordClassClosedChannels:
+		return countValues(tx.Bucket(closedChannelBucket)), nil
+
+	case recordClassForwards:
+		return countValues(tx.Bucket(forwardingLogBucket)), nil
+
+	case recordClassGossip:
+		return countValues(tx.Bucket(messageStoreBucket)), nil
+
+	default:
+		return 0, nil
+	}
+}
+
+// countValues returns the number of keys within the bucket that hold a value
+// rather than a nested bucket. A nil bucket holds no values.
+func countValues(bucket *bbolt.Bucket) uint64 {
+	if bucket == nil {
+		return 0
+	}
+
+	var count uint64
+	cursor := bucket.Cursor()
+	for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+		if v != nil {
+			count++
+		}
+	}
+
+	return count
+}
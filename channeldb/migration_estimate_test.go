@@ -0,0 +1,126 @@
+package channeldb
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/coreos/bbolt"
+)
+
+// TestMigrationCostModels asserts that the cost of every migration is modeled,
+// such that new migrations aren't silently estimated as free.
+func TestMigrationCostModels(t *testing.T) {
+	t.Parallel()
+
+	for _, v := range dbVersions {
+		if versionMigrationName(v) == "" {
+			continue
+		}
+		if _, ok := migrationCosts[v.number]; !ok {
+			t.Fatalf("no cost model for migration %v to version %v",
+				versionMigrationName(v), v.number)
+		}
+	}
+}
+
+// TestEstimateMigrationTime asserts that the pending migrations of a database
+// opened read-only are estimated by the number of records they process, and
+// that the database can't be written to.
+func TestEstimateMigrationTime(t *testing.T) {
+	t.Parallel()
+
+	dbPath, err := ioutil.TempDir("", "channeldb")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+
+	db, err := Open(dbPath, OptionSetSyncMode(NoSync))
+	if err != nil {
+		t.Fatalf("unable to open db: %v", err)
+	}
+
+	const numInvoices = 5
+	for i := 0; i < numInvoices; i++ {
+		invoice, err := randInvoice(1000)
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+		hash := invoice.Terms.PaymentPreimage.Hash()
+		if _, err := db.AddInvoice(invoice, hash); err != nil {
+			t.Fatalf("unable to add invoice: %v", err)
+		}
+	}
+
+	// With the database rolled back to the version preceding the
+	// migration of invoice HTLCs, it and all later migrations should be
+	// pending once it's reopened.
+	const rolledBack = 20
+	latest := getLatestDBVersion(dbVersions)
+	if err := db.PutMeta(&Meta{DbVersionNumber: rolledBack}); err != nil {
+		t.Fatalf("unable to roll back db version: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("unable to close db: %v", err)
+	}
+
+	db, err = Open(dbPath, OptionSetReadOnly(true))
+	if err != nil {
+		t.Fatalf("unable to open db read-only: %v", err)
+	}
+	defer db.Close()
+
+	estimates, err := db.EstimateMigrationTime()
+	if err != nil {
+		t.Fatalf("unable to estimate migration time: %v", err)
+	}
+	if len(estimates) != int(latest-rolledBack) {
+		t.Fatalf("expected %v pending migrations, got %v",
+			latest-rolledBack, estimates)
+	}
+
+	// The invoices are the only records processed by the first of the
+	// pending migrations.
+	expected := numInvoices * migrationCosts[rolledBack+1].perRecord
+	estimate, ok := estimates["migrateInvoiceHtlcAttempts"]
+	if !ok {
+		t.Fatalf("no estimate for invoice migration")
+	}
+	if estimate != expected {
+		t.Fatalf("expected estimate %v, got %v", expected, estimate)
+	}
+
+	// Reading the version must not have migrated the database, and
+	// writing to it must fail.
+	meta, err := db.FetchMeta(nil)
+	if err != nil {
+		t.Fatalf("unable to fetch meta: %v", err)
+	}
+	if meta.DbVersionNumber != rolledBack {
+		t.Fatalf("expected db version %v, got %v", rolledBack,
+			meta.DbVersionNumber)
+	}
+	err = db.Update(func(*bbolt.Tx) error {
+		return nil
+	})
+	if err != bbolt.ErrDatabaseReadOnly {
+		t.Fatalf("expected ErrDatabaseReadOnly, got %v", err)
+	}
+
+	// Once the database has been migrated, nothing is pending.
+	if err := db.Close(); err != nil {
+		t.Fatalf("unable to close db: %v", err)
+	}
+	db, err = Open(dbPath, OptionSetSyncMode(NoSync))
+	if err != nil {
+		t.Fatalf("unable to open db: %v", err)
+	}
+	estimates, err = db.EstimateMigrationTime()
+	if err != nil {
+		t.Fatalf("unable to estimate migration time: %v", err)
+	}
+	if len(estimates) != 0 {
+		t.Fatalf("expected no pending migrations, got %v", estimates)
+	}
+}
@@ -0,0 +1,161 @@
+package channeldb
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btclog"
+)
+
+// migrationLogger is a logger that enriches every message logged by a
+// migration with the context it's applied in: the name of the migration, the
+// version transition it performs and the path of the database. Each line is
+// emitted in logfmt, allowing the progress of a migration to be parsed by
+// external tooling. A line logged by the edge policy migration would look like
+// this (wrapped):
+//
+//	migration=migrateEdgePolicies fromVersion=3 toVersion=4
+//	dbPath="/path/to/db" msg="Migration of edge policies complete!"
+//
+// As migrations may log a trace message for every record they visit, trace and
+// debug messages are only formatted if their level is enabled.
+type migrationLogger struct {
+	btclog.Logger
+
+	// fields is the pre-formatted set of fields that's prepended to each
+	// message.
+	fields string
+}
+
+// A compile-time check to ensure migrationLogger implements the
+// btclog.Logger interface.
+var _ btclog.Logger = (*migrationLogger)(nil)
+
+// newMigrationLogger returns a logger for the migration that moves the
+// database at dbPath from fromVersion to toVersion. The migration is either a
+// migration or a batchMigration. All messages are passed on to the given
+// logger.
+func newMigrationLogger(logger btclog.Logger, m interface{}, fromVersion,
+	toVersion uint32, dbPath string) *migrationLogger {
+
+	fields := fmt.Sprintf("migration=%v fromVersion=%v toVersion=%v "+
+		"dbPath=%v", migrationName(m), fromVersion, toVersion,
+		strconv.Quote(dbPath))
+
+	return &migrationLogger{
+		Logger: logger,
+		fields: fields,
+	}
+}
+
+// migrationName returns the name of the function implementing the migration,
+// stripped of its package path.
+func migrationName(m interface{}) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(m).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+
+	name := fn.Name()
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+
+	return name
+}
+
+// format prepends the migration's fields to the message.
+func (l *migrationLogger) format(msg string) string {
+	return l.fields + " msg=" + strconv.Quote(msg)
+}
+
+// Tracef formats message according to format specifier and writes to log
+// with LevelTrace.
+func (l *migrationLogger) Tracef(format string, params ...interface{}) {
+	if l.Level() > btclog.LevelTrace {
+		return
+	}
+
+	l.Logger.Trace(l.format(fmt.Sprintf(format, params...)))
+}
+
+// Debugf formats message according to format specifier and writes to log
+// with LevelDebug.
+func (l *migrationLogger) Debugf(format string, params ...interface{}) {
+	if l.Level() > btclog.LevelDebug {
+		return
+	}
+
+	l.Logger.Debug(l.format(fmt.Sprintf(format, params...)))
+}
+
+// Infof formats message according to format specifier and writes to log
+// with LevelInfo.
+func (l *migrationLogger) Infof(format string, params ...interface{}) {
+	l.Logger.Info(l.format(fmt.Sprintf(format, params...)))
+}
+
+// Warnf formats message according to format specifier and writes to log
+// with LevelWarn.
+func (l *migrationLogger) Warnf(format string, params ...interface{}) {
+	l.Logger.Warn(l.format(fmt.Sprintf(format, params...)))
+}
+
+// Errorf formats message according to format specifier and writes to log
+// with LevelError.
+func (l *migrationLogger) Errorf(format string, params ...interface{}) {
+	l.Logger.Error(l.format(fmt.Sprintf(format, params...)))
+}
+
+// Criticalf formats message according to format specifier and writes to log
+// with LevelCritical.
+func (l *migrationLogger) Criticalf(format string, params ...interface{}) {
+	l.Logger.Critical(l.format(fmt.Sprintf(format, params...)))
+}
+
+// Trace formats message using the default formats for its operands and
+// writes to log with LevelTrace.
+func (l *migrationLogger) Trace(v ...interface{}) {
+	if l.Level() > btclog.LevelTrace {
+		return
+	}
+
+	l.Logger.Trace(l.format(fmt.Sprint(v...)))
+}
+
+// Debug formats message using the default formats for its operands and
+// writes to log with LevelDebug.
+func (l *migrationLogger) Debug(v ...interface{}) {
+	if l.Level() > btclog.LevelDebug {
+		return
+	}
+
+	l.Logger.Debug(l.format(fmt.Sprint(v...)))
+}
+
+// Info formats message using the default formats for its operands and
+// writes to log with LevelInfo.
+func (l *migrationLogger) Info(v ...interface{}) {
+	l.Logger.Info(l.format(fmt.Sprint(v...)))
+}
+
+// Warn formats message using the default formats for its operands and
+// writes to log with LevelWarn.
+func (l *migrationLogger) Warn(v ...interface{}) {
+	l.Logger.Warn(l.format(fmt.Sprint(v...)))
+}
+
+// Error formats message using the default formats for its operands and
+// writes to log with LevelError.
+func (l *migrationLogger) Error(v ...interface{}) {
+	l.Logger.Error(l.format(fmt.Sprint(v...)))
+}
+
+// Critical formats message using the default formats for its operands and
+// writes to log with LevelCritical.
+func (l *migrationLogger) Critical(v ...interface{}) {
+	l.Logger.Critical(l.format(fmt.Sprint(v...)))
+}
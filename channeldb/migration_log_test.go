@@ -0,0 +1,86 @@
+package channeldb
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+	"github.com/coreos/bbolt"
+)
+
+// TestMigrationLogger asserts that messages logged through a migration logger
+// carry the migration's context, and that disabled levels are suppressed.
+func TestMigrationLogger(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+	backend := btclog.NewBackend(&b).Logger("TEST")
+	backend.SetLevel(btclog.LevelInfo)
+
+	logger := newMigrationLogger(
+		backend, migrateEdgePolicies, 3, 4, "/path/to/db",
+	)
+	logger.Tracef("Adding edge policy for channel %v", 1)
+	logger.Infof("Migrated %v edge policies", 2)
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected a single log line, got %q", b.String())
+	}
+
+	const expected = `migration=migrateEdgePolicies fromVersion=3 ` +
+		`toVersion=4 dbPath="/path/to/db" msg="Migrated 2 edge policies"`
+	if !strings.HasSuffix(lines[0], expected) {
+		t.Fatalf("expected log line to end with %q, got %q", expected,
+			lines[0])
+	}
+}
+
+// TestMigrationLoggerVersions asserts that each migration applied by
+// syncVersions is passed a logger describing the version transition it
+// performs.
+func TestMigrationLoggerVersions(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutMeta(&Meta{DbVersionNumber: 0}); err != nil {
+		t.Fatalf("unable to store meta data: %v", err)
+	}
+
+	var fields []string
+	recordFields := func(tx *bbolt.Tx, log btclog.Logger) error {
+		fields = append(fields, log.(*migrationLogger).fields)
+		return nil
+	}
+
+	versions := []version{
+		{number: 0},
+		{number: 1, migration: recordFields},
+		{number: 2},
+		{number: 3, migration: recordFields},
+	}
+	if err := db.syncVersions(versions); err != nil {
+		t.Fatalf("unable to sync versions: %v", err)
+	}
+
+	if len(fields) != 2 {
+		t.Fatalf("expected 2 applied migrations, got %v", len(fields))
+	}
+	for i, transition := range []string{
+		"fromVersion=0 toVersion=1", "fromVersion=2 toVersion=3",
+	} {
+		if !strings.Contains(fields[i], transition) {
+			t.Fatalf("expected fields %q to contain %q", fields[i],
+				transition)
+		}
+		if !strings.Contains(fields[i], db.Path()) {
+			t.Fatalf("expected fields %q to contain db path %v",
+				fields[i], db.Path())
+		}
+	}
+}
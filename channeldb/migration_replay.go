@@ -0,0 +1,170 @@
+package channeldb
+
+import (
+	"fmt"
+
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// ErrMigrationNotFound is returned when no migration is implemented by
+	// a function of the requested name.
+	ErrMigrationNotFound = fmt.Errorf("migration not found")
+
+	// ErrMigrationAlreadyApplied is returned when a migration that has
+	// already been applied is replayed without being forced.
+	ErrMigrationAlreadyApplied = fmt.Errorf("migration already applied")
+
+	// ErrMigrationNotDue is returned when a migration is replayed without
+	// being forced, while the migrations preceding it haven't been applied
+	// yet.
+	ErrMigrationNotDue = fmt.Errorf("preceding migrations not applied")
+)
+
+// UnsafeRunMigration applies the single migration implemented by the function
+// of the given name, for example "migrateChannelUUIDs". Unless forced, the
+// migration is only applied if it's the next one due, in which case the
+// database version is bumped just as it would be on startup. A forced
+// migration is applied regardless of the database version, which is left
+// untouched. The migration is applied within a single transaction, including
+// batch migrations, so it either takes effect as a whole or not at all.
+//
+// NOTE: Most migrations aren't idempotent, and replaying one on a database
+// that's already been migrated may corrupt it. This is only intended for
+// development, or for re-building an index after manually repairing the
+// database.
+func (d *DB) UnsafeRunMigration(name string, force bool) error {
+	return d.unsafeRunMigration(dbVersions, name, force)
+}
+
+// unsafeRunMigration is UnsafeRunMigration with a custom set of versions to
+// look up the migration in.
+func (d *DB) unsafeRunMigration(versions []version, name string,
+	force bool) error {
+
+	var v *version
+	for i := range versions {
+		if name != "" && versionMigrationName(versions[i]) == name {
+			v = &versions[i]
+			break
+		}
+	}
+	if v == nil {
+		return ErrMigrationNotFound
+	}
+
+	return d.Update(func(tx *bbolt.Tx) error {
+		meta := &Meta{}
+		err := fetchMeta(meta, tx)
+		if err != nil && err != ErrMetaNotFound {
+			return err
+		}
+
+		if !force {
+			switch {
+			case meta.DbVersionNumber >= v.number:
+				return ErrMigrationAlreadyApplied
+			case meta.DbVersionNumber+1 != v.number:
+				return ErrMigrationNotDue
+			}
+		}
+
+		if v.migration != nil {
+			migrationLog := newMigrationLogger(
+				log, v.migration, meta.DbVersionNumber,
+				v.number, d.dbPath,
+			)
+			migrationLog.Warnf("Replaying migration #%v (force=%v)",
+				v.number, force)
+
+			if err := v.migration(tx, migrationLog); err != nil {
+				return err
+			}
+		} else {
+			err := replayBatchMigration(
+				tx, v, meta.DbVersionNumber, force, d.dbPath,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Migrations rewrite buckets directly, so the checksums of those
+		// buckets must be brought up to date.
+		if err := refreshBucketChecksums(tx); err != nil {
+			return err
+		}
+
+		if force {
+			return nil
+		}
+
+		meta.DbVersionNumber = v.number
+		return putMeta(meta, tx)
+	})
+}
+
+// replayBatchMigration applies all batches of the passed batch migration
+// within the given transaction. A forced replay discards any checkpoint left
+// behind by an interrupted run of the migration, and starts over.
+func replayBatchMigration(tx *bbolt.Tx, v *version, fromVersion uint32,
+	force bool, dbPath string) error {
+
+	migrationLog := newMigrationLogger(
+		log, v.batchMigration, fromVersion, v.number, dbPath,
+	)
+	migrationLog.Warnf("Replaying migration #%v in a single transaction "+
+		"(force=%v)", v.number, force)
+
+	var versionKey [4]byte
+	byteOrder.PutUint32(versionKey[:], v.number)
+
+	checkpoints, err := tx.CreateBucketIfNotExists(
+		migrationCheckpointBucket,
+	)
+	if err != nil {
+		return err
+	}
+	if force {
+		err := checkpoints.DeleteBucket(versionKey[:])
+		if err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+	}
+	checkpoint, err := checkpoints.CreateBucketIfNotExists(versionKey[:])
+	if err != nil {
+		return err
+	}
+
+	for done := false; !done; {
+		done, err = v.batchMigration(
+			tx, checkpoint, migrationBatchSize, migrationLog,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	// With the migration complete, its checkpoint is no longer needed.
+	if err := checkpoints.DeleteBucket(versionKey[:]); err != nil {
+		return err
+	}
+	if k, _ := checkpoints.Cursor().First(); k != nil {
+		return nil
+	}
+
+	return tx.DeleteBucket(migrationCheckpointBucket)
+}
+
+// versionMigrationName returns the name of the function implementing the
+// migration of the passed version, or an empty string if it has none.
+func versionMigrationName(v version) string {
+	switch {
+	case v.migration != nil:
+		return migrationName(v.migration)
+	case v.batchMigration != nil:
+		return migrationName(v.batchMigration)
+	default:
+		return ""
+	}
+}
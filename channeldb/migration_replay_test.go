@@ -0,0 +1,228 @@
+package channeldb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+	"github.com/coreos/bbolt"
+)
+
+// replayTestBucket is the bucket modified by the migrations replayed in
+// TestUnsafeRunMigration.
+var replayTestBucket = []byte("test-replay-bucket")
+
+// replayTestCounterKey is the key under which testReplayMigration counts how
+// often it was applied.
+var replayTestCounterKey = []byte("counter")
+
+// testReplayMigration counts the number of times it has been applied.
+func testReplayMigration(tx *bbolt.Tx, _ btclog.Logger) error {
+	bucket, err := tx.CreateBucketIfNotExists(replayTestBucket)
+	if err != nil {
+		return err
+	}
+
+	counter := append(bucket.Get(replayTestCounterKey), 'x')
+	return bucket.Put(replayTestCounterKey, counter)
+}
+
+// testReplayBatchMigration appends a marker to each record of the nested
+// records bucket.
+func testReplayBatchMigration(tx *bbolt.Tx, checkpoint *bbolt.Bucket,
+	batchSize int, _ btclog.Logger) (bool, error) {
+
+	records := tx.Bucket(replayTestBucket).Bucket([]byte("records"))
+	return reserializeBatch(
+		checkpoint, replayTestBucket, records, batchSize,
+		func(k, v []byte) ([]byte, error) {
+			newValue := append([]byte(nil), v...)
+			return append(newValue, 'x'), nil
+		},
+	)
+}
+
+// TestUnsafeRunMigration asserts that a migration is only replayed without
+// being forced if it's the next one due, and that forced replays leave the
+// database version untouched.
+func TestUnsafeRunMigration(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+
+	// Migrations of the actual database versions have all been applied to
+	// a new database.
+	err = db.UnsafeRunMigration("migrateChannelUUIDs", false)
+	if err != ErrMigrationAlreadyApplied {
+		t.Fatalf("expected ErrMigrationAlreadyApplied, got %v", err)
+	}
+
+	// We'll start out at version 0 of a set of test versions, with a few
+	// records for the batch migration to modify.
+	const numRecords = 5
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucket(replayTestBucket)
+		if err != nil {
+			return err
+		}
+		records, err := bucket.CreateBucket([]byte("records"))
+		if err != nil {
+			return err
+		}
+		for i := byte(0); i < numRecords; i++ {
+			err := records.Put([]byte{i}, []byte{i})
+			if err != nil {
+				return err
+			}
+		}
+
+		return putMeta(&Meta{DbVersionNumber: 0}, tx)
+	})
+	if err != nil {
+		t.Fatalf("unable to populate database: %v", err)
+	}
+
+	versions := []version{
+		{number: 0},
+		{number: 1, migration: testReplayMigration},
+		{number: 2, batchMigration: testReplayBatchMigration},
+	}
+	run := func(name string, force bool, expectedErr error) {
+		t.Helper()
+
+		err := db.unsafeRunMigration(versions, name, force)
+		if err != expectedErr {
+			t.Fatalf("expected error %v running %v (force=%v), "+
+				"got %v", expectedErr, name, force, err)
+		}
+	}
+	assertState := func(expectedVersion uint32, numApplied,
+		numBatchApplied int) {
+
+		t.Helper()
+
+		meta, err := db.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch meta: %v", err)
+		}
+		if meta.DbVersionNumber != expectedVersion {
+			t.Fatalf("expected db version %v, got %v",
+				expectedVersion, meta.DbVersionNumber)
+		}
+
+		err = db.View(func(tx *bbolt.Tx) error {
+			bucket := tx.Bucket(replayTestBucket)
+
+			counter := bucket.Get(replayTestCounterKey)
+			if len(counter) != numApplied {
+				t.Fatalf("expected migration to be applied %v "+
+					"times, got %v", numApplied,
+					len(counter))
+			}
+
+			records := bucket.Bucket([]byte("records"))
+			for i := byte(0); i < numRecords; i++ {
+				expected := append(
+					[]byte{i}, bytes.Repeat(
+						[]byte{'x'}, numBatchApplied,
+					)...,
+				)
+				v := records.Get([]byte{i})
+				if !bytes.Equal(v, expected) {
+					t.Fatalf("expected record %v to be "+
+						"%x, got %x", i, expected, v)
+				}
+			}
+
+			if tx.Bucket(migrationCheckpointBucket) != nil {
+				t.Fatalf("expected checkpoint to be removed")
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to read database: %v", err)
+		}
+	}
+
+	run("migrateUnknown", false, ErrMigrationNotFound)
+	run("testReplayBatchMigration", false, ErrMigrationNotDue)
+	assertState(0, 0, 0)
+
+	// Applying the next migration due should bump the database version,
+	// after which it can only be replayed if forced.
+	run("testReplayMigration", false, nil)
+	assertState(1, 1, 0)
+	run("testReplayMigration", false, ErrMigrationAlreadyApplied)
+	run("testReplayMigration", true, nil)
+	assertState(1, 2, 0)
+
+	// The same applies to batch migrations, which are applied as a whole.
+	run("testReplayBatchMigration", false, nil)
+	assertState(2, 2, 1)
+	run("testReplayBatchMigration", false, ErrMigrationAlreadyApplied)
+	run("testReplayBatchMigration", true, nil)
+	assertState(2, 2, 2)
+}
+
+// testReplayChecksumMigration writes to the forwarding log directly, bypassing
+// the maintenance of its checksum.
+func testReplayChecksumMigration(tx *bbolt.Tx, _ btclog.Logger) error {
+	bucket, err := tx.CreateBucketIfNotExists(forwardingLogBucket)
+	if err != nil {
+		return err
+	}
+
+	counter := append(bucket.Get(replayTestCounterKey), 'x')
+	return bucket.Put(replayTestCounterKey, counter)
+}
+
+// TestUnsafeRunMigrationChecksums asserts that replaying a migration brings
+// the checksums of the buckets it rewrote up to date.
+func TestUnsafeRunMigrationChecksums(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+
+	err = db.EnableBucketChecksum(string(forwardingLogBucket))
+	if err != nil {
+		t.Fatalf("unable to enable checksum: %v", err)
+	}
+
+	// We'll start out at version 0 of a set of test versions, such that
+	// the migration is first applied as the next one due, and then forced.
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return putMeta(&Meta{DbVersionNumber: 0}, tx)
+	})
+	if err != nil {
+		t.Fatalf("unable to reset db version: %v", err)
+	}
+
+	versions := []version{
+		{number: 0},
+		{number: 1, migration: testReplayChecksumMigration},
+	}
+	for _, force := range []bool{false, true} {
+		err := db.unsafeRunMigration(
+			versions, "testReplayChecksumMigration", force,
+		)
+		if err != nil {
+			t.Fatalf("unable to replay migration (force=%v): %v",
+				force, err)
+		}
+
+		err = db.VerifyBucketChecksum(string(forwardingLogBucket))
+		if err != nil {
+			t.Fatalf("unable to verify checksum (force=%v): %v",
+				force, err)
+		}
+	}
+}
@@ -5,7 +5,11 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"time"
 
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
 	"github.com/coreos/bbolt"
 	"github.com/lightningnetwork/lnd/lnwire"
 )
@@ -15,7 +19,7 @@ import (
 // (one for nodes and one for edges) to keep track of the last time a node or
 // edge was updated on the network. These new indexes allow us to implement the
 // new graph sync protocol added.
-func migrateNodeAndEdgeUpdateIndex(tx *bbolt.Tx) error {
+func migrateNodeAndEdgeUpdateIndex(tx *bbolt.Tx, log btclog.Logger) error {
 	// First, we'll populating the node portion of the new index. Before we
 	// can add new values to the index, we'll first create the new bucket
 	// where these items will be housed.
@@ -119,196 +123,223 @@ func migrateNodeAndEdgeUpdateIndex(tx *bbolt.Tx) error {
 // migrateInvoiceTimeSeries is a database migration that assigns all existing
 // invoices an index in the add and/or the settle index. Additionally, all
 // existing invoices will have their bytes padded out in order to encode the
-// add+settle index as well as the amount paid.
-func migrateInvoiceTimeSeries(tx *bbolt.Tx) error {
+// add+settle index as well as the amount paid. Invoices are migrated in
+// batches in the order of their keys, so that their index entries are
+// assigned in the same order as if they had been migrated at once. Each
+// batch is committed along with its index entries and checkpoint, such that
+// a resumed migration continues the sequence of either index.
+func migrateInvoiceTimeSeries(tx *bbolt.Tx, checkpoint *bbolt.Bucket,
+	batchSize int, log btclog.Logger) (bool, error) {
+
 	invoices, err := tx.CreateBucketIfNotExists(invoiceBucket)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	addIndex, err := invoices.CreateBucketIfNotExists(
 		addIndexBucket,
 	)
 	if err != nil {
-		return err
+		return false, err
 	}
 	settleIndex, err := invoices.CreateBucketIfNotExists(
 		settleIndexBucket,
 	)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	log.Infof("Migrating invoice database to new time series format")
+	if checkpoint.Get(invoiceBucket) == nil {
+		log.Infof("Migrating invoice database to new time series " +
+			"format")
+	}
 
-	// Now that we have all the buckets we need, we'll run through each
-	// invoice in the database, and update it to reflect the new format
-	// expected post migration.
-	err = invoices.ForEach(func(invoiceNum, invoiceBytes []byte) error {
-		// If this is a sub bucket, then we'll skip it.
-		if invoiceBytes == nil {
-			return nil
-		}
+	// Now that we have all the buckets we need, we'll run through the
+	// next batch of invoices in the database, and update each to reflect
+	// the new format expected post migration.
+	done, err := reserializeBatch(
+		checkpoint, invoiceBucket, invoices, batchSize,
+		func(invoiceNum, invoiceBytes []byte) ([]byte, error) {
+			return migrateInvoiceTimeSeriesInvoice(
+				addIndex, settleIndex, invoiceNum,
+				invoiceBytes, log,
+			)
+		},
+	)
+	if err != nil || !done {
+		return false, err
+	}
 
-		// First, we'll make a copy of the encoded invoice bytes.
-		invoiceBytesCopy := make([]byte, len(invoiceBytes))
-		copy(invoiceBytesCopy, invoiceBytes)
+	log.Infof("Migration to invoice time series index complete!")
 
-		// With the bytes copied over, we'll append 24 additional
-		// bytes. We do this so we can decode the invoice under the new
-		// serialization format.
-		padding := bytes.Repeat([]byte{0}, 24)
-		invoiceBytesCopy = append(invoiceBytesCopy, padding...)
+	return true, nil
+}
 
-		invoiceReader := bytes.NewReader(invoiceBytesCopy)
-		invoice, err := deserializeInvoice(invoiceReader)
-		if err != nil {
-			return fmt.Errorf("unable to decode invoice: %v", err)
-		}
+// migrateInvoiceTimeSeriesInvoice adds the invoice with the passed number to
+// the add index, and to the settle index if it's settled, returning the
+// invoice in the new format.
+func migrateInvoiceTimeSeriesInvoice(addIndex, settleIndex *bbolt.Bucket,
+	invoiceNum, invoiceBytes []byte, log btclog.Logger) ([]byte, error) {
 
-		// Now that we have the fully decoded invoice, we can update
-		// the various indexes that we're added, and finally the
-		// invoice itself before re-inserting it.
+	// First, we'll make a copy of the encoded invoice bytes.
+	invoiceBytesCopy := make([]byte, len(invoiceBytes))
+	copy(invoiceBytesCopy, invoiceBytes)
 
-		// First, we'll get the new sequence in the addIndex in order
-		// to create the proper mapping.
-		nextAddSeqNo, err := addIndex.NextSequence()
-		if err != nil {
-			return err
-		}
-		var seqNoBytes [8]byte
-		byteOrder.PutUint64(seqNoBytes[:], nextAddSeqNo)
-		err = addIndex.Put(seqNoBytes[:], invoiceNum[:])
-		if err != nil {
-			return err
-		}
+	// With the bytes copied over, we'll append 24 additional
+	// bytes. We do this so we can decode the invoice under the new
+	// serialization format.
+	padding := bytes.Repeat([]byte{0}, 24)
+	invoiceBytesCopy = append(invoiceBytesCopy, padding...)
 
-		log.Tracef("Adding invoice (preimage=%x, add_index=%v) to add "+
-			"time series", invoice.Terms.PaymentPreimage[:],
-			nextAddSeqNo)
+	invoiceReader := bytes.NewReader(invoiceBytesCopy)
+	invoice, err := deserializeInvoiceV8(invoiceReader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode invoice: %v", err)
+	}
 
-		// Next, we'll check if the invoice has been settled or not. If
-		// so, then we'll also add it to the settle index.
-		var nextSettleSeqNo uint64
-		if invoice.Terms.State == ContractSettled {
-			nextSettleSeqNo, err = settleIndex.NextSequence()
-			if err != nil {
-				return err
-			}
+	// Now that we have the fully decoded invoice, we can update
+	// the various indexes that we're added, and finally the
+	// invoice itself before re-inserting it.
 
-			var seqNoBytes [8]byte
-			byteOrder.PutUint64(seqNoBytes[:], nextSettleSeqNo)
-			err := settleIndex.Put(seqNoBytes[:], invoiceNum)
-			if err != nil {
-				return err
-			}
+	// First, we'll get the new sequence in the addIndex in order
+	// to create the proper mapping.
+	nextAddSeqNo, err := addIndex.NextSequence()
+	if err != nil {
+		return nil, err
+	}
+	var seqNoBytes [8]byte
+	byteOrder.PutUint64(seqNoBytes[:], nextAddSeqNo)
+	err = addIndex.Put(seqNoBytes[:], invoiceNum[:])
+	if err != nil {
+		return nil, err
+	}
 
-			invoice.AmtPaid = invoice.Terms.Value
+	log.Tracef("Adding invoice (preimage=%x, add_index=%v) to add "+
+		"time series", invoice.Terms.PaymentPreimage[:],
+		nextAddSeqNo)
 
-			log.Tracef("Adding invoice (preimage=%x, "+
-				"settle_index=%v) to add time series",
-				invoice.Terms.PaymentPreimage[:],
-				nextSettleSeqNo)
+	// Next, we'll check if the invoice has been settled or not. If
+	// so, then we'll also add it to the settle index.
+	var nextSettleSeqNo uint64
+	if invoice.Terms.State == ContractSettled {
+		nextSettleSeqNo, err = settleIndex.NextSequence()
+		if err != nil {
+			return nil, err
 		}
 
-		// Finally, we'll update the invoice itself with the new
-		// indexing information as well as the amount paid if it has
-		// been settled or not.
-		invoice.AddIndex = nextAddSeqNo
-		invoice.SettleIndex = nextSettleSeqNo
-
-		// We've fully migrated an invoice, so we'll now update the
-		// invoice in-place.
-		var b bytes.Buffer
-		if err := serializeInvoice(&b, &invoice); err != nil {
-			return err
+		var seqNoBytes [8]byte
+		byteOrder.PutUint64(seqNoBytes[:], nextSettleSeqNo)
+		err := settleIndex.Put(seqNoBytes[:], invoiceNum)
+		if err != nil {
+			return nil, err
 		}
 
-		return invoices.Put(invoiceNum, b.Bytes())
-	})
-	if err != nil {
-		return err
+		invoice.AmtPaid = invoice.Terms.Value
+
+		log.Tracef("Adding invoice (preimage=%x, "+
+			"settle_index=%v) to add time series",
+			invoice.Terms.PaymentPreimage[:],
+			nextSettleSeqNo)
 	}
 
-	log.Infof("Migration to invoice time series index complete!")
+	// Finally, we'll update the invoice itself with the new
+	// indexing information as well as the amount paid if it has
+	// been settled or not.
+	invoice.AddIndex = nextAddSeqNo
+	invoice.SettleIndex = nextSettleSeqNo
+
+	// We've fully migrated an invoice, so we'll now hand it back to
+	// be updated in-place.
+	var b bytes.Buffer
+	if err := serializeInvoiceV8(&b, &invoice); err != nil {
+		return nil, err
+	}
 
-	return nil
+	return b.Bytes(), nil
 }
 
 // migrateInvoiceTimeSeriesOutgoingPayments is a follow up to the
 // migrateInvoiceTimeSeries migration. As at the time of writing, the
 // OutgoingPayment struct embeddeds an instance of the Invoice struct. As a
 // result, we also need to migrate the internal invoice to the new format.
-func migrateInvoiceTimeSeriesOutgoingPayments(tx *bbolt.Tx) error {
+func migrateInvoiceTimeSeriesOutgoingPayments(tx *bbolt.Tx,
+	checkpoint *bbolt.Bucket, batchSize int, log btclog.Logger) (bool,
+	error) {
+
 	payBucket := tx.Bucket(paymentBucket)
 	if payBucket == nil {
-		return nil
+		return true, nil
 	}
 
-	log.Infof("Migrating invoice database to new outgoing payment format")
-
-	err := payBucket.ForEach(func(payID, paymentBytes []byte) error {
-		log.Tracef("Migrating payment %x", payID[:])
-
-		// The internal invoices for each payment only contain a
-		// populated contract term, and creation date, as a result,
-		// most of the bytes will be "empty".
-
-		// We'll calculate the end of the invoice index assuming a
-		// "minimal" index that's embedded within the greater
-		// OutgoingPayment. The breakdown is:
-		//  3 bytes empty var bytes, 16 bytes creation date, 16 bytes
-		//  settled date, 32 bytes payment pre-image, 8 bytes value, 1
-		//  byte settled.
-		endOfInvoiceIndex := 1 + 1 + 1 + 16 + 16 + 32 + 8 + 1
-
-		// We'll now extract the prefix of the pure invoice embedded
-		// within.
-		invoiceBytes := paymentBytes[:endOfInvoiceIndex]
-
-		// With the prefix extracted, we'll copy over the invoice, and
-		// also add padding for the new 24 bytes of fields, and finally
-		// append the remainder of the outgoing payment.
-		paymentCopy := make([]byte, len(invoiceBytes))
-		copy(paymentCopy[:], invoiceBytes)
-
-		padding := bytes.Repeat([]byte{0}, 24)
-		paymentCopy = append(paymentCopy, padding...)
-		paymentCopy = append(
-			paymentCopy, paymentBytes[endOfInvoiceIndex:]...,
-		)
+	if checkpoint.Get(paymentBucket) == nil {
+		log.Infof("Migrating invoice database to new outgoing " +
+			"payment format")
+	}
 
-		// At this point, we now have the new format of the outgoing
-		// payments, we'll attempt to deserialize it to ensure the
-		// bytes are properly formatted.
-		paymentReader := bytes.NewReader(paymentCopy)
-		_, err := deserializeOutgoingPayment(paymentReader)
-		if err != nil {
-			return fmt.Errorf("unable to deserialize payment: %v", err)
-		}
+	done, err := reserializeBatch(
+		checkpoint, paymentBucket, payBucket, batchSize,
+		func(payID, paymentBytes []byte) ([]byte, error) {
+			log.Tracef("Migrating payment %x", payID[:])
+
+			// The internal invoices for each payment only contain
+			// a populated contract term, and creation date, as a
+			// result, most of the bytes will be "empty".
+
+			// We'll calculate the end of the invoice index
+			// assuming a "minimal" index that's embedded within
+			// the greater OutgoingPayment. The breakdown is:
+			//  3 bytes empty var bytes, 16 bytes creation date, 16
+			//  bytes settled date, 32 bytes payment pre-image, 8
+			//  bytes value, 1 byte settled.
+			endOfInvoiceIndex := 1 + 1 + 1 + 16 + 16 + 32 + 8 + 1
+
+			// We'll now extract the prefix of the pure invoice
+			// embedded within.
+			invoiceBytes := paymentBytes[:endOfInvoiceIndex]
+
+			// With the prefix extracted, we'll copy over the
+			// invoice, and also add padding for the new 24 bytes
+			// of fields, and finally append the remainder of the
+			// outgoing payment.
+			paymentCopy := make([]byte, len(invoiceBytes))
+			copy(paymentCopy[:], invoiceBytes)
+
+			padding := bytes.Repeat([]byte{0}, 24)
+			paymentCopy = append(paymentCopy, padding...)
+			paymentCopy = append(
+				paymentCopy,
+				paymentBytes[endOfInvoiceIndex:]...,
+			)
 
-		// Now that we know the modifications was successful, we'll
-		// write it back to disk in the new format.
-		if err := payBucket.Put(payID, paymentCopy); err != nil {
-			return err
-		}
+			// At this point, we now have the new format of the
+			// outgoing payments, we'll attempt to deserialize it
+			// to ensure the bytes are properly formatted.
+			paymentReader := bytes.NewReader(paymentCopy)
+			_, err := deserializeOutgoingPaymentV8(paymentReader)
+			if err != nil {
+				return nil, fmt.Errorf("unable to deserialize "+
+					"payment: %v", err)
+			}
 
-		return nil
-	})
-	if err != nil {
-		return err
+			// Now that we know the modifications was successful,
+			// it can be written back to disk in the new format.
+			return paymentCopy, nil
+		},
+	)
+	if err != nil || !done {
+		return false, err
 	}
 
 	log.Infof("Migration to outgoing payment invoices complete!")
 
-	return nil
+	return true, nil
 }
 
 // migrateEdgePolicies is a migration function that will update the edges
 // bucket. It ensure that edges with unknown policies will also have an entry
 // in the bucket. After the migration, there will be two edge entries for
 // every channel, regardless of whether the policies are known.
-func migrateEdgePolicies(tx *bbolt.Tx) error {
+func migrateEdgePolicies(tx *bbolt.Tx, log btclog.Logger) error {
 	nodes := tx.Bucket(nodeBucket)
 	if nodes == nil {
 		return nil
@@ -380,7 +411,7 @@ func migrateEdgePolicies(tx *bbolt.Tx) error {
 // paymentStatusesMigration is a database migration intended for adding payment
 // statuses for each existing payment entity in bucket to be able control
 // transitions of statuses and prevent cases such as double payment
-func paymentStatusesMigration(tx *bbolt.Tx) error {
+func paymentStatusesMigration(tx *bbolt.Tx, log btclog.Logger) error {
 	// Get the bucket dedicated to storing statuses of payments,
 	// where a key is payment hash, value is payment status.
 	paymentStatuses, err := tx.CreateBucketIfNotExists(paymentStatusBucket)
@@ -438,7 +469,7 @@ func paymentStatusesMigration(tx *bbolt.Tx) error {
 		}
 
 		r := bytes.NewReader(v)
-		payment, err := deserializeOutgoingPayment(r)
+		payment, err := deserializeOutgoingPaymentV8(r)
 		if err != nil {
 			return err
 		}
@@ -467,7 +498,7 @@ func paymentStatusesMigration(tx *bbolt.Tx) error {
 // migration also fixes the case where the public keys within edge policies were
 // being serialized with an extra byte, causing an even greater error when
 // attempting to perform the offset calculation described earlier.
-func migratePruneEdgeUpdateIndex(tx *bbolt.Tx) error {
+func migratePruneEdgeUpdateIndex(tx *bbolt.Tx, log btclog.Logger) error {
 	// To begin the migration, we'll retrieve the update index bucket. If it
 	// does not exist, we have nothing left to do so we can simply exit.
 	edges := tx.Bucket(edgeBucket)
@@ -564,7 +595,7 @@ func migratePruneEdgeUpdateIndex(tx *bbolt.Tx) error {
 			return err
 		}
 
-		err = updateEdgePolicy(tx, edgePolicy)
+		err = updateEdgePolicy(tx, edgePolicy, nil)
 		if err != nil {
 			return err
 		}
@@ -578,7 +609,9 @@ func migratePruneEdgeUpdateIndex(tx *bbolt.Tx) error {
 // migrateOptionalChannelCloseSummaryFields migrates the serialized format of
 // ChannelCloseSummary to a format where optional fields' presence is indicated
 // with boolean markers.
-func migrateOptionalChannelCloseSummaryFields(tx *bbolt.Tx) error {
+func migrateOptionalChannelCloseSummaryFields(tx *bbolt.Tx,
+	log btclog.Logger) error {
+
 	closedChanBucket := tx.Bucket(closedChannelBucket)
 	if closedChanBucket == nil {
 		return nil
@@ -597,7 +630,7 @@ func migrateOptionalChannelCloseSummaryFields(tx *bbolt.Tx) error {
 		// Serialize using the new format, and put back into the
 		// bucket.
 		var b bytes.Buffer
-		if err := serializeChannelCloseSummary(&b, c); err != nil {
+		if err := serializeChannelCloseSummaryV11(&b, c); err != nil {
 			return err
 		}
 
@@ -617,7 +650,7 @@ var messageStoreBucket = []byte("message-store")
 // migrateGossipMessageStoreKeys migrates the key format for gossip messages
 // found in the message store to a new one that takes into consideration the of
 // the message being stored.
-func migrateGossipMessageStoreKeys(tx *bbolt.Tx) error {
+func migrateGossipMessageStoreKeys(tx *bbolt.Tx, log btclog.Logger) error {
 	// We'll start by retrieving the bucket in which these messages are
 	// stored within. If there isn't one, there's nothing left for us to do
 	// so we can avoid the migration.
@@ -683,3 +716,1070 @@ func migrateGossipMessageStoreKeys(tx *bbolt.Tx) error {
 
 	return nil
 }
+
+// migrateInvoiceTLVStream migrates all invoices to the v9 database format,
+// where every serialized invoice is followed by a TLV stream housing its
+// optional records, such as any custom records. As outgoing payments embed an
+// invoice, the stream is also inserted within each stored payment directly
+// after its embedded invoice. Existing invoices carry no records, so an empty
+// stream is written for each of them.
+func migrateInvoiceTLVStream(tx *bbolt.Tx, checkpoint *bbolt.Bucket,
+	batchSize int, log btclog.Logger) (bool, error) {
+
+	var emptyStream bytes.Buffer
+	if err := writeTLVStream(&emptyStream, nil); err != nil {
+		return false, err
+	}
+
+	invoices := tx.Bucket(invoiceBucket)
+	if invoices != nil {
+		if checkpoint.Get(invoiceBucket) == nil {
+			log.Infof("Migrating invoices to the tlv stream format")
+		}
+
+		done, err := reserializeBatch(
+			checkpoint, invoiceBucket, invoices, batchSize,
+			func(k, v []byte) ([]byte, error) {
+				newInvoice := make(
+					[]byte, 0, len(v)+emptyStream.Len(),
+				)
+				newInvoice = append(newInvoice, v...)
+				newInvoice = append(
+					newInvoice, emptyStream.Bytes()...,
+				)
+
+				// Make sure the invoice can be decoded in the
+				// new format before we write it back.
+				_, err := deserializeInvoiceV9(
+					bytes.NewReader(newInvoice),
+				)
+				if err != nil {
+					return nil, fmt.Errorf("unable to "+
+						"decode invoice %x: %v", k, err)
+				}
+
+				return newInvoice, nil
+			},
+		)
+		if err != nil || !done {
+			return false, err
+		}
+	}
+
+	payments := tx.Bucket(paymentBucket)
+	if payments != nil {
+		if checkpoint.Get(paymentBucket) == nil {
+			log.Infof("Migrating outgoing payments to the tlv " +
+				"stream format")
+		}
+
+		done, err := reserializeBatch(
+			checkpoint, paymentBucket, payments, batchSize,
+			func(k, v []byte) ([]byte, error) {
+				// Decode the embedded invoice in order to find
+				// out where it ends, that's where the stream
+				// is to be inserted.
+				r := bytes.NewReader(v)
+				_, err := deserializeInvoiceV8(r)
+				if err != nil {
+					return nil, fmt.Errorf("unable to "+
+						"decode payment %x: %v", k, err)
+				}
+				invoiceEnd := len(v) - r.Len()
+
+				newPayment := make(
+					[]byte, 0, len(v)+emptyStream.Len(),
+				)
+				newPayment = append(
+					newPayment, v[:invoiceEnd]...,
+				)
+				newPayment = append(
+					newPayment, emptyStream.Bytes()...,
+				)
+				newPayment = append(
+					newPayment, v[invoiceEnd:]...,
+				)
+
+				return newPayment, nil
+			},
+		)
+		if err != nil || !done {
+			return false, err
+		}
+	}
+
+	log.Infof("Migration to invoice tlv stream format complete!")
+
+	return true, nil
+}
+
+// migrateOutgoingPaymentTLVStream migrates all outgoing payments to the v10
+// database format, where each payment ends with its own TLV stream, distinct
+// from the one of the embedded invoice. None of the existing payments carry
+// any records, so an empty stream is appended to each of them.
+func migrateOutgoingPaymentTLVStream(tx *bbolt.Tx, checkpoint *bbolt.Bucket,
+	batchSize int, log btclog.Logger) (bool, error) {
+
+	payments := tx.Bucket(paymentBucket)
+	if payments == nil {
+		return true, nil
+	}
+
+	if checkpoint.Get(paymentBucket) == nil {
+		log.Infof("Migrating outgoing payments to carry a tlv stream")
+	}
+
+	var emptyStream bytes.Buffer
+	if err := writeTLVStream(&emptyStream, nil); err != nil {
+		return false, err
+	}
+
+	done, err := reserializeBatch(
+		checkpoint, paymentBucket, payments, batchSize,
+		func(k, v []byte) ([]byte, error) {
+			newPayment := make([]byte, 0, len(v)+emptyStream.Len())
+			newPayment = append(newPayment, v...)
+			newPayment = append(newPayment, emptyStream.Bytes()...)
+
+			r := bytes.NewReader(newPayment)
+			_, err := deserializeOutgoingPaymentV10(r)
+			if err != nil {
+				return nil, fmt.Errorf("unable to decode "+
+					"payment %x: %v", k, err)
+			}
+
+			return newPayment, nil
+		},
+	)
+	if err != nil || !done {
+		return false, err
+	}
+
+	log.Infof("Migration of outgoing payment tlv stream complete!")
+
+	return true, nil
+}
+
+// migrateReportSkewedTimestamps reports all node announcements and channel
+// updates whose update time is implausibly offset from those of the records
+// related to them, which is the result of it having been stored using local
+// time rather than UTC. As the update times are covered by
+// the records' signatures, the records are left untouched. Instead, each of
+// them is logged, allowing an operator to remove them using
+// ChannelGraph.PruneSkewedTimestamps.
+func migrateReportSkewedTimestamps(tx *bbolt.Tx, log btclog.Logger) error {
+	log.Infof("Checking graph for update times stored in local time")
+
+	skewed, err := findSkewedTimestamps(
+		tx, time.Now(), DefaultTimestampSkewWindow,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range skewed {
+		if s.IsNode {
+			log.Warnf("Node announcement of %x has update time %v, "+
+				"suspected local time offset of %v", s.NodePub,
+				s.LastUpdate, s.Offset)
+			continue
+		}
+
+		log.Warnf("Channel update of %v (flags=%v) has update time %v, "+
+			"suspected local time offset of %v", s.ChannelID,
+			s.ChannelFlags, s.LastUpdate, s.Offset)
+	}
+
+	log.Infof("Found %v graph records with suspected local update "+
+		"times", len(skewed))
+
+	return nil
+}
+
+// migrateCloseSummarySweptFlag migrates all channel close summaries to the v12
+// database format, which carries a flag indicating whether the output paying
+// out our settled balance has been swept. The flag directly follows the fixed
+// size fields at the start of each summary, and is set to false for all
+// existing summaries.
+func migrateCloseSummarySweptFlag(tx *bbolt.Tx, log btclog.Logger) error {
+	closedChanBucket := tx.Bucket(closedChannelBucket)
+	if closedChanBucket == nil {
+		return nil
+	}
+
+	// All fields preceding the flag are of fixed size: the channel point,
+	// short channel ID, chain hash, closing txid, close height, remote
+	// public key, the three balances, the close type and the pending flag.
+	const sweptFlagOffset = 36 + 8 + 32 + 32 + 4 + 33 + 3*8 + 1 + 1
+
+	log.Infof("Migrating closed channels to carry a swept flag")
+
+	migrated := make(map[string][]byte)
+	err := closedChanBucket.ForEach(func(chanID, summary []byte) error {
+		if summary == nil {
+			return nil
+		}
+
+		// Ensure that the summary is well formed before we modify it.
+		r := bytes.NewReader(summary)
+		if _, err := deserializeCloseChannelSummaryV11(r); err != nil {
+			return fmt.Errorf("unable to decode close summary "+
+				"%x: %v", chanID, err)
+		}
+
+		newSummary := make([]byte, 0, len(summary)+1)
+		newSummary = append(newSummary, summary[:sweptFlagOffset]...)
+		newSummary = append(newSummary, 0)
+		newSummary = append(newSummary, summary[sweptFlagOffset:]...)
+
+		migrated[string(chanID)] = newSummary
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for chanID, summary := range migrated {
+		err := closedChanBucket.Put([]byte(chanID), summary)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Migration of closed channel swept flag complete!")
+
+	return nil
+}
+
+// migrateChannelUUIDs assigns a random UUID to each open channel, and indexes
+// all channels by their UUID. The UUID is stored under its own key within the
+// bucket of each channel, leaving the existing channel records untouched.
+func migrateChannelUUIDs(tx *bbolt.Tx, log btclog.Logger) error {
+	openChanBucket := tx.Bucket(openChannelBucket)
+	if openChanBucket == nil {
+		return nil
+	}
+
+	log.Infof("Assigning UUIDs to open channels")
+
+	var numChannels int
+	err := openChanBucket.ForEach(func(nodePub, v []byte) error {
+		if len(nodePub) != 33 || v != nil {
+			return nil
+		}
+
+		nodeChanBucket := openChanBucket.Bucket(nodePub)
+		return nodeChanBucket.ForEach(func(chainHash, v []byte) error {
+			if v != nil {
+				return nil
+			}
+
+			chainBucket := nodeChanBucket.Bucket(chainHash)
+			return chainBucket.ForEach(func(op, v []byte) error {
+				if v != nil {
+					return nil
+				}
+
+				chanBucket := chainBucket.Bucket(op)
+				if chanBucket.Get(chanUUIDKey) != nil {
+					return nil
+				}
+
+				id, err := newChannelUUID()
+				if err != nil {
+					return err
+				}
+
+				numChannels++
+
+				return putChanUUID(
+					tx, chanBucket, id, nodePub, chainHash,
+					op,
+				)
+			})
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Assigned UUIDs to %v open channels", numChannels)
+
+	return nil
+}
+
+// migrateInvoiceFiatRecords migrates the database to the v14 format, where the
+// TLV stream of an invoice may carry its fiat amount and exchange rate. As
+// these use record types that were previously rejected, no existing invoice
+// carries them, and all default to none. The invoices are only decoded to
+// ensure they can be read in the new format, none are modified.
+func migrateInvoiceFiatRecords(tx *bbolt.Tx, log btclog.Logger) error {
+	invoices := tx.Bucket(invoiceBucket)
+	if invoices == nil {
+		return nil
+	}
+
+	log.Infof("Checking invoices for the fiat amount format")
+
+	var numInvoices int
+	err := invoices.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return nil
+		}
+
+		invoice, err := deserializeInvoice(bytes.NewReader(v))
+		if err != nil {
+			return fmt.Errorf("unable to decode invoice %x: %v", k,
+				err)
+		}
+		if invoice.FiatAmount != nil || invoice.ExchangeRate != 0 {
+			return fmt.Errorf("invoice %x already carries a fiat "+
+				"amount", k)
+		}
+
+		numInvoices++
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Checked %v invoices for the fiat amount format",
+		numInvoices)
+
+	return nil
+}
+
+// migrateHtlcAddTimes migrates the database to the v15 format, where the add
+// time of each HTLC pending on a channel's commitments is stored along with
+// them. The time at which an existing HTLC was added isn't known, nor is the
+// time of the commitment that added it, so they're all assigned the time of
+// the migration. The age of these HTLCs is therefore underestimated.
+func migrateHtlcAddTimes(tx *bbolt.Tx, log btclog.Logger) error {
+	openChanBucket := tx.Bucket(openChannelBucket)
+	if openChanBucket == nil {
+		return nil
+	}
+
+	log.Infof("Recording add times of pending HTLCs")
+
+	var (
+		now      = time.Now()
+		numHtlcs int
+	)
+	err := forEachChanBucket(openChanBucket, func(_ wire.OutPoint,
+		chanBucket *bbolt.Bucket) error {
+
+		for _, local := range []bool{true, false} {
+			if chanBucket.Get(htlcAddTimesKeyFor(local)) != nil {
+				continue
+			}
+
+			// Restored channels have no commitments, so there
+			// are no HTLCs to record.
+			commit, err := fetchChanCommitment(chanBucket, local)
+			if err == ErrNoCommitmentsFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			err = putHtlcAddTimes(chanBucket, &commit, local, now)
+			if err != nil {
+				return err
+			}
+			numHtlcs += len(commit.Htlcs)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Recorded add times of %v pending HTLCs", numHtlcs)
+
+	return nil
+}
+
+// migrateCommitmentTypes migrates the database to the v16 format, where each
+// channel records its commitment type explicitly. The type of existing
+// channels is inferred from their static channel info.
+func migrateCommitmentTypes(tx *bbolt.Tx, log btclog.Logger) error {
+	openChanBucket := tx.Bucket(openChannelBucket)
+	if openChanBucket == nil {
+		return nil
+	}
+
+	log.Infof("Recording commitment types of open channels")
+
+	numChannels := make(map[CommitmentType]int)
+	err := forEachChanBucket(openChanBucket, func(op wire.OutPoint,
+		chanBucket *bbolt.Bucket) error {
+
+		if chanBucket.Get(chanCommitTypeKey) != nil {
+			return nil
+		}
+
+		channel := &OpenChannel{
+			FundingOutpoint: op,
+		}
+		if err := fetchChanInfo(chanBucket, channel); err != nil {
+			return fmt.Errorf("unable to fetch chan info of %v: %v",
+				op, err)
+		}
+
+		commitType := inferCommitmentType(channel)
+		numChannels[commitType]++
+
+		return putChanCommitType(chanBucket, commitType)
+	})
+	if err != nil {
+		return err
+	}
+
+	for commitType, num := range numChannels {
+		log.Infof("Recorded commitment type %v for %v channels",
+			commitType, num)
+	}
+
+	return nil
+}
+
+// duplicateForwardingEventWindow is the max time between two identical
+// forwarding events for the latter to be considered a duplicate written by
+// the same forward. Genuine repeated forwards of the same amounts over the
+// same channels require a new HTLC to be added and settled on both channels,
+// which takes considerably longer.
+const duplicateForwardingEventWindow = time.Second
+
+// migrateDedupeForwardingEvents migrates the database to the v17 format, where
+// duplicate forwarding events written by an older build are removed. An event
+// is considered a duplicate if it directly follows an identical event within
+// the forwarding log, and was logged less than
+// duplicateForwardingEventWindow later.
+func migrateDedupeForwardingEvents(tx *bbolt.Tx, log btclog.Logger) error {
+	logBucket := tx.Bucket(forwardingLogBucket)
+	if logBucket == nil {
+		return nil
+	}
+
+	log.Infof("Removing duplicate forwarding events")
+
+	// We'll first collect the keys of all duplicates, as the log can't be
+	// modified while it's being iterated over.
+	var (
+		duplicates [][]byte
+		prevTime   int64
+		prevEvent  []byte
+	)
+	err := logBucket.ForEach(func(k, v []byte) error {
+		if len(k) != 8 {
+			return nil
+		}
+		eventTime := int64(byteOrder.Uint64(k))
+
+		window := int64(duplicateForwardingEventWindow)
+		if prevEvent != nil && bytes.Equal(v, prevEvent) &&
+			eventTime-prevTime < window {
+
+			duplicates = append(duplicates, append([]byte{}, k...))
+			return nil
+		}
+
+		prevTime = eventTime
+		prevEvent = append([]byte(nil), v...)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range duplicates {
+		if err := logBucket.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Removed %v duplicate forwarding events", len(duplicates))
+
+	return nil
+}
+
+// migrateInvoicePreimages migrates the database to the v18 format, where the
+// preimages of settled invoices are stored within the preimage bucket, keyed
+// by their payment hash, rather than inline. Each settled invoice is
+// rewritten to reference its preimage by the payment hash instead. The
+// preimage of an invoice is moved within the same transaction its record is
+// rewritten in, so an invoice never ends up without access to its preimage.
+func migrateInvoicePreimages(tx *bbolt.Tx, checkpoint *bbolt.Bucket,
+	batchSize int, log btclog.Logger) (bool, error) {
+
+	invoices := tx.Bucket(invoiceBucket)
+	if invoices == nil {
+		return true, nil
+	}
+
+	if checkpoint.Get(invoiceBucket) == nil {
+		log.Infof("Moving preimages of settled invoices to their own " +
+			"bucket")
+	}
+
+	return reserializeBatch(
+		checkpoint, invoiceBucket, invoices, batchSize,
+		func(k, v []byte) ([]byte, error) {
+			invoice, err := deserializeInvoice(bytes.NewReader(v))
+			if err != nil {
+				return nil, fmt.Errorf("unable to decode "+
+					"invoice %x: %v", k, err)
+			}
+			if invoice.Terms.State != ContractSettled {
+				return v, nil
+			}
+
+			if err := movePreimage(tx, &invoice); err != nil {
+				return nil, err
+			}
+
+			var b bytes.Buffer
+			if err := serializeInvoice(&b, &invoice); err != nil {
+				return nil, err
+			}
+
+			return b.Bytes(), nil
+		},
+	)
+}
+
+// migratePaymentGroupIndex migrates the database to the v19 format, where
+// outgoing payments are indexed by the group they were sent as part of. None
+// of the existing payments were sent as part of a group, so all of them are
+// indexed under the zero group.
+func migratePaymentGroupIndex(tx *bbolt.Tx, log btclog.Logger) error {
+	payments := tx.Bucket(paymentBucket)
+	if payments == nil {
+		return nil
+	}
+
+	log.Infof("Indexing existing payments under the zero payment group")
+
+	var (
+		zeroGroup   [16]byte
+		numPayments int
+	)
+	err := payments.ForEach(func(k, v []byte) error {
+		// Ignores if it is sub-bucket.
+		if v == nil {
+			return nil
+		}
+
+		numPayments++
+		return putPaymentGroupIndex(tx, zeroGroup, k)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Indexed %v existing payments", numPayments)
+
+	return nil
+}
+
+// migrateCanonicalChannelKeys migrates the database to the v20 format, where
+// every channel point is keyed canonically, with its txid in internal byte
+// order. Open channels, closed channel summaries and the graph's channel
+// point index that are keyed by a txid in display byte order are re-keyed.
+// Only records that carry their own channel point can be recognized as such,
+// any other record is left untouched.
+func migrateCanonicalChannelKeys(tx *bbolt.Tx, log btclog.Logger) error {
+	log.Infof("Re-keying channel points stored in display byte order")
+
+	numOpen, err := rekeyOpenChannels(tx)
+	if err != nil {
+		return err
+	}
+	numClosed, err := rekeyClosedChannels(tx)
+	if err != nil {
+		return err
+	}
+	numEdges, err := rekeyChannelPointIndex(tx)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Re-keyed %v open channels, %v closed channels and %v "+
+		"channel edges", numOpen, numClosed, numEdges)
+
+	return nil
+}
+
+// migrateInvoiceHtlcAttempts migrates the database to the v21 format, where
+// invoices record whether an HTLC paying to them has ever been seen. Accepted
+// and settled invoices must have been paid by an HTLC, so they're marked as
+// attempted. Whether a rejected HTLC was seen for any other invoice isn't
+// known, so they're left unmarked.
+func migrateInvoiceHtlcAttempts(tx *bbolt.Tx, checkpoint *bbolt.Bucket,
+	batchSize int, log btclog.Logger) (bool, error) {
+
+	invoices := tx.Bucket(invoiceBucket)
+	if invoices == nil {
+		return true, nil
+	}
+
+	if checkpoint.Get(invoiceBucket) == nil {
+		log.Infof("Marking accepted and settled invoices as attempted")
+	}
+
+	return reserializeBatch(
+		checkpoint, invoiceBucket, invoices, batchSize,
+		func(k, v []byte) ([]byte, error) {
+			invoice, err := deserializeInvoice(bytes.NewReader(v))
+			if err != nil {
+				return nil, fmt.Errorf("unable to decode "+
+					"invoice %x: %v", k, err)
+			}
+
+			switch invoice.Terms.State {
+			case ContractAccepted, ContractSettled:
+			default:
+				return v, nil
+			}
+
+			invoice.HtlcAttempted = true
+
+			var b bytes.Buffer
+			if err := serializeInvoice(&b, &invoice); err != nil {
+				return nil, err
+			}
+
+			return b.Bytes(), nil
+		},
+	)
+}
+
+// migrateNodeAddrTypeIndex migrates the database to the v22 format, where
+// nodes are indexed by the types of the addresses they advertise. The index is
+// populated for all nodes within the graph.
+func migrateNodeAddrTypeIndex(tx *bbolt.Tx, log btclog.Logger) error {
+	nodes := tx.Bucket(nodeBucket)
+	if nodes == nil {
+		return nil
+	}
+
+	log.Infof("Populating node address type index")
+
+	// We'll gather all nodes first, as the index is nested within the
+	// node bucket, which can't be modified while iterating over it.
+	var announced []LightningNode
+	err := nodes.ForEach(func(nodePub, nodeBytes []byte) error {
+		if nodeBytes == nil || len(nodePub) != 33 {
+			return nil
+		}
+
+		node, err := deserializeLightningNode(
+			bytes.NewReader(nodeBytes),
+		)
+		if err != nil {
+			return fmt.Errorf("unable to decode node %x: %v",
+				nodePub, err)
+		}
+		if !node.HaveNodeAnnouncement {
+			return nil
+		}
+
+		announced = append(announced, node)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, node := range announced {
+		err := updateNodeAddrTypeIndex(
+			nodes, node.PubKeyBytes[:], nil, node.Addresses,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Indexed addresses of %v nodes", len(announced))
+
+	return nil
+}
+
+// migrateEdgePolicyDirections migrates the database to the v23 format, where
+// the direction flag of every edge policy agrees with the node the policy
+// leads to. A historical bug could store a policy with a flipped direction
+// flag, which we correct by comparing the node the policy leads to against the
+// two nodes of its edge. Policies whose nodes don't match their edge at all
+// can't be corrected, and are left as is.
+func migrateEdgePolicyDirections(tx *bbolt.Tx, log btclog.Logger) error {
+	edges := tx.Bucket(edgeBucket)
+	if edges == nil {
+		return nil
+	}
+	edgeIndex := edges.Bucket(edgeIndexBucket)
+	if edgeIndex == nil {
+		return nil
+	}
+
+	log.Infof("Correcting direction flags of edge policies")
+
+	type correctedPolicy struct {
+		key    []byte
+		policy []byte
+	}
+	var corrected []correctedPolicy
+	err := edges.ForEach(func(k, policy []byte) error {
+		// Only the policy entries are keyed by the node the policy
+		// originates from followed by the channel ID.
+		if len(k) != 33+8 || policy == nil ||
+			bytes.Equal(policy, unknownPolicy) {
+
+			return nil
+		}
+
+		edgeInfo := edgeIndex.Get(k[33:])
+		if len(edgeInfo) < 66 {
+			return nil
+		}
+		node1, node2 := edgeInfo[:33], edgeInfo[33:66]
+
+		flagsOffset, toOffset, err := edgePolicyOffsets(policy)
+		if err != nil {
+			return fmt.Errorf("unable to decode policy %x: %v",
+				k, err)
+		}
+		from, to := k[:33], policy[toOffset:toOffset+33]
+
+		var direction lnwire.ChanUpdateChanFlags
+		switch {
+		case bytes.Equal(from, node1) && bytes.Equal(to, node2):
+		case bytes.Equal(from, node2) && bytes.Equal(to, node1):
+			direction = lnwire.ChanUpdateDirection
+		default:
+			log.Warnf("Policy of channel %v from node %x leads to "+
+				"node %x outside of its edge, skipping",
+				byteOrder.Uint64(k[33:]), from, to)
+			return nil
+		}
+
+		flags := lnwire.ChanUpdateChanFlags(policy[flagsOffset])
+		if flags&lnwire.ChanUpdateDirection == direction {
+			return nil
+		}
+
+		log.Infof("Correcting direction of policy of channel %v from "+
+			"node %x", byteOrder.Uint64(k[33:]), from)
+
+		fixed := append([]byte(nil), policy...)
+		fixed[flagsOffset] = byte(flags ^ lnwire.ChanUpdateDirection)
+		corrected = append(corrected, correctedPolicy{
+			key:    append([]byte(nil), k...),
+			policy: fixed,
+		})
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range corrected {
+		if err := edges.Put(entry.key, entry.policy); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Corrected direction flags of %v edge policies",
+		len(corrected))
+
+	return nil
+}
+
+// edgePolicyOffsets returns the offsets of the channel flags and of the node
+// the policy leads to within a serialized edge policy.
+func edgePolicyOffsets(policy []byte) (int, int, error) {
+	r := bytes.NewReader(policy)
+	sigLen, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// The signature is followed by the channel ID, the update time and
+	// the message flags, after which the channel flags, the time lock
+	// delta, the min HTLC and the base and proportional fees precede the
+	// node.
+	sigEnd := uint64(len(policy)-r.Len()) + sigLen
+	flagsOffset := sigEnd + 8 + 8 + 1
+	toOffset := flagsOffset + 1 + 2 + 8 + 8 + 8
+	if toOffset+33 > uint64(len(policy)) {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+
+	return int(flagsOffset), int(toOffset), nil
+}
+
+// migrateNodeUpdateIndexKeys migrates the database to the v24 format, where
+// the node identifier within each key of the node update index is prefixed by
+// its length, rather than being assumed to be a 33-byte public key. This
+// allows nodes identified by keys of other lengths to be indexed in the
+// future. Keys already in the length-prefixed format are left as is.
+func migrateNodeUpdateIndexKeys(tx *bbolt.Tx, log btclog.Logger) error {
+	nodes := tx.Bucket(nodeBucket)
+	if nodes == nil {
+		return nil
+	}
+	nodeUpdateIndex := nodes.Bucket(nodeUpdateIndexBucket)
+	if nodeUpdateIndex == nil {
+		return nil
+	}
+
+	log.Infof("Migrating node update index to length-prefixed keys")
+
+	// As the bucket can't be modified while iterating over it, the legacy
+	// keys are collected first.
+	var legacyKeys [][]byte
+	err := nodeUpdateIndex.ForEach(func(k, _ []byte) error {
+		if len(k) != legacyNodeUpdateIndexKeyLen {
+			return nil
+		}
+		if len(k) == 9+int(k[8]) {
+			return nil
+		}
+
+		legacyKeys = append(legacyKeys, append([]byte(nil), k...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range legacyKeys {
+		if err := nodeUpdateIndex.Delete(k); err != nil {
+			return err
+		}
+
+		indexKey := nodeUpdateIndexKey(byteOrder.Uint64(k[:8]), k[8:])
+		if err := nodeUpdateIndex.Put(indexKey, nil); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Migrated %v node update index keys", len(legacyKeys))
+
+	return nil
+}
+
+// migrateChannelConfirmations migrates the database to the v26 format, where
+// each channel records the number of confirmations its funding transaction
+// has received. Channels that are already open are considered to have
+// exactly the number of confirmations they require, while pending channels
+// default to none until the next block updates them.
+func migrateChannelConfirmations(tx *bbolt.Tx, log btclog.Logger) error {
+	openChanBucket := tx.Bucket(openChannelBucket)
+	if openChanBucket == nil {
+		return nil
+	}
+
+	log.Infof("Recording funding confirmations of open channels")
+
+	var numOpen, numPending int
+	err := forEachChanBucket(openChanBucket, func(op wire.OutPoint,
+		chanBucket *bbolt.Bucket) error {
+
+		if chanBucket.Get(chanConfirmationsKey) != nil {
+			return nil
+		}
+
+		channel := &OpenChannel{
+			FundingOutpoint: op,
+		}
+		if err := fetchChanInfo(chanBucket, channel); err != nil {
+			return fmt.Errorf("unable to fetch chan info of %v: %v",
+				op, err)
+		}
+
+		if channel.IsPending {
+			numPending++
+			return putChanConfirmations(chanBucket, 0)
+		}
+
+		numOpen++
+		return putChanConfirmations(
+			chanBucket, uint32(channel.NumConfsRequired),
+		)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Recorded funding confirmations of %v open and %v pending "+
+		"channels", numOpen, numPending)
+
+	return nil
+}
+
+// migrateChannelIdleIndex migrates the database to the v29 format, where the
+// most recent forward through each channel is indexed, and each channel
+// records the time it was opened. The index is built from the forwarding log.
+// The open time of existing channels isn't known, so they're all assigned the
+// time of the migration, which underestimates how long channels that never
+// forwarded have been idle.
+func migrateChannelIdleIndex(tx *bbolt.Tx, log btclog.Logger) error {
+	log.Infof("Indexing the forwarding log by channel")
+
+	var numEvents int
+	logBucket := tx.Bucket(forwardingLogBucket)
+	if logBucket != nil {
+		err := logBucket.ForEach(func(k, v []byte) error {
+			timestamp := time.Unix(0, int64(byteOrder.Uint64(k)))
+
+			var events []ForwardingEvent
+			readBuf := bytes.NewReader(v)
+			for readBuf.Len() != 0 {
+				var event ForwardingEvent
+				err := decodeForwardingEvent(readBuf, &event)
+				if err != nil {
+					return err
+				}
+				event.Timestamp = timestamp
+
+				events = append(events, event)
+			}
+			numEvents += len(events)
+
+			return putForwardingChanIndex(tx, events)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Indexed %v forwarding events by channel", numEvents)
+
+	openChanBucket := tx.Bucket(openChannelBucket)
+	if openChanBucket == nil {
+		return nil
+	}
+
+	var (
+		now         = time.Now()
+		numChannels int
+	)
+	err := forEachChanBucket(openChanBucket, func(_ wire.OutPoint,
+		chanBucket *bbolt.Bucket) error {
+
+		if chanBucket.Get(chanOpenTimeKey) != nil {
+			return nil
+		}
+		numChannels++
+
+		return putChanOpenTime(chanBucket, now)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Recorded open time of %v channels", numChannels)
+
+	return nil
+}
+
+// migrateInvoicePaymentRequestFields migrates the database to the v33 format,
+// where an invoice may carry the fields of its payment request that it
+// doesn't otherwise hold, such as its network and expiry. They're recovered
+// from the payment request stored along with each existing invoice. Invoices
+// stored without a payment request, or with one that can't be decoded or
+// whose payment hash doesn't index the invoice, are left without them.
+func migrateInvoicePaymentRequestFields(tx *bbolt.Tx,
+	checkpoint *bbolt.Bucket, batchSize int, log btclog.Logger) (bool,
+	error) {
+
+	invoices := tx.Bucket(invoiceBucket)
+	if invoices == nil {
+		return true, nil
+	}
+	invoiceIndex := invoices.Bucket(invoiceIndexBucket)
+	if invoiceIndex == nil {
+		return true, nil
+	}
+
+	if checkpoint.Get(invoiceBucket) == nil {
+		log.Infof("Recovering the payment request fields of invoices")
+	}
+
+	return reserializeBatch(
+		checkpoint, invoiceBucket, invoices, batchSize,
+		func(k, v []byte) ([]byte, error) {
+			invoice, err := deserializeInvoice(bytes.NewReader(v))
+			if err != nil {
+				return nil, fmt.Errorf("unable to decode "+
+					"invoice %x: %v", k, err)
+			}
+			if invoice.PaymentRequestFields != nil {
+				return nil, fmt.Errorf("invoice %x already "+
+					"carries payment request fields", k)
+			}
+
+			fields, err := recoverPaymentRequestFields(
+				invoiceIndex, k, &invoice,
+			)
+			if err != nil {
+				log.Warnf("Invoice %x left without payment "+
+					"request fields: %v", k, err)
+				return v, nil
+			}
+			if fields == nil {
+				return v, nil
+			}
+			invoice.PaymentRequestFields = fields
+
+			var b bytes.Buffer
+			if err := serializeInvoice(&b, &invoice); err != nil {
+				return nil, err
+			}
+
+			return b.Bytes(), nil
+		},
+	)
+}
+
+// recoverPaymentRequestFields returns the payment request fields of the
+// invoice with the passed number, as held by its stored payment request, or
+// nil if it was stored without one. An error is returned if the request
+// can't be decoded, or if its payment hash doesn't index the invoice.
+func recoverPaymentRequestFields(invoiceIndex *bbolt.Bucket,
+	invoiceNum []byte, invoice *Invoice) (*PaymentRequestFields, error) {
+
+	if len(invoice.PaymentRequest) == 0 {
+		return nil, nil
+	}
+
+	request, err := decodeStoredPaymentRequest(
+		string(invoice.PaymentRequest),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if request.PaymentHash == nil || !bytes.Equal(
+		invoiceIndex.Get(request.PaymentHash[:]), invoiceNum,
+	) {
+
+		return nil, fmt.Errorf("payment request of another payment " +
+			"hash")
+	}
+
+	fields := NewPaymentRequestFields(request)
+	if err := validatePaymentRequestFields(fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
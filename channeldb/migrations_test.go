@@ -5,14 +5,20 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 	"github.com/coreos/bbolt"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/go-errors/errors"
 	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/lightningnetwork/lnd/zpay32"
 )
 
 // TestPaymentStatusesMigration checks that already completed payments will have
@@ -25,19 +31,47 @@ func TestPaymentStatusesMigration(t *testing.T) {
 
 	// Add fake payment to test database, verifying that it was created,
 	// that we have only one payment, and its status is not "Completed".
+	// The payment is written in the v8 format, as that's the format the
+	// migration expects to find on disk.
 	beforeMigrationFunc := func(d *DB) {
-		if err := d.AddPayment(fakePayment); err != nil {
-			t.Fatalf("unable to add payment: %v", err)
+		var b bytes.Buffer
+		if err := serializeOutgoingPaymentV8(&b, fakePayment); err != nil {
+			t.Fatalf("unable to serialize payment: %v", err)
 		}
 
-		payments, err := d.FetchAllPayments()
+		var numPayments int
+		err := d.Update(func(tx *bbolt.Tx) error {
+			payments, err := tx.CreateBucketIfNotExists(
+				paymentBucket,
+			)
+			if err != nil {
+				return err
+			}
+
+			paymentID, err := payments.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			var paymentIDBytes [8]byte
+			byteOrder.PutUint64(paymentIDBytes[:], paymentID)
+			err = payments.Put(paymentIDBytes[:], b.Bytes())
+			if err != nil {
+				return err
+			}
+
+			return payments.ForEach(func(k, v []byte) error {
+				numPayments++
+				return nil
+			})
+		})
 		if err != nil {
-			t.Fatalf("unable to fetch payments: %v", err)
+			t.Fatalf("unable to add payment: %v", err)
 		}
 
-		if len(payments) != 1 {
+		if numPayments != 1 {
 			t.Fatalf("wrong qty of paymets: expected 1, got %v",
-				len(payments))
+				numPayments)
 		}
 
 		paymentStatus, err := d.FetchPaymentStatus(paymentHash)
@@ -410,9 +444,10 @@ func TestMigrateOptionalChannelCloseSummaryFields(t *testing.T) {
 			}
 
 			// We generate the new serialized version, to check
-			// against what is found in the DB.
+			// against what is found in the DB. As later migrations
+			// changed the format again, this is the v11 format.
 			var b bytes.Buffer
-			err = serializeChannelCloseSummary(&b, test.closeSummary)
+			err = serializeChannelCloseSummaryV11(&b, test.closeSummary)
 			if err != nil {
 				t.Fatalf("unable to serialize: %v", err)
 			}
@@ -427,7 +462,9 @@ func TestMigrateOptionalChannelCloseSummaryFields(t *testing.T) {
 
 				// Get the serialized verision from the DB and
 				// make sure it matches what we expected.
-				dbSummary = closedChanBucket.Get(chanID)
+				dbSummary = append(
+					[]byte(nil), closedChanBucket.Get(chanID)...,
+				)
 				if !bytes.Equal(dbSummary, newSerialization) {
 					return fmt.Errorf("unexpected new " +
 						"serialization")
@@ -438,20 +475,16 @@ func TestMigrateOptionalChannelCloseSummaryFields(t *testing.T) {
 				t.Fatalf("unable to view DB: %v", err)
 			}
 
-			// Finally we fetch the deserialized summary from the
-			// DB and check that it is equal to our original one.
-			dbChannels, err := d.FetchClosedChannels(false)
+			// Finally we deserialize the summary found in the DB
+			// and check that it is equal to our original one.
+			dbChan, err := deserializeCloseChannelSummaryV11(
+				bytes.NewReader(dbSummary),
+			)
 			if err != nil {
-				t.Fatalf("unable to fetch closed channels: %v",
+				t.Fatalf("unable to deserialize summary: %v",
 					err)
 			}
 
-			if len(dbChannels) != 1 {
-				t.Fatalf("expected 1 closed channels, found %v",
-					len(dbChannels))
-			}
-
-			dbChan := dbChannels[0]
 			if !reflect.DeepEqual(dbChan, test.closeSummary) {
 				dbChan.RemotePub.Curve = nil
 				test.closeSummary.RemotePub.Curve = nil
@@ -564,3 +597,1848 @@ func TestMigrateGossipMessageStoreKeys(t *testing.T) {
 		migrateGossipMessageStoreKeys, false,
 	)
 }
+
+// serializeOutgoingPaymentV8 writes an outgoing payment using the v8 database
+// format, where neither the payment nor its embedded invoice have a trailing
+// TLV stream.
+func serializeOutgoingPaymentV8(w io.Writer, p *OutgoingPayment) error {
+	var scratch [8]byte
+
+	if err := serializeInvoiceV8(w, &p.Invoice); err != nil {
+		return err
+	}
+
+	byteOrder.PutUint64(scratch[:], uint64(p.Fee))
+	if _, err := w.Write(scratch[:]); err != nil {
+		return err
+	}
+
+	byteOrder.PutUint32(scratch[:4], uint32(len(p.Path)))
+	if _, err := w.Write(scratch[:4]); err != nil {
+		return err
+	}
+	for _, hop := range p.Path {
+		if _, err := w.Write(hop[:]); err != nil {
+			return err
+		}
+	}
+
+	byteOrder.PutUint32(scratch[:4], p.TimeLockLength)
+	if _, err := w.Write(scratch[:4]); err != nil {
+		return err
+	}
+
+	_, err := w.Write(p.PaymentPreimage[:])
+	return err
+}
+
+// TestMigrateInvoiceTimeSeries asserts that invoices are assigned add and
+// settle indexes in the order of their keys when they're migrated to the time
+// series format in batches.
+func TestMigrateInvoiceTimeSeries(t *testing.T) {
+	t.Parallel()
+
+	const numInvoices = 3
+	var invoices []*Invoice
+	for i := 0; i < numInvoices; i++ {
+		invoice, err := randInvoice(lnwire.NewMSatFromSatoshis(1000))
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+		invoice.Terms.State = ContractOpen
+		invoices = append(invoices, invoice)
+	}
+	invoices[1].Terms.State = ContractSettled
+
+	// Before the migration, we'll write the invoices to disk in the
+	// format preceding the time series, which lacks the trailing add
+	// index, settle index and amount paid.
+	beforeMigration := func(d *DB) {
+		err := d.Update(func(tx *bbolt.Tx) error {
+			bucket, err := tx.CreateBucketIfNotExists(
+				invoiceBucket,
+			)
+			if err != nil {
+				return err
+			}
+
+			for i, invoice := range invoices {
+				var b bytes.Buffer
+				err := serializeInvoiceV8(&b, invoice)
+				if err != nil {
+					return err
+				}
+				invoiceBytes := b.Bytes()[:b.Len()-24]
+
+				var invoiceKey [4]byte
+				byteOrder.PutUint32(invoiceKey[:], uint32(i))
+				err = bucket.Put(invoiceKey[:], invoiceBytes)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to write invoices: %v", err)
+		}
+	}
+
+	// After the migration, each invoice should carry the next add index,
+	// and the settled one the first settle index, all of which should be
+	// indexed.
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		err = d.View(func(tx *bbolt.Tx) error {
+			bucket := tx.Bucket(invoiceBucket)
+			addIndex := bucket.Bucket(addIndexBucket)
+			settleIndex := bucket.Bucket(settleIndexBucket)
+
+			for i, expected := range invoices {
+				var invoiceKey [4]byte
+				byteOrder.PutUint32(invoiceKey[:], uint32(i))
+
+				r := bytes.NewReader(bucket.Get(invoiceKey[:]))
+				invoice, err := deserializeInvoiceV8(r)
+				if err != nil {
+					return err
+				}
+
+				var settleIndexNo uint64
+				if expected.Terms.State == ContractSettled {
+					settleIndexNo = 1
+				}
+				if invoice.AddIndex != uint64(i+1) ||
+					invoice.SettleIndex != settleIndexNo {
+
+					return fmt.Errorf("invoice %v has add "+
+						"index %v and settle index %v",
+						i, invoice.AddIndex,
+						invoice.SettleIndex)
+				}
+
+				var seqNo [8]byte
+				byteOrder.PutUint64(seqNo[:], invoice.AddIndex)
+				if !bytes.Equal(addIndex.Get(seqNo[:]),
+					invoiceKey[:]) {
+
+					return fmt.Errorf("invoice %v not in "+
+						"add index", i)
+				}
+				if settleIndexNo == 0 {
+					continue
+				}
+
+				byteOrder.PutUint64(seqNo[:], settleIndexNo)
+				if !bytes.Equal(settleIndex.Get(seqNo[:]),
+					invoiceKey[:]) {
+
+					return fmt.Errorf("invoice %v not in "+
+						"settle index", i)
+				}
+			}
+
+			numSettled, err := countEntries(settleIndex)
+			if err != nil {
+				return err
+			}
+			if numSettled != 1 {
+				return fmt.Errorf("expected 1 settled "+
+					"invoice, got %v", numSettled)
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to verify invoices: %v", err)
+		}
+	}
+
+	applyBatchMigration(
+		t, beforeMigration, afterMigration, migrateInvoiceTimeSeries,
+		false,
+	)
+}
+
+// TestMigrateInvoiceTLVStream checks that both invoices and the invoices
+// embedded within outgoing payments can be decoded after they've been migrated
+// to the format with a trailing TLV stream.
+func TestMigrateInvoiceTLVStream(t *testing.T) {
+	t.Parallel()
+
+	invoice, err := randInvoice(lnwire.NewMSatFromSatoshis(1000))
+	if err != nil {
+		t.Fatalf("unable to create invoice: %v", err)
+	}
+	invoice.AddIndex = 1
+
+	payment := makeFakePayment()
+
+	// Before the migration, we'll write both records to disk using the
+	// v8 format.
+	beforeMigration := func(d *DB) {
+		var invoiceBytes, paymentBytes bytes.Buffer
+		if err := serializeInvoiceV8(&invoiceBytes, invoice); err != nil {
+			t.Fatalf("unable to serialize invoice: %v", err)
+		}
+		err := serializeOutgoingPaymentV8(&paymentBytes, payment)
+		if err != nil {
+			t.Fatalf("unable to serialize payment: %v", err)
+		}
+
+		err = d.Update(func(tx *bbolt.Tx) error {
+			invoices, err := tx.CreateBucketIfNotExists(
+				invoiceBucket,
+			)
+			if err != nil {
+				return err
+			}
+			var invoiceKey [4]byte
+			err = invoices.Put(invoiceKey[:], invoiceBytes.Bytes())
+			if err != nil {
+				return err
+			}
+
+			payments, err := tx.CreateBucketIfNotExists(
+				paymentBucket,
+			)
+			if err != nil {
+				return err
+			}
+			var paymentKey [8]byte
+			byteOrder.PutUint64(paymentKey[:], 1)
+			return payments.Put(paymentKey[:], paymentBytes.Bytes())
+		})
+		if err != nil {
+			t.Fatalf("unable to write records: %v", err)
+		}
+	}
+
+	// After the migration, both records should be readable using the
+	// current format, and should match what we originally wrote.
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		invoices, err := d.FetchAllInvoices(false)
+		if err != nil {
+			t.Fatalf("unable to fetch invoices: %v", err)
+		}
+		if len(invoices) != 1 {
+			t.Fatalf("expected 1 invoice, got %v", len(invoices))
+		}
+		if !reflect.DeepEqual(*invoice, invoices[0]) {
+			t.Fatalf("invoice mismatch: expected %v, got %v",
+				spew.Sdump(invoice), spew.Sdump(invoices[0]))
+		}
+
+		// The payment should now have the invoice in its new format
+		// embedded, followed by the remainder of the v8 payment.
+		var invoiceV8, paymentV8, expectedPayment bytes.Buffer
+		if err := serializeInvoiceV8(&invoiceV8, &payment.Invoice); err != nil {
+			t.Fatalf("unable to serialize invoice: %v", err)
+		}
+		if err := serializeOutgoingPaymentV8(&paymentV8, payment); err != nil {
+			t.Fatalf("unable to serialize payment: %v", err)
+		}
+		err = serializeInvoice(&expectedPayment, &payment.Invoice)
+		if err != nil {
+			t.Fatalf("unable to serialize invoice: %v", err)
+		}
+		expectedPayment.Write(paymentV8.Bytes()[invoiceV8.Len():])
+
+		var paymentBytes []byte
+		err = d.View(func(tx *bbolt.Tx) error {
+			var paymentKey [8]byte
+			byteOrder.PutUint64(paymentKey[:], 1)
+			paymentBytes = tx.Bucket(paymentBucket).Get(
+				paymentKey[:],
+			)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to fetch payment: %v", err)
+		}
+		if !bytes.Equal(expectedPayment.Bytes(), paymentBytes) {
+			t.Fatalf("payment mismatch: expected %x, got %x",
+				expectedPayment.Bytes(), paymentBytes)
+		}
+	}
+
+	applyBatchMigration(
+		t, beforeMigration, afterMigration, migrateInvoiceTLVStream,
+		false,
+	)
+}
+
+// TestMigrateOutgoingPaymentTLVStream checks that outgoing payments can be
+// decoded using the current format once the empty TLV stream has been appended
+// to them.
+func TestMigrateOutgoingPaymentTLVStream(t *testing.T) {
+	t.Parallel()
+
+	payment := makeFakePayment()
+
+	// Before the migration, we'll write the payment in the v9 format,
+	// which is the v8 format with the invoice's TLV stream inserted.
+	beforeMigration := func(d *DB) {
+		var invoiceV8, paymentV8, paymentV9 bytes.Buffer
+		if err := serializeInvoiceV8(&invoiceV8, &payment.Invoice); err != nil {
+			t.Fatalf("unable to serialize invoice: %v", err)
+		}
+		if err := serializeOutgoingPaymentV8(&paymentV8, payment); err != nil {
+			t.Fatalf("unable to serialize payment: %v", err)
+		}
+		if err := serializeInvoice(&paymentV9, &payment.Invoice); err != nil {
+			t.Fatalf("unable to serialize invoice: %v", err)
+		}
+		paymentV9.Write(paymentV8.Bytes()[invoiceV8.Len():])
+
+		err := d.Update(func(tx *bbolt.Tx) error {
+			payments, err := tx.CreateBucketIfNotExists(
+				paymentBucket,
+			)
+			if err != nil {
+				return err
+			}
+			var paymentKey [8]byte
+			byteOrder.PutUint64(paymentKey[:], 1)
+			return payments.Put(paymentKey[:], paymentV9.Bytes())
+		})
+		if err != nil {
+			t.Fatalf("unable to write payment: %v", err)
+		}
+	}
+
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		payments, err := d.FetchAllPayments()
+		if err != nil {
+			t.Fatalf("unable to fetch payments: %v", err)
+		}
+		if len(payments) != 1 {
+			t.Fatalf("expected 1 payment, got %v", len(payments))
+		}
+		if !reflect.DeepEqual(payment, payments[0]) {
+			t.Fatalf("payment mismatch: expected %v, got %v",
+				spew.Sdump(payment), spew.Sdump(payments[0]))
+		}
+	}
+
+	applyBatchMigration(
+		t, beforeMigration, afterMigration,
+		migrateOutgoingPaymentTLVStream, false,
+	)
+}
+
+// TestMigrateReportSkewedTimestamps asserts that the migration reporting graph
+// records with skewed update times leaves the records untouched.
+func TestMigrateReportSkewedTimestamps(t *testing.T) {
+	t.Parallel()
+
+	const offset = 2 * time.Hour
+
+	var skewedNode *LightningNode
+	beforeMigration := func(d *DB) {
+		skewedNode, _ = populateSkewedGraph(t, d, offset)
+	}
+
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		skewed, err := d.ChannelGraph().SkewedTimestamps(
+			DefaultTimestampSkewWindow,
+		)
+		if err != nil {
+			t.Fatalf("unable to find skewed timestamps: %v", err)
+		}
+		if len(skewed) != 2 {
+			t.Fatalf("expected 2 skewed timestamps, got %v",
+				len(skewed))
+		}
+		if !skewed[1].LastUpdate.Equal(skewedNode.LastUpdate) {
+			t.Fatalf("expected node update time %v, got %v",
+				skewedNode.LastUpdate, skewed[1].LastUpdate)
+		}
+	}
+
+	applyMigration(
+		t, beforeMigration, afterMigration,
+		migrateReportSkewedTimestamps, false,
+	)
+}
+
+// TestMigrateCloseSummarySweptFlag asserts that existing close summaries are
+// migrated to carry a swept flag that defaults to false.
+func TestMigrateCloseSummarySweptFlag(t *testing.T) {
+	t.Parallel()
+
+	summary := &ChannelCloseSummary{
+		ChanPoint:      wire.OutPoint{Hash: key, Index: 3},
+		ClosingTXID:    rev,
+		RemotePub:      pubKey,
+		Capacity:       btcutil.Amount(100000),
+		SettledBalance: btcutil.Amount(60000),
+		CloseType:      CooperativeClose,
+		CloseHeight:    200,
+	}
+
+	var b bytes.Buffer
+	if err := writeOutpoint(&b, &summary.ChanPoint); err != nil {
+		t.Fatalf("unable to write outpoint: %v", err)
+	}
+	chanID := b.Bytes()
+
+	beforeMigration := func(d *DB) {
+		var summaryV11 bytes.Buffer
+		err := serializeChannelCloseSummaryV11(&summaryV11, summary)
+		if err != nil {
+			t.Fatalf("unable to serialize summary: %v", err)
+		}
+
+		err = d.Update(func(tx *bbolt.Tx) error {
+			closedChanBucket, err := tx.CreateBucketIfNotExists(
+				closedChannelBucket,
+			)
+			if err != nil {
+				return err
+			}
+			return closedChanBucket.Put(chanID, summaryV11.Bytes())
+		})
+		if err != nil {
+			t.Fatalf("unable to write summary: %v", err)
+		}
+	}
+
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		closed, err := d.FetchClosedChannels(false)
+		if err != nil {
+			t.Fatalf("unable to fetch closed channels: %v", err)
+		}
+		if len(closed) != 1 {
+			t.Fatalf("expected 1 closed channel, got %v", len(closed))
+		}
+		if !reflect.DeepEqual(summary, closed[0]) {
+			t.Fatalf("summary mismatch: expected %v, got %v",
+				spew.Sdump(summary), spew.Sdump(closed[0]))
+		}
+	}
+
+	applyMigration(
+		t, beforeMigration, afterMigration,
+		migrateCloseSummarySweptFlag, false,
+	)
+}
+
+// TestMigrateChannelUUIDs asserts that the migration assigns a UUID to each
+// open channel lacking one, under which the channel can be looked up.
+func TestMigrateChannelUUIDs(t *testing.T) {
+	t.Parallel()
+
+	var state *OpenChannel
+	beforeMigration := func(d *DB) {
+		var err error
+		state, err = createTestChannelState(d)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		if err := state.FullSync(); err != nil {
+			t.Fatalf("unable to save channel state: %v", err)
+		}
+
+		// We'll strip the channel of its UUID to mimic a channel
+		// stored before the UUID was introduced.
+		err = d.Update(func(tx *bbolt.Tx) error {
+			chanBucket, err := fetchChanBucket(
+				tx, state.IdentityPub, &state.FundingOutpoint,
+				state.ChainHash,
+			)
+			if err != nil {
+				return err
+			}
+			if err := chanBucket.Delete(chanUUIDKey); err != nil {
+				return err
+			}
+
+			return tx.DeleteBucket(channelUUIDIndexBucket)
+		})
+		if err != nil {
+			t.Fatalf("unable to remove channel UUID: %v", err)
+		}
+
+		channels, err := d.FetchAllChannels()
+		if err != nil {
+			t.Fatalf("unable to fetch channels: %v", err)
+		}
+		if channels[0].UUID != ([16]byte{}) {
+			t.Fatalf("expected channel without UUID")
+		}
+	}
+
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		channels, err := d.FetchAllChannels()
+		if err != nil {
+			t.Fatalf("unable to fetch channels: %v", err)
+		}
+		if len(channels) != 1 {
+			t.Fatalf("expected 1 channel, got %v", len(channels))
+		}
+		id := channels[0].UUID
+		if id == ([16]byte{}) || id == state.UUID {
+			t.Fatalf("expected channel to be assigned a new UUID")
+		}
+
+		channel, err := d.ChannelByUUID(id)
+		if err != nil {
+			t.Fatalf("unable to fetch channel by UUID: %v", err)
+		}
+		if channel.FundingOutpoint != state.FundingOutpoint {
+			t.Fatalf("expected channel %v, got %v",
+				state.FundingOutpoint, channel.FundingOutpoint)
+		}
+	}
+
+	applyMigration(
+		t, beforeMigration, afterMigration,
+		migrateChannelUUIDs, false,
+	)
+}
+
+// TestMigrateInvoiceFiatRecords asserts that existing invoices remain readable
+// after the migration, and carry no fiat amount.
+func TestMigrateInvoiceFiatRecords(t *testing.T) {
+	t.Parallel()
+
+	var invoice *Invoice
+	beforeMigration := func(d *DB) {
+		var err error
+		invoice, err = randInvoice(lnwire.NewMSatFromSatoshis(1000))
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+
+		_, err = d.AddInvoice(
+			invoice, invoice.Terms.PaymentPreimage.Hash(),
+		)
+		if err != nil {
+			t.Fatalf("unable to add invoice: %v", err)
+		}
+	}
+
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		dbInvoice, err := d.LookupInvoice(
+			invoice.Terms.PaymentPreimage.Hash(),
+		)
+		if err != nil {
+			t.Fatalf("unable to lookup invoice: %v", err)
+		}
+		if dbInvoice.FiatAmount != nil || dbInvoice.ExchangeRate != 0 {
+			t.Fatalf("expected invoice without fiat amount")
+		}
+		if !reflect.DeepEqual(*invoice, dbInvoice) {
+			t.Fatalf("invoice mismatch: expected %v, got %v",
+				spew.Sdump(invoice), spew.Sdump(dbInvoice))
+		}
+	}
+
+	applyMigration(
+		t, beforeMigration, afterMigration,
+		migrateInvoiceFiatRecords, false,
+	)
+}
+
+// TestMigrateHtlcAddTimes asserts that HTLCs pending before the migration are
+// assigned an add time.
+func TestMigrateHtlcAddTimes(t *testing.T) {
+	t.Parallel()
+
+	var (
+		state *OpenChannel
+		rHash = [32]byte{1}
+	)
+	beforeMigration := func(d *DB) {
+		var err error
+		state, err = createTestChannelState(d)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		state.RemoteCommitment.Htlcs = []HTLC{testHTLC(0, rHash)}
+		if err := state.FullSync(); err != nil {
+			t.Fatalf("unable to save channel state: %v", err)
+		}
+
+		// We'll remove the add times to mimic a channel stored before
+		// they were introduced.
+		err = d.Update(func(tx *bbolt.Tx) error {
+			chanBucket, err := fetchChanBucket(
+				tx, state.IdentityPub, &state.FundingOutpoint,
+				state.ChainHash,
+			)
+			if err != nil {
+				return err
+			}
+
+			for _, local := range []bool{true, false} {
+				key := htlcAddTimesKeyFor(local)
+				if err := chanBucket.Delete(key); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to remove add times: %v", err)
+		}
+
+		_, _, _, err = d.OldestPendingHTLC()
+		if err != ErrNoPendingHTLCs {
+			t.Fatalf("expected ErrNoPendingHTLCs, got %v", err)
+		}
+	}
+
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		_, hash, age, err := d.OldestPendingHTLC()
+		if err != nil {
+			t.Fatalf("unable to fetch oldest htlc: %v", err)
+		}
+		if hash != rHash {
+			t.Fatalf("expected htlc %x, got %x", rHash, hash)
+		}
+		if age > time.Minute {
+			t.Fatalf("expected htlc to be added at migration, "+
+				"got age %v", age)
+		}
+	}
+
+	applyMigration(
+		t, beforeMigration, afterMigration,
+		migrateHtlcAddTimes, false,
+	)
+}
+
+// TestMigrateCommitmentTypes asserts that existing channels are assigned the
+// commitment type inferred from their channel info.
+func TestMigrateCommitmentTypes(t *testing.T) {
+	t.Parallel()
+
+	var state *OpenChannel
+	beforeMigration := func(d *DB) {
+		var err error
+		state, err = createTestChannelState(d)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		if err := state.FullSync(); err != nil {
+			t.Fatalf("unable to save channel state: %v", err)
+		}
+
+		// We'll remove the commitment type to mimic a channel stored
+		// before it was recorded, which can't be read.
+		err = d.Update(func(tx *bbolt.Tx) error {
+			chanBucket, err := fetchChanBucket(
+				tx, state.IdentityPub, &state.FundingOutpoint,
+				state.ChainHash,
+			)
+			if err != nil {
+				return err
+			}
+
+			return chanBucket.Delete(chanCommitTypeKey)
+		})
+		if err != nil {
+			t.Fatalf("unable to remove commitment type: %v", err)
+		}
+
+		if _, err := d.FetchAllChannels(); err == nil {
+			t.Fatalf("expected channel without commitment type " +
+				"to be unreadable")
+		}
+	}
+
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		channel, err := d.FetchChannel(state.FundingOutpoint)
+		if err != nil {
+			t.Fatalf("unable to fetch channel: %v", err)
+		}
+		if channel.CommitmentType != CommitmentTypeLegacy {
+			t.Fatalf("expected commitment type %v, got %v",
+				CommitmentTypeLegacy, channel.CommitmentType)
+		}
+	}
+
+	applyMigration(
+		t, beforeMigration, afterMigration,
+		migrateCommitmentTypes, false,
+	)
+}
+
+// TestMigrateDedupeForwardingEvents asserts that only forwarding events that
+// directly follow an identical event within a second are removed.
+func TestMigrateDedupeForwardingEvents(t *testing.T) {
+	t.Parallel()
+
+	eventA := ForwardingEvent{
+		IncomingChanID: lnwire.NewShortChanIDFromInt(1),
+		OutgoingChanID: lnwire.NewShortChanIDFromInt(2),
+		AmtIn:          1000,
+		AmtOut:         990,
+	}
+	eventB := eventA
+	eventB.AmtIn = 2000
+
+	start := time.Unix(1000, 0)
+	ms := time.Millisecond
+	entries := []struct {
+		event     ForwardingEvent
+		offset    time.Duration
+		duplicate bool
+	}{
+		{event: eventA, offset: 0},
+		{event: eventA, offset: 100 * ms, duplicate: true},
+		{event: eventA, offset: 900 * ms, duplicate: true},
+		{event: eventA, offset: 2000 * ms},
+		{event: eventB, offset: 2100 * ms},
+		{event: eventA, offset: 2200 * ms},
+	}
+
+	beforeMigration := func(d *DB) {
+		err := d.Update(func(tx *bbolt.Tx) error {
+			logBucket, err := tx.CreateBucketIfNotExists(
+				forwardingLogBucket,
+			)
+			if err != nil {
+				return err
+			}
+
+			for _, entry := range entries {
+				var b bytes.Buffer
+				err := encodeForwardingEvent(&b, &entry.event)
+				if err != nil {
+					return err
+				}
+
+				var k [8]byte
+				eventTime := start.Add(entry.offset).UnixNano()
+				byteOrder.PutUint64(k[:], uint64(eventTime))
+				err = logBucket.Put(k[:], b.Bytes())
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to write forwarding events: %v", err)
+		}
+	}
+
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		timeSlice, err := d.ForwardingLog().Query(ForwardingEventQuery{
+			StartTime:    start,
+			EndTime:      start.Add(time.Hour),
+			NumMaxEvents: 100,
+		})
+		if err != nil {
+			t.Fatalf("unable to query forwarding log: %v", err)
+		}
+
+		var expected []ForwardingEvent
+		for _, entry := range entries {
+			if entry.duplicate {
+				continue
+			}
+			event := entry.event
+			event.Timestamp = start.Add(entry.offset)
+			expected = append(expected, event)
+		}
+		if !reflect.DeepEqual(timeSlice.ForwardingEvents, expected) {
+			t.Fatalf("expected events %v, got %v",
+				spew.Sdump(expected),
+				spew.Sdump(timeSlice.ForwardingEvents))
+		}
+	}
+
+	applyMigration(
+		t, beforeMigration, afterMigration,
+		migrateDedupeForwardingEvents, false,
+	)
+}
+
+// TestMigrateInvoicePreimages asserts that the preimages of settled invoices
+// are moved to the preimage bucket, while those of other invoices are kept
+// inline, and that all invoices are returned unchanged afterwards.
+func TestMigrateInvoicePreimages(t *testing.T) {
+	t.Parallel()
+
+	var invoices []*Invoice
+	for _, state := range []ContractState{
+		ContractOpen, ContractSettled, ContractSettled,
+	} {
+		invoice, err := randInvoice(lnwire.NewMSatFromSatoshis(1000))
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+		invoice.Terms.State = state
+		invoice.AddIndex = uint64(len(invoices) + 1)
+		invoices = append(invoices, invoice)
+	}
+
+	// Before the migration, all invoices carry their preimage inline, as
+	// they did prior to the preimage bucket.
+	beforeMigration := func(d *DB) {
+		err := d.Update(func(tx *bbolt.Tx) error {
+			invoiceB, err := tx.CreateBucketIfNotExists(
+				invoiceBucket,
+			)
+			if err != nil {
+				return err
+			}
+
+			for i, invoice := range invoices {
+				var b bytes.Buffer
+				err := serializeInvoice(&b, invoice)
+				if err != nil {
+					return err
+				}
+
+				var invoiceKey [4]byte
+				byteOrder.PutUint32(invoiceKey[:], uint32(i))
+				err = invoiceB.Put(invoiceKey[:], b.Bytes())
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to write invoices: %v", err)
+		}
+	}
+
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		err = d.View(func(tx *bbolt.Tx) error {
+			invoiceB := tx.Bucket(invoiceBucket)
+			preimages := tx.Bucket(preimageBucket)
+			if preimages == nil {
+				return fmt.Errorf("preimage bucket not found")
+			}
+
+			for i, invoice := range invoices {
+				var invoiceKey [4]byte
+				byteOrder.PutUint32(invoiceKey[:], uint32(i))
+				_, _, inline, err := deserializeInvoiceState(
+					invoiceB.Get(invoiceKey[:]),
+				)
+				if err != nil {
+					return err
+				}
+
+				preimage := invoice.Terms.PaymentPreimage
+				payHash := preimage.Hash()
+				stored := preimages.Get(payHash[:])
+
+				state := invoice.Terms.State
+				settled := state == ContractSettled
+				switch {
+				case settled && inline != UnknownPreimage:
+					return fmt.Errorf("invoice %v kept "+
+						"its preimage inline", i)
+
+				case settled && !bytes.Equal(
+					stored, preimage[:]):
+
+					return fmt.Errorf("expected stored "+
+						"preimage %v, got %x",
+						preimage, stored)
+
+				case !settled && (inline != preimage ||
+					stored != nil):
+
+					return fmt.Errorf("invoice %v moved "+
+						"its preimage", i)
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dbInvoices, err := d.FetchAllInvoices(false)
+		if err != nil {
+			t.Fatalf("unable to fetch invoices: %v", err)
+		}
+		if len(dbInvoices) != len(invoices) {
+			t.Fatalf("expected %v invoices, got %v", len(invoices),
+				len(dbInvoices))
+		}
+		for i, invoice := range invoices {
+			if !reflect.DeepEqual(*invoice, dbInvoices[i]) {
+				t.Fatalf("invoice mismatch: expected %v, "+
+					"got %v", spew.Sdump(invoice),
+					spew.Sdump(dbInvoices[i]))
+			}
+		}
+	}
+
+	applyBatchMigration(
+		t, beforeMigration, afterMigration, migrateInvoicePreimages,
+		false,
+	)
+}
+
+// TestMigratePaymentGroupIndex asserts that all payments existing prior to
+// the payment group index are indexed under the zero group.
+func TestMigratePaymentGroupIndex(t *testing.T) {
+	t.Parallel()
+
+	var payments []*OutgoingPayment
+	for i := 0; i < 3; i++ {
+		payment, err := makeRandomFakePayment()
+		if err != nil {
+			t.Fatalf("unable to create payment: %v", err)
+		}
+		payments = append(payments, payment)
+	}
+
+	// Before the migration, the payments are stored without being indexed
+	// by their group.
+	beforeMigration := func(d *DB) {
+		err := d.Update(func(tx *bbolt.Tx) error {
+			paymentB, err := tx.CreateBucketIfNotExists(
+				paymentBucket,
+			)
+			if err != nil {
+				return err
+			}
+
+			for i, payment := range payments {
+				var b bytes.Buffer
+				err := serializeOutgoingPayment(&b, payment)
+				if err != nil {
+					return err
+				}
+
+				var paymentKey [8]byte
+				byteOrder.PutUint64(paymentKey[:], uint64(i))
+				err = paymentB.Put(paymentKey[:], b.Bytes())
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to write payments: %v", err)
+		}
+	}
+
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		grouped, err := d.PaymentsInGroup([16]byte{})
+		if err != nil {
+			t.Fatalf("unable to fetch payments of group: %v", err)
+		}
+		if !reflect.DeepEqual(payments, grouped) {
+			t.Fatalf("payment mismatch: expected %v, got %v",
+				spew.Sdump(payments), spew.Sdump(grouped))
+		}
+	}
+
+	applyMigration(
+		t, beforeMigration, afterMigration, migratePaymentGroupIndex,
+		false,
+	)
+}
+
+// TestMigrateCanonicalChannelKeys asserts that open channels, closed channel
+// summaries and entries of the graph's channel point index that are keyed by
+// a txid in display byte order are re-keyed canonically.
+func TestMigrateCanonicalChannelKeys(t *testing.T) {
+	t.Parallel()
+
+	var (
+		openChan   *OpenChannel
+		closedChan *OpenChannel
+		edgeInfo   *ChannelEdgeInfo
+	)
+
+	// Before the migration, we'll store each record through the regular
+	// methods, and then move it to the display ordered key of its channel
+	// point.
+	beforeMigration := func(d *DB) {
+		var err error
+		openChan, err = createTestChannelState(d)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		if err := openChan.FullSync(); err != nil {
+			t.Fatalf("unable to save channel state: %v", err)
+		}
+
+		closedChan, err = createTestChannelState(d)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		if err := closedChan.FullSync(); err != nil {
+			t.Fatalf("unable to save channel state: %v", err)
+		}
+		err = closedChan.CloseChannel(&ChannelCloseSummary{
+			ChanPoint:   closedChan.FundingOutpoint,
+			ShortChanID: closedChan.ShortChannelID,
+			RemotePub:   closedChan.IdentityPub,
+			CloseType:   CooperativeClose,
+		})
+		if err != nil {
+			t.Fatalf("unable to close channel: %v", err)
+		}
+
+		graph := d.ChannelGraph()
+		node1, err := createTestVertex(d)
+		if err != nil {
+			t.Fatalf("unable to create node: %v", err)
+		}
+		node2, err := createTestVertex(d)
+		if err != nil {
+			t.Fatalf("unable to create node: %v", err)
+		}
+		for _, node := range []*LightningNode{node1, node2} {
+			if err := graph.AddLightningNode(node); err != nil {
+				t.Fatalf("unable to add node: %v", err)
+			}
+		}
+		edgeInfo, _, _ = createChannelEdge(d, node1, node2)
+		if err := graph.AddChannelEdge(edgeInfo); err != nil {
+			t.Fatalf("unable to add edge: %v", err)
+		}
+
+		err = d.Update(func(tx *bbolt.Tx) error {
+			op := openChan.FundingOutpoint
+			chainBucket := tx.Bucket(openChannelBucket).Bucket(
+				openChan.IdentityPub.SerializeCompressed(),
+			).Bucket(openChan.ChainHash[:])
+			oldKey := canonicalChannelKey(op)
+			chanBucket, err := chainBucket.CreateBucket(
+				displayChannelKey(op),
+			)
+			if err != nil {
+				return err
+			}
+			err = copyBucket(chanBucket, chainBucket.Bucket(oldKey))
+			if err != nil {
+				return err
+			}
+			if err := chainBucket.DeleteBucket(oldKey); err != nil {
+				return err
+			}
+			err = putChanUUID(
+				tx, chanBucket, openChan.UUID,
+				openChan.IdentityPub.SerializeCompressed(),
+				openChan.ChainHash[:], displayChannelKey(op),
+			)
+			if err != nil {
+				return err
+			}
+
+			op = closedChan.FundingOutpoint
+			closedChanBucket := tx.Bucket(closedChannelBucket)
+			summary := closedChanBucket.Get(canonicalChannelKey(op))
+			err = closedChanBucket.Put(
+				displayChannelKey(op), summary,
+			)
+			if err != nil {
+				return err
+			}
+			err = closedChanBucket.Delete(canonicalChannelKey(op))
+			if err != nil {
+				return err
+			}
+
+			op = edgeInfo.ChannelPoint
+			chanIndex := tx.Bucket(edgeBucket).Bucket(
+				channelPointBucket,
+			)
+			chanID := chanIndex.Get(canonicalChannelKey(op))
+			err = chanIndex.Put(displayChannelKey(op), chanID)
+			if err != nil {
+				return err
+			}
+			return chanIndex.Delete(canonicalChannelKey(op))
+		})
+		if err != nil {
+			t.Fatalf("unable to mis-key records: %v", err)
+		}
+
+		// With the records mis-keyed, they can no longer be found by
+		// their channel points.
+		_, err = d.FetchChannel(openChan.FundingOutpoint)
+		if err != ErrChannelNotFound {
+			t.Fatalf("expected ErrChannelNotFound, got %v", err)
+		}
+	}
+
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		channel, err := d.FetchChannel(openChan.FundingOutpoint)
+		if err != nil {
+			t.Fatalf("unable to fetch channel: %v", err)
+		}
+		openChan.Db = channel.Db
+		if !reflect.DeepEqual(openChan, channel) {
+			t.Fatalf("channel mismatch: expected %v, got %v",
+				spew.Sdump(openChan), spew.Sdump(channel))
+		}
+		if _, err := d.ChannelByUUID(openChan.UUID); err != nil {
+			t.Fatalf("unable to fetch channel by UUID: %v", err)
+		}
+
+		_, err = d.FetchClosedChannel(&closedChan.FundingOutpoint)
+		if err != nil {
+			t.Fatalf("unable to fetch closed channel: %v", err)
+		}
+
+		graph := d.ChannelGraph()
+		chanID, err := graph.ChannelID(&edgeInfo.ChannelPoint)
+		if err != nil {
+			t.Fatalf("unable to fetch channel id: %v", err)
+		}
+		if chanID != edgeInfo.ChannelID {
+			t.Fatalf("expected channel id %v, got %v",
+				edgeInfo.ChannelID, chanID)
+		}
+	}
+
+	applyMigration(
+		t, beforeMigration, afterMigration,
+		migrateCanonicalChannelKeys, false,
+	)
+}
+
+// TestMigrateInvoiceHtlcAttempts asserts that accepted and settled invoices
+// are marked as attempted, while open and canceled ones are left unmarked.
+func TestMigrateInvoiceHtlcAttempts(t *testing.T) {
+	t.Parallel()
+
+	states := []ContractState{
+		ContractOpen, ContractAccepted, ContractSettled,
+		ContractCanceled,
+	}
+	var invoices []*Invoice
+	for _, state := range states {
+		invoice, err := randInvoice(lnwire.NewMSatFromSatoshis(1000))
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+		invoice.Terms.State = state
+		invoices = append(invoices, invoice)
+	}
+
+	beforeMigration := func(d *DB) {
+		err := d.Update(func(tx *bbolt.Tx) error {
+			invoiceB, err := tx.CreateBucketIfNotExists(
+				invoiceBucket,
+			)
+			if err != nil {
+				return err
+			}
+
+			for i, invoice := range invoices {
+				var b bytes.Buffer
+				err := serializeInvoice(&b, invoice)
+				if err != nil {
+					return err
+				}
+
+				var invoiceKey [4]byte
+				byteOrder.PutUint32(invoiceKey[:], uint32(i))
+				err = invoiceB.Put(invoiceKey[:], b.Bytes())
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to write invoices: %v", err)
+		}
+	}
+
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		dbInvoices, err := d.FetchAllInvoices(false)
+		if err != nil {
+			t.Fatalf("unable to fetch invoices: %v", err)
+		}
+		if len(dbInvoices) != len(invoices) {
+			t.Fatalf("expected %v invoices, got %v", len(invoices),
+				len(dbInvoices))
+		}
+		for i, invoice := range dbInvoices {
+			state := invoice.Terms.State
+			attempted := state == ContractAccepted ||
+				state == ContractSettled
+			if invoice.HtlcAttempted != attempted {
+				t.Fatalf("invoice %v in state %v: expected "+
+					"attempted=%v", i, state, attempted)
+			}
+		}
+	}
+
+	applyBatchMigration(
+		t, beforeMigration, afterMigration, migrateInvoiceHtlcAttempts,
+		false,
+	)
+}
+
+// TestMigrateNodeAddrTypeIndex asserts that the migration indexes all nodes
+// with an announcement by the types of the addresses they advertise.
+func TestMigrateNodeAddrTypeIndex(t *testing.T) {
+	t.Parallel()
+
+	var node *LightningNode
+	beforeMigration := func(d *DB) {
+		var err error
+		node, err = createTestVertex(d)
+		if err != nil {
+			t.Fatalf("unable to create node: %v", err)
+		}
+		if err := d.ChannelGraph().AddLightningNode(node); err != nil {
+			t.Fatalf("unable to add node: %v", err)
+		}
+
+		// Nodes stored before the migration weren't indexed, so we'll
+		// remove the index written by the current code.
+		err = d.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket(nodeBucket).DeleteBucket(
+				nodeAddrTypeIndexBucket,
+			)
+		})
+		if err != nil {
+			t.Fatalf("unable to delete index: %v", err)
+		}
+	}
+
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		graph := d.ChannelGraph()
+		clearnet := []AddrType{AddrTypeIPv4, AddrTypeIPv6}
+		for _, addrType := range clearnet {
+			nodes, err := graph.NodesByAddressType(addrType)
+			if err != nil {
+				t.Fatalf("unable to fetch nodes: %v", err)
+			}
+			if len(nodes) != 1 ||
+				nodes[0].PubKeyBytes != node.PubKeyBytes {
+
+				t.Fatalf("expected node %x to be indexed as %v",
+					node.PubKeyBytes, addrType)
+			}
+		}
+
+		nodes, err := graph.NodesByAddressType(AddrTypeTorV3)
+		if err != nil {
+			t.Fatalf("unable to fetch nodes: %v", err)
+		}
+		if len(nodes) != 0 {
+			t.Fatalf("expected no tor nodes, got %v", len(nodes))
+		}
+	}
+
+	applyMigration(
+		t, beforeMigration, afterMigration, migrateNodeAddrTypeIndex,
+		false,
+	)
+}
+
+// TestMigrateEdgePolicyDirections asserts that the migration corrects the
+// direction flag of a policy stored with a flipped flag, while leaving correct
+// policies untouched.
+func TestMigrateEdgePolicyDirections(t *testing.T) {
+	t.Parallel()
+
+	var (
+		edgeInfo     *ChannelEdgeInfo
+		edge1, edge2 *ChannelEdgePolicy
+	)
+	beforeMigration := func(d *DB) {
+		graph := d.ChannelGraph()
+		node1, err := createTestVertex(d)
+		if err != nil {
+			t.Fatalf("unable to create node: %v", err)
+		}
+		node2, err := createTestVertex(d)
+		if err != nil {
+			t.Fatalf("unable to create node: %v", err)
+		}
+		for _, node := range []*LightningNode{node1, node2} {
+			if err := graph.AddLightningNode(node); err != nil {
+				t.Fatalf("unable to add node: %v", err)
+			}
+		}
+
+		edgeInfo, edge1, edge2 = createChannelEdge(d, node1, node2)
+		if err := graph.AddChannelEdge(edgeInfo); err != nil {
+			t.Fatalf("unable to add edge: %v", err)
+		}
+		for _, edge := range []*ChannelEdgePolicy{edge1, edge2} {
+			if err := graph.UpdateEdgePolicy(edge); err != nil {
+				t.Fatalf("unable to update policy: %v", err)
+			}
+		}
+
+		// We'll now overwrite the policy of the first node with one
+		// that has its direction flag flipped, while still being
+		// stored under the first node and leading to the second.
+		flipped := *edge1
+		flipped.ChannelFlags ^= lnwire.ChanUpdateDirection
+
+		var b bytes.Buffer
+		err = serializeChanEdgePolicy(
+			&b, &flipped, edgeInfo.NodeKey2Bytes[:],
+		)
+		if err != nil {
+			t.Fatalf("unable to serialize policy: %v", err)
+		}
+
+		var edgeKey [33 + 8]byte
+		copy(edgeKey[:], edgeInfo.NodeKey1Bytes[:])
+		byteOrder.PutUint64(edgeKey[33:], edgeInfo.ChannelID)
+		err = d.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket(edgeBucket).Put(edgeKey[:], b.Bytes())
+		})
+		if err != nil {
+			t.Fatalf("unable to store flipped policy: %v", err)
+		}
+	}
+
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		graph := d.ChannelGraph()
+		_, policy1, policy2, err := graph.FetchChannelEdgesByID(
+			edgeInfo.ChannelID,
+		)
+		if err != nil {
+			t.Fatalf("unable to fetch policies: %v", err)
+		}
+
+		if policy1.ChannelFlags != edge1.ChannelFlags {
+			t.Fatalf("expected corrected flags %v, got %v",
+				edge1.ChannelFlags, policy1.ChannelFlags)
+		}
+		if policy2.ChannelFlags != edge2.ChannelFlags {
+			t.Fatalf("expected untouched flags %v, got %v",
+				edge2.ChannelFlags, policy2.ChannelFlags)
+		}
+		if policy1.FeeBaseMSat != edge1.FeeBaseMSat ||
+			policy1.MaxHTLC != edge1.MaxHTLC {
+
+			t.Fatalf("policy fields changed by migration")
+		}
+	}
+
+	applyMigration(
+		t, beforeMigration, afterMigration, migrateEdgePolicyDirections,
+		false,
+	)
+}
+
+// TestMigrateNodeUpdateIndexKeys asserts that the migration rewrites the keys
+// of the node update index into the length-prefixed format, without changing
+// the set of nodes that are indexed.
+func TestMigrateNodeUpdateIndexKeys(t *testing.T) {
+	t.Parallel()
+
+	var nodes []*LightningNode
+	beforeMigration := func(d *DB) {
+		graph := d.ChannelGraph()
+		for i := 0; i < 2; i++ {
+			node, err := createTestVertex(d)
+			if err != nil {
+				t.Fatalf("unable to create node: %v", err)
+			}
+			if err := graph.AddLightningNode(node); err != nil {
+				t.Fatalf("unable to add node: %v", err)
+			}
+			nodes = append(nodes, node)
+		}
+
+		// Only the first node is indexed in the legacy format, such
+		// that the index holds keys of both formats.
+		err := d.Update(func(tx *bbolt.Tx) error {
+			index := tx.Bucket(nodeBucket).Bucket(
+				nodeUpdateIndexBucket,
+			)
+			unix := uint64(nodes[0].LastUpdate.Unix())
+			nodePub := nodes[0].PubKeyBytes[:]
+
+			err := index.Delete(nodeUpdateIndexKey(unix, nodePub))
+			if err != nil {
+				return err
+			}
+
+			return index.Put(
+				legacyNodeUpdateIndexKey(unix, nodePub), nil,
+			)
+		})
+		if err != nil {
+			t.Fatalf("unable to write legacy key: %v", err)
+		}
+	}
+
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		var keys [][]byte
+		err = d.View(func(tx *bbolt.Tx) error {
+			index := tx.Bucket(nodeBucket).Bucket(
+				nodeUpdateIndexBucket,
+			)
+			return index.ForEach(func(k, _ []byte) error {
+				keys = append(keys, append([]byte(nil), k...))
+				return nil
+			})
+		})
+		if err != nil {
+			t.Fatalf("unable to read index: %v", err)
+		}
+		if len(keys) != len(nodes) {
+			t.Fatalf("expected %v index keys, got %v", len(nodes),
+				len(keys))
+		}
+
+		for _, node := range nodes {
+			unix := uint64(node.LastUpdate.Unix())
+			nodePub := node.PubKeyBytes[:]
+			expected := nodeUpdateIndexKey(unix, nodePub)
+
+			var found bool
+			for _, k := range keys {
+				if bytes.Equal(k, expected) {
+					found = true
+				}
+			}
+			if !found {
+				t.Fatalf("node %x not indexed by "+
+					"length-prefixed key", node.PubKeyBytes)
+			}
+		}
+	}
+
+	applyMigration(
+		t, beforeMigration, afterMigration, migrateNodeUpdateIndexKeys,
+		false,
+	)
+}
+
+// TestMigrateChannelConfirmations asserts that open channels are considered
+// confirmed after the migration, while pending channels have no confirmations.
+func TestMigrateChannelConfirmations(t *testing.T) {
+	t.Parallel()
+
+	var pendingChan, openChan *OpenChannel
+	beforeMigration := func(d *DB) {
+		for _, pending := range []bool{true, false} {
+			state, err := createTestChannelState(d)
+			if err != nil {
+				t.Fatalf("unable to create channel state: %v",
+					err)
+			}
+			state.IsPending = pending
+			if err := state.FullSync(); err != nil {
+				t.Fatalf("unable to save channel state: %v",
+					err)
+			}
+
+			// We'll remove the confirmations to mimic a channel
+			// stored before they were recorded.
+			err = d.Update(func(tx *bbolt.Tx) error {
+				chanBucket, err := fetchChanBucket(
+					tx, state.IdentityPub,
+					&state.FundingOutpoint, state.ChainHash,
+				)
+				if err != nil {
+					return err
+				}
+
+				return chanBucket.Delete(chanConfirmationsKey)
+			})
+			if err != nil {
+				t.Fatalf("unable to remove confirmations: %v",
+					err)
+			}
+
+			if pending {
+				pendingChan = state
+			} else {
+				openChan = state
+			}
+		}
+	}
+
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		channel, err := d.FetchChannel(openChan.FundingOutpoint)
+		if err != nil {
+			t.Fatalf("unable to fetch channel: %v", err)
+		}
+		if channel.Confirmations != uint32(channel.NumConfsRequired) {
+			t.Fatalf("expected %v confirmations, got %v",
+				channel.NumConfsRequired, channel.Confirmations)
+		}
+
+		unconfirmed, err := d.UnconfirmedChannels()
+		if err != nil {
+			t.Fatalf("unable to fetch unconfirmed channels: %v",
+				err)
+		}
+		if len(unconfirmed) != 1 || unconfirmed[0].FundingOutpoint !=
+			pendingChan.FundingOutpoint {
+
+			t.Fatalf("expected only the pending channel to be " +
+				"unconfirmed")
+		}
+		if unconfirmed[0].Confirmations != 0 {
+			t.Fatalf("expected no confirmations, got %v",
+				unconfirmed[0].Confirmations)
+		}
+	}
+
+	applyMigration(
+		t, beforeMigration, afterMigration,
+		migrateChannelConfirmations, false,
+	)
+}
+
+// TestMigrateChannelIdleIndex asserts that the forwarding log is indexed by
+// channel, and that channels are assigned an open time by the migration.
+func TestMigrateChannelIdleIndex(t *testing.T) {
+	t.Parallel()
+
+	var (
+		channel  *OpenChannel
+		lastTime = time.Unix(2000, 0)
+	)
+	beforeMigration := func(d *DB) {
+		var err error
+		channel, err = createTestChannelState(d)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		channel.IsPending = false
+		if err := channel.FullSync(); err != nil {
+			t.Fatalf("unable to save channel state: %v", err)
+		}
+
+		events := []ForwardingEvent{
+			{
+				Timestamp:      lastTime,
+				IncomingChanID: channel.ShortChannelID,
+			},
+			{
+				Timestamp:      lastTime.Add(-time.Hour),
+				OutgoingChanID: channel.ShortChannelID,
+			},
+		}
+		err = d.ForwardingLog().AddForwardingEvents(events)
+		if err != nil {
+			t.Fatalf("unable to add events: %v", err)
+		}
+
+		// We'll remove the index and the open time to mimic a
+		// database written before they were recorded.
+		err = d.Update(func(tx *bbolt.Tx) error {
+			err := tx.DeleteBucket(forwardingChanIndexBucket)
+			if err != nil {
+				return err
+			}
+
+			chanBucket, err := fetchChanBucket(
+				tx, channel.IdentityPub,
+				&channel.FundingOutpoint, channel.ChainHash,
+			)
+			if err != nil {
+				return err
+			}
+
+			return chanBucket.Delete(chanOpenTimeKey)
+		})
+		if err != nil {
+			t.Fatalf("unable to remove idle index: %v", err)
+		}
+	}
+
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		idleTimes, err := d.ChannelIdleTimes(lastTime.Add(time.Hour))
+		if err != nil {
+			t.Fatalf("unable to fetch idle times: %v", err)
+		}
+		if len(idleTimes) != 1 {
+			t.Fatalf("expected 1 idle time, got %v", len(idleTimes))
+		}
+		if !idleTimes[0].LastForward.Equal(lastTime) {
+			t.Fatalf("expected last forward %v, got %v", lastTime,
+				idleTimes[0].LastForward)
+		}
+		if idleTimes[0].OpenTime.IsZero() {
+			t.Fatalf("expected open time to be recorded")
+		}
+	}
+
+	applyMigration(
+		t, beforeMigration, afterMigration,
+		migrateChannelIdleIndex, false,
+	)
+}
+
+// TestMigrateInvoicePaymentRequestFields asserts that the payment request
+// fields of existing invoices are recovered from their stored payment
+// request, and that invoices whose request doesn't yield them are left
+// without.
+func TestMigrateInvoicePaymentRequestFields(t *testing.T) {
+	t.Parallel()
+
+	privKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to create private key: %v", err)
+	}
+
+	// newRequest returns a payment request of the passed payment hash.
+	newRequest := func(hash [32]byte) string {
+		request, err := zpay32.NewInvoice(
+			&chaincfg.RegressionNetParams, hash, time.Unix(1, 0),
+			zpay32.Description("memo"),
+			zpay32.Expiry(time.Hour*3),
+			zpay32.CLTVExpiry(144),
+		)
+		if err != nil {
+			t.Fatalf("unable to create request: %v", err)
+		}
+		encoded, err := request.Encode(zpay32.MessageSigner{
+			SignCompact: func(hash []byte) ([]byte, error) {
+				return btcec.SignCompact(
+					btcec.S256(), privKey, hash, true,
+				)
+			},
+		})
+		if err != nil {
+			t.Fatalf("unable to encode request: %v", err)
+		}
+
+		return encoded
+	}
+
+	// The first invoice carries its own payment request, the second one
+	// of another payment hash, and the last one none.
+	var hashes [][32]byte
+	beforeMigration := func(d *DB) {
+		for i := 0; i < 3; i++ {
+			invoice, err := randInvoice(
+				lnwire.NewMSatFromSatoshis(1000),
+			)
+			if err != nil {
+				t.Fatalf("unable to create invoice: %v", err)
+			}
+			hash := invoice.Terms.PaymentPreimage.Hash()
+
+			invoice.PaymentRequest = nil
+			switch i {
+			case 0:
+				request := newRequest(hash)
+				invoice.PaymentRequest = []byte(request)
+			case 1:
+				request := newRequest([32]byte{1})
+				invoice.PaymentRequest = []byte(request)
+			}
+
+			if _, err := d.AddInvoice(invoice, hash); err != nil {
+				t.Fatalf("unable to add invoice: %v", err)
+			}
+			hashes = append(hashes, hash)
+		}
+	}
+
+	afterMigration := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatalf("unable to fetch db version: %v", err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("migration should have succeeded but didn't")
+		}
+
+		expected := &PaymentRequestFields{
+			Net:                &chaincfg.RegressionNetParams,
+			Expiry:             time.Hour * 3,
+			MinFinalCLTVExpiry: 144,
+			Destination:        privKey.PubKey(),
+		}
+		for i, hash := range hashes {
+			invoice, err := d.LookupInvoice(hash)
+			if err != nil {
+				t.Fatalf("unable to lookup invoice: %v", err)
+			}
+
+			fields := invoice.PaymentRequestFields
+			switch {
+			case i == 0 && !reflect.DeepEqual(fields, expected):
+				t.Fatalf("expected payment request fields "+
+					"%v, got %v", spew.Sdump(expected),
+					spew.Sdump(fields))
+
+			case i != 0 && fields != nil:
+				t.Fatalf("expected invoice %v without payment "+
+					"request fields, got %v", i,
+					spew.Sdump(fields))
+			}
+		}
+	}
+
+	applyBatchMigration(
+		t, beforeMigration, afterMigration,
+		migrateInvoicePaymentRequestFields, false,
+	)
+}
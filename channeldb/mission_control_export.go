@@ -0,0 +1,121 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/coreos/bbolt"
+)
+
+const (
+	// missionControlExportVersion is the version of the format written by
+	// ExportMissionControl. It must be bumped whenever the format changes,
+	// such that older exports are either converted or rejected by
+	// ImportMissionControl.
+	missionControlExportVersion uint16 = 1
+)
+
+var (
+	// ErrUnknownMissionControlExportVersion is returned when attempting to
+	// import mission control state that was exported using an unknown
+	// format.
+	ErrUnknownMissionControlExportVersion = fmt.Errorf("unknown mission " +
+		"control export version")
+)
+
+// ExportMissionControl writes the outcome of all past payment attempts, as
+// recorded by RecordAttempt for each channel direction, to w. The export is
+// versioned, and can be loaded into another database using
+// ImportMissionControl to seed it with the network conditions learned by this
+// one.
+func (d *DB) ExportMissionControl(w io.Writer) error {
+	var b bytes.Buffer
+	err := d.View(func(tx *bbolt.Tx) error {
+		err := WriteElement(&b, missionControlExportVersion)
+		if err != nil {
+			return err
+		}
+
+		scores := tx.Bucket(channelScoreBucket)
+		if scores == nil {
+			return WriteElement(&b, uint32(0))
+		}
+
+		return exportBucket(&b, scores)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// ImportMissionControl loads the state written by ExportMissionControl into
+// the database. Unless merge is set, all attempts recorded so far are
+// replaced by the imported ones. Otherwise, the imported state of a channel
+// direction only replaces the existing one if it was updated more recently.
+// The entire export is validated before the database is modified.
+func (d *DB) ImportMissionControl(r io.Reader, merge bool) error {
+	var version uint16
+	if err := ReadElement(r, &version); err != nil {
+		return err
+	}
+	if version != missionControlExportVersion {
+		return ErrUnknownMissionControlExportVersion
+	}
+
+	entries, err := importBucket(r)
+	if err != nil {
+		return err
+	}
+
+	imported := make([]*channelScore, len(entries))
+	for i, entry := range entries {
+		if entry.isBucket || len(entry.key) != 9 || entry.key[8] > 1 {
+			return fmt.Errorf("invalid channel score key %x",
+				entry.key)
+		}
+
+		imported[i], err = deserializeChannelScore(
+			bytes.NewReader(entry.value),
+		)
+		if err != nil {
+			return fmt.Errorf("invalid channel score %x: %v",
+				entry.key, err)
+		}
+	}
+
+	return d.Update(func(tx *bbolt.Tx) error {
+		if !merge {
+			err := tx.DeleteBucket(channelScoreBucket)
+			if err != nil && err != bbolt.ErrBucketNotFound {
+				return err
+			}
+		}
+
+		scores, err := tx.CreateBucketIfNotExists(channelScoreBucket)
+		if err != nil {
+			return err
+		}
+
+		for i, entry := range entries {
+			key, value := entry.key, entry.value
+			existing, err := fetchChannelScore(scores, key)
+			if err != nil {
+				return err
+			}
+			last := existing.lastUpdate
+			if merge && !imported[i].lastUpdate.After(last) {
+				continue
+			}
+
+			if err := scores.Put(key, value); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
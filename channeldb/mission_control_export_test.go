@@ -0,0 +1,134 @@
+package channeldb
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+// TestMissionControlExportImport asserts that exported mission control state
+// either replaces the state of the importing database, or is merged into it
+// such that the more recently updated state of each channel direction wins.
+func TestMissionControlExportImport(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1500000000, 0)
+	later := now.Add(time.Hour)
+
+	var cleanUps []func()
+	defer func() {
+		for _, cleanUp := range cleanUps {
+			cleanUp()
+		}
+	}()
+
+	type attempt struct {
+		chanID  uint64
+		success bool
+		t       time.Time
+	}
+	newDB := func(attempts ...attempt) *DB {
+		t.Helper()
+
+		db, cleanUp, err := makeTestDB()
+		if err != nil {
+			t.Fatalf("unable to make test database: %v", err)
+		}
+		cleanUps = append(cleanUps, cleanUp)
+
+		for _, a := range attempts {
+			err := db.recordAttempt(a.chanID, 0, a.success, a.t)
+			if err != nil {
+				t.Fatalf("unable to record attempt: %v", err)
+			}
+		}
+
+		return db
+	}
+	fetchScore := func(db *DB, chanID uint64) []byte {
+		t.Helper()
+
+		var score []byte
+		err := db.View(func(tx *bbolt.Tx) error {
+			scores := tx.Bucket(channelScoreBucket)
+			if scores == nil {
+				return nil
+			}
+
+			value := scores.Get(channelScoreKey(chanID, 0))
+			score = append([]byte(nil), value...)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to fetch score: %v", err)
+		}
+
+		return score
+	}
+
+	// The source database knows of channels one and two, while the target
+	// databases know of a more recent attempt through channel two, and of
+	// channel three.
+	source := newDB(
+		attempt{1, false, later},
+		attempt{2, true, now},
+	)
+	targetAttempts := []attempt{
+		{2, false, later},
+		{3, true, now},
+	}
+	mergeTarget := newDB(targetAttempts...)
+	replaceTarget := newDB(targetAttempts...)
+	targetScore := fetchScore(mergeTarget, 2)
+
+	var export bytes.Buffer
+	if err := source.ExportMissionControl(&export); err != nil {
+		t.Fatalf("unable to export mission control: %v", err)
+	}
+
+	err := mergeTarget.ImportMissionControl(
+		bytes.NewReader(export.Bytes()), true,
+	)
+	if err != nil {
+		t.Fatalf("unable to merge mission control: %v", err)
+	}
+	if !bytes.Equal(fetchScore(mergeTarget, 1), fetchScore(source, 1)) {
+		t.Fatalf("expected unknown channel to be imported")
+	}
+	if !bytes.Equal(fetchScore(mergeTarget, 2), targetScore) {
+		t.Fatalf("expected more recent state to be kept")
+	}
+	if fetchScore(mergeTarget, 3) == nil {
+		t.Fatalf("expected channel unknown to source to be kept")
+	}
+
+	err = replaceTarget.ImportMissionControl(
+		bytes.NewReader(export.Bytes()), false,
+	)
+	if err != nil {
+		t.Fatalf("unable to import mission control: %v", err)
+	}
+	for _, chanID := range []uint64{1, 2} {
+		imported := fetchScore(replaceTarget, chanID)
+		if !bytes.Equal(imported, fetchScore(source, chanID)) {
+			t.Fatalf("expected state of channel %v to be replaced",
+				chanID)
+		}
+	}
+	if fetchScore(replaceTarget, 3) != nil {
+		t.Fatalf("expected channel unknown to source to be removed")
+	}
+
+	// An export of an unknown version is rejected.
+	corrupted := export.Bytes()
+	corrupted[1]++
+	err = replaceTarget.ImportMissionControl(
+		bytes.NewReader(corrupted), false,
+	)
+	if err != ErrUnknownMissionControlExportVersion {
+		t.Fatalf("expected ErrUnknownMissionControlExportVersion, "+
+			"got %v", err)
+	}
+}
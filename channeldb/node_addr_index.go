@@ -0,0 +1,162 @@
+package channeldb
+
+import (
+	"bytes"
+	"net"
+
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// nodeAddrTypeIndexBucket is a sub-bucket of the nodeBucket that
+	// indexes nodes by the types of the addresses they advertise. A node
+	// is indexed once under each type it has at least one address of.
+	//
+	// maps: addrType || pubKey -> nil
+	nodeAddrTypeIndexBucket = []byte("graph-node-addr-type-index")
+)
+
+// AddrType is the type of an address advertised by a node, which determines
+// how the node can be reached.
+type AddrType uint8
+
+const (
+	// AddrTypeIPv4 denotes an IPv4 TCP address.
+	AddrTypeIPv4 = AddrType(tcp4Addr)
+
+	// AddrTypeIPv6 denotes an IPv6 TCP address.
+	AddrTypeIPv6 = AddrType(tcp6Addr)
+
+	// AddrTypeTorV2 denotes a version 2 Tor onion service address.
+	AddrTypeTorV2 = AddrType(v2OnionAddr)
+
+	// AddrTypeTorV3 denotes a version 3 Tor onion service address.
+	AddrTypeTorV3 = AddrType(v3OnionAddr)
+)
+
+// IsClearnet returns true if the address type can be reached without Tor.
+func (t AddrType) IsClearnet() bool {
+	return t == AddrTypeIPv4 || t == AddrTypeIPv6
+}
+
+// String returns a human readable version of the address type.
+func (t AddrType) String() string {
+	switch t {
+	case AddrTypeIPv4:
+		return "IPv4"
+	case AddrTypeIPv6:
+		return "IPv6"
+	case AddrTypeTorV2:
+		return "TorV2"
+	case AddrTypeTorV3:
+		return "TorV3"
+	default:
+		return "Unknown"
+	}
+}
+
+// NodesByAddressType returns all nodes within the graph that advertise at
+// least one address of the given type, in the order of their public keys.
+func (c *ChannelGraph) NodesByAddressType(t AddrType) ([]LightningNode,
+	error) {
+
+	var nodes []LightningNode
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		nodeBucket := tx.Bucket(nodeBucket)
+		if nodeBucket == nil {
+			return ErrGraphNotFound
+		}
+		index := nodeBucket.Bucket(nodeAddrTypeIndexBucket)
+		if index == nil {
+			return nil
+		}
+
+		prefix := []byte{byte(t)}
+		cursor := index.Cursor()
+		k, _ := cursor.Seek(prefix)
+		for ; bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+			node, err := fetchLightningNode(nodeBucket, k[1:])
+			if err != nil {
+				return err
+			}
+			node.db = c.db
+
+			nodes = append(nodes, node)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return nodes, nil
+}
+
+// nodeAddrTypes returns the distinct types of the passed addresses. The type
+// of an address is the one it's serialized with, such that the index always
+// agrees with the stored node.
+func nodeAddrTypes(addrs []net.Addr) (map[AddrType]struct{}, error) {
+	types := make(map[AddrType]struct{})
+	for _, addr := range addrs {
+		var b bytes.Buffer
+		if err := serializeAddr(&b, addr); err != nil {
+			return nil, err
+		}
+
+		types[AddrType(b.Bytes()[0])] = struct{}{}
+	}
+
+	return types, nil
+}
+
+// updateNodeAddrTypeIndex replaces the index entries of the node with the
+// passed public key, derived from its old addresses, with those derived from
+// its new addresses. A nil newAddrs removes the node from the index.
+func updateNodeAddrTypeIndex(nodeBucket *bbolt.Bucket, nodePub []byte,
+	oldAddrs, newAddrs []net.Addr) error {
+
+	index, err := nodeBucket.CreateBucketIfNotExists(
+		nodeAddrTypeIndexBucket,
+	)
+	if err != nil {
+		return err
+	}
+
+	oldTypes, err := nodeAddrTypes(oldAddrs)
+	if err != nil {
+		return err
+	}
+	newTypes, err := nodeAddrTypes(newAddrs)
+	if err != nil {
+		return err
+	}
+
+	for t := range oldTypes {
+		if _, ok := newTypes[t]; ok {
+			continue
+		}
+		err := index.Delete(nodeAddrTypeKey(t, nodePub))
+		if err != nil {
+			return err
+		}
+	}
+	for t := range newTypes {
+		err := index.Put(nodeAddrTypeKey(t, nodePub), nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nodeAddrTypeKey returns the key of the node with the passed public key
+// within the address type index.
+func nodeAddrTypeKey(t AddrType, nodePub []byte) []byte {
+	key := make([]byte, 1+len(nodePub))
+	key[0] = byte(t)
+	copy(key[1:], nodePub)
+
+	return key
+}
@@ -0,0 +1,101 @@
+package channeldb
+
+import (
+	"net"
+	"testing"
+
+	"github.com/lightningnetwork/lnd/tor"
+)
+
+// assertNodesByAddressType asserts that exactly the expected nodes advertise
+// an address of the given type.
+func assertNodesByAddressType(t *testing.T, graph *ChannelGraph,
+	addrType AddrType, expected ...*LightningNode) {
+
+	t.Helper()
+
+	nodes, err := graph.NodesByAddressType(addrType)
+	if err != nil {
+		t.Fatalf("unable to fetch nodes: %v", err)
+	}
+
+	want := make(map[[33]byte]struct{})
+	for _, node := range expected {
+		want[node.PubKeyBytes] = struct{}{}
+	}
+	if len(nodes) != len(want) {
+		t.Fatalf("expected %v %v nodes, got %v", len(want), addrType,
+			len(nodes))
+	}
+	for _, node := range nodes {
+		if _, ok := want[node.PubKeyBytes]; !ok {
+			t.Fatalf("unexpected %v node %x", addrType,
+				node.PubKeyBytes)
+		}
+	}
+}
+
+// TestNodesByAddressType asserts that nodes are indexed by the types of the
+// addresses they advertise, and that the index follows updates to and the
+// deletion of a node.
+func TestNodesByAddressType(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+	graph := db.ChannelGraph()
+
+	onion := &tor.OnionAddr{
+		OnionService: "vww6ybal4bd7szmgncyruucpgfkqahzddi37ktceo3ah7" +
+			"ngmcopnpyyd.onion",
+		Port: 9735,
+	}
+
+	clearnet, err := createTestVertex(db)
+	if err != nil {
+		t.Fatalf("unable to create node: %v", err)
+	}
+	clearnet.Addresses = []net.Addr{testAddr}
+
+	hybrid, err := createTestVertex(db)
+	if err != nil {
+		t.Fatalf("unable to create node: %v", err)
+	}
+	hybrid.Addresses = []net.Addr{testAddr, onion}
+
+	for _, node := range []*LightningNode{clearnet, hybrid} {
+		if err := graph.AddLightningNode(node); err != nil {
+			t.Fatalf("unable to add node: %v", err)
+		}
+	}
+
+	assertNodesByAddressType(t, graph, AddrTypeIPv4, clearnet, hybrid)
+	assertNodesByAddressType(t, graph, AddrTypeTorV3, hybrid)
+	assertNodesByAddressType(t, graph, AddrTypeIPv6)
+
+	// Once the hybrid node stops advertising its clearnet address, it
+	// should only be found by its onion address.
+	hybrid.Addresses = []net.Addr{onion}
+	hybrid.LastUpdate = hybrid.LastUpdate.Add(1)
+	if err := graph.AddLightningNode(hybrid); err != nil {
+		t.Fatalf("unable to update node: %v", err)
+	}
+	assertNodesByAddressType(t, graph, AddrTypeIPv4, clearnet)
+	assertNodesByAddressType(t, graph, AddrTypeTorV3, hybrid)
+
+	pub, err := hybrid.PubKey()
+	if err != nil {
+		t.Fatalf("unable to parse pubkey: %v", err)
+	}
+	if err := graph.DeleteLightningNode(pub); err != nil {
+		t.Fatalf("unable to delete node: %v", err)
+	}
+	assertNodesByAddressType(t, graph, AddrTypeTorV3)
+
+	if !AddrTypeIPv6.IsClearnet() || AddrTypeTorV2.IsClearnet() {
+		t.Fatalf("address types misclassified")
+	}
+}
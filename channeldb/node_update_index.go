@@ -0,0 +1,86 @@
+package channeldb
+
+import (
+	"fmt"
+
+	"github.com/coreos/bbolt"
+)
+
+// legacyNodeUpdateIndexKeyLen is the length of a key within the node update
+// index prior to the v24 format, the update time followed by a compressed
+// public key.
+const legacyNodeUpdateIndexKeyLen = 8 + 33
+
+var (
+	// ErrInvalidNodeUpdateIndexKey is returned when a key within the node
+	// update index is in neither the length-prefixed nor the legacy
+	// format.
+	ErrInvalidNodeUpdateIndexKey = fmt.Errorf("invalid node update " +
+		"index key")
+)
+
+// nodeUpdateIndexKey returns the key of a node within the node update index,
+// the update time followed by the length-prefixed identifier of the node. As
+// the identifier is prefixed by its length, nodes identified by keys of any
+// length up to 255 bytes can be indexed.
+func nodeUpdateIndexKey(updateUnix uint64, nodeID []byte) []byte {
+	key := make([]byte, 8+1+len(nodeID))
+	byteOrder.PutUint64(key[:8], updateUnix)
+	key[8] = byte(len(nodeID))
+	copy(key[9:], nodeID)
+
+	return key
+}
+
+// legacyNodeUpdateIndexKey returns the key of a node within the node update
+// index as written prior to the v24 format.
+func legacyNodeUpdateIndexKey(updateUnix uint64, nodeID []byte) []byte {
+	key := make([]byte, 8+len(nodeID))
+	byteOrder.PutUint64(key[:8], updateUnix)
+	copy(key[8:], nodeID)
+
+	return key
+}
+
+// parseNodeUpdateIndexKey returns the update time and the node identifier
+// encoded within a key of the node update index. Both the length-prefixed
+// and the legacy format are accepted, such that the index can be read while
+// it's transitioned to the former. The formats can't be confused: the first
+// byte of a legacy key's public key is 0x02 or 0x03, which as a length prefix
+// never matches the remainder of a legacy key.
+func parseNodeUpdateIndexKey(key []byte) (uint64, []byte, error) {
+	if len(key) < 9 {
+		return 0, nil, ErrInvalidNodeUpdateIndexKey
+	}
+	updateUnix := byteOrder.Uint64(key[:8])
+
+	switch {
+	case len(key) == 9+int(key[8]):
+		return updateUnix, key[9:], nil
+
+	case len(key) == legacyNodeUpdateIndexKeyLen:
+		return updateUnix, key[8:], nil
+
+	default:
+		return 0, nil, ErrInvalidNodeUpdateIndexKey
+	}
+}
+
+// deleteNodeUpdateIndexKey removes the entry of the node with the passed
+// identifier and update time from the node update index. The entry is removed
+// in both formats, as it may not have been transitioned yet.
+func deleteNodeUpdateIndexKey(updateIndex *bbolt.Bucket,
+	cache *updateIndexCache, updateUnix uint64, nodeID []byte) error {
+
+	for _, key := range [][]byte{
+		nodeUpdateIndexKey(updateUnix, nodeID),
+		legacyNodeUpdateIndexKey(updateUnix, nodeID),
+	} {
+		if err := updateIndex.Delete(key); err != nil {
+			return err
+		}
+		cache.stageDelete(nodeUpdateIndexKind, key)
+	}
+
+	return nil
+}
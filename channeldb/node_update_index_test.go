@@ -0,0 +1,148 @@
+package channeldb
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+// TestParseNodeUpdateIndexKey asserts that keys of the node update index are
+// parsed in both the length-prefixed and the legacy format, and that keys in
+// neither format are rejected.
+func TestParseNodeUpdateIndexKey(t *testing.T) {
+	t.Parallel()
+
+	const updateUnix = 1234
+	pubKey := bytes.Repeat([]byte{0x02}, 33)
+	longID := bytes.Repeat([]byte{0x03}, 64)
+
+	tests := []struct {
+		name   string
+		key    []byte
+		nodeID []byte
+		err    error
+	}{
+		{
+			name:   "length-prefixed public key",
+			key:    nodeUpdateIndexKey(updateUnix, pubKey),
+			nodeID: pubKey,
+		},
+		{
+			name:   "length-prefixed long identifier",
+			key:    nodeUpdateIndexKey(updateUnix, longID),
+			nodeID: longID,
+		},
+		{
+			name:   "legacy public key",
+			key:    legacyNodeUpdateIndexKey(updateUnix, pubKey),
+			nodeID: pubKey,
+		},
+		{
+			name: "truncated",
+			key:  nodeUpdateIndexKey(updateUnix, pubKey)[:20],
+			err:  ErrInvalidNodeUpdateIndexKey,
+		},
+		{
+			name: "no identifier",
+			key:  make([]byte, 8),
+			err:  ErrInvalidNodeUpdateIndexKey,
+		},
+	}
+
+	for _, test := range tests {
+		unix, nodeID, err := parseNodeUpdateIndexKey(test.key)
+		if err != test.err {
+			t.Fatalf("%v: expected error %v, got %v", test.name,
+				test.err, err)
+		}
+		if err != nil {
+			continue
+		}
+		if unix != updateUnix {
+			t.Fatalf("%v: expected update time %v, got %v",
+				test.name, updateUnix, unix)
+		}
+		if !bytes.Equal(nodeID, test.nodeID) {
+			t.Fatalf("%v: expected node id %x, got %x", test.name,
+				test.nodeID, nodeID)
+		}
+	}
+}
+
+// TestNodeUpdateIndexLegacyKeys asserts that a node indexed by a legacy key is
+// still served by NodeUpdatesInHorizon, and that its legacy key is replaced
+// once the node is updated.
+func TestNodeUpdateIndexLegacyKeys(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	graph := db.ChannelGraph()
+	node, err := createTestVertex(db)
+	if err != nil {
+		t.Fatalf("unable to create node: %v", err)
+	}
+	if err := graph.AddLightningNode(node); err != nil {
+		t.Fatalf("unable to add node: %v", err)
+	}
+
+	updateUnix := uint64(node.LastUpdate.Unix())
+	legacyKey := legacyNodeUpdateIndexKey(updateUnix, node.PubKeyBytes[:])
+	err = db.Update(func(tx *bbolt.Tx) error {
+		index := tx.Bucket(nodeBucket).Bucket(nodeUpdateIndexBucket)
+		err := index.Delete(
+			nodeUpdateIndexKey(updateUnix, node.PubKeyBytes[:]),
+		)
+		if err != nil {
+			return err
+		}
+
+		return index.Put(legacyKey, nil)
+	})
+	if err != nil {
+		t.Fatalf("unable to write legacy key: %v", err)
+	}
+
+	start := node.LastUpdate.Add(-time.Hour)
+	end := node.LastUpdate.Add(time.Hour)
+	nodes, err := graph.NodeUpdatesInHorizon(start, end)
+	if err != nil {
+		t.Fatalf("unable to fetch node updates: %v", err)
+	}
+	if len(nodes) != 1 || nodes[0].PubKeyBytes != node.PubKeyBytes {
+		t.Fatalf("expected node %x within horizon, got %v",
+			node.PubKeyBytes, len(nodes))
+	}
+
+	// Updating the node must replace its legacy key, rather than leave it
+	// behind next to the new one.
+	node.LastUpdate = node.LastUpdate.Add(time.Minute)
+	if err := graph.AddLightningNode(node); err != nil {
+		t.Fatalf("unable to update node: %v", err)
+	}
+
+	var keys [][]byte
+	err = db.View(func(tx *bbolt.Tx) error {
+		index := tx.Bucket(nodeBucket).Bucket(nodeUpdateIndexBucket)
+		return index.ForEach(func(k, _ []byte) error {
+			keys = append(keys, append([]byte(nil), k...))
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("unable to read index: %v", err)
+	}
+
+	expected := nodeUpdateIndexKey(
+		uint64(node.LastUpdate.Unix()), node.PubKeyBytes[:],
+	)
+	if len(keys) != 1 || !bytes.Equal(keys[0], expected) {
+		t.Fatalf("expected only key %x, got %x", expected, keys)
+	}
+}
@@ -121,6 +121,15 @@ func putLinkNode(nodeMetaBucket *bbolt.Bucket, l *LinkNode) error {
 		return err
 	}
 
+	// The addresses of the node are also added to its address history,
+	// which is retained once the link node is deleted.
+	err := putPeerAddrHistory(
+		nodeMetaBucket.Tx(), l.IdentityPub, l.Addresses, l.LastSeen,
+	)
+	if err != nil {
+		return err
+	}
+
 	// Finally insert the link-node into the node metadata bucket keyed
 	// according to the its pubkey serialized in compressed form.
 	nodePub := l.IdentityPub.SerializeCompressed()
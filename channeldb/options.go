@@ -0,0 +1,105 @@
+package channeldb
+
+// SyncMode determines how the database trades durability for write
+// throughput.
+type SyncMode uint8
+
+const (
+	// FullSync syncs both the data pages and the freelist to disk on every
+	// commit. This is the default, and the only mode in which a committed
+	// transaction is guaranteed to survive a crash or power loss.
+	FullSync SyncMode = iota
+
+	// NoSync skips syncing to disk on commit altogether, leaving it to the
+	// operating system to flush dirty pages at its own pace. Transactions
+	// that were committed shortly before a crash or power loss may be lost,
+	// and the database file may be left corrupted beyond repair. This mode
+	// MUST only be used for benchmarks and disposable nodes, such as those
+	// of the test suite, and never for a node holding funds.
+	NoSync
+
+	// NoFreelistSync syncs data pages on commit, but doesn't write the
+	// freelist to disk. Committed data remains durable, while each
+	// commit writes fewer pages. In exchange, the freelist is rebuilt by
+	// scanning the entire database whenever it's opened, which slows down
+	// startup for large databases.
+	NoFreelistSync
+)
+
+// String returns a human readable version of the sync mode.
+func (m SyncMode) String() string {
+	switch m {
+	case FullSync:
+		return "FullSync"
+	case NoSync:
+		return "NoSync"
+	case NoFreelistSync:
+		return "NoFreelistSync"
+	default:
+		return "Unknown"
+	}
+}
+
+// Options holds parameters for tuning and customizing a channeldb.DB.
+type Options struct {
+	// SyncMode determines whether commits are synced to disk. See the
+	// documentation of each mode for its durability implications.
+	SyncMode SyncMode
+
+	// ReplicationSink, if set, receives the mutations committed to the
+	// database, such that they can be streamed to a standby. While it's
+	// set, write transactions are serialized with finding the mutations
+	// each of them committed.
+	ReplicationSink ReplicationSink
+
+	// ReadOnly opens the database without applying any pending migrations,
+	// such that it can be inspected before it's upgraded. Any attempt to
+	// write to the database fails.
+	ReadOnly bool
+
+	// RevocationLogLimit, if non-zero, is the max number of revoked states
+	// retained within the revocation log of each channel. Older states are
+	// trimmed as new ones are appended, see TrimRevocationLog.
+	RevocationLogLimit int
+}
+
+// DefaultOptions returns an Options populated with default values.
+func DefaultOptions() Options {
+	return Options{
+		SyncMode: FullSync,
+	}
+}
+
+// OptionModifier is a function signature for modifying the default Options.
+type OptionModifier func(*Options)
+
+// OptionSetSyncMode sets the sync mode of the database.
+func OptionSetSyncMode(mode SyncMode) OptionModifier {
+	return func(o *Options) {
+		o.SyncMode = mode
+	}
+}
+
+// OptionSetReplicationSink sets the sink that committed mutations are streamed
+// to.
+func OptionSetReplicationSink(sink ReplicationSink) OptionModifier {
+	return func(o *Options) {
+		o.ReplicationSink = sink
+	}
+}
+
+// OptionSetReadOnly sets whether the database is opened read-only, without
+// applying any pending migrations.
+func OptionSetReadOnly(readOnly bool) OptionModifier {
+	return func(o *Options) {
+		o.ReadOnly = readOnly
+	}
+}
+
+// OptionSetRevocationLogLimit sets the max number of revoked states retained
+// per channel. A limit of zero retains all revoked states.
+func OptionSetRevocationLogLimit(limit int) OptionModifier {
+	return func(o *Options) {
+		o.RevocationLogLimit = limit
+	}
+}
@@ -0,0 +1,60 @@
+package channeldb
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// TestOpenSyncMode asserts that the sync mode passed when opening the
+// database is applied to the underlying bolt database.
+func TestOpenSyncMode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		mode           SyncMode
+		noSync         bool
+		noFreelistSync bool
+	}{
+		{mode: FullSync},
+		{mode: NoSync, noSync: true},
+		{mode: NoFreelistSync, noFreelistSync: true},
+	}
+
+	for _, test := range tests {
+		tempDir, err := ioutil.TempDir("", "channeldb")
+		if err != nil {
+			t.Fatalf("unable to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		db, err := Open(tempDir, OptionSetSyncMode(test.mode))
+		if err != nil {
+			t.Fatalf("unable to open db with sync mode %v: %v",
+				test.mode, err)
+		}
+
+		if db.bdb.NoSync != test.noSync ||
+			db.bdb.NoFreelistSync != test.noFreelistSync {
+
+			t.Fatalf("sync mode %v: expected NoSync=%v "+
+				"NoFreelistSync=%v, got NoSync=%v "+
+				"NoFreelistSync=%v", test.mode, test.noSync,
+				test.noFreelistSync, db.bdb.NoSync,
+				db.bdb.NoFreelistSync)
+		}
+
+		db.Close()
+	}
+
+	tempDir, err := ioutil.TempDir("", "channeldb")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	_, err = Open(tempDir, OptionSetSyncMode(SyncMode(99)))
+	if err == nil {
+		t.Fatalf("expected unknown sync mode to be rejected")
+	}
+}
@@ -0,0 +1,152 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/coreos/bbolt"
+)
+
+const (
+	// paymentRouteChansType is the TLV record type of the channels an
+	// outgoing payment's route traversed. Payments whose channels aren't
+	// known don't carry the record.
+	paymentRouteChansType uint64 = 3
+)
+
+var (
+	// paymentChanIndexBucket is the top-level bucket that indexes
+	// outgoing payments by the channels their route traversed. Payments
+	// whose channels aren't known aren't indexed.
+	//
+	// maps: chanID => paymentID => nil
+	paymentChanIndexBucket = []byte("payment-chan-index")
+
+	// ErrRouteChansMismatch is returned when adding a payment whose route
+	// channels don't match the hops of its path.
+	ErrRouteChansMismatch = fmt.Errorf("number of route channels doesn't " +
+		"match path length")
+)
+
+// PaymentsThroughChannel returns all outgoing payments whose route traversed
+// the channel with the passed short channel ID, in the order they were added.
+// The channel may have been closed since. Payments are looked up through an
+// index of their route channels, which only covers payments that recorded
+// them.
+func (db *DB) PaymentsThroughChannel(chanID uint64) ([]*OutgoingPayment,
+	error) {
+
+	var payments []*OutgoingPayment
+	err := db.View(func(tx *bbolt.Tx) error {
+		payments = nil
+
+		index := tx.Bucket(paymentChanIndexBucket)
+		if index == nil {
+			return nil
+		}
+		var chanKey [8]byte
+		byteOrder.PutUint64(chanKey[:], chanID)
+		chanPayments := index.Bucket(chanKey[:])
+		if chanPayments == nil {
+			return nil
+		}
+		paymentsBucket := tx.Bucket(paymentBucket)
+		if paymentsBucket == nil {
+			return ErrNoPaymentsCreated
+		}
+
+		return chanPayments.ForEach(func(paymentID, _ []byte) error {
+			paymentBytes := paymentsBucket.Get(paymentID)
+			if paymentBytes == nil {
+				return fmt.Errorf("payment %x through channel "+
+					"%v not found", paymentID, chanID)
+			}
+
+			payment, err := deserializeOutgoingPayment(
+				bytes.NewReader(paymentBytes),
+			)
+			if err != nil {
+				return err
+			}
+
+			payments = append(payments, payment)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// putPaymentChanIndex indexes the payment with the passed ID under each of
+// the channels its route traversed.
+func putPaymentChanIndex(tx *bbolt.Tx, chanIDs []uint64,
+	paymentID []byte) error {
+
+	if len(chanIDs) == 0 {
+		return nil
+	}
+
+	index, err := tx.CreateBucketIfNotExists(paymentChanIndexBucket)
+	if err != nil {
+		return err
+	}
+
+	for _, chanID := range chanIDs {
+		var chanKey [8]byte
+		byteOrder.PutUint64(chanKey[:], chanID)
+
+		chanPayments, err := index.CreateBucketIfNotExists(chanKey[:])
+		if err != nil {
+			return err
+		}
+		if err := chanPayments.Put(paymentID, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateRouteChans ensures that a payment recording its route channels
+// records one for each hop of its path.
+func validateRouteChans(p *OutgoingPayment) error {
+	if len(p.RouteChanIDs) != 0 && len(p.RouteChanIDs) != len(p.Path) {
+		return ErrRouteChansMismatch
+	}
+
+	return nil
+}
+
+// encodeRouteChans serializes the route channels of a payment into the value
+// of their TLV record, or returns nil if they aren't known.
+func encodeRouteChans(p *OutgoingPayment) []byte {
+	if len(p.RouteChanIDs) == 0 {
+		return nil
+	}
+
+	value := make([]byte, 8*len(p.RouteChanIDs))
+	for i, chanID := range p.RouteChanIDs {
+		byteOrder.PutUint64(value[i*8:], chanID)
+	}
+
+	return value
+}
+
+// decodeRouteChans deserializes the route channels of a payment from the value
+// of their TLV record.
+func decodeRouteChans(value []byte) ([]uint64, error) {
+	if len(value) == 0 || len(value)%8 != 0 {
+		return nil, fmt.Errorf("invalid payment route channels record "+
+			"length %v", len(value))
+	}
+
+	chanIDs := make([]uint64, len(value)/8)
+	for i := range chanIDs {
+		chanIDs[i] = byteOrder.Uint64(value[i*8:])
+	}
+
+	return chanIDs, nil
+}
@@ -0,0 +1,86 @@
+package channeldb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestPaymentsThroughChannel asserts that payments are returned for each of
+// the channels their route traversed, and that their route channels round
+// trip through the database.
+func TestPaymentsThroughChannel(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	addPayment := func(chanIDs ...uint64) *OutgoingPayment {
+		t.Helper()
+
+		payment, err := makeRandomFakePayment()
+		if err != nil {
+			t.Fatalf("unable to create payment: %v", err)
+		}
+		payment.Path = make([][33]byte, len(chanIDs))
+		payment.RouteChanIDs = chanIDs
+		if err := db.AddPayment(payment); err != nil {
+			t.Fatalf("unable to add payment: %v", err)
+		}
+
+		return payment
+	}
+
+	assertPayments := func(chanID uint64, expected ...*OutgoingPayment) {
+		t.Helper()
+
+		payments, err := db.PaymentsThroughChannel(chanID)
+		if err != nil {
+			t.Fatalf("unable to fetch payments: %v", err)
+		}
+		if len(payments) != len(expected) {
+			t.Fatalf("expected %v payments through channel %v, "+
+				"got %v", len(expected), chanID, len(payments))
+		}
+		for i := range expected {
+			if !reflect.DeepEqual(expected[i], payments[i]) {
+				t.Fatalf("payment mismatch: expected %v, "+
+					"got %v", spew.Sdump(expected[i]),
+					spew.Sdump(payments[i]))
+			}
+		}
+	}
+
+	// Without any payments, none traversed the channel.
+	assertPayments(1)
+
+	first := addPayment(1, 2)
+	second := addPayment(3, 2)
+	addPayment()
+
+	assertPayments(1, first)
+	assertPayments(2, first, second)
+	assertPayments(3, second)
+	assertPayments(4)
+
+	// A payment must record a channel for each hop of its path, if any.
+	payment, err := makeRandomFakePayment()
+	if err != nil {
+		t.Fatalf("unable to create payment: %v", err)
+	}
+	payment.Path = make([][33]byte, 2)
+	payment.RouteChanIDs = []uint64{1}
+	if err := db.AddPayment(payment); err != ErrRouteChansMismatch {
+		t.Fatalf("expected ErrRouteChansMismatch, got %v", err)
+	}
+
+	// Deleting all payments also clears the index.
+	if err := db.DeleteAllPayments(); err != nil {
+		t.Fatalf("unable to delete payments: %v", err)
+	}
+	assertPayments(2)
+}
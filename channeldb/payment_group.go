@@ -0,0 +1,177 @@
+package channeldb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/coreos/bbolt"
+)
+
+const (
+	// paymentGroupIDType is the TLV record type of the group an outgoing
+	// payment was sent as part of. Payments of the zero group don't carry
+	// the record.
+	paymentGroupIDType uint64 = 0
+
+	// paymentGroupIDLen is the length of a payment group ID.
+	paymentGroupIDLen = 16
+)
+
+var (
+	// paymentGroupIndexBucket is the top-level bucket that indexes
+	// outgoing payments by the group they were sent as part of. Payments
+	// that weren't sent as part of a group are indexed under the zero
+	// group.
+	//
+	// maps: groupID => paymentID => nil
+	paymentGroupIndexBucket = []byte("payment-group-index")
+)
+
+// GroupStatus summarizes the statuses of all outgoing payments sent as part
+// of a single group.
+type GroupStatus struct {
+	// Succeeded is the number of payments of the group that completed.
+	Succeeded int
+
+	// Failed is the number of payments of the group that were attempted,
+	// but didn't complete.
+	Failed int
+
+	// InFlight is the number of payments of the group that have been
+	// initiated, but haven't received a response yet.
+	InFlight int
+}
+
+// Total returns the number of payments of the group.
+func (g GroupStatus) Total() int {
+	return g.Succeeded + g.Failed + g.InFlight
+}
+
+// putPaymentGroupIndex indexes the payment with the passed ID under the group
+// it was sent as part of.
+func putPaymentGroupIndex(tx *bbolt.Tx, groupID [16]byte,
+	paymentID []byte) error {
+
+	index, err := tx.CreateBucketIfNotExists(paymentGroupIndexBucket)
+	if err != nil {
+		return err
+	}
+	group, err := index.CreateBucketIfNotExists(groupID[:])
+	if err != nil {
+		return err
+	}
+
+	return group.Put(paymentID, nil)
+}
+
+// PaymentsInGroup returns all outgoing payments sent as part of the group
+// with the passed ID, in the order they were added. Payments that weren't
+// sent as part of a group are returned for the zero group.
+func (db *DB) PaymentsInGroup(groupID [16]byte) ([]*OutgoingPayment, error) {
+	var payments []*OutgoingPayment
+	err := db.View(func(tx *bbolt.Tx) error {
+		var err error
+		payments, err = fetchPaymentsInGroup(tx, groupID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// GroupPaymentStatus returns the number of succeeded, failed and in-flight
+// payments sent as part of the group with the passed ID. As all payments of
+// the group are read within a single transaction, the summary reflects a
+// consistent view of the group.
+func (db *DB) GroupPaymentStatus(groupID [16]byte) (GroupStatus, error) {
+	var status GroupStatus
+	err := db.View(func(tx *bbolt.Tx) error {
+		payments, err := fetchPaymentsInGroup(tx, groupID)
+		if err != nil {
+			return err
+		}
+
+		for _, payment := range payments {
+			payHash := sha256.Sum256(payment.PaymentPreimage[:])
+			paymentStatus, err := FetchPaymentStatusTx(tx, payHash)
+			if err != nil {
+				return err
+			}
+
+			switch paymentStatus {
+			case StatusCompleted:
+				status.Succeeded++
+			case StatusInFlight:
+				status.InFlight++
+			default:
+				status.Failed++
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return GroupStatus{}, err
+	}
+
+	return status, nil
+}
+
+// fetchPaymentsInGroup returns all outgoing payments indexed under the group
+// with the passed ID.
+func fetchPaymentsInGroup(tx *bbolt.Tx,
+	groupID [16]byte) ([]*OutgoingPayment, error) {
+
+	index := tx.Bucket(paymentGroupIndexBucket)
+	if index == nil {
+		return nil, nil
+	}
+	group := index.Bucket(groupID[:])
+	if group == nil {
+		return nil, nil
+	}
+	paymentsBucket := tx.Bucket(paymentBucket)
+	if paymentsBucket == nil {
+		return nil, ErrNoPaymentsCreated
+	}
+
+	var payments []*OutgoingPayment
+	err := group.ForEach(func(paymentID, _ []byte) error {
+		paymentBytes := paymentsBucket.Get(paymentID)
+		if paymentBytes == nil {
+			return fmt.Errorf("payment %x of group %x not found",
+				paymentID, groupID)
+		}
+
+		payment, err := deserializeOutgoingPayment(
+			bytes.NewReader(paymentBytes),
+		)
+		if err != nil {
+			return err
+		}
+
+		payments = append(payments, payment)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// decodePaymentGroupID deserializes a payment group ID from the value of its
+// TLV record.
+func decodePaymentGroupID(value []byte) ([16]byte, error) {
+	var groupID [16]byte
+	if len(value) != paymentGroupIDLen {
+		return groupID, fmt.Errorf("invalid payment group id record "+
+			"of %v bytes", len(value))
+	}
+	copy(groupID[:], value)
+
+	return groupID, nil
+}
@@ -0,0 +1,103 @@
+package channeldb
+
+import (
+	"crypto/sha256"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestPaymentGroups asserts that outgoing payments can be fetched by the
+// group they were sent as part of, and that the statuses of a group's
+// payments are summarized correctly.
+func TestPaymentGroups(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	groupA := [16]byte{1}
+	groupB := [16]byte{2}
+
+	// We'll add three payments to the first group, one to the second, and
+	// one that isn't part of any group.
+	var groupPayments []*OutgoingPayment
+	statuses := []PaymentStatus{
+		StatusCompleted, StatusInFlight, StatusGrounded,
+	}
+	for _, status := range statuses {
+		payment, err := makeRandomFakePayment()
+		if err != nil {
+			t.Fatalf("unable to create payment: %v", err)
+		}
+		payment.GroupID = groupA
+		if err := db.AddPayment(payment); err != nil {
+			t.Fatalf("unable to add payment: %v", err)
+		}
+
+		payHash := sha256.Sum256(payment.PaymentPreimage[:])
+		if err := db.UpdatePaymentStatus(payHash, status); err != nil {
+			t.Fatalf("unable to update payment status: %v", err)
+		}
+
+		groupPayments = append(groupPayments, payment)
+	}
+
+	otherPayment, err := makeRandomFakePayment()
+	if err != nil {
+		t.Fatalf("unable to create payment: %v", err)
+	}
+	otherPayment.GroupID = groupB
+	if err := db.AddPayment(otherPayment); err != nil {
+		t.Fatalf("unable to add payment: %v", err)
+	}
+
+	ungrouped, err := makeRandomFakePayment()
+	if err != nil {
+		t.Fatalf("unable to create payment: %v", err)
+	}
+	if err := db.AddPayment(ungrouped); err != nil {
+		t.Fatalf("unable to add payment: %v", err)
+	}
+
+	assertGroup := func(groupID [16]byte, expected []*OutgoingPayment) {
+		t.Helper()
+
+		payments, err := db.PaymentsInGroup(groupID)
+		if err != nil {
+			t.Fatalf("unable to fetch payments of group: %v", err)
+		}
+		if !reflect.DeepEqual(payments, expected) {
+			t.Fatalf("payment mismatch: expected %v, got %v",
+				spew.Sdump(expected), spew.Sdump(payments))
+		}
+	}
+
+	assertGroup(groupA, groupPayments)
+	assertGroup(groupB, []*OutgoingPayment{otherPayment})
+	assertGroup([16]byte{}, []*OutgoingPayment{ungrouped})
+	assertGroup([16]byte{3}, nil)
+
+	status, err := db.GroupPaymentStatus(groupA)
+	if err != nil {
+		t.Fatalf("unable to fetch group status: %v", err)
+	}
+	expected := GroupStatus{Succeeded: 1, Failed: 1, InFlight: 1}
+	if status != expected {
+		t.Fatalf("expected group status %v, got %v", expected, status)
+	}
+	if status.Total() != len(groupPayments) {
+		t.Fatalf("expected %v payments, got %v", len(groupPayments),
+			status.Total())
+	}
+
+	// Deleting all payments should empty the groups as well.
+	if err := db.DeleteAllPayments(); err != nil {
+		t.Fatalf("unable to delete payments: %v", err)
+	}
+	assertGroup(groupA, nil)
+}
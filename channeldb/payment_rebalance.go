@@ -0,0 +1,231 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+const (
+	// paymentRebalanceType is the TLV record type that marks an outgoing
+	// payment as a rebalance. Payments that aren't rebalances don't carry
+	// the record.
+	paymentRebalanceType uint64 = 1
+
+	// paymentRebalanceChansType is the TLV record type of the channels a
+	// rebalance was sent out and came back in through. Rebalances whose
+	// channels aren't known don't carry the record.
+	paymentRebalanceChansType uint64 = 2
+)
+
+var (
+	// ErrRebalanceChansWithoutFlag is returned when adding a payment that
+	// has rebalance channels set, but isn't marked as a rebalance.
+	ErrRebalanceChansWithoutFlag = fmt.Errorf("rebalance channels set " +
+		"on payment that isn't a rebalance")
+)
+
+// RebalancePayments returns all rebalancing payments created within the
+// inclusive time range, in the order they were added.
+func (d *DB) RebalancePayments(start,
+	end time.Time) ([]*OutgoingPayment, error) {
+
+	var payments []*OutgoingPayment
+	err := d.View(func(tx *bbolt.Tx) error {
+		payments = nil
+
+		return forEachRebalance(tx, start, end,
+			func(payment *OutgoingPayment) error {
+				payments = append(payments, payment)
+				return nil
+			},
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// NetRoutingProfit returns the fees earned by forwarding HTLCs within the
+// inclusive time range, the fees paid for rebalancing payments created within
+// the same range, and the difference between the two. As amounts can't be
+// negative, net is zero if rebalancing cost more than was earned, which the
+// caller can tell by comparing earned to rebalanceCost. If any of the totals
+// exceeds the range of a uint64, ErrAmountOverflow is returned.
+func (d *DB) NetRoutingProfit(start, end time.Time) (earned, rebalanceCost,
+	net lnwire.MilliSatoshi, err error) {
+
+	err = d.View(func(tx *bbolt.Tx) error {
+		var err error
+		earned, err = sumForwardingFees(tx, start, end)
+		if err != nil {
+			return err
+		}
+
+		rebalanceCost, err = sumRebalanceFees(tx, start, end)
+		return err
+	})
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	if earned > rebalanceCost {
+		net = earned - rebalanceCost
+	}
+
+	return earned, rebalanceCost, net, nil
+}
+
+// sumForwardingFees returns the total fees earned by all forwarding events
+// within the inclusive time range.
+func sumForwardingFees(tx *bbolt.Tx, start,
+	end time.Time) (lnwire.MilliSatoshi, error) {
+
+	logBucket := tx.Bucket(forwardingLogBucket)
+	if logBucket == nil {
+		return 0, nil
+	}
+
+	var startTime, endTime [8]byte
+	byteOrder.PutUint64(startTime[:], uint64(start.UnixNano()))
+	byteOrder.PutUint64(endTime[:], uint64(end.UnixNano()))
+
+	var total lnwire.MilliSatoshi
+	c := logBucket.Cursor()
+	for k, v := c.Seek(startTime[:]); k != nil &&
+		bytes.Compare(k, endTime[:]) <= 0; k, v = c.Next() {
+
+		readBuf := bytes.NewReader(v)
+		for readBuf.Len() != 0 {
+			var event ForwardingEvent
+			err := decodeForwardingEvent(readBuf, &event)
+			if err != nil {
+				return 0, err
+			}
+
+			fee, err := subAmount(event.AmtIn, event.AmtOut)
+			if err != nil {
+				return 0, err
+			}
+
+			total, err = addAmount(total, fee)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return total, nil
+}
+
+// sumRebalanceFees returns the total fees paid by all rebalancing payments
+// created within the inclusive time range.
+func sumRebalanceFees(tx *bbolt.Tx, start,
+	end time.Time) (lnwire.MilliSatoshi, error) {
+
+	var total lnwire.MilliSatoshi
+	err := forEachRebalance(tx, start, end,
+		func(payment *OutgoingPayment) error {
+			var err error
+			total, err = addAmount(total, payment.Fee)
+			return err
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// forEachRebalance calls cb with each rebalancing payment created within the
+// inclusive time range, in the order they were added.
+func forEachRebalance(tx *bbolt.Tx, start, end time.Time,
+	cb func(*OutgoingPayment) error) error {
+
+	payments := tx.Bucket(paymentBucket)
+	if payments == nil {
+		return nil
+	}
+
+	return payments.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return nil
+		}
+
+		payment, err := deserializeOutgoingPayment(bytes.NewReader(v))
+		if err != nil {
+			return err
+		}
+		if !payment.IsRebalance ||
+			payment.CreationDate.Before(start) ||
+			payment.CreationDate.After(end) {
+
+			return nil
+		}
+
+		return cb(payment)
+	})
+}
+
+// validateRebalance ensures that only payments marked as rebalances have
+// rebalance channels set.
+func validateRebalance(p *OutgoingPayment) error {
+	hasChans := p.RebalanceSource != (lnwire.ShortChannelID{}) ||
+		p.RebalanceDest != (lnwire.ShortChannelID{})
+	if hasChans && !p.IsRebalance {
+		return ErrRebalanceChansWithoutFlag
+	}
+
+	return nil
+}
+
+// decodePaymentRebalance deserializes the rebalance flag of an outgoing
+// payment from the value of its TLV record.
+func decodePaymentRebalance(value []byte) (bool, error) {
+	if len(value) != 1 || value[0] != 1 {
+		return false, fmt.Errorf("invalid payment rebalance record "+
+			"%x", value)
+	}
+
+	return true, nil
+}
+
+// encodeRebalanceChans serializes the channels of a rebalance into the value
+// of their TLV record, or returns nil if neither channel is known.
+func encodeRebalanceChans(p *OutgoingPayment) []byte {
+	if p.RebalanceSource == (lnwire.ShortChannelID{}) &&
+		p.RebalanceDest == (lnwire.ShortChannelID{}) {
+
+		return nil
+	}
+
+	value := make([]byte, 16)
+	byteOrder.PutUint64(value[:8], p.RebalanceSource.ToUint64())
+	byteOrder.PutUint64(value[8:], p.RebalanceDest.ToUint64())
+
+	return value
+}
+
+// decodeRebalanceChans deserializes the channels of a rebalance from the value
+// of their TLV record into the passed payment.
+func decodeRebalanceChans(value []byte, p *OutgoingPayment) error {
+	if len(value) != 16 {
+		return fmt.Errorf("invalid payment rebalance channels record "+
+			"length %v", len(value))
+	}
+
+	p.RebalanceSource = lnwire.NewShortChanIDFromInt(
+		byteOrder.Uint64(value[:8]),
+	)
+	p.RebalanceDest = lnwire.NewShortChanIDFromInt(
+		byteOrder.Uint64(value[8:]),
+	)
+
+	return nil
+}
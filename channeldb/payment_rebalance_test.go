@@ -0,0 +1,171 @@
+package channeldb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestNetRoutingProfit asserts that the fees of forwarding events are offset
+// by the fees of rebalancing payments within the same time range, while other
+// payments are ignored.
+func TestNetRoutingProfit(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	start := time.Unix(1000, 0)
+	hour := time.Hour
+	events := []ForwardingEvent{
+		{Timestamp: start, AmtIn: 10100, AmtOut: 10000},
+		{Timestamp: start.Add(hour), AmtIn: 5050, AmtOut: 5000},
+		{Timestamp: start.Add(2 * hour), AmtIn: 1500, AmtOut: 1000},
+	}
+	if err := db.ForwardingLog().AddForwardingEvents(events); err != nil {
+		t.Fatalf("unable to add events: %v", err)
+	}
+
+	payments := []struct {
+		created     time.Time
+		fee         lnwire.MilliSatoshi
+		isRebalance bool
+	}{
+		{start, 30, true},
+		{start.Add(time.Hour), 1000, false},
+		{start.Add(2 * time.Hour), 900, true},
+	}
+	for _, p := range payments {
+		payment, err := makeRandomFakePayment()
+		if err != nil {
+			t.Fatalf("unable to create payment: %v", err)
+		}
+		payment.CreationDate = p.created
+		payment.Fee = p.fee
+		payment.IsRebalance = p.isRebalance
+		if err := db.AddPayment(payment); err != nil {
+			t.Fatalf("unable to add payment: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name                  string
+		end                   time.Time
+		earned, rebalanceCost lnwire.MilliSatoshi
+		net                   lnwire.MilliSatoshi
+	}{
+		{
+			name:          "profit",
+			end:           start.Add(time.Hour),
+			earned:        150,
+			rebalanceCost: 30,
+			net:           120,
+		},
+		{
+			// A rebalance costing more than was earned leaves no
+			// net profit.
+			name:          "loss",
+			end:           start.Add(2 * time.Hour),
+			earned:        650,
+			rebalanceCost: 930,
+			net:           0,
+		},
+	}
+	for _, test := range tests {
+		earned, cost, net, err := db.NetRoutingProfit(start, test.end)
+		if err != nil {
+			t.Fatalf("%v: unable to compute profit: %v", test.name,
+				err)
+		}
+		if earned != test.earned || cost != test.rebalanceCost ||
+			net != test.net {
+
+			t.Fatalf("%v: expected (%v, %v, %v), got (%v, %v, %v)",
+				test.name, test.earned, test.rebalanceCost,
+				test.net, earned, cost, net)
+		}
+	}
+
+	// The rebalance flag survives a round trip through the database.
+	fetched, err := db.FetchAllPayments()
+	if err != nil {
+		t.Fatalf("unable to fetch payments: %v", err)
+	}
+	for i, payment := range fetched {
+		if payment.IsRebalance != payments[i].isRebalance {
+			t.Fatalf("payment %v: expected rebalance flag %v",
+				i, payments[i].isRebalance)
+		}
+	}
+}
+
+// TestRebalancePayments asserts that only rebalances created within the time
+// range are returned, along with their channels, and that rebalance channels
+// can't be set on other payments.
+func TestRebalancePayments(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	start := time.Unix(1000, 0)
+	srcChan := lnwire.NewShortChanIDFromInt(1)
+	destChan := lnwire.NewShortChanIDFromInt(2)
+
+	var rebalances []*OutgoingPayment
+	for i := 0; i < 4; i++ {
+		payment, err := makeRandomFakePayment()
+		if err != nil {
+			t.Fatalf("unable to create payment: %v", err)
+		}
+		payment.CreationDate = start.Add(time.Duration(i) * time.Hour)
+
+		// Every other payment is a rebalance, of which only the first
+		// records its channels.
+		if i%2 == 0 {
+			payment.IsRebalance = true
+			rebalances = append(rebalances, payment)
+		}
+		if i == 0 {
+			payment.RebalanceSource = srcChan
+			payment.RebalanceDest = destChan
+		}
+
+		if err := db.AddPayment(payment); err != nil {
+			t.Fatalf("unable to add payment: %v", err)
+		}
+	}
+
+	assertRebalances := func(end time.Time, expected []*OutgoingPayment) {
+		t.Helper()
+
+		payments, err := db.RebalancePayments(start, end)
+		if err != nil {
+			t.Fatalf("unable to fetch rebalances: %v", err)
+		}
+		if !reflect.DeepEqual(payments, expected) {
+			t.Fatalf("expected rebalances %v, got %v",
+				spew.Sdump(expected), spew.Sdump(payments))
+		}
+	}
+	assertRebalances(start.Add(time.Hour), rebalances[:1])
+	assertRebalances(start.Add(3*time.Hour), rebalances)
+
+	payment, err := makeRandomFakePayment()
+	if err != nil {
+		t.Fatalf("unable to create payment: %v", err)
+	}
+	payment.RebalanceDest = destChan
+	if err := db.AddPayment(payment); err != ErrRebalanceChansWithoutFlag {
+		t.Fatalf("expected ErrRebalanceChansWithoutFlag, got %v", err)
+	}
+}
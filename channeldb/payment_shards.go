@@ -0,0 +1,284 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+var (
+	// paymentShardsBucket is the top-level bucket that stores the shards
+	// dispatched for each multi-part payment. Each payment has its own
+	// sub-bucket keyed by its payment hash, which holds an entry per
+	// shard keyed by its ID.
+	//
+	// maps: paymentHash => shardID => chanID || amt || status
+	paymentShardsBucket = []byte("payment-shards")
+
+	// ErrDuplicateShard is returned when dispatching a shard whose ID is
+	// already taken by another shard of the payment.
+	ErrDuplicateShard = fmt.Errorf("payment shard with id already exists")
+
+	// ErrShardNotFound is returned when resolving a shard that wasn't
+	// dispatched.
+	ErrShardNotFound = fmt.Errorf("payment shard not found")
+
+	// ErrShardAlreadyResolved is returned when resolving a shard that was
+	// already resolved.
+	ErrShardAlreadyResolved = fmt.Errorf("payment shard already resolved")
+
+	// ErrInvalidShardResolution is returned when resolving a shard with a
+	// status other than ShardSettled or ShardFailed.
+	ErrInvalidShardResolution = fmt.Errorf("payment shard must be " +
+		"resolved as settled or failed")
+)
+
+// ShardStatus is the state of a single shard of a multi-part payment.
+type ShardStatus uint8
+
+const (
+	// ShardInFlight denotes a shard that was dispatched, but hasn't been
+	// resolved yet.
+	ShardInFlight ShardStatus = 0
+
+	// ShardSettled denotes a shard that was settled by the destination.
+	ShardSettled ShardStatus = 1
+
+	// ShardFailed denotes a shard that was failed back to us.
+	ShardFailed ShardStatus = 2
+)
+
+// String returns a human readable identifier for the ShardStatus type.
+func (s ShardStatus) String() string {
+	switch s {
+	case ShardInFlight:
+		return "InFlight"
+	case ShardSettled:
+		return "Settled"
+	case ShardFailed:
+		return "Failed"
+	}
+
+	return "Unknown"
+}
+
+// PaymentShard is a single shard of a multi-part payment, sent as an HTLC of
+// its own.
+type PaymentShard struct {
+	// ID identifies the shard among the shards of its payment.
+	ID uint64
+
+	// ChanID is the channel the shard was sent out through.
+	ChanID lnwire.ShortChannelID
+
+	// Amt is the amount the shard delivers to the destination.
+	Amt lnwire.MilliSatoshi
+
+	// Status is the state of the shard.
+	Status ShardStatus
+}
+
+// MPPPaymentState is the state of a multi-part payment required to resume it
+// after a restart.
+type MPPPaymentState struct {
+	// PaymentHash is the payment hash of the payment.
+	PaymentHash [32]byte
+
+	// Status is the status of the payment as a whole.
+	Status PaymentStatus
+
+	// Shards are all shards dispatched for the payment, ordered by their
+	// ID.
+	Shards []PaymentShard
+}
+
+// DispatchShard records that the shard of the payment with the passed payment
+// hash was dispatched. The shard is recorded as in flight regardless of its
+// status, and the payment is marked as in flight within the same transaction.
+func (db *DB) DispatchShard(paymentHash [32]byte, shard *PaymentShard) error {
+	return db.Batch(func(tx *bbolt.Tx) error {
+		shards, err := tx.CreateBucketIfNotExists(paymentShardsBucket)
+		if err != nil {
+			return err
+		}
+		paymentShards, err := shards.CreateBucketIfNotExists(
+			paymentHash[:],
+		)
+		if err != nil {
+			return err
+		}
+
+		var shardKey [8]byte
+		byteOrder.PutUint64(shardKey[:], shard.ID)
+		if paymentShards.Get(shardKey[:]) != nil {
+			return ErrDuplicateShard
+		}
+
+		dispatched := *shard
+		dispatched.Status = ShardInFlight
+		err = putPaymentShard(paymentShards, shardKey[:], &dispatched)
+		if err != nil {
+			return err
+		}
+
+		return UpdatePaymentStatusTx(tx, paymentHash, StatusInFlight)
+	})
+}
+
+// ResolveShard records that the in-flight shard with the passed ID of the
+// payment with the passed payment hash was resolved with the given status,
+// which must be either ShardSettled or ShardFailed.
+func (db *DB) ResolveShard(paymentHash [32]byte, shardID uint64,
+	status ShardStatus) error {
+
+	if status != ShardSettled && status != ShardFailed {
+		return ErrInvalidShardResolution
+	}
+
+	return db.Batch(func(tx *bbolt.Tx) error {
+		shards := tx.Bucket(paymentShardsBucket)
+		if shards == nil {
+			return ErrShardNotFound
+		}
+		paymentShards := shards.Bucket(paymentHash[:])
+		if paymentShards == nil {
+			return ErrShardNotFound
+		}
+
+		var shardKey [8]byte
+		byteOrder.PutUint64(shardKey[:], shardID)
+		shardBytes := paymentShards.Get(shardKey[:])
+		if shardBytes == nil {
+			return ErrShardNotFound
+		}
+
+		shard, err := deserializePaymentShard(
+			bytes.NewReader(shardBytes),
+		)
+		if err != nil {
+			return err
+		}
+		if shard.Status != ShardInFlight {
+			return ErrShardAlreadyResolved
+		}
+		shard.ID = shardID
+		shard.Status = status
+
+		return putPaymentShard(paymentShards, shardKey[:], shard)
+	})
+}
+
+// ResumableMPPPayments returns the state of all multi-part payments that have
+// at least one shard in flight, ordered by their payment hash. After a
+// restart, these are the payments whose shards must be tracked until they
+// resolve, for the payment to either complete or be aborted. A payment no
+// longer needs to be resumed once all of its shards resolved.
+func (db *DB) ResumableMPPPayments() ([]MPPPaymentState, error) {
+	var payments []MPPPaymentState
+	err := db.View(func(tx *bbolt.Tx) error {
+		payments = nil
+
+		shards := tx.Bucket(paymentShardsBucket)
+		if shards == nil {
+			return nil
+		}
+
+		return shards.ForEach(func(paymentHash, _ []byte) error {
+			paymentShards := shards.Bucket(paymentHash)
+			if paymentShards == nil {
+				return nil
+			}
+
+			var payment MPPPaymentState
+			copy(payment.PaymentHash[:], paymentHash)
+
+			var inFlight bool
+			err := paymentShards.ForEach(func(k, v []byte) error {
+				if len(k) != 8 {
+					return fmt.Errorf("invalid payment "+
+						"shard key %x", k)
+				}
+
+				shard, err := deserializePaymentShard(
+					bytes.NewReader(v),
+				)
+				if err != nil {
+					return err
+				}
+				shard.ID = byteOrder.Uint64(k)
+
+				if shard.Status == ShardInFlight {
+					inFlight = true
+				}
+				payment.Shards = append(payment.Shards, *shard)
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if !inFlight {
+				return nil
+			}
+
+			payment.Status, err = FetchPaymentStatusTx(
+				tx, payment.PaymentHash,
+			)
+			if err != nil {
+				return err
+			}
+			payments = append(payments, payment)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// putPaymentShard writes the shard under the passed key within the bucket of
+// its payment's shards.
+func putPaymentShard(paymentShards *bbolt.Bucket, shardKey []byte,
+	shard *PaymentShard) error {
+
+	var b bytes.Buffer
+	if err := serializePaymentShard(&b, shard); err != nil {
+		return err
+	}
+
+	return paymentShards.Put(shardKey, b.Bytes())
+}
+
+// serializePaymentShard writes the shard to w. The ID of the shard isn't
+// serialized, as it's the key of the shard.
+func serializePaymentShard(w io.Writer, shard *PaymentShard) error {
+	if err := WriteElements(w, shard.ChanID, shard.Amt); err != nil {
+		return err
+	}
+
+	_, err := w.Write([]byte{byte(shard.Status)})
+	return err
+}
+
+// deserializePaymentShard reads a shard serialized by serializePaymentShard
+// from r.
+func deserializePaymentShard(r io.Reader) (*PaymentShard, error) {
+	shard := &PaymentShard{}
+	if err := ReadElements(r, &shard.ChanID, &shard.Amt); err != nil {
+		return nil, err
+	}
+
+	var status [1]byte
+	if _, err := io.ReadFull(r, status[:]); err != nil {
+		return nil, err
+	}
+	shard.Status = ShardStatus(status[0])
+
+	return shard, nil
+}
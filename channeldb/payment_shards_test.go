@@ -0,0 +1,111 @@
+package channeldb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestResumableMPPPayments asserts that the shards of multi-part payments are
+// tracked as they're dispatched and resolved, and that only payments with
+// shards in flight are resumable.
+func TestResumableMPPPayments(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	assertResumable := func(expected []MPPPaymentState) {
+		t.Helper()
+
+		payments, err := db.ResumableMPPPayments()
+		if err != nil {
+			t.Fatalf("unable to fetch resumable payments: %v", err)
+		}
+		if !reflect.DeepEqual(payments, expected) {
+			t.Fatalf("expected payments %v, got %v",
+				spew.Sdump(expected), spew.Sdump(payments))
+		}
+	}
+
+	assertResumable(nil)
+
+	hashA, hashB := [32]byte{1}, [32]byte{2}
+	shardsA := []PaymentShard{
+		{ID: 0, ChanID: lnwire.NewShortChanIDFromInt(1), Amt: 1000},
+		{ID: 1, ChanID: lnwire.NewShortChanIDFromInt(2), Amt: 2000},
+	}
+	shardB := PaymentShard{
+		ID:     0,
+		ChanID: lnwire.NewShortChanIDFromInt(1),
+		Amt:    3000,
+
+		// The status of a dispatched shard is ignored.
+		Status: ShardSettled,
+	}
+	for i := range shardsA {
+		if err := db.DispatchShard(hashA, &shardsA[i]); err != nil {
+			t.Fatalf("unable to dispatch shard: %v", err)
+		}
+	}
+	if err := db.DispatchShard(hashB, &shardB); err != nil {
+		t.Fatalf("unable to dispatch shard: %v", err)
+	}
+	if err := db.DispatchShard(hashB, &shardB); err != ErrDuplicateShard {
+		t.Fatalf("expected ErrDuplicateShard, got %v", err)
+	}
+	shardB.Status = ShardInFlight
+
+	assertResumable([]MPPPaymentState{
+		{
+			PaymentHash: hashA,
+			Status:      StatusInFlight,
+			Shards:      shardsA,
+		},
+		{
+			PaymentHash: hashB,
+			Status:      StatusInFlight,
+			Shards:      []PaymentShard{shardB},
+		},
+	})
+
+	// A payment with some of its shards resolved is still resumable,
+	// while one whose shards all resolved isn't.
+	if err := db.ResolveShard(hashA, 0, ShardSettled); err != nil {
+		t.Fatalf("unable to resolve shard: %v", err)
+	}
+	if err := db.ResolveShard(hashB, 0, ShardFailed); err != nil {
+		t.Fatalf("unable to resolve shard: %v", err)
+	}
+	shardsA[0].Status = ShardSettled
+
+	assertResumable([]MPPPaymentState{
+		{
+			PaymentHash: hashA,
+			Status:      StatusInFlight,
+			Shards:      shardsA,
+		},
+	})
+
+	err = db.ResolveShard(hashA, 0, ShardFailed)
+	if err != ErrShardAlreadyResolved {
+		t.Fatalf("expected ErrShardAlreadyResolved, got %v", err)
+	}
+	err = db.ResolveShard(hashA, 2, ShardFailed)
+	if err != ErrShardNotFound {
+		t.Fatalf("expected ErrShardNotFound, got %v", err)
+	}
+	err = db.ResolveShard([32]byte{3}, 0, ShardFailed)
+	if err != ErrShardNotFound {
+		t.Fatalf("expected ErrShardNotFound, got %v", err)
+	}
+	err = db.ResolveShard(hashA, 1, ShardInFlight)
+	if err != ErrInvalidShardResolution {
+		t.Fatalf("expected ErrInvalidShardResolution, got %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/coreos/bbolt"
@@ -98,6 +99,39 @@ type OutgoingPayment struct {
 	// PaymentPreimage is the preImage of a successful payment. This is used
 	// to calculate the PaymentHash as well as serve as a proof of payment.
 	PaymentPreimage [32]byte
+
+	// CustomRecords is the set of custom TLV records that were sent to the
+	// destination along with the payment. All record types must be greater
+	// than or equal to CustomTypeStart.
+	//
+	// NOTE: This shadows the custom records of the embedded invoice, which
+	// are kept separately.
+	CustomRecords map[uint64][]byte
+
+	// GroupID is the optional ID of the logical group the payment was sent
+	// as part of, such as a batch of payments fanned out across many
+	// invoices. Payments that weren't sent as part of a group belong to
+	// the zero group.
+	GroupID [16]byte
+
+	// IsRebalance is true if the payment was sent to ourselves to shift
+	// liquidity between our own channels, rather than to pay a remote
+	// node. Its fee is a cost of routing instead of a cost of spending.
+	IsRebalance bool
+
+	// RebalanceSource is the channel a rebalance was sent out through,
+	// if known. It's only set for rebalances.
+	RebalanceSource lnwire.ShortChannelID
+
+	// RebalanceDest is the channel a rebalance came back in through, if
+	// known. It's only set for rebalances.
+	RebalanceDest lnwire.ShortChannelID
+
+	// RouteChanIDs is the short channel ID of each channel the payment's
+	// route traversed, ordered the same as Path. It's empty if the
+	// channels aren't known, as for payments added before they were
+	// recorded.
+	RouteChanIDs []uint64
 }
 
 // AddPayment saves a successful payment to the database. It is assumed that
@@ -108,6 +142,15 @@ func (db *DB) AddPayment(payment *OutgoingPayment) error {
 	if err := validateInvoice(&payment.Invoice); err != nil {
 		return err
 	}
+	if err := validateCustomRecords(payment.CustomRecords); err != nil {
+		return err
+	}
+	if err := validateRebalance(payment); err != nil {
+		return err
+	}
+	if err := validateRouteChans(payment); err != nil {
+		return err
+	}
 
 	// We first serialize the payment before starting the database
 	// transaction so we can avoid creating a DB payment in the case of a
@@ -136,7 +179,24 @@ func (db *DB) AddPayment(payment *OutgoingPayment) error {
 		paymentIDBytes := make([]byte, 8)
 		binary.BigEndian.PutUint64(paymentIDBytes, paymentID)
 
-		return payments.Put(paymentIDBytes, paymentBytes)
+		err = checksumPut(
+			tx, paymentBucket, payments, paymentIDBytes,
+			paymentBytes,
+		)
+		if err != nil {
+			return err
+		}
+
+		err = putPaymentGroupIndex(
+			tx, payment.GroupID, paymentIDBytes,
+		)
+		if err != nil {
+			return err
+		}
+
+		return putPaymentChanIndex(
+			tx, payment.RouteChanIDs, paymentIDBytes,
+		)
 	})
 }
 
@@ -182,8 +242,22 @@ func (db *DB) DeleteAllPayments() error {
 			return err
 		}
 
+		err = tx.DeleteBucket(paymentGroupIndexBucket)
+		if err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+
+		err = tx.DeleteBucket(paymentChanIndexBucket)
+		if err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+
 		_, err = tx.CreateBucket(paymentBucket)
-		return err
+		if err != nil {
+			return err
+		}
+
+		return refreshBucketChecksums(tx)
 	})
 }
 
@@ -285,7 +359,34 @@ func serializeOutgoingPayment(w io.Writer, p *OutgoingPayment) error {
 		return err
 	}
 
-	return nil
+	// Finally, we'll write out the TLV stream which houses all the
+	// optional records of the payment.
+	return writeTLVStream(w, paymentRecords(p))
+}
+
+// paymentRecords returns the full set of TLV records that should be written
+// for the passed payment.
+func paymentRecords(p *OutgoingPayment) map[uint64][]byte {
+	records := make(map[uint64][]byte, len(p.CustomRecords)+4)
+	for typ, value := range p.CustomRecords {
+		records[typ] = value
+	}
+
+	if p.GroupID != ([16]byte{}) {
+		groupID := p.GroupID
+		records[paymentGroupIDType] = groupID[:]
+	}
+	if p.IsRebalance {
+		records[paymentRebalanceType] = []byte{1}
+	}
+	if chans := encodeRebalanceChans(p); chans != nil {
+		records[paymentRebalanceChansType] = chans
+	}
+	if chans := encodeRouteChans(p); chans != nil {
+		records[paymentRouteChansType] = chans
+	}
+
+	return records
 }
 
 func deserializeOutgoingPayment(r io.Reader) (*OutgoingPayment, error) {
@@ -326,5 +427,50 @@ func deserializeOutgoingPayment(r io.Reader) (*OutgoingPayment, error) {
 		return nil, err
 	}
 
+	records, err := readTLVStream(r)
+	if err != nil {
+		return nil, err
+	}
+	for typ, value := range records {
+		switch {
+		case typ == paymentGroupIDType:
+			p.GroupID, err = decodePaymentGroupID(value)
+			if err != nil {
+				return nil, err
+			}
+			continue
+
+		case typ == paymentRebalanceType:
+			p.IsRebalance, err = decodePaymentRebalance(value)
+			if err != nil {
+				return nil, err
+			}
+			continue
+
+		case typ == paymentRebalanceChansType:
+			err = decodeRebalanceChans(value, p)
+			if err != nil {
+				return nil, err
+			}
+			continue
+
+		case typ == paymentRouteChansType:
+			p.RouteChanIDs, err = decodeRouteChans(value)
+			if err != nil {
+				return nil, err
+			}
+			continue
+
+		case typ < CustomTypeStart:
+			return nil, fmt.Errorf("unknown payment record "+
+				"type %v", typ)
+		}
+
+		if p.CustomRecords == nil {
+			p.CustomRecords = make(map[uint64][]byte)
+		}
+		p.CustomRecords[typ] = value
+	}
+
 	return p, nil
 }
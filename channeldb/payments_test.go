@@ -251,3 +251,49 @@ func TestPaymentStatusWorkflow(t *testing.T) {
 		}
 	}
 }
+
+// TestOutgoingPaymentCustomRecords asserts that the custom records of a
+// payment are stored independently of the ones of its embedded invoice, and
+// that records within the reserved type range are rejected.
+func TestOutgoingPaymentCustomRecords(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	payment := makeFakePayment()
+	payment.CustomRecords = map[uint64][]byte{
+		CustomTypeStart + 5: []byte("order-1234"),
+	}
+	payment.Invoice.CustomRecords = map[uint64][]byte{
+		CustomTypeStart: []byte("invoice"),
+	}
+
+	if err := db.AddPayment(payment); err != nil {
+		t.Fatalf("unable to add payment: %v", err)
+	}
+
+	payments, err := db.FetchAllPayments()
+	if err != nil {
+		t.Fatalf("unable to fetch payments: %v", err)
+	}
+	if len(payments) != 1 {
+		t.Fatalf("expected 1 payment, got %v", len(payments))
+	}
+	if !reflect.DeepEqual(payment, payments[0]) {
+		t.Fatalf("payment mismatch: expected %v, got %v",
+			spew.Sdump(payment), spew.Sdump(payments[0]))
+	}
+
+	badPayment := makeFakePayment()
+	badPayment.CustomRecords = map[uint64][]byte{
+		1: []byte("reserved"),
+	}
+	if err := db.AddPayment(badPayment); err == nil {
+		t.Fatalf("expected payment with reserved record type to be " +
+			"rejected")
+	}
+}
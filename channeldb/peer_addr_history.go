@@ -0,0 +1,122 @@
+package channeldb
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// peerAddressHistory is the top-level bucket that stores every
+	// address each peer was known by, along with the last time the peer
+	// was seen while the address was known. Unlike the addresses of a
+	// link node, the history is retained once the link node is pruned,
+	// so that it can be used to reconnect to peers when recovering their
+	// channels.
+	//
+	// maps: nodePub => serializedAddr => lastSeen
+	peerAddressHistory = []byte("peer-address-history")
+)
+
+// putPeerAddrHistory adds the addresses to the address history of the peer,
+// updating the time an address was last seen at if it's already known.
+func putPeerAddrHistory(tx *bbolt.Tx, nodePub *btcec.PublicKey,
+	addrs []net.Addr, lastSeen time.Time) error {
+
+	if len(addrs) == 0 {
+		return nil
+	}
+
+	history, err := tx.CreateBucketIfNotExists(peerAddressHistory)
+	if err != nil {
+		return err
+	}
+	peerAddrs, err := history.CreateBucketIfNotExists(
+		nodePub.SerializeCompressed(),
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range addrs {
+		var b bytes.Buffer
+		if err := serializeAddr(&b, addr); err != nil {
+			return err
+		}
+
+		seen := lastSeen.Unix()
+		if v := peerAddrs.Get(b.Bytes()); len(v) == 8 &&
+			int64(byteOrder.Uint64(v)) > seen {
+
+			continue
+		}
+
+		var seenBytes [8]byte
+		byteOrder.PutUint64(seenBytes[:], uint64(seen))
+		if err := peerAddrs.Put(b.Bytes(), seenBytes[:]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PeerAddressHistory returns all addresses the peer with the given identity
+// was ever known by, including those it's no longer known by as a link node,
+// ordered from the most to the least recently seen.
+func (d *DB) PeerAddressHistory(nodePub *btcec.PublicKey) ([]net.Addr,
+	error) {
+
+	type seenAddr struct {
+		addr     net.Addr
+		lastSeen int64
+	}
+
+	var seenAddrs []seenAddr
+	err := d.View(func(tx *bbolt.Tx) error {
+		history := tx.Bucket(peerAddressHistory)
+		if history == nil {
+			return nil
+		}
+		peerAddrs := history.Bucket(nodePub.SerializeCompressed())
+		if peerAddrs == nil {
+			return nil
+		}
+
+		return peerAddrs.ForEach(func(k, v []byte) error {
+			addr, err := deserializeAddr(bytes.NewReader(k))
+			if err != nil {
+				return err
+			}
+
+			var lastSeen int64
+			if len(v) == 8 {
+				lastSeen = int64(byteOrder.Uint64(v))
+			}
+			seenAddrs = append(seenAddrs, seenAddr{
+				addr:     addr,
+				lastSeen: lastSeen,
+			})
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(seenAddrs, func(i, j int) bool {
+		return seenAddrs[i].lastSeen > seenAddrs[j].lastSeen
+	})
+
+	addrs := make([]net.Addr, 0, len(seenAddrs))
+	for _, seen := range seenAddrs {
+		addrs = append(addrs, seen.addr)
+	}
+
+	return addrs, nil
+}
@@ -0,0 +1,74 @@
+package channeldb
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestPeerAddressHistory asserts that the addresses of a link node are
+// retained within the peer's address history once the link node is deleted,
+// ordered from the most to the least recently seen.
+func TestPeerAddressHistory(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	_, pub := btcec.PrivKeyFromBytes(btcec.S256(), key[:])
+	addr1, err := net.ResolveTCPAddr("tcp", "10.0.0.1:9000")
+	if err != nil {
+		t.Fatalf("unable to create test addr: %v", err)
+	}
+	addr2, err := net.ResolveTCPAddr("tcp", "10.0.0.2:9000")
+	if err != nil {
+		t.Fatalf("unable to create test addr: %v", err)
+	}
+
+	assertHistory := func(expected ...net.Addr) {
+		t.Helper()
+
+		history, err := cdb.PeerAddressHistory(pub)
+		if err != nil {
+			t.Fatalf("unable to fetch address history: %v", err)
+		}
+		if len(history) != len(expected) {
+			t.Fatalf("expected %v addresses, got %v",
+				len(expected), len(history))
+		}
+		for i, addr := range expected {
+			if history[i].String() != addr.String() {
+				t.Fatalf("expected address %v at %v, got %v",
+					addr, i, history[i])
+			}
+		}
+	}
+
+	assertHistory()
+
+	// We'll first know the peer by one address, and then by another once
+	// its link node was pruned.
+	now := time.Now()
+	node := cdb.NewLinkNode(wire.MainNet, pub, addr1)
+	if err := node.UpdateLastSeen(now.Add(-time.Hour)); err != nil {
+		t.Fatalf("unable to sync node: %v", err)
+	}
+	assertHistory(addr1)
+
+	if err := cdb.DeleteLinkNode(pub); err != nil {
+		t.Fatalf("unable to delete node: %v", err)
+	}
+	assertHistory(addr1)
+
+	node = cdb.NewLinkNode(wire.MainNet, pub, addr2)
+	if err := node.UpdateLastSeen(now); err != nil {
+		t.Fatalf("unable to sync node: %v", err)
+	}
+	assertHistory(addr2, addr1)
+}
@@ -0,0 +1,161 @@
+package channeldb
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+)
+
+// PeerHistory summarizes all channels we've ever had with a single peer.
+//
+// Neither open nor closed channels record when they were opened in wall
+// clock time, so the age of a channel is expressed by the height of the block
+// its funding transaction was confirmed in. For channels that are still
+// pending, the height their funding transaction was broadcast at is used
+// instead, while closed channels that never confirmed aren't dated.
+type PeerHistory struct {
+	// PubKey is the public key of the peer.
+	PubKey [33]byte
+
+	// NumOpen is the number of channels with the peer that are still open,
+	// including pending ones.
+	NumOpen int
+
+	// NumClosed is the number of channels with the peer that have been
+	// closed.
+	NumClosed int
+
+	// FirstChannelHeight is the height at which the oldest channel with
+	// the peer was opened. It's zero if the height of none is known.
+	FirstChannelHeight uint32
+
+	// LastChannelHeight is the height at which the newest channel with the
+	// peer was opened.
+	LastChannelHeight uint32
+}
+
+// AllHistoricalPeers returns the public key of every peer we've ever had a
+// channel with, whether the channel is still open or has since been closed,
+// sorted in ascending order.
+func (d *DB) AllHistoricalPeers() ([][33]byte, error) {
+	histories, err := d.PeerHistories()
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make([][33]byte, 0, len(histories))
+	for _, history := range histories {
+		peers = append(peers, history.PubKey)
+	}
+
+	return peers, nil
+}
+
+// PeerHistories returns a summary of the channels we've ever had with each
+// peer, across both open and closed channels, sorted by the public key of the
+// peer in ascending order.
+func (d *DB) PeerHistories() ([]PeerHistory, error) {
+	var histories []PeerHistory
+	err := d.View(func(tx *bbolt.Tx) error {
+		histories = nil
+		peers := make(map[[33]byte]*PeerHistory)
+		addChannel := func(pubKey []byte, height uint32, open bool) {
+			var peer [33]byte
+			copy(peer[:], pubKey)
+
+			history, ok := peers[peer]
+			if !ok {
+				history = &PeerHistory{PubKey: peer}
+				peers[peer] = history
+			}
+
+			if open {
+				history.NumOpen++
+			} else {
+				history.NumClosed++
+			}
+
+			if height == 0 {
+				return
+			}
+			if history.FirstChannelHeight == 0 ||
+				height < history.FirstChannelHeight {
+
+				history.FirstChannelHeight = height
+			}
+			if height > history.LastChannelHeight {
+				history.LastChannelHeight = height
+			}
+		}
+
+		addOpenChannel := func(op wire.OutPoint,
+			chanBucket *bbolt.Bucket) error {
+
+			channel := &OpenChannel{
+				FundingOutpoint: op,
+			}
+			err := fetchChanInfo(chanBucket, channel)
+			if err != nil {
+				return err
+			}
+
+			height := channel.ShortChannelID.BlockHeight
+			if channel.IsPending {
+				height = channel.FundingBroadcastHeight
+			}
+			addChannel(
+				channel.IdentityPub.SerializeCompressed(),
+				height, true,
+			)
+
+			return nil
+		}
+		openChanBucket := tx.Bucket(openChannelBucket)
+		if openChanBucket != nil {
+			err := forEachChanBucket(openChanBucket, addOpenChannel)
+			if err != nil {
+				return err
+			}
+		}
+
+		closeBucket := tx.Bucket(closedChannelBucket)
+		if closeBucket != nil {
+			err := closeBucket.ForEach(func(_, v []byte) error {
+				summary, err := deserializeCloseChannelSummary(
+					bytes.NewReader(v),
+				)
+				if err != nil {
+					return err
+				}
+
+				addChannel(
+					summary.RemotePub.SerializeCompressed(),
+					summary.ShortChanID.BlockHeight, false,
+				)
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, history := range peers {
+			histories = append(histories, *history)
+		}
+		sort.Slice(histories, func(i, j int) bool {
+			return bytes.Compare(
+				histories[i].PubKey[:], histories[j].PubKey[:],
+			) < 0
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return histories, nil
+}
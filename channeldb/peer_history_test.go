@@ -0,0 +1,122 @@
+package channeldb
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestPeerHistories asserts that the peers of open, pending and closed
+// channels are merged into a single summary per peer.
+func TestPeerHistories(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	priv, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+
+	newChannel := func(height uint32, otherPeer bool) *OpenChannel {
+		t.Helper()
+
+		channel, err := createTestChannelState(cdb)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		channel.IsPending = false
+		channel.ShortChannelID = lnwire.ShortChannelID{
+			BlockHeight: height,
+		}
+		if otherPeer {
+			channel.IdentityPub = priv.PubKey()
+		}
+		if err := channel.FullSync(); err != nil {
+			t.Fatalf("unable to save channel state: %v", err)
+		}
+
+		return channel
+	}
+
+	// The first peer had a channel opened at height 100 that has since
+	// been closed, and has a channel pending since height 150.
+	closedChan := newChannel(100, false)
+	summary := &ChannelCloseSummary{
+		ChanPoint:       closedChan.FundingOutpoint,
+		ShortChanID:     closedChan.ShortChannelID,
+		ChainHash:       closedChan.ChainHash,
+		RemotePub:       closedChan.IdentityPub,
+		Capacity:        closedChan.Capacity,
+		CloseType:       CooperativeClose,
+		LocalChanConfig: closedChan.LocalChanCfg,
+	}
+	if err := closedChan.CloseChannel(summary); err != nil {
+		t.Fatalf("unable to close channel: %v", err)
+	}
+
+	pendingChan, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	addr := &net.TCPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 18555,
+	}
+	if err := pendingChan.SyncPending(addr, 150); err != nil {
+		t.Fatalf("unable to sync channel: %v", err)
+	}
+
+	// The second peer has two open channels.
+	newChannel(300, true)
+	newChannel(200, true)
+
+	var peerA, peerB [33]byte
+	copy(peerA[:], closedChan.IdentityPub.SerializeCompressed())
+	copy(peerB[:], priv.PubKey().SerializeCompressed())
+
+	expected := []PeerHistory{
+		{
+			PubKey:             peerA,
+			NumOpen:            1,
+			NumClosed:          1,
+			FirstChannelHeight: 100,
+			LastChannelHeight:  150,
+		},
+		{
+			PubKey:             peerB,
+			NumOpen:            2,
+			FirstChannelHeight: 200,
+			LastChannelHeight:  300,
+		},
+	}
+	if string(peerB[:]) < string(peerA[:]) {
+		expected[0], expected[1] = expected[1], expected[0]
+	}
+
+	histories, err := cdb.PeerHistories()
+	if err != nil {
+		t.Fatalf("unable to fetch peer histories: %v", err)
+	}
+	if !reflect.DeepEqual(histories, expected) {
+		t.Fatalf("expected histories %v, got %v", spew.Sdump(expected),
+			spew.Sdump(histories))
+	}
+
+	peers, err := cdb.AllHistoricalPeers()
+	if err != nil {
+		t.Fatalf("unable to fetch peers: %v", err)
+	}
+	expectedPeers := [][33]byte{expected[0].PubKey, expected[1].PubKey}
+	if !reflect.DeepEqual(peers, expectedPeers) {
+		t.Fatalf("expected peers %x, got %x", expectedPeers, peers)
+	}
+}
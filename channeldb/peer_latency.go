@@ -0,0 +1,149 @@
+package channeldb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// peerLatencyBucket is the top-level bucket that stores the round trip
+	// latency samples of each peer. Each peer has its own sub-bucket, which
+	// holds an entry per sample keyed by the time it was taken, followed by
+	// a sequence number to keep samples taken at the same time apart. The
+	// value is the round trip time in nanoseconds, encoded as a varint.
+	//
+	// maps: peerPub => sampleTime || seqNo => rtt
+	peerLatencyBucket = []byte("peer-latency")
+
+	// ErrNegativeLatency is returned when recording a latency sample with
+	// a negative round trip time.
+	ErrNegativeLatency = fmt.Errorf("latency sample is negative")
+
+	// ErrNoLatencySamples is returned when querying the latency of a peer
+	// for which no samples were taken within the window.
+	ErrNoLatencySamples = fmt.Errorf("no latency samples within window")
+
+	// ErrPeerLatencyWindowTooLarge is returned when the latency of a peer
+	// is queried over a window exceeding MaxPeerLatencyWindow.
+	ErrPeerLatencyWindowTooLarge = fmt.Errorf("peer latency window "+
+		"exceeds max of %v", MaxPeerLatencyWindow)
+)
+
+const (
+	// MaxPeerLatencyWindow is the largest window over which the latency of
+	// a peer can be queried. Samples taken before this are trimmed as new
+	// ones are recorded.
+	MaxPeerLatencyWindow = 7 * 24 * time.Hour
+)
+
+// RecordPeerLatency records a sample of the round trip time to the peer,
+// taken at the passed time. Any samples of the peer that have fallen out of
+// MaxPeerLatencyWindow are trimmed along the way.
+func (d *DB) RecordPeerLatency(pub [33]byte, rtt time.Duration,
+	t time.Time) error {
+
+	if rtt < 0 {
+		return ErrNegativeLatency
+	}
+
+	return d.Batch(func(tx *bbolt.Tx) error {
+		latencies, err := tx.CreateBucketIfNotExists(peerLatencyBucket)
+		if err != nil {
+			return err
+		}
+		samples, err := latencies.CreateBucketIfNotExists(pub[:])
+		if err != nil {
+			return err
+		}
+
+		seqNo, err := samples.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		var (
+			sampleKey [16]byte
+			rttBytes  [binary.MaxVarintLen64]byte
+		)
+		byteOrder.PutUint64(sampleKey[:8], uint64(t.UnixNano()))
+		byteOrder.PutUint64(sampleKey[8:], seqNo)
+		n := binary.PutUvarint(rttBytes[:], uint64(rtt))
+		if err := samples.Put(sampleKey[:], rttBytes[:n]); err != nil {
+			return err
+		}
+
+		return trimTimeSeries(samples, t.Add(-MaxPeerLatencyWindow))
+	})
+}
+
+// PeerLatencyStats returns the average and the 95th percentile of the round
+// trip times sampled for the peer within the window preceding now, including
+// those sampled at now. The percentile is computed with the nearest-rank
+// method, so it's always one of the samples. ErrNoLatencySamples is returned
+// if there are none within the window, which may not exceed
+// MaxPeerLatencyWindow.
+func (d *DB) PeerLatencyStats(pub [33]byte, window time.Duration,
+	now time.Time) (time.Duration, time.Duration, error) {
+
+	if window > MaxPeerLatencyWindow {
+		return 0, 0, ErrPeerLatencyWindowTooLarge
+	}
+
+	var rtts []time.Duration
+	err := d.View(func(tx *bbolt.Tx) error {
+		rtts = nil
+
+		latencies := tx.Bucket(peerLatencyBucket)
+		if latencies == nil {
+			return nil
+		}
+		samples := latencies.Bucket(pub[:])
+		if samples == nil {
+			return nil
+		}
+
+		var start, end [8]byte
+		startTime := now.Add(-window)
+		byteOrder.PutUint64(start[:], uint64(startTime.UnixNano()))
+		byteOrder.PutUint64(end[:], uint64(now.UnixNano()))
+
+		c := samples.Cursor()
+		for k, v := c.Seek(start[:]); k != nil &&
+			bytes.Compare(k[:8], end[:]) <= 0; k, v = c.Next() {
+
+			rtt, n := binary.Uvarint(v)
+			if n <= 0 {
+				return fmt.Errorf("invalid latency sample "+
+					"%x", k)
+			}
+			rtts = append(rtts, time.Duration(rtt))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(rtts) == 0 {
+		return 0, 0, ErrNoLatencySamples
+	}
+
+	var sum time.Duration
+	for _, rtt := range rtts {
+		sum += rtt
+	}
+	avg := sum / time.Duration(len(rtts))
+
+	sort.Slice(rtts, func(i, j int) bool {
+		return rtts[i] < rtts[j]
+	})
+	rank := (len(rtts)*95 + 99) / 100
+	p95 := rtts[rank-1]
+
+	return avg, p95, nil
+}
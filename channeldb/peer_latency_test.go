@@ -0,0 +1,91 @@
+package channeldb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+// TestPeerLatencyStats asserts that the average and 95th percentile latency of
+// a peer are computed over the samples within the queried window, and that
+// samples falling out of the max window are trimmed.
+func TestPeerLatencyStats(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+
+	var pub, otherPub [33]byte
+	pub[0], otherPub[0] = 2, 3
+	now := time.Unix(1500000000, 0)
+
+	_, _, err = db.PeerLatencyStats(pub, time.Hour, now)
+	if err != ErrNoLatencySamples {
+		t.Fatalf("expected ErrNoLatencySamples, got %v", err)
+	}
+	err = db.RecordPeerLatency(pub, -time.Millisecond, now)
+	if err != ErrNegativeLatency {
+		t.Fatalf("expected ErrNegativeLatency, got %v", err)
+	}
+	_, _, err = db.PeerLatencyStats(pub, MaxPeerLatencyWindow+1, now)
+	if err != ErrPeerLatencyWindowTooLarge {
+		t.Fatalf("expected ErrPeerLatencyWindowTooLarge, got %v", err)
+	}
+
+	// We'll record an old sample, followed by twenty samples of 1ms to
+	// 20ms taken a second apart, the last of which at now.
+	record := func(pub [33]byte, rtt time.Duration, at time.Time) {
+		t.Helper()
+
+		if err := db.RecordPeerLatency(pub, rtt, at); err != nil {
+			t.Fatalf("unable to record latency: %v", err)
+		}
+	}
+	record(pub, time.Second, now.Add(-2*time.Hour))
+	for i := 1; i <= 20; i++ {
+		at := now.Add(time.Duration(i-20) * time.Second)
+		record(pub, time.Duration(i)*time.Millisecond, at)
+	}
+	record(otherPub, time.Minute, now)
+
+	assertStats := func(window time.Duration, expectedAvg,
+		expectedP95 time.Duration) {
+
+		t.Helper()
+
+		avg, p95, err := db.PeerLatencyStats(pub, window, now)
+		if err != nil {
+			t.Fatalf("unable to fetch latency stats: %v", err)
+		}
+		if avg != expectedAvg {
+			t.Fatalf("expected avg %v, got %v", expectedAvg, avg)
+		}
+		if p95 != expectedP95 {
+			t.Fatalf("expected p95 %v, got %v", expectedP95, p95)
+		}
+	}
+	assertStats(time.Hour, 10500*time.Microsecond, 19*time.Millisecond)
+	assertStats(time.Second, 19500*time.Microsecond, 20*time.Millisecond)
+	assertStats(
+		3*time.Hour, 1210*time.Millisecond/21, 20*time.Millisecond,
+	)
+
+	// Once a sample is recorded past the max window of the old sample, it
+	// should be trimmed.
+	later := now.Add(MaxPeerLatencyWindow - time.Hour)
+	record(pub, time.Millisecond, later)
+	err = db.View(func(tx *bbolt.Tx) error {
+		samples := tx.Bucket(peerLatencyBucket).Bucket(pub[:])
+		if numSamples := samples.Stats().KeyN; numSamples != 21 {
+			t.Fatalf("expected 21 samples, got %v", numSamples)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to count samples: %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+package channeldb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// RecordType identifies a kind of record whose serialization can be swapped
+// out through RegisterCodec.
+type RecordType uint8
+
+const (
+	// ForwardingEventRecord is a ForwardingEvent of the forwarding log.
+	ForwardingEventRecord RecordType = iota
+
+	// CloseSummaryRecord is the ChannelCloseSummary of a closed channel.
+	CloseSummaryRecord
+)
+
+// String returns a human readable identifier for the RecordType type.
+func (t RecordType) String() string {
+	switch t {
+	case ForwardingEventRecord:
+		return "ForwardingEvent"
+	case CloseSummaryRecord:
+		return "CloseSummary"
+	default:
+		return "Unknown"
+	}
+}
+
+// ErrUnknownRecordType is returned when registering a codec for an unknown
+// record type.
+var ErrUnknownRecordType = fmt.Errorf("unknown record type")
+
+// ErrJSONRecordTooLarge is returned when a JSON record exceeds
+// maxJSONRecordSize.
+var ErrJSONRecordTooLarge = fmt.Errorf("json record too large")
+
+// maxJSONRecordSize is the largest JSON record that JSONCodec encodes or
+// decodes, such that a corrupt length prefix can't make it allocate an
+// arbitrary amount of memory.
+const maxJSONRecordSize = 1 << 16
+
+// Codec serializes records of a single type. Encode is passed a pointer to
+// the record to write, and Decode a pointer to the record to read into.
+// Records of some types are stored back to back within a single value, so an
+// encoding must allow its reader to tell where a record ends.
+type Codec interface {
+	// Encode writes the record to w.
+	Encode(w io.Writer, record interface{}) error
+
+	// Decode reads a record from r into the passed record.
+	Decode(r io.Reader, record interface{}) error
+}
+
+// codecs holds the codec registered for each record type. It's initialized
+// with the binary codecs of the on-disk format.
+var codecs = struct {
+	byType map[RecordType]Codec
+	sync.RWMutex
+}{
+	byType: map[RecordType]Codec{
+		ForwardingEventRecord: BinaryCodec(ForwardingEventRecord),
+		CloseSummaryRecord:    BinaryCodec(CloseSummaryRecord),
+	},
+}
+
+// RegisterCodec replaces the codec of the given record type, and returns the
+// one it replaces, such that it can be restored. Records written with one
+// codec can't be read with another, so this is meant for tests and tools that
+// operate on a database of their own. A codec must be registered before any
+// database holding records of its type is opened. All reads and writes of the
+// buckets holding records of the type go through the registered codec, while
+// closed channel archives and dead letters, which embed records within
+// versioned binary formats of their own, always use the binary format.
+func RegisterCodec(t RecordType, codec Codec) (Codec, error) {
+	codecs.Lock()
+	defer codecs.Unlock()
+
+	prev, ok := codecs.byType[t]
+	if !ok {
+		return nil, ErrUnknownRecordType
+	}
+	codecs.byType[t] = codec
+
+	return prev, nil
+}
+
+// codecFor returns the codec registered for the record type.
+func codecFor(t RecordType) Codec {
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	return codecs.byType[t]
+}
+
+// BinaryCodec returns the codec of the binary on-disk format for the given
+// record type, or nil if the type is unknown.
+func BinaryCodec(t RecordType) Codec {
+	switch t {
+	case ForwardingEventRecord:
+		return binaryForwardingEventCodec{}
+	case CloseSummaryRecord:
+		return binaryCloseSummaryCodec{}
+	default:
+		return nil
+	}
+}
+
+// binaryForwardingEventCodec is the binary codec of forwarding events. Their
+// timestamp isn't serialized, as it's the key of the event within the
+// forwarding log.
+type binaryForwardingEventCodec struct{}
+
+// Encode writes the *ForwardingEvent to w.
+//
+// NOTE: This is part of the Codec interface.
+func (binaryForwardingEventCodec) Encode(w io.Writer,
+	record interface{}) error {
+
+	event, ok := record.(*ForwardingEvent)
+	if !ok {
+		return UnknownElementType{"Encode", record}
+	}
+
+	return encodeForwardingEventBinary(w, event)
+}
+
+// Decode reads a forwarding event from r into the *ForwardingEvent.
+//
+// NOTE: This is part of the Codec interface.
+func (binaryForwardingEventCodec) Decode(r io.Reader,
+	record interface{}) error {
+
+	event, ok := record.(*ForwardingEvent)
+	if !ok {
+		return UnknownElementType{"Decode", record}
+	}
+
+	return decodeForwardingEventBinary(r, event)
+}
+
+// binaryCloseSummaryCodec is the binary codec of channel close summaries.
+type binaryCloseSummaryCodec struct{}
+
+// Encode writes the *ChannelCloseSummary to w.
+//
+// NOTE: This is part of the Codec interface.
+func (binaryCloseSummaryCodec) Encode(w io.Writer, record interface{}) error {
+	summary, ok := record.(*ChannelCloseSummary)
+	if !ok {
+		return UnknownElementType{"Encode", record}
+	}
+
+	return serializeChannelCloseSummaryBinary(w, summary)
+}
+
+// Decode reads a close summary from r into the *ChannelCloseSummary.
+//
+// NOTE: This is part of the Codec interface.
+func (binaryCloseSummaryCodec) Decode(r io.Reader, record interface{}) error {
+	summary, ok := record.(*ChannelCloseSummary)
+	if !ok {
+		return UnknownElementType{"Decode", record}
+	}
+
+	return deserializeCloseChannelSummaryBinary(r, summary)
+}
+
+// JSONCodec encodes records as JSON objects, each preceded by its length as a
+// big endian uint32 to tell back to back records apart. It's meant for
+// debugging, and can only be used for records whose fields all round trip
+// through encoding/json, which excludes those holding public keys such as
+// close summaries.
+type JSONCodec struct{}
+
+// Encode writes the record to w as a length prefixed JSON object.
+//
+// NOTE: This is part of the Codec interface.
+func (JSONCodec) Encode(w io.Writer, record interface{}) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if len(b) > maxJSONRecordSize {
+		return ErrJSONRecordTooLarge
+	}
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(b)))
+	if _, err := w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+
+	return err
+}
+
+// Decode reads a length prefixed JSON object from r into the record.
+//
+// NOTE: This is part of the Codec interface.
+func (JSONCodec) Decode(r io.Reader, record interface{}) error {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return err
+	}
+
+	size := binary.BigEndian.Uint32(length[:])
+	if size > maxJSONRecordSize {
+		return ErrJSONRecordTooLarge
+	}
+
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, record)
+}
@@ -0,0 +1,253 @@
+package channeldb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/bbolt"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestRecordCodecRegistry asserts that forwarding events are stored through
+// the codec registered for them, and that the previous codec is handed back
+// on registration.
+//
+// NOTE: The codec registry is global, so this test must not run in parallel.
+func TestRecordCodecRegistry(t *testing.T) {
+	prev, err := RegisterCodec(ForwardingEventRecord, JSONCodec{})
+	if err != nil {
+		t.Fatalf("unable to register codec: %v", err)
+	}
+	defer RegisterCodec(ForwardingEventRecord, prev)
+
+	if _, ok := prev.(binaryForwardingEventCodec); !ok {
+		t.Fatalf("expected binary codec by default, got %T", prev)
+	}
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+	log := ForwardingLog{
+		db: db,
+	}
+
+	timestamp := time.Unix(1234, 0)
+	events := []ForwardingEvent{
+		{
+			Timestamp:      timestamp,
+			IncomingChanID: lnwire.NewShortChanIDFromInt(1),
+			OutgoingChanID: lnwire.NewShortChanIDFromInt(2),
+			AmtIn:          2000,
+			AmtOut:         1000,
+		},
+		{
+			Timestamp:      timestamp.Add(time.Minute),
+			IncomingChanID: lnwire.NewShortChanIDFromInt(3),
+			OutgoingChanID: lnwire.NewShortChanIDFromInt(4),
+			AmtIn:          4000,
+			AmtOut:         3000,
+		},
+	}
+	if err := log.AddForwardingEvents(events); err != nil {
+		t.Fatalf("unable to add events: %v", err)
+	}
+
+	timeSlice, err := log.Query(ForwardingEventQuery{
+		StartTime:    timestamp,
+		EndTime:      timestamp.Add(time.Hour),
+		NumMaxEvents: 10,
+	})
+	if err != nil {
+		t.Fatalf("unable to query for events: %v", err)
+	}
+	if !reflect.DeepEqual(events, timeSlice.ForwardingEvents) {
+		t.Fatalf("event mismatch: expected %v vs %v",
+			spew.Sdump(events),
+			spew.Sdump(timeSlice.ForwardingEvents))
+	}
+
+	// The events must have been stored as JSON rather than in the binary
+	// format.
+	var b bytes.Buffer
+	if err := encodeForwardingEvent(&b, &events[0]); err != nil {
+		t.Fatalf("unable to encode event: %v", err)
+	}
+	var decoded ForwardingEvent
+	if err := json.Unmarshal(b.Bytes()[4:], &decoded); err != nil {
+		t.Fatalf("expected json encoding: %v", err)
+	}
+
+	restored, err := RegisterCodec(ForwardingEventRecord, prev)
+	if err != nil {
+		t.Fatalf("unable to register codec: %v", err)
+	}
+	if _, ok := restored.(JSONCodec); !ok {
+		t.Fatalf("expected json codec to be replaced, got %T", restored)
+	}
+
+	if _, err := RegisterCodec(RecordType(99), JSONCodec{}); err !=
+		ErrUnknownRecordType {
+
+		t.Fatalf("expected ErrUnknownRecordType, got %v", err)
+	}
+	if BinaryCodec(RecordType(99)) != nil {
+		t.Fatalf("expected no binary codec for unknown record type")
+	}
+}
+
+// TestBinaryCodecRecordMismatch asserts that the binary codecs reject records
+// of a type other than their own.
+func TestBinaryCodecRecordMismatch(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+	codec := BinaryCodec(CloseSummaryRecord)
+	if err := codec.Encode(&b, &ForwardingEvent{}); err == nil {
+		t.Fatalf("expected close summary codec to reject event")
+	}
+	if err := codec.Decode(&b, &ForwardingEvent{}); err == nil {
+		t.Fatalf("expected close summary codec to reject event")
+	}
+
+	codec = BinaryCodec(ForwardingEventRecord)
+	if err := codec.Encode(&b, &ChannelCloseSummary{}); err == nil {
+		t.Fatalf("expected event codec to reject close summary")
+	}
+}
+
+// TestJSONCodecRecordTooLarge asserts that the JSON codec refuses to read a
+// record whose length prefix exceeds maxJSONRecordSize.
+func TestJSONCodecRecordTooLarge(t *testing.T) {
+	t.Parallel()
+
+	r := bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff})
+	err := JSONCodec{}.Decode(r, &ForwardingEvent{})
+	if err != ErrJSONRecordTooLarge {
+		t.Fatalf("expected ErrJSONRecordTooLarge, got %v", err)
+	}
+}
+
+// prefixedCodec wraps a codec, prefixing each record with a marker byte such
+// that reading a record through any other codec fails.
+type prefixedCodec struct {
+	Codec
+}
+
+// Encode writes the marker byte and the record to w.
+func (c prefixedCodec) Encode(w io.Writer, record interface{}) error {
+	if _, err := w.Write([]byte{0xfe}); err != nil {
+		return err
+	}
+
+	return c.Codec.Encode(w, record)
+}
+
+// Decode reads the marker byte and the record from r.
+func (c prefixedCodec) Decode(r io.Reader, record interface{}) error {
+	var marker [1]byte
+	if _, err := io.ReadFull(r, marker[:]); err != nil {
+		return err
+	}
+	if marker[0] != 0xfe {
+		return fmt.Errorf("unknown marker %x", marker[0])
+	}
+
+	return c.Codec.Decode(r, record)
+}
+
+// TestRecordCodecCloseSummaries asserts that all reads and writes of the
+// closed channel bucket go through the codec registered for close summaries.
+//
+// NOTE: The codec registry is global, so this test must not run in parallel.
+func TestRecordCodecCloseSummaries(t *testing.T) {
+	prev, err := RegisterCodec(
+		CloseSummaryRecord,
+		prefixedCodec{BinaryCodec(CloseSummaryRecord)},
+	)
+	if err != nil {
+		t.Fatalf("unable to register codec: %v", err)
+	}
+	defer RegisterCodec(CloseSummaryRecord, prev)
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	state, err := createTestChannelState(db)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 18555}
+	if err := state.SyncPending(addr, 99); err != nil {
+		t.Fatalf("unable to sync channel: %v", err)
+	}
+
+	summary := &ChannelCloseSummary{
+		ChanPoint:       state.FundingOutpoint,
+		ClosingTXID:     rev,
+		RemotePub:       state.IdentityPub,
+		Capacity:        state.Capacity,
+		SettledBalance:  state.LocalCommitment.LocalBalance.ToSatoshis(),
+		CloseType:       CooperativeClose,
+		IsPending:       true,
+		LocalChanConfig: state.LocalChanCfg,
+	}
+	if err := state.CloseChannel(summary); err != nil {
+		t.Fatalf("unable to close channel: %v", err)
+	}
+
+	// The summary must have been stored through the registered codec.
+	err = db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(closedChannelBucket).Get(
+			canonicalChannelKey(summary.ChanPoint),
+		)
+		if len(v) == 0 || v[0] != 0xfe {
+			return fmt.Errorf("summary not stored through codec: %x",
+				v)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to read summary: %v", err)
+	}
+
+	// It must be read back and updated through the codec as well.
+	if err := db.MarkSwept(summary.ChanPoint); err != nil {
+		t.Fatalf("unable to mark channel swept: %v", err)
+	}
+	if err := db.MarkChanFullyClosed(&summary.ChanPoint); err != nil {
+		t.Fatalf("unable to mark channel fully closed: %v", err)
+	}
+	summary.Swept = true
+	summary.IsPending = false
+
+	closed, err := db.FetchClosedChannels(false)
+	if err != nil {
+		t.Fatalf("unable to fetch closed channels: %v", err)
+	}
+	if len(closed) != 1 || !reflect.DeepEqual(summary, closed[0]) {
+		t.Fatalf("expected summary %v, got %v", spew.Sdump(summary),
+			spew.Sdump(closed))
+	}
+
+	fetched, err := db.FetchClosedChannel(&summary.ChanPoint)
+	if err != nil {
+		t.Fatalf("unable to fetch closed channel: %v", err)
+	}
+	if !reflect.DeepEqual(summary, fetched) {
+		t.Fatalf("expected summary %v, got %v", spew.Sdump(summary),
+			spew.Sdump(fetched))
+	}
+}
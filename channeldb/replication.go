@@ -0,0 +1,757 @@
+package channeldb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// replicationBucket is the top-level bucket whose sequence tracks the
+	// DB sequence of the latest replicated transaction a standby applied.
+	replicationBucket = []byte("replication")
+
+	// ErrReplicationSeqMismatch is returned when a standby is handed the
+	// events of a transaction that don't all carry the same sequence
+	// number.
+	ErrReplicationSeqMismatch = fmt.Errorf("replication events belong " +
+		"to different transactions")
+)
+
+const (
+	// replicationPathSeparator separates the hex encoded bucket names of
+	// the bucket path of a replication event.
+	replicationPathSeparator = "/"
+)
+
+// ReplicationOp is the type of mutation carried by a replication event.
+type ReplicationOp uint8
+
+const (
+	// ReplicationWrite sets the value of a key.
+	ReplicationWrite ReplicationOp = iota
+
+	// ReplicationDelete deletes a key.
+	ReplicationDelete
+
+	// ReplicationCreateBucket creates an empty bucket.
+	ReplicationCreateBucket
+
+	// ReplicationDeleteBucket deletes a bucket along with its contents.
+	ReplicationDeleteBucket
+
+	// ReplicationSetSequence sets the sequence of a bucket.
+	ReplicationSetSequence
+)
+
+// String returns a human readable description of the replication op.
+func (o ReplicationOp) String() string {
+	switch o {
+	case ReplicationWrite:
+		return "Write"
+	case ReplicationDelete:
+		return "Delete"
+	case ReplicationCreateBucket:
+		return "CreateBucket"
+	case ReplicationDeleteBucket:
+		return "DeleteBucket"
+	case ReplicationSetSequence:
+		return "SetSequence"
+	default:
+		return fmt.Sprintf("ReplicationOp(%d)", uint8(o))
+	}
+}
+
+// ReplicationSink receives the mutations committed to a primary database, such
+// that they can be streamed to a standby. The mutations of a transaction are
+// delivered once it has been committed, all tagged with the DB sequence of the
+// transaction, see DBSequence. Transactions are delivered in the order they
+// were committed, so sequence numbers increase from one transaction to the
+// next, though transactions that didn't mutate any replicated data are
+// skipped. The mutations of a single transaction are delivered in order, and
+// must be applied to the standby as a whole by ApplyReplicationEvents.
+//
+// The bucket of an event is the path of nested buckets, starting at the root
+// of the database, with each bucket name hex encoded and separated by a slash.
+// For key events, it's the bucket housing the key, while for bucket events,
+// it's the bucket itself.
+//
+// NOTE: Every write committed through Update or Batch is delivered, including
+// those of migrations and journals. Writes made directly through the embedded
+// bolt database bypass the sink.
+type ReplicationSink interface {
+	// OnWrite is invoked after the value of key within bucket has been set
+	// to val.
+	OnWrite(seq uint64, bucket string, key, val []byte)
+
+	// OnDelete is invoked after key has been deleted from bucket.
+	OnDelete(seq uint64, bucket string, key []byte)
+
+	// OnCreateBucket is invoked after an empty bucket has been created.
+	OnCreateBucket(seq uint64, bucket string)
+
+	// OnDeleteBucket is invoked after a bucket has been deleted along with
+	// its contents.
+	OnDeleteBucket(seq uint64, bucket string)
+
+	// OnSetSequence is invoked after the sequence of bucket has been set
+	// to bucketSeq.
+	OnSetSequence(seq uint64, bucket string, bucketSeq uint64)
+}
+
+// ReplicationEvent is a single mutation streamed from a primary database, to
+// be replayed on a standby by ApplyReplicationEvents.
+type ReplicationEvent struct {
+	// Seq is the DB sequence of the transaction that committed the event.
+	Seq uint64
+
+	// Op is the type of mutation.
+	Op ReplicationOp
+
+	// Bucket is the encoded bucket path of the event, as handed to the
+	// ReplicationSink.
+	Bucket string
+
+	// Key is the key targeted by a write or delete.
+	Key []byte
+
+	// Value is the new value of Key for a write.
+	Value []byte
+
+	// BucketSeq is the new sequence of Bucket for a sequence update.
+	BucketSeq uint64
+}
+
+// notify hands the event to the sink.
+func (e *ReplicationEvent) notify(sink ReplicationSink) {
+	switch e.Op {
+	case ReplicationWrite:
+		sink.OnWrite(e.Seq, e.Bucket, e.Key, e.Value)
+	case ReplicationDelete:
+		sink.OnDelete(e.Seq, e.Bucket, e.Key)
+	case ReplicationCreateBucket:
+		sink.OnCreateBucket(e.Seq, e.Bucket)
+	case ReplicationDeleteBucket:
+		sink.OnDeleteBucket(e.Seq, e.Bucket)
+	case ReplicationSetSequence:
+		sink.OnSetSequence(e.Seq, e.Bucket, e.BucketSeq)
+	}
+}
+
+// ApplyReplicationEvents replays the mutations of a single transaction
+// streamed from a primary database. All events must carry the same sequence
+// number, and are applied within a single transaction, such that the standby
+// never reflects a partially applied transaction. Transactions must be applied
+// in the order of their sequence numbers. Transactions whose sequence number
+// isn't greater than that of the last one applied are ignored, such that the
+// stream may be redelivered after e.g. a reconnect.
+func (d *DB) ApplyReplicationEvents(events []ReplicationEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	seq := events[0].Seq
+	paths := make([][][]byte, len(events))
+	for i, event := range events {
+		if event.Seq != seq {
+			return ErrReplicationSeqMismatch
+		}
+
+		var err error
+		paths[i], err = parseReplicationBucketPath(event.Bucket)
+		if err != nil {
+			return err
+		}
+
+		switch event.Op {
+		case ReplicationWrite, ReplicationDelete:
+			if len(event.Key) == 0 {
+				return fmt.Errorf("replication event %v has "+
+					"no key", seq)
+			}
+		case ReplicationCreateBucket, ReplicationDeleteBucket,
+			ReplicationSetSequence:
+
+		default:
+			return fmt.Errorf("unknown replication op %v",
+				event.Op)
+		}
+	}
+
+	return d.Update(func(tx *bbolt.Tx) error {
+		replication, err := tx.CreateBucketIfNotExists(
+			replicationBucket,
+		)
+		if err != nil {
+			return err
+		}
+		if seq <= replication.Sequence() {
+			return nil
+		}
+
+		for i := range events {
+			err := applyReplicationEvent(tx, &events[i], paths[i])
+			if err != nil {
+				return err
+			}
+		}
+
+		return replication.SetSequence(seq)
+	})
+}
+
+// applyReplicationEvent applies a single event to the bucket at the passed
+// path, creating any buckets along the path that don't yet exist.
+func applyReplicationEvent(tx *bbolt.Tx, event *ReplicationEvent,
+	path [][]byte) error {
+
+	// A bucket that's deleted is looked up within its parent, which for a
+	// top-level bucket is the root of the database.
+	if event.Op == ReplicationDeleteBucket {
+		name := path[len(path)-1]
+		if len(path) == 1 {
+			err := tx.DeleteBucket(name)
+			if err == bbolt.ErrBucketNotFound {
+				return nil
+			}
+			return err
+		}
+
+		parent, err := createBucketPath(tx, path[:len(path)-1])
+		if err != nil {
+			return err
+		}
+		err = parent.DeleteBucket(name)
+		if err == bbolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	}
+
+	bucket, err := createBucketPath(tx, path)
+	if err != nil {
+		return err
+	}
+
+	switch event.Op {
+	case ReplicationWrite:
+		return bucket.Put(event.Key, event.Value)
+	case ReplicationDelete:
+		return bucket.Delete(event.Key)
+	case ReplicationSetSequence:
+		return bucket.SetSequence(event.BucketSeq)
+	}
+
+	return nil
+}
+
+// createBucketPath returns the bucket at the passed path, creating any buckets
+// along the path that don't yet exist.
+func createBucketPath(tx *bbolt.Tx, path [][]byte) (*bbolt.Bucket, error) {
+	bucket, err := tx.CreateBucketIfNotExists(path[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range path[1:] {
+		bucket, err = bucket.CreateBucketIfNotExists(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return bucket, nil
+}
+
+// updateReplicated executes fn within a read-write transaction like Update,
+// and hands the mutations it committed to the replication sink. Concurrent
+// callers are serialized, such that transactions are delivered in the order
+// they were committed.
+func (d *DB) updateReplicated(fn func(tx *bbolt.Tx) error) error {
+	d.replicationMtx.Lock()
+	defer d.replicationMtx.Unlock()
+
+	d.compactMtx.RLock()
+	defer d.compactMtx.RUnlock()
+
+	if d.reopenErr != nil {
+		return d.reopenErr
+	}
+
+	var txID uint64
+	err := d.bdb.Update(func(tx *bbolt.Tx) error {
+		if err := bumpDBSequence(tx); err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		txID = uint64(tx.ID())
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := d.replicateTx(txID); err != nil {
+		return fmt.Errorf("unable to replicate committed "+
+			"transaction %v: %v", txID, err)
+	}
+
+	return nil
+}
+
+// replicateTx hands the mutations of the bolt transaction with the passed ID,
+// which must be the latest one committed, to the replication sink. They're
+// found by comparing the trees of the database as of the transaction and the
+// one preceding it, both of which are still recorded by bolt's meta pages.
+// Subtrees shared by both trees are skipped, so only the pages the
+// transaction rewrote are compared. The caller must hold the replicationMtx,
+// such that no write transaction frees the pages of the preceding tree while
+// they're compared.
+func (d *DB) replicateTx(txID uint64) error {
+	after, err := d.bdb.Begin(false)
+	if err != nil {
+		return err
+	}
+	defer after.Rollback()
+
+	if uint64(after.ID()) != txID {
+		return fmt.Errorf("transaction %v was followed by "+
+			"transaction %v", txID, after.ID())
+	}
+
+	r, err := newBoltPageReader(d.bdb.Path(), d.bdb.Info().PageSize)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	beforeRoot, err := r.metaRoot(txID - 1)
+	if err != nil {
+		return err
+	}
+	afterRoot, err := r.metaRoot(txID)
+	if err != nil {
+		return err
+	}
+
+	diff := &replicationDiff{
+		r:   r,
+		seq: dbSequenceTx(after),
+	}
+	err = diff.diffKeys(
+		nil, &boltBucket{root: beforeRoot},
+		&boltBucket{root: afterRoot},
+	)
+	if err != nil {
+		return err
+	}
+
+	for i := range diff.events {
+		diff.events[i].notify(d.replicationSink)
+	}
+
+	return nil
+}
+
+// batchReplicated executes fn as part of a batched read-write transaction like
+// Batch, and hands the mutations of the transaction to the replication sink.
+// Like bolt's batches, calls are collected for up to bbolt.DefaultMaxBatchDelay
+// before they're executed within a single transaction, and a call that fails
+// is retried within a transaction of its own.
+func (d *DB) batchReplicated(fn func(tx *bbolt.Tx) error) error {
+	errChan := make(chan error, 1)
+
+	d.replicationBatchMtx.Lock()
+	batch := d.replicationBatch
+	if batch == nil || len(batch.calls) >= bbolt.DefaultMaxBatchSize {
+		batch = &replicationBatch{db: d}
+		batch.timer = time.AfterFunc(
+			bbolt.DefaultMaxBatchDelay, batch.trigger,
+		)
+		d.replicationBatch = batch
+	}
+	batch.calls = append(batch.calls, replicationBatchCall{
+		fn:  fn,
+		err: errChan,
+	})
+	if len(batch.calls) >= bbolt.DefaultMaxBatchSize {
+		go batch.trigger()
+	}
+	d.replicationBatchMtx.Unlock()
+
+	err := <-errChan
+	if err == errReplicationBatchSolo {
+		err = d.updateReplicated(fn)
+	}
+
+	return err
+}
+
+// errReplicationBatchSolo is handed to a call of a replicated batch that
+// failed, such that it's retried within a transaction of its own.
+var errReplicationBatchSolo = fmt.Errorf("batched call failed and must be " +
+	"retried on its own")
+
+// replicationBatchCall is a single call to Batch that's part of a replicated
+// batch.
+type replicationBatchCall struct {
+	fn  func(tx *bbolt.Tx) error
+	err chan<- error
+}
+
+// replicationBatch is a set of calls to Batch that are executed within a
+// single replicated transaction.
+type replicationBatch struct {
+	db    *DB
+	calls []replicationBatchCall
+	timer *time.Timer
+	start sync.Once
+}
+
+// trigger executes the batch, unless it's already been executed.
+func (b *replicationBatch) trigger() {
+	b.start.Do(b.run)
+}
+
+// run executes the calls of the batch within a single transaction. Should a
+// call fail, it's removed from the batch and told to retry on its own, while
+// the remaining calls are executed again.
+func (b *replicationBatch) run() {
+	b.db.replicationBatchMtx.Lock()
+	b.timer.Stop()
+	if b.db.replicationBatch == b {
+		b.db.replicationBatch = nil
+	}
+	b.db.replicationBatchMtx.Unlock()
+
+	for len(b.calls) > 0 {
+		failed := -1
+		err := b.db.updateReplicated(func(tx *bbolt.Tx) error {
+			for i, call := range b.calls {
+				if err := call.fn(tx); err != nil {
+					failed = i
+					return err
+				}
+			}
+
+			return nil
+		})
+		if failed < 0 {
+			for _, call := range b.calls {
+				call.err <- err
+			}
+			return
+		}
+
+		call := b.calls[failed]
+		last := len(b.calls) - 1
+		b.calls[failed], b.calls = b.calls[last], b.calls[:last]
+		call.err <- errReplicationBatchSolo
+	}
+}
+
+// isReplicatedBucket returns whether the top-level bucket with the passed name
+// is replicated. The DB sequence, the replication state and the compaction
+// schedule are specific to each database, and are maintained by the standby
+// itself.
+func isReplicatedBucket(name []byte) bool {
+	return !bytes.Equal(name, dbSequenceBucket) &&
+		!bytes.Equal(name, replicationBucket) &&
+		!bytes.Equal(name, compactionBucket)
+}
+
+// replicationDiff collects the events that turn one tree of the database into
+// another.
+type replicationDiff struct {
+	r      *boltPageReader
+	seq    uint64
+	events []ReplicationEvent
+}
+
+// emit tags the event with the sequence number of the diff and collects it.
+func (d *replicationDiff) emit(event ReplicationEvent) {
+	event.Seq = d.seq
+	d.events = append(d.events, event)
+}
+
+// diffBuckets emits the events that turn the before bucket into the after
+// bucket, both found at the passed path. A nil bucket doesn't exist within its
+// tree.
+func (d *replicationDiff) diffBuckets(path [][]byte, before,
+	after *boltBucket) error {
+
+	bucketPath := replicationBucketPath(path)
+	switch {
+	case after == nil:
+		d.emit(ReplicationEvent{
+			Op:     ReplicationDeleteBucket,
+			Bucket: bucketPath,
+		})
+		return nil
+
+	case before == nil:
+		d.emit(ReplicationEvent{
+			Op:     ReplicationCreateBucket,
+			Bucket: bucketPath,
+		})
+	}
+
+	var beforeSeq uint64
+	if before != nil {
+		beforeSeq = before.sequence
+	}
+	if after.sequence != beforeSeq {
+		d.emit(ReplicationEvent{
+			Op:        ReplicationSetSequence,
+			Bucket:    bucketPath,
+			BucketSeq: after.sequence,
+		})
+	}
+
+	// As bolt never modifies pages in place, a bucket that's still rooted
+	// at the same page is unchanged. Inline buckets have no root page and
+	// are compared key by key.
+	if before != nil && before.root != 0 && before.root == after.root {
+		return nil
+	}
+
+	return d.diffKeys(path, before, after)
+}
+
+// diffKeys emits the events that turn the keys of the before bucket into those
+// of the after bucket, both found at the passed path. The empty path is the
+// root bucket, whose keys are the top-level buckets.
+func (d *replicationDiff) diffKeys(path [][]byte, before,
+	after *boltBucket) error {
+
+	beforeWalk, err := newBoltTreeWalker(d.r, before)
+	if err != nil {
+		return err
+	}
+	afterWalk, err := newBoltTreeWalker(d.r, after)
+	if err != nil {
+		return err
+	}
+
+	for {
+		b, a := beforeWalk.next(), afterWalk.next()
+		if b == nil && a == nil {
+			return nil
+		}
+
+		// Subtrees shared by both trees are unchanged.
+		if b != nil && a != nil && b.subtree != 0 &&
+			b.subtree == a.subtree {
+
+			beforeWalk.skip()
+			afterWalk.skip()
+			continue
+		}
+
+		// A subtree is only descended into once it's known to hold
+		// the next key of the walk. Of two subtrees, the taller one is
+		// descended into first, such that subtrees of the same height
+		// are compared against each other.
+		switch {
+		case b != nil && b.subtree != 0 && a != nil && a.subtree != 0:
+			if b.height >= a.height {
+				err = beforeWalk.descend()
+			} else {
+				err = afterWalk.descend()
+			}
+			if err != nil {
+				return err
+			}
+			continue
+
+		case b != nil && b.subtree != 0 && (a == nil ||
+			bytes.Compare(b.element.key, a.element.key) <= 0):
+
+			if err := beforeWalk.descend(); err != nil {
+				return err
+			}
+			continue
+
+		case a != nil && a.subtree != 0 && (b == nil ||
+			bytes.Compare(a.element.key, b.element.key) <= 0):
+
+			if err := afterWalk.descend(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// The next item of at least one of the walks is now a leaf
+		// element, and any subtree of the other one is known to only
+		// hold keys following it.
+		var beforeElement, afterElement *boltTreeElement
+		if b != nil && b.subtree == 0 {
+			beforeElement = &b.element
+		}
+		if a != nil && a.subtree == 0 {
+			afterElement = &a.element
+		}
+		var beforeKey, afterKey []byte
+		if beforeElement != nil {
+			beforeKey = beforeElement.key
+		}
+		if afterElement != nil {
+			afterKey = afterElement.key
+		}
+
+		cmp := compareCursorKeys(beforeKey, afterKey)
+		if cmp > 0 || beforeElement == nil {
+			beforeElement = nil
+		} else {
+			beforeWalk.skip()
+		}
+		if cmp < 0 || afterElement == nil {
+			afterElement = nil
+		} else {
+			afterWalk.skip()
+		}
+
+		err := d.diffElements(path, beforeElement, afterElement)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// diffElements emits the events that turn the before element of the bucket at
+// the passed path into the after element, both of which carry the same key. A
+// nil element doesn't exist within its tree.
+func (d *replicationDiff) diffElements(path [][]byte, before,
+	after *boltTreeElement) error {
+
+	var key []byte
+	if before != nil {
+		key = before.key
+	} else {
+		key = after.key
+	}
+
+	// Only replicated buckets are compared at the top level.
+	if len(path) == 0 && !isReplicatedBucket(key) {
+		return nil
+	}
+
+	// Keys and values are copied, such that the events don't retain the
+	// pages they were read from.
+	key = append([]byte(nil), key...)
+	bucketPath := replicationBucketPath(path)
+	childPath := append(path[:len(path):len(path)], key)
+
+	var beforeBucket, afterBucket *boltBucket
+	var err error
+	if before != nil && before.flags&boltBucketLeafFlag != 0 {
+		beforeBucket, err = parseBoltBucket(before.value)
+		if err != nil {
+			return err
+		}
+	}
+	if after != nil && after.flags&boltBucketLeafFlag != 0 {
+		afterBucket, err = parseBoltBucket(after.value)
+		if err != nil {
+			return err
+		}
+	}
+
+	// A key that changed from a value to a nested bucket or vice versa is
+	// removed before it's recreated.
+	if before != nil && after != nil &&
+		(beforeBucket == nil) != (afterBucket == nil) {
+
+		removal := ReplicationEvent{
+			Op:     ReplicationDelete,
+			Bucket: bucketPath,
+			Key:    key,
+		}
+		if beforeBucket != nil {
+			removal = ReplicationEvent{
+				Op:     ReplicationDeleteBucket,
+				Bucket: replicationBucketPath(childPath),
+			}
+		}
+		d.emit(removal)
+		before, beforeBucket = nil, nil
+	}
+
+	switch {
+	case afterBucket != nil || (after == nil && beforeBucket != nil):
+		return d.diffBuckets(childPath, beforeBucket, afterBucket)
+
+	case after == nil:
+		d.emit(ReplicationEvent{
+			Op:     ReplicationDelete,
+			Bucket: bucketPath,
+			Key:    key,
+		})
+
+	case before == nil || !bytes.Equal(before.value, after.value):
+		d.emit(ReplicationEvent{
+			Op:     ReplicationWrite,
+			Bucket: bucketPath,
+			Key:    key,
+			Value:  append([]byte(nil), after.value...),
+		})
+	}
+
+	return nil
+}
+
+// compareCursorKeys compares the keys of two cursors walked in lockstep, where
+// a nil key marks an exhausted cursor and sorts after all others.
+func compareCursorKeys(a, b []byte) int {
+	switch {
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	default:
+		return bytes.Compare(a, b)
+	}
+}
+
+// replicationBucketPath encodes a path of nested buckets as handed to the
+// replication sink.
+func replicationBucketPath(buckets [][]byte) string {
+	names := make([]string, len(buckets))
+	for i, name := range buckets {
+		names[i] = hex.EncodeToString(name)
+	}
+
+	return strings.Join(names, replicationPathSeparator)
+}
+
+// parseReplicationBucketPath decodes a path of nested buckets encoded by
+// replicationBucketPath.
+func parseReplicationBucketPath(path string) ([][]byte, error) {
+	if path == "" {
+		return nil, fmt.Errorf("replication event has no bucket")
+	}
+
+	names := strings.Split(path, replicationPathSeparator)
+	buckets := make([][]byte, len(names))
+	for i, name := range names {
+		bucket, err := hex.DecodeString(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket path %q: %v",
+				path, err)
+		}
+		if len(bucket) == 0 {
+			return nil, fmt.Errorf("invalid bucket path %q: empty "+
+				"bucket name", path)
+		}
+		buckets[i] = bucket
+	}
+
+	return buckets, nil
+}
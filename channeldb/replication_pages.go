@@ -0,0 +1,375 @@
+package channeldb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"unsafe"
+)
+
+const (
+	// boltPageHeaderSize is the size of the header of a bolt page: its ID,
+	// flags, number of elements and number of overflow pages.
+	boltPageHeaderSize = 16
+
+	// boltElementSize is the size of a branch or leaf element of a bolt
+	// page, which precedes the keys and values the elements point to.
+	boltElementSize = 16
+
+	// boltBucketHeaderSize is the size of the header of a bucket value:
+	// the root page of the bucket and its sequence. An inline bucket's
+	// page follows the header.
+	boltBucketHeaderSize = 16
+
+	// boltBranchPageFlag and boltLeafPageFlag are the page flags of branch
+	// and leaf pages.
+	boltBranchPageFlag = 0x01
+	boltLeafPageFlag   = 0x02
+
+	// boltBucketLeafFlag is the flag of a leaf element holding a nested
+	// bucket.
+	boltBucketLeafFlag = 0x01
+
+	// boltMetaRootOffset and boltMetaTxIDOffset are the offsets of the
+	// root bucket and the transaction ID within a meta page.
+	boltMetaRootOffset = boltPageHeaderSize + 16
+	boltMetaTxIDOffset = boltPageHeaderSize + 48
+)
+
+// boltByteOrder is the byte order bolt lays out its pages in, which is that of
+// the host.
+var boltByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+
+	return binary.BigEndian
+}()
+
+// boltPageReader reads the pages of a bolt database from its file, in the
+// on-disk format bolt's B+trees are stored in. It's used to find the changes
+// of a committed transaction by comparing the trees rooted at the meta pages
+// before and after it, skipping all subtrees that are shared between them.
+//
+// NOTE: The pages of the tree a transaction replaced are only released for
+// reuse once the next write transaction begins, so they may only be read
+// while write transactions are held off.
+type boltPageReader struct {
+	file     *os.File
+	pageSize int
+	pages    map[uint64]boltPage
+}
+
+// boltPage is a single page of a bolt database, including its overflow pages,
+// or the page of an inline bucket.
+type boltPage []byte
+
+// boltTreeElement is an element of a bolt page. Branch elements reference
+// the child page of a subtree, and leaf elements hold a key and its value.
+type boltTreeElement struct {
+	key   []byte
+	value []byte
+	flags uint32
+	child uint64
+}
+
+// newBoltPageReader opens the bolt database file at path for reading its
+// pages.
+func newBoltPageReader(path string, pageSize int) (*boltPageReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &boltPageReader{
+		file:     file,
+		pageSize: pageSize,
+		pages:    make(map[uint64]boltPage),
+	}, nil
+}
+
+// Close closes the database file.
+func (r *boltPageReader) Close() error {
+	return r.file.Close()
+}
+
+// page returns the page with the passed ID, along with its overflow pages.
+func (r *boltPageReader) page(id uint64) (boltPage, error) {
+	if page, ok := r.pages[id]; ok {
+		return page, nil
+	}
+
+	page := make(boltPage, r.pageSize)
+	offset := int64(id) * int64(r.pageSize)
+	if _, err := r.file.ReadAt(page, offset); err != nil {
+		return nil, fmt.Errorf("unable to read page %v: %v", id, err)
+	}
+	if page.id() != id {
+		return nil, fmt.Errorf("page %v holds page %v", id, page.id())
+	}
+
+	if overflow := page.overflow(); overflow > 0 {
+		full := make(boltPage, (overflow+1)*r.pageSize)
+		if _, err := r.file.ReadAt(full, offset); err != nil {
+			return nil, fmt.Errorf("unable to read page %v: %v",
+				id, err)
+		}
+		page = full
+	}
+
+	r.pages[id] = page
+
+	return page, nil
+}
+
+// metaRoot returns the root page of the root bucket as of the transaction with
+// the passed ID, as recorded by the meta page the transaction committed. Bolt
+// alternates between two meta pages, so the root as of the transaction
+// preceding the latest one is still recorded as well.
+func (r *boltPageReader) metaRoot(txID uint64) (uint64, error) {
+	meta := make([]byte, boltMetaTxIDOffset+8)
+	offset := int64(txID%2) * int64(r.pageSize)
+	if _, err := r.file.ReadAt(meta, offset); err != nil {
+		return 0, fmt.Errorf("unable to read meta page: %v", err)
+	}
+
+	metaTxID := boltByteOrder.Uint64(meta[boltMetaTxIDOffset:])
+	if metaTxID != txID {
+		return 0, fmt.Errorf("meta page holds transaction %v rather "+
+			"than %v", metaTxID, txID)
+	}
+
+	return boltByteOrder.Uint64(meta[boltMetaRootOffset:]), nil
+}
+
+// id returns the ID of the page.
+func (p boltPage) id() uint64 {
+	return boltByteOrder.Uint64(p[0:8])
+}
+
+// flags returns the flags of the page.
+func (p boltPage) flags() uint16 {
+	return boltByteOrder.Uint16(p[8:10])
+}
+
+// count returns the number of elements of the page.
+func (p boltPage) count() int {
+	return int(boltByteOrder.Uint16(p[10:12]))
+}
+
+// overflow returns the number of overflow pages following the page.
+func (p boltPage) overflow() int {
+	return int(boltByteOrder.Uint32(p[12:16]))
+}
+
+// elements returns the elements of the page, whose keys and values reference
+// the page's memory.
+func (p boltPage) elements() ([]boltTreeElement, error) {
+	isBranch := p.flags()&boltBranchPageFlag != 0
+	if !isBranch && p.flags()&boltLeafPageFlag == 0 {
+		return nil, fmt.Errorf("page %v isn't a branch or leaf page",
+			p.id())
+	}
+
+	count := p.count()
+	if boltPageHeaderSize+count*boltElementSize > len(p) {
+		return nil, fmt.Errorf("page %v has %v elements exceeding "+
+			"its size", p.id(), count)
+	}
+
+	elements := make([]boltTreeElement, count)
+	for i := range elements {
+		offset := boltPageHeaderSize + i*boltElementSize
+		element := p[offset : offset+boltElementSize]
+
+		var (
+			pos, keySize, valueSize int
+			e                       = &elements[i]
+		)
+		if isBranch {
+			pos = int(boltByteOrder.Uint32(element[0:4]))
+			keySize = int(boltByteOrder.Uint32(element[4:8]))
+			e.child = boltByteOrder.Uint64(element[8:16])
+		} else {
+			e.flags = boltByteOrder.Uint32(element[0:4])
+			pos = int(boltByteOrder.Uint32(element[4:8]))
+			keySize = int(boltByteOrder.Uint32(element[8:12]))
+			valueSize = int(boltByteOrder.Uint32(element[12:16]))
+		}
+
+		start := offset + pos
+		end := start + keySize + valueSize
+		if end > len(p) {
+			return nil, fmt.Errorf("element %v of page %v exceeds "+
+				"its size", i, p.id())
+		}
+		e.key = p[start : start+keySize : start+keySize]
+		e.value = p[start+keySize : end : end]
+	}
+
+	return elements, nil
+}
+
+// isBranch returns whether the page is a branch page.
+func (p boltPage) isBranch() bool {
+	return p.flags()&boltBranchPageFlag != 0
+}
+
+// boltBucket is a bucket as stored within a bolt database. Buckets small
+// enough to be stored inline within their parent have no root page, and
+// their page is held by the value of the bucket instead.
+type boltBucket struct {
+	root     uint64
+	sequence uint64
+	inline   boltPage
+}
+
+// parseBoltBucket parses the value of a leaf element holding a bucket.
+func parseBoltBucket(value []byte) (*boltBucket, error) {
+	if len(value) < boltBucketHeaderSize {
+		return nil, fmt.Errorf("bucket value of %v bytes", len(value))
+	}
+
+	bucket := &boltBucket{
+		root:     boltByteOrder.Uint64(value[0:8]),
+		sequence: boltByteOrder.Uint64(value[8:16]),
+	}
+	if bucket.root == 0 {
+		bucket.inline = boltPage(value[boltBucketHeaderSize:])
+		if len(bucket.inline) < boltPageHeaderSize {
+			return nil, fmt.Errorf("inline bucket of %v bytes",
+				len(bucket.inline))
+		}
+	}
+
+	return bucket, nil
+}
+
+// boltTreeItem is an item of the frontier of a boltTreeWalker: either a leaf
+// element, or a subtree that has yet to be descended into.
+type boltTreeItem struct {
+	element boltTreeElement
+
+	// subtree is the root page of a subtree, or zero for leaf elements.
+	subtree uint64
+
+	// height is the number of levels of the subtree. It decides which of
+	// two subtrees is descended into first when comparing two walks, such
+	// that subtrees of the same height are compared against each other.
+	height int
+}
+
+// boltTreeWalker walks the leaf elements of a bucket in key order. Subtrees
+// are only read once they're descended into, such that those shared with
+// another snapshot of the bucket can be skipped without being read.
+type boltTreeWalker struct {
+	r *boltPageReader
+
+	// frontier holds the items that are yet to be walked, with the next
+	// one last.
+	frontier []boltTreeItem
+}
+
+// newBoltTreeWalker returns a walker over the passed bucket, or over an empty
+// bucket if it's nil.
+func newBoltTreeWalker(r *boltPageReader,
+	bucket *boltBucket) (*boltTreeWalker, error) {
+
+	w := &boltTreeWalker{r: r}
+	switch {
+	case bucket == nil:
+
+	case bucket.root == 0:
+		elements, err := bucket.inline.elements()
+		if err != nil {
+			return nil, err
+		}
+		w.pushElements(elements, false, 0)
+
+	default:
+		height, err := w.height(bucket.root)
+		if err != nil {
+			return nil, err
+		}
+		w.frontier = append(w.frontier, boltTreeItem{
+			subtree: bucket.root,
+			height:  height,
+		})
+	}
+
+	return w, nil
+}
+
+// height returns the number of levels of the tree rooted at the passed page.
+// Bolt's trees are balanced, so it's found by descending its leftmost path.
+func (w *boltTreeWalker) height(root uint64) (int, error) {
+	height := 1
+	for {
+		page, err := w.r.page(root)
+		if err != nil {
+			return 0, err
+		}
+		if !page.isBranch() {
+			return height, nil
+		}
+
+		elements, err := page.elements()
+		if err != nil {
+			return 0, err
+		}
+		if len(elements) == 0 {
+			return 0, fmt.Errorf("branch page %v is empty", root)
+		}
+		root = elements[0].child
+		height++
+	}
+}
+
+// pushElements adds the elements of a page to the frontier. The elements of a
+// branch page of the passed height are added as its subtrees.
+func (w *boltTreeWalker) pushElements(elements []boltTreeElement,
+	isBranch bool, height int) {
+
+	for i := len(elements) - 1; i >= 0; i-- {
+		item := boltTreeItem{element: elements[i]}
+		if isBranch {
+			item.subtree = elements[i].child
+			item.height = height - 1
+		}
+		w.frontier = append(w.frontier, item)
+	}
+}
+
+// next returns the next item of the walk, or nil once it's exhausted.
+func (w *boltTreeWalker) next() *boltTreeItem {
+	if len(w.frontier) == 0 {
+		return nil
+	}
+
+	return &w.frontier[len(w.frontier)-1]
+}
+
+// skip drops the next item of the walk.
+func (w *boltTreeWalker) skip() {
+	w.frontier = w.frontier[:len(w.frontier)-1]
+}
+
+// descend replaces the next item of the walk, which must be a subtree, by the
+// elements of its root page.
+func (w *boltTreeWalker) descend() error {
+	item := *w.next()
+	w.skip()
+
+	page, err := w.r.page(item.subtree)
+	if err != nil {
+		return err
+	}
+	elements, err := page.elements()
+	if err != nil {
+		return err
+	}
+	w.pushElements(elements, page.isBranch(), item.height)
+
+	return nil
+}
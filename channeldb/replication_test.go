@@ -0,0 +1,457 @@
+package channeldb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// recordingSink is a ReplicationSink that records all events handed to it.
+type recordingSink struct {
+	events []ReplicationEvent
+}
+
+func (s *recordingSink) OnWrite(seq uint64, bucket string, key, val []byte) {
+	s.events = append(s.events, ReplicationEvent{
+		Seq:    seq,
+		Op:     ReplicationWrite,
+		Bucket: bucket,
+		Key:    key,
+		Value:  val,
+	})
+}
+
+func (s *recordingSink) OnDelete(seq uint64, bucket string, key []byte) {
+	s.events = append(s.events, ReplicationEvent{
+		Seq:    seq,
+		Op:     ReplicationDelete,
+		Bucket: bucket,
+		Key:    key,
+	})
+}
+
+func (s *recordingSink) OnCreateBucket(seq uint64, bucket string) {
+	s.events = append(s.events, ReplicationEvent{
+		Seq:    seq,
+		Op:     ReplicationCreateBucket,
+		Bucket: bucket,
+	})
+}
+
+func (s *recordingSink) OnDeleteBucket(seq uint64, bucket string) {
+	s.events = append(s.events, ReplicationEvent{
+		Seq:    seq,
+		Op:     ReplicationDeleteBucket,
+		Bucket: bucket,
+	})
+}
+
+func (s *recordingSink) OnSetSequence(seq uint64, bucket string,
+	bucketSeq uint64) {
+
+	s.events = append(s.events, ReplicationEvent{
+		Seq:       seq,
+		Op:        ReplicationSetSequence,
+		Bucket:    bucket,
+		BucketSeq: bucketSeq,
+	})
+}
+
+// transactions groups the recorded events by the transaction that committed
+// them.
+func (s *recordingSink) transactions() [][]ReplicationEvent {
+	var txns [][]ReplicationEvent
+	for _, event := range s.events {
+		last := len(txns) - 1
+		if last >= 0 && txns[last][0].Seq == event.Seq {
+			txns[last] = append(txns[last], event)
+			continue
+		}
+
+		txns = append(txns, []ReplicationEvent{event})
+	}
+
+	return txns
+}
+
+// dumpReplicatedState returns a description of all replicated buckets, keys
+// and sequences of the database.
+func dumpReplicatedState(t *testing.T, db *DB) []string {
+	t.Helper()
+
+	var dump []string
+	var dumpBucket func(path string, bucket *bbolt.Bucket) error
+	dumpBucket = func(path string, bucket *bbolt.Bucket) error {
+		dump = append(dump, fmt.Sprintf("%v seq=%v", path,
+			bucket.Sequence()))
+
+		return bucket.ForEach(func(k, v []byte) error {
+			if v == nil {
+				return dumpBucket(
+					fmt.Sprintf("%v/%x", path, k),
+					bucket.Bucket(k),
+				)
+			}
+
+			entry := fmt.Sprintf("%v %x=%x", path, k, v)
+			dump = append(dump, entry)
+			return nil
+		})
+	}
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte,
+			bucket *bbolt.Bucket) error {
+
+			if !isReplicatedBucket(name) {
+				return nil
+			}
+
+			return dumpBucket(fmt.Sprintf("%x", name), bucket)
+		})
+	})
+	if err != nil {
+		t.Fatalf("unable to dump database: %v", err)
+	}
+
+	return dump
+}
+
+// TestReplication asserts that every mutation committed to a primary is
+// streamed to its sink tagged with the DB sequence of its transaction, and
+// that replaying the transactions on a standby yields the same state.
+func TestReplication(t *testing.T) {
+	t.Parallel()
+
+	dbPath, err := ioutil.TempDir("", "channeldb")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+
+	sink := &recordingSink{}
+	primary, err := Open(
+		dbPath, OptionSetSyncMode(NoSync),
+		OptionSetReplicationSink(sink),
+	)
+	if err != nil {
+		t.Fatalf("unable to open primary: %v", err)
+	}
+	defer primary.Close()
+
+	// The standby is seeded with the primary as it was opened, and then
+	// tails all writes that follow.
+	standbyPath, err := ioutil.TempDir("", "channeldb")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(standbyPath)
+	err = primary.CompactTo(standbyPath + "/" + dbName)
+	if err != nil {
+		t.Fatalf("unable to copy primary: %v", err)
+	}
+	sink.events = nil
+
+	standby, err := Open(standbyPath, OptionSetSyncMode(NoSync))
+	if err != nil {
+		t.Fatalf("unable to open standby: %v", err)
+	}
+	defer standby.Close()
+
+	// Plain updates are replicated, including nested buckets, sequences
+	// and deletions.
+	err = primary.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucket(testJournalBucket)
+		if err != nil {
+			return err
+		}
+		nested, err := bucket.CreateBucket(testJournalNested)
+		if err != nil {
+			return err
+		}
+		_, err = bucket.CreateBucket([]byte("empty"))
+		if err != nil {
+			return err
+		}
+		if _, err := nested.NextSequence(); err != nil {
+			return err
+		}
+
+		return nested.Put([]byte("a"), []byte("1"))
+	})
+	if err != nil {
+		t.Fatalf("unable to update primary: %v", err)
+	}
+	seq, err := primary.DBSequence()
+	if err != nil {
+		t.Fatalf("unable to fetch db sequence: %v", err)
+	}
+
+	topPath := replicationBucketPath([][]byte{testJournalBucket})
+	nestedPath := replicationBucketPath(
+		[][]byte{testJournalBucket, testJournalNested},
+	)
+	expected := []ReplicationEvent{
+		{
+			Seq:    seq,
+			Op:     ReplicationCreateBucket,
+			Bucket: topPath,
+		},
+		{
+			Seq: seq,
+			Op:  ReplicationCreateBucket,
+			Bucket: replicationBucketPath([][]byte{
+				testJournalBucket, []byte("empty"),
+			}),
+		},
+		{
+			Seq:    seq,
+			Op:     ReplicationCreateBucket,
+			Bucket: nestedPath,
+		},
+		{
+			Seq:       seq,
+			Op:        ReplicationSetSequence,
+			Bucket:    nestedPath,
+			BucketSeq: 1,
+		},
+		{
+			Seq:    seq,
+			Op:     ReplicationWrite,
+			Bucket: nestedPath,
+			Key:    []byte("a"),
+			Value:  []byte("1"),
+		},
+	}
+	if !reflect.DeepEqual(sink.events, expected) {
+		t.Fatalf("expected events %v, got %v", expected, sink.events)
+	}
+
+	err = primary.Journal([]JournalStep{{
+		Buckets: [][]byte{testJournalBucket, testJournalNested},
+		Key:     []byte("b"),
+		Value:   []byte("2"),
+	}})
+	if err != nil {
+		t.Fatalf("unable to apply journal: %v", err)
+	}
+	err = primary.Batch(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(testJournalBucket)
+		if err := bucket.DeleteBucket([]byte("empty")); err != nil {
+			return err
+		}
+
+		return bucket.Bucket(testJournalNested).Delete([]byte("a"))
+	})
+	if err != nil {
+		t.Fatalf("unable to update primary: %v", err)
+	}
+
+	// Concurrent batches are replicated as well, including the remaining
+	// calls of a batch one of whose calls failed.
+	errBatch := fmt.Errorf("batch failed")
+	var wg sync.WaitGroup
+	batchErrs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i byte) {
+			defer wg.Done()
+
+			batchErrs <- primary.Batch(func(tx *bbolt.Tx) error {
+				if i == 0 {
+					return errBatch
+				}
+
+				nested := tx.Bucket(testJournalBucket).Bucket(
+					testJournalNested,
+				)
+				return nested.Put([]byte{'c', i}, []byte{i})
+			})
+		}(byte(i))
+	}
+	wg.Wait()
+	close(batchErrs)
+	for err := range batchErrs {
+		if err != nil && err != errBatch {
+			t.Fatalf("unable to batch update primary: %v", err)
+		}
+	}
+
+	// Writes of the regular channeldb methods are replicated as well.
+	invoice, err := randInvoice(lnwire.NewMSatFromSatoshis(1000))
+	if err != nil {
+		t.Fatalf("unable to create invoice: %v", err)
+	}
+	hash := invoice.Terms.PaymentPreimage.Hash()
+	if _, err := primary.AddInvoice(invoice, hash); err != nil {
+		t.Fatalf("unable to add invoice: %v", err)
+	}
+
+	// Sequence numbers must increase from one transaction to the next.
+	txns := sink.transactions()
+	for i := 1; i < len(txns); i++ {
+		if txns[i][0].Seq <= txns[i-1][0].Seq {
+			t.Fatalf("expected increasing sequence numbers, got "+
+				"%v after %v", txns[i][0].Seq, txns[i-1][0].Seq)
+		}
+	}
+
+	// The events of different transactions can't be applied as one.
+	mixed := append([]ReplicationEvent(nil), txns[0]...)
+	mixed = append(mixed, txns[1]...)
+	err = standby.ApplyReplicationEvents(mixed)
+	if err != ErrReplicationSeqMismatch {
+		t.Fatalf("expected ErrReplicationSeqMismatch, got %v", err)
+	}
+
+	for _, txn := range txns {
+		if err := standby.ApplyReplicationEvents(txn); err != nil {
+			t.Fatalf("unable to apply transaction %v: %v",
+				txn[0].Seq, err)
+		}
+	}
+
+	// Redelivering a transaction that was already applied is a noop, and
+	// must not resurrect the deleted key.
+	if err := standby.ApplyReplicationEvents(txns[0]); err != nil {
+		t.Fatalf("unable to redeliver transaction: %v", err)
+	}
+
+	if value := fetchTestJournalKey(t, standby, []byte("a")); value != nil {
+		t.Fatalf("expected key to be deleted, found %x", value)
+	}
+	primaryState := dumpReplicatedState(t, primary)
+	standbyState := dumpReplicatedState(t, standby)
+	if !reflect.DeepEqual(primaryState, standbyState) {
+		t.Fatalf("expected standby state %v, got %v", primaryState,
+			standbyState)
+	}
+
+	if _, err := standby.LookupInvoice(hash); err != nil {
+		t.Fatalf("unable to find replicated invoice: %v", err)
+	}
+}
+
+// TestReplicationBucketPath asserts that bucket paths survive being encoded
+// for the replication sink, and that malformed paths are rejected.
+func TestReplicationBucketPath(t *testing.T) {
+	t.Parallel()
+
+	path := [][]byte{[]byte("top"), {0x2f, 0x00, 0xff}}
+	parsed, err := parseReplicationBucketPath(replicationBucketPath(path))
+	if err != nil {
+		t.Fatalf("unable to parse bucket path: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, path) {
+		t.Fatalf("expected path %x, got %x", path, parsed)
+	}
+
+	for _, invalid := range []string{"", "zz", "746f70//00"} {
+		_, err := parseReplicationBucketPath(invalid)
+		if err == nil {
+			t.Fatalf("expected path %q to be rejected", invalid)
+		}
+	}
+}
+
+// TestReplicationDiffPages asserts that the mutations of a transaction are
+// found by only reading the pages it rewrote, rather than all pages of the
+// buckets it modified.
+func TestReplicationDiffPages(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	// We'll fill a bucket with enough keys to span many pages, and then
+	// overwrite a single one of them.
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucket(testJournalBucket)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 10000; i++ {
+			var key [8]byte
+			byteOrder.PutUint64(key[:], uint64(i))
+			if err := bucket.Put(key[:], key[:]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to fill bucket: %v", err)
+	}
+
+	var key [8]byte
+	byteOrder.PutUint64(key[:], 5000)
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(testJournalBucket).Put(key[:], []byte("new"))
+	})
+	if err != nil {
+		t.Fatalf("unable to update key: %v", err)
+	}
+
+	var txID uint64
+	err = db.View(func(tx *bbolt.Tx) error {
+		txID = uint64(tx.ID())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to fetch tx id: %v", err)
+	}
+
+	r, err := newBoltPageReader(db.bdb.Path(), db.bdb.Info().PageSize)
+	if err != nil {
+		t.Fatalf("unable to open page reader: %v", err)
+	}
+	defer r.Close()
+
+	beforeRoot, err := r.metaRoot(txID - 1)
+	if err != nil {
+		t.Fatalf("unable to read meta root: %v", err)
+	}
+	afterRoot, err := r.metaRoot(txID)
+	if err != nil {
+		t.Fatalf("unable to read meta root: %v", err)
+	}
+
+	diff := &replicationDiff{r: r, seq: 1}
+	err = diff.diffKeys(
+		nil, &boltBucket{root: beforeRoot},
+		&boltBucket{root: afterRoot},
+	)
+	if err != nil {
+		t.Fatalf("unable to diff transaction: %v", err)
+	}
+
+	expected := []ReplicationEvent{{
+		Seq:    1,
+		Op:     ReplicationWrite,
+		Bucket: replicationBucketPath([][]byte{testJournalBucket}),
+		Key:    key[:],
+		Value:  []byte("new"),
+	}}
+	if !reflect.DeepEqual(diff.events, expected) {
+		t.Fatalf("expected events %v, got %v", expected, diff.events)
+	}
+
+	// Beyond the roots, only the path to the rewritten leaf of the bucket
+	// and the database sequence is read, along with the leftmost paths
+	// walked to find the height of each tree.
+	const maxPages = 16
+	if len(r.pages) > maxPages {
+		t.Fatalf("expected at most %v pages to be read, read %v",
+			maxPages, len(r.pages))
+	}
+}
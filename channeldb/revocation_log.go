@@ -0,0 +1,227 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// ErrInvalidRevocationLogLimit is returned when trimming the revocation
+	// log of a channel down to less than a single revoked state.
+	ErrInvalidRevocationLogLimit = fmt.Errorf("at least one revoked " +
+		"state must be retained")
+
+	// ErrCommitmentNotRetained is returned when fetching a commitment of
+	// the remote party at a height that's neither retained within the
+	// revocation log, nor the current or pending commitment.
+	ErrCommitmentNotRetained = fmt.Errorf("commitment at height not " +
+		"retained")
+)
+
+// htlcID identifies an HTLC across the commitments of a channel.
+type htlcID struct {
+	htlcIndex uint64
+	incoming  bool
+}
+
+// TrimRevocationLog deletes all but the keepLast most recent revoked states
+// from the revocation log of the open channel with the passed funding
+// outpoint, returning the number of states deleted. Revoked states are
+// deleted oldest first, and trimming stops at the first state that holds an
+// HTLC that's still outstanding, as the state is needed to resolve the HTLC
+// should the peer broadcast it. Once trimmed, a breach of a deleted state can
+// no longer be punished through FindPreviousState.
+func (d *DB) TrimRevocationLog(op wire.OutPoint, keepLast int) (uint64,
+	error) {
+
+	if keepLast < 1 {
+		return 0, ErrInvalidRevocationLogLimit
+	}
+
+	var numTrimmed uint64
+	err := d.Update(func(tx *bbolt.Tx) error {
+		_, _, chanBucket, err := findChanBucket(tx, &op)
+		if err != nil {
+			return err
+		}
+
+		numTrimmed, err = trimRevocationLog(chanBucket, keepLast)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return numTrimmed, nil
+}
+
+// CommitmentAtHeight returns the commitment of the remote party of the open
+// channel with the passed funding outpoint at the given state number. Revoked
+// commitments are read from the revocation log, while the current commitment
+// and the pending one, if it's been signed but not yet revoked, are read from
+// the channel's state. As the local commitment is overwritten on every state
+// transition, only the remote party's commitment chain can be reconstructed.
+// If the requested height was never reached, or has been trimmed from the
+// revocation log through TrimRevocationLog, ErrCommitmentNotRetained is
+// returned.
+func (d *DB) CommitmentAtHeight(op wire.OutPoint,
+	height uint64) (*ChannelCommitment, error) {
+
+	var commit *ChannelCommitment
+	err := d.View(func(tx *bbolt.Tx) error {
+		_, _, chanBucket, err := findChanBucket(tx, &op)
+		if err != nil {
+			return err
+		}
+
+		var commitBytes []byte
+		logBucket := chanBucket.Bucket(revocationLogBucket)
+		if logBucket != nil {
+			logKey := makeLogKey(height)
+			commitBytes = logBucket.Get(logKey[:])
+		}
+		if commitBytes != nil {
+			revoked, err := deserializeChanCommit(
+				bytes.NewReader(commitBytes),
+			)
+			if err != nil {
+				return err
+			}
+			commit = &revoked
+
+			return nil
+		}
+
+		remoteCommit, err := fetchChanCommitment(chanBucket, false)
+		if err != nil {
+			return err
+		}
+		if remoteCommit.CommitHeight == height {
+			commit = &remoteCommit
+			return nil
+		}
+
+		diffBytes := chanBucket.Get(commitDiffKey)
+		if diffBytes == nil {
+			return ErrCommitmentNotRetained
+		}
+		diff, err := deserializeCommitDiff(bytes.NewReader(diffBytes))
+		if err != nil {
+			return err
+		}
+		if diff.Commitment.CommitHeight != height {
+			return ErrCommitmentNotRetained
+		}
+		commit = &diff.Commitment
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return commit, nil
+}
+
+// trimRevocationLog deletes the oldest revoked states from the revocation log
+// within the passed channel bucket, such that at least keepLast states are
+// retained, along with every state following the first one that holds an
+// outstanding HTLC.
+func trimRevocationLog(chanBucket *bbolt.Bucket, keepLast int) (uint64,
+	error) {
+
+	logBucket := chanBucket.Bucket(revocationLogBucket)
+	if logBucket == nil {
+		return 0, nil
+	}
+
+	numTrimmable := int(countValues(logBucket)) - keepLast
+	if numTrimmable <= 0 {
+		return 0, nil
+	}
+
+	outstanding, err := outstandingHtlcs(chanBucket)
+	if err != nil {
+		return 0, err
+	}
+
+	var trimmed [][]byte
+	cursor := logBucket.Cursor()
+	k, v := cursor.First()
+	for ; k != nil && len(trimmed) < numTrimmable; k, v = cursor.Next() {
+		commit, err := deserializeChanCommit(bytes.NewReader(v))
+		if err != nil {
+			return 0, err
+		}
+
+		if holdsHtlc(&commit, outstanding) {
+			break
+		}
+
+		trimmed = append(trimmed, append([]byte(nil), k...))
+	}
+
+	for _, k := range trimmed {
+		if err := logBucket.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+
+	return uint64(len(trimmed)), nil
+}
+
+// outstandingHtlcs returns the HTLCs that are still outstanding within the
+// channel bucket, which are those of the current local and remote commitment,
+// and of the pending remote commitment if there is one.
+func outstandingHtlcs(chanBucket *bbolt.Bucket) (map[htlcID]struct{},
+	error) {
+
+	var commits []*ChannelCommitment
+	for _, local := range []bool{true, false} {
+		commit, err := fetchChanCommitment(chanBucket, local)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, &commit)
+	}
+
+	if tipBytes := chanBucket.Get(commitDiffKey); tipBytes != nil {
+		diff, err := deserializeCommitDiff(bytes.NewReader(tipBytes))
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, &diff.Commitment)
+	}
+
+	outstanding := make(map[htlcID]struct{})
+	for _, commit := range commits {
+		for _, htlc := range commit.Htlcs {
+			outstanding[htlcID{
+				htlcIndex: htlc.HtlcIndex,
+				incoming:  htlc.Incoming,
+			}] = struct{}{}
+		}
+	}
+
+	return outstanding, nil
+}
+
+// holdsHtlc returns true if the commitment holds any of the passed HTLCs.
+func holdsHtlc(commit *ChannelCommitment,
+	htlcs map[htlcID]struct{}) bool {
+
+	for _, htlc := range commit.Htlcs {
+		id := htlcID{
+			htlcIndex: htlc.HtlcIndex,
+			incoming:  htlc.Incoming,
+		}
+		if _, ok := htlcs[id]; ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,279 @@
+package channeldb
+
+import (
+	"net"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestTrimRevocationLog asserts that the oldest revoked states of a channel
+// are trimmed down to the requested number, without trimming any state that
+// holds an outstanding HTLC.
+func TestTrimRevocationLog(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	addr := &net.TCPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 18555,
+	}
+	if err := channel.SyncPending(addr, 101); err != nil {
+		t.Fatalf("unable to sync channel: %v", err)
+	}
+
+	htlc := HTLC{
+		HtlcIndex: 7,
+		Amt:       1000,
+		OnionBlob: []byte("onionblob"),
+	}
+
+	updateChannel := func(f func(chanBucket *bbolt.Bucket) error) {
+		t.Helper()
+
+		err := cdb.Update(func(tx *bbolt.Tx) error {
+			chanBucket, err := fetchChanBucket(
+				tx, channel.IdentityPub,
+				&channel.FundingOutpoint, channel.ChainHash,
+			)
+			if err != nil {
+				return err
+			}
+
+			return f(chanBucket)
+		})
+		if err != nil {
+			t.Fatalf("unable to update channel: %v", err)
+		}
+	}
+
+	// The remote commitment holds an outstanding HTLC, which was added in
+	// the third of six revoked states.
+	updateChannel(func(chanBucket *bbolt.Bucket) error {
+		logBucket, err := chanBucket.CreateBucketIfNotExists(
+			revocationLogBucket,
+		)
+		if err != nil {
+			return err
+		}
+
+		commit := channel.RemoteCommitment
+		for height := uint64(0); height < 6; height++ {
+			commit.CommitHeight = height
+			commit.Htlcs = nil
+			if height >= 2 {
+				commit.Htlcs = []HTLC{htlc}
+			}
+
+			err := appendChannelLogEntry(logBucket, &commit)
+			if err != nil {
+				return err
+			}
+		}
+
+		commit.CommitHeight = 6
+		return putChanCommitment(chanBucket, &commit, false)
+	})
+
+	assertLog := func(heights ...uint64) {
+		t.Helper()
+
+		var logHeights []uint64
+		updateChannel(func(chanBucket *bbolt.Bucket) error {
+			logBucket := chanBucket.Bucket(revocationLogBucket)
+			return logBucket.ForEach(func(k, _ []byte) error {
+				logHeights = append(logHeights, readLogKey(k))
+				return nil
+			})
+		})
+
+		if len(logHeights) != len(heights) {
+			t.Fatalf("expected heights %v, got %v", heights,
+				logHeights)
+		}
+		for i := range heights {
+			if logHeights[i] != heights[i] {
+				t.Fatalf("expected heights %v, got %v",
+					heights, logHeights)
+			}
+		}
+	}
+
+	op := channel.FundingOutpoint
+	if _, err := cdb.TrimRevocationLog(op, 0); err !=
+		ErrInvalidRevocationLogLimit {
+
+		t.Fatalf("expected ErrInvalidRevocationLogLimit, got %v", err)
+	}
+
+	// Only the states preceding the one that added the HTLC may be
+	// trimmed, even though we'd like to keep just two.
+	numTrimmed, err := cdb.TrimRevocationLog(op, 2)
+	if err != nil {
+		t.Fatalf("unable to trim revocation log: %v", err)
+	}
+	if numTrimmed != 2 {
+		t.Fatalf("expected 2 trimmed states, got %v", numTrimmed)
+	}
+	assertLog(2, 3, 4, 5)
+
+	// Once the HTLC is resolved, the log is trimmed down to two states.
+	updateChannel(func(chanBucket *bbolt.Bucket) error {
+		commit := channel.RemoteCommitment
+		commit.CommitHeight = 7
+		return putChanCommitment(chanBucket, &commit, false)
+	})
+
+	numTrimmed, err = cdb.TrimRevocationLog(op, 2)
+	if err != nil {
+		t.Fatalf("unable to trim revocation log: %v", err)
+	}
+	if numTrimmed != 2 {
+		t.Fatalf("expected 2 trimmed states, got %v", numTrimmed)
+	}
+	assertLog(4, 5)
+
+	// A log that's already short enough is left as is.
+	numTrimmed, err = cdb.TrimRevocationLog(op, 2)
+	if err != nil {
+		t.Fatalf("unable to trim revocation log: %v", err)
+	}
+	if numTrimmed != 0 {
+		t.Fatalf("expected no trimmed states, got %v", numTrimmed)
+	}
+	assertLog(4, 5)
+}
+
+// TestCommitmentAtHeight asserts that the remote commitment of a channel can
+// be fetched at every height that's retained, and that trimmed heights are
+// reported as such.
+func TestCommitmentAtHeight(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	channel.RemoteCommitment.CommitHeight = 3
+	addr := &net.TCPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 18555,
+	}
+	if err := channel.SyncPending(addr, 101); err != nil {
+		t.Fatalf("unable to sync channel: %v", err)
+	}
+	op := channel.FundingOutpoint
+
+	// The states at heights zero to two were revoked, the current remote
+	// commitment is at height three, and the one at height four is
+	// pending.
+	err = cdb.Update(func(tx *bbolt.Tx) error {
+		chanBucket, err := fetchChanBucket(
+			tx, channel.IdentityPub, &op, channel.ChainHash,
+		)
+		if err != nil {
+			return err
+		}
+		logBucket, err := chanBucket.CreateBucketIfNotExists(
+			revocationLogBucket,
+		)
+		if err != nil {
+			return err
+		}
+
+		commit := channel.RemoteCommitment
+		commit.Htlcs = nil
+		for height := uint64(0); height < 3; height++ {
+			commit.CommitHeight = height
+			commit.CommitFee = btcutil.Amount(height)
+			err := appendChannelLogEntry(logBucket, &commit)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to fill revocation log: %v", err)
+	}
+
+	commitDiff := &CommitDiff{
+		Commitment: channel.RemoteCommitment,
+		CommitSig: &lnwire.CommitSig{
+			ChanID: lnwire.NewChanIDFromOutPoint(&op),
+		},
+		OpenedCircuitKeys: []CircuitKey{},
+		ClosedCircuitKeys: []CircuitKey{},
+	}
+	commitDiff.Commitment.CommitHeight = 4
+	if err := channel.AppendRemoteCommitChain(commitDiff); err != nil {
+		t.Fatalf("unable to add to commit chain: %v", err)
+	}
+
+	assertCommitment := func(height uint64, expectedFee btcutil.Amount) {
+		t.Helper()
+
+		commit, err := cdb.CommitmentAtHeight(op, height)
+		if err != nil {
+			t.Fatalf("unable to fetch commitment at height %v: %v",
+				height, err)
+		}
+		if commit.CommitHeight != height {
+			t.Fatalf("expected height %v, got %v", height,
+				commit.CommitHeight)
+		}
+		if commit.CommitFee != expectedFee {
+			t.Fatalf("expected fee %v at height %v, got %v",
+				expectedFee, height, commit.CommitFee)
+		}
+	}
+	assertNotRetained := func(height uint64) {
+		t.Helper()
+
+		_, err := cdb.CommitmentAtHeight(op, height)
+		if err != ErrCommitmentNotRetained {
+			t.Fatalf("expected ErrCommitmentNotRetained at height "+
+				"%v, got %v", height, err)
+		}
+	}
+
+	for height := uint64(0); height < 3; height++ {
+		assertCommitment(height, btcutil.Amount(height))
+	}
+	assertCommitment(3, channel.RemoteCommitment.CommitFee)
+	assertCommitment(4, channel.RemoteCommitment.CommitFee)
+	assertNotRetained(5)
+
+	// Once trimmed, the oldest revoked states are no longer retained.
+	if _, err := cdb.TrimRevocationLog(op, 1); err != nil {
+		t.Fatalf("unable to trim revocation log: %v", err)
+	}
+	assertNotRetained(0)
+	assertNotRetained(1)
+	assertCommitment(2, 2)
+
+	unknown := wire.OutPoint{Hash: op.Hash, Index: op.Index + 1}
+	_, err = cdb.CommitmentAtHeight(unknown, 0)
+	if err != ErrChannelNotFound {
+		t.Fatalf("expected ErrChannelNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// sweepWorklistBucket is the top-level bucket that stores the sweeps
+	// still outstanding for each force closed channel. Each channel has
+	// its own sub-bucket keyed by its channel point, which holds an entry
+	// per sweep step keyed by its kind, followed by the outpoint it
+	// sweeps. The value is the height at which the output matures.
+	//
+	// maps: chanPoint => sweepKind || outpoint => maturityHeight
+	sweepWorklistBucket = []byte("sweep-worklist")
+
+	// ErrUnknownSweepKind is returned when adding a sweep step of an
+	// unknown kind.
+	ErrUnknownSweepKind = fmt.Errorf("unknown sweep kind")
+
+	// ErrSweepStepNotFound is returned when marking a sweep step as done
+	// that isn't outstanding for the channel.
+	ErrSweepStepNotFound = fmt.Errorf("sweep step not found")
+)
+
+// SweepKind denotes the stage of a force close a sweep step belongs to.
+type SweepKind uint8
+
+const (
+	// SweepCommitOutput is the sweep of our output on the commitment
+	// transaction.
+	SweepCommitOutput SweepKind = 0
+
+	// SweepHTLCTimeout is the sweep of an outgoing HTLC output once it
+	// has timed out.
+	SweepHTLCTimeout SweepKind = 1
+
+	// SweepHTLCSuccess is the sweep of an incoming HTLC output using its
+	// preimage.
+	SweepHTLCSuccess SweepKind = 2
+)
+
+// String returns a human readable identifier for the SweepKind type.
+func (k SweepKind) String() string {
+	switch k {
+	case SweepCommitOutput:
+		return "CommitOutput"
+	case SweepHTLCTimeout:
+		return "HTLCTimeout"
+	case SweepHTLCSuccess:
+		return "HTLCSuccess"
+	}
+
+	return "Unknown"
+}
+
+// SweepStep is a single outstanding sweep of an output of a force closed
+// channel.
+type SweepStep struct {
+	// Kind is the stage of the force close the sweep belongs to.
+	Kind SweepKind
+
+	// Output is the outpoint that's to be swept.
+	Output wire.OutPoint
+
+	// MaturityHeight is the height at which the output can be swept.
+	MaturityHeight uint32
+}
+
+// sweepStepKey returns the key a sweep step is stored under within the
+// worklist of its channel.
+func sweepStepKey(step *SweepStep) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte(byte(step.Kind))
+	if err := writeOutpoint(&b, &step.Output); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// AddSweepSteps adds the steps to the worklist of the closed channel with the
+// given channel point. Adding a step that's already outstanding updates its
+// maturity height.
+func (d *DB) AddSweepSteps(op wire.OutPoint, steps []SweepStep) error {
+	for _, step := range steps {
+		if step.Kind > SweepHTLCSuccess {
+			return ErrUnknownSweepKind
+		}
+	}
+
+	chanPoint := canonicalChannelKey(op)
+
+	return d.Update(func(tx *bbolt.Tx) error {
+		closedChanBucket := tx.Bucket(closedChannelBucket)
+		if closedChanBucket == nil ||
+			closedChanBucket.Get(chanPoint) == nil {
+
+			return ErrClosedChannelNotFound
+		}
+
+		worklists, err := tx.CreateBucketIfNotExists(
+			sweepWorklistBucket,
+		)
+		if err != nil {
+			return err
+		}
+		worklist, err := worklists.CreateBucketIfNotExists(
+			chanPoint,
+		)
+		if err != nil {
+			return err
+		}
+
+		for i := range steps {
+			stepKey, err := sweepStepKey(&steps[i])
+			if err != nil {
+				return err
+			}
+
+			var height [4]byte
+			byteOrder.PutUint32(height[:], steps[i].MaturityHeight)
+			if err := worklist.Put(stepKey, height[:]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// PendingSweepSteps returns the steps outstanding for the channel with the
+// given channel point, ordered by their maturity height. Channels without a
+// worklist, including those closed before worklists were recorded, have no
+// outstanding steps.
+func (d *DB) PendingSweepSteps(op wire.OutPoint) ([]SweepStep, error) {
+	chanPoint := canonicalChannelKey(op)
+
+	var steps []SweepStep
+	err := d.View(func(tx *bbolt.Tx) error {
+		worklists := tx.Bucket(sweepWorklistBucket)
+		if worklists == nil {
+			return nil
+		}
+		worklist := worklists.Bucket(chanPoint)
+		if worklist == nil {
+			return nil
+		}
+
+		return worklist.ForEach(func(k, v []byte) error {
+			if len(k) < 1 || len(v) != 4 {
+				return fmt.Errorf("invalid sweep step %x", k)
+			}
+
+			step := SweepStep{
+				Kind:           SweepKind(k[0]),
+				MaturityHeight: byteOrder.Uint32(v),
+			}
+			err := readOutpoint(
+				bytes.NewReader(k[1:]), &step.Output,
+			)
+			if err != nil {
+				return err
+			}
+
+			steps = append(steps, step)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].MaturityHeight < steps[j].MaturityHeight
+	})
+
+	return steps, nil
+}
+
+// MarkSweepStepDone removes the step from the worklist of the channel with
+// the given channel point. Once the last step is done, the worklist itself is
+// removed.
+func (d *DB) MarkSweepStepDone(op wire.OutPoint, step SweepStep) error {
+	chanPoint := canonicalChannelKey(op)
+	stepKey, err := sweepStepKey(&step)
+	if err != nil {
+		return err
+	}
+
+	return d.Update(func(tx *bbolt.Tx) error {
+		worklists := tx.Bucket(sweepWorklistBucket)
+		if worklists == nil {
+			return ErrSweepStepNotFound
+		}
+		worklist := worklists.Bucket(chanPoint)
+		if worklist == nil || worklist.Get(stepKey) == nil {
+			return ErrSweepStepNotFound
+		}
+
+		if err := worklist.Delete(stepKey); err != nil {
+			return err
+		}
+
+		if k, _ := worklist.Cursor().First(); k != nil {
+			return nil
+		}
+
+		return worklists.DeleteBucket(chanPoint)
+	})
+}
+
+// deleteSweepWorklist removes the worklist of the channel with the given
+// serialized channel point, if any.
+func deleteSweepWorklist(tx *bbolt.Tx, chanPoint []byte) error {
+	worklists := tx.Bucket(sweepWorklistBucket)
+	if worklists == nil {
+		return nil
+	}
+
+	err := worklists.DeleteBucket(chanPoint)
+	if err != nil && err != bbolt.ErrBucketNotFound {
+		return err
+	}
+
+	return nil
+}
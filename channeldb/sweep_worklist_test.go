@@ -0,0 +1,121 @@
+package channeldb
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestSweepWorklist asserts that the sweep steps added for a force closed
+// channel are returned until they're marked as done, and that the worklist is
+// removed once the channel is fully closed.
+func TestSweepWorklist(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	addr := &net.TCPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 18555,
+	}
+	if err := channel.SyncPending(addr, 101); err != nil {
+		t.Fatalf("unable to sync channel: %v", err)
+	}
+	chanPoint := channel.FundingOutpoint
+	output := func(index uint32) wire.OutPoint {
+		return wire.OutPoint{Hash: chanPoint.Hash, Index: index}
+	}
+
+	steps := []SweepStep{
+		{
+			Kind:           SweepHTLCTimeout,
+			Output:         output(1),
+			MaturityHeight: 300,
+		},
+		{
+			Kind:           SweepCommitOutput,
+			Output:         output(0),
+			MaturityHeight: 244,
+		},
+		{
+			Kind:           SweepHTLCSuccess,
+			Output:         output(2),
+			MaturityHeight: 250,
+		},
+	}
+
+	// Steps can only be added once the channel has been closed.
+	err = cdb.AddSweepSteps(chanPoint, steps)
+	if err != ErrClosedChannelNotFound {
+		t.Fatalf("expected ErrClosedChannelNotFound, got %v", err)
+	}
+
+	summary := &ChannelCloseSummary{
+		ChanPoint: chanPoint,
+		RemotePub: channel.IdentityPub,
+		Capacity:  channel.Capacity,
+		CloseType: LocalForceClose,
+		IsPending: true,
+	}
+	if err := channel.CloseChannel(summary); err != nil {
+		t.Fatalf("unable to close channel: %v", err)
+	}
+
+	assertSteps := func(expected []SweepStep) {
+		t.Helper()
+
+		pending, err := cdb.PendingSweepSteps(chanPoint)
+		if err != nil {
+			t.Fatalf("unable to fetch pending sweep steps: %v", err)
+		}
+		if !reflect.DeepEqual(pending, expected) {
+			t.Fatalf("expected steps %v, got %v",
+				spew.Sdump(expected), spew.Sdump(pending))
+		}
+	}
+
+	// A channel closed without any recorded steps has an empty worklist.
+	assertSteps(nil)
+
+	if err := cdb.AddSweepSteps(chanPoint, steps); err != nil {
+		t.Fatalf("unable to add sweep steps: %v", err)
+	}
+	assertSteps([]SweepStep{steps[1], steps[2], steps[0]})
+
+	// Marking a step as done should remove it from the worklist, while
+	// marking one which isn't outstanding should fail.
+	if err := cdb.MarkSweepStepDone(chanPoint, steps[1]); err != nil {
+		t.Fatalf("unable to mark sweep step done: %v", err)
+	}
+	assertSteps([]SweepStep{steps[2], steps[0]})
+
+	err = cdb.MarkSweepStepDone(chanPoint, steps[1])
+	if err != ErrSweepStepNotFound {
+		t.Fatalf("expected ErrSweepStepNotFound, got %v", err)
+	}
+
+	// Once the channel is fully closed, nothing is left to sweep.
+	if err := cdb.MarkChanFullyClosed(&chanPoint); err != nil {
+		t.Fatalf("unable to mark channel fully closed: %v", err)
+	}
+	assertSteps(nil)
+
+	// Unknown kinds of steps should be rejected.
+	err = cdb.AddSweepSteps(chanPoint, []SweepStep{{
+		Kind: SweepHTLCSuccess + 1,
+	}})
+	if err != ErrUnknownSweepKind {
+		t.Fatalf("expected ErrUnknownSweepKind, got %v", err)
+	}
+}
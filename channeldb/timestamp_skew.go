@@ -0,0 +1,431 @@
+package channeldb
+
+import (
+	"sort"
+	"time"
+
+	"github.com/coreos/bbolt"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+const (
+	// DefaultTimestampSkewWindow is the default amount of time a graph
+	// record's update time may deviate from those of the records it's
+	// compared against before it's suspected to have been stored using
+	// local time rather than UTC. It's well below the smallest offset of
+	// any time zone, while leaving room for regular clock drift between
+	// peers.
+	DefaultTimestampSkewWindow = 10 * time.Minute
+
+	// timeZoneGranularity is the granularity of all offsets between time
+	// zones and UTC.
+	timeZoneGranularity = 15 * time.Minute
+
+	// maxTimeZoneOffset is the largest offset between any time zone and
+	// UTC. A record deviating by more than that from those it's compared
+	// against wasn't skewed by its time zone, but is merely older or newer
+	// than them.
+	maxTimeZoneOffset = 14 * time.Hour
+
+	// minSkewReferences is the min number of records whose update times
+	// must agree with each other for a record to be compared against
+	// them. A single record can't tell whether it or the record compared
+	// against is the skewed one.
+	minSkewReferences = 2
+)
+
+// SkewedTimestamp describes a node announcement or channel update within the
+// graph whose update time is implausibly offset from those of related
+// records, indicating that it was stored using local time rather than UTC.
+type SkewedTimestamp struct {
+	// IsNode is true if the record is a node announcement, and false if
+	// it's a channel update.
+	IsNode bool
+
+	// NodePub is the public key of the node the announcement belongs to.
+	// This is only set if IsNode is true.
+	NodePub [33]byte
+
+	// ChannelID is the ID of the channel the update belongs to. This is
+	// only set if IsNode is false.
+	ChannelID uint64
+
+	// ChannelFlags denotes the direction of the channel update. This is
+	// only set if IsNode is false.
+	ChannelFlags lnwire.ChanUpdateChanFlags
+
+	// LastUpdate is the update time stored for the record.
+	LastUpdate time.Time
+
+	// Offset is the amount of time by which LastUpdate deviates from the
+	// update times of the related records, rounded to the granularity of
+	// time zone offsets. It's the suspected local time offset the record
+	// was stored with.
+	Offset time.Duration
+}
+
+// skewRecord is a node announcement or channel update of the graph, along with
+// the node that signed it.
+type skewRecord struct {
+	updateUnix uint64
+	isNode     bool
+	signer     [33]byte
+
+	// chanID and flags identify a channel update. They're only set if
+	// isNode is false.
+	chanID uint64
+	flags  lnwire.ChanUpdateChanFlags
+}
+
+// SkewedTimestamps returns all node announcements and channel updates whose
+// update time deviates by more than window from those of related records that
+// are independent of the graph's overall update history: the other records
+// signed by the same node, and for a channel update the update of the
+// opposite direction of the channel. A node refreshes its announcement and
+// its channel updates together, and both directions of a channel are updated
+// as the channel is announced, such that a record that was stored using local
+// time rather than UTC stands apart from them by the offset of its time zone,
+// whether it lies ahead of or behind UTC. Records deviating by more than any
+// time zone offset are merely older or newer than the related records, and
+// aren't reported. The records are merely reported, allowing an operator to
+// decide whether they should be removed using PruneSkewedTimestamps.
+func (c *ChannelGraph) SkewedTimestamps(
+	window time.Duration) ([]SkewedTimestamp, error) {
+
+	var skewed []SkewedTimestamp
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		skewed, err = findSkewedTimestamps(tx, time.Now(), window)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return skewed, nil
+}
+
+// PruneSkewedTimestamps removes each record that would be returned by
+// SkewedTimestamps from the graph, returning the number of removed records.
+// As the update time of a record is covered by its signature, it can't be
+// corrected in place. Instead, a node announcement is reverted to a shell
+// node, and a channel update is marked as unknown, such that the next
+// announcement or update received from the network is accepted in its place
+// rather than being rejected as older than the skewed record.
+func (c *ChannelGraph) PruneSkewedTimestamps(
+	window time.Duration) (int, error) {
+
+	var numPruned int
+	err := c.db.updateGraph(func(tx *bbolt.Tx) error {
+		numPruned = 0
+
+		skewed, err := findSkewedTimestamps(tx, time.Now(), window)
+		if err != nil {
+			return err
+		}
+
+		cache := c.db.updateIndexCache
+		for i := range skewed {
+			if skewed[i].IsNode {
+				err = pruneSkewedNode(tx, &skewed[i], cache)
+			} else {
+				err = pruneSkewedPolicy(tx, &skewed[i], cache)
+			}
+			if err != nil {
+				return err
+			}
+
+			numPruned++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return numPruned, nil
+}
+
+// findSkewedTimestamps compares the update time of each node announcement and
+// channel update of the graph against the median update time of its related
+// records, returning the records that deviate by more than window, ordered by
+// their update time. As no record can have been signed after now, now is used
+// in place of the median should the latter lie in the future, as well as for
+// records without enough related records to compare against.
+func findSkewedTimestamps(tx *bbolt.Tx, now time.Time,
+	window time.Duration) ([]SkewedTimestamp, error) {
+
+	records, err := fetchSkewRecords(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// We'll index the records by the node that signed them, and channel
+	// updates by their channel as well, such that the related records of
+	// each record can be found.
+	bySigner := make(map[[33]byte][]int)
+	byChannel := make(map[uint64][]int)
+	for i, record := range records {
+		bySigner[record.signer] = append(bySigner[record.signer], i)
+		if !record.isNode {
+			byChannel[record.chanID] = append(
+				byChannel[record.chanID], i,
+			)
+		}
+	}
+
+	var skewed []SkewedTimestamp
+	for i, record := range records {
+		updateTime := time.Unix(int64(record.updateUnix), 0)
+
+		var references []uint64
+		related := [][]int{bySigner[record.signer]}
+		if !record.isNode {
+			related = append(related, byChannel[record.chanID])
+		}
+		for _, indexes := range related {
+			for _, j := range indexes {
+				if j == i {
+					continue
+				}
+				references = append(
+					references, records[j].updateUnix,
+				)
+			}
+		}
+
+		// Without enough agreeing references, only an update time in
+		// the future is known to be skewed.
+		median, ok := referenceUpdateTime(references, window)
+		if !ok && !updateTime.After(now.Add(window)) {
+			continue
+		}
+		if !ok || median.After(now) {
+			median = now
+		}
+
+		offset := updateTime.Sub(median)
+		if offset <= window && offset >= -window {
+			continue
+		}
+		if ok && (offset > maxTimeZoneOffset+window ||
+			offset < -maxTimeZoneOffset-window) {
+
+			continue
+		}
+
+		s := SkewedTimestamp{
+			IsNode:       record.isNode,
+			ChannelID:    record.chanID,
+			ChannelFlags: record.flags,
+			LastUpdate:   updateTime,
+			Offset:       offset.Round(timeZoneGranularity),
+		}
+		if record.isNode {
+			s.NodePub = record.signer
+		}
+		skewed = append(skewed, s)
+	}
+
+	sort.SliceStable(skewed, func(i, j int) bool {
+		return skewed[i].LastUpdate.Before(skewed[j].LastUpdate)
+	})
+
+	return skewed, nil
+}
+
+// fetchSkewRecords returns the node announcements of the graph, as found
+// within the node update index, and all channel updates of the graph.
+func fetchSkewRecords(tx *bbolt.Tx) ([]skewRecord, error) {
+	var records []skewRecord
+
+	// Each key of the node update index is the update time followed by
+	// the node's public key, in either format of the index.
+	nodes := tx.Bucket(nodeBucket)
+	var nodeIndex *bbolt.Bucket
+	if nodes != nil {
+		nodeIndex = nodes.Bucket(nodeUpdateIndexBucket)
+	}
+	if nodeIndex != nil {
+		err := nodeIndex.ForEach(func(k, _ []byte) error {
+			unix, nodePub, err := parseNodeUpdateIndexKey(k)
+			if err != nil {
+				return err
+			}
+
+			record := skewRecord{
+				updateUnix: unix,
+				isNode:     true,
+			}
+			copy(record.signer[:], nodePub)
+			records = append(records, record)
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The channel updates are found through the edge index, which holds
+	// the public keys of the nodes signing either direction.
+	edges := tx.Bucket(edgeBucket)
+	if edges == nil {
+		return records, nil
+	}
+	edgeIndex := edges.Bucket(edgeIndexBucket)
+	if edgeIndex == nil {
+		return records, nil
+	}
+
+	err := edgeIndex.ForEach(func(chanID, edgeInfo []byte) error {
+		edge1, edge2, err := fetchChanEdgePolicies(
+			edgeIndex, edges, nodes, chanID, nil,
+		)
+		if err != nil {
+			return err
+		}
+
+		signers := [][]byte{edgeInfo[:33], edgeInfo[33:66]}
+		for i, policy := range []*ChannelEdgePolicy{edge1, edge2} {
+			if policy == nil {
+				continue
+			}
+
+			record := skewRecord{
+				updateUnix: uint64(policy.LastUpdate.Unix()),
+				chanID:     policy.ChannelID,
+				flags:      policy.ChannelFlags,
+			}
+			copy(record.signer[:], signers[i])
+			records = append(records, record)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// referenceUpdateTime returns the median of the passed update times of the
+// records related to a record. False is returned unless at least
+// minSkewReferences of them, making up the majority, lie within window of the
+// median, as the references don't agree on an update time otherwise.
+func referenceUpdateTime(references []uint64,
+	window time.Duration) (time.Time, bool) {
+
+	if len(references) < minSkewReferences {
+		return time.Time{}, false
+	}
+
+	sorted := append([]uint64(nil), references...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	mid := len(sorted) / 2
+	median := sorted[mid]
+	if len(sorted)%2 == 0 {
+		median = sorted[mid-1] + (sorted[mid]-sorted[mid-1])/2
+	}
+	medianTime := time.Unix(int64(median), 0)
+
+	var agreeing int
+	for _, unix := range sorted {
+		offset := time.Unix(int64(unix), 0).Sub(medianTime)
+		if offset <= window && offset >= -window {
+			agreeing++
+		}
+	}
+	if agreeing < minSkewReferences || 2*agreeing <= len(sorted) {
+		return time.Time{}, false
+	}
+
+	return medianTime, true
+}
+
+// pruneSkewedNode reverts the node described by the passed skewed timestamp to
+// a shell node, removing its announcement along with its entries within the
+// node update and alias indexes.
+func pruneSkewedNode(tx *bbolt.Tx, s *SkewedTimestamp,
+	cache *updateIndexCache) error {
+
+	nodes := tx.Bucket(nodeBucket)
+	if nodes == nil {
+		return ErrGraphNodesNotFound
+	}
+	aliases := nodes.Bucket(aliasIndexBucket)
+	if aliases == nil {
+		return ErrGraphNodesNotFound
+	}
+	updateIndex := nodes.Bucket(nodeUpdateIndexBucket)
+	if updateIndex == nil {
+		return ErrGraphNodesNotFound
+	}
+
+	err := deleteNodeUpdateIndexKey(
+		updateIndex, cache, uint64(s.LastUpdate.Unix()), s.NodePub[:],
+	)
+	if err != nil {
+		return err
+	}
+	if err := aliases.Delete(s.NodePub[:]); err != nil {
+		return err
+	}
+
+	shellNode := LightningNode{
+		PubKeyBytes:          s.NodePub,
+		HaveNodeAnnouncement: false,
+	}
+	return putLightningNode(nodes, aliases, updateIndex, &shellNode, cache)
+}
+
+// pruneSkewedPolicy marks the channel update described by the passed skewed
+// timestamp as unknown, removing its entry within the edge update index.
+func pruneSkewedPolicy(tx *bbolt.Tx, s *SkewedTimestamp,
+	cache *updateIndexCache) error {
+
+	edges := tx.Bucket(edgeBucket)
+	if edges == nil {
+		return ErrGraphNoEdgesFound
+	}
+	edgeIndex := edges.Bucket(edgeIndexBucket)
+	if edgeIndex == nil {
+		return ErrGraphNoEdgesFound
+	}
+	updateIndex := edges.Bucket(edgeUpdateIndexBucket)
+	if updateIndex == nil {
+		return ErrGraphNoEdgesFound
+	}
+
+	var chanID [8]byte
+	byteOrder.PutUint64(chanID[:], s.ChannelID)
+
+	nodeInfo := edgeIndex.Get(chanID[:])
+	if nodeInfo == nil {
+		return ErrEdgeNotFound
+	}
+	fromNode := nodeInfo[:33]
+	if s.ChannelFlags&lnwire.ChanUpdateDirection != 0 {
+		fromNode = nodeInfo[33:66]
+	}
+
+	var indexKey [8 + 8]byte
+	byteOrder.PutUint64(indexKey[:8], uint64(s.LastUpdate.Unix()))
+	copy(indexKey[8:], chanID[:])
+
+	if err := updateIndex.Delete(indexKey[:]); err != nil {
+		return err
+	}
+	cache.stageDelete(edgeUpdateIndexKind, indexKey[:])
+
+	var edgeKey [33 + 8]byte
+	copy(edgeKey[:], fromNode)
+	copy(edgeKey[33:], chanID[:])
+
+	return edges.Put(edgeKey[:], unknownPolicy)
+}
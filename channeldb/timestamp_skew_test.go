@@ -0,0 +1,245 @@
+package channeldb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// populateSkewedGraph adds a number of nodes and channels to the graph. Each
+// node signs its announcement and its channel updates within a few minutes of
+// each other, while the nodes do so hours apart. The announcement of one node
+// is given an update time that lies offset ahead of the node's other records,
+// and the update of one channel an update time that lies offset behind those
+// of its signer. Both land in the midst of the records of other nodes. The
+// graph also holds a node whose records are all a month old, and an update
+// that's two days older than the other records of its signer, neither of
+// which is skewed.
+func populateSkewedGraph(t *testing.T, db *DB,
+	offset time.Duration) (*LightningNode, *ChannelEdgePolicy) {
+
+	t.Helper()
+
+	graph := db.ChannelGraph()
+	now := time.Unix(time.Now().Unix(), 0)
+
+	// The first node's records are a month old, while the remaining
+	// nodes sign theirs three hours apart.
+	const numNodes = 6
+	var (
+		nodes      []*LightningNode
+		updateTime = make(map[[33]byte]time.Time)
+	)
+	for i := 0; i < numNodes; i++ {
+		node, err := createTestVertex(db)
+		if err != nil {
+			t.Fatalf("unable to create test node: %v", err)
+		}
+
+		node.LastUpdate = now.Add(-30 * 24 * time.Hour)
+		if i > 0 {
+			node.LastUpdate = now.Add(
+				time.Duration(i*3-20) * time.Hour,
+			)
+		}
+		updateTime[node.PubKeyBytes] = node.LastUpdate
+
+		nodes = append(nodes, node)
+	}
+
+	// Each following record a node signs lies a minute after its
+	// previous one.
+	nextUpdate := func(node *LightningNode) time.Time {
+		next := updateTime[node.PubKeyBytes].Add(time.Minute)
+		updateTime[node.PubKeyBytes] = next
+		return next
+	}
+
+	// The announcement of the third node is skewed ahead, landing among
+	// the records of the fourth node.
+	skewedNode := nodes[2]
+	skewedNode.LastUpdate = skewedNode.LastUpdate.Add(offset)
+	for _, node := range nodes {
+		if err := graph.AddLightningNode(node); err != nil {
+			t.Fatalf("unable to add node: %v", err)
+		}
+	}
+
+	addChannel := func(node1, node2 *LightningNode) (*ChannelEdgePolicy,
+		*ChannelEdgePolicy) {
+
+		edgeInfo, edge1, edge2 := createChannelEdge(db, node1, node2)
+		if err := graph.AddChannelEdge(edgeInfo); err != nil {
+			t.Fatalf("unable to add edge: %v", err)
+		}
+
+		// The policy a node signs is the one leading to the other
+		// node.
+		if edge1.Node.PubKeyBytes == node1.PubKeyBytes {
+			edge1, edge2 = edge2, edge1
+		}
+		edge1.LastUpdate = nextUpdate(node1)
+		edge2.LastUpdate = nextUpdate(node2)
+
+		return edge1, edge2
+	}
+
+	var policies []*ChannelEdgePolicy
+	for i := 1; i < numNodes; i++ {
+		for j := i + 1; j < numNodes; j++ {
+			policy1, policy2 := addChannel(nodes[i], nodes[j])
+			policies = append(policies, policy1, policy2)
+		}
+	}
+	for _, node := range nodes[1:3] {
+		policy1, policy2 := addChannel(nodes[0], node)
+		policies = append(policies, policy1, policy2)
+	}
+
+	// The update the fourth node signed for its channel with the second
+	// node is skewed behind, landing among the records of the third node.
+	// The update the last node signed for its channel with the second
+	// node is merely old.
+	skewedPolicy := policies[3]
+	skewedPolicy.LastUpdate = skewedPolicy.LastUpdate.Add(-offset)
+	oldPolicy := policies[7]
+	oldPolicy.LastUpdate = oldPolicy.LastUpdate.Add(-48 * time.Hour)
+
+	for _, policy := range policies {
+		if err := graph.UpdateEdgePolicy(policy); err != nil {
+			t.Fatalf("unable to update edge: %v", err)
+		}
+	}
+
+	return skewedNode, skewedPolicy
+}
+
+// TestSkewedTimestamps asserts that graph records with update times offset
+// from those of their related records in either direction are reported, even
+// if they lie amid the records of other nodes, and that pruning them leaves
+// the remaining records untouched.
+func TestSkewedTimestamps(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	if err := db.EnableUpdateIndexCache(100); err != nil {
+		t.Fatalf("unable to enable update index cache: %v", err)
+	}
+	graph := db.ChannelGraph()
+
+	const offset = 3 * time.Hour
+	skewedNode, skewedPolicy := populateSkewedGraph(t, db, offset)
+
+	skewed, err := graph.SkewedTimestamps(DefaultTimestampSkewWindow)
+	if err != nil {
+		t.Fatalf("unable to find skewed timestamps: %v", err)
+	}
+	if len(skewed) != 2 {
+		t.Fatalf("expected 2 skewed timestamps, got %v",
+			spew.Sdump(skewed))
+	}
+
+	// The records are reported in the order of their update times, such
+	// that the channel update lagging behind its signer's records comes
+	// first.
+	edgeSkew, nodeSkew := skewed[0], skewed[1]
+	if edgeSkew.IsNode || edgeSkew.ChannelID != skewedPolicy.ChannelID ||
+		edgeSkew.ChannelFlags != skewedPolicy.ChannelFlags ||
+		!edgeSkew.LastUpdate.Equal(skewedPolicy.LastUpdate) ||
+		edgeSkew.Offset != -offset {
+
+		t.Fatalf("unexpected edge skew: %v", spew.Sdump(edgeSkew))
+	}
+	if !nodeSkew.IsNode || nodeSkew.NodePub != skewedNode.PubKeyBytes ||
+		!nodeSkew.LastUpdate.Equal(skewedNode.LastUpdate) ||
+		nodeSkew.Offset != offset {
+
+		t.Fatalf("unexpected node skew: %v", spew.Sdump(nodeSkew))
+	}
+
+	// We'll now prune both records, after which none should remain.
+	numPruned, err := graph.PruneSkewedTimestamps(
+		DefaultTimestampSkewWindow,
+	)
+	if err != nil {
+		t.Fatalf("unable to prune skewed timestamps: %v", err)
+	}
+	if numPruned != 2 {
+		t.Fatalf("expected 2 pruned records, got %v", numPruned)
+	}
+
+	skewed, err = graph.SkewedTimestamps(DefaultTimestampSkewWindow)
+	if err != nil {
+		t.Fatalf("unable to find skewed timestamps: %v", err)
+	}
+	if len(skewed) != 0 {
+		t.Fatalf("expected no skewed timestamps, got %v",
+			spew.Sdump(skewed))
+	}
+
+	// The node should have been reverted to a shell node, and the channel
+	// update marked as unknown, while the opposite update is retained.
+	pub, err := skewedNode.PubKey()
+	if err != nil {
+		t.Fatalf("unable to parse pubkey: %v", err)
+	}
+	node, err := graph.FetchLightningNode(pub)
+	if err != nil {
+		t.Fatalf("unable to fetch node: %v", err)
+	}
+	if node.HaveNodeAnnouncement {
+		t.Fatalf("expected node announcement to be pruned")
+	}
+
+	_, policy1, policy2, err := graph.FetchChannelEdgesByID(
+		skewedPolicy.ChannelID,
+	)
+	if err != nil {
+		t.Fatalf("unable to fetch edge: %v", err)
+	}
+	if skewedPolicy.ChannelFlags&lnwire.ChanUpdateDirection != 0 {
+		policy1, policy2 = policy2, policy1
+	}
+	if policy1 != nil {
+		t.Fatalf("expected channel update to be pruned, got %v",
+			spew.Sdump(policy1))
+	}
+	if policy2 == nil {
+		t.Fatalf("expected opposite channel update to be retained")
+	}
+
+	assertUpdateIndexMirror(t, db)
+}
+
+// TestSkewedTimestampsOldRecords asserts that graph records that are merely
+// older than the records of other nodes, or than the other records of their
+// signer, aren't reported as skewed.
+func TestSkewedTimestampsOldRecords(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	graph := db.ChannelGraph()
+
+	// Without an offset, the graph only holds old records besides the
+	// current ones.
+	populateSkewedGraph(t, db, 0)
+
+	skewed, err := graph.SkewedTimestamps(DefaultTimestampSkewWindow)
+	if err != nil {
+		t.Fatalf("unable to find skewed timestamps: %v", err)
+	}
+	if len(skewed) != 0 {
+		t.Fatalf("expected no skewed timestamps, got %v",
+			spew.Sdump(skewed))
+	}
+}
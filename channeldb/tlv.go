@@ -0,0 +1,119 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// CustomTypeStart is the smallest record type that may be used for
+	// custom, application specific records. All types below this value are
+	// reserved for records that are interpreted by the database itself.
+	CustomTypeStart uint64 = 65536
+
+	// maxTLVStreamSize is the maximum size of a single serialized TLV
+	// stream that we'll read from disk.
+	maxTLVStreamSize = 1 << 20
+)
+
+// writeTLVStream writes the passed set of records to w as a length prefixed
+// TLV stream. Each record is encoded as a var int type, followed by a var int
+// length and the raw value. Records are always written in canonical order,
+// meaning strictly ascending by type.
+func writeTLVStream(w io.Writer, records map[uint64][]byte) error {
+	types := make([]uint64, 0, len(records))
+	for typ := range records {
+		types = append(types, typ)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i] < types[j]
+	})
+
+	var b bytes.Buffer
+	for _, typ := range types {
+		value := records[typ]
+
+		if err := wire.WriteVarInt(&b, 0, typ); err != nil {
+			return err
+		}
+		err := wire.WriteVarBytes(&b, 0, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	if b.Len() > maxTLVStreamSize {
+		return fmt.Errorf("tlv stream of %v bytes exceeds max size of "+
+			"%v bytes", b.Len(), maxTLVStreamSize)
+	}
+
+	return wire.WriteVarBytes(w, 0, b.Bytes())
+}
+
+// readTLVStream reads a length prefixed TLV stream as written by
+// writeTLVStream. An error is returned if the records within the stream aren't
+// in canonical order, or if a record type appears more than once.
+func readTLVStream(r io.Reader) (map[uint64][]byte, error) {
+	stream, err := wire.ReadVarBytes(r, 0, maxTLVStreamSize, "tlv")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		streamReader = bytes.NewReader(stream)
+		records      = make(map[uint64][]byte)
+		prevType     uint64
+	)
+	for streamReader.Len() > 0 {
+		typ, err := wire.ReadVarInt(streamReader, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		// Ensure that the types are strictly increasing, which also
+		// guarantees that no type is present twice.
+		if len(records) > 0 {
+			switch {
+			case typ == prevType:
+				return nil, ErrTLVDuplicateType
+			case typ < prevType:
+				return nil, ErrTLVOutOfOrder
+			}
+		}
+		prevType = typ
+
+		length, err := wire.ReadVarInt(streamReader, 0)
+		if err != nil {
+			return nil, err
+		}
+		if length > uint64(streamReader.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		value := make([]byte, length)
+		if _, err := io.ReadFull(streamReader, value); err != nil {
+			return nil, err
+		}
+		records[typ] = value
+	}
+
+	return records, nil
+}
+
+// validateCustomRecords ensures that all types within the passed set of
+// custom records are in the range reserved for custom records.
+func validateCustomRecords(records map[uint64][]byte) error {
+	for typ := range records {
+		if typ < CustomTypeStart {
+			return fmt.Errorf("custom record type %v is below the "+
+				"custom type range starting at %v", typ,
+				CustomTypeStart)
+		}
+	}
+
+	return nil
+}
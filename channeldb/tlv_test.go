@@ -0,0 +1,99 @@
+package channeldb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestTLVStreamRoundTrip asserts that a set of records written as a TLV
+// stream is read back unaltered.
+func TestTLVStreamRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	records := map[uint64][]byte{
+		CustomTypeStart + 10: []byte("order"),
+		1:                    {},
+		CustomTypeStart:      bytes.Repeat([]byte{0xaa}, 300),
+		0xffffffffffffffff:   []byte("max"),
+	}
+
+	var b bytes.Buffer
+	if err := writeTLVStream(&b, records); err != nil {
+		t.Fatalf("unable to write stream: %v", err)
+	}
+
+	readRecords, err := readTLVStream(&b)
+	if err != nil {
+		t.Fatalf("unable to read stream: %v", err)
+	}
+	if !reflect.DeepEqual(records, readRecords) {
+		t.Fatalf("records mismatch: expected %v, got %v",
+			spew.Sdump(records), spew.Sdump(readRecords))
+	}
+}
+
+// TestTLVStreamCanonical asserts that streams with records that aren't in
+// strictly ascending order are rejected.
+func TestTLVStreamCanonical(t *testing.T) {
+	t.Parallel()
+
+	// encodeStream serializes the records in the exact order given,
+	// bypassing the sorting done by writeTLVStream.
+	encodeStream := func(types ...uint64) []byte {
+		var stream, b bytes.Buffer
+		for _, typ := range types {
+			if err := wire.WriteVarInt(&stream, 0, typ); err != nil {
+				t.Fatalf("unable to write type: %v", err)
+			}
+			err := wire.WriteVarBytes(&stream, 0, []byte{0x01})
+			if err != nil {
+				t.Fatalf("unable to write value: %v", err)
+			}
+		}
+		err := wire.WriteVarBytes(&b, 0, stream.Bytes())
+		if err != nil {
+			t.Fatalf("unable to write stream: %v", err)
+		}
+
+		return b.Bytes()
+	}
+
+	tests := []struct {
+		name  string
+		types []uint64
+		err   error
+	}{
+		{
+			name:  "sorted",
+			types: []uint64{0, 5, CustomTypeStart},
+		},
+		{
+			name:  "out of order",
+			types: []uint64{CustomTypeStart + 1, CustomTypeStart},
+			err:   ErrTLVOutOfOrder,
+		},
+		{
+			name:  "duplicate",
+			types: []uint64{CustomTypeStart, CustomTypeStart},
+			err:   ErrTLVDuplicateType,
+		},
+		{
+			name:  "duplicate zero",
+			types: []uint64{0, 0},
+			err:   ErrTLVDuplicateType,
+		},
+	}
+
+	for _, test := range tests {
+		stream := encodeStream(test.types...)
+		_, err := readTLVStream(bytes.NewReader(stream))
+		if err != test.err {
+			t.Fatalf("%v: expected error %v, got %v", test.name,
+				test.err, err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package channeldb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// ttlBucket is the top-level bucket that stores values which expire
+	// after a time to live. Each caller chooses the name of its own
+	// sub-bucket, within which every value is prefixed by the time it
+	// expires at.
+	//
+	// maps: bucket => key => expiry || value
+	ttlBucket = []byte("ttl-cache")
+
+	// ErrTTLEntryNotFound is returned when a value stored with a time to
+	// live doesn't exist, or has expired.
+	ErrTTLEntryNotFound = fmt.Errorf("ttl entry not found")
+
+	// ErrInvalidTTL is returned when storing a value with a time to live
+	// that isn't positive.
+	ErrInvalidTTL = fmt.Errorf("ttl must be positive")
+)
+
+// PutWithTTL stores the value under the key within the named bucket, from
+// where it's returned by GetWithTTL until the ttl has passed. Storing a value
+// under an existing key replaces it along with its expiry.
+func (d *DB) PutWithTTL(bucket, key, val []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+
+	expiry := time.Now().Add(ttl)
+	return d.Update(func(tx *bbolt.Tx) error {
+		return putTTLEntry(tx, bucket, key, val, expiry)
+	})
+}
+
+// putTTLEntry stores the value under the key within the named bucket, such
+// that it expires at the passed time.
+func putTTLEntry(tx *bbolt.Tx, bucket, key, val []byte,
+	expiry time.Time) error {
+
+	ttls, err := tx.CreateBucketIfNotExists(ttlBucket)
+	if err != nil {
+		return err
+	}
+	entries, err := ttls.CreateBucketIfNotExists(bucket)
+	if err != nil {
+		return err
+	}
+
+	entry := make([]byte, 8+len(val))
+	byteOrder.PutUint64(entry[:8], uint64(expiry.UnixNano()))
+	copy(entry[8:], val)
+
+	return entries.Put(key, entry)
+}
+
+// GetWithTTL returns the value stored under the key within the named bucket.
+// If the value has expired, it's deleted and ErrTTLEntryNotFound is returned,
+// just as for keys that don't exist.
+func (d *DB) GetWithTTL(bucket, key []byte) ([]byte, error) {
+	var (
+		val     []byte
+		expired bool
+		now     = time.Now()
+	)
+	err := d.View(func(tx *bbolt.Tx) error {
+		entry, err := fetchTTLEntry(tx, bucket, key)
+		if err != nil {
+			return err
+		}
+
+		if ttlEntryExpired(entry, now) {
+			expired = true
+			return ErrTTLEntryNotFound
+		}
+		val = append([]byte(nil), entry[8:]...)
+
+		return nil
+	})
+	if !expired {
+		if err != nil {
+			return nil, err
+		}
+
+		return val, nil
+	}
+
+	// As reads can't delete, we'll remove the expired value within its
+	// own transaction, unless it was replaced in the meantime.
+	err = d.Update(func(tx *bbolt.Tx) error {
+		entry, err := fetchTTLEntry(tx, bucket, key)
+		if err != nil || !ttlEntryExpired(entry, now) {
+			return nil
+		}
+
+		return tx.Bucket(ttlBucket).Bucket(bucket).Delete(key)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, ErrTTLEntryNotFound
+}
+
+// fetchTTLEntry returns the raw entry stored under the key within the named
+// bucket, including its expiry.
+func fetchTTLEntry(tx *bbolt.Tx, bucket, key []byte) ([]byte, error) {
+	ttls := tx.Bucket(ttlBucket)
+	if ttls == nil {
+		return nil, ErrTTLEntryNotFound
+	}
+	entries := ttls.Bucket(bucket)
+	if entries == nil {
+		return nil, ErrTTLEntryNotFound
+	}
+
+	entry := entries.Get(key)
+	if entry == nil {
+		return nil, ErrTTLEntryNotFound
+	}
+	if len(entry) < 8 {
+		return nil, fmt.Errorf("invalid ttl entry %x", key)
+	}
+
+	return entry, nil
+}
+
+// ttlEntryExpired returns true if the raw entry expired at or before now.
+func ttlEntryExpired(entry []byte, now time.Time) bool {
+	return int64(byteOrder.Uint64(entry[:8])) <= now.UnixNano()
+}
+
+// ReapExpired deletes all values stored with a time to live that have
+// expired, across all buckets, and returns the number of values deleted.
+// Buckets left empty are removed as well.
+func (d *DB) ReapExpired() (int, error) {
+	return d.reapExpired(time.Now())
+}
+
+// reapExpired deletes all values stored with a time to live that expired at or
+// before now.
+func (d *DB) reapExpired(now time.Time) (int, error) {
+	var numReaped int
+	err := d.Update(func(tx *bbolt.Tx) error {
+		numReaped = 0
+
+		ttls := tx.Bucket(ttlBucket)
+		if ttls == nil {
+			return nil
+		}
+
+		var buckets [][]byte
+		err := ttls.ForEach(func(bucket, v []byte) error {
+			if v == nil {
+				bucket = append([]byte(nil), bucket...)
+				buckets = append(buckets, bucket)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, bucket := range buckets {
+			entries := ttls.Bucket(bucket)
+
+			var expired [][]byte
+			err := entries.ForEach(func(key, entry []byte) error {
+				if entry != nil && len(entry) >= 8 &&
+					ttlEntryExpired(entry, now) {
+
+					key = append([]byte(nil), key...)
+					expired = append(expired, key)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, key := range expired {
+				if err := entries.Delete(key); err != nil {
+					return err
+				}
+			}
+			numReaped += len(expired)
+
+			if k, _ := entries.Cursor().First(); k != nil {
+				continue
+			}
+			if err := ttls.DeleteBucket(bucket); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return numReaped, nil
+}
@@ -0,0 +1,127 @@
+package channeldb
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+// TestTTLCache asserts that values stored with a time to live are returned
+// until they expire, after which they're deleted on read or by reaping.
+func TestTTLCache(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+
+	var (
+		routes = []byte("routes")
+		fees   = []byte("fees")
+	)
+
+	_, err = db.GetWithTTL(routes, []byte("a"))
+	if err != ErrTTLEntryNotFound {
+		t.Fatalf("expected ErrTTLEntryNotFound, got %v", err)
+	}
+
+	err = db.PutWithTTL(routes, []byte("a"), []byte("route"), time.Hour)
+	if err != nil {
+		t.Fatalf("unable to put value: %v", err)
+	}
+	val, err := db.GetWithTTL(routes, []byte("a"))
+	if err != nil {
+		t.Fatalf("unable to get value: %v", err)
+	}
+	if !bytes.Equal(val, []byte("route")) {
+		t.Fatalf("expected value %q, got %q", "route", val)
+	}
+
+	// Values are kept apart by the bucket they're stored within.
+	_, err = db.GetWithTTL(fees, []byte("a"))
+	if err != ErrTTLEntryNotFound {
+		t.Fatalf("expected ErrTTLEntryNotFound, got %v", err)
+	}
+
+	// We'll now store a few values that have already expired.
+	past := time.Now().Add(-time.Minute)
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, entry := range []struct {
+			bucket, key []byte
+		}{
+			{routes, []byte("b")},
+			{fees, []byte("a")},
+			{fees, []byte("b")},
+		} {
+			err := putTTLEntry(
+				tx, entry.bucket, entry.key, []byte("old"),
+				past,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to put expired values: %v", err)
+	}
+
+	// Reading an expired value should report it as absent, and delete it
+	// along the way.
+	_, err = db.GetWithTTL(routes, []byte("b"))
+	if err != ErrTTLEntryNotFound {
+		t.Fatalf("expected ErrTTLEntryNotFound, got %v", err)
+	}
+	err = db.View(func(tx *bbolt.Tx) error {
+		entry := tx.Bucket(ttlBucket).Bucket(routes).Get([]byte("b"))
+		if entry != nil {
+			t.Fatalf("expected expired value to be deleted")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to read values: %v", err)
+	}
+
+	// Reaping should delete the remaining expired values, and the bucket
+	// they were the only values of, while keeping the live one.
+	numReaped, err := db.ReapExpired()
+	if err != nil {
+		t.Fatalf("unable to reap expired values: %v", err)
+	}
+	if numReaped != 2 {
+		t.Fatalf("expected 2 reaped values, got %v", numReaped)
+	}
+	err = db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket(ttlBucket).Bucket(fees) != nil {
+			t.Fatalf("expected empty bucket to be removed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to read values: %v", err)
+	}
+	if _, err := db.GetWithTTL(routes, []byte("a")); err != nil {
+		t.Fatalf("unable to get value: %v", err)
+	}
+
+	// Once its ttl has passed, the live value should be reaped as well.
+	numReaped, err = db.reapExpired(time.Now().Add(2 * time.Hour))
+	if err != nil {
+		t.Fatalf("unable to reap expired values: %v", err)
+	}
+	if numReaped != 1 {
+		t.Fatalf("expected 1 reaped value, got %v", numReaped)
+	}
+
+	err = db.PutWithTTL(routes, []byte("a"), []byte("route"), 0)
+	if err != ErrInvalidTTL {
+		t.Fatalf("expected ErrInvalidTTL, got %v", err)
+	}
+}
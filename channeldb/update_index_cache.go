@@ -0,0 +1,329 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/coreos/bbolt"
+)
+
+// updateIndexKind denotes which of the graph's update indexes an entry
+// belongs to.
+type updateIndexKind uint8
+
+const (
+	// nodeUpdateIndexKind denotes the index of node announcement update
+	// times, keyed by updateTime || nodePub.
+	nodeUpdateIndexKind updateIndexKind = iota
+
+	// edgeUpdateIndexKind denotes the index of channel update times,
+	// keyed by updateTime || chanID.
+	edgeUpdateIndexKind
+)
+
+// sortedKeySet is a set of keys which are kept in lexicographical order,
+// allowing range queries to be resolved with a binary search.
+type sortedKeySet struct {
+	keys []string
+}
+
+// insert adds the key to the set if it isn't already present.
+func (s *sortedKeySet) insert(key string) {
+	i := sort.SearchStrings(s.keys, key)
+	if i < len(s.keys) && s.keys[i] == key {
+		return
+	}
+
+	s.keys = append(s.keys, "")
+	copy(s.keys[i+1:], s.keys[i:])
+	s.keys[i] = key
+}
+
+// remove deletes the key from the set if present.
+func (s *sortedKeySet) remove(key string) {
+	i := sort.SearchStrings(s.keys, key)
+	if i == len(s.keys) || s.keys[i] != key {
+		return
+	}
+
+	s.keys = append(s.keys[:i], s.keys[i+1:]...)
+}
+
+// keysInRange returns all keys k of the set, such that start <= k <= end.
+func (s *sortedKeySet) keysInRange(start, end []byte) []string {
+	from := sort.SearchStrings(s.keys, string(start))
+	to := from
+	for to < len(s.keys) && s.keys[to] <= string(end) {
+		to++
+	}
+
+	return s.keys[from:to]
+}
+
+// updateIndexOp is a single staged mutation of one of the update indexes.
+type updateIndexOp struct {
+	kind   updateIndexKind
+	key    string
+	delete bool
+}
+
+// updateIndexCache is an in-memory mirror of the keys within the node and
+// edge update indexes. It allows the horizon queries used when serving gossip
+// syncs to locate the entries within a time range without touching disk. Only
+// the small index keys are mirrored, the records themselves are still read
+// from the database.
+//
+// All writes to the update indexes must go through DB.updateGraph for the
+// mirror to remain consistent with the on-disk state. Mutations performed by
+// a transaction are staged while it executes, and only applied to the mirror
+// once the transaction has committed. The write lock is held throughout, such
+// that readers always observe a mirror which matches the database.
+type updateIndexCache struct {
+	// mu guards the mirrored indexes as well as the staged operations.
+	mu sync.RWMutex
+
+	nodes sortedKeySet
+	edges sortedKeySet
+
+	// pending are the operations staged by the write transaction that is
+	// currently being executed.
+	pending []updateIndexOp
+
+	// reset is set if the transaction currently being executed wiped the
+	// graph, in which case the mirror is cleared before applying pending.
+	reset bool
+
+	// maxEntries is the maximum number of keys the mirror may hold across
+	// both indexes. Once exceeded, the mirror is disabled and all queries
+	// fall back to the on-disk indexes.
+	maxEntries int
+
+	// disabled is set once the mirror has outgrown maxEntries.
+	disabled bool
+}
+
+// EnableUpdateIndexCache builds an in-memory mirror of the node and edge
+// update indexes from disk, allowing subsequent horizon queries to be served
+// from memory. The mirror is bounded by maxEntries, the total number of index
+// keys it may hold. If the mirror grows beyond this limit, it's dropped and
+// all queries are once again served from disk.
+//
+// NOTE: This method should be called at startup, before the database is used
+// concurrently.
+func (d *DB) EnableUpdateIndexCache(maxEntries int) error {
+	cache := &updateIndexCache{
+		maxEntries: maxEntries,
+	}
+
+	err := d.View(func(tx *bbolt.Tx) error {
+		if nodes := tx.Bucket(nodeBucket); nodes != nil {
+			index := nodes.Bucket(nodeUpdateIndexBucket)
+			if index != nil {
+				err := index.ForEach(func(k, _ []byte) error {
+					cache.nodes.keys = append(
+						cache.nodes.keys, string(k),
+					)
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if edges := tx.Bucket(edgeBucket); edges != nil {
+			index := edges.Bucket(edgeUpdateIndexBucket)
+			if index != nil {
+				err := index.ForEach(func(k, _ []byte) error {
+					cache.edges.keys = append(
+						cache.edges.keys, string(k),
+					)
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if cache.size() > maxEntries {
+		return fmt.Errorf("update indexes hold %v entries, exceeding "+
+			"the max of %v", cache.size(), maxEntries)
+	}
+
+	d.updateIndexCache = cache
+
+	return nil
+}
+
+// size returns the total number of keys held by the mirror.
+func (u *updateIndexCache) size() int {
+	return len(u.nodes.keys) + len(u.edges.keys)
+}
+
+// index returns the mirrored set of keys for the given index, or nil if the
+// mirror isn't available.
+func (u *updateIndexCache) index(kind updateIndexKind) *sortedKeySet {
+	if u == nil || u.disabled {
+		return nil
+	}
+
+	switch kind {
+	case nodeUpdateIndexKind:
+		return &u.nodes
+	default:
+		return &u.edges
+	}
+}
+
+// stagePut records the addition of key to the given index by the transaction
+// currently being executed. It's safe to call on a nil cache.
+func (u *updateIndexCache) stagePut(kind updateIndexKind, key []byte) {
+	if u == nil {
+		return
+	}
+
+	u.pending = append(u.pending, updateIndexOp{
+		kind: kind,
+		key:  string(key),
+	})
+}
+
+// stageDelete records the removal of key from the given index by the
+// transaction currently being executed. It's safe to call on a nil cache.
+func (u *updateIndexCache) stageDelete(kind updateIndexKind, key []byte) {
+	if u == nil {
+		return
+	}
+
+	u.pending = append(u.pending, updateIndexOp{
+		kind:   kind,
+		key:    string(key),
+		delete: true,
+	})
+}
+
+// stageReset records that the transaction currently being executed removes
+// both update indexes entirely. It's safe to call on a nil cache.
+func (u *updateIndexCache) stageReset() {
+	if u == nil {
+		return
+	}
+
+	u.reset = true
+	u.pending = u.pending[:0]
+}
+
+// applyPending applies all staged operations to the mirror. This must only be
+// called once the transaction that staged them has been committed.
+func (u *updateIndexCache) applyPending() {
+	defer u.discardPending()
+
+	if u.disabled {
+		return
+	}
+
+	if u.reset {
+		u.nodes.keys = nil
+		u.edges.keys = nil
+	}
+
+	for _, op := range u.pending {
+		set := u.index(op.kind)
+		if op.delete {
+			set.remove(op.key)
+		} else {
+			set.insert(op.key)
+		}
+	}
+
+	if u.size() > u.maxEntries {
+		log.Warnf("Update index cache exceeded its max of %v "+
+			"entries, falling back to disk", u.maxEntries)
+
+		u.disabled = true
+		u.nodes.keys = nil
+		u.edges.keys = nil
+	}
+}
+
+// discardPending drops all staged operations.
+func (u *updateIndexCache) discardPending() {
+	u.pending = u.pending[:0]
+	u.reset = false
+}
+
+// updateGraph executes fn within a read-write transaction. If the update index
+// cache is enabled, the staged index mutations are applied to it once the
+// transaction commits. All write transactions that may touch the update
+// indexes should be executed through this method.
+func (d *DB) updateGraph(fn func(tx *bbolt.Tx) error) error {
+	cache := d.updateIndexCache
+	if cache == nil {
+		return d.Update(fn)
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if err := d.Update(fn); err != nil {
+		cache.discardPending()
+		return err
+	}
+
+	cache.applyPending()
+
+	return nil
+}
+
+// viewUpdateIndex executes fn within a read-only transaction. If the update
+// index cache is enabled, its read lock is held while fn executes, ensuring
+// the mirrored keys handed to fn match the state of the transaction.
+func (d *DB) viewUpdateIndex(fn func(tx *bbolt.Tx) error) error {
+	if cache := d.updateIndexCache; cache != nil {
+		cache.mu.RLock()
+		defer cache.mu.RUnlock()
+	}
+
+	return d.View(fn)
+}
+
+// forEachUpdateIndexKey invokes cb for each key k within the given update
+// index such that start <= k <= end, in ascending order. The keys are served
+// from the in-memory mirror if available, otherwise the on-disk index is
+// scanned.
+//
+// NOTE: This must be called from within a transaction created by
+// viewUpdateIndex or updateGraph.
+func (d *DB) forEachUpdateIndexKey(index *bbolt.Bucket, kind updateIndexKind,
+	start, end []byte, cb func(key []byte) error) error {
+
+	if set := d.updateIndexCache.index(kind); set != nil {
+		for _, key := range set.keysInRange(start, end) {
+			if err := cb([]byte(key)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	cursor := index.Cursor()
+	for k, _ := cursor.Seek(start); k != nil &&
+		bytes.Compare(k, end) <= 0; k, _ = cursor.Next() {
+
+		if err := cb(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,290 @@
+package channeldb
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+// assertUpdateIndexMirror asserts that the keys held by the update index
+// cache match those within the on-disk update indexes.
+func assertUpdateIndexMirror(t *testing.T, db *DB) {
+	t.Helper()
+
+	var nodeKeys, edgeKeys []string
+	err := db.View(func(tx *bbolt.Tx) error {
+		nodeIndex := tx.Bucket(nodeBucket).Bucket(nodeUpdateIndexBucket)
+		err := nodeIndex.ForEach(func(k, _ []byte) error {
+			nodeKeys = append(nodeKeys, string(k))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		edgeIndex := tx.Bucket(edgeBucket).Bucket(edgeUpdateIndexBucket)
+		return edgeIndex.ForEach(func(k, _ []byte) error {
+			edgeKeys = append(edgeKeys, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("unable to read update indexes: %v", err)
+	}
+
+	cache := db.updateIndexCache
+	if len(cache.nodes.keys) != 0 || len(nodeKeys) != 0 {
+		if !reflect.DeepEqual(cache.nodes.keys, nodeKeys) {
+			t.Fatalf("node update index mismatch: expected %v "+
+				"keys, mirror has %v", len(nodeKeys),
+				len(cache.nodes.keys))
+		}
+	}
+	if len(cache.edges.keys) != 0 || len(edgeKeys) != 0 {
+		if !reflect.DeepEqual(cache.edges.keys, edgeKeys) {
+			t.Fatalf("edge update index mismatch: expected %v "+
+				"keys, mirror has %v", len(edgeKeys),
+				len(cache.edges.keys))
+		}
+	}
+}
+
+// TestUpdateIndexCache asserts that the in-memory mirror of the update indexes
+// is kept in sync with the database as nodes and edges are added, updated and
+// removed, and that the horizon queries return identical results whether or
+// not they're served from the mirror.
+func TestUpdateIndexCache(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	graph := db.ChannelGraph()
+
+	// We'll add a few nodes before enabling the cache, to ensure the
+	// mirror is properly built from the existing index.
+	const numNodes = 6
+	nodes := make([]*LightningNode, 0, numNodes)
+	for i := 0; i < numNodes/2; i++ {
+		node, err := createTestVertex(db)
+		if err != nil {
+			t.Fatalf("unable to create test node: %v", err)
+		}
+		node.LastUpdate = time.Unix(int64(1000+i), 0)
+		if err := graph.AddLightningNode(node); err != nil {
+			t.Fatalf("unable to add node: %v", err)
+		}
+		nodes = append(nodes, node)
+	}
+
+	if err := db.EnableUpdateIndexCache(1000); err != nil {
+		t.Fatalf("unable to enable update index cache: %v", err)
+	}
+	assertUpdateIndexMirror(t, db)
+
+	for i := numNodes / 2; i < numNodes; i++ {
+		node, err := createTestVertex(db)
+		if err != nil {
+			t.Fatalf("unable to create test node: %v", err)
+		}
+		node.LastUpdate = time.Unix(int64(1000+i), 0)
+		if err := graph.AddLightningNode(node); err != nil {
+			t.Fatalf("unable to add node: %v", err)
+		}
+		nodes = append(nodes, node)
+	}
+	assertUpdateIndexMirror(t, db)
+
+	// Next, connect each pair of consecutive nodes with a channel, and
+	// add both of its policies.
+	var edges []*ChannelEdgeInfo
+	for i := 0; i < numNodes-1; i++ {
+		edgeInfo, edge1, edge2 := createChannelEdge(
+			db, nodes[i], nodes[i+1],
+		)
+		edgeInfo.ChannelPoint.Index = uint32(i)
+
+		if err := graph.AddChannelEdge(edgeInfo); err != nil {
+			t.Fatalf("unable to add edge: %v", err)
+		}
+		if err := graph.UpdateEdgePolicy(edge1); err != nil {
+			t.Fatalf("unable to update edge: %v", err)
+		}
+		if err := graph.UpdateEdgePolicy(edge2); err != nil {
+			t.Fatalf("unable to update edge: %v", err)
+		}
+
+		// Bump the update time of the first policy, which should
+		// replace its entry within the index.
+		edge1.LastUpdate = edge1.LastUpdate.Add(time.Hour)
+		if err := graph.UpdateEdgePolicy(edge1); err != nil {
+			t.Fatalf("unable to update edge: %v", err)
+		}
+
+		edges = append(edges, edgeInfo)
+	}
+	assertUpdateIndexMirror(t, db)
+
+	// Re-announcing a node with a new timestamp should also replace its
+	// entry.
+	nodes[0].LastUpdate = nodes[0].LastUpdate.Add(time.Hour)
+	if err := graph.AddLightningNode(nodes[0]); err != nil {
+		t.Fatalf("unable to update node: %v", err)
+	}
+	assertUpdateIndexMirror(t, db)
+
+	// Removing a channel and a node should remove their entries as well.
+	if err := graph.DeleteChannelEdge(&edges[0].ChannelPoint); err != nil {
+		t.Fatalf("unable to delete edge: %v", err)
+	}
+	assertUpdateIndexMirror(t, db)
+
+	pub, err := nodes[0].PubKey()
+	if err != nil {
+		t.Fatalf("unable to parse pubkey: %v", err)
+	}
+	if err := graph.DeleteLightningNode(pub); err != nil {
+		t.Fatalf("unable to delete node: %v", err)
+	}
+	assertUpdateIndexMirror(t, db)
+
+	// A transaction that fails shouldn't leave any trace in the mirror.
+	node, err := createTestVertex(db)
+	if err != nil {
+		t.Fatalf("unable to create test node: %v", err)
+	}
+	errAbort := fmt.Errorf("abort")
+	err = db.updateGraph(func(tx *bbolt.Tx) error {
+		err := addLightningNode(tx, node, db.updateIndexCache)
+		if err != nil {
+			return err
+		}
+
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatalf("expected abort error, got: %v", err)
+	}
+	assertUpdateIndexMirror(t, db)
+
+	// Finally, the horizon queries should yield the same results when
+	// served from the mirror as when served from disk.
+	start := time.Unix(0, 0)
+	end := time.Unix(math.MaxInt64, 0)
+
+	cachedNodes, err := graph.NodeUpdatesInHorizon(start, end)
+	if err != nil {
+		t.Fatalf("unable to query node horizon: %v", err)
+	}
+	cachedEdges, err := graph.ChanUpdatesInHorizon(start, end)
+	if err != nil {
+		t.Fatalf("unable to query chan horizon: %v", err)
+	}
+
+	cache := db.updateIndexCache
+	db.updateIndexCache = nil
+
+	diskNodes, err := graph.NodeUpdatesInHorizon(start, end)
+	if err != nil {
+		t.Fatalf("unable to query node horizon: %v", err)
+	}
+	diskEdges, err := graph.ChanUpdatesInHorizon(start, end)
+	if err != nil {
+		t.Fatalf("unable to query chan horizon: %v", err)
+	}
+
+	db.updateIndexCache = cache
+
+	if len(cachedNodes) != numNodes-1 {
+		t.Fatalf("expected %v nodes, got %v", numNodes-1,
+			len(cachedNodes))
+	}
+	if len(cachedNodes) != len(diskNodes) {
+		t.Fatalf("expected %v nodes from mirror, got %v",
+			len(diskNodes), len(cachedNodes))
+	}
+	for i := range diskNodes {
+		if cachedNodes[i].PubKeyBytes != diskNodes[i].PubKeyBytes {
+			t.Fatalf("node %v mismatch: expected %x, got %x", i,
+				diskNodes[i].PubKeyBytes,
+				cachedNodes[i].PubKeyBytes)
+		}
+	}
+
+	if len(cachedEdges) != len(diskEdges) {
+		t.Fatalf("expected %v edges from mirror, got %v",
+			len(diskEdges), len(cachedEdges))
+	}
+	for i := range diskEdges {
+		cachedID := cachedEdges[i].Info.ChannelID
+		diskID := diskEdges[i].Info.ChannelID
+		if cachedID != diskID {
+			t.Fatalf("edge %v mismatch: expected %v, got %v", i,
+				diskID, cachedID)
+		}
+	}
+}
+
+// TestUpdateIndexCacheBound asserts that the mirror refuses to be built if the
+// indexes are larger than its bound, and that it falls back to disk once it
+// outgrows the bound at runtime.
+func TestUpdateIndexCacheBound(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	graph := db.ChannelGraph()
+
+	addNode := func() {
+		node, err := createTestVertex(db)
+		if err != nil {
+			t.Fatalf("unable to create test node: %v", err)
+		}
+		node.LastUpdate = time.Unix(1000, 0)
+		if err := graph.AddLightningNode(node); err != nil {
+			t.Fatalf("unable to add node: %v", err)
+		}
+	}
+
+	addNode()
+	addNode()
+
+	if err := db.EnableUpdateIndexCache(1); err == nil {
+		t.Fatalf("expected cache exceeding bound to be rejected")
+	}
+	if db.updateIndexCache != nil {
+		t.Fatalf("cache should not be enabled")
+	}
+
+	if err := db.EnableUpdateIndexCache(3); err != nil {
+		t.Fatalf("unable to enable update index cache: %v", err)
+	}
+	addNode()
+	assertUpdateIndexMirror(t, db)
+
+	// Adding one more node pushes the mirror past its bound, after which
+	// it should be disabled while queries continue to be served from disk.
+	addNode()
+	if !db.updateIndexCache.disabled {
+		t.Fatalf("expected cache to be disabled")
+	}
+
+	nodes, err := graph.NodeUpdatesInHorizon(
+		time.Unix(0, 0), time.Unix(math.MaxInt64, 0),
+	)
+	if err != nil {
+		t.Fatalf("unable to query node horizon: %v", err)
+	}
+	if len(nodes) != 4 {
+		t.Fatalf("expected 4 nodes, got %v", len(nodes))
+	}
+}
@@ -0,0 +1,108 @@
+package channeldb
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+var (
+	// validatedSigBucket is a sub-bucket of the edgeBucket that records
+	// the channel updates whose signature has already been validated, such
+	// that they needn't be validated again after a restart. As the update
+	// time distinguishes the successive updates of a channel, an entry
+	// only vouches for the exact update it was recorded for.
+	//
+	// maps: chanID || updateTime -> nil
+	validatedSigBucket = []byte("validated-sigs")
+)
+
+// MarkPolicyValidated records that the signature of the channel update with
+// the passed channel ID and update time has been validated.
+func (c *ChannelGraph) MarkPolicyValidated(chanID uint64,
+	updateTime time.Time) error {
+
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		edges, err := tx.CreateBucketIfNotExists(edgeBucket)
+		if err != nil {
+			return err
+		}
+		validated, err := edges.CreateBucketIfNotExists(
+			validatedSigBucket,
+		)
+		if err != nil {
+			return err
+		}
+
+		key := validatedSigKey(chanID, updateTime)
+		return validated.Put(key[:], nil)
+	})
+}
+
+// IsPolicyValidated returns true if the signature of the channel update with
+// the passed channel ID and update time was previously marked as validated.
+// If the record can't be read, the update is reported as not validated, such
+// that its signature is validated once more.
+func (c *ChannelGraph) IsPolicyValidated(chanID uint64,
+	updateTime time.Time) bool {
+
+	var isValidated bool
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		edges := tx.Bucket(edgeBucket)
+		if edges == nil {
+			return nil
+		}
+		validated := edges.Bucket(validatedSigBucket)
+		if validated == nil {
+			return nil
+		}
+
+		key := validatedSigKey(chanID, updateTime)
+		k, _ := validated.Cursor().Seek(key[:])
+		isValidated = bytes.Equal(k, key[:])
+
+		return nil
+	})
+	if err != nil {
+		log.Debugf("Unable to look up validated signature of channel "+
+			"%v: %v", chanID, err)
+		return false
+	}
+
+	return isValidated
+}
+
+// delValidatedSigs removes all validated signature records of the channel
+// with the passed channel ID.
+func delValidatedSigs(edges *bbolt.Bucket, chanID []byte) error {
+	validated := edges.Bucket(validatedSigBucket)
+	if validated == nil {
+		return nil
+	}
+
+	var keys [][]byte
+	cursor := validated.Cursor()
+	k, _ := cursor.Seek(chanID)
+	for ; bytes.HasPrefix(k, chanID); k, _ = cursor.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+
+	for _, k := range keys {
+		if err := validated.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validatedSigKey returns the key of a channel update within the validated
+// signature bucket.
+func validatedSigKey(chanID uint64, updateTime time.Time) [16]byte {
+	var key [16]byte
+	byteOrder.PutUint64(key[:8], chanID)
+	byteOrder.PutUint64(key[8:], uint64(updateTime.Unix()))
+
+	return key
+}
@@ -0,0 +1,67 @@
+package channeldb
+
+import (
+	"testing"
+	"time"
+)
+
+// TestValidatedPolicySignatures asserts that only the exact channel updates
+// marked as validated are reported as such, and that their records are
+// removed along with their channel.
+func TestValidatedPolicySignatures(t *testing.T) {
+	t.Parallel()
+
+	db, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test db: %v", err)
+	}
+
+	graph := db.ChannelGraph()
+	node1, err := createTestVertex(db)
+	if err != nil {
+		t.Fatalf("unable to create test node: %v", err)
+	}
+	node2, err := createTestVertex(db)
+	if err != nil {
+		t.Fatalf("unable to create test node: %v", err)
+	}
+	for _, node := range []*LightningNode{node1, node2} {
+		if err := graph.AddLightningNode(node); err != nil {
+			t.Fatalf("unable to add node: %v", err)
+		}
+	}
+
+	edgeInfo, _, _ := createChannelEdge(db, node1, node2)
+	if err := graph.AddChannelEdge(edgeInfo); err != nil {
+		t.Fatalf("unable to add edge: %v", err)
+	}
+	chanID := edgeInfo.ChannelID
+
+	updateTime := time.Unix(1000, 0)
+	if graph.IsPolicyValidated(chanID, updateTime) {
+		t.Fatalf("expected update to not be validated yet")
+	}
+	if err := graph.MarkPolicyValidated(chanID, updateTime); err != nil {
+		t.Fatalf("unable to mark policy validated: %v", err)
+	}
+
+	if !graph.IsPolicyValidated(chanID, updateTime) {
+		t.Fatalf("expected update to be validated")
+	}
+	if graph.IsPolicyValidated(chanID, updateTime.Add(time.Second)) {
+		t.Fatalf("expected later update to not be validated")
+	}
+	if graph.IsPolicyValidated(chanID+1, updateTime) {
+		t.Fatalf("expected update of other channel to not be " +
+			"validated")
+	}
+
+	// Once the channel is removed from the graph, so is its record.
+	if err := graph.DeleteChannelEdge(&edgeInfo.ChannelPoint); err != nil {
+		t.Fatalf("unable to delete edge: %v", err)
+	}
+	if graph.IsPolicyValidated(chanID, updateTime) {
+		t.Fatalf("expected record to be removed with its channel")
+	}
+}
@@ -279,10 +279,20 @@ var (
 	errNoActions = fmt.Errorf("no chain actions exist")
 )
 
+// arbitratorLogDB is the database a boltArbitratorLog is stored within. It's
+// satisfied by both a bolt DB instance and a channeldb.DB, which must be
+// passed in place of its bolt DB, as the latter is replaced once the database
+// is compacted.
+type arbitratorLogDB interface {
+	View(fn func(tx *bbolt.Tx) error) error
+	Update(fn func(tx *bbolt.Tx) error) error
+	Batch(fn func(tx *bbolt.Tx) error) error
+}
+
 // boltArbitratorLog is an implementation of the ArbitratorLog interface backed
 // by a bolt DB instance.
 type boltArbitratorLog struct {
-	db *bbolt.DB
+	db arbitratorLogDB
 
 	cfg ChannelArbitratorConfig
 
@@ -291,7 +301,7 @@ type boltArbitratorLog struct {
 
 // newBoltArbitratorLog returns a new instance of the boltArbitratorLog given
 // an arbitrator config, and the items needed to create its log scope.
-func newBoltArbitratorLog(db *bbolt.DB, cfg ChannelArbitratorConfig,
+func newBoltArbitratorLog(db arbitratorLogDB, cfg ChannelArbitratorConfig,
 	chainHash chainhash.Hash, chanPoint wire.OutPoint) (*boltArbitratorLog, error) {
 
 	scope, err := newLogScope(chainHash, chanPoint)
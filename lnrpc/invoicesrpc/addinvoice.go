@@ -389,6 +389,13 @@ func AddInvoice(ctx context.Context, cfg *AddInvoiceConfig,
 		return nil, nil, err
 	}
 
+	// The encoded request is decoded to learn its destination, such that
+	// its fields can be stored along with the invoice.
+	decodedPayReq, err := zpay32.Decode(payReqString, cfg.ChainParams)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	newInvoice := &channeldb.Invoice{
 		CreationDate:   creationDate,
 		Memo:           []byte(invoice.Memo),
@@ -398,6 +405,10 @@ func AddInvoice(ctx context.Context, cfg *AddInvoiceConfig,
 			Value:           amtMSat,
 			PaymentPreimage: paymentPreimage,
 		},
+		RouteHints: payReq.RouteHints,
+		PaymentRequestFields: channeldb.NewPaymentRequestFields(
+			decodedPayReq,
+		),
 	}
 
 	log.Tracef("[addinvoice] adding new invoice %v",
@@ -409,15 +409,22 @@ type RestrictParams struct {
 func findPath(g *graphParams, r *RestrictParams, source, target Vertex,
 	amt lnwire.MilliSatoshi) ([]*channeldb.ChannelEdgePolicy, error) {
 
-	var err error
-	tx := g.tx
-	if tx == nil {
-		tx, err = g.graph.Database().Begin(false)
-		if err != nil {
-			return nil, err
-		}
-		defer tx.Rollback()
+	// If no transaction was passed in, we'll search within a new one. It's
+	// opened through the database rather than bolt directly, such that it
+	// can't overlap the database being replaced by its compacted copy.
+	if g.tx == nil {
+		var path []*channeldb.ChannelEdgePolicy
+		err := g.graph.Database().View(func(tx *bbolt.Tx) error {
+			txParams := *g
+			txParams.tx = tx
+
+			var err error
+			path, err = findPath(&txParams, r, source, target, amt)
+			return err
+		})
+		return path, err
 	}
+	tx := g.tx
 
 	// First we'll initialize an empty heap which'll help us to quickly
 	// locate the next edge we should visit next during our graph
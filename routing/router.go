@@ -621,6 +621,17 @@ func (r *ChannelRouter) pruneZombieChans() error {
 
 	log.Infof("Examining Channel Graph for zombie channels")
 
+	// Channels pinned by the operator are never pruned, so we'll fetch
+	// them up front to skip them below.
+	pinnedChans, err := r.cfg.Graph.PinnedEdges()
+	if err != nil {
+		return fmt.Errorf("unable to fetch pinned chans: %v", err)
+	}
+	pinned := make(map[uint64]struct{}, len(pinnedChans))
+	for _, chanID := range pinnedChans {
+		pinned[chanID] = struct{}{}
+	}
+
 	// First, we'll collect all the channels which are eligible for garbage
 	// collection due to being zombies.
 	filterPruneChans := func(info *channeldb.ChannelEdgeInfo,
@@ -634,6 +645,9 @@ func (r *ChannelRouter) pruneZombieChans() error {
 
 			return nil
 		}
+		if _, ok := pinned[info.ChannelID]; ok {
+			return nil
+		}
 
 		// If *both* edges haven't been updated for a period of
 		// chanExpiry, then we'll mark the channel itself as eligible
@@ -675,7 +689,7 @@ func (r *ChannelRouter) pruneZombieChans() error {
 	r.rejectMtx.Lock()
 	defer r.rejectMtx.Unlock()
 
-	err := r.cfg.Graph.ForEachChannel(filterPruneChans)
+	err = r.cfg.Graph.ForEachChannel(filterPruneChans)
 	if err != nil {
 		return fmt.Errorf("Unable to filter local zombie "+
 			"chans: %v", err)
@@ -1385,26 +1399,22 @@ func (r *ChannelRouter) FindRoutes(source, target Vertex,
 		return nil, err
 	}
 
-	tx, err := r.cfg.Graph.Database().Begin(false)
-	if err != nil {
-		tx.Rollback()
-		return nil, err
-	}
-
 	// Now that we know the destination is reachable within the graph,
 	// we'll execute our KSP algorithm to find the k-shortest paths from
 	// our source to the destination.
-	shortestPaths, err := findPaths(
-		tx, r.cfg.Graph, source, target, amt, restrictions,
-		numPaths, bandwidthHints,
-	)
+	var shortestPaths [][]*channeldb.ChannelEdgePolicy
+	err = r.cfg.Graph.Database().View(func(tx *bbolt.Tx) error {
+		var err error
+		shortestPaths, err = findPaths(
+			tx, r.cfg.Graph, source, target, amt, restrictions,
+			numPaths, bandwidthHints,
+		)
+		return err
+	})
 	if err != nil {
-		tx.Rollback()
 		return nil, err
 	}
 
-	tx.Rollback()
-
 	// Now that we have a set of paths, we'll need to turn them into
 	// *routes* by computing the required time-lock and fee information for
 	// each path. During this process, some paths may be discarded if they
@@ -1855,6 +1855,11 @@ func (r *rpcServer) AbandonChannel(ctx context.Context,
 		RemoteCurrentRevocation: dbChan.RemoteCurrentRevocation,
 		RemoteNextRevocation:    dbChan.RemoteNextRevocation,
 		LocalChanConfig:         dbChan.LocalChanCfg,
+
+		// As we remove all state required to claim our balance, it's
+		// considered lost unless we had none.
+		AbandonReason: "abandoned via AbandonChannel rpc",
+		FundsLost:     dbChan.LocalCommitment.LocalBalance > 0,
 	}
 
 	// Finally, we'll close the channel in the DB, and return back to the
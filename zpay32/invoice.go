@@ -478,6 +478,18 @@ func (invoice *Invoice) MinFinalCLTVExpiry() uint64 {
 	return DefaultFinalCLTVDelta
 }
 
+// HasExpiry returns whether the expiry time of the invoice was set explicitly,
+// rather than implied by its absence.
+func (invoice *Invoice) HasExpiry() bool {
+	return invoice.expiry != nil
+}
+
+// HasMinFinalCLTVExpiry returns whether the minimum final CLTV expiry delta
+// of the invoice was set explicitly, rather than implied by its absence.
+func (invoice *Invoice) HasMinFinalCLTVExpiry() bool {
+	return invoice.minFinalCLTVExpiry != nil
+}
+
 // validateInvoice does a sanity check of the provided Invoice, making sure it
 // has all the necessary fields set for it to be considered valid by BOLT-0011.
 func validateInvoice(invoice *Invoice) error {